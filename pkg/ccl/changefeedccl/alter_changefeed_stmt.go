@@ -60,6 +60,8 @@ func alterChangefeedTypeCheck(
 				KVOptions:  v.Options,
 				Validation: changefeedvalidators.AlterOptionValidations,
 			})
+		case *tree.AlterChangefeedSetTargetTopic:
+			toCheck = append(toCheck, exprutil.Strings{v.Topic})
 		}
 	}
 	if err := exprutil.TypeCheck(ctx, "ALTER CHANGEFED", p.SemaCtx(), toCheck...); err != nil {
@@ -114,6 +116,15 @@ func alterChangefeedPlanHook(
 			return errors.Errorf(`job %d is not paused`, jobID)
 		}
 
+		if len(prevDetails.AdditionalSinkURIs) > 0 {
+			return errors.Errorf(`ALTER CHANGEFEED is not supported for changefeeds emitting to multiple sinks`)
+		}
+
+		if prevDetails.TenantID.IsSet() {
+			return errors.Errorf(`ALTER CHANGEFEED is not supported for changefeeds created with the %s option`,
+				changefeedbase.OptTenant)
+		}
+
 		newChangefeedStmt := &tree.CreateChangefeed{}
 
 		prevOpts, err := getPrevOpts(job.Payload().Description, prevDetails.Opts)
@@ -127,8 +138,15 @@ func alterChangefeedPlanHook(
 		if err != nil {
 			return err
 		}
+		overrides, err := newOptions.GetSettingsOverrides()
+		if err != nil {
+			return err
+		}
+		if err := authorizeUserToOverrideSettings(ctx, p, overrides); err != nil {
+			return err
+		}
 
-		newTargets, newProgress, newStatementTime, originalSpecs, err := generateAndValidateNewTargets(
+		newTargets, newProgress, newStatementTime, originalSpecs, endOfStreamTargets, err := generateAndValidateNewTargets(
 			ctx, exprEval, p,
 			alterChangefeedStmt.Cmds,
 			newOptions.AsMap(), // TODO: Remove .AsMap()
@@ -173,6 +191,7 @@ func alterChangefeedPlanHook(
 			p,
 			annotatedStmt,
 			newSinkURI,
+			nil, /* additionalSinkURIs */
 			newOptions,
 			jobID,
 			``,
@@ -197,6 +216,36 @@ func alterChangefeedPlanHook(
 			return err
 		}
 		newPayload.MaximumPTSAge = newExpiration
+		newExpirationAction, err := newOptions.GetPTSExpirationAction()
+		if err != nil {
+			return err
+		}
+		newPayload.ReleasePTSOnExpiration = newExpirationAction == changefeedbase.OptPTSExpirationActionRelease
+		if len(endOfStreamTargets) > 0 {
+			if err := validateTargetMarkersFormat(prevDetails, changefeedbase.OptEndOfStream); err != nil {
+				return err
+			}
+			// The end-of-stream markers are recorded in the progress of the
+			// job rather than emitted here, so that they're only emitted, by
+			// the changefeed as it resumes, once the alteration has committed.
+			cf := newProgress.GetChangefeed()
+			if cf == nil {
+				cf = &jobspb.ChangefeedProgress{}
+				newProgress.Details = jobspb.WrapProgressDetails(*cf)
+				cf = newProgress.GetChangefeed()
+			}
+			for _, t := range endOfStreamTargets {
+				cf.EndOfStreamTargets = append(cf.EndOfStreamTargets, jobspb.ChangefeedTargetSpecification{
+					Type:              t.Type,
+					TableID:           t.TableID,
+					FamilyName:        t.FamilyName,
+					StatementTimeName: string(t.StatementTimeName),
+					IndexID:           t.IndexID,
+					TopicName:         t.TopicName,
+				})
+			}
+		}
+
 		j, err := p.ExecCfg().JobRegistry.LoadJobWithTxn(ctx, jobID, p.InternalSQLTxn())
 		if err != nil {
 			return err
@@ -347,6 +396,7 @@ func generateAndValidateNewTargets(
 	*jobspb.Progress,
 	hlc.Timestamp,
 	map[tree.ChangefeedTarget]jobspb.ChangefeedTargetSpecification,
+	[]changefeedbase.Target,
 	error,
 ) {
 
@@ -365,6 +415,12 @@ func generateAndValidateNewTargets(
 	// name of the target was modified.
 	originalSpecs := make(map[tree.ChangefeedTarget]jobspb.ChangefeedTargetSpecification)
 
+	// prevTargetSpecs and endOfStreamTargets track the targets that existed
+	// prior to the alteration of the changefeed, and those among them that
+	// were dropped with the end_of_stream option.
+	prevTargetSpecs := make(map[targetKey]changefeedbase.Target)
+	var endOfStreamTargets []changefeedbase.Target
+
 	// We want to store the value of whether or not the original changefeed had
 	// initial_scan set to only so that we only do an initial scan on an alter
 	// changefeed with initial_scan = 'only' if the original one also had
@@ -399,17 +455,18 @@ func generateAndValidateNewTargets(
 	// perform these validations in the validateNewTargets function.
 	allDescs, err := backupresolver.LoadAllDescs(ctx, p.ExecCfg(), statementTime)
 	if err != nil {
-		return nil, nil, hlc.Timestamp{}, nil, err
+		return nil, nil, hlc.Timestamp{}, nil, nil, err
 	}
 	descResolver, err := backupresolver.NewDescriptorResolver(allDescs)
 	if err != nil {
-		return nil, nil, hlc.Timestamp{}, nil, err
+		return nil, nil, hlc.Timestamp{}, nil, nil, err
 	}
 
 	prevTargets := AllTargets(prevDetails)
 	noLongerExist := make(map[string]descpb.ID)
 	err = prevTargets.EachTarget(func(targetSpec changefeedbase.Target) error {
 		k := targetKey{TableID: targetSpec.TableID, FamilyName: tree.Name(targetSpec.FamilyName)}
+		prevTargetSpecs[k] = targetSpec
 		var desc catalog.TableDescriptor
 		if d, exists := descResolver.DescByID[targetSpec.TableID]; exists {
 			desc = d.(catalog.TableDescriptor)
@@ -421,7 +478,7 @@ func generateAndValidateNewTargets(
 			return nil
 		}
 
-		tbName, err := getQualifiedTableNameObj(ctx, p.ExecCfg(), p.Txn(), desc)
+		tbName, err := getQualifiedTableNameObj(ctx, p.ExecCfg(), prevDetails.TenantID, p.Txn(), desc)
 		if err != nil {
 			return err
 		}
@@ -434,6 +491,15 @@ func generateAndValidateNewTargets(
 		newTarget := tree.ChangefeedTarget{
 			TableName:  tablePattern,
 			FamilyName: tree.Name(targetSpec.FamilyName),
+			Sequence:   desc.IsSequence(),
+		}
+		if targetSpec.Type == jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX {
+			// The index may have been renamed since it was targeted.
+			index := catalog.FindIndexByID(desc, targetSpec.IndexID)
+			if index == nil {
+				return errors.Errorf(`index %d of table %s no longer exists`, targetSpec.IndexID, desc.GetName())
+			}
+			newTarget.IndexName = tree.UnrestrictedName(index.GetName())
 		}
 		newTargets[k] = newTarget
 		newTableDescs[targetSpec.TableID] = descResolver.DescByID[targetSpec.TableID]
@@ -443,12 +509,14 @@ func generateAndValidateNewTargets(
 			TableID:           targetSpec.TableID,
 			FamilyName:        targetSpec.FamilyName,
 			StatementTimeName: string(targetSpec.StatementTimeName),
+			IndexID:           targetSpec.IndexID,
+			TopicName:         targetSpec.TopicName,
 		}
 		return nil
 	})
 
 	if err != nil {
-		return nil, nil, hlc.Timestamp{}, nil, err
+		return nil, nil, hlc.Timestamp{}, nil, nil, err
 	}
 
 	for _, cmd := range alterCmds {
@@ -458,7 +526,7 @@ func generateAndValidateNewTargets(
 				ctx, v.Options, changefeedvalidators.AlterTargetOptionValidations,
 			)
 			if err != nil {
-				return nil, nil, hlc.Timestamp{}, nil, err
+				return nil, nil, hlc.Timestamp{}, nil, nil, err
 			}
 
 			var withInitialScan bool
@@ -477,14 +545,14 @@ func generateAndValidateNewTargets(
 			}
 
 			if initialScanType != `` && initialScanType != `yes` && initialScanType != `no` && initialScanType != `only` {
-				return nil, nil, hlc.Timestamp{}, nil, pgerror.Newf(
+				return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
 					pgcode.InvalidParameterValue,
 					`cannot set initial_scan to %q. possible values for initial_scan are "yes", "no", "only", or no value`, changefeedbase.OptInitialScan,
 				)
 			}
 
 			if initialScanSet && noInitialScanSet {
-				return nil, nil, hlc.Timestamp{}, nil, pgerror.Newf(
+				return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
 					pgcode.InvalidParameterValue,
 					`cannot specify both %q and %q`, changefeedbase.OptInitialScan,
 					changefeedbase.OptNoInitialScan,
@@ -492,7 +560,7 @@ func generateAndValidateNewTargets(
 			}
 
 			if initialScanSet && initialScanOnlySet {
-				return nil, nil, hlc.Timestamp{}, nil, pgerror.Newf(
+				return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
 					pgcode.InvalidParameterValue,
 					`cannot specify both %q and %q`, changefeedbase.OptInitialScan,
 					changefeedbase.OptInitialScanOnly,
@@ -500,7 +568,7 @@ func generateAndValidateNewTargets(
 			}
 
 			if noInitialScanSet && initialScanOnlySet {
-				return nil, nil, hlc.Timestamp{}, nil, pgerror.Newf(
+				return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
 					pgcode.InvalidParameterValue,
 					`cannot specify both %q and %q`, changefeedbase.OptInitialScanOnly,
 					changefeedbase.OptNoInitialScan,
@@ -516,10 +584,10 @@ func generateAndValidateNewTargets(
 			for _, target := range v.Targets {
 				desc, found, err := getTargetDesc(ctx, p, descResolver, target.TableName)
 				if err != nil {
-					return nil, nil, hlc.Timestamp{}, nil, err
+					return nil, nil, hlc.Timestamp{}, nil, nil, err
 				}
 				if !found {
-					return nil, nil, hlc.Timestamp{}, nil, pgerror.Newf(
+					return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
 						pgcode.InvalidParameterValue,
 						`target %q does not exist`,
 						tree.ErrString(&target),
@@ -545,23 +613,34 @@ func generateAndValidateNewTargets(
 				withInitialScan,
 			)
 			if err != nil {
-				return nil, nil, hlc.Timestamp{}, nil, err
+				return nil, nil, hlc.Timestamp{}, nil, nil, err
 			}
 			telemetry.CountBucketed(telemetryPath+`.added_targets`, int64(len(v.Targets)))
 		case *tree.AlterChangefeedDropTarget:
+			dropOpts, err := exprEval.KVOptions(
+				ctx, v.Options, changefeedvalidators.AlterDropTargetOptionValidations,
+			)
+			if err != nil {
+				return nil, nil, hlc.Timestamp{}, nil, nil, err
+			}
+			_, endOfStream := dropOpts[changefeedbase.OptEndOfStream]
+
 			for _, target := range v.Targets {
 				desc, found, err := getTargetDesc(ctx, p, descResolver, target.TableName)
 				if err != nil {
-					return nil, nil, hlc.Timestamp{}, nil, err
+					return nil, nil, hlc.Timestamp{}, nil, nil, err
 				}
 				if !found {
 					if id, wasDeleted := noLongerExist[target.TableName.String()]; wasDeleted {
 						// Failed to lookup table because it was deleted.
 						k := targetKey{TableID: id, FamilyName: target.FamilyName}
 						droppedTargets[k] = target
+						if spec, ok := prevTargetSpecs[k]; ok && endOfStream {
+							endOfStreamTargets = append(endOfStreamTargets, spec)
+						}
 						continue
 					} else {
-						return nil, nil, hlc.Timestamp{}, nil, pgerror.Newf(
+						return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
 							pgcode.InvalidParameterValue,
 							`target %q does not exist`,
 							tree.ErrString(&target),
@@ -572,16 +651,55 @@ func generateAndValidateNewTargets(
 				droppedTargets[k] = target
 				_, recognized := newTargets[k]
 				if !recognized {
-					return nil, nil, hlc.Timestamp{}, nil, pgerror.Newf(
+					return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
 						pgcode.InvalidParameterValue,
 						`target %q already not watched by changefeed`,
 						tree.ErrString(&target),
 					)
 				}
+				if spec, ok := prevTargetSpecs[k]; ok && endOfStream {
+					endOfStreamTargets = append(endOfStreamTargets, spec)
+				}
 				newTableDescs[desc.GetID()] = desc
 				delete(newTargets, k)
 			}
 			telemetry.CountBucketed(telemetryPath+`.dropped_targets`, int64(len(v.Targets)))
+			if endOfStream {
+				telemetry.Count(telemetryPath + `.end_of_stream`)
+			}
+		case *tree.AlterChangefeedSetTargetTopic:
+			desc, found, err := getTargetDesc(ctx, p, descResolver, v.Target.TableName)
+			if err != nil {
+				return nil, nil, hlc.Timestamp{}, nil, nil, err
+			}
+			var target tree.ChangefeedTarget
+			if found {
+				target, found = newTargets[targetKey{TableID: desc.GetID(), FamilyName: v.Target.FamilyName}]
+			}
+			if !found {
+				return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
+					pgcode.InvalidParameterValue,
+					`target %q is not watched by changefeed`,
+					tree.ErrString(&v.Target),
+				)
+			}
+			// The topic name is kept in the spec of the target, which only
+			// targets watched before this statement have.
+			spec, ok := originalSpecs[target]
+			if !ok {
+				return nil, nil, hlc.Timestamp{}, nil, nil, pgerror.Newf(
+					pgcode.InvalidParameterValue,
+					`cannot set the topic of target %q added by the same statement`,
+					tree.ErrString(&v.Target),
+				)
+			}
+			topicName, err := exprEval.String(ctx, v.Topic)
+			if err != nil {
+				return nil, nil, hlc.Timestamp{}, nil, nil, err
+			}
+			spec.TopicName = topicName
+			originalSpecs[target] = spec
+			telemetry.Count(telemetryPath + `.set_target_topic`)
 		}
 	}
 
@@ -615,20 +733,20 @@ func generateAndValidateNewTargets(
 	for _, desc := range newTableDescs {
 		hasSelect, hasChangefeed, err := checkPrivilegesForDescriptor(ctx, p, desc)
 		if err != nil {
-			return nil, nil, hlc.Timestamp{}, nil, err
+			return nil, nil, hlc.Timestamp{}, nil, nil, err
 		}
 		hasSelectPrivOnAllTables = hasSelectPrivOnAllTables && hasSelect
 		hasChangefeedPrivOnAllTables = hasChangefeedPrivOnAllTables && hasChangefeed
 	}
-	if err := authorizeUserToCreateChangefeed(ctx, p, sinkURI, hasSelectPrivOnAllTables, hasChangefeedPrivOnAllTables); err != nil {
-		return nil, nil, hlc.Timestamp{}, nil, err
+	if err := authorizeUserToCreateChangefeed(ctx, p, []string{sinkURI}, hasSelectPrivOnAllTables, hasChangefeedPrivOnAllTables); err != nil {
+		return nil, nil, hlc.Timestamp{}, nil, nil, err
 	}
 
 	if err := validateNewTargets(ctx, p, newTargetList, newJobProgress, newJobStatementTime); err != nil {
-		return nil, nil, hlc.Timestamp{}, nil, err
+		return nil, nil, hlc.Timestamp{}, nil, nil, err
 	}
 
-	return newTargetList, &newJobProgress, newJobStatementTime, originalSpecs, nil
+	return newTargetList, &newJobProgress, newJobStatementTime, originalSpecs, endOfStreamTargets, nil
 }
 
 func validateNewTargets(
@@ -11,6 +11,7 @@ package changefeedccl
 import (
 	"context"
 	gosql "database/sql"
+	gojson "encoding/json"
 	"fmt"
 	"net/url"
 	"sync/atomic"
@@ -347,6 +348,66 @@ func TestAlterChangefeedDropTarget(t *testing.T) {
 	cdcTest(t, testFn, feedTestEnterpriseSinks, feedTestNoExternalConnection)
 }
 
+func TestAlterChangefeedDropTargetEndOfStream(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `CREATE TABLE bar (a INT PRIMARY KEY)`)
+
+		testFeed := feed(t, f, `CREATE CHANGEFEED FOR foo, bar`)
+		defer closeFeed(t, testFeed)
+
+		sqlDB.Exec(t, `INSERT INTO foo VALUES(1)`)
+		sqlDB.Exec(t, `INSERT INTO bar VALUES(2)`)
+		assertPayloads(t, testFeed, []string{
+			`foo: [1]->{"after": {"a": 1}}`,
+			`bar: [2]->{"after": {"a": 2}}`,
+		})
+
+		feed, ok := testFeed.(cdctest.EnterpriseTestFeed)
+		require.True(t, ok)
+
+		sqlDB.Exec(t, `PAUSE JOB $1`, feed.JobID())
+		waitForJobStatus(sqlDB, t, feed.JobID(), `paused`)
+
+		sqlDB.ExpectErr(t, `option "end_of_stream" does not take a value`,
+			fmt.Sprintf(`ALTER CHANGEFEED %d DROP bar WITH end_of_stream = 'yes'`, feed.JobID()))
+
+		sqlDB.Exec(t, fmt.Sprintf(`ALTER CHANGEFEED %d DROP bar WITH end_of_stream`, feed.JobID()))
+
+		// The marker is only emitted by the changefeed once it resumes, after
+		// the alteration committed.
+		registry := s.Server.JobRegistry().(*jobs.Registry)
+		job, err := registry.LoadJob(context.Background(), feed.JobID())
+		require.NoError(t, err)
+		require.Len(t, job.Progress().GetChangefeed().EndOfStreamTargets, 1)
+
+		sqlDB.Exec(t, fmt.Sprintf(`RESUME JOB %d`, feed.JobID()))
+		waitForJobStatus(sqlDB, t, feed.JobID(), `running`)
+
+		// Only the dropped target's topic is sent the end-of-stream marker.
+		m, err := testFeed.Next()
+		require.NoError(t, err)
+		require.Equal(t, `bar`, m.Topic)
+		var marker struct {
+			EndOfStream string `json:"end_of_stream"`
+		}
+		require.NoError(t, gojson.Unmarshal(m.Resolved, &marker))
+		require.NotEmpty(t, marker.EndOfStream)
+
+		sqlDB.Exec(t, `INSERT INTO bar VALUES(3)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES(4)`)
+		assertPayloads(t, testFeed, []string{
+			`foo: [4]->{"after": {"a": 4}}`,
+		})
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"), feedTestNoExternalConnection)
+}
+
 func TestAlterChangefeedDropTargetAfterTableDrop(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -414,6 +475,52 @@ func TestAlterChangefeedDropTargetFamily(t *testing.T) {
 	cdcTest(t, testFn, feedTestEnterpriseSinks, feedTestNoExternalConnection)
 }
 
+func TestAlterChangefeedSetTargetTopic(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `CREATE TABLE bar (a INT PRIMARY KEY)`)
+
+		testFeed := feed(t, f, `CREATE CHANGEFEED FOR foo`)
+		defer closeFeed(t, testFeed)
+
+		sqlDB.Exec(t, `INSERT INTO foo VALUES(1)`)
+		assertPayloads(t, testFeed, []string{
+			`foo: [1]->{"after": {"a": 1}}`,
+		})
+
+		feed, ok := testFeed.(cdctest.EnterpriseTestFeed)
+		require.True(t, ok)
+
+		sqlDB.Exec(t, `PAUSE JOB $1`, feed.JobID())
+		waitForJobStatus(sqlDB, t, feed.JobID(), `paused`)
+
+		sqlDB.ExpectErr(t, `target "bar" is not watched by changefeed`,
+			fmt.Sprintf(`ALTER CHANGEFEED %d SET TARGET bar TOPIC 'legacy_bar'`, feed.JobID()))
+		sqlDB.ExpectErr(t, `cannot set the topic of target "bar" added by the same statement`,
+			fmt.Sprintf(`ALTER CHANGEFEED %d ADD bar SET TARGET bar TOPIC 'legacy_bar'`, feed.JobID()))
+
+		sqlDB.Exec(t, fmt.Sprintf(`ALTER CHANGEFEED %d SET TARGET foo TOPIC 'legacy_foo'`, feed.JobID()))
+		// The topic name persists when the changefeed is altered again.
+		sqlDB.Exec(t, fmt.Sprintf(`ALTER CHANGEFEED %d ADD bar`, feed.JobID()))
+
+		sqlDB.Exec(t, fmt.Sprintf(`RESUME JOB %d`, feed.JobID()))
+		waitForJobStatus(sqlDB, t, feed.JobID(), `running`)
+
+		sqlDB.Exec(t, `INSERT INTO foo VALUES(2)`)
+		sqlDB.Exec(t, `INSERT INTO bar VALUES(1)`)
+		assertPayloads(t, testFeed, []string{
+			`legacy_foo: [2]->{"after": {"a": 2}}`,
+			`bar: [1]->{"after": {"a": 1}}`,
+		})
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"), feedTestNoExternalConnection)
+}
+
 func TestAlterChangefeedSetDiffOption(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
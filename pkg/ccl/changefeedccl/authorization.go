@@ -11,6 +11,7 @@ package changefeedccl
 import (
 	"context"
 	"net/url"
+	"strings"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/cloud/externalconn"
@@ -65,7 +66,7 @@ func checkPrivilegesForDescriptor(
 func authorizeUserToCreateChangefeed(
 	ctx context.Context,
 	p sql.PlanHookState,
-	sinkURI string,
+	sinkURIs []string,
 	hasSelectPrivOnAllTables bool,
 	hasChangefeedPrivOnAllTables bool,
 ) error {
@@ -92,7 +93,7 @@ func authorizeUserToCreateChangefeed(
 		return nil
 	}
 
-	if sinkURI == "" {
+	if len(sinkURIs) == 0 || sinkURIs[0] == "" {
 		if !hasSelectPrivOnAllTables {
 			return pgerror.Newf(pgcode.InsufficientPrivilege,
 				`user %s requires the %s privilege on all target tables to be able to run a core changefeed`,
@@ -109,27 +110,29 @@ func authorizeUserToCreateChangefeed(
 
 	enforceExternalConnections := changefeedbase.RequireExternalConnectionSink.Get(&p.ExecCfg().Settings.SV)
 	if enforceExternalConnections {
-		uri, err := url.Parse(sinkURI)
-		if err != nil {
-			return errors.Newf("failed to parse url %s", sinkURI)
-		}
-		if uri.Scheme == changefeedbase.SinkSchemeExternalConnection {
-			ec, err := externalconn.LoadExternalConnection(ctx, uri.Host, p.InternalSQLTxn())
+		for _, sinkURI := range sinkURIs {
+			uri, err := url.Parse(sinkURI)
 			if err != nil {
-				return errors.Wrap(err, "failed to load external connection object")
-			}
-			ecPriv := &syntheticprivilege.ExternalConnectionPrivilege{
-				ConnectionName: ec.ConnectionName(),
+				return errors.Newf("failed to parse url %s", sinkURI)
 			}
-			if err := p.CheckPrivilege(ctx, ecPriv, privilege.USAGE); err != nil {
-				return err
+			if uri.Scheme == changefeedbase.SinkSchemeExternalConnection {
+				ec, err := externalconn.LoadExternalConnection(ctx, uri.Host, p.InternalSQLTxn())
+				if err != nil {
+					return errors.Wrap(err, "failed to load external connection object")
+				}
+				ecPriv := &syntheticprivilege.ExternalConnectionPrivilege{
+					ConnectionName: ec.ConnectionName(),
+				}
+				if err := p.CheckPrivilege(ctx, ecPriv, privilege.USAGE); err != nil {
+					return err
+				}
+			} else {
+				return pgerror.Newf(
+					pgcode.InsufficientPrivilege,
+					`the %s privilege on all tables can only be used with external connection sinks. see cluster setting %s`,
+					privilege.CHANGEFEED, changefeedbase.RequireExternalConnectionSink.Key(),
+				)
 			}
-		} else {
-			return pgerror.Newf(
-				pgcode.InsufficientPrivilege,
-				`the %s privilege on all tables can only be used with external connection sinks. see cluster setting %s`,
-				privilege.CHANGEFEED, changefeedbase.RequireExternalConnectionSink.Key(),
-			)
 		}
 	}
 
@@ -169,3 +172,78 @@ func AuthorizeChangefeedJobAccess(
 func init() {
 	jobsauth.RegisterAuthorizer(jobspb.TypeChangefeed, AuthorizeChangefeedJobAccess)
 }
+
+// authorizeUserToUseSchemaRegistry checks that the user has the USAGE
+// privilege on the external connection, if any, to which the
+// confluent_schema_registry option of a changefeed refers.
+func authorizeUserToUseSchemaRegistry(
+	ctx context.Context, p sql.PlanHookState, registryURI string,
+) error {
+	if registryURI == "" {
+		return nil
+	}
+	uri, err := url.Parse(registryURI)
+	if err != nil {
+		return errors.Newf("failed to parse url %s", registryURI)
+	}
+	if uri.Scheme != changefeedbase.SinkSchemeExternalConnection {
+		return nil
+	}
+	ec, err := externalconn.LoadExternalConnection(ctx, uri.Host, p.InternalSQLTxn())
+	if err != nil {
+		return errors.Wrap(err, "failed to load external connection object")
+	}
+	ecPriv := &syntheticprivilege.ExternalConnectionPrivilege{
+		ConnectionName: ec.ConnectionName(),
+	}
+	return p.CheckPrivilege(ctx, ecPriv, privilege.USAGE)
+}
+
+// authorizeUserToDeleteEmittedRows checks that the user has the DELETE
+// privilege on the target table desc, whose rows a changefeed with the
+// delete_after_emit option deletes once they are emitted.
+func authorizeUserToDeleteEmittedRows(
+	ctx context.Context, p sql.PlanHookState, desc catalog.Descriptor,
+) error {
+	return p.CheckPrivilege(ctx, desc, privilege.DELETE)
+}
+
+// authorizeUserToWriteTable checks that the user has the INSERT privilege on
+// the table desc, into which a changefeed with the dead_letter_table option
+// writes the events which fail to be encoded, or one with the
+// content_digest_table option writes the digests of its messages.
+func authorizeUserToWriteTable(
+	ctx context.Context, p sql.PlanHookState, desc catalog.Descriptor,
+) error {
+	return p.CheckPrivilege(ctx, desc, privilege.INSERT)
+}
+
+// authorizeUserToOverrideSettings checks that the user has the admin role or
+// the MODIFYCLUSTERSETTING privilege if the settings option of the changefeed
+// raises any cluster setting above its value for the cluster, since the
+// changefeed could otherwise use more of the resources of the cluster than its
+// operators allowed for. Lowering the settings requires no privilege.
+func authorizeUserToOverrideSettings(
+	ctx context.Context, p sql.PlanHookState, overrides changefeedbase.SettingsOverrides,
+) error {
+	raised := overrides.Raised(&p.ExecCfg().Settings.SV)
+	if len(raised) == 0 {
+		return nil
+	}
+	isAdmin, err := p.HasAdminRole(ctx)
+	if err != nil || isAdmin {
+		return err
+	}
+	// Check for the system privilege first, otherwise fall back to role options.
+	hasModify, err := p.HasPrivilege(ctx, syntheticprivilege.GlobalPrivilegeObject, privilege.MODIFYCLUSTERSETTING, p.User())
+	if err != nil || hasModify {
+		return err
+	}
+	hasModify, err = p.HasRoleOption(ctx, roleoption.MODIFYCLUSTERSETTING)
+	if err != nil || hasModify {
+		return err
+	}
+	return pgerror.Newf(pgcode.InsufficientPrivilege,
+		"only users with the admin role or the %s system privilege may raise %s with the %s option",
+		privilege.MODIFYCLUSTERSETTING, strings.Join(raised, ", "), changefeedbase.OptSettings)
+}
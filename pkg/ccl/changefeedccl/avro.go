@@ -10,6 +10,7 @@ package changefeedccl
 
 import (
 	"encoding/json"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -116,6 +117,9 @@ type avroSchemaField struct {
 	Namespace  string         `json:"namespace,omitempty"`
 
 	typ *types.T
+	// nested are the schemas of the elements of array and tuple types, whose
+	// types are refreshed along with typ. See refreshType.
+	nested []*avroSchemaField
 
 	// encodeFn encodes specified tree.Datum as go "native" interface value.
 	// This function may memoize results to save allocations.
@@ -180,8 +184,35 @@ type avroEnvelopeRecord struct {
 	before, after, record *avroDataRecord
 }
 
-// typeToAvroSchema converts a database type to an avro field
-func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
+// avroTypeOptions controls the avro encoding of the SQL types which have no
+// lossless native avro representation. The zero value selects the default
+// encodings.
+type avroTypeOptions struct {
+	decimal                   changefeedbase.AvroDecimalEncoding
+	unboundedDecimalPrecision int
+	unboundedDecimalScale     int
+	interval                  changefeedbase.AvroIntervalEncoding
+	geospatial                changefeedbase.AvroGeospatialEncoding
+	enumCodes                 bool
+}
+
+func makeAvroTypeOptions(opts changefeedbase.EncodingOptions) avroTypeOptions {
+	return avroTypeOptions{
+		decimal:                   opts.AvroDecimal,
+		unboundedDecimalPrecision: opts.AvroUnboundedDecimalPrecision,
+		unboundedDecimalScale:     opts.AvroUnboundedDecimalScale,
+		interval:                  opts.AvroInterval,
+		geospatial:                opts.AvroGeospatial,
+		enumCodes:                 opts.EnumCodes,
+	}
+}
+
+// typeToAvroSchema converts a database type to an avro field. recordName is
+// the full name given to the avro record the type is encoded as, if any, and
+// must be unique within the enclosing schema.
+func typeToAvroSchema(
+	typ *types.T, recordName string, opts avroTypeOptions,
+) (*avroSchemaField, error) {
 	schema := &avroSchemaField{
 		typ: typ,
 	}
@@ -343,6 +374,27 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 			},
 		)
 	case types.GeographyFamily:
+		if opts.geospatial == changefeedbase.OptAvroGeospatialGeoJSON {
+			setNullable(
+				avroSchemaString,
+				func(d tree.Datum, _ interface{}) (interface{}, error) {
+					j, err := geo.SpatialObjectToGeoJSON(
+						d.(*tree.DGeography).Geography.SpatialObject(), -1, geo.SpatialObjectToGeoJSONFlagShortCRSIfNot4326)
+					if err != nil {
+						return nil, err
+					}
+					return string(j), nil
+				},
+				func(x interface{}) (tree.Datum, error) {
+					g, err := geo.ParseGeographyFromGeoJSON([]byte(x.(string)))
+					if err != nil {
+						return nil, err
+					}
+					return &tree.DGeography{Geography: g}, nil
+				},
+			)
+			break
+		}
 		setNullable(
 			avroSchemaBytes,
 			func(d tree.Datum, _ interface{}) (interface{}, error) {
@@ -357,6 +409,27 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 			},
 		)
 	case types.GeometryFamily:
+		if opts.geospatial == changefeedbase.OptAvroGeospatialGeoJSON {
+			setNullable(
+				avroSchemaString,
+				func(d tree.Datum, _ interface{}) (interface{}, error) {
+					j, err := geo.SpatialObjectToGeoJSON(
+						d.(*tree.DGeometry).Geometry.SpatialObject(), -1, geo.SpatialObjectToGeoJSONFlagShortCRSIfNot4326)
+					if err != nil {
+						return nil, err
+					}
+					return string(j), nil
+				},
+				func(x interface{}) (tree.Datum, error) {
+					g, err := geo.ParseGeometryFromGeoJSON([]byte(x.(string)))
+					if err != nil {
+						return nil, err
+					}
+					return &tree.DGeometry{Geometry: g}, nil
+				},
+			)
+			break
+		}
 		setNullable(
 			avroSchemaBytes,
 			func(d tree.Datum, _ interface{}) (interface{}, error) {
@@ -478,6 +551,33 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 			},
 		)
 	case types.IntervalFamily:
+		if opts.interval == changefeedbase.OptAvroIntervalMicros {
+			// Intervals too long to be represented in microseconds are encoded
+			// as ISO 8601 strings.
+			setNullableWithStringFallback(
+				avroSchemaLong,
+				func(d tree.Datum, _ interface{}) (interface{}, error) {
+					dur := d.(*tree.DInterval).Duration
+					nanos, _, _, err := dur.Encode()
+					if err != nil {
+						return dur.ISO8601String(), nil //nolint:returnerrcheck
+					}
+					return nanos / int64(time.Microsecond), nil
+				},
+				func(x interface{}) (tree.Datum, error) {
+					unionMap := x.(map[string]interface{})
+					if micros, ok := unionMap[avroUnionKey(avroSchemaLong)]; ok {
+						return tree.NewDInterval(
+							duration.MakeDuration(micros.(int64)*int64(time.Microsecond), 0, 0),
+							types.DefaultIntervalTypeMetadata,
+						), nil
+					}
+					return tree.ParseDInterval(
+						duration.IntervalStyle_ISO_8601, unionMap[avroUnionKey(avroSchemaString)].(string))
+				},
+			)
+			break
+		}
 		setNullable(
 			// This would ideally be the avro Duration logical type
 			// However, the spec is not implemented in most tooling
@@ -498,13 +598,34 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 			},
 		)
 	case types.DecimalFamily:
-		if typ.Precision() == 0 {
-			return nil, changefeedbase.WithTerminalError(errors.Errorf(
-				`decimal with no precision not yet supported with avro`))
+		if opts.decimal == changefeedbase.OptAvroDecimalString {
+			setNullable(
+				avroSchemaString,
+				func(d tree.Datum, _ interface{}) (interface{}, error) {
+					return d.String(), nil
+				},
+				func(x interface{}) (tree.Datum, error) {
+					return tree.ParseDDecimal(x.(string))
+				},
+			)
+			break
 		}
 
 		width := int(typ.Width())
 		prec := int(typ.Precision())
+		// Values of a decimal column declared without a precision may not fit
+		// the precision and scale given by avro_unbounded_decimal, in which
+		// case they are encoded as strings.
+		unbounded := prec == 0
+		if unbounded {
+			if opts.unboundedDecimalPrecision == 0 {
+				return nil, changefeedbase.WithTerminalError(errors.WithHintf(
+					errors.Errorf(`decimal with no precision not yet supported with avro`),
+					`use the %s or %s=%s options`, changefeedbase.OptAvroUnboundedDecimal,
+					changefeedbase.OptAvroDecimal, changefeedbase.OptAvroDecimalString))
+			}
+			prec, width = opts.unboundedDecimalPrecision, opts.unboundedDecimalScale
+		}
 		decimalType := avroLogicalType{
 			SchemaType:  avroSchemaBytes,
 			LogicalType: `decimal`,
@@ -519,12 +640,20 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 				if dec.Form != apd.Finite {
 					return d.String(), nil
 				}
+				if unbounded && -dec.Exponent > int32(width) {
+					return d.String(), nil
+				}
 
 				// If the decimal happens to fit a smaller width than the
-				// column allows, add trailing zeroes so the scale is constant
-				if typ.Width() > -dec.Exponent {
+				// column allows, add trailing zeroes so the scale is constant.
+				// Unbounded decimals are always quantized, to check that they
+				// fit the precision.
+				if unbounded || int32(width) > -dec.Exponent {
 					_, err := tree.DecimalCtx.WithPrecision(uint32(prec)).Quantize(&dec, &dec, -int32(width))
 					if err != nil {
+						if unbounded {
+							return d.String(), nil
+						}
 						// This should always be possible without rounding since we're using the column def,
 						// but if it's not, WithPrecision will force it to error.
 						return nil, err
@@ -532,9 +661,8 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 				}
 
 				// TODO(dan): For the cases that the avro defined decimal format
-				// would not roundtrip, serialize the decimal as a string. Also
-				// support the unspecified precision/scale case in this branch. We
-				// can't currently do this without surgery to the avro library we're
+				// would not roundtrip, serialize the decimal as a string. We can't
+				// currently do this without surgery to the avro library we're
 				// using and that's too scary leading up to 2.1.0.
 				rat, err := decimalToRat(dec, int32(width))
 				if err != nil {
@@ -604,21 +732,117 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 			},
 		)
 	case types.EnumFamily:
+		// The type is read from the schema rather than captured, as the enum
+		// metadata is refreshed on cached schemas when values are added.
+		decodeEnum := func(logicalRep string) (tree.Datum, error) {
+			e, err := tree.MakeDEnumFromLogicalRepresentation(schema.typ, logicalRep)
+			if err != nil {
+				return nil, err
+			}
+			return tree.NewDEnum(e), nil
+		}
+		if !opts.enumCodes {
+			setNullable(
+				avroSchemaString,
+				func(d tree.Datum, _ interface{}) (interface{}, error) {
+					return d.(*tree.DEnum).LogicalRep, nil
+				},
+				func(x interface{}) (tree.Datum, error) {
+					return decodeEnum(x.(string))
+				},
+			)
+			break
+		}
+		// With enum codes, values are records of their name and their code.
 		setNullable(
-			avroSchemaString,
-			func(d tree.Datum, _ interface{}) (interface{}, error) {
-				return d.(*tree.DEnum).LogicalRep, nil
+			&avroRecord{
+				SchemaType: `record`,
+				Name:       recordName,
+				Fields: []*avroSchemaField{
+					{Name: `name`, SchemaType: []avroSchemaType{avroSchemaNull, avroSchemaString}},
+					{Name: `code`, SchemaType: []avroSchemaType{avroSchemaNull, avroSchemaLong}},
+				},
+			},
+			func(d tree.Datum, memo interface{}) (interface{}, error) {
+				e := d.(*tree.DEnum)
+				var native map[string]interface{}
+				if memo != nil {
+					native = memo.(map[string]interface{})
+				} else {
+					native = make(map[string]interface{}, 2)
+				}
+				native[`name`] = goavro.Union(avroSchemaString, e.LogicalRep)
+				native[`code`] = goavro.Union(avroSchemaLong, int64(enumCode(e)))
+				return native, nil
 			},
 			func(x interface{}) (tree.Datum, error) {
-				e, err := tree.MakeDEnumFromLogicalRepresentation(typ, x.(string))
-				if err != nil {
-					return nil, err
+				name, ok := x.(map[string]interface{})[`name`].(map[string]interface{})
+				if !ok {
+					return nil, changefeedbase.WithTerminalError(
+						errors.Errorf(`missing name for enum value of type %s`, schema.typ.SQLString()))
+				}
+				return decodeEnum(name[avroSchemaString].(string))
+			},
+		)
+	case types.TupleFamily:
+		// Composite types, and tuples in general, are encoded as records with a
+		// field for each element of the tuple.
+		contents := typ.TupleContents()
+		labels := typ.TupleLabels()
+		fields := make([]*avroSchemaField, len(contents))
+		for i, contentTyp := range contents {
+			fieldName := fmt.Sprintf(`f%d`, i+1)
+			if i < len(labels) {
+				fieldName = SQLNameToAvroName(labels[i])
+			}
+			field, err := typeToAvroSchema(contentTyp, recordName+`.`+fieldName, opts)
+			if err != nil {
+				return nil, changefeedbase.WithTerminalError(
+					errors.Wrapf(err, `could not create schema for field %s of %s`, fieldName, typ))
+			}
+			field.Name = fieldName
+			fields[i] = field
+		}
+
+		setNullable(
+			&avroRecord{
+				SchemaType: `record`,
+				Name:       recordName,
+				Fields:     fields,
+			},
+			func(d tree.Datum, memo interface{}) (interface{}, error) {
+				tuple := d.(*tree.DTuple)
+				var native map[string]interface{}
+				if memo != nil {
+					native = memo.(map[string]interface{})
+				} else {
+					native = make(map[string]interface{}, len(fields))
+				}
+				for i, field := range fields {
+					encoded, err := field.encodeNested(tuple.D[i])
+					if err != nil {
+						return nil, err
+					}
+					native[field.Name] = encoded
+				}
+				return native, nil
+			},
+			func(x interface{}) (tree.Datum, error) {
+				native := x.(map[string]interface{})
+				datums := make(tree.Datums, len(fields))
+				for i, field := range fields {
+					d, err := field.decodeFn(native[field.Name])
+					if err != nil {
+						return nil, err
+					}
+					datums[i] = d
 				}
-				return tree.NewDEnum(e), nil
+				return tree.NewDTuple(schema.typ, datums...), nil
 			},
 		)
+		schema.nested = fields
 	case types.ArrayFamily:
-		itemSchema, err := typeToAvroSchema(typ.ArrayContents())
+		itemSchema, err := typeToAvroSchema(typ.ArrayContents(), recordName, opts)
 		if err != nil {
 			return nil, changefeedbase.WithTerminalError(
 				errors.Wrapf(err, `could not create item schema for %s`, typ))
@@ -699,6 +923,7 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 				return datumArr, nil
 			},
 		)
+		schema.nested = []*avroSchemaField{itemSchema}
 
 	default:
 		return nil, changefeedbase.WithTerminalError(
@@ -708,10 +933,48 @@ func typeToAvroSchema(typ *types.T) (*avroSchemaField, error) {
 	return schema, nil
 }
 
+// refreshType replaces the type of the field, and those of the elements of
+// arrays and tuples, with the given type, whose metadata may be newer. Decoding
+// only ever reads the types of fields, so that a schema is never modified by
+// the values decoded with it.
+func (f *avroSchemaField) refreshType(typ *types.T) {
+	f.typ = typ
+	switch typ.Family() {
+	case types.ArrayFamily:
+		f.nested[0].refreshType(typ.ArrayContents())
+	case types.TupleFamily:
+		for i, contentTyp := range typ.TupleContents() {
+			f.nested[i].refreshType(contentTyp)
+		}
+	}
+}
+
+// encodeNested encodes the specified datum as a go "native" value like
+// encodeFn, but without memoizing, so that the value can be retained within
+// the encoding of an enclosing value.
+func (f *avroSchemaField) encodeNested(d tree.Datum) (interface{}, error) {
+	if d == tree.DNull {
+		return nil /* value */, nil
+	}
+	encoded, err := f.encodeDatum(d, nil /* memo */)
+	if err != nil {
+		return nil, err
+	}
+	union := f.SchemaType.([]avroSchemaType)
+	if _, isString := encoded.(string); isString && len(union) > 2 {
+		// Types with a string fallback, see setNullableWithStringFallback.
+		return goavro.Union(avroSchemaString, encoded), nil
+	}
+	return goavro.Union(avroUnionKey(union[1]), encoded), nil
+}
+
 // columnToAvroSchema converts a column descriptor into its corresponding
-// avro field schema.
-func columnToAvroSchema(col cdcevent.ResultColumn) (*avroSchemaField, error) {
-	schema, err := typeToAvroSchema(col.Typ)
+// avro field schema. recordName is the full name of the avro record containing
+// the field.
+func columnToAvroSchema(
+	col cdcevent.ResultColumn, recordName string, opts avroTypeOptions,
+) (*avroSchemaField, error) {
+	schema, err := typeToAvroSchema(col.Typ, recordName+`.`+SQLNameToAvroName(col.Name), opts)
 	if err != nil {
 		return nil, changefeedbase.WithTerminalError(errors.Wrapf(err, "column %s", col.Name))
 	}
@@ -726,7 +989,7 @@ func columnToAvroSchema(col cdcevent.ResultColumn) (*avroSchemaField, error) {
 // Only columns returned by Iterator as used to popoulate schema fields.
 // sqlName can be any string but should uniquely identify a schema.
 func newSchemaForRow(
-	it cdcevent.Iterator, sqlName string, namespace string,
+	it cdcevent.Iterator, sqlName string, namespace string, opts avroTypeOptions,
 ) (*avroDataRecord, error) {
 	schema := &avroDataRecord{
 		avroRecord: avroRecord{
@@ -739,7 +1002,7 @@ func newSchemaForRow(
 	}
 
 	if err := it.Col(func(col cdcevent.ResultColumn) error {
-		field, err := columnToAvroSchema(col)
+		field, err := columnToAvroSchema(col, avroUnionKey(&schema.avroRecord), opts)
 		if err != nil {
 			return err
 		}
@@ -767,9 +1030,9 @@ func newSchemaForRow(
 
 // primaryIndexToAvroSchema constructs schema for primary index.
 func primaryIndexToAvroSchema(
-	row cdcevent.Row, sqlName string, namespace string,
+	row cdcevent.Row, sqlName string, namespace string, opts avroTypeOptions,
 ) (*avroDataRecord, error) {
-	return newSchemaForRow(row.ForEachKeyColumn(), SQLNameToAvroName(sqlName), namespace)
+	return newSchemaForRow(row.ForEachKeyColumn(), SQLNameToAvroName(sqlName), namespace, opts)
 }
 
 const (
@@ -782,7 +1045,7 @@ const (
 // If a name suffix is provided (as opposed to avroSchemaNoSuffix), it will be
 // appended to the end of the avro record's name.
 func tableToAvroSchema(
-	row cdcevent.Row, nameSuffix string, namespace string,
+	row cdcevent.Row, nameSuffix string, namespace string, opts avroTypeOptions,
 ) (*avroDataRecord, error) {
 	var sqlName string
 	// Even though we now always specify a family,
@@ -796,7 +1059,7 @@ func tableToAvroSchema(
 	if nameSuffix != avroSchemaNoSuffix {
 		sqlName = sqlName + `_` + nameSuffix
 	}
-	return newSchemaForRow(row.ForEachColumn(), sqlName, namespace)
+	return newSchemaForRow(row.ForEachColumn(), sqlName, namespace, opts)
 }
 
 // BinaryFromRow encodes the given row data into avro's defined binary format.
@@ -1029,12 +1292,13 @@ func (r *avroEnvelopeRecord) BinaryFromRow(
 	return r.codec.BinaryFromNative(buf, native)
 }
 
-// Refresh the metadata for user-defined types on a cached schema
-// The only user-defined type is enum, so this is usually a no-op.
+// Refresh the metadata for user-defined types on a cached schema, including
+// those nested within arrays and composite types. Only enums have metadata which
+// changes, so this is usually a no-op.
 func (r *avroDataRecord) refreshTypeMetadata(row cdcevent.Row) error {
 	return row.ForEachUDTColumn().Col(func(col cdcevent.ResultColumn) error {
 		if fieldIdx, ok := r.fieldIdxByName[col.Name]; ok {
-			r.Fields[fieldIdx].typ = col.Typ
+			r.Fields[fieldIdx].refreshType(col.Typ)
 		}
 		return nil
 	})
@@ -20,6 +20,7 @@ import (
 
 	"github.com/cockroachdb/apd/v3"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
@@ -46,6 +47,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil/pgdate"
 	"github.com/cockroachdb/errors"
+	"github.com/linkedin/goavro/v2"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/text/collate"
 )
@@ -164,7 +166,7 @@ func parseAvroSchema(t *testing.T, evalCtx *eval.Context, j string) (*avroDataRe
 	return tableToAvroSchema(
 		cdcevent.TestingMakeEventRow(
 			tabledesc.NewBuilder(&tableDesc).BuildImmutableTable(), 0, nil, false,
-		), "", "")
+		), "", "", avroTypeOptions{})
 }
 
 func avroFieldMetadataToColDesc(
@@ -392,7 +394,7 @@ func TestAvroSchema(t *testing.T) {
 			require.NoError(t, err)
 			origSchema, err := tableToAvroSchema(
 				cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false),
-				avroSchemaNoSuffix, "")
+				avroSchemaNoSuffix, "", avroTypeOptions{})
 			require.NoError(t, err)
 			jsonSchema := origSchema.codec.Schema()
 			roundtrippedSchema, err := parseAvroSchema(t, evalCtx, jsonSchema)
@@ -430,7 +432,7 @@ func TestAvroSchema(t *testing.T) {
 		tableDesc, err := parseTableDesc(`CREATE TABLE "☃" (🍦 INT PRIMARY KEY)`)
 		require.NoError(t, err)
 		tableSchema, err := tableToAvroSchema(
-			cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false), avroSchemaNoSuffix, "")
+			cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false), avroSchemaNoSuffix, "", avroTypeOptions{})
 		require.NoError(t, err)
 		require.Equal(t,
 			`{"type":"record","name":"_u2603_","fields":[`+
@@ -438,7 +440,7 @@ func TestAvroSchema(t *testing.T) {
 				`"__crdb__":"🍦 INT8 NOT NULL"}]}`,
 			tableSchema.codec.Schema())
 		indexSchema, err := primaryIndexToAvroSchema(
-			cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false), tableDesc.GetName(), "")
+			cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false), tableDesc.GetName(), "", avroTypeOptions{})
 		require.NoError(t, err)
 		require.Equal(t,
 			`{"type":"record","name":"_u2603_","fields":[`+
@@ -489,6 +491,7 @@ func TestAvroSchema(t *testing.T) {
 			require.NoError(t, err)
 			field, err := columnToAvroSchema(
 				cdcevent.ResultColumn{ResultColumn: colinfo.ResultColumn{Typ: tableDesc.PublicColumns()[1].GetType()}},
+				`foo`, avroTypeOptions{},
 			)
 			require.NoError(t, err)
 			schema, err := json.Marshal(field.SchemaType)
@@ -663,7 +666,7 @@ func TestAvroSchema(t *testing.T) {
 
 			row := cdcevent.TestingMakeEventRow(tableDesc, 0, encDatums[0], false)
 			schema, err := tableToAvroSchema(
-				row, avroSchemaNoSuffix, "")
+				row, avroSchemaNoSuffix, "", avroTypeOptions{})
 			require.NoError(t, err)
 			if test.numRawBytes > 0 {
 				overhead := 4
@@ -720,7 +723,7 @@ func TestAvroSchema(t *testing.T) {
 			require.NoError(t, err)
 
 			row := cdcevent.TestingMakeEventRow(tableDesc, 0, encDatums[0], false)
-			schema, err := tableToAvroSchema(row, avroSchemaNoSuffix, "")
+			schema, err := tableToAvroSchema(row, avroSchemaNoSuffix, "", avroTypeOptions{})
 			require.NoError(t, err)
 			textual, err := schema.textualFromRow(row)
 			require.NoError(t, err)
@@ -736,6 +739,77 @@ func TestAvroSchema(t *testing.T) {
 			require.Equal(t, test.avro, value)
 		}
 	})
+
+	t.Run("type_options", func(t *testing.T) {
+		tests := []struct {
+			opts    avroTypeOptions
+			sqlType string
+			sql     string
+			avro    string
+			err     string
+		}{
+			{
+				opts:    avroTypeOptions{decimal: changefeedbase.OptAvroDecimalString},
+				sqlType: `DECIMAL(3,2)`,
+				sql:     `1.23`,
+				avro:    `{"string":"1.23"}`,
+			},
+			{
+				opts:    avroTypeOptions{unboundedDecimalPrecision: 10, unboundedDecimalScale: 2},
+				sqlType: `DECIMAL`,
+				sql:     `1.2`,
+				avro:    `{"bytes.decimal":"x"}`,
+			},
+			{
+				opts:    avroTypeOptions{unboundedDecimalPrecision: 10, unboundedDecimalScale: 2},
+				sqlType: `DECIMAL`,
+				sql:     `1.234`,
+				avro:    `{"string":"1.234"}`,
+			},
+			{
+				sqlType: `DECIMAL`,
+				sql:     `1.234`,
+				err:     `decimal with no precision`,
+			},
+			{
+				opts:    avroTypeOptions{interval: changefeedbase.OptAvroIntervalMicros},
+				sqlType: `INTERVAL`,
+				sql:     `'1 second'`,
+				avro:    `{"long":1000000}`,
+			},
+			{
+				opts:    avroTypeOptions{geospatial: changefeedbase.OptAvroGeospatialGeoJSON},
+				sqlType: `GEOMETRY`,
+				sql:     `'POINT(1.0 1.0)'`,
+				avro:    `{"string":"{\"type\":\"Point\",\"coordinates\":[1,1]}"}`,
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.sqlType+`/`+test.sql, func(t *testing.T) {
+				tableDesc, err := parseTableDesc(
+					`CREATE TABLE foo (pk INT PRIMARY KEY, a ` + test.sqlType + `)`)
+				require.NoError(t, err)
+				rows, err := parseValues(tableDesc, `VALUES (1, `+test.sql+`)`)
+				require.NoError(t, err)
+
+				row := cdcevent.TestingMakeEventRow(tableDesc, 0, rows[0], false)
+				schema, err := tableToAvroSchema(row, avroSchemaNoSuffix, "", test.opts)
+				if test.err != `` {
+					require.Regexp(t, test.err, err)
+					return
+				}
+				require.NoError(t, err)
+				textual, err := schema.textualFromRow(row)
+				require.NoError(t, err)
+				value := string(textual[1 : len(textual)-1])
+				value = strings.Replace(value, `"pk":{"long":1}`, ``, -1)
+				value = strings.Trim(value, `,`)
+				value = strings.Replace(value, `"a":`, ``, -1)
+				require.Equal(t, test.avro, value)
+			})
+		}
+	})
 }
 
 func (f *avroSchemaField) defaultValueNative() (interface{}, bool) {
@@ -824,13 +898,13 @@ func TestAvroMigration(t *testing.T) {
 				fmt.Sprintf(`CREATE TABLE "%s" %s`, test.name, test.writerSchema))
 			require.NoError(t, err)
 			writerSchema, err := tableToAvroSchema(
-				cdcevent.TestingMakeEventRow(writerDesc, 0, nil, false), avroSchemaNoSuffix, "")
+				cdcevent.TestingMakeEventRow(writerDesc, 0, nil, false), avroSchemaNoSuffix, "", avroTypeOptions{})
 			require.NoError(t, err)
 			readerDesc, err := parseTableDesc(
 				fmt.Sprintf(`CREATE TABLE "%s" %s`, test.name, test.readerSchema))
 			require.NoError(t, err)
 			readerSchema, err := tableToAvroSchema(
-				cdcevent.TestingMakeEventRow(readerDesc, 0, nil, false), avroSchemaNoSuffix, "")
+				cdcevent.TestingMakeEventRow(readerDesc, 0, nil, false), avroSchemaNoSuffix, "", avroTypeOptions{})
 			require.NoError(t, err)
 
 			writerRows, err := parseValues(writerDesc, `VALUES `+test.writerValues)
@@ -850,6 +924,117 @@ func TestAvroMigration(t *testing.T) {
 	}
 }
 
+func TestAvroUserDefinedTypes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	statusTyp := createEnum(
+		tree.EnumValueList{tree.EnumValue(`open`), tree.EnumValue(`closed`)},
+		tree.MakeUnqualifiedTypeName(`status`),
+	)
+	makeEnum := func(logicalRep string) *tree.DEnum {
+		e, err := tree.MakeDEnumFromLogicalRepresentation(statusTyp, logicalRep)
+		require.NoError(t, err)
+		return tree.NewDEnum(e)
+	}
+	openVal, closedVal := makeEnum(`open`), makeEnum(`closed`)
+
+	statusArrayTyp := types.MakeArray(statusTyp)
+	statusArray := tree.NewDArray(statusTyp)
+	require.NoError(t, statusArray.Append(openVal))
+	require.NoError(t, statusArray.Append(tree.DNull))
+	require.NoError(t, statusArray.Append(closedVal))
+
+	compositeTyp := types.MakeLabeledTuple(
+		[]*types.T{types.Int, statusTyp, statusArrayTyp}, []string{`id`, `status`, `history`})
+	composite := tree.NewDTuple(compositeTyp, tree.NewDInt(1), closedVal, statusArray)
+
+	// roundtrip encodes d as the value of a field of type typ within a record,
+	// checks that it decodes back to d and returns the textual encoding of the
+	// field.
+	roundtrip := func(
+		t *testing.T, typ *types.T, d tree.Datum, opts avroTypeOptions,
+	) string {
+		field, err := typeToAvroSchema(typ, `foo.a`, opts)
+		require.NoError(t, err)
+		field.Name = `a`
+		record := &avroRecord{SchemaType: `record`, Name: `foo`, Fields: []*avroSchemaField{field}}
+		schemaJSON, err := json.Marshal(record)
+		require.NoError(t, err)
+		codec, err := goavro.NewCodec(string(schemaJSON))
+		require.NoError(t, err)
+
+		native, err := field.encodeFn(d)
+		require.NoError(t, err)
+		textual, err := codec.TextualFromNative(nil /* buf */, map[string]interface{}{`a`: native})
+		require.NoError(t, err)
+		decodedNative, _, err := codec.NativeFromTextual(textual)
+		require.NoError(t, err)
+		decoded, err := field.decodeFn(decodedNative.(map[string]interface{})[`a`])
+		require.NoError(t, err)
+		require.Equal(t, d.String(), decoded.String())
+		return strings.TrimSuffix(strings.TrimPrefix(string(textual), `{"a":`), `}`)
+	}
+
+	t.Run(`enum array`, func(t *testing.T) {
+		require.Equal(t,
+			`{"array":[{"string":"open"},null,{"string":"closed"}]}`,
+			roundtrip(t, statusArrayTyp, statusArray, avroTypeOptions{}))
+	})
+	t.Run(`enum codes`, func(t *testing.T) {
+		require.Equal(t,
+			fmt.Sprintf(`{"foo.a":{"name":{"string":"open"},"code":{"long":%d}}}`, enumCode(openVal)),
+			roundtrip(t, statusTyp, openVal, avroTypeOptions{enumCodes: true}))
+		require.Equal(t,
+			fmt.Sprintf(`{"array":[{"foo.a":{"name":{"string":"open"},"code":{"long":%d}}},null,`+
+				`{"foo.a":{"name":{"string":"closed"},"code":{"long":%d}}}]}`, enumCode(openVal), enumCode(closedVal)),
+			roundtrip(t, statusArrayTyp, statusArray, avroTypeOptions{enumCodes: true}))
+		// Codes are stable as they don't depend on the position of the value.
+		require.NotEqual(t, enumCode(openVal), enumCode(closedVal))
+		require.Equal(t, enumCode(openVal), enumCode(makeEnum(`open`)))
+	})
+	t.Run(`composite`, func(t *testing.T) {
+		require.Equal(t,
+			`{"foo.a":{"id":{"long":1},"status":{"string":"closed"},`+
+				`"history":{"array":[{"string":"open"},null,{"string":"closed"}]}}}`,
+			roundtrip(t, compositeTyp, composite, avroTypeOptions{}))
+		withCodes := roundtrip(t, compositeTyp, composite, avroTypeOptions{enumCodes: true})
+		require.Contains(t, withCodes,
+			fmt.Sprintf(`"status":{"foo.a.status":{"name":{"string":"closed"},"code":{"long":%d}}}`, enumCode(closedVal)))
+		require.Contains(t, withCodes, `"history":{"array":[{"foo.a.history":`)
+	})
+	t.Run(`refresh`, func(t *testing.T) {
+		field, err := typeToAvroSchema(compositeTyp, `foo.a`, avroTypeOptions{})
+		require.NoError(t, err)
+		native := map[string]interface{}{`foo.a`: map[string]interface{}{
+			`id`:     map[string]interface{}{`long`: int64(1)},
+			`status`: map[string]interface{}{`string`: `pending`},
+			`history`: map[string]interface{}{`array`: []interface{}{
+				map[string]interface{}{`string`: `pending`},
+			}},
+		}}
+		// Decoding a value the schema's types don't know of leaves them alone.
+		_, err = field.decodeFn(native)
+		require.Error(t, err)
+		require.Equal(t, statusTyp, field.nested[1].typ)
+		require.Equal(t, statusTyp, field.nested[2].nested[0].typ)
+
+		// Refreshing the top-level type refreshes the nested ones.
+		refreshedStatusTyp := createEnum(
+			tree.EnumValueList{tree.EnumValue(`open`), tree.EnumValue(`closed`), tree.EnumValue(`pending`)},
+			tree.MakeUnqualifiedTypeName(`status`),
+		)
+		field.refreshType(types.MakeLabeledTuple(
+			[]*types.T{types.Int, refreshedStatusTyp, types.MakeArray(refreshedStatusTyp)},
+			[]string{`id`, `status`, `history`}))
+		decoded, err := field.decodeFn(native)
+		require.NoError(t, err)
+		require.Equal(t, `pending`, decoded.(*tree.DTuple).D[1].(*tree.DEnum).LogicalRep)
+		history := decoded.(*tree.DTuple).D[2].(*tree.DArray)
+		require.Equal(t, `pending`, history.Array[0].(*tree.DEnum).LogicalRep)
+	})
+}
+
 func TestDecimalRatRoundtrip(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -908,7 +1093,7 @@ func benchmarkEncodeType(b *testing.B, typ *types.T, encRow rowenc.EncDatumRow)
 		fmt.Sprintf(`CREATE TABLE bench_table (bench_field %s)`, typ.SQLString()))
 	require.NoError(b, err)
 	row := cdcevent.TestingMakeEventRow(tableDesc, 0, encRow, false)
-	schema, err := tableToAvroSchema(row, "suffix", "namespace")
+	schema, err := tableToAvroSchema(row, "suffix", "namespace", avroTypeOptions{})
 	require.NoError(b, err)
 
 	b.ReportAllocs()
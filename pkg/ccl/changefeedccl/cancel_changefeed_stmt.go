@@ -0,0 +1,214 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobsauth"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/server/telemetry"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/colinfo"
+	"github.com/cockroachdb/cockroach/pkg/sql/exprutil"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/asof"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+func init() {
+	sql.AddPlanHook("cancel changefeed", cancelChangefeedPlanHook, cancelChangefeedTypeCheck)
+}
+
+const cancelTelemetryPath = `changefeed.cancel_at_time`
+
+func cancelChangefeedTypeCheck(
+	ctx context.Context, stmt tree.Statement, p sql.PlanHookState,
+) (matched bool, header colinfo.ResultColumns, _ error) {
+	cancelChangefeedStmt, ok := stmt.(*tree.CancelChangefeed)
+	if !ok {
+		return false, nil, nil
+	}
+	if err := exprutil.TypeCheck(
+		ctx, "CANCEL CHANGEFEED", p.SemaCtx(), exprutil.Ints{cancelChangefeedStmt.Job},
+	); err != nil {
+		return false, nil, err
+	}
+	return true, cancelChangefeedHeader, nil
+}
+
+var cancelChangefeedHeader = colinfo.ResultColumns{
+	{Name: "job_id", Typ: types.Int},
+	{Name: "end_time", Typ: types.Decimal},
+}
+
+// cancelChangefeedPlanHook implements sql.PlanHookFn. It gracefully drains a
+// changefeed: the changefeed keeps emitting until its frontier reaches the
+// given timestamp, emits a final resolved timestamp and then completes. A
+// replacement changefeed created with cursor set to that final resolved
+// timestamp continues with no gap or overlap.
+func cancelChangefeedPlanHook(
+	ctx context.Context, stmt tree.Statement, p sql.PlanHookState,
+) (sql.PlanHookRowFn, colinfo.ResultColumns, []sql.PlanNode, bool, error) {
+	cancelChangefeedStmt, ok := stmt.(*tree.CancelChangefeed)
+	if !ok {
+		return nil, nil, nil, false, nil
+	}
+
+	fn := func(ctx context.Context, _ []sql.PlanNode, resultsCh chan<- tree.Datums) error {
+		typedExpr, err := cancelChangefeedStmt.Job.TypeCheck(ctx, p.SemaCtx(), types.Int)
+		if err != nil {
+			return err
+		}
+		jobID := jobspb.JobID(tree.MustBeDInt(typedExpr))
+
+		asOf, err := asof.Eval(
+			ctx, tree.AsOfClause{Expr: cancelChangefeedStmt.Time}, p.SemaCtx(), &p.ExtendedEvalContext().Context,
+		)
+		if err != nil {
+			return err
+		}
+		endTime := asOf.Timestamp
+
+		job, err := p.ExecCfg().JobRegistry.LoadJobWithTxn(ctx, jobID, p.InternalSQLTxn())
+		if err != nil {
+			return errors.Wrapf(err, `could not load job with job id %d`, jobID)
+		}
+
+		jobPayload := job.Payload()
+		if err := jobsauth.Authorize(ctx, p, jobID, &jobPayload, jobsauth.ControlAccess); err != nil {
+			return err
+		}
+
+		details, ok := job.Details().(jobspb.ChangefeedDetails)
+		if !ok {
+			return errors.Errorf(`job %d is not changefeed job`, jobID)
+		}
+
+		if status := job.Status(); status != jobs.StatusRunning && status != jobs.StatusPaused {
+			return errors.Errorf(`job %d is %s; only running or paused changefeeds can be drained`,
+				jobID, status)
+		}
+
+		if details.Draining {
+			return errors.Errorf(`changefeed %d is already draining at %s`,
+				jobID, details.EndTime.AsOfSystemTime())
+		}
+
+		if details.Opts[changefeedbase.OptFormat] == string(changefeedbase.OptFormatCSV) {
+			return errors.Errorf(`CANCEL CHANGEFEED ... AT TIME is not supported for changefeeds with %s=%s`,
+				changefeedbase.OptFormat, changefeedbase.OptFormatCSV)
+		}
+
+		if endTime.Less(details.StatementTime) {
+			return errors.Errorf(`drain time %s is earlier than the changefeed statement time %s`,
+				endTime.AsOfSystemTime(), details.StatementTime.AsOfSystemTime())
+		}
+
+		// The aggregators of a running changefeed only notice the drain time
+		// when they next poll the job, and must do so before any row past it
+		// can be written.
+		clock := p.ExecCfg().Clock
+		minDrainTime := clock.Now().Add((drainPollInterval + clock.MaxOffset()).Nanoseconds(), 0)
+		if endTime.Less(minDrainTime) {
+			return errors.Errorf(`drain time %s must be at least %s in the future`,
+				endTime.AsOfSystemTime(), drainPollInterval+clock.MaxOffset())
+		}
+
+		if !details.EndTime.IsEmpty() && details.EndTime.Less(endTime) {
+			return errors.Errorf(`changefeed %d already ends at %s, which is before the drain time %s`,
+				jobID, details.EndTime.AsOfSystemTime(), endTime.AsOfSystemTime())
+		}
+
+		if err := job.WithTxn(p.InternalSQLTxn()).Update(ctx, func(
+			txn isql.Txn, md jobs.JobMetadata, ju *jobs.JobUpdater,
+		) error {
+			// The high-water is checked as of the update, which conflicts with
+			// those of the changefeed, rather than as of when the job was
+			// loaded, since the changefeed may have advanced it since.
+			if hw := md.Progress.GetHighWater(); hw != nil && !hw.Less(endTime) {
+				return errors.Errorf(`changefeed %d has already resolved up to %s, which is not before the drain time %s`,
+					jobID, hw.AsOfSystemTime(), endTime.AsOfSystemTime())
+			}
+			details := *md.Payload.GetChangefeed()
+			if details.Draining {
+				return errors.Errorf(`changefeed %d is already draining at %s`,
+					jobID, details.EndTime.AsOfSystemTime())
+			}
+			details.EndTime = endTime
+			details.Draining = true
+			newPayload := *md.Payload
+			newPayload.Details = jobspb.WrapPayloadDetails(details)
+			ju.UpdatePayload(&newPayload)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		telemetry.Count(cancelTelemetryPath)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case resultsCh <- tree.Datums{
+			tree.NewDInt(tree.DInt(jobID)),
+			eval.TimestampToDecimalDatum(endTime),
+		}:
+			return nil
+		}
+	}
+
+	return fn, cancelChangefeedHeader, nil, false, nil
+}
+
+// drainPollInterval is how often the aggregators of a running changefeed poll
+// its job for a drain time set by CANCEL CHANGEFEED ... AT TIME.
+const drainPollInterval = 2 * time.Second
+
+// drainWatcher polls the job of a running changefeed for a drain time set by
+// CANCEL CHANGEFEED ... AT TIME, so that its aggregators stop emitting at the
+// drain time without waiting for the changeFrontier to notice it and restart
+// the flow with it as the end time.
+type drainWatcher struct {
+	registry  *jobs.Registry
+	jobID     jobspb.JobID
+	lastPoll  time.Time
+	drainTime hlc.Timestamp
+}
+
+// get returns the drain time of the changefeed, if it is draining, polling its
+// job if it was last polled over drainPollInterval ago.
+func (w *drainWatcher) get(ctx context.Context) hlc.Timestamp {
+	if w == nil {
+		return hlc.Timestamp{}
+	}
+	if !w.drainTime.IsEmpty() || timeutil.Since(w.lastPoll) < drainPollInterval {
+		return w.drainTime
+	}
+	w.lastPoll = timeutil.Now()
+	job, err := w.registry.LoadJob(ctx, w.jobID)
+	if err != nil {
+		log.Warningf(ctx, "checking whether the changefeed is draining: %v", err)
+		return w.drainTime
+	}
+	if details, ok := job.Details().(jobspb.ChangefeedDetails); ok && details.Draining {
+		log.Infof(ctx, "changefeed draining at %s", details.EndTime)
+		w.drainTime = details.EndTime
+	}
+	return w.drainTime
+}
@@ -0,0 +1,214 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package cdcbench_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcbench"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
+	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/stretchr/testify/require"
+)
+
+const numRows = 1024
+
+// BenchmarkEncoders measures the throughput of encoding the key and value of
+// a row with each format.
+func BenchmarkEncoders(b *testing.B) {
+	defer leaktest.AfterTest(b)()
+	defer log.Scope(b).Close(b)
+
+	ctx := context.Background()
+	updatedRows, prevRows := cdcbench.MakeRows(numRows)
+	updated := hlc.Timestamp{WallTime: 42}
+
+	for _, tc := range []struct {
+		format   changefeedbase.FormatType
+		envelope changefeedbase.EnvelopeType
+		diff     bool
+	}{
+		{format: changefeedbase.OptFormatJSON, envelope: changefeedbase.OptEnvelopeWrapped},
+		{format: changefeedbase.OptFormatJSON, envelope: changefeedbase.OptEnvelopeWrapped, diff: true},
+		{format: changefeedbase.OptFormatJSON, envelope: changefeedbase.OptEnvelopeRow},
+		{format: changefeedbase.OptFormatAvro, envelope: changefeedbase.OptEnvelopeWrapped},
+		{format: changefeedbase.OptFormatAvro, envelope: changefeedbase.OptEnvelopeWrapped, diff: true},
+		{format: changefeedbase.OptFormatCSV, envelope: changefeedbase.OptEnvelopeRow},
+		{format: changefeedbase.OptFormatMsgpack, envelope: changefeedbase.OptEnvelopeWrapped},
+		{format: changefeedbase.OptFormatMsgpack, envelope: changefeedbase.OptEnvelopeWrapped, diff: true},
+	} {
+		name := fmt.Sprintf(`format=%s/envelope=%s/diff=%t`, tc.format, tc.envelope, tc.diff)
+		b.Run(name, func(b *testing.B) {
+			encoder, err := changefeedccl.TestingMakeEncoder(changefeedbase.EncodingOptions{
+				Format:            tc.format,
+				Envelope:          tc.envelope,
+				UpdatedTimestamps: tc.envelope == changefeedbase.OptEnvelopeWrapped,
+				Diff:              tc.diff,
+			}, cdcbench.Targets())
+			require.NoError(b, err)
+
+			var bytes int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key, value, err := encoder.EncodeRow(
+					ctx, `randtbl`, updatedRows[i%numRows], prevRows[i%numRows], updated)
+				if err != nil {
+					b.Fatal(err)
+				}
+				bytes += int64(len(key) + len(value))
+			}
+			b.SetBytes(bytes / int64(b.N))
+		})
+	}
+}
+
+// discardServer is a mock webhook endpoint which counts and discards the
+// requests it receives.
+type discardServer struct {
+	*httptest.Server
+	requests int64
+}
+
+func startDiscardServer() *discardServer {
+	s := &discardServer{}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.requests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+// sinkURI returns the URI of a webhook sink into the server.
+func (s *discardServer) sinkURI() string {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		panic(err)
+	}
+	u.Scheme = changefeedbase.SinkSchemeWebhookHTTPS
+	u.RawQuery = url.Values{changefeedbase.SinkParamSkipTLSVerify: {`true`}}.Encode()
+	return u.String()
+}
+
+// BenchmarkWebhookSinkBatching measures the throughput of emitting rows
+// through the webhook sink into a mock endpoint, with and without batching.
+func BenchmarkWebhookSinkBatching(b *testing.B) {
+	defer leaktest.AfterTest(b)()
+	defer log.Scope(b).Close(b)
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	encoder, err := changefeedccl.TestingMakeEncoder(changefeedbase.EncodingOptions{
+		Format:   changefeedbase.OptFormatJSON,
+		Envelope: changefeedbase.OptEnvelopeWrapped,
+	}, cdcbench.Targets())
+	require.NoError(b, err)
+	updatedRows, prevRows := cdcbench.MakeRows(numRows)
+	keys, values := make([][]byte, numRows), make([][]byte, numRows)
+	for i := range updatedRows {
+		key, value, err := encoder.EncodeRow(ctx, `randtbl`, updatedRows[i], prevRows[i], hlc.Timestamp{})
+		require.NoError(b, err)
+		keys[i], values[i] = key, append([]byte(nil), value...)
+	}
+	topic := changefeedccl.TestingMakeTopic(`randtbl`, 42)
+
+	for _, messages := range []int{0, 10, 100, 1000} {
+		b.Run(fmt.Sprintf(`messages=%d`, messages), func(b *testing.B) {
+			srv := startDiscardServer()
+			defer srv.Close()
+
+			sinkConfig := fmt.Sprintf(`{"Flush":{"Messages":%d,"Frequency":"1s"}}`, messages)
+			if messages == 0 {
+				sinkConfig = `{}`
+			}
+			sink, err := changefeedccl.TestingMakeWebhookSink(ctx, srv.sinkURI(),
+				map[string]string{changefeedbase.OptWebhookSinkConfig: sinkConfig}, &st.SV)
+			require.NoError(b, err)
+			require.NoError(b, sink.Dial())
+			defer func() { require.NoError(b, sink.Close()) }()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := sink.EmitRow(ctx, topic, keys[i%numRows], values[i%numRows],
+					hlc.Timestamp{}, hlc.Timestamp{}, kvevent.Alloc{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			require.NoError(b, sink.Flush(ctx))
+			b.StopTimer()
+			b.ReportMetric(float64(atomic.LoadInt64(&srv.requests))/float64(b.N), `requests/row`)
+		})
+	}
+}
+
+// BenchmarkChangefeed measures the throughput of changefeeds from end to end,
+// from the initial scan of a table to its rows being emitted into a mock sink.
+func BenchmarkChangefeed(b *testing.B) {
+	defer leaktest.AfterTest(b)()
+	defer log.Scope(b).Close(b)
+
+	ctx := context.Background()
+	s, db, _ := serverutils.StartServer(b, base.TestServerArgs{})
+	defer s.Stopper().Stop(ctx)
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(b, `SET CLUSTER SETTING kv.rangefeed.enabled = true`)
+
+	srv := startDiscardServer()
+	defer srv.Close()
+	sinks := []struct {
+		name string
+		uri  string
+	}{
+		{name: `null`, uri: `null://`},
+		{name: `webhook`, uri: srv.sinkURI()},
+	}
+
+	loaded := 0
+	sqlDB.Exec(b, cdcbench.CreateTableStmt)
+	for _, scenario := range cdcbench.Scenarios {
+		// The scenarios scan the rows of the table with the smallest keys.
+		if scenario.Rows > loaded {
+			sqlDB.Exec(b, cdcbench.InsertRowsStmt(loaded, scenario.Rows))
+			loaded = scenario.Rows
+		}
+		if scenario.Rows < loaded {
+			b.Fatalf(`scenarios must be ordered by rows`)
+		}
+		for _, sink := range sinks {
+			b.Run(fmt.Sprintf(`%s/sink=%s`, scenario.Name(), sink.name), func(b *testing.B) {
+				start := timeutil.Now()
+				for i := 0; i < b.N; i++ {
+					var jobID int64
+					sqlDB.QueryRow(b, scenario.ChangefeedStmt(), sink.uri).Scan(&jobID)
+					var status string
+					sqlDB.QueryRow(b, `SELECT status FROM [SHOW JOB WHEN COMPLETE $1]`, jobID).Scan(&status)
+					require.Equal(b, `succeeded`, status)
+				}
+				rows := float64(scenario.Rows * b.N)
+				b.ReportMetric(rows/timeutil.Since(start).Seconds(), `rows/s`)
+			})
+		}
+	}
+}
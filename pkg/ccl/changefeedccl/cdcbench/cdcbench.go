@@ -0,0 +1,124 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+// Package cdcbench contains reproducible benchmarks of the emit path of
+// changefeeds: the throughput of the encoders, of the batching of sinks, and
+// of changefeeds from end to end into mock sinks. They are run with
+//
+//	./dev bench pkg/ccl/changefeedccl/cdcbench
+//
+// and the end to end scenarios are also run on a cluster by the cdc/bench
+// roachtests, so that regressions in the emit path show up in roachperf.
+//
+// The rows of the benchmarks are generated from a fixed seed, and the rows of
+// the end to end scenarios from their primary keys, so that each run encodes
+// and emits the same rows.
+package cdcbench
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/sql/randgen"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+)
+
+// Seed seeds the generation of the rows which are encoded by the benchmarks.
+const Seed = 2365865412074131521
+
+// ColumnTypes are the types of the columns of the rows which are encoded by
+// the benchmarks, and of the table of the end to end scenarios. The first
+// column is the primary key.
+var ColumnTypes = []*types.T{
+	types.Int, types.String, types.Float, types.Bool, types.TimestampTZ, types.Bytes,
+}
+
+// MakeRows returns n rows of ColumnTypes, and a previous version of each row
+// with the same primary key.
+func MakeRows(n int) (updatedRows, prevRows []cdcevent.Row) {
+	rng := rand.New(rand.NewSource(Seed))
+	for _, r := range randgen.RandEncDatumRowsOfTypes(rng, n, ColumnTypes) {
+		updatedRows = append(updatedRows,
+			cdcevent.TestingMakeEventRowFromEncDatums(r, ColumnTypes, 1 /* numKeyCols */, false /* deleted */))
+		prev := append(r[:1:1], randgen.RandEncDatumRowOfTypes(rng, ColumnTypes[1:])...)
+		prevRows = append(prevRows,
+			cdcevent.TestingMakeEventRowFromEncDatums(prev, ColumnTypes, 1 /* numKeyCols */, false /* deleted */))
+	}
+	return updatedRows, prevRows
+}
+
+// Targets returns the targets of a changefeed on the table of the rows made
+// by MakeRows.
+func Targets() changefeedbase.Targets {
+	var targets changefeedbase.Targets
+	targets.Add(changefeedbase.Target{
+		Type:              jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY,
+		TableID:           42,
+		FamilyName:        "primary",
+		StatementTimeName: "randtbl",
+	})
+	return targets
+}
+
+// TableName is the name of the table of the end to end scenarios.
+const TableName = `cdcbench`
+
+// CreateTableStmt creates the table of the end to end scenarios.
+const CreateTableStmt = `CREATE TABLE cdcbench (
+	id INT8 PRIMARY KEY,
+	s STRING,
+	f FLOAT8,
+	b BOOL,
+	ts TIMESTAMPTZ,
+	raw BYTES
+)`
+
+// InsertRowsStmt returns a statement which inserts the rows of the table of
+// the end to end scenarios with primary keys in [start, end).
+func InsertRowsStmt(start, end int) string {
+	return fmt.Sprintf(`INSERT INTO cdcbench SELECT
+	i,
+	repeat(md5(i::STRING), 4),
+	i::FLOAT8 / 7,
+	i %% 2 = 0,
+	'2023-01-01'::TIMESTAMPTZ + i * '1s'::INTERVAL,
+	md5(i::STRING)::BYTES
+FROM generate_series(%d, %d) AS g(i)`, start, end-1)
+}
+
+// Scenario is an end to end benchmark: a changefeed which scans the rows of
+// the table of the scenarios into a sink, and completes.
+type Scenario struct {
+	// Rows is the number of rows in the table.
+	Rows int
+	// Format is the format of the changefeed.
+	Format changefeedbase.FormatType
+}
+
+// Scenarios are the end to end scenarios of the benchmarks, with the number
+// of rows used by go test -bench. The roachtests scale up the rows.
+var Scenarios = []Scenario{
+	{Rows: 10000, Format: changefeedbase.OptFormatJSON},
+	{Rows: 10000, Format: changefeedbase.OptFormatCSV},
+	{Rows: 10000, Format: changefeedbase.OptFormatMsgpack},
+}
+
+// Name returns the name of the scenario, used to name benchmarks.
+func (s Scenario) Name() string {
+	return fmt.Sprintf(`rows=%d/format=%s`, s.Rows, s.Format)
+}
+
+// ChangefeedStmt returns the statement which creates the changefeed of the
+// scenario, with the URI of its sink as its only placeholder.
+func (s Scenario) ChangefeedStmt() string {
+	return fmt.Sprintf(`CREATE CHANGEFEED FOR TABLE cdcbench INTO $1 WITH initial_scan = 'only', format = '%s'`,
+		s.Format)
+}
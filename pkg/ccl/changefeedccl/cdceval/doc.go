@@ -52,6 +52,13 @@ section below for more info).
 Certain stable functions (s.a. now(), current_timestamp(), etc) are allowed -- they will always
 return the MVCC timestamp of the event.
 
+JSONB operators (->, ->>, #>, @>, ?, etc) and array functions and operators
+(array_length, @>, && etc) are immutable, and can be used to filter and project
+semi-structured columns:
+   SELECT id, payload->'amount' AS amount FROM foo WHERE payload->>'type' = 'purchase'
+Set returning functions (s.a. jsonb_array_elements, unnest) are generators,
+and are disallowed since each event must produce at most one row.
+
 Access to the previous state of the row is accomplished via (typed) cdc_prev tuple.
 This tuple can be used to build complex expressions around the previous state of the row:
    SELECT * FROM foo WHERE status='active' AND cdc_prev.status='inactive'
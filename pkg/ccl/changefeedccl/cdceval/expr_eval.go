@@ -133,10 +133,12 @@ func (e *Evaluator) Close() {
 }
 
 // Eval evaluates projection for the specified updated and (optional) previous row.
+// backfill indicates whether the event was produced by a scan of the table
+// (an initial scan, or a backfill during a schema change) rather than by a write.
 // Returns projection result.  If the filter does not match the event, returns
 // "zero" Row.
 func (e *Evaluator) Eval(
-	ctx context.Context, updatedRow cdcevent.Row, prevRow cdcevent.Row,
+	ctx context.Context, updatedRow cdcevent.Row, prevRow cdcevent.Row, backfill bool,
 ) (projection cdcevent.Row, evalErr error) {
 	defer func() {
 		if evalErr != nil {
@@ -154,14 +156,14 @@ func (e *Evaluator) Eval(
 		e.familyEval[updatedRow.FamilyID] = fe
 	}
 
-	return fe.eval(ctx, updatedRow, prevRow)
+	return fe.eval(ctx, updatedRow, prevRow, backfill)
 }
 
 // eval evaluates projection for the specified updated and (optional) previous row.
 // Returns projection result.  If the filter does not match the event, returns
 // "zero" Row.
 func (e *familyEvaluator) eval(
-	ctx context.Context, updatedRow cdcevent.Row, prevRow cdcevent.Row,
+	ctx context.Context, updatedRow cdcevent.Row, prevRow cdcevent.Row, backfill bool,
 ) (projection cdcevent.Row, evalErr error) {
 	if updatedRow.FamilyID != e.targetFamilyID {
 		return cdcevent.Row{}, errors.AssertionFailedf(
@@ -190,7 +192,7 @@ func (e *familyEvaluator) eval(
 	}
 
 	// Setup context.
-	if err := e.setupContextForRow(ctx, updatedRow, prevRow); err != nil {
+	if err := e.setupContextForRow(ctx, updatedRow, prevRow, backfill); err != nil {
 		return cdcevent.Row{}, err
 	}
 
@@ -455,10 +457,11 @@ func (e *familyEvaluator) copyPrevRow(prev cdcevent.Row) error {
 // setupContextForRow configures evaluation context with the provided row
 // information.
 func (e *familyEvaluator) setupContextForRow(
-	ctx context.Context, updated cdcevent.Row, prevRow cdcevent.Row,
+	ctx context.Context, updated cdcevent.Row, prevRow cdcevent.Row, backfill bool,
 ) error {
 	e.rowEvalCtx.ctx = ctx
 	e.rowEvalCtx.updatedRow = updated
+	e.rowEvalCtx.backfill = tree.MakeDBool(tree.DBool(backfill))
 
 	if updated.IsDeleted() {
 		e.rowEvalCtx.op = eventTypeDelete
@@ -507,6 +510,7 @@ type rowEvalContext struct {
 	withDiff   bool
 	updatedRow cdcevent.Row
 	op         tree.Datum
+	backfill   tree.Datum
 }
 
 // cdcAnnotationAddr is the address used to store relevant information
@@ -59,10 +59,12 @@ CREATE TABLE foo (
   g STRING,
   h STRING NOT VISIBLE,
   flag BOOL,
+  payload JSONB,
+  tags STRING[],
   PRIMARY KEY (b, a),
   FAMILY main (a, b, e, h),
   FAMILY only_c (c),
-  FAMILY f_g_fam(f, g, flag)
+  FAMILY f_g_fam(f, g, flag, payload, tags)
 )`)
 	sqlDB.Exec(t, `
 CREATE FUNCTION yesterday(mvcc DECIMAL) 
@@ -321,6 +323,33 @@ $$`)
 				},
 			},
 		},
+		{
+			testName:   "jsonb_and_array_filter",
+			familyName: "f_g_fam",
+			actions: []string{
+				`INSERT INTO foo (a, b, payload, tags) VALUES (1, 'purchase', '{"type": "purchase", "amount": 10}', ARRAY['new'])`,
+				`INSERT INTO foo (a, b, payload, tags) VALUES (2, 'return', '{"type": "purchase", "amount": 20}', ARRAY['returned'])`,
+				`INSERT INTO foo (a, b, payload, tags) VALUES (3, 'view', '{"type": "view"}', ARRAY['new'])`,
+			},
+			stmt: `SELECT a, payload->'amount' AS amount, array_length(tags, 1) AS num_tags
+             FROM foo
+             WHERE payload->>'type' = 'purchase' AND tags @> ARRAY['new']`,
+			expectMainFamily: repeatExpectation(decodeExpectation{expectUnwatchedErr: true}, 3),
+			expectFGFamily: []decodeExpectation{
+				{
+					keyValues: []string{"purchase", "1"},
+					allValues: map[string]string{"a": "1", "amount": "10", "num_tags": "1"},
+				},
+				{
+					keyValues:      []string{"return", "2"},
+					expectFiltered: true,
+				},
+				{
+					keyValues:      []string{"view", "3"},
+					expectFiltered: true,
+				},
+			},
+		},
 		{
 			testName:   "main/cdc_prev_select",
 			familyName: "only_c",
@@ -557,7 +586,7 @@ $$`)
 			defer e.Close()
 
 			ctx := context.Background()
-			decoder, err := cdcevent.NewEventDecoder(ctx, &execCfg, targets, false, false)
+			decoder, err := cdcevent.NewEventDecoder(ctx, &execCfg, roachpb.TenantID{}, targets, false, false)
 			require.NoError(t, err)
 
 			for _, action := range tc.setupActions {
@@ -600,7 +629,7 @@ $$`)
 				require.Equal(t, expect.keyValues, slurpKeys(t, updatedRow),
 					"isDelete=%t fid=%d", updatedRow.IsDeleted(), eventFamilyID)
 
-				projection, err := e.Eval(ctx, updatedRow, prevRow)
+				projection, err := e.Eval(ctx, updatedRow, prevRow, false)
 				if expect.evalErr != "" {
 					require.Regexp(t, expect.evalErr, err)
 					continue
@@ -622,7 +651,7 @@ $$`)
 				descriptorCopy := *updatedRow.EventDescriptor
 				descriptorCopy.Version++
 				updatedRow.EventDescriptor = &descriptorCopy
-				_, err = e.Eval(ctx, updatedRow, prevRow)
+				_, err = e.Eval(ctx, updatedRow, prevRow, false)
 				require.NoError(t, err)
 			}
 		})
@@ -44,6 +44,8 @@ var cdcFunctions = map[string]*tree.ResolvedFunctionDefinition{
 	"date_trunc":               useDefaultBuiltin,
 	"extract":                  useDefaultBuiltin,
 	"format":                   useDefaultBuiltin,
+	"json_build_array":         useDefaultBuiltin,
+	"json_build_object":        useDefaultBuiltin,
 	"jsonb_build_array":        useDefaultBuiltin,
 	"jsonb_build_object":       useDefaultBuiltin,
 	"row_to_json":              useDefaultBuiltin,
@@ -107,6 +109,28 @@ var cdcFunctions = map[string]*tree.ResolvedFunctionDefinition{
 			Info:       "Returns 'insert', 'update', 'upsert' or 'delete' to describe the type of the operation.",
 			Volatility: volatility.Volatile,
 		}),
+	"event_is_backfill": makeCDCBuiltIn(
+		"event_is_backfill",
+		tree.Overload{
+			Types:      tree.ParamTypes{},
+			ReturnType: tree.FixedReturnType(types.Bool),
+			Fn: func(ctx context.Context, evalCtx *eval.Context, datums tree.Datums) (tree.Datum, error) {
+				rowEvalCtx := rowEvalContextFromEvalContext(evalCtx)
+				return rowEvalCtx.backfill, nil
+			},
+			Info: "Returns true if the event was produced by an initial scan or by a " +
+				"schema change backfill, rather than by a write to the row.",
+			Volatility: volatility.Volatile,
+		}),
+	"event_mvcc_timestamp": cdcTimestampBuiltin(
+		"event_mvcc_timestamp",
+		"Returns MVCC timestamp of the event",
+		volatility.Volatile,
+		types.Decimal,
+		func(rowEvalCtx *rowEvalContext) hlc.Timestamp {
+			return rowEvalCtx.updatedRow.MvccTimestamp
+		},
+	),
 	"event_schema_timestamp": cdcTimestampBuiltin(
 		"event_schema_timestamp",
 		"Returns schema timestamp of the event.",
@@ -77,6 +77,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 		for fn, preferredOverload := range map[string]preferredFn{
 			"statement_timestamp":           expectTSTZ,
 			"transaction_timestamp":         expectTSTZ,
+			"event_mvcc_timestamp":          expectHLC,
 			"event_schema_timestamp":        expectHLC,
 			"changefeed_creation_timestamp": expectHLC,
 		} {
@@ -106,7 +107,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 				defer e.Close()
 				e.statementTS = createTS
 
-				p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+				p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 				require.NoError(t, err)
 
 				initialExpectations := map[string]string{
@@ -123,7 +124,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 				targetTS = testRow.MvccTimestamp
 				testRow.SchemaTS = schemaTS.Add(1, 0)
 				e.statementTS = e.statementTS.Add(-1, 0)
-				p, err = e.Eval(ctx, testRow, cdcevent.Row{})
+				p, err = e.Eval(ctx, testRow, cdcevent.Row{}, false)
 				require.NoError(t, err)
 
 				var updatedExpectations map[string]string
@@ -165,7 +166,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 			require.NoError(t, err)
 			defer e.Close()
 
-			p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+			p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 			require.NoError(t, err)
 
 			expectedTZ := fmt.Sprintf("%s-01:33",
@@ -237,13 +238,27 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 				require.NoError(t, err)
 				defer e.Close()
 
-				p, err := e.Eval(ctx, tc.row, tc.prevRow)
+				p, err := e.Eval(ctx, tc.row, tc.prevRow, false)
 				require.NoError(t, err)
 				require.Equal(t, map[string]string{"event_op": tc.expect}, slurpValues(t, p))
 			})
 		}
 	})
 
+	t.Run("event_is_backfill", func(t *testing.T) {
+		testRow := makeEventRow(t, desc, s.Clock().Now(), false, s.Clock().Now(), false)
+		e, err := newEvaluator(&execCfg, &semaCtx, testRow.EventDescriptor, false,
+			"SELECT event_is_backfill() FROM foo")
+		require.NoError(t, err)
+		defer e.Close()
+
+		for _, backfill := range []bool{true, false} {
+			p, err := e.Eval(ctx, testRow, cdcevent.Row{}, backfill)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"event_is_backfill": fmt.Sprint(backfill)}, slurpValues(t, p))
+		}
+	})
+
 	mustParseJSON := func(d tree.Datum) jsonb.JSON {
 		t.Helper()
 		j, err := tree.AsJSON(d, sessiondatapb.DataConversionConfig{}, time.UTC)
@@ -258,7 +273,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 		require.NoError(t, err)
 		defer e.Close()
 
-		p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+		p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 		require.NoError(t, err)
 		require.Equal(t, map[string]string{"col": "\"de_DE\""}, slurpValues(t, p))
 	})
@@ -272,7 +287,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 			require.NoError(t, err)
 			defer e.Close()
 
-			p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+			p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 			require.NoError(t, err)
 			require.Equal(t,
 				map[string]string{fn: mustParseJSON(rowDatums[0].Datum).String()},
@@ -294,7 +309,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 		}
 		expectedJSON := b.Build()
 
-		p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+		p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 		require.NoError(t, err)
 		require.Equal(t, map[string]string{"row_to_json": expectedJSON.String()}, slurpValues(t, p))
 	})
@@ -313,7 +328,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 		b.Add(jsonb.FromInt(42))
 		expectedJSON := b.Build()
 
-		p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+		p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 		require.NoError(t, err)
 		require.Equal(t, map[string]string{"three_ints": expectedJSON.String()}, slurpValues(t, p))
 	})
@@ -331,7 +346,44 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 		b.Add("c", mustParseJSON(rowDatums[2].Datum))
 		expectedJSON := b.Build()
 
-		p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+		p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"obj": expectedJSON.String()}, slurpValues(t, p))
+	})
+
+	t.Run("json_build_array", func(t *testing.T) {
+		testRow := makeEventRow(t, desc, s.Clock().Now(), false, s.Clock().Now(), false)
+		rowDatums := testRow.EncDatums()
+		e, err := newEvaluator(&execCfg, &semaCtx, testRow.EventDescriptor, false, "SELECT json_build_array(a, a, 42) AS three_ints FROM foo")
+		require.NoError(t, err)
+		defer e.Close()
+
+		b := jsonb.NewArrayBuilder(3)
+		j := mustParseJSON(rowDatums[0].Datum)
+		b.Add(j)
+		b.Add(j)
+		b.Add(jsonb.FromInt(42))
+		expectedJSON := b.Build()
+
+		p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"three_ints": expectedJSON.String()}, slurpValues(t, p))
+	})
+
+	t.Run("json_build_object", func(t *testing.T) {
+		testRow := makeEventRow(t, desc, s.Clock().Now(), false, s.Clock().Now(), false)
+		rowDatums := testRow.EncDatums()
+		e, err := newEvaluator(&execCfg, &semaCtx, testRow.EventDescriptor, false, "SELECT json_build_object('a', a, 'b', b, 'c', c) AS obj FROM foo")
+		require.NoError(t, err)
+		defer e.Close()
+
+		b := jsonb.NewObjectBuilder(3)
+		b.Add("a", mustParseJSON(rowDatums[0].Datum))
+		b.Add("b", mustParseJSON(rowDatums[1].Datum))
+		b.Add("c", mustParseJSON(rowDatums[2].Datum))
+		expectedJSON := b.Build()
+
+		p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 		require.NoError(t, err)
 		require.Equal(t, map[string]string{"obj": expectedJSON.String()}, slurpValues(t, p))
 	})
@@ -345,7 +397,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 			require.NoError(t, err)
 			defer e.Close()
 
-			p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+			p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 			require.NoError(t, err)
 			require.Equal(t,
 				map[string]string{fn: fmt.Sprintf("'%s'", jsonb.FromInt(42).String())},
@@ -361,7 +413,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 		require.NoError(t, err)
 		defer e.Close()
 
-		p, err := e.Eval(ctx, testRow, cdcevent.Row{})
+		p, err := e.Eval(ctx, testRow, cdcevent.Row{}, false)
 		require.NoError(t, err)
 		require.Equal(t, map[string]string{"overlaps": "false"}, slurpValues(t, p))
 	})
@@ -390,7 +442,7 @@ func TestEvaluatesCDCFunctionOverloads(t *testing.T) {
 				t.Run(fn, func(t *testing.T) {
 					e, err := newEvaluator(&execCfg, &semaCtx, testRow.EventDescriptor, false, fmt.Sprintf("SELECT %s(%s) FROM foo", fn, fnArgs()))
 					require.NoError(t, err)
-					_, err = e.Eval(ctx, testRow, testRow)
+					_, err = e.Eval(ctx, testRow, testRow, false)
 					require.Regexp(t, "unknown signature", err)
 				})
 			}
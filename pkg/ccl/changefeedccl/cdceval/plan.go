@@ -174,7 +174,10 @@ func withPlanner(
 		}
 
 		// Current implementation relies on row-by-row evaluation;
-		// so, ensure vectorized engine is off.
+		// so, ensure vectorized engine is off. CDC pushes a single event at a
+		// time into the flow and waits for its projection, so there is no batch
+		// for the vectorized engine to amortize its overhead over -- even for
+		// expressions (s.a. JSONB operators) that have vectorized implementations.
 		sd.VectorizeMode = sessiondatapb.VectorizeOff
 		planner, cleanup := sql.NewInternalPlanner(
 			"cdc-expr", txn.KV(),
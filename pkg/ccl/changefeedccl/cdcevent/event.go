@@ -15,11 +15,13 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/build"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/colinfo"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descs"
 	"github.com/cockroachdb/cockroach/pkg/sql/row"
 	"github.com/cockroachdb/cockroach/pkg/sql/rowenc"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
@@ -27,14 +29,33 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/cache"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/intsets"
 	"github.com/cockroachdb/cockroach/pkg/util/iterutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/redact"
+	"github.com/lib/pq/oid"
 )
 
 const virtualColOrd = 1<<31 - 1
 
+// credentialColumns are, by the ID of their system table, the columns which
+// hold credentials, such as the hashed password of each user, and which are
+// therefore fetched but not emitted. They remain available to CDC queries.
+var credentialColumns = map[descpb.ID]map[string]struct{}{
+	keys.UsersTableID: {`hashedPassword`: {}},
+}
+
+// isCredentialColumn returns whether the column of the table holds
+// credentials which changefeeds don't emit.
+func isCredentialColumn(desc catalog.TableDescriptor, col catalog.Column) bool {
+	if !catalog.IsSystemDescriptor(desc) {
+		return false
+	}
+	_, ok := credentialColumns[desc.GetID()][col.GetName()]
+	return ok
+}
+
 // Metadata describes event metadata.
 type Metadata struct {
 	TableID          descpb.ID                // Table ID.
@@ -212,6 +233,9 @@ type ResultColumn struct {
 	colinfo.ResultColumn
 	ord       int
 	sqlString string
+	// notNull is set if the column has a NOT NULL constraint. Columns of
+	// projections are always nullable.
+	notNull bool
 }
 
 // SQLStringNotHumanReadable returns the SQL statement describing the column.
@@ -224,6 +248,11 @@ func (c ResultColumn) Ordinal() int {
 	return c.ord
 }
 
+// Nullable returns true if the values of the column may be NULL.
+func (c ResultColumn) Nullable() bool {
+	return !c.notNull
+}
+
 // EventDescriptor is a cdc event descriptor: collection of information describing Row.
 type EventDescriptor struct {
 	Metadata
@@ -236,7 +265,7 @@ type EventDescriptor struct {
 	cols []ResultColumn
 
 	// Precomputed index lists into cols.
-	keyCols   []int // Primary key columns.
+	keyCols   []int // Primary key columns, or those of the watched index.
 	valueCols []int // All column family columns.
 	udtCols   []int // Columns containing UDTs.
 	allCols   []int // Contains all the columns
@@ -249,6 +278,21 @@ func NewEventDescriptor(
 	includeVirtualColumns bool,
 	keyOnly bool,
 	schemaTS hlc.Timestamp,
+) (*EventDescriptor, error) {
+	return newEventDescriptor(desc, desc.GetPrimaryIndex(), family, includeVirtualColumns, keyOnly, schemaTS)
+}
+
+// newEventDescriptor returns EventDescriptor for the entries of the specified
+// index. The key of the entries of a secondary index consists of its key
+// columns followed by the primary key columns which complete them, and their
+// value of the columns of the index, rather than those of the family.
+func newEventDescriptor(
+	desc catalog.TableDescriptor,
+	index catalog.Index,
+	family *descpb.ColumnFamilyDescriptor,
+	includeVirtualColumns bool,
+	keyOnly bool,
+	schemaTS hlc.Timestamp,
 ) (*EventDescriptor, error) {
 	sd := EventDescriptor{
 		Metadata: Metadata{
@@ -257,7 +301,7 @@ func NewEventDescriptor(
 			Version:          desc.GetVersion(),
 			FamilyID:         family.ID,
 			FamilyName:       family.Name,
-			HasOtherFamilies: desc.NumFamilies() > 1,
+			HasOtherFamilies: desc.NumFamilies() > 1 && index.Primary(),
 			SchemaTS:         schemaTS,
 		},
 		td: desc,
@@ -274,6 +318,7 @@ func NewEventDescriptor(
 			},
 			ord:       ord,
 			sqlString: col.ColumnDesc().SQLStringNotHumanReadable(),
+			notNull:   !col.IsNullable(),
 		}
 
 		colIdx := len(sd.cols)
@@ -285,33 +330,39 @@ func NewEventDescriptor(
 		return colIdx
 	}
 
-	// Primary key columns must be added in the same order they
-	// appear in the primary key index.
-	primaryIdx := desc.GetPrimaryIndex()
+	// Key columns must be added in the same order they
+	// appear in the index.
+	keyColIDs, storedColIDs := indexColumnIDs(index)
 	colOrd := catalog.ColumnIDToOrdinalMap(desc.PublicColumns())
-	sd.keyCols = make([]int, primaryIdx.NumKeyColumns())
-	var primaryKeyOrdinal catalog.TableColMap
+	sd.keyCols = make([]int, len(keyColIDs))
+	var keyOrdinal catalog.TableColMap
 
-	for i := 0; i < primaryIdx.NumKeyColumns(); i++ {
-		ord, ok := colOrd.Get(primaryIdx.GetKeyColumnID(i))
+	for i, id := range keyColIDs {
+		ord, ok := colOrd.Get(id)
 		if !ok {
-			return nil, errors.AssertionFailedf("expected to find column %d", ord)
+			return nil, errors.AssertionFailedf("expected to find column %d", id)
 		}
-		primaryKeyOrdinal.Set(desc.PublicColumns()[ord].GetID(), i)
+		keyOrdinal.Set(desc.PublicColumns()[ord].GetID(), i)
 	}
 
 	// Remaining columns go in same order as public columns,
 	// with the exception that virtual columns are reordered
-	// to be at the end.
+	// to be at the end. The entries of a secondary index only
+	// hold its own columns, so other virtual columns can't be
+	// computed for them.
 	inFamily := catalog.MakeTableColSet(family.ColumnIDs...)
+	if !index.Primary() {
+		inFamily = catalog.MakeTableColSet(append(keyColIDs, storedColIDs...)...)
+	}
 	ord := 0
+	var credentialCols intsets.Fast
 	for _, col := range desc.PublicColumns() {
 		isInFamily := inFamily.Contains(col.GetID())
 		if col.IsVirtual() {
 			sd.HasVirtual = true
 		}
-		virtual := col.IsVirtual() && includeVirtualColumns
-		pKeyOrd, isPKey := primaryKeyOrdinal.Get(col.GetID())
+		virtual := col.IsVirtual() && includeVirtualColumns && index.Primary()
+		pKeyOrd, isPKey := keyOrdinal.Get(col.GetID())
 		if keyOnly {
 			if isPKey {
 				colIdx := addColumn(col, ord)
@@ -323,7 +374,9 @@ func NewEventDescriptor(
 			if isInFamily || isPKey {
 				colIdx := addColumn(col, ord)
 				ord++
-				if isInFamily {
+				if isInFamily && !isPKey && isCredentialColumn(desc, col) {
+					credentialCols.Add(colIdx)
+				} else if isInFamily {
 					sd.valueCols = append(sd.valueCols, colIdx)
 				}
 				if isPKey {
@@ -337,9 +390,19 @@ func NewEventDescriptor(
 		}
 	}
 
+	// A sequence consists of a single row, whose sole column is nominally also
+	// its primary key. Since that column holds the (changing) value of the
+	// sequence, sequence events are emitted without key columns so that all
+	// events for a sequence share the same key.
+	if desc.IsSequence() {
+		sd.keyCols = nil
+	}
+
 	allCols := make([]int, len(sd.cols))
 	for i := 0; i < len(sd.cols); i++ {
-		allCols = append(allCols, i)
+		if !credentialCols.Contains(i) {
+			allCols = append(allCols, i)
+		}
 	}
 	sd.allCols = allCols
 
@@ -389,6 +452,7 @@ func (d *EventDescriptor) TableDescriptor() catalog.TableDescriptor {
 
 type eventDescriptorFactory func(
 	desc catalog.TableDescriptor,
+	index catalog.Index,
 	family *descpb.ColumnFamilyDescriptor,
 	schemaTS hlc.Timestamp,
 ) (*EventDescriptor, error)
@@ -409,12 +473,14 @@ type eventDecoder struct {
 	// State pertaining for decoding of a single key.
 	fetcher  fetcher                        // Fetcher to decode KV
 	desc     catalog.TableDescriptor        // Current descriptor
+	index    catalog.Index                  // Current index
 	family   *descpb.ColumnFamilyDescriptor // Current family
 	schemaTS hlc.Timestamp                  // Schema timestamp.
 }
 
 func getEventDescriptorCached(
 	desc catalog.TableDescriptor,
+	index catalog.Index,
 	family *descpb.ColumnFamilyDescriptor,
 	includeVirtual bool,
 	keyOnly bool,
@@ -430,7 +496,7 @@ func getEventDescriptorCached(
 		}
 	}
 
-	ed, err := NewEventDescriptor(desc, family, includeVirtual, keyOnly, schemaTS)
+	ed, err := newEventDescriptor(desc, index, family, includeVirtual, keyOnly, schemaTS)
 	if err != nil {
 		return nil, err
 	}
@@ -438,19 +504,27 @@ func getEventDescriptorCached(
 	return ed, nil
 }
 
-// NewEventDecoder returns key value decoder.
+// NewEventDecoder returns key value decoder. If tenantID is set, the targets
+// are tables of that secondary tenant rather than of the local tenant.
 func NewEventDecoder(
 	ctx context.Context,
 	cfg *sql.ExecutorConfig,
+	tenantID roachpb.TenantID,
 	targets changefeedbase.Targets,
 	includeVirtual bool,
 	keyOnly bool,
 ) (Decoder, error) {
+	codec, leaseMgr, cf := cfg.Codec, cfg.LeaseManager, cfg.CollectionFactory
+	if tenantID.IsSet() {
+		// The lease manager only serves descriptors of the local tenant.
+		codec, leaseMgr = keys.MakeSQLCodec(tenantID), nil
+		cf = descs.NewBareBonesCollectionFactory(cfg.Settings, codec)
+	}
 	rfCache, err := newRowFetcherCache(
 		ctx,
-		cfg.Codec,
-		cfg.LeaseManager,
-		cfg.CollectionFactory,
+		codec,
+		leaseMgr,
+		cf,
 		cfg.DB,
 		targets,
 	)
@@ -461,10 +535,11 @@ func NewEventDecoder(
 	eventDescriptorCache := cache.NewUnorderedCache(DefaultCacheConfig)
 	getEventDescriptor := func(
 		desc catalog.TableDescriptor,
+		index catalog.Index,
 		family *descpb.ColumnFamilyDescriptor,
 		schemaTS hlc.Timestamp,
 	) (*EventDescriptor, error) {
-		return getEventDescriptorCached(desc, family, includeVirtual, keyOnly, schemaTS, eventDescriptorCache)
+		return getEventDescriptorCached(desc, index, family, includeVirtual, keyOnly, schemaTS, eventDescriptorCache)
 	}
 
 	return &eventDecoder{
@@ -489,6 +564,10 @@ func (d *eventDecoder) DecodeKV(
 		return Row{}, err
 	}
 
+	if d.desc.IsSequence() {
+		return d.decodeSequenceKV(kv, rt, schemaTS)
+	}
+
 	d.kvProvider.KVs = d.kvProvider.KVs[:0]
 	d.kvProvider.KVs = append(d.kvProvider.KVs, kv)
 	if err := d.fetcher.ConsumeKVProvider(ctx, &d.kvProvider); err != nil {
@@ -500,7 +579,7 @@ func (d *eventDecoder) DecodeKV(
 		return Row{}, err
 	}
 
-	ed, err := d.getEventDescriptor(d.desc, d.family, schemaTS)
+	ed, err := d.getEventDescriptor(d.desc, d.index, d.family, schemaTS)
 	if err != nil {
 		return Row{}, err
 	}
@@ -514,23 +593,64 @@ func (d *eventDecoder) DecodeKV(
 	}, nil
 }
 
+// decodeSequenceKV decodes the key value of a sequence. Unlike table rows,
+// sequence values are stored as bare integers rather than being encoded by
+// column family, so they cannot be decoded by the row fetcher.
+func (d *eventDecoder) decodeSequenceKV(
+	kv roachpb.KeyValue, rt RowType, schemaTS hlc.Timestamp,
+) (Row, error) {
+	ed, err := d.getEventDescriptor(d.desc, d.index, d.family, schemaTS)
+	if err != nil {
+		return Row{}, err
+	}
+
+	isDeleted := !kv.Value.IsPresent()
+	value := tree.DNull
+	if !isDeleted {
+		v, err := kv.Value.GetInt()
+		if err != nil {
+			return Row{}, err
+		}
+		value = d.alloc.NewDInt(tree.DInt(v))
+	}
+
+	// Lay out datums the same way as the row fetcher: the sequence value,
+	// followed by the system columns.
+	datums := rowenc.EncDatumRow{
+		rowenc.DatumToEncDatum(types.Int, value),
+		rowenc.DatumToEncDatum(colinfo.MVCCTimestampColumnType, eval.TimestampToDecimalDatum(kv.Value.Timestamp)),
+	}
+	if rt != PrevRow {
+		datums = append(datums, rowenc.DatumToEncDatum(types.Oid, tree.NewDOid(oid.Oid(d.desc.GetID()))))
+	}
+
+	return Row{
+		EventDescriptor: ed,
+		MvccTimestamp:   kv.Value.Timestamp,
+		datums:          datums,
+		deleted:         isDeleted,
+		alloc:           &d.alloc,
+	}, nil
+}
+
 // initForKey initializes decoder state to prepare it to decode
 // key/value at specified timestamp.
 func (d *eventDecoder) initForKey(
 	ctx context.Context, key roachpb.Key, schemaTS hlc.Timestamp, keyOnly bool,
 ) error {
-	desc, familyID, err := d.rfCache.tableDescForKey(ctx, key, schemaTS)
+	desc, index, familyID, err := d.rfCache.tableDescForKey(ctx, key, schemaTS)
 	if err != nil {
 		return err
 	}
 
-	fetcher, family, err := d.rfCache.RowFetcherForColumnFamily(desc, familyID, systemColumns, keyOnly)
+	fetcher, family, err := d.rfCache.rowFetcherForIndexFamily(desc, index, familyID, systemColumns, keyOnly)
 	if err != nil {
 		return err
 	}
 
 	d.schemaTS = schemaTS
 	d.desc = desc
+	d.index = index
 	d.family = family
 	d.fetcher.Fetcher = fetcher
 	return nil
@@ -653,7 +773,7 @@ func TestingMakeEventRowFromDatums(datums tree.Datums) Row {
 func TestingGetFamilyIDFromKey(
 	decoder Decoder, key roachpb.Key, ts hlc.Timestamp,
 ) (descpb.FamilyID, error) {
-	_, familyID, err := decoder.(*eventDecoder).rfCache.tableDescForKey(context.Background(), key, ts)
+	_, _, familyID, err := decoder.(*eventDecoder).rfCache.tableDescForKey(context.Background(), key, ts)
 	return familyID, err
 }
 
@@ -737,6 +857,48 @@ func TestingMakeEventRowFromEncDatums(
 	}
 }
 
+// indexColumnIDs returns the IDs of the key columns of the entries of an
+// index, and of the other columns it stores. The key of the entries of a
+// secondary index consists of its key columns followed by the primary key
+// columns which complete them.
+func indexColumnIDs(index catalog.Index) (key, stored []descpb.ColumnID) {
+	for i := 0; i < index.NumKeyColumns(); i++ {
+		key = append(key, index.GetKeyColumnID(i))
+	}
+	if index.Primary() {
+		return key, nil
+	}
+	for i := 0; i < index.NumKeySuffixColumns(); i++ {
+		key = append(key, index.GetKeySuffixColumnID(i))
+	}
+	for i := 0; i < index.NumSecondaryStoredColumns(); i++ {
+		stored = append(stored, index.GetStoredColumnID(i))
+	}
+	return key, stored
+}
+
+// getRelevantColumnsForIndex returns an array of column ids for the public
+// columns of the entries of a secondary index, or only its key columns if
+// keyOnly is set, in the order of tableDesc.PublicColumns().
+func getRelevantColumnsForIndex(
+	tableDesc catalog.TableDescriptor, index catalog.Index, keyOnly bool,
+) []descpb.ColumnID {
+	key, stored := indexColumnIDs(index)
+	cols := catalog.MakeTableColSet(key...)
+	if !keyOnly {
+		for _, colID := range stored {
+			cols.Add(colID)
+		}
+	}
+	result := make([]descpb.ColumnID, 0, cols.Len())
+	for _, colID := range tableDesc.PublicColumnIDs() {
+		if cols.Contains(colID) {
+			result = append(result, colID)
+		}
+	}
+	return result
+}
+
 // getRelevantColumnsForFamily returns an array of column ids for public columns
 // including only primary key columns and columns in the specified familyDesc,
 // If includeVirtual is true, virtual columns, which may be outside the specified
@@ -33,10 +33,11 @@ func MakeProjection(d *EventDescriptor) Projection {
 		EventDescriptor: &EventDescriptor{Metadata: d.Metadata},
 	}
 
-	// Add all primary key columns.
+	// Add all primary key columns, which keep their nullability.
 	for _, colIdx := range d.keyCols {
 		col := d.cols[colIdx]
 		p.addColumn(col.Name, col.Typ, col.sqlString, &p.keyCols)
+		p.cols[len(p.cols)-1].notNull = col.notNull
 	}
 	return p
 }
@@ -35,7 +35,9 @@ import (
 // ConsumeKVProvider() can be used to turn that key (or all the keys making up
 // the column families of one row) into a row.
 type rowFetcherCache struct {
-	codec           keys.SQLCodec
+	codec keys.SQLCodec
+	// leaseMgr is nil when decoding keys of a secondary tenant, whose
+	// descriptors are read from storage instead.
 	leaseMgr        *lease.Manager
 	fetchers        *cache.UnorderedCache
 	watchedFamilies map[watchedFamily]struct{}
@@ -89,7 +91,12 @@ func newRowFetcherCache(
 }
 
 func refreshUDT(
-	ctx context.Context, tableID descpb.ID, db *kv.DB, collection *descs.Collection, ts hlc.Timestamp,
+	ctx context.Context,
+	tableID descpb.ID,
+	db *kv.DB,
+	collection *descs.Collection,
+	ts hlc.Timestamp,
+	withLeased bool,
 ) (tableDesc catalog.TableDescriptor, err error) {
 	// If the table contains user defined types, then use the
 	// descs.Collection to retrieve a TableDescriptor with type metadata
@@ -106,7 +113,11 @@ func refreshUDT(
 		if err != nil {
 			return err
 		}
-		tableDesc, err = collection.ByIDWithLeased(txn).WithoutNonPublic().Get().Table(ctx, tableID)
+		getter := collection.ByID(txn)
+		if withLeased {
+			getter = collection.ByIDWithLeased(txn)
+		}
+		tableDesc, err = getter.WithoutNonPublic().Get().Table(ctx, tableID)
 		return err
 	}); err != nil {
 		// Manager can return all kinds of errors during chaos, but based on
@@ -119,57 +130,90 @@ func refreshUDT(
 	return tableDesc, nil
 }
 
+// tableDescForKey returns the descriptor of the table the key belongs to, as
+// well as the index and column family the key encodes an entry of. The index
+// is the primary index of the table, unless the key belongs to the secondary
+// index watched by an index target.
 func (c *rowFetcherCache) tableDescForKey(
 	ctx context.Context, key roachpb.Key, ts hlc.Timestamp,
-) (catalog.TableDescriptor, descpb.FamilyID, error) {
+) (catalog.TableDescriptor, catalog.Index, descpb.FamilyID, error) {
 	var tableDesc catalog.TableDescriptor
 	key, err := c.codec.StripTenantPrefix(key)
 	if err != nil {
-		return nil, descpb.FamilyID(0), err
+		return nil, nil, descpb.FamilyID(0), err
 	}
-	remaining, tableID, _, err := rowenc.DecodePartialTableIDIndexID(key)
+	remaining, tableID, indexID, err := rowenc.DecodePartialTableIDIndexID(key)
 	if err != nil {
-		return nil, descpb.FamilyID(0), err
+		return nil, nil, descpb.FamilyID(0), err
 	}
 
 	familyID, err := keys.DecodeFamilyKey(key)
 	if err != nil {
-		return nil, descpb.FamilyID(0), err
+		return nil, nil, descpb.FamilyID(0), err
 	}
 
 	family := descpb.FamilyID(familyID)
 
+	if c.leaseMgr == nil {
+		// Read the descriptor, with its types hydrated, from storage.
+		tableDesc, err = refreshUDT(ctx, tableID, c.db, c.collection, ts, false /* withLeased */)
+		if err != nil {
+			return nil, nil, family, err
+		}
+		index, err := skipKeyColumns(tableDesc, indexID, remaining)
+		return tableDesc, index, family, err
+	}
+
 	// Retrieve the target TableDescriptor from the lease manager. No caching
 	// is attempted because the lease manager does its own caching.
 	desc, err := c.leaseMgr.Acquire(ctx, ts, tableID)
 	if err != nil {
 		// Manager can return all kinds of errors during chaos, but based on
 		// its usage, none of them should ever be terminal.
-		return nil, family, changefeedbase.MarkRetryableError(err)
+		return nil, nil, family, changefeedbase.MarkRetryableError(err)
 	}
 	tableDesc = desc.Underlying().(catalog.TableDescriptor)
 	// Immediately release the lease, since we only need it for the exact
 	// timestamp requested.
 	desc.Release(ctx)
+	if tableDesc.Offline() {
+		return nil, nil, family, ErrOfflineTable
+	}
 	if catalog.MaybeRequiresHydration(tableDesc) {
-		tableDesc, err = refreshUDT(ctx, tableID, c.db, c.collection, ts)
+		tableDesc, err = refreshUDT(ctx, tableID, c.db, c.collection, ts, true /* withLeased */)
 		if err != nil {
-			return nil, family, err
+			return nil, nil, family, err
 		}
 	}
 
-	// Skip over the column data.
-	for skippedCols := 0; skippedCols < tableDesc.GetPrimaryIndex().NumKeyColumns(); skippedCols++ {
+	index, err := skipKeyColumns(tableDesc, indexID, remaining)
+	return tableDesc, index, family, err
+}
+
+// skipKeyColumns checks that the remainder of a key holds the values of the
+// key columns of the specified index of the table, which it returns.
+func skipKeyColumns(
+	tableDesc catalog.TableDescriptor, indexID descpb.IndexID, remaining []byte,
+) (catalog.Index, error) {
+	index, err := catalog.MustFindIndexByID(tableDesc, indexID)
+	if err != nil {
+		return nil, err
+	}
+	for skippedCols := 0; skippedCols < index.NumKeyColumns(); skippedCols++ {
 		l, err := encoding.PeekLength(remaining)
 		if err != nil {
-			return nil, family, err
+			return nil, err
 		}
 		remaining = remaining[l:]
 	}
-
-	return tableDesc, family, nil
+	return index, nil
 }
 
+// ErrOfflineTable is a sentinel error that indicates that the row was
+// written while its table was offline, e.g. by an IMPORT INTO. Changefeeds
+// which wait for their tables to come back online re-scan them once they do.
+var ErrOfflineTable = errors.New("watched table is offline")
+
 // ErrUnwatchedFamily is a sentinel error that indicates this part of the row
 // is not being watched and does not need to be decoded.
 var ErrUnwatchedFamily = errors.New("watched table but unwatched family")
@@ -181,6 +225,19 @@ func (c *rowFetcherCache) RowFetcherForColumnFamily(
 	family descpb.FamilyID,
 	sysCols []descpb.ColumnDescriptor,
 	keyOnly bool,
+) (*row.Fetcher, *descpb.ColumnFamilyDescriptor, error) {
+	return c.rowFetcherForIndexFamily(tableDesc, tableDesc.GetPrimaryIndex(), family, sysCols, keyOnly)
+}
+
+// rowFetcherForIndexFamily returns row.Fetcher for the specified column family
+// of the entries of the specified index. Since a changefeed watches a single
+// index of each table, fetchers aren't cached by index.
+func (c *rowFetcherCache) rowFetcherForIndexFamily(
+	tableDesc catalog.TableDescriptor,
+	index catalog.Index,
+	family descpb.FamilyID,
+	sysCols []descpb.ColumnDescriptor,
+	keyOnly bool,
 ) (*row.Fetcher, *descpb.ColumnFamilyDescriptor, error) {
 	idVer := CacheKey{ID: tableDesc.GetID(), Version: tableDesc.GetVersion(), FamilyID: family}
 	if v, ok := c.fetchers.Get(idVer); ok {
@@ -223,9 +280,12 @@ func (c *rowFetcherCache) RowFetcherForColumnFamily(
 	var spec fetchpb.IndexFetchSpec
 
 	var relevantColumns descpb.ColumnIDs
-	if keyOnly {
+	switch {
+	case !index.Primary():
+		relevantColumns = getRelevantColumnsForIndex(tableDesc, index, keyOnly)
+	case keyOnly:
 		relevantColumns = tableDesc.GetPrimaryIndex().CollectKeyColumnIDs().Ordered()
-	} else {
+	default:
 		relevantColumns, err = getRelevantColumnsForFamily(tableDesc, familyDesc)
 	}
 	if err != nil {
@@ -233,7 +293,7 @@ func (c *rowFetcherCache) RowFetcherForColumnFamily(
 	}
 
 	if err := rowenc.InitIndexFetchSpec(
-		&spec, c.codec, tableDesc, tableDesc.GetPrimaryIndex(), relevantColumns,
+		&spec, c.codec, tableDesc, index, relevantColumns,
 	); err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,58 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+/*
+Package cdclib implements the changefeed stream protocol, with which a
+changefeed delivers its rows to the source adapter of a streaming engine, such
+as Apache Flink or Kafka Connect, over a plain TCP connection. It contains the
+framing of the protocol, which is used by the stream sink of changefeeds, and
+Source, a reference implementation of the receiving end for adapters written in
+Go.
+
+A changefeed created with a stream://host:port sink URI opens one connection
+to the adapter for every processor which emits rows or watermarks. Each
+connection is a split of the changefeed: the adapter is told which topics the
+split carries when it is assigned, and may treat the split as the unit of
+parallelism and of checkpointing.
+
+A changefeed created with a sidecar://name sink URI speaks the same protocol
+over the unix socket of a sidecar process running alongside each node, which
+is registered under that name with the changefeed.sidecar_sinks cluster
+setting. Sidecars let destinations which changefeeds don't support be added
+without changing changefeeds themselves; a Source may serve a sidecar by
+listening on the socket.
+
+A changefeed created with a file:///path sink URI writes the same frames to
+segment files in that directory, relative to the external IO directory of each
+node, for environments in which the downstream system is only reachable
+intermittently. Segments are read with ReadSegment, e.g. by the cockroach debug
+changefeed-replay command, to forward their rows once it is reachable again.
+
+Every message is sent as a frame consisting of a one byte frame type, the
+length of the payload as a four byte big endian unsigned integer, and a
+payload of JSON. Byte strings in payloads are encoded in base64, and
+timestamps as objects with wall_time and logical fields. Frames are:
+
+	Hello (1)      changefeed -> adapter  Assigns a split. Always the first frame.
+	Schema (2)     changefeed -> adapter  Announces a table version and its columns.
+	Row (3)        changefeed -> adapter  A row, encoded in the changefeed's format.
+	Watermark (4)  changefeed -> adapter  A resolved timestamp of the changefeed.
+	Flush (5)      changefeed -> adapter  Asks for the preceding frames to be acked.
+	Ack (6)        adapter -> changefeed  Acknowledges a flush, or rejects it.
+
+A watermark means that every row of the changefeed, across all of its splits,
+with an updated timestamp at or below the watermark has been acknowledged by
+the adapter; it is the point up to which a streaming engine may advance its
+event time. The changefeed doesn't advance its own checkpoint past rows which
+have not been acknowledged, so an adapter which acks a flush only once it has
+durably handled the preceding frames receives every row at least once.
+
+Readers must ignore frame types they don't know, so that frames may be added
+to the protocol without changing its version.
+*/
+package cdclib
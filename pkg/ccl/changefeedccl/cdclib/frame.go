@@ -0,0 +1,262 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package cdclib
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ProtocolVersion is the version of the stream protocol implemented by this
+// package.
+const ProtocolVersion = 1
+
+// MaxFrameSize is the size of the largest frame payload which is read.
+const MaxFrameSize = 64 << 20
+
+// frameHeaderSize is the size of the type and length which precede the
+// payload of a frame.
+const frameHeaderSize = 5
+
+// FrameType is the type of a frame.
+type FrameType byte
+
+// The frame types of the protocol. See the package documentation.
+const (
+	FrameHello     FrameType = 1
+	FrameSchema    FrameType = 2
+	FrameRow       FrameType = 3
+	FrameWatermark FrameType = 4
+	FrameFlush     FrameType = 5
+	FrameAck       FrameType = 6
+)
+
+func (t FrameType) String() string {
+	switch t {
+	case FrameHello:
+		return `hello`
+	case FrameSchema:
+		return `schema`
+	case FrameRow:
+		return `row`
+	case FrameWatermark:
+		return `watermark`
+	case FrameFlush:
+		return `flush`
+	case FrameAck:
+		return `ack`
+	default:
+		return fmt.Sprintf(`unknown(%d)`, byte(t))
+	}
+}
+
+// Message is the payload of a frame.
+type Message interface {
+	// FrameType returns the type of the frames carrying the message.
+	FrameType() FrameType
+}
+
+// Timestamp is an HLC timestamp of the changefeed.
+type Timestamp struct {
+	WallTime int64 `json:"wall_time"`
+	Logical  int32 `json:"logical"`
+}
+
+// Less returns whether t is before u.
+func (t Timestamp) Less(u Timestamp) bool {
+	return t.WallTime < u.WallTime || (t.WallTime == u.WallTime && t.Logical < u.Logical)
+}
+
+// IsEmpty returns whether t is the zero timestamp.
+func (t Timestamp) IsEmpty() bool {
+	return t == Timestamp{}
+}
+
+// String returns the timestamp as a decimal, in the form accepted by the
+// cursor option of changefeeds.
+func (t Timestamp) String() string {
+	return fmt.Sprintf(`%d.%010d`, t.WallTime, t.Logical)
+}
+
+// Split describes a connection of a changefeed.
+type Split struct {
+	// ID identifies the split. It is unique for each connection, including
+	// the connections opened when a changefeed restarts.
+	ID string `json:"id"`
+	// JobID is the id of the changefeed job, or 0 for changefeeds without a
+	// job.
+	JobID int64 `json:"job_id"`
+	// Topics are the topics of the rows which the split may carry.
+	Topics []string `json:"topics"`
+}
+
+// Hello assigns a split to the adapter.
+type Hello struct {
+	Version int   `json:"version"`
+	Split   Split `json:"split"`
+	// Format and Envelope are the format and envelope options of the
+	// changefeed, which determine the encoding of keys and values of rows.
+	Format   string `json:"format"`
+	Envelope string `json:"envelope"`
+}
+
+// Schema announces a version of the table of a topic. It is sent before the
+// first row of each version on each split.
+type Schema struct {
+	Topic    string `json:"topic"`
+	TableID  uint32 `json:"table_id"`
+	FamilyID uint32 `json:"family_id"`
+	Version  uint32 `json:"version"`
+	// Columns are the columns of the rows of the version, in the order in
+	// which they're encoded. The primary key columns come first.
+	Columns []Column `json:"columns,omitempty"`
+}
+
+// Column describes a column of the rows of a table version.
+type Column struct {
+	Name string `json:"name"`
+	// Type is the SQL type of the column, e.g. INT8 or STRING.
+	Type string `json:"type"`
+	// PrimaryKey is set for the columns of the primary key, which are the
+	// columns of the keys of rows.
+	PrimaryKey bool `json:"primary_key,omitempty"`
+}
+
+// Row is a row of the changefeed.
+type Row struct {
+	Topic   string    `json:"topic"`
+	Key     []byte    `json:"key"`
+	Value   []byte    `json:"value"`
+	Updated Timestamp `json:"updated"`
+	MVCC    Timestamp `json:"mvcc"`
+}
+
+// Watermark is a resolved timestamp of the changefeed.
+type Watermark struct {
+	Resolved Timestamp `json:"resolved"`
+}
+
+// Flush asks the adapter to acknowledge the frames sent before it.
+type Flush struct {
+	Seq uint64 `json:"seq"`
+}
+
+// Ack acknowledges the flush with the same sequence number. If Error is set,
+// the adapter failed to handle the preceding frames and the changefeed
+// retries.
+type Ack struct {
+	Seq   uint64 `json:"seq"`
+	Error string `json:"error,omitempty"`
+}
+
+// UnknownMessage is a message of a frame type which isn't known to this
+// package.
+type UnknownMessage struct {
+	Type    FrameType
+	Payload []byte
+}
+
+// FrameType implements the Message interface.
+func (Hello) FrameType() FrameType { return FrameHello }
+
+// FrameType implements the Message interface.
+func (Schema) FrameType() FrameType { return FrameSchema }
+
+// FrameType implements the Message interface.
+func (Row) FrameType() FrameType { return FrameRow }
+
+// FrameType implements the Message interface.
+func (Watermark) FrameType() FrameType { return FrameWatermark }
+
+// FrameType implements the Message interface.
+func (Flush) FrameType() FrameType { return FrameFlush }
+
+// FrameType implements the Message interface.
+func (Ack) FrameType() FrameType { return FrameAck }
+
+// FrameType implements the Message interface.
+func (m UnknownMessage) FrameType() FrameType { return m.Type }
+
+// WriteMessage writes the frame of a message.
+func WriteMessage(w io.Writer, m Message) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxFrameSize {
+		return errors.Errorf(`%s frame of %d bytes exceeds the maximum of %d bytes`,
+			m.FrameType(), len(payload), MaxFrameSize)
+	}
+	var header [frameHeaderSize]byte
+	header[0] = byte(m.FrameType())
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// ReadMessage reads the next frame and decodes its message. Frames of unknown
+// types are returned as an UnknownMessage.
+func ReadMessage(r io.Reader) (Message, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	t := FrameType(header[0])
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxFrameSize {
+		return nil, errors.Errorf(`%s frame of %d bytes exceeds the maximum of %d bytes`,
+			t, size, MaxFrameSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.Wrapf(err, `reading %s frame`, t)
+	}
+
+	var m Message
+	var err error
+	switch t {
+	case FrameHello:
+		var msg Hello
+		err = json.Unmarshal(payload, &msg)
+		m = msg
+	case FrameSchema:
+		var msg Schema
+		err = json.Unmarshal(payload, &msg)
+		m = msg
+	case FrameRow:
+		var msg Row
+		err = json.Unmarshal(payload, &msg)
+		m = msg
+	case FrameWatermark:
+		var msg Watermark
+		err = json.Unmarshal(payload, &msg)
+		m = msg
+	case FrameFlush:
+		var msg Flush
+		err = json.Unmarshal(payload, &msg)
+		m = msg
+	case FrameAck:
+		var msg Ack
+		err = json.Unmarshal(payload, &msg)
+		m = msg
+	default:
+		return UnknownMessage{Type: t, Payload: payload}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, `decoding %s frame`, t)
+	}
+	return m, nil
+}
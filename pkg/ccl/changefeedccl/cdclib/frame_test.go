@@ -0,0 +1,104 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package cdclib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	msgs := []Message{
+		Hello{
+			Version:  ProtocolVersion,
+			Split:    Split{ID: `a`, JobID: 1, Topics: []string{`foo`, `bar`}},
+			Format:   `json`,
+			Envelope: `wrapped`,
+		},
+		Schema{
+			Topic:    `foo`,
+			TableID:  104,
+			FamilyID: 1,
+			Version:  3,
+			Columns: []Column{
+				{Name: `a`, Type: `INT8`, PrimaryKey: true},
+				{Name: `b`, Type: `STRING`},
+			},
+		},
+		Row{
+			Topic:   `foo`,
+			Key:     []byte(`[1]`),
+			Value:   []byte{0, 1, 2, 0xff},
+			Updated: Timestamp{WallTime: 2, Logical: 1},
+			MVCC:    Timestamp{WallTime: 2, Logical: 1},
+		},
+		Watermark{Resolved: Timestamp{WallTime: 3}},
+		Flush{Seq: 7},
+		Ack{Seq: 7, Error: `boom`},
+	}
+
+	var buf bytes.Buffer
+	for _, m := range msgs {
+		require.NoError(t, WriteMessage(&buf, m))
+	}
+	// Frames of unknown types are returned as they are.
+	unknown := UnknownMessage{Type: 42, Payload: []byte(`{}`)}
+	buf.Write([]byte{42, 0, 0, 0, 2})
+	buf.Write(unknown.Payload)
+
+	for _, expected := range append(msgs, unknown) {
+		m, err := ReadMessage(&buf)
+		require.NoError(t, err)
+		require.Equal(t, expected, m)
+	}
+	_, err := ReadMessage(&buf)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	header := func(t FrameType, size uint32) []byte {
+		b := []byte{byte(t), 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], size)
+		return b
+	}
+
+	_, err := ReadMessage(bytes.NewReader(header(FrameRow, MaxFrameSize+1)))
+	require.Regexp(t, `row frame of \d+ bytes exceeds the maximum`, err)
+
+	_, err = ReadMessage(bytes.NewReader(append(header(FrameRow, 10), `{}`...)))
+	require.Regexp(t, `reading row frame`, err)
+
+	_, err = ReadMessage(bytes.NewReader(append(header(FrameAck, 2), `[]`...)))
+	require.Regexp(t, `decoding ack frame`, err)
+}
+
+func TestTimestamp(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	a := Timestamp{WallTime: 1, Logical: 2}
+	b := Timestamp{WallTime: 1, Logical: 3}
+	require.True(t, a.Less(b))
+	require.False(t, b.Less(a))
+	require.False(t, a.Less(a))
+	require.True(t, Timestamp{}.IsEmpty())
+	require.Equal(t, `1.0000000002`, a.String())
+}
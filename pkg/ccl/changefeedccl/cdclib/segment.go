@@ -0,0 +1,115 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package cdclib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// SegmentSuffix is the suffix of the names of segment files.
+const SegmentSuffix = `.cdclog`
+
+// segmentTimeFormat is the format of the creation time which prefixes the
+// names of segment files, so that they sort in the order they were created.
+const segmentTimeFormat = `20060102T150405.000000000Z`
+
+// SegmentName returns the name of the seq'th segment file of a split of a
+// job, created at the given time.
+func SegmentName(created time.Time, jobID int64, splitID string, seq int) string {
+	return fmt.Sprintf(`%s-%d-%s-%06d%s`,
+		created.UTC().Format(segmentTimeFormat), jobID, splitID, seq, SegmentSuffix)
+}
+
+// SegmentJobID returns the ID of the job which wrote the segment file with
+// the given name, or false if the name isn't that of a segment.
+func SegmentJobID(name string) (int64, bool) {
+	// The creation time is formatted with a fixed number of digits.
+	if len(name) <= len(segmentTimeFormat) || name[len(segmentTimeFormat)] != '-' {
+		return 0, false
+	}
+	rest := name[len(segmentTimeFormat)+1:]
+	end := strings.IndexByte(rest, '-')
+	if end < 0 {
+		return 0, false
+	}
+	jobID, err := strconv.ParseInt(rest[:end], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return jobID, true
+}
+
+// ListSegments returns the names of the segment files in dir, in the order
+// in which they were created.
+func ListSegments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), SegmentSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ReadSegment reads the frames of a segment file, calling fn with the Hello
+// frame which begins the segment and each message which follows it.
+//
+// A segment consists of the frames which a changefeed would send over a single
+// connection, without flushes: a Hello frame assigning the split, and the
+// Schema, Row and Watermark frames of the split. A segment which was being
+// written when its node crashed may end with a truncated frame, in which case
+// the segment is read up to that frame. The rows of the truncated frame, and
+// any rows which weren't flushed before the crash, are emitted again once the
+// changefeed resumes.
+func ReadSegment(r io.Reader, fn func(hello Hello, m Message) error) error {
+	br := bufio.NewReader(r)
+	msg, err := ReadMessage(br)
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// The node crashed before the segment was assigned its split.
+			return nil
+		}
+		return err
+	}
+	hello, ok := msg.(Hello)
+	if !ok {
+		return errors.Errorf(`segment begins with a %s frame rather than a hello frame`,
+			msg.FrameType())
+	}
+	if hello.Version > ProtocolVersion {
+		return errors.Errorf(`segment has protocol version %d, newer than %d`,
+			hello.Version, ProtocolVersion)
+	}
+	for {
+		msg, err := ReadMessage(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		if err := fn(hello, msg); err != nil {
+			return err
+		}
+	}
+}
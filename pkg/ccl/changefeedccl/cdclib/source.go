@@ -0,0 +1,151 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package cdclib
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Handler receives the splits of changefeeds from a Source. Its methods are
+// called concurrently for different splits, but never concurrently for any
+// one split.
+type Handler interface {
+	// AssignSplit is called when a changefeed opens a connection. Returning an
+	// error rejects the split, and the changefeed retries.
+	AssignSplit(ctx context.Context, hello Hello) error
+	// Schema is called before the first row of each table version.
+	Schema(ctx context.Context, split Split, schema Schema) error
+	// Row is called for each row of the split.
+	Row(ctx context.Context, split Split, row Row) error
+	// Watermark is called for each resolved timestamp of the changefeed.
+	Watermark(ctx context.Context, split Split, watermark Watermark) error
+	// Checkpoint is called when the changefeed flushes the split. The flush
+	// is acknowledged once Checkpoint returns, so any state derived from the
+	// preceding messages should be made durable before it does. Returning an
+	// error fails the flush, and the changefeed retries.
+	Checkpoint(ctx context.Context, split Split) error
+	// ReleaseSplit is called when the connection of a split is closed, with
+	// the error which closed it, if any.
+	ReleaseSplit(split Split, err error)
+}
+
+// Source accepts the connections of changefeeds with stream sinks and passes
+// their messages to a Handler.
+type Source struct {
+	ln      net.Listener
+	handler Handler
+}
+
+// NewSource returns a Source which accepts connections from ln.
+func NewSource(ln net.Listener, handler Handler) *Source {
+	return &Source{ln: ln, handler: handler}
+}
+
+// Serve accepts connections until the context is canceled or the listener
+// is closed, and then waits for the connections to be released.
+func (s *Source) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	go func() {
+		<-ctx.Done()
+		_ = s.ln.Close()
+	}()
+
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (s *Source) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	// Unblock reads of the connection when the source is stopped.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	msg, err := ReadMessage(r)
+	if err != nil {
+		return
+	}
+	hello, ok := msg.(Hello)
+	if !ok {
+		return
+	}
+	if hello.Version > ProtocolVersion {
+		return
+	}
+	if err := s.handler.AssignSplit(ctx, hello); err != nil {
+		return
+	}
+	err = s.serveSplit(ctx, hello.Split, r, conn)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	s.handler.ReleaseSplit(hello.Split, err)
+}
+
+func (s *Source) serveSplit(ctx context.Context, split Split, r io.Reader, w io.Writer) error {
+	for {
+		msg, err := ReadMessage(r)
+		if err != nil {
+			return err
+		}
+		switch m := msg.(type) {
+		case Schema:
+			err = s.handler.Schema(ctx, split, m)
+		case Row:
+			err = s.handler.Row(ctx, split, m)
+		case Watermark:
+			err = s.handler.Watermark(ctx, split, m)
+		case Flush:
+			ack := Ack{Seq: m.Seq}
+			if err := s.handler.Checkpoint(ctx, split); err != nil {
+				ack.Error = err.Error()
+			}
+			err = WriteMessage(w, ack)
+		case Hello:
+			err = errors.Errorf(`split %s was assigned twice`, split.ID)
+		default:
+			// Frames of unknown types are ignored.
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
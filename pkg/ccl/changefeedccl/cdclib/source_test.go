@@ -0,0 +1,124 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package cdclib
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHandler records the calls made to it.
+type recordingHandler struct {
+	failCheckpoint bool
+	released       chan error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (h *recordingHandler) record(format string, args ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, fmt.Sprintf(format, args...))
+}
+
+func (h *recordingHandler) AssignSplit(_ context.Context, hello Hello) error {
+	h.record(`assign %s %v`, hello.Split.ID, hello.Split.Topics)
+	return nil
+}
+
+func (h *recordingHandler) Schema(_ context.Context, split Split, schema Schema) error {
+	h.record(`schema %s %s@%d`, split.ID, schema.Topic, schema.Version)
+	return nil
+}
+
+func (h *recordingHandler) Row(_ context.Context, split Split, row Row) error {
+	h.record(`row %s %s %s`, split.ID, row.Topic, row.Value)
+	return nil
+}
+
+func (h *recordingHandler) Watermark(_ context.Context, split Split, w Watermark) error {
+	h.record(`watermark %s %s`, split.ID, w.Resolved)
+	return nil
+}
+
+func (h *recordingHandler) Checkpoint(_ context.Context, split Split) error {
+	h.record(`checkpoint %s`, split.ID)
+	if h.failCheckpoint {
+		return errors.New(`disk full`)
+	}
+	return nil
+}
+
+func (h *recordingHandler) ReleaseSplit(split Split, err error) {
+	h.released <- err
+}
+
+func TestSource(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	for _, failCheckpoint := range []bool{false, true} {
+		t.Run(fmt.Sprintf("failCheckpoint=%t", failCheckpoint), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+			require.NoError(t, err)
+			h := &recordingHandler{failCheckpoint: failCheckpoint, released: make(chan error, 1)}
+			served := make(chan error, 1)
+			go func() { served <- NewSource(ln, h).Serve(ctx) }()
+
+			conn, err := net.Dial(`tcp`, ln.Addr().String())
+			require.NoError(t, err)
+			w := bufio.NewWriter(conn)
+			for _, m := range []Message{
+				Hello{Version: ProtocolVersion, Split: Split{ID: `s1`, Topics: []string{`foo`}}},
+				Schema{Topic: `foo`, Version: 1},
+				Row{Topic: `foo`, Value: []byte(`{"a":1}`)},
+				UnknownMessage{Type: 42},
+				Watermark{Resolved: Timestamp{WallTime: 5}},
+				Flush{Seq: 1},
+			} {
+				require.NoError(t, WriteMessage(w, m))
+			}
+			require.NoError(t, w.Flush())
+
+			ack, err := ReadMessage(conn)
+			require.NoError(t, err)
+			if failCheckpoint {
+				require.Equal(t, Ack{Seq: 1, Error: `disk full`}, ack)
+			} else {
+				require.Equal(t, Ack{Seq: 1}, ack)
+			}
+			require.NoError(t, conn.Close())
+			require.NoError(t, <-h.released)
+
+			require.Equal(t, []string{
+				`assign s1 [foo]`,
+				`schema s1 foo@1`,
+				`row s1 foo {"a":1}`,
+				`watermark s1 5.0000000000`,
+				`checkpoint s1`,
+			}, h.calls)
+
+			cancel()
+			require.ErrorIs(t, <-served, context.Canceled)
+		})
+	}
+}
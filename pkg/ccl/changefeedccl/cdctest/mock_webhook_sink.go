@@ -9,13 +9,18 @@
 package cdctest
 
 import (
+	"compress/gzip"
 	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
 )
 
 // MockWebhookSink is the Webhook sink used in tests.
@@ -29,7 +34,17 @@ type MockWebhookSink struct {
 		statusCodes      []int
 		statusCodesIndex int
 		rows             []string
+		latestHeader     http.Header
+		latestChunked    bool
 		notify           chan struct{}
+		acceptEncodings  []string
+		responseBody     string
+		checkpoints      struct {
+			enabled     bool
+			nextToken   int
+			unconfirmed int
+			confirmed   []string
+		}
 	}
 }
 
@@ -116,6 +131,43 @@ func (s *MockWebhookSink) SetStatusCodes(statusCodes []int) {
 	s.mu.statusCodes = statusCodes
 }
 
+// EnableCheckpoints makes the sink respond to each batch with a checkpoint
+// token, and to the given number of requests to confirm checkpoint tokens
+// with 202 Accepted before confirming them.
+func (s *MockWebhookSink) EnableCheckpoints(unconfirmed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mu.checkpoints.enabled = true
+	s.mu.checkpoints.unconfirmed = unconfirmed
+}
+
+// SetResponseBody sets the body with which the sink responds to the batches
+// it accepts, unless it responds with checkpoint tokens.
+func (s *MockWebhookSink) SetResponseBody(body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mu.responseBody = body
+}
+
+// AcceptEncodings makes the sink advertise, with an Accept-Encoding header in
+// its responses, that it accepts request bodies with the given content
+// codings, and respond to requests with any other coding with 415
+// Unsupported Media Type. Bodies compressed with gzip or zstd are always
+// decompressed.
+func (s *MockWebhookSink) AcceptEncodings(encodings ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mu.acceptEncodings = append([]string{}, encodings...)
+}
+
+// ConfirmedCheckpointTokens returns the checkpoint tokens the sink has
+// confirmed, in the order it confirmed them.
+func (s *MockWebhookSink) ConfirmedCheckpointTokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.mu.checkpoints.confirmed...)
+}
+
 // Close closes the mock Webhook sink.
 func (s *MockWebhookSink) Close() {
 	s.server.Close()
@@ -133,6 +185,22 @@ func (s *MockWebhookSink) Latest() string {
 	return latest
 }
 
+// LatestHeader returns the headers of the most recent message received by the
+// MockWebhookSink.
+func (s *MockWebhookSink) LatestHeader() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mu.latestHeader
+}
+
+// LatestChunked returns whether the most recent message received by the
+// MockWebhookSink was sent with chunked transfer encoding.
+func (s *MockWebhookSink) LatestChunked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mu.latestChunked
+}
+
 // Pop deletes and returns the oldest message from MockWebhookSink
 func (s *MockWebhookSink) Pop() string {
 	s.mu.Lock()
@@ -171,7 +239,11 @@ func (s *MockWebhookSink) requestHandler(hw http.ResponseWriter, hr *http.Reques
 				return
 			}
 		}
-		err = s.publish(hw, hr)
+		if hr.Header.Get(`X-Changefeed-Checkpoint`) != `` {
+			err = s.confirmCheckpoint(hw, hr)
+		} else {
+			err = s.publish(hw, hr)
+		}
 	default:
 		hw.WriteHeader(http.StatusNotFound)
 		return
@@ -183,22 +255,95 @@ func (s *MockWebhookSink) requestHandler(hw http.ResponseWriter, hr *http.Reques
 
 func (s *MockWebhookSink) publish(hw http.ResponseWriter, hr *http.Request) error {
 	defer hr.Body.Close()
-	row, err := io.ReadAll(hr.Body)
+	encoding := hr.Header.Get(`Content-Encoding`)
+	row, err := readBody(hr.Body, encoding)
 	if err != nil {
 		return err
 	}
 	s.mu.Lock()
 	s.mu.numCalls++
+	if s.mu.acceptEncodings != nil {
+		hw.Header().Set(`Accept-Encoding`, strings.Join(s.mu.acceptEncodings, `, `))
+		if encoding != `` && !contains(s.mu.acceptEncodings, encoding) {
+			s.mu.Unlock()
+			hw.WriteHeader(http.StatusUnsupportedMediaType)
+			return nil
+		}
+	}
 	if s.mu.statusCodes[s.mu.statusCodesIndex] >= http.StatusOK && s.mu.statusCodes[s.mu.statusCodesIndex] < http.StatusMultipleChoices {
 		s.mu.rows = append(s.mu.rows, string(row))
+		s.mu.latestHeader = hr.Header.Clone()
+		s.mu.latestChunked = contains(hr.TransferEncoding, `chunked`)
 		if s.mu.notify != nil {
 			close(s.mu.notify)
 			s.mu.notify = nil
 		}
 	}
 
-	hw.WriteHeader(s.mu.statusCodes[s.mu.statusCodesIndex])
+	statusCode := s.mu.statusCodes[s.mu.statusCodesIndex]
+	hw.WriteHeader(statusCode)
 	s.mu.statusCodesIndex = (s.mu.statusCodesIndex + 1) % len(s.mu.statusCodes)
+	if statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices {
+		if s.mu.checkpoints.enabled {
+			s.mu.checkpoints.nextToken++
+			_, err = fmt.Fprintf(hw, `{"checkpoint_token": "%d"}`, s.mu.checkpoints.nextToken)
+		} else if s.mu.responseBody != `` {
+			_, err = io.WriteString(hw, s.mu.responseBody)
+		}
+	}
 	s.mu.Unlock()
+	return err
+}
+
+// readBody reads a request body with the given content coding.
+func readBody(body io.Reader, encoding string) ([]byte, error) {
+	switch encoding {
+	case ``:
+		return io.ReadAll(body)
+	case `gzip`:
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case `zstd`:
+		r, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return nil, errors.Errorf(`unsupported content encoding %q`, encoding)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MockWebhookSink) confirmCheckpoint(hw http.ResponseWriter, hr *http.Request) error {
+	defer hr.Body.Close()
+	var req struct {
+		Tokens []string `json:"checkpoint_tokens"`
+	}
+	if err := json.NewDecoder(hr.Body).Decode(&req); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mu.checkpoints.unconfirmed > 0 {
+		s.mu.checkpoints.unconfirmed--
+		hw.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+	s.mu.checkpoints.confirmed = append(s.mu.checkpoints.confirmed, req.Tokens...)
+	hw.WriteHeader(http.StatusOK)
 	return nil
 }
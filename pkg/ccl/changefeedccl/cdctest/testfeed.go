@@ -29,6 +29,17 @@ type TestFeedFactory interface {
 	AsUser(user string, fn func(runner *sqlutils.SQLRunner)) error
 }
 
+// ExternalSinkFeedFactory is a TestFeedFactory whose feeds emit to a real
+// sink running outside of the test server, such as a Kafka broker or the
+// Pub/Sub emulator, and read messages back using the real client libraries
+// rather than in-memory fakes.
+type ExternalSinkFeedFactory interface {
+	TestFeedFactory
+
+	// SinkURI returns the URI of the external sink.
+	SinkURI() string
+}
+
 // TestFeedMessage represents one row update or resolved timestamp message from
 // a changefeed.
 type TestFeedMessage struct {
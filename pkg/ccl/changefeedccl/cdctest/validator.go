@@ -703,6 +703,72 @@ func (v *CountValidator) Failures() []string {
 	return v.v.Failures()
 }
 
+// DuplicateValidator checks that rows are only emitted more than once within
+// the window of duplicates allowed by our delivery guarantees, and keeps
+// count of the duplicates it has seen.
+//
+// A changefeed only emits a resolved timestamp once it has checkpointed its
+// progress up to it, and restarts from its last checkpoint, so the rows it
+// emits again after a restart are all updated above the resolved timestamps
+// it has emitted. Once a resolved timestamp has been emitted on a partition,
+// no previously seen row with a lower or equal update timestamp is emitted
+// on that partition again.
+type DuplicateValidator struct {
+	topic    string
+	seen     map[string]map[hlc.Timestamp]struct{}
+	resolved map[string]hlc.Timestamp
+
+	// NumDuplicates is the number of rows seen more than once.
+	NumDuplicates int
+
+	failures []string
+}
+
+var _ Validator = &DuplicateValidator{}
+
+// NewDuplicateValidator returns a DuplicateValidator for the given topic.
+func NewDuplicateValidator(topic string) *DuplicateValidator {
+	return &DuplicateValidator{
+		topic:    topic,
+		seen:     make(map[string]map[hlc.Timestamp]struct{}),
+		resolved: make(map[string]hlc.Timestamp),
+	}
+}
+
+// NoteRow implements the Validator interface.
+func (v *DuplicateValidator) NoteRow(
+	partition string, key, value string, updated hlc.Timestamp,
+) error {
+	if v.seen[key] == nil {
+		v.seen[key] = make(map[hlc.Timestamp]struct{})
+	}
+	if _, ok := v.seen[key][updated]; !ok {
+		v.seen[key][updated] = struct{}{}
+		return nil
+	}
+	v.NumDuplicates++
+	if resolved := v.resolved[partition]; updated.LessEq(resolved) {
+		v.failures = append(v.failures, fmt.Sprintf(
+			`topic %s partition %s: saw duplicate of row %s at %s after %s was resolved`,
+			v.topic, partition, key, updated.AsOfSystemTime(), resolved.AsOfSystemTime(),
+		))
+	}
+	return nil
+}
+
+// NoteResolved implements the Validator interface.
+func (v *DuplicateValidator) NoteResolved(partition string, resolved hlc.Timestamp) error {
+	if v.resolved[partition].Less(resolved) {
+		v.resolved[partition] = resolved
+	}
+	return nil
+}
+
+// Failures implements the Validator interface.
+func (v *DuplicateValidator) Failures() []string {
+	return v.failures
+}
+
 // ParseJSONValueTimestamps returns the updated or resolved timestamp set in the
 // provided `format=json` value. Exported for acceptance testing.
 func ParseJSONValueTimestamps(v []byte) (updated, resolved hlc.Timestamp, err error) {
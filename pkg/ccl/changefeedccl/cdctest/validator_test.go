@@ -434,6 +434,48 @@ func TestFingerprintValidator(t *testing.T) {
 	})
 }
 
+func TestDuplicateValidator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	const ignored = `ignored`
+
+	t.Run(`no duplicates`, func(t *testing.T) {
+		v := NewDuplicateValidator(`t1`)
+		noteRow(t, v, `p1`, `k1`, ignored, ts(1))
+		noteRow(t, v, `p1`, `k1`, ignored, ts(2))
+		noteRow(t, v, `p1`, `k2`, ignored, ts(1))
+		noteResolved(t, v, `p1`, ts(2))
+		assertValidatorFailures(t, v)
+		require.Equal(t, 0, v.NumDuplicates)
+	})
+	t.Run(`duplicates above resolved`, func(t *testing.T) {
+		v := NewDuplicateValidator(`t1`)
+		noteRow(t, v, `p1`, `k1`, ignored, ts(1))
+		noteResolved(t, v, `p1`, ts(1))
+		noteRow(t, v, `p1`, `k1`, ignored, ts(2))
+		noteRow(t, v, `p1`, `k1`, ignored, ts(2))
+		// Resolved timestamps on other partitions don't bound duplicates.
+		noteResolved(t, v, `p2`, ts(3))
+		noteRow(t, v, `p1`, `k1`, ignored, ts(2))
+		assertValidatorFailures(t, v)
+		require.Equal(t, 2, v.NumDuplicates)
+	})
+	t.Run(`duplicates at or below resolved`, func(t *testing.T) {
+		v := NewDuplicateValidator(`t1`)
+		noteRow(t, v, `p1`, `k1`, ignored, ts(1))
+		noteRow(t, v, `p1`, `k1`, ignored, ts(2))
+		noteResolved(t, v, `p1`, ts(2))
+		noteRow(t, v, `p1`, `k1`, ignored, ts(1))
+		noteRow(t, v, `p1`, `k1`, ignored, ts(2))
+		assertValidatorFailures(t, v,
+			`topic t1 partition p1`+
+				`: saw duplicate of row k1 at 1.0000000000 after 2.0000000000 was resolved`,
+			`topic t1 partition p1`+
+				`: saw duplicate of row k1 at 2.0000000000 after 2.0000000000 was resolved`,
+		)
+		require.Equal(t, 2, v.NumDuplicates)
+	})
+}
+
 func TestValidators(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	const ignored = `ignored`
@@ -12,6 +12,7 @@ import (
 	"context"
 	"encoding/json"
 
+	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/cloud"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
@@ -71,6 +72,8 @@ func AllTargets(cd jobspb.ChangefeedDetails) (targets changefeedbase.Targets) {
 					TableID:           ts.TableID,
 					FamilyName:        ts.FamilyName,
 					StatementTimeName: changefeedbase.StatementTimeName(ts.StatementTimeName),
+					IndexID:           ts.IndexID,
+					TopicName:         ts.TopicName,
 				})
 			}
 		}
@@ -165,11 +168,54 @@ func init() {
 	jobspb.ChangefeedDetailsMarshaler = func(m *jobspb.ChangefeedDetails, marshaller *jsonpb.Marshaler) ([]byte, error) {
 		if protoreflect.ShouldRedact(marshaller) {
 			var err error
-			m.SinkURI, err = cloud.SanitizeExternalStorageURI(m.SinkURI, nil)
+			m.SinkURI, err = sanitizeSinkURI(m.SinkURI)
 			if err != nil {
 				return nil, err
 			}
+			// Copy the additional sinks rather than sanitize them in place, since
+			// the slice is shared with the caller's details.
+			additionalSinkURIs := make([]string, len(m.AdditionalSinkURIs))
+			for i, u := range m.AdditionalSinkURIs {
+				if additionalSinkURIs[i], err = sanitizeSinkURI(u); err != nil {
+					return nil, err
+				}
+			}
+			m.AdditionalSinkURIs = additionalSinkURIs
 		}
 		return json.Marshal(m)
 	}
 }
+
+// sanitizeSinkURI redacts the credentials in the parameters of a sink URI,
+// including those of the URL of its proxy.
+func sanitizeSinkURI(sinkURI string) (string, error) {
+	sanitized, err := cloud.SanitizeExternalStorageURI(sinkURI, changefeedbase.RedactedSinkParams)
+	if err != nil {
+		return "", err
+	}
+	return changefeedbase.RedactProxyUserFromURI(sanitized)
+}
+
+// feedGeneration returns the generation of a changefeed, which is 1 for
+// changefeeds created before generations were recorded.
+func feedGeneration(generation int64) int64 {
+	if generation == 0 {
+		return 1
+	}
+	return generation
+}
+
+// withSourceGeneration returns the encoding options of a changefeed's flow
+// with the ID of the cluster running it and the generation of the
+// changefeed, which are emitted under the source_generation option.
+func withSourceGeneration(
+	opts changefeedbase.EncodingOptions,
+	clusterID *base.ClusterIDContainer,
+	details jobspb.ChangefeedDetails,
+) changefeedbase.EncodingOptions {
+	if opts.SourceGeneration {
+		opts.SourceClusterID = clusterID.Get().String()
+		opts.Generation = feedGeneration(details.Generation)
+	}
+	return opts
+}
@@ -0,0 +1,287 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+// admissionPollInterval is how often changefeeds waiting for admission check
+// whether they may run, so that they notice changes to the limits, as well as
+// changefeeds which stopped running on other nodes.
+const admissionPollInterval = 5 * time.Second
+
+// maxFlowAdmissionWait bounds the time the aggregator of a changefeed waits
+// for admission to its node, after which the flow of the changefeed is
+// restarted. The aggregators of a changefeed which run on other nodes hold
+// their admission meanwhile, so two changefeeds could otherwise each wait
+// forever on a node where the other one was admitted.
+const maxFlowAdmissionWait = time.Minute
+
+// The running status of changefeeds waiting for cluster admission starts with
+// this prefix, so that the pending state shows in SHOW CHANGEFEED JOBS.
+const pendingClusterAdmission = "pending cluster admission"
+
+// flowAdmission is a node-wide FIFO queue which admits the aggregators of
+// changefeeds to run while fewer than changefeed.max_running_per_node
+// aggregators run on the node. It keeps a node which is assigned the flows of
+// many changefeeds at once, for instance when the cluster restarts, from
+// running all of them at the same time.
+type flowAdmission struct {
+	admitted, pending *metric.Gauge
+
+	mu struct {
+		syncutil.Mutex
+		// running is the number of admitted changefeeds.
+		running int64
+		// queue holds the changefeeds waiting for admission, in order of
+		// arrival.
+		queue []*admissionTicket
+		// changed is closed, and replaced, whenever the queue changes or an
+		// admitted changefeed stops, to wake up the waiting changefeeds.
+		changed chan struct{}
+	}
+}
+
+// admissionTicket identifies a changefeed in the queue of flowAdmission.
+type admissionTicket struct {
+	_ int // ensures distinct tickets have distinct addresses
+}
+
+func newFlowAdmission(admitted, pending *metric.Gauge) *flowAdmission {
+	a := &flowAdmission{admitted: admitted, pending: pending}
+	a.mu.changed = make(chan struct{})
+	return a
+}
+
+// admit blocks until the aggregator of a changefeed is admitted to run on
+// this node. The returned function must be called once the aggregator stops
+// running. If the aggregator isn't admitted within maxWait, admit returns a
+// retryable error, which restarts the flow of the changefeed.
+func (a *flowAdmission) admit(
+	ctx context.Context, sv *settings.Values, maxWait time.Duration,
+) (release func(), _ error) {
+	t := &admissionTicket{}
+	timer := timeutil.NewTimer()
+	defer timer.Stop()
+	start := timeutil.Now()
+
+	a.mu.Lock()
+	a.mu.queue = append(a.mu.queue, t)
+	a.pending.Inc(1)
+	for waited := false; ; waited = true {
+		limit := changefeedbase.MaxRunningPerNode.Get(sv)
+		if a.mu.queue[0] == t && (limit == 0 || a.mu.running < limit) {
+			a.removeLocked(t)
+			a.mu.running++
+			a.admitted.Inc(1)
+			a.mu.Unlock()
+			return a.release, nil
+		}
+		changed, running := a.mu.changed, a.mu.running
+		if waited && timeutil.Since(start) >= maxWait {
+			a.removeLocked(t)
+			a.mu.Unlock()
+			return nil, changefeedbase.MarkRetryableError(errors.Newf(
+				"changefeed not admitted within %s: %d changefeeds running on this node (%s=%d)",
+				maxWait, running, changefeedbase.MaxRunningPerNode.Key(), limit))
+		}
+		a.mu.Unlock()
+
+		if !waited {
+			log.Infof(ctx, "waiting for admission: %d changefeeds running on this node (%s=%d)",
+				running, changefeedbase.MaxRunningPerNode.Key(), limit)
+		}
+		timer.Reset(admissionPollInterval)
+		select {
+		case <-ctx.Done():
+			a.mu.Lock()
+			a.removeLocked(t)
+			a.mu.Unlock()
+			return nil, ctx.Err()
+		case <-changed:
+		case <-timer.C:
+			timer.Read = true
+		}
+		a.mu.Lock()
+	}
+}
+
+// release records that an admitted changefeed stopped running.
+func (a *flowAdmission) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.mu.running--
+	a.admitted.Dec(1)
+	a.notifyLocked()
+}
+
+// removeLocked removes the ticket from the queue.
+func (a *flowAdmission) removeLocked(t *admissionTicket) {
+	for i := range a.mu.queue {
+		if a.mu.queue[i] == t {
+			a.mu.queue = append(a.mu.queue[:i], a.mu.queue[i+1:]...)
+			a.pending.Dec(1)
+			a.notifyLocked()
+			return
+		}
+	}
+}
+
+func (a *flowAdmission) notifyLocked() {
+	close(a.mu.changed)
+	a.mu.changed = make(chan struct{})
+}
+
+const runningChangefeedStatusQuery = `
+SELECT id, progress
+FROM crdb_internal.system_jobs
+WHERE job_type = $1 AND status = $2`
+
+// clusterAdmission counts the changefeeds running in the cluster for the
+// changefeeds of this node which wait for admission under
+// changefeed.max_running_per_cluster. The running changefeeds are listed at
+// most once every admissionPollInterval for all of them, rather than by each
+// of them.
+type clusterAdmission struct {
+	mu struct {
+		syncutil.Mutex
+		// running are the running changefeeds, with whether each of them
+		// waits for cluster admission, as of refreshed.
+		running   map[jobspb.JobID]bool
+		refreshed time.Time
+	}
+}
+
+// countAdmitted returns the number of running changefeeds, other than the
+// given one, which count against changefeed.max_running_per_cluster: those
+// which aren't waiting for admission, and those which wait for it with a
+// smaller job ID. The latter admits waiting changefeeds in order of their IDs
+// rather than all at once.
+func (c *clusterAdmission) countAdmitted(
+	ctx context.Context, execCfg *sql.ExecutorConfig, jobID jobspb.JobID,
+) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mu.running == nil || timeutil.Since(c.mu.refreshed) >= admissionPollInterval {
+		running, err := listRunningChangefeeds(ctx, execCfg)
+		if err != nil {
+			return 0, err
+		}
+		c.mu.running, c.mu.refreshed = running, timeutil.Now()
+	}
+	var admitted int64
+	for id, pending := range c.mu.running {
+		if id != jobID && (!pending || id < jobID) {
+			admitted++
+		}
+	}
+	return admitted, nil
+}
+
+// listRunningChangefeeds returns the running changefeeds of the cluster, with
+// whether each of them waits for cluster admission.
+func listRunningChangefeeds(
+	ctx context.Context, execCfg *sql.ExecutorConfig,
+) (_ map[jobspb.JobID]bool, retErr error) {
+	it, err := execCfg.InternalDB.Executor().QueryIteratorEx(ctx, "changefeed-admission",
+		nil /* txn */, sessiondata.NodeUserSessionDataOverride, runningChangefeedStatusQuery,
+		jobspb.TypeChangefeed.String(), string(jobs.StatusRunning))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := it.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	running := make(map[jobspb.JobID]bool)
+	var ok bool
+	for ok, err = it.Next(ctx); ok; ok, err = it.Next(ctx) {
+		id := jobspb.JobID(tree.MustBeDInt(it.Cur()[0]))
+		var runningStatus string
+		if it.Cur()[1] != tree.DNull {
+			progress, err := jobs.UnmarshalProgress(it.Cur()[1])
+			if err != nil {
+				return nil, err
+			}
+			runningStatus = progress.RunningStatus
+		}
+		running[id] = strings.HasPrefix(runningStatus, pendingClusterAdmission)
+	}
+	return running, err
+}
+
+// waitForAdmission blocks until the changefeed may run under the
+// changefeed.max_running_per_cluster limit, recording in its running status
+// that it is pending until then. The changefeed.max_running_per_node limit is
+// enforced by its aggregators, on the nodes they run on.
+func (b *changefeedResumer) waitForAdmission(
+	ctx context.Context, execCfg *sql.ExecutorConfig,
+) error {
+	// The changefeed may have been pending when it last stopped, in which
+	// case its running status has to be reset as well once it's admitted.
+	pending := strings.HasPrefix(b.job.Progress().RunningStatus, pendingClusterAdmission)
+	metrics, ok := execCfg.JobRegistry.MetricsStruct().Changefeed.(*Metrics)
+	if !ok {
+		return nil
+	}
+
+	var waited bool
+	timer := timeutil.NewTimer()
+	defer timer.Stop()
+	for {
+		limit := changefeedbase.MaxRunningPerCluster.Get(&execCfg.Settings.SV)
+		if limit == 0 {
+			break
+		}
+		admitted, err := metrics.clusterAdmission.countAdmitted(ctx, execCfg, b.job.ID())
+		if err != nil {
+			return err
+		}
+		if admitted < limit {
+			break
+		}
+		if !waited {
+			pending, waited = true, true
+			b.setJobRunningStatus(ctx, time.Time{}, "%s: %d changefeeds running in the cluster (%s=%d)",
+				pendingClusterAdmission, admitted, changefeedbase.MaxRunningPerCluster.Key(), limit)
+		}
+		// Jitter the polls of changefeeds which started waiting together.
+		timer.Reset(time.Duration(float64(admissionPollInterval) * (0.5 + rand.Float64())))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			timer.Read = true
+		}
+	}
+
+	if pending {
+		b.setJobRunningStatus(ctx, time.Time{}, "running")
+	}
+	return nil
+}
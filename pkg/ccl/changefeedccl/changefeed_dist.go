@@ -13,6 +13,7 @@ import (
 	"sort"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdceval"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvfeed"
@@ -23,9 +24,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/sql"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descs"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfrapb"
-	"github.com/cockroachdb/cockroach/pkg/sql/isql"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/physicalplan"
@@ -37,6 +38,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/ctxgroup"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/errors"
 )
 
@@ -78,6 +80,11 @@ func distChangefeedFlow(
 ) error {
 
 	opts := changefeedbase.MakeStatementOptions(details.Opts)
+	details = withoutIsolatedSinks(details, progress)
+
+	if err := verifySourceTenant(ctx, execCtx.ExecCfg(), details.TenantID); err != nil {
+		return err
+	}
 
 	// NB: A non-empty high water indicates that we have checkpointed a resolved
 	// timestamp. Skipping the initial scan is equivalent to starting the
@@ -126,31 +133,36 @@ func distChangefeedFlow(
 	if cf := progress.GetChangefeed(); cf != nil && cf.Checkpoint != nil {
 		checkpoint = *cf.Checkpoint
 	}
+	var emittedSpans []jobspb.ChangefeedProgress_EmittedSpan
+	if cf := progress.GetChangefeed(); cf != nil {
+		emittedSpans = cf.EmittedSpans
+	}
 
 	return startDistChangefeed(
-		ctx, execCtx, jobID, schemaTS, details, initialHighWater, checkpoint, resultsCh)
+		ctx, execCtx, jobID, schemaTS, details, initialHighWater, checkpoint, emittedSpans, resultsCh)
 }
 
 func fetchTableDescriptors(
 	ctx context.Context,
 	execCfg *sql.ExecutorConfig,
+	tenantID roachpb.TenantID,
 	targets changefeedbase.Targets,
 	ts hlc.Timestamp,
 ) ([]catalog.TableDescriptor, error) {
 	var targetDescs []catalog.TableDescriptor
 
 	fetchSpans := func(
-		ctx context.Context, txn isql.Txn, descriptors *descs.Collection,
+		ctx context.Context, txn *kv.Txn, descriptors *descs.Collection,
 	) error {
 		targetDescs = make([]catalog.TableDescriptor, 0, targets.NumUniqueTables())
-		if err := txn.KV().SetFixedTimestamp(ctx, ts); err != nil {
+		if err := txn.SetFixedTimestamp(ctx, ts); err != nil {
 			return err
 		}
 		// Note that all targets are currently guaranteed to have a Table ID
 		// and lie within the primary index span. Deduplication is important
 		// here as requesting the same span twice will deadlock.
 		return targets.EachTableID(func(id catid.DescID) error {
-			tableDesc, err := descriptors.ByID(txn.KV()).WithoutNonPublic().Get().Table(ctx, id)
+			tableDesc, err := descriptors.ByID(txn).WithoutNonPublic().Get().Table(ctx, id)
 			if err != nil {
 				return err
 			}
@@ -158,7 +170,7 @@ func fetchTableDescriptors(
 			return nil
 		})
 	}
-	if err := sql.DescsTxn(ctx, execCfg, fetchSpans); err != nil {
+	if err := sourceDescsTxn(ctx, execCfg, tenantID, fetchSpans); err != nil {
 		return nil, err
 	}
 	return targetDescs, nil
@@ -173,7 +185,8 @@ var changefeedResultTypes = []*types.T{
 }
 
 // fetchSpansForTable returns the set of spans for the specified table.
-// Usually, this is just the primary index span.
+// Usually, this is just the primary index span, or the span of the secondary
+// index watched by an index target.
 // However, if details.Select is not empty, the set of spans returned may be
 // restricted to satisfy predicate in the select clause.
 func fetchSpansForTables(
@@ -185,8 +198,19 @@ func fetchSpansForTables(
 ) (roachpb.Spans, error) {
 	var trackedSpans []roachpb.Span
 	if details.Select == "" {
+		indexes := make(map[descpb.ID]descpb.IndexID)
+		for _, ts := range details.TargetSpecifications {
+			if ts.Type == jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX {
+				indexes[ts.TableID] = ts.IndexID
+			}
+		}
+		codec := sourceCodec(execCtx.ExecCfg().Codec, details.TenantID)
 		for _, d := range tableDescs {
-			trackedSpans = append(trackedSpans, d.PrimaryIndexSpan(execCtx.ExecCfg().Codec))
+			if indexID, ok := indexes[d.GetID()]; ok {
+				trackedSpans = append(trackedSpans, d.IndexSpan(codec, indexID))
+				continue
+			}
+			trackedSpans = append(trackedSpans, d.PrimaryIndexSpan(codec))
 		}
 		return trackedSpans, nil
 	}
@@ -228,6 +252,77 @@ var replanChangefeedFrequency = settings.RegisterDurationSetting(
 	settings.PositiveDuration,
 )
 
+var replanChangefeedRangeShiftThreshold = settings.RegisterFloatSetting(
+	settings.TenantWritable,
+	"changefeed.replan_flow_range_shift_threshold",
+	"fraction of watched spans which would now be planned on a different node than the one watching them "+
+		"above which a redistribution would occur (0=disabled)",
+	0,
+	settings.NonNegativeFloat,
+)
+
+// replanOnRangeShift returns a PlanChangeDecision that returns true when the
+// fraction of the watched spans of a new plan which are not watched by an
+// aggregator on the same node in the old plan exceeds the threshold. Leases
+// and replicas move after a changefeed is planned, for example due to
+// rebalancing, so the aggregators of a long-running changefeed would
+// otherwise increasingly watch ranges remotely. Splits alone do not count as
+// moves as long as the resulting spans stay on the same node.
+func replanOnRangeShift(thresholdFn func() float64) sql.PlanChangeDecision {
+	return func(ctx context.Context, oldPlan, newPlan *sql.PhysicalPlan) bool {
+		threshold := thresholdFn()
+		if threshold == 0 {
+			return false
+		}
+		moved, total := countMovedWatches(oldPlan, newPlan)
+		if total == 0 {
+			return false
+		}
+		shift := float64(moved) / float64(total)
+		replan := shift > threshold
+		if replan || log.V(1) {
+			log.Infof(ctx, "%d of %d watched spans would be planned on a different node / %.2f, threshold %.2f, replan %v",
+				moved, total, shift, threshold, replan)
+		}
+		return replan
+	}
+}
+
+// countMovedWatches returns the number of spans watched by the aggregators of
+// newPlan which are not watched by an aggregator on the same node in oldPlan,
+// along with the total number of spans watched in newPlan.
+func countMovedWatches(oldPlan, newPlan *sql.PhysicalPlan) (moved int, total int) {
+	oldWatches := make(map[base.SQLInstanceID]*roachpb.SpanGroup)
+	for _, proc := range oldPlan.Processors {
+		agg := proc.Spec.Core.ChangeAggregator
+		if agg == nil {
+			continue
+		}
+		g, ok := oldWatches[proc.SQLInstanceID]
+		if !ok {
+			g = &roachpb.SpanGroup{}
+			oldWatches[proc.SQLInstanceID] = g
+		}
+		for _, w := range agg.Watches {
+			g.Add(w.Span)
+		}
+	}
+	for _, proc := range newPlan.Processors {
+		agg := proc.Spec.Core.ChangeAggregator
+		if agg == nil {
+			continue
+		}
+		g := oldWatches[proc.SQLInstanceID]
+		for _, w := range agg.Watches {
+			total++
+			if g == nil || !g.Encloses(w.Span) {
+				moved++
+			}
+		}
+	}
+	return moved, total
+}
+
 // startDistChangefeed starts distributed changefeed execution.
 func startDistChangefeed(
 	ctx context.Context,
@@ -237,10 +332,11 @@ func startDistChangefeed(
 	details jobspb.ChangefeedDetails,
 	initialHighWater hlc.Timestamp,
 	checkpoint jobspb.ChangefeedProgress_Checkpoint,
+	emittedSpans []jobspb.ChangefeedProgress_EmittedSpan,
 	resultsCh chan<- tree.Datums,
 ) error {
 	execCfg := execCtx.ExecCfg()
-	tableDescs, err := fetchTableDescriptors(ctx, execCfg, AllTargets(details), schemaTS)
+	tableDescs, err := fetchTableDescriptors(ctx, execCfg, details.TenantID, AllTargets(details), schemaTS)
 	if err != nil {
 		return err
 	}
@@ -260,23 +356,31 @@ func startDistChangefeed(
 	dsp := execCtx.DistSQLPlanner()
 	evalCtx := execCtx.ExtendedEvalContext()
 
-	p, planCtx, err := makePlan(execCtx, jobID, details, initialHighWater, checkpoint, trackedSpans)(ctx, dsp)
+	p, planCtx, err := makePlan(execCtx, jobID, details, initialHighWater, checkpoint, emittedSpans, trackedSpans)(ctx, dsp)
 	if err != nil {
 		return err
 	}
 
-	replanOracle := sql.ReplanOnChangedFraction(
+	replanOnChangedFraction := sql.ReplanOnChangedFraction(
 		func() float64 {
 			return replanChangefeedThreshold.Get(execCtx.ExecCfg().SV())
 		},
 	)
+	replanOnShift := replanOnRangeShift(
+		func() float64 {
+			return replanChangefeedRangeShiftThreshold.Get(execCtx.ExecCfg().SV())
+		},
+	)
+	var replanOracle sql.PlanChangeDecision = func(ctx context.Context, oldPlan, newPlan *sql.PhysicalPlan) bool {
+		return replanOnChangedFraction(ctx, oldPlan, newPlan) || replanOnShift(ctx, oldPlan, newPlan)
+	}
 	if knobs, ok := cfKnobs.(*TestingKnobs); ok && knobs != nil && knobs.ShouldReplan != nil {
 		replanOracle = knobs.ShouldReplan
 	}
 
 	replanner, stopReplanner := sql.PhysicalPlanChangeChecker(ctx,
 		p,
-		makePlan(execCtx, jobID, details, initialHighWater, checkpoint, trackedSpans),
+		makePlan(execCtx, jobID, details, initialHighWater, checkpoint, emittedSpans, trackedSpans),
 		execCtx,
 		replanOracle,
 		func() time.Duration { return replanChangefeedFrequency.Get(execCtx.ExecCfg().SV()) },
@@ -341,6 +445,7 @@ func makePlan(
 	details jobspb.ChangefeedDetails,
 	initialHighWater hlc.Timestamp,
 	checkpoint jobspb.ChangefeedProgress_Checkpoint,
+	emittedSpans []jobspb.ChangefeedProgress_EmittedSpan,
 	trackedSpans []roachpb.Span,
 ) func(context.Context, *sql.DistSQLPlanner) (*sql.PhysicalPlan, *sql.PlanningCtx, error) {
 	return func(ctx context.Context, dsp *sql.DistSQLPlanner) (*sql.PhysicalPlan, *sql.PlanningCtx, error) {
@@ -360,6 +465,8 @@ func makePlan(
 		}
 
 		sv := &execCtx.ExecCfg().Settings.SV
+		sender := execCtx.ExecCfg().DB.NonTransactionalSender()
+		distSender := sender.(*kv.CrossRangeTxnWrapperSender).Wrapped().(*kvcoord.DistSender)
 		if enableBalancedRangeDistribution.Get(sv) {
 			scanType, err := changefeedbase.MakeStatementOptions(details.Opts).GetInitialScanType()
 			if err != nil {
@@ -369,9 +476,6 @@ func makePlan(
 			// Currently, balanced range distribution supported only in export mode.
 			// TODO(yevgeniy): Consider lifting this restriction.
 			if scanType == changefeedbase.OnlyInitialScan {
-				sender := execCtx.ExecCfg().DB.NonTransactionalSender()
-				distSender := sender.(*kv.CrossRangeTxnWrapperSender).Wrapped().(*kvcoord.DistSender)
-
 				spanPartitions, err = rebalanceSpanPartitions(
 					ctx, &distResolver{distSender}, rebalanceThreshold.Get(sv), spanPartitions)
 				if err != nil {
@@ -380,6 +484,14 @@ func makePlan(
 			}
 		}
 
+		// Sinkless feeds always run on this node.
+		if distMode != sql.DistributionTypeNone {
+			spanPartitions, err = assignSpans(ctx, execCtx, dsp, distSender, spanPartitions)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
 		// Use the same checkpoint for all aggregators; each aggregator will only look at
 		// spans that are assigned to it.
 		// We could compute per-aggregator checkpoint, but that's probably an overkill.
@@ -412,6 +524,9 @@ func makePlan(
 				UserProto:  execCtx.User().EncodeProto(),
 				JobID:      jobID,
 				Select:     execinfrapb.Expression{Expr: details.Select},
+				// Each aggregator is only given the spans it may emit messages
+				// for again.
+				EmittedSpans: emittedSpansOverlapping(emittedSpans, sp.Spans),
 			}
 		}
 
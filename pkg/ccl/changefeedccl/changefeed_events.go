@@ -0,0 +1,324 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	gojson "encoding/json"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdceval"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/utilccl"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/kv"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descs"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/volatility"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/errors"
+)
+
+// The crdb_internal.changefeed_events builtin streams the events of a
+// changefeed job to the SQL client, e.g.
+//
+//	SELECT * FROM crdb_internal.changefeed_events(123, '1681234567890123456.0000000000');
+//
+// which lets lightweight consumers subscribe to a changefeed without a sink
+// of their own. It backs the /api/v2/changefeeds/{job_id}/events/ endpoint,
+// which serves the events as Server-Sent Events. The targets and options of
+// the job are run as a sinkless changefeed, as the user, from the given
+// cursor, or from the high-water of the job if none is given. The resolved
+// timestamps it emits are returned as well, and serve as the cursors to
+// resume from: the events above a resolved timestamp may be returned again
+// after resuming from it, but none at or below it.
+
+// changefeedEventsOmittedOptions are the options of the job which are left
+// out of the sinkless changefeed run for its events: those which require a
+// sink or a job, and the cursor, which is replaced.
+var changefeedEventsOmittedOptions = func() map[string]struct{} {
+	omitted := make(map[string]struct{}, len(previewOmittedOptions))
+	for opt := range previewOmittedOptions {
+		omitted[opt] = struct{}{}
+	}
+	for _, opt := range []string{
+		changefeedbase.OptResolvedTimestamps,
+		changefeedbase.OptInitialScan,
+		changefeedbase.OptNoInitialScan,
+		changefeedbase.OptInitialScanOnly,
+	} {
+		delete(omitted, opt)
+	}
+	return omitted
+}()
+
+// changefeedEventsTargets returns the targets of the sinkless changefeed run
+// to stream the events of the changefeed with the given details, or its CDC
+// query. Targets are built from the IDs of the tables watched by the job, by
+// their current names, so that the events are those of the tables the job
+// watches even if they were renamed, or other tables took their names.
+func changefeedEventsTargets(
+	ctx context.Context, execCfg *sql.ExecutorConfig, details jobspb.ChangefeedDetails,
+) (*tree.CreateChangefeed, error) {
+	changefeed := &tree.CreateChangefeed{}
+	if err := sourceDescsTxn(ctx, execCfg, details.TenantID, func(
+		ctx context.Context, txn *kv.Txn, descriptors *descs.Collection,
+	) error {
+		changefeed.Targets = changefeed.Targets[:0]
+		for _, ts := range details.TargetSpecifications {
+			desc, err := descriptors.ByID(txn).WithoutNonPublic().Get().Table(ctx, ts.TableID)
+			if err != nil {
+				return err
+			}
+			name, err := getQualifiedTableNameObj(ctx, execCfg, details.TenantID, txn, desc)
+			if err != nil {
+				return err
+			}
+			target := tree.ChangefeedTarget{
+				TableName: &name,
+				Sequence:  desc.IsSequence(),
+				View:      desc.IsView(),
+			}
+			switch ts.Type {
+			case jobspb.ChangefeedTargetSpecification_COLUMN_FAMILY:
+				target.FamilyName = tree.Name(ts.FamilyName)
+			case jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX:
+				index, err := catalog.MustFindIndexByID(desc, ts.IndexID)
+				if err != nil {
+					return err
+				}
+				target.IndexName = tree.UnrestrictedName(index.GetName())
+			}
+			changefeed.Targets = append(changefeed.Targets, target)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if details.Select == `` {
+		return changefeed, nil
+	}
+
+	// The query of a changefeed reads from its single target.
+	sc, err := cdceval.ParseChangefeedExpression(details.Select)
+	if err != nil {
+		return nil, err
+	}
+	if len(changefeed.Targets) != 1 || len(sc.From.Tables) != 1 {
+		return nil, errors.AssertionFailedf(`expected a single target of changefeed query %s`, details.Select)
+	}
+	from, ok := sc.From.Tables[0].(*tree.AliasedTableExpr)
+	if !ok {
+		return nil, errors.AssertionFailedf(`unexpected source %T of changefeed query`, sc.From.Tables[0])
+	}
+	from.Expr = changefeed.Targets[0].TableName.(*tree.TableName)
+	changefeed.Targets = nil
+	changefeed.Select = sc
+	return changefeed, nil
+}
+
+// changefeedEventsStmt returns the sinkless changefeed run to stream the
+// events of a changefeed with the given targets and options from cursor. If
+// cursor is empty, the changefeed starts like the job did.
+func changefeedEventsStmt(
+	changefeed *tree.CreateChangefeed, opts map[string]string, cursor string,
+) (string, error) {
+	if format, ok := opts[changefeedbase.OptFormat]; ok && format != string(changefeedbase.OptFormatJSON) {
+		return ``, pgerror.Newf(pgcode.FeatureNotSupported,
+			`changefeed events are only available for changefeeds with %s=%s`,
+			changefeedbase.OptFormat, changefeedbase.OptFormatJSON)
+	}
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	events := *changefeed
+	events.Options = nil
+	hasResolved := false
+	for _, k := range keys {
+		if _, ok := changefeedbase.CommonOptions[k]; !ok {
+			continue
+		}
+		if _, ok := changefeedEventsOmittedOptions[k]; ok {
+			continue
+		}
+		switch k {
+		case changefeedbase.OptResolvedTimestamps:
+			hasResolved = true
+		case changefeedbase.OptInitialScan, changefeedbase.OptNoInitialScan,
+			changefeedbase.OptInitialScanOnly:
+			// Resuming from a cursor never re-scans the rows.
+			if cursor != `` {
+				continue
+			}
+		}
+		opt := tree.KVOption{Key: tree.Name(k)}
+		if v := opts[k]; v != `` {
+			opt.Value = tree.NewStrVal(v)
+		}
+		events.Options = append(events.Options, opt)
+	}
+	if !hasResolved {
+		events.Options = append(events.Options,
+			tree.KVOption{Key: tree.Name(changefeedbase.OptResolvedTimestamps)})
+	}
+	if cursor != `` {
+		events.Options = append(events.Options,
+			tree.KVOption{Key: tree.Name(changefeedbase.OptCursor), Value: tree.NewStrVal(cursor)})
+	}
+	return tree.AsString(&events), nil
+}
+
+var changefeedEventsGeneratorType = types.MakeLabeledTuple(
+	[]*types.T{types.String, types.String, types.String, types.String},
+	[]string{"topic", "key", "value", "resolved"},
+)
+
+// changefeedEventsJobQuery checks that the user can see the job, and
+// returns its high-water.
+const changefeedEventsJobQuery = `
+SELECT high_water_timestamp::STRING
+FROM [SHOW CHANGEFEED JOB $1]`
+
+// changefeedEventsGenerator implements the crdb_internal.changefeed_events
+// builtin.
+type changefeedEventsGenerator struct {
+	evalCtx *eval.Context
+	jobID   int64
+	cursor  string
+
+	it  isql.Rows
+	cur tree.Datums
+}
+
+var _ eval.ValueGenerator = &changefeedEventsGenerator{}
+
+// ResolvedType implements the eval.ValueGenerator interface.
+func (g *changefeedEventsGenerator) ResolvedType() *types.T {
+	return changefeedEventsGeneratorType
+}
+
+// Start implements the eval.ValueGenerator interface.
+func (g *changefeedEventsGenerator) Start(ctx context.Context, _ *kv.Txn) error {
+	// Like for previews, the changefeed runs outside of the transaction of
+	// the statement, as its user, who must be able to see the job, and is
+	// subject to the privilege checks of the changefeed's targets.
+	execCfg := g.evalCtx.Planner.ExecutorConfig().(*sql.ExecutorConfig)
+	override := sessiondata.InternalExecutorOverride{
+		User:     g.evalCtx.SessionData().User(),
+		Database: g.evalCtx.SessionData().Database,
+	}
+	ie := execCfg.InternalDB.Executor()
+	row, err := ie.QueryRowEx(ctx, `changefeed-events-job`, nil /* txn */, override,
+		changefeedEventsJobQuery, g.jobID)
+	if err != nil {
+		return err
+	}
+	if row == nil {
+		return pgerror.Newf(pgcode.UndefinedObject, `changefeed job %d not found`, g.jobID)
+	}
+	cursor := g.cursor
+	if cursor == `` && row[0] != tree.DNull {
+		cursor = string(tree.MustBeDString(row[0]))
+	}
+	job, err := execCfg.JobRegistry.LoadJob(ctx, jobspb.JobID(g.jobID))
+	if err != nil {
+		return err
+	}
+	details, ok := job.Details().(jobspb.ChangefeedDetails)
+	if !ok {
+		return pgerror.Newf(pgcode.UndefinedObject, `changefeed job %d not found`, g.jobID)
+	}
+	changefeed, err := changefeedEventsTargets(ctx, execCfg, details)
+	if err != nil {
+		return err
+	}
+	stmt, err := changefeedEventsStmt(changefeed, details.Opts, cursor)
+	if err != nil {
+		return err
+	}
+	it, err := ie.QueryIteratorEx(ctx, `changefeed-events`, nil /* txn */, override, stmt)
+	if err != nil {
+		return err
+	}
+	g.it = it
+	return nil
+}
+
+// Next implements the eval.ValueGenerator interface.
+func (g *changefeedEventsGenerator) Next(ctx context.Context) (bool, error) {
+	ok, err := g.it.Next(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+	row := g.it.Cur()
+	if row[0] != tree.DNull {
+		g.cur = tree.Datums{row[0], renderPreviewBytes(row[1]), renderPreviewBytes(row[2]), tree.DNull}
+		return true, nil
+	}
+	// Resolved timestamps have no topic.
+	var resolved struct {
+		Resolved string `json:"resolved"`
+	}
+	if err := gojson.Unmarshal(tree.MustBeDBytes(row[2]), &resolved); err != nil {
+		return false, errors.Wrap(err, `parsing resolved timestamp`)
+	}
+	g.cur = tree.Datums{tree.DNull, tree.DNull, tree.DNull, tree.NewDString(resolved.Resolved)}
+	return true, nil
+}
+
+// Values implements the eval.ValueGenerator interface.
+func (g *changefeedEventsGenerator) Values() (tree.Datums, error) {
+	return g.cur, nil
+}
+
+// Close implements the eval.ValueGenerator interface. It stops the
+// changefeed.
+func (g *changefeedEventsGenerator) Close(ctx context.Context) {
+	if g.it != nil {
+		_ = g.it.Close()
+	}
+}
+
+func init() {
+	utilccl.RegisterCCLBuiltin("crdb_internal.changefeed_events",
+		`Streams the events of a changefeed job.`,
+		tree.Overload{
+			Types: tree.ParamTypes{
+				{Name: "job_id", Typ: types.Int},
+				{Name: "cursor", Typ: types.String},
+			},
+			ReturnType: tree.FixedReturnType(changefeedEventsGeneratorType),
+			Generator: eval.GeneratorOverload(func(
+				_ context.Context, evalCtx *eval.Context, args tree.Datums,
+			) (eval.ValueGenerator, error) {
+				return &changefeedEventsGenerator{
+					evalCtx: evalCtx,
+					jobID:   int64(tree.MustBeDInt(args[0])),
+					cursor:  string(tree.MustBeDString(args[1])),
+				}, nil
+			}),
+			Class: tree.GeneratorClass,
+			Info: "Runs the targets and options of the given changefeed job as a sinkless changefeed, as the " +
+				"current user, from cursor, or from the high-water of the job if cursor is empty, " +
+				"and returns the topic, key and value of the messages it emits, rendered as text, " +
+				"along with its resolved timestamps, which can be resumed from. Only changefeeds " +
+				"with format=json are supported.",
+			Volatility: volatility.Volatile,
+		})
+}
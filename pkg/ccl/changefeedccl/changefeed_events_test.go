@@ -0,0 +1,167 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdctest"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangefeedEventsStmt(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	foo := tree.MakeTableNameWithSchema(`d`, `public`, `foo`)
+	changefeed := &tree.CreateChangefeed{
+		Targets: tree.ChangefeedTargets{{TableName: &foo}},
+	}
+	for _, tc := range []struct {
+		opts     map[string]string
+		cursor   string
+		expected string
+	}{
+		{
+			// Sink specific options and those which require a job are left out,
+			// and resolved timestamps are emitted.
+			opts: map[string]string{`diff`: ``, `kafka_sink_config`: `{}`,
+				`on_error`: `pause`, `initial_scan`: `only`},
+			expected: `EXPERIMENTAL CHANGEFEED FOR TABLE d.public.foo ` +
+				`WITH diff, initial_scan = 'only', on_error = 'pause', resolved`,
+		},
+		{
+			// The changefeed resumes from the cursor without re-scanning.
+			opts:   map[string]string{`resolved`: `10s`, `cursor`: `1`, `initial_scan`: `yes`},
+			cursor: `1681234567890123456.0000000001`,
+			expected: `EXPERIMENTAL CHANGEFEED FOR TABLE d.public.foo ` +
+				`WITH resolved = '10s', cursor = '1681234567890123456.0000000001'`,
+		},
+	} {
+		stmt, err := changefeedEventsStmt(changefeed, tc.opts, tc.cursor)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, stmt)
+	}
+
+	_, err := changefeedEventsStmt(changefeed, map[string]string{`format`: `avro`}, ``)
+	require.EqualError(t, err, `changefeed events are only available for changefeeds with format=json`)
+}
+
+func TestChangefeedEventsEndpoint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'a')`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo`)
+		defer closeFeed(t, foo)
+		jobID := foo.(cdctest.EnterpriseTestFeed).JobID()
+
+		client, err := s.Server.GetAdminHTTPClient()
+		require.NoError(t, err)
+		// subscribe streams the events of the changefeed, resuming from
+		// lastEventID if set, until it receives the row with the given key
+		// and a resolved timestamp after it. It returns the rows it received
+		// and the id of the last event.
+		subscribe := func(lastEventID string, key string) (rows []string, id string) {
+			t.Helper()
+			req, err := http.NewRequest(`GET`,
+				fmt.Sprintf(`%s/api/v2/changefeeds/%d/events/`, s.Server.AdminURL(), jobID), nil)
+			require.NoError(t, err)
+			req.Header.Set(`X-Cockroach-API-Session`, `cookie`)
+			if lastEventID != `` {
+				req.Header.Set(`Last-Event-ID`, lastEventID)
+			}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, `text/event-stream`, resp.Header.Get(`Content-Type`))
+
+			var event string
+			seen := false
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				line := scanner.Text()
+				switch {
+				case strings.HasPrefix(line, `event: `):
+					event = strings.TrimPrefix(line, `event: `)
+				case strings.HasPrefix(line, `id: `):
+					id = strings.TrimPrefix(line, `id: `)
+				case strings.HasPrefix(line, `data: `):
+					data := strings.TrimPrefix(line, `data: `)
+					switch event {
+					case `row`:
+						rows = append(rows, data)
+						seen = seen || strings.Contains(data, `"key":[`+key+`]`)
+					case `resolved`:
+						if seen {
+							return rows, id
+						}
+					default:
+						t.Fatalf(`unexpected %s event: %s`, event, data)
+					}
+				}
+			}
+			require.NoError(t, scanner.Err())
+			t.Fatal(`event stream ended`)
+			return nil, ``
+		}
+
+		// Without a cursor, the events are streamed from the high-water of the
+		// changefeed, or from the start of the changefeed if it has none.
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (2, 'b')`)
+		rows, id := subscribe(``, `2`)
+		require.Contains(t, rows, `{"topic":"foo","key":[2],"value":{"after":{"a":2,"b":"b"}}}`)
+		require.NotEmpty(t, id)
+
+		// Resuming from the last event skips the rows at or below it.
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (3, 'c')`)
+		rows, _ = subscribe(id, `3`)
+		for _, row := range rows {
+			require.NotContains(t, row, `"key":[1]`)
+		}
+		require.Contains(t, rows, `{"topic":"foo","key":[3],"value":{"after":{"a":3,"b":"c"}}}`)
+
+		// The events are those of the table watched by the job, even once it
+		// is renamed and another table takes its name.
+		sqlDB.Exec(t, `ALTER TABLE foo RENAME TO bar`)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (100, 'x')`)
+		sqlDB.Exec(t, `INSERT INTO bar VALUES (4, 'd')`)
+		rows, _ = subscribe(id, `4`)
+		for _, row := range rows {
+			require.NotContains(t, row, `"key":[100]`)
+		}
+		require.Contains(t, rows, `{"topic":"bar","key":[4],"value":{"after":{"a":4,"b":"d"}}}`)
+
+		// Unknown jobs aren't found.
+		req, err := http.NewRequest(`GET`,
+			fmt.Sprintf(`%s/api/v2/changefeeds/%d/events/`, s.Server.AdminURL(), jobID+1), nil)
+		require.NoError(t, err)
+		req.Header.Set(`X-Cockroach-API-Session`, `cookie`)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
@@ -11,8 +11,11 @@ package changefeedccl
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcutils"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
@@ -21,9 +24,11 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/jobs"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/closedts"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/protectedts"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfra"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfrapb"
 	"github.com/cockroachdb/cockroach/pkg/sql/isql"
@@ -33,6 +38,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/log/eventpb"
 	"github.com/cockroachdb/cockroach/pkg/util/log/logcrash"
 	"github.com/cockroachdb/cockroach/pkg/util/mon"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
@@ -62,6 +68,15 @@ type changeAggregator struct {
 	// sink is the Sink to write rows to. Resolved timestamps are never written
 	// by changeAggregator.
 	sink EventSink
+	// fanOut, if non-nil, is the sink for a changefeed emitting to multiple
+	// sinks. The sinks it has isolated are reported to the changeFrontier.
+	fanOut *fanOutSink
+	// topicCreator, if non-nil, is the sink which creates the topics it emits
+	// to. The topics it created are reported to the changeFrontier.
+	topicCreator TopicCreatingSink
+	// bufferingSink, if non-nil, is the sink which buffers the messages it
+	// emits. The size of its backlog is reported to the changeFrontier.
+	bufferingSink BufferingSink
 	// changedRowBuf, if non-nil, contains changed rows to be emitted. Anything
 	// queued in `resolvedSpanBuf` is dependent on these having been emitted, so
 	// this one must be empty before moving on to that one.
@@ -74,6 +89,12 @@ type changeAggregator struct {
 	// span was forwarded to the frontier
 	recentKVCount uint64
 
+	// unflushedEvents is the number of events consumed since the sink was last
+	// flushed, and eventsPerFlush is the value it had when the sink was last
+	// flushed. The latter is reported to the changeFrontier.
+	unflushedEvents int64
+	eventsPerFlush  int64
+
 	// eventProducer produces the next event from the kv feed.
 	eventProducer kvevent.Reader
 	// eventConsumer consumes the event.
@@ -83,6 +104,9 @@ type changeAggregator struct {
 	flushFrequency     time.Duration // how often high watermark can be checkpointed.
 	lastSpanFlush      time.Time     // last time expensive, span based checkpoint was written.
 
+	// settingsOverrides are the cluster settings overridden by the changefeed.
+	settingsOverrides changefeedbase.SettingsOverrides
+
 	// frontier keeps track of resolved timestamps for spans along with schema change
 	// boundary information.
 	frontier *schemaChangeFrontier
@@ -91,6 +115,31 @@ type changeAggregator struct {
 	sliMetrics             *sliMetrics
 	closeTelemetryRecorder func()
 	knobs                  TestingKnobs
+
+	// emittedBytesRecorder, if set, counts the bytes written to the sink under
+	// max_emitted_bytes_per_day, which the changeFrontier enforces.
+	emittedBytesRecorder *emittedBytesQuotaRecorder
+	// emissionWindow, if set, is the window outside of which the aggregator
+	// holds the events of the kvfeed under the emission_window option.
+	// heldEvents are the events received while the window was closed, in
+	// order, and emissionPaused is set once the sink was flushed as the
+	// window closed.
+	emissionWindow *changefeedbase.EmissionWindow
+	heldEvents     []kvevent.Event
+	emissionPaused bool
+	// releaseAdmission, if set, releases the admission of the aggregator to
+	// run on its node under changefeed.max_running_per_node.
+	releaseAdmission func()
+	// drainWatcher, if set, notices a drain time set by CANCEL CHANGEFEED ...
+	// AT TIME while the changefeed runs. Changes at or past it are dropped.
+	drainWatcher *drainWatcher
+	// emittedByTable accumulates the messages and bytes emitted for each table
+	// until they're reported to the changeFrontier.
+	emittedByTable *tableEmittedCounts
+	// contentDigests, if set, accumulates the digests of the messages emitted
+	// under the content_digest_table option until they're reported to the
+	// changeFrontier.
+	contentDigests *contentDigests
 }
 
 type timestampLowerBoundOracle interface {
@@ -185,6 +234,10 @@ func newChangeAggregatorProcessor(
 		ca.flushFrequency = changefeedbase.DefaultMinCheckpointFrequency
 	}
 
+	if ca.settingsOverrides, err = opts.GetSettingsOverrides(); err != nil {
+		return nil, err
+	}
+
 	return ca, nil
 }
 
@@ -248,7 +301,7 @@ func (ca *changeAggregator) Start(ctx context.Context) {
 	if ca.knobs.MemMonitor != nil {
 		pool = ca.knobs.MemMonitor
 	}
-	limit := changefeedbase.PerChangefeedMemLimit.Get(&ca.flowCtx.Cfg.Settings.SV)
+	limit := ca.settingsOverrides.GetByteSize(changefeedbase.PerChangefeedMemLimit, &ca.flowCtx.Cfg.Settings.SV)
 	kvFeedMemMon := mon.NewMonitorInheritWithLimit("kvFeed", limit, pool)
 	kvFeedMemMon.StartNoReserved(ctx, pool)
 	ca.kvFeedMemMon = kvFeedMemMon
@@ -265,6 +318,18 @@ func (ca *changeAggregator) Start(ctx context.Context) {
 		return
 	}
 
+	// The changefeed.max_running_per_node limit applies to the aggregators of
+	// changefeed jobs, which do the work of changefeeds wherever they run.
+	if ca.spec.JobID != 0 {
+		ca.releaseAdmission, err = ca.metrics.admission.admit(
+			ctx, &ca.flowCtx.Cfg.Settings.SV, maxFlowAdmissionWait)
+		if err != nil {
+			ca.MoveToDraining(err)
+			ca.cancel()
+			return
+		}
+	}
+
 	// TODO(jayant): add support for sinkless changefeeds using UUID
 	recorder := metricsRecorder(ca.sliMetrics)
 	if !ca.isSinkless() {
@@ -276,6 +341,27 @@ func (ca *changeAggregator) Start(ctx context.Context) {
 		}
 	}
 
+	maxEmittedBytes, err := opts.GetMaxEmittedBytesPerDay()
+	if err != nil {
+		ca.MoveToDraining(err)
+		ca.cancel()
+		return
+	}
+	if maxEmittedBytes > 0 {
+		ca.emittedBytesRecorder = &emittedBytesQuotaRecorder{inner: recorder}
+		recorder = ca.emittedBytesRecorder
+	}
+
+	ca.emissionWindow, err = opts.GetEmissionWindow()
+	if err != nil {
+		ca.MoveToDraining(err)
+		ca.cancel()
+		return
+	}
+	if ca.spec.JobID != 0 && !ca.spec.Feed.Draining {
+		ca.drainWatcher = &drainWatcher{registry: ca.flowCtx.Cfg.JobRegistry, jobID: ca.spec.JobID}
+	}
+
 	ca.sink, err = getEventSink(ctx, ca.flowCtx.Cfg, ca.spec.Feed, timestampOracle,
 		ca.spec.User(), ca.spec.JobID, recorder)
 	if err != nil {
@@ -291,6 +377,15 @@ func (ca *changeAggregator) Start(ctx context.Context) {
 	if b, ok := ca.sink.(*bufferSink); ok {
 		ca.changedRowBuf = &b.buf
 	}
+	if f, ok := ca.sink.(*fanOutSink); ok {
+		ca.fanOut = f
+	}
+	if c, ok := asTopicCreatingSink(ca.sink); ok {
+		ca.topicCreator = c
+	}
+	if b, ok := asBufferingSink(ca.sink); ok {
+		ca.bufferingSink = b
+	}
 
 	// If the initial scan was disabled the highwater would've already been forwarded
 	needsInitialScan := ca.frontier.Frontier().IsEmpty()
@@ -311,9 +406,14 @@ func (ca *changeAggregator) Start(ctx context.Context) {
 		return
 	}
 	ca.sink = &errorWrapperSink{wrapped: ca.sink}
+	ca.emittedByTable = newTableEmittedCounts(
+		ca.sliMetrics, spans, ca.spec.EmittedSpans, ca.spec.Feed.Tables)
+	if feed.ContentDigestTableID != 0 {
+		ca.contentDigests = newContentDigests()
+	}
 	ca.eventConsumer, ca.sink, err = newEventConsumer(
 		ctx, ca.flowCtx.Cfg, ca.spec, feed, ca.frontier.SpanFrontier(), kvFeedHighWater,
-		ca.sink, ca.metrics, ca.sliMetrics, ca.knobs)
+		ca.sink, ca.metrics, ca.sliMetrics, ca.emittedByTable, ca.contentDigests, ca.knobs)
 
 	if err != nil {
 		// Early abort in the case that there is an error setting up the consumption.
@@ -388,7 +488,11 @@ func (ca *changeAggregator) makeKVFeedCfg(
 	if schemaChange.Policy == changefeedbase.OptSchemaChangePolicyIgnore || initialScanOnly {
 		sf = schemafeed.DoNothingSchemaFeed
 	} else {
-		sf = schemafeed.New(ctx, cfg, schemaChange.EventClass, AllTargets(ca.spec.Feed),
+		eventClass := schemaChange.EventClass
+		if ca.knobs.ForceSchemaChangeBackfills {
+			eventClass = schemafeed.AllTableEventsClass
+		}
+		sf = schemafeed.New(ctx, cfg, ca.spec.Feed.TenantID, eventClass, AllTargets(ca.spec.Feed),
 			initialHighWater, &ca.metrics.SchemaFeedMetrics, config.Opts.GetCanHandle())
 	}
 
@@ -396,7 +500,7 @@ func (ca *changeAggregator) makeKVFeedCfg(
 		Writer:                  buf,
 		Settings:                cfg.Settings,
 		DB:                      cfg.DB.KV(),
-		Codec:                   cfg.Codec,
+		Codec:                   sourceCodec(cfg.Codec, ca.spec.Feed.TenantID),
 		Clock:                   cfg.DB.KV().Clock(),
 		Gossip:                  cfg.Gossip,
 		Spans:                   spans,
@@ -490,11 +594,20 @@ func (ca *changeAggregator) close() {
 	if ca.closeTelemetryRecorder != nil {
 		ca.closeTelemetryRecorder()
 	}
+	for i := range ca.heldEvents {
+		a := ca.heldEvents[i].DetachAlloc()
+		a.Release(ca.Ctx())
+	}
+	ca.heldEvents = nil
 
 	if ca.sink != nil {
 		// Best effort: context is often cancel by now, so we expect to see an error
 		_ = ca.sink.Close()
 	}
+	if ca.releaseAdmission != nil {
+		ca.releaseAdmission()
+		ca.releaseAdmission = nil
+	}
 	ca.memAcc.Close(ca.Ctx())
 	if ca.kvFeedMemMon != nil {
 		ca.kvFeedMemMon.Stop(ca.Ctx())
@@ -542,36 +655,99 @@ func (ca *changeAggregator) Next() (rowenc.EncDatumRow, *execinfrapb.ProducerMet
 // kvFeed, sends off this event to the event consumer, and flushes the sink
 // if necessary.
 func (ca *changeAggregator) tick() error {
-	event, err := ca.eventProducer.Get(ca.Ctx())
-	if err != nil {
+	event, ok, err := ca.nextEvent()
+	if err != nil || !ok {
 		return err
 	}
+	drainTime := ca.drainWatcher.get(ca.Ctx())
 
 	queuedNanos := timeutil.Since(event.BufferAddTimestamp()).Nanoseconds()
 	ca.metrics.QueueTimeNanos.Inc(queuedNanos)
 
 	switch event.Type() {
 	case kvevent.TypeKV:
+		if !drainTime.IsEmpty() && !event.Timestamp().Less(drainTime) {
+			// The flow is about to be restarted with the drain time as its end
+			// time; until then, changes past it must not be emitted.
+			a := event.DetachAlloc()
+			a.Release(ca.Ctx())
+			return nil
+		}
 		// Keep track of SLI latency for non-backfill/rangefeed KV events.
 		if event.BackfillTimestamp().IsEmpty() {
 			ca.sliMetrics.AdmitLatency.RecordValue(timeutil.Since(event.Timestamp().GoTime()).Nanoseconds())
 		}
 		ca.recentKVCount++
+		ca.unflushedEvents++
 		return ca.eventConsumer.ConsumeEvent(ca.Ctx(), event)
 	case kvevent.TypeResolved:
 		a := event.DetachAlloc()
 		a.Release(ca.Ctx())
 		resolved := event.Resolved()
+		if !drainTime.IsEmpty() && !resolved.Timestamp.Less(drainTime) {
+			resolved.Timestamp = drainTime.Prev()
+			resolved.BoundaryType = jobspb.ResolvedSpan_NONE
+		}
 		if ca.knobs.FilterSpanWithMutation == nil || !ca.knobs.FilterSpanWithMutation(&resolved) {
 			return ca.noteResolvedSpan(resolved)
 		}
 	case kvevent.TypeFlush:
-		return ca.sink.Flush(ca.Ctx())
+		return ca.flushSink()
 	}
 
 	return nil
 }
 
+// nextEvent returns the next event to process, which is the next event of
+// the kvfeed unless the emission_window of the changefeed, if any, is closed.
+// While it is, the events of the kvfeed, resolved spans included, are held
+// rather than processed, and nextEvent returns false, so that neither rows
+// nor progress past the held rows are emitted. The held events keep their
+// allocations of the memory budget of the kvfeed, which bounds how many
+// events are held: once it is exhausted, the kvfeed stops consuming
+// rangefeeds until the window opens. The held events are processed first
+// once it does. Messages emitted before the window closed are flushed as it
+// closes.
+func (ca *changeAggregator) nextEvent() (kvevent.Event, bool, error) {
+	if ca.emissionWindow == nil {
+		event, err := ca.eventProducer.Get(ca.Ctx())
+		return event, err == nil, err
+	}
+	wait := ca.emissionWindow.UntilOpen(timeutil.Now())
+	if wait == 0 {
+		ca.emissionPaused = false
+		if len(ca.heldEvents) > 0 {
+			event := ca.heldEvents[0]
+			ca.heldEvents[0] = kvevent.Event{}
+			ca.heldEvents = ca.heldEvents[1:]
+			return event, true, nil
+		}
+		event, err := ca.eventProducer.Get(ca.Ctx())
+		return event, err == nil, err
+	}
+	if !ca.emissionPaused {
+		log.Infof(ca.Ctx(), "holding changes for %s until the %s opens",
+			wait, changefeedbase.OptEmissionWindow)
+		if err := ca.flushSink(); err != nil {
+			return kvevent.Event{}, false, err
+		}
+		ca.emissionPaused = true
+	}
+	// Getting the next event is bounded by the opening of the window, lest
+	// the aggregator wait for the kvfeed when its budget is exhausted.
+	ctx, cancel := context.WithTimeout(ca.Ctx(), wait)
+	defer cancel()
+	event, err := ca.eventProducer.Get(ctx)
+	if err != nil {
+		if ca.Ctx().Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			return kvevent.Event{}, false, nil
+		}
+		return kvevent.Event{}, false, err
+	}
+	ca.heldEvents = append(ca.heldEvents, event)
+	return kvevent.Event{}, false, nil
+}
+
 // noteResolvedSpan periodically flushes Frontier progress from the current
 // changeAggregator node to the changeFrontier node to allow the changeFrontier
 // to persist the overall changefeed's progress
@@ -604,8 +780,8 @@ func (ca *changeAggregator) noteResolvedSpan(resolved jobspb.ResolvedSpan) error
 	// either in backfills or if the highwater mark is excessively lagging behind
 	checkpointSpans := ca.spec.JobID != 0 && /* enterprise changefeed */
 		(resolved.Timestamp.Equal(ca.frontier.BackfillTS()) ||
-			ca.frontier.hasLaggingSpans(ca.spec.Feed.StatementTime, &ca.flowCtx.Cfg.Settings.SV)) &&
-		canCheckpointSpans(&ca.flowCtx.Cfg.Settings.SV, ca.lastSpanFlush)
+			ca.frontier.hasLaggingSpans(ca.spec.Feed.StatementTime, &ca.flowCtx.Cfg.Settings.SV, ca.settingsOverrides)) &&
+		canCheckpointSpans(&ca.flowCtx.Cfg.Settings.SV, ca.settingsOverrides, ca.lastSpanFlush)
 
 	if checkpointSpans {
 		defer func() {
@@ -623,7 +799,7 @@ func (ca *changeAggregator) flushFrontier() error {
 	// otherwise, we could lose buffered messages and violate the
 	// at-least-once guarantee. This is also true for checkpointing the
 	// resolved spans in the job progress.
-	if err := ca.sink.Flush(ca.Ctx()); err != nil {
+	if err := ca.flushSink(); err != nil {
 		return err
 	}
 
@@ -646,12 +822,48 @@ func (ca *changeAggregator) flushFrontier() error {
 	return ca.emitResolved(batch)
 }
 
+// flushSink flushes the sink, recording the number of events flushed.
+func (ca *changeAggregator) flushSink() error {
+	ca.eventsPerFlush = ca.unflushedEvents
+	ca.unflushedEvents = 0
+	return ca.sink.Flush(ca.Ctx())
+}
+
+// nodeStatus returns the status of the aggregator, which is reported to the
+// changeFrontier along with resolved spans.
+func (ca *changeAggregator) nodeStatus() jobspb.ChangefeedProgress_NodeStatus {
+	status := jobspb.ChangefeedProgress_NodeStatus{
+		NodeID:         ca.flowCtx.NodeID.SQLInstanceID(),
+		SpanCount:      int64(len(ca.spec.Watches)),
+		Resolved:       ca.frontier.Frontier(),
+		EventsPerFlush: ca.eventsPerFlush,
+	}
+	if ca.kvFeedMemMon != nil {
+		status.BufferedBytes = ca.kvFeedMemMon.AllocBytes()
+	}
+	if ca.bufferingSink != nil {
+		status.SinkBufferedBytes = ca.bufferingSink.BufferedBytes()
+	}
+	return status
+}
+
 func (ca *changeAggregator) emitResolved(batch jobspb.ResolvedSpans) error {
 	progressUpdate := jobspb.ResolvedSpans{
 		ResolvedSpans: batch.ResolvedSpans,
 		Stats: jobspb.ResolvedSpans_Stats{
 			RecentKvCount: ca.recentKVCount,
 		},
+		NodeStatus:        ca.nodeStatus(),
+		EmittedByTable:    ca.emittedByTable.drain(),
+		EmittedSpans:      ca.emittedByTable.drainEmittedSpans(),
+		ContentDigests:    ca.contentDigests.drain(),
+		QuotaEmittedBytes: ca.emittedBytesRecorder.drain(),
+	}
+	if ca.fanOut != nil {
+		progressUpdate.IsolatedSinks = ca.fanOut.IsolatedSinks()
+	}
+	if ca.topicCreator != nil {
+		progressUpdate.CreatedTopics = ca.topicCreator.DrainCreatedTopics()
 	}
 	updateBytes, err := protoutil.Marshal(&progressUpdate)
 	if err != nil {
@@ -698,16 +910,74 @@ type changeFrontier struct {
 	// frontier contains the current resolved timestamp high-water for the tracked
 	// span set.
 	frontier *schemaChangeFrontier
-	// encoder is the Encoder to use for resolved timestamp serialization.
-	encoder Encoder
+	// encoder is the Encoder to use for resolved timestamp serialization. It
+	// is created, from encodingOpts, once the sink is.
+	encoder      Encoder
+	encodingOpts changefeedbase.EncodingOptions
 	// sink is the Sink to write resolved timestamps to. Rows are never written
 	// by changeFrontier.
 	sink ResolvedTimestampSink
+	// fanOut, if non-nil, is the sink for a changefeed emitting to multiple
+	// sinks.
+	fanOut *fanOutSink
+	// isolatedSinks are the sinks, of a changefeed emitting to multiple sinks,
+	// which have been isolated by any processor, along with the frontier when
+	// their isolation was noted. Their high-water is not advanced past it.
+	isolatedSinks map[int32]hlc.Timestamp
+	// nodeStatus is the status last reported by the aggregator on each node.
+	nodeStatus map[base.SQLInstanceID]jobspb.ChangefeedProgress_NodeStatus
+	// pendingEmittedByTable are the messages and bytes reported by the
+	// aggregators as emitted for each table which have yet to be added to the
+	// job progress.
+	pendingEmittedByTable []jobspb.ChangefeedProgress_TableEmitted
+	// emittedSpans tracks the greatest MVCC timestamp emitted for each of the
+	// tracked spans, as reported by the aggregators and recovered from the job
+	// progress. Those above the checkpoint are added to the job progress, so
+	// that messages emitted again after a restart are counted as duplicates.
+	emittedSpans *span.Frontier
+	// pendingCreatedTopics are the topics reported by the aggregators as
+	// created which have yet to be added to the job progress.
+	pendingCreatedTopics []string
+	// throughputEmitted are the messages and bytes reported by the
+	// aggregators as emitted since throughputSince, the start of the window
+	// over which the rates of throughput are being measured. throughput holds
+	// the rates measured over the last complete window.
+	throughputEmitted jobspb.ChangefeedProgress_TableEmitted
+	throughputSince   time.Time
+	throughput        jobspb.ChangefeedProgress_Throughput
+	// contentDigests, if set, combines the digests of the messages reported
+	// by the aggregators under the content_digest_table option into the digests
+	// written with resolved timestamps by contentDigestWriter.
+	contentDigests      *resolvedContentDigests
+	contentDigestWriter *contentDigestWriter
+	// maxEmittedBytes is the max_emitted_bytes_per_day option, if set, which
+	// emittedBytesQuota enforces against the bytes reported by the
+	// aggregators.
+	maxEmittedBytes   int64
+	emittedBytesQuota *emittedBytesQuota
 	// freqEmitResolved, if >= 0, is a lower bound on the duration between
 	// resolved timestamp emits.
 	freqEmitResolved time.Duration
 	// lastEmitResolved is the last time a resolved timestamp was emitted.
 	lastEmitResolved time.Time
+	// resolvedTables, if set, are the intervals at which resolved timestamps
+	// are emitted to the topics of individual tables, in place of
+	// freqEmitResolved.
+	resolvedTables []*tableResolvedInterval
+	// tableTargets are the targets of the changefeed by table ID.
+	tableTargets map[descpb.ID]changefeedbase.Target
+	// tableResolved is the resolved timestamp of each table as of the last
+	// checkpoint.
+	tableResolved []jobspb.ChangefeedProgress_TableResolved
+	// resolvedPerTable, if set, is the resolved_per_table option, under which
+	// each table is sent its own resolved timestamp from tableResolved.
+	resolvedPerTable bool
+	// tableLastEmitted is the last resolved timestamp emitted to each table
+	// under the resolved_per_table option.
+	tableLastEmitted map[descpb.ID]hlc.Timestamp
+	// rowDeleter, if set, deletes the rows emitted by the changefeed after
+	// each checkpoint, under the delete_after_emit option.
+	rowDeleter *emittedRowDeleter
 
 	// slowLogEveryN rate-limits the logging of slow spans
 	slowLogEveryN log.EveryN
@@ -716,6 +986,9 @@ type changeFrontier struct {
 	// record was updated to the frontier's highwater mark
 	lastProtectedTimestampUpdate time.Time
 
+	// settingsOverrides are the cluster settings overridden by the changefeed.
+	settingsOverrides changefeedbase.SettingsOverrides
+
 	// js, if non-nil, is called to checkpoint the changefeed's
 	// progress in the corresponding system job entry.
 	js *jobState
@@ -743,6 +1016,9 @@ type changeFrontier struct {
 const (
 	runStatusUpdateFrequency time.Duration = time.Minute
 	slowSpanMaxFrequency                   = 10 * time.Second
+	// throughputUpdateFrequency is the length of the windows over which the
+	// rates at which a changefeed emits are measured.
+	throughputUpdateFrequency = 30 * time.Second
 )
 
 // jobState encapsulates changefeed job state.
@@ -755,6 +1031,8 @@ type jobState struct {
 	settings *cluster.Settings
 	metrics  *Metrics
 	ts       timeutil.TimeSource
+	// settingsOverrides are the cluster settings overridden by the changefeed.
+	settingsOverrides changefeedbase.SettingsOverrides
 
 	// The last time we updated job run status.
 	lastRunStatusUpdate time.Time
@@ -790,6 +1068,7 @@ func newJobState(
 	j *jobs.Job,
 	coreProgress *coreChangefeedProgress,
 	st *cluster.Settings,
+	settingsOverrides changefeedbase.SettingsOverrides,
 	metrics *Metrics,
 	ts timeutil.TimeSource,
 ) *jobState {
@@ -797,14 +1076,17 @@ func newJobState(
 		job:                j,
 		coreProgress:       coreProgress,
 		settings:           st,
+		settingsOverrides:  settingsOverrides,
 		metrics:            metrics,
 		ts:                 ts,
 		lastProgressUpdate: ts.Now(),
 	}
 }
 
-func canCheckpointSpans(sv *settings.Values, lastCheckpoint time.Time) bool {
-	freq := changefeedbase.FrontierCheckpointFrequency.Get(sv)
+func canCheckpointSpans(
+	sv *settings.Values, overrides changefeedbase.SettingsOverrides, lastCheckpoint time.Time,
+) bool {
+	freq := overrides.GetDuration(changefeedbase.FrontierCheckpointFrequency, sv)
 	if freq == 0 {
 		return false
 	}
@@ -812,7 +1094,7 @@ func canCheckpointSpans(sv *settings.Values, lastCheckpoint time.Time) bool {
 }
 
 func (j *jobState) canCheckpointSpans() bool {
-	return canCheckpointSpans(&j.settings.SV, j.lastProgressUpdate)
+	return canCheckpointSpans(&j.settings.SV, j.settingsOverrides, j.lastProgressUpdate)
 }
 
 // canCheckpointHighWatermark returns true if we should update job high water mark (i.e. progress).
@@ -826,7 +1108,7 @@ func (j *jobState) canCheckpointHighWatermark(frontierChanged bool) bool {
 		return false
 	}
 
-	minAdvance := changefeedbase.MinHighWaterMarkCheckpointAdvance.Get(&j.settings.SV)
+	minAdvance := j.settingsOverrides.GetDuration(changefeedbase.MinHighWaterMarkCheckpointAdvance, &j.settings.SV)
 	if j.checkpointDuration > 0 &&
 		j.ts.Now().Before(j.lastProgressUpdate.Add(j.checkpointDuration+minAdvance)) {
 		// Updates are too rapid; skip some.
@@ -840,7 +1122,7 @@ func (j *jobState) canCheckpointHighWatermark(frontierChanged bool) bool {
 // checkpointCompleted must be called when job checkpoint completes.
 // checkpointDuration indicates how long the checkpoint took.
 func (j *jobState) checkpointCompleted(ctx context.Context, checkpointDuration time.Duration) {
-	minAdvance := changefeedbase.MinHighWaterMarkCheckpointAdvance.Get(&j.settings.SV)
+	minAdvance := j.settingsOverrides.GetDuration(changefeedbase.MinHighWaterMarkCheckpointAdvance, &j.settings.SV)
 	if j.progressUpdatesSkipped {
 		// Log message if we skipped updates for some time.
 		warnThreshold := 2 * minAdvance
@@ -878,12 +1160,18 @@ func newChangeFrontierProcessor(
 		return nil, err
 	}
 
+	emittedSpans, err := span.MakeFrontier(spec.TrackedSpans...)
+	if err != nil {
+		return nil, err
+	}
+
 	cf := &changeFrontier{
 		flowCtx:       flowCtx,
 		spec:          spec,
 		memAcc:        memMonitor.MakeBoundAccount(),
 		input:         input,
 		frontier:      sf,
+		emittedSpans:  emittedSpans,
 		slowLogEveryN: log.Every(slowSpanMaxFrequency),
 	}
 
@@ -926,14 +1214,50 @@ func newChangeFrontierProcessor(
 	} else {
 		cf.freqEmitResolved = emitNoResolved
 	}
+	tableIntervals, err := opts.GetResolvedTimestampTableIntervals()
+	if err != nil {
+		return nil, err
+	}
+	for table, freq := range tableIntervals {
+		cf.resolvedTables = append(cf.resolvedTables, &tableResolvedInterval{table: table, freq: freq})
+	}
+	cf.tableTargets = make(map[descpb.ID]changefeedbase.Target)
+	targets := AllTargets(spec.Feed)
+	_ = targets.EachTarget(func(t changefeedbase.Target) error {
+		cf.tableTargets[t.TableID] = t
+		return nil
+	})
+	if opts.IsSet(changefeedbase.OptResolvedPerTable) {
+		cf.resolvedPerTable = true
+		cf.tableLastEmitted = make(map[descpb.ID]hlc.Timestamp)
+	}
+
+	if cf.settingsOverrides, err = opts.GetSettingsOverrides(); err != nil {
+		return nil, err
+	}
+	if cf.maxEmittedBytes, err = opts.GetMaxEmittedBytesPerDay(); err != nil {
+		return nil, err
+	}
+	if opts.IsSet(changefeedbase.OptDeleteAfterEmit) && spec.JobID != 0 {
+		if cf.rowDeleter, err = makeEmittedRowDeleter(flowCtx.Cfg.DB, flowCtx.Cfg.JobRegistry,
+			spec.JobID, spec.User(), spec.Feed); err != nil {
+			return nil, err
+		}
+	}
 
 	encodingOpts, err := opts.GetEncodingOptions()
 	if err != nil {
 		return nil, err
 	}
-	if cf.encoder, err = getEncoder(encodingOpts, AllTargets(spec.Feed)); err != nil {
+	if err := resolveSchemaRegistryURI(ctx, flowCtx.Cfg.DB, &encodingOpts); err != nil {
 		return nil, err
 	}
+	cf.encodingOpts = withSourceGeneration(encodingOpts, flowCtx.Cfg.LogicalClusterID, spec.Feed)
+	if spec.Feed.ContentDigestTableID != 0 && cf.freqEmitResolved != emitNoResolved {
+		cf.contentDigests = newResolvedContentDigests()
+		cf.contentDigestWriter = newContentDigestWriter(flowCtx.Cfg.InternalDB, spec.User(), spec.JobID,
+			spec.Feed.ContentDigestTableID, cf.contentDigests)
+	}
 
 	return cf, nil
 }
@@ -952,6 +1276,7 @@ func (cf *changeFrontier) Start(ctx context.Context) {
 	// early returns if errors are detected.
 	ctx = cf.StartInternal(ctx, changeFrontierProcName)
 	cf.input.Start(ctx)
+	cf.throughputSince = timeutil.Now()
 
 	// The job registry has a set of metrics used to monitor the various jobs it
 	// runs. They're all stored as the `metric.Struct` interface because of
@@ -981,9 +1306,22 @@ func (cf *changeFrontier) Start(ctx context.Context) {
 	if b, ok := cf.sink.(*bufferSink); ok {
 		cf.resolvedBuf = &b.buf
 	}
+	if f, ok := cf.sink.(*fanOutSink); ok {
+		cf.fanOut = f
+	}
 
 	cf.sink = &errorWrapperSink{wrapped: cf.sink}
 
+	// The schemas of avro resolved timestamps are registered with the registry
+	// of the sink, if it records schemas itself, like those of the rows
+	// emitted by the aggregators.
+	if cf.encoder, err = getEncoder(
+		cf.encodingOpts, AllTargets(cf.spec.Feed), schemaRegistryForSink(cf.sink),
+	); err != nil {
+		cf.MoveToDraining(err)
+		return
+	}
+
 	cf.highWaterAtStart = cf.spec.Feed.StatementTime
 	if cf.spec.JobID != 0 {
 		job, err := cf.flowCtx.Cfg.JobRegistry.LoadClaimedJob(ctx, cf.spec.JobID)
@@ -991,9 +1329,10 @@ func (cf *changeFrontier) Start(ctx context.Context) {
 			cf.MoveToDraining(err)
 			return
 		}
-		cf.js = newJobState(job, nil, cf.flowCtx.Cfg.Settings, cf.metrics, timeutil.DefaultTimeSource{})
+		cf.js = newJobState(job, nil, cf.flowCtx.Cfg.Settings, cf.settingsOverrides, cf.metrics,
+			timeutil.DefaultTimeSource{})
 
-		if changefeedbase.FrontierCheckpointFrequency.Get(&cf.flowCtx.Cfg.Settings.SV) == 0 {
+		if cf.settingsOverrides.GetDuration(changefeedbase.FrontierCheckpointFrequency, &cf.flowCtx.Cfg.Settings.SV) == 0 {
 			log.Warning(ctx,
 				"Frontier checkpointing disabled; set changefeed.frontier_checkpoint_frequency to non-zero value to re-enable")
 		}
@@ -1008,6 +1347,9 @@ func (cf *changeFrontier) Start(ctx context.Context) {
 		if ts := p.GetHighWater(); ts != nil {
 			cf.highWaterAtStart.Forward(*ts)
 			cf.frontier.initialHighWater = *ts
+			if cf.contentDigests != nil {
+				cf.contentDigests.since = *ts
+			}
 			for _, span := range cf.spec.TrackedSpans {
 				if _, err := cf.frontier.Forward(span, *ts); err != nil {
 					cf.MoveToDraining(err)
@@ -1015,6 +1357,23 @@ func (cf *changeFrontier) Start(ctx context.Context) {
 				}
 			}
 		}
+		// The spans emitted above the checkpoint before the restart are kept
+		// until the changefeed checkpoints past them.
+		if progress := p.GetChangefeed(); progress != nil {
+			for _, emitted := range progress.EmittedSpans {
+				if _, err := cf.emittedSpans.Forward(emitted.Span, emitted.MaxEmittedMVCC); err != nil {
+					cf.MoveToDraining(err)
+					return
+				}
+			}
+		}
+
+		if cf.rowDeleter != nil {
+			if err := cf.rowDeleter.start(ctx, cf.flowCtx.Stopper()); err != nil {
+				cf.MoveToDraining(err)
+				return
+			}
+		}
 
 		if p.RunningStatus != "" {
 			// If we had running status set, that means we're probably retrying
@@ -1025,7 +1384,19 @@ func (cf *changeFrontier) Start(ctx context.Context) {
 	} else {
 		cf.js = newJobState(nil,
 			cf.EvalCtx.ChangefeedState.(*coreChangefeedProgress),
-			cf.flowCtx.Cfg.Settings, cf.metrics, timeutil.DefaultTimeSource{})
+			cf.flowCtx.Cfg.Settings, cf.settingsOverrides, cf.metrics, timeutil.DefaultTimeSource{})
+	}
+
+	if cf.maxEmittedBytes > 0 {
+		// The quota carries on from the window recorded by the previous run
+		// of the changefeed, if any.
+		var window jobspb.ChangefeedProgress_EmittedBytesQuotaWindow
+		if cf.js.job != nil {
+			if p := cf.js.job.Progress().GetChangefeed(); p != nil {
+				window = p.EmittedBytesQuotaWindow
+			}
+		}
+		cf.emittedBytesQuota = newEmittedBytesQuota(cf.maxEmittedBytes, timeutil.Now, window)
 	}
 
 	cf.metrics.mu.Lock()
@@ -1055,6 +1426,10 @@ func (cf *changeFrontier) close() {
 			// Best effort: context is often cancel by now, so we expect to see an error
 			_ = cf.sink.Close()
 		}
+		if cf.rowDeleter != nil {
+			// InternalClose canceled the context of the goroutine deleting rows.
+			cf.rowDeleter.wait()
+		}
 		cf.memAcc.Close(cf.Ctx())
 		cf.MemMonitor.Stop(cf.Ctx())
 	}
@@ -1156,6 +1531,38 @@ func (cf *changeFrontier) noteAggregatorProgress(d rowenc.EncDatum) error {
 
 	cf.maybeMarkJobIdle(resolvedSpans.Stats.RecentKvCount)
 
+	// Sinks must be marked isolated before the frontier is forwarded, since the
+	// aggregator did not deliver the resolved spans to them.
+	cf.noteIsolatedSinks(resolvedSpans.IsolatedSinks)
+	cf.noteNodeStatus(resolvedSpans.NodeStatus)
+	if len(resolvedSpans.EmittedByTable) > 0 {
+		cf.pendingEmittedByTable = addTableEmitted(cf.pendingEmittedByTable, resolvedSpans.EmittedByTable)
+	}
+	for _, c := range resolvedSpans.EmittedByTable {
+		cf.throughputEmitted.EmittedMessages += c.EmittedMessages
+		cf.throughputEmitted.EmittedBytes += c.EmittedBytes
+		cf.throughputEmitted.DuplicateMessages += c.DuplicateMessages
+	}
+	cf.maybeUpdateThroughput()
+	for _, emitted := range resolvedSpans.EmittedSpans {
+		if _, err := cf.emittedSpans.Forward(emitted.Span, emitted.MaxEmittedMVCC); err != nil {
+			return err
+		}
+	}
+	cf.pendingCreatedTopics = append(cf.pendingCreatedTopics, resolvedSpans.CreatedTopics...)
+	if cf.contentDigests != nil {
+		// Digests must be added before the frontier is forwarded, since they
+		// include the messages at or below the resolved spans.
+		cf.contentDigests.add(resolvedSpans.ContentDigests)
+	}
+	if cf.emittedBytesQuota != nil {
+		cf.emittedBytesQuota.record(resolvedSpans.QuotaEmittedBytes)
+		if err := cf.emittedBytesQuota.check(); err != nil {
+			cf.noteEmittedBytesQuotaExceeded()
+			return err
+		}
+	}
+
 	for _, resolved := range resolvedSpans.ResolvedSpans {
 		// Inserting a timestamp less than the one the changefeed flow started at
 		// could potentially regress the job progress. This is not expected, but it
@@ -1170,6 +1577,9 @@ func (cf *changeFrontier) noteAggregatorProgress(d rowenc.EncDatum) error {
 				redact.Safe(resolved.Timestamp), resolved.Span, redact.Safe(cf.highWaterAtStart))
 			continue
 		}
+		if cf.knobs.StallFrontier != nil && cf.knobs.StallFrontier(resolved) {
+			continue
+		}
 		if err := cf.forwardFrontier(resolved); err != nil {
 			return err
 		}
@@ -1185,6 +1595,9 @@ func (cf *changeFrontier) forwardFrontier(resolved jobspb.ResolvedSpan) error {
 	}
 
 	cf.maybeLogBehindSpan(frontierChanged)
+	if frontierChanged && cf.contentDigests != nil {
+		cf.contentDigests.fold(cf.frontier.Frontier())
+	}
 
 	// If frontier changed, we emit resolved timestamp.
 	emitResolved := frontierChanged
@@ -1203,6 +1616,9 @@ func (cf *changeFrontier) forwardFrontier(resolved jobspb.ResolvedSpan) error {
 		// Keeping this after the checkpointJobProgress call will avoid
 		// some duplicates if a restart happens.
 		newResolved := cf.frontier.Frontier()
+		if cf.rowDeleter != nil {
+			cf.rowDeleter.noteFrontier(newResolved)
+		}
 		cf.metrics.mu.Lock()
 		if cf.metricsID != -1 {
 			cf.metrics.mu.resolved[cf.metricsID] = newResolved
@@ -1224,7 +1640,7 @@ func (cf *changeFrontier) maybeMarkJobIdle(recentKVCount uint64) {
 		cf.frontier.ForwardLatestKV(timeutil.Now())
 	}
 
-	idleTimeout := changefeedbase.IdleTimeout.Get(&cf.flowCtx.Cfg.Settings.SV)
+	idleTimeout := cf.settingsOverrides.GetDuration(changefeedbase.IdleTimeout, &cf.flowCtx.Cfg.Settings.SV)
 	if idleTimeout == 0 {
 		return
 	}
@@ -1251,13 +1667,13 @@ func (cf *changeFrontier) maybeCheckpointJob(
 	// it, therefore to avoid losing that progress on changefeed resumption we
 	// also store as many of those leading spans as we can in the job progress
 	updateCheckpoint :=
-		(inBackfill || cf.frontier.hasLaggingSpans(cf.spec.Feed.StatementTime, &cf.js.settings.SV)) &&
+		(inBackfill || cf.frontier.hasLaggingSpans(cf.spec.Feed.StatementTime, &cf.js.settings.SV, cf.settingsOverrides)) &&
 			cf.js.canCheckpointSpans()
 
 	// If the highwater has moved an empty checkpoint will be saved
 	var checkpoint jobspb.ChangefeedProgress_Checkpoint
 	if updateCheckpoint {
-		maxBytes := changefeedbase.FrontierCheckpointMaxBytes.Get(&cf.flowCtx.Cfg.Settings.SV)
+		maxBytes := cf.settingsOverrides.GetByteSize(changefeedbase.FrontierCheckpointMaxBytes, &cf.flowCtx.Cfg.Settings.SV)
 		checkpoint.Spans, checkpoint.Timestamp = cf.frontier.getCheckpointSpans(maxBytes)
 	}
 
@@ -1283,6 +1699,13 @@ func (cf *changeFrontier) checkpointJobProgress(
 	}
 	cf.metrics.FrontierUpdates.Inc(1)
 	var updateSkipped error
+	var drainTime hlc.Timestamp
+	tableResolved := cf.frontier.tableResolved(
+		sourceCodec(cf.flowCtx.Codec(), cf.spec.Feed.TenantID), cf.tableTargets)
+	var pendingEmittedBytes int64
+	for _, c := range cf.pendingEmittedByTable {
+		pendingEmittedBytes += c.EmittedBytes
+	}
 	if cf.js.job != nil {
 
 		if err := cf.js.job.NoTxn().Update(cf.Ctx(), func(
@@ -1295,6 +1718,19 @@ func (cf *changeFrontier) checkpointJobProgress(
 				return nil
 			}
 
+			// CANCEL CHANGEFEED ... AT TIME updates the job details while the
+			// changefeed is running; notice it here so that the flow can be
+			// restarted with the new end time. This must happen before the
+			// progress is updated, so that a frontier which passed the drain
+			// time is never persisted.
+			if details := md.Payload.GetChangefeed(); details != nil &&
+				details.Draining && !cf.spec.Feed.Draining {
+				drainTime = details.EndTime
+				if !frontier.Less(drainTime) {
+					return nil
+				}
+			}
+
 			// Advance resolved timestamp.
 			progress := md.Progress
 			progress.Progress = &jobspb.Progress_HighWater{
@@ -1303,6 +1739,25 @@ func (cf *changeFrontier) checkpointJobProgress(
 
 			changefeedProgress := progress.Details.(*jobspb.Progress_Changefeed).Changefeed
 			changefeedProgress.Checkpoint = &checkpoint
+			if len(cf.spec.Feed.AdditionalSinkURIs) > 0 {
+				cf.updateSinkProgress(changefeedProgress, frontier)
+			}
+			changefeedProgress.NodeStatus = cf.nodeStatusProgress()
+			changefeedProgress.Throughput = cf.throughputProgress()
+			if len(cf.pendingEmittedByTable) > 0 {
+				changefeedProgress.EmittedByTable = addTableEmitted(
+					changefeedProgress.EmittedByTable, cf.pendingEmittedByTable)
+				changefeedProgress.EmittedBytes += pendingEmittedBytes
+			}
+			changefeedProgress.CreatedTopics = addCreatedTopics(
+				changefeedProgress.CreatedTopics, cf.pendingCreatedTopics)
+			changefeedProgress.DeleteAfterEmitTimestamps = trimDeleteAfterEmitTimestamps(
+				changefeedProgress.DeleteAfterEmitTimestamps, frontier)
+			changefeedProgress.ResolvedByTable = tableResolved
+			changefeedProgress.EmittedSpans = emittedSpansProgress(cf.emittedSpans, frontier, checkpoint)
+			if cf.emittedBytesQuota != nil {
+				changefeedProgress.EmittedBytesQuotaWindow = cf.emittedBytesQuota.window()
+			}
 
 			if err := cf.manageProtectedTimestamps(cf.Ctx(), txn, changefeedProgress); err != nil {
 				log.Warningf(cf.Ctx(), "error managing protected timestamp record: %v", err)
@@ -1311,6 +1766,10 @@ func (cf *changeFrontier) checkpointJobProgress(
 
 			if updateRunStatus {
 				md.Progress.RunningStatus = fmt.Sprintf("running: resolved=%s", frontier)
+				changefeedProgress.RetryableErrorClass = ""
+				if len(cf.isolatedSinks) > 0 {
+					md.Progress.RunningStatus += fmt.Sprintf(", isolated sinks=%d", len(cf.isolatedSinks))
+				}
 			}
 
 			ju.UpdateProgress(progress)
@@ -1336,6 +1795,21 @@ func (cf *changeFrontier) checkpointJobProgress(
 		log.Warningf(cf.Ctx(), "skipping changefeed checkpoint: %s", updateSkipped)
 		return false, nil
 	}
+	if !drainTime.IsEmpty() && !frontier.Less(drainTime) {
+		return false, changefeedbase.WithTerminalError(errors.Newf(
+			"changefeed resolved timestamp %s passed the drain time %s", frontier, drainTime))
+	}
+	if cf.js.job != nil {
+		cf.sliMetrics.CheckpointedEmittedBytes.Inc(pendingEmittedBytes)
+	}
+	cf.pendingEmittedByTable = nil
+	cf.pendingCreatedTopics = nil
+	cf.tableResolved = tableResolved
+
+	if !drainTime.IsEmpty() {
+		return false, changefeedbase.MarkRetryableError(errors.Newf(
+			"changefeed draining at %s", drainTime))
+	}
 
 	if cf.knobs.RaiseRetryableError != nil {
 		if err := cf.knobs.RaiseRetryableError(); err != nil {
@@ -1347,13 +1821,165 @@ func (cf *changeFrontier) checkpointJobProgress(
 	return true, nil
 }
 
+// noteEmittedBytesQuotaExceeded records the window in which the changefeed
+// exceeded max_emitted_bytes_per_day in the job progress, so that the quota
+// isn't restored when the changefeed is resumed, and logs an event.
+func (cf *changeFrontier) noteEmittedBytesQuotaExceeded() {
+	window := cf.emittedBytesQuota.window()
+	var description string
+	if cf.js.job != nil {
+		description = cf.js.job.Payload().Description
+		if err := cf.js.job.NoTxn().Update(cf.Ctx(), func(
+			txn isql.Txn, md jobs.JobMetadata, ju *jobs.JobUpdater,
+		) error {
+			if p := md.Progress.GetChangefeed(); p != nil {
+				p.EmittedBytesQuotaWindow = window
+				ju.UpdateProgress(md.Progress)
+			}
+			return nil
+		}); err != nil {
+			log.Warningf(cf.Ctx(), "error recording the emitted bytes quota window: %v", err)
+		}
+	}
+	log.StructuredEvent(cf.Ctx(), &eventpb.ChangefeedEmittedBytesQuotaExceeded{
+		CommonChangefeedEventDetails: getCommonChangefeedEventDetails(cf.Ctx(), cf.spec.Feed, description),
+		JobId:                        int64(cf.spec.JobID),
+		EmittedBytes:                 window.EmittedBytes,
+		MaxEmittedBytesPerDay:        cf.maxEmittedBytes,
+	})
+}
+
+// noteIsolatedSinks records sinks which have been isolated. The resolved spans
+// forwarded into the frontier so far were flushed to every sink by the
+// aggregators which reported them, so the frontier is the high-water of the
+// sinks isolated since.
+func (cf *changeFrontier) noteIsolatedSinks(isolated []int32) {
+	if cf.fanOut != nil {
+		isolated = append(isolated, cf.fanOut.IsolatedSinks()...)
+	}
+	for _, i := range isolated {
+		if _, ok := cf.isolatedSinks[i]; ok {
+			continue
+		}
+		if cf.isolatedSinks == nil {
+			cf.isolatedSinks = make(map[int32]hlc.Timestamp)
+		}
+		cf.isolatedSinks[i] = cf.frontier.Frontier()
+	}
+}
+
+// noteNodeStatus records the status reported by an aggregator.
+func (cf *changeFrontier) noteNodeStatus(status jobspb.ChangefeedProgress_NodeStatus) {
+	if status.NodeID == 0 {
+		// The aggregator is running on a node which doesn't report its status.
+		return
+	}
+	if cf.nodeStatus == nil {
+		cf.nodeStatus = make(map[base.SQLInstanceID]jobspb.ChangefeedProgress_NodeStatus)
+	}
+	cf.nodeStatus[status.NodeID] = status
+}
+
+// nodeStatusProgress returns the status of each node, sorted by node ID, to
+// record in the job progress.
+func (cf *changeFrontier) nodeStatusProgress() []jobspb.ChangefeedProgress_NodeStatus {
+	statuses := make([]jobspb.ChangefeedProgress_NodeStatus, 0, len(cf.nodeStatus))
+	for _, status := range cf.nodeStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].NodeID < statuses[j].NodeID })
+	return statuses
+}
+
+// maybeUpdateThroughput measures the rates at which messages and bytes were
+// emitted once the window over which they are measured is complete. The rates
+// are recorded in the job progress at each checkpoint, and are recorded here
+// if the job progress hasn't been updated over the window, so that they stay
+// current while the changefeed doesn't checkpoint, e.g. when its high-water
+// is held back by a lagging span.
+func (cf *changeFrontier) maybeUpdateThroughput() {
+	window := throughputUpdateFrequency
+	if cf.knobs.ThroughputUpdateFrequency > 0 {
+		window = cf.knobs.ThroughputUpdateFrequency
+	}
+	now := timeutil.Now()
+	elapsed := now.Sub(cf.throughputSince)
+	if elapsed < window {
+		return
+	}
+	seconds := elapsed.Seconds()
+	cf.throughput = jobspb.ChangefeedProgress_Throughput{
+		EmittedMessagesPerSecond:   float64(cf.throughputEmitted.EmittedMessages) / seconds,
+		EmittedBytesPerSecond:      float64(cf.throughputEmitted.EmittedBytes) / seconds,
+		DuplicateMessagesPerSecond: float64(cf.throughputEmitted.DuplicateMessages) / seconds,
+	}
+	cf.throughputEmitted = jobspb.ChangefeedProgress_TableEmitted{}
+	cf.throughputSince = now
+
+	if cf.js.job == nil || now.Sub(cf.js.lastProgressUpdate) < window {
+		return
+	}
+	throughput := cf.throughputProgress()
+	if err := cf.js.job.NoTxn().Update(cf.Ctx(), func(
+		txn isql.Txn, md jobs.JobMetadata, ju *jobs.JobUpdater,
+	) error {
+		// As with checkpoints, the throughput isn't recorded unless the job is
+		// running, such as while a pause is requested.
+		if md.CheckRunningOrReverting() != nil {
+			return nil
+		}
+		if p := md.Progress.GetChangefeed(); p != nil {
+			p.Throughput = throughput
+			ju.UpdateProgress(md.Progress)
+		}
+		return nil
+	}); err != nil {
+		log.Warningf(cf.Ctx(), "error recording the changefeed throughput: %v", err)
+	}
+}
+
+// throughputProgress returns the rates at which messages and bytes were
+// emitted over the last complete window, along with the backlog of the sinks
+// of the aggregators as last reported, to record in the job progress.
+func (cf *changeFrontier) throughputProgress() jobspb.ChangefeedProgress_Throughput {
+	throughput := cf.throughput
+	for _, status := range cf.nodeStatus {
+		throughput.BacklogBytes += status.SinkBufferedBytes
+	}
+	return throughput
+}
+
+// updateSinkProgress advances the high-water of each sink of a changefeed
+// emitting to multiple sinks to the frontier. The high-water of a sink which
+// has been isolated is that of the frontier when its isolation was noted, and
+// then no longer advances.
+func (cf *changeFrontier) updateSinkProgress(
+	progress *jobspb.ChangefeedProgress, frontier hlc.Timestamp,
+) {
+	cf.noteIsolatedSinks(nil)
+	for len(progress.Sinks) < len(cf.spec.Feed.AdditionalSinkURIs)+1 {
+		progress.Sinks = append(progress.Sinks, jobspb.ChangefeedProgress_SinkProgress{})
+	}
+	for i := range progress.Sinks {
+		if progress.Sinks[i].Isolated {
+			continue
+		}
+		if highWater, ok := cf.isolatedSinks[int32(i)]; ok {
+			progress.Sinks[i].Isolated = true
+			progress.Sinks[i].HighWater.Forward(highWater)
+			continue
+		}
+		progress.Sinks[i].HighWater = frontier
+	}
+}
+
 // manageProtectedTimestamps periodically advances the protected timestamp for
 // the changefeed's targets to the current highwater mark.  The record is
 // cleared during changefeedResumer.OnFailOrCancel
 func (cf *changeFrontier) manageProtectedTimestamps(
 	ctx context.Context, txn isql.Txn, progress *jobspb.ChangefeedProgress,
 ) error {
-	ptsUpdateInterval := changefeedbase.ProtectTimestampInterval.Get(&cf.flowCtx.Cfg.Settings.SV)
+	ptsUpdateInterval := cf.settingsOverrides.GetDuration(changefeedbase.ProtectTimestampInterval, &cf.flowCtx.Cfg.Settings.SV)
 	if timeutil.Since(cf.lastProtectedTimestampUpdate) < ptsUpdateInterval {
 		return nil
 	}
@@ -1370,7 +1996,7 @@ func (cf *changeFrontier) manageProtectedTimestamps(
 	recordID := progress.ProtectedTimestampRecord
 	if recordID == uuid.Nil {
 		ptr := createProtectedTimestampRecord(
-			ctx, cf.flowCtx.Codec(), cf.spec.JobID, AllTargets(cf.spec.Feed), highWater, progress,
+			ctx, sourceCodec(cf.flowCtx.Codec(), cf.spec.Feed.TenantID), cf.spec.JobID, AllTargets(cf.spec.Feed), highWater, progress,
 		)
 		if err := pts.Protect(ctx, ptr); err != nil {
 			return err
@@ -1378,22 +2004,78 @@ func (cf *changeFrontier) manageProtectedTimestamps(
 	} else {
 		log.VEventf(ctx, 2, "updating protected timestamp %v at %v", recordID, highWater)
 		if err := pts.UpdateTimestamp(ctx, recordID, highWater); err != nil {
-			return err
+			if !errors.Is(err, protectedts.ErrNotExists) {
+				return err
+			}
+			// The record was released when it expired while the changefeed was
+			// paused; protect the data from the highwater mark on.
+			log.Warningf(ctx, "protected timestamp %v no longer exists; creating a new one at %v",
+				recordID, highWater)
+			ptr := createProtectedTimestampRecord(
+				ctx, sourceCodec(cf.flowCtx.Codec(), cf.spec.Feed.TenantID), cf.spec.JobID, AllTargets(cf.spec.Feed), highWater, progress,
+			)
+			if err := pts.Protect(ctx, ptr); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// tableResolvedInterval is the interval at which resolved timestamps are
+// emitted to the topics of a table.
+type tableResolvedInterval struct {
+	// table is the statement time name of the table, or its unqualified name.
+	table string
+	freq  time.Duration
+	// lastEmitted is the last resolved timestamp emitted to the table.
+	lastEmitted time.Time
+}
+
+// matches returns whether the target is a table named by the interval.
+func (t *tableResolvedInterval) matches(target changefeedbase.Target) bool {
+	name := string(target.StatementTimeName)
+	if name == t.table {
+		return true
+	}
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[i+1:] == t.table
+	}
+	return false
+}
+
 func (cf *changeFrontier) maybeEmitResolved(newResolved hlc.Timestamp) error {
-	if cf.freqEmitResolved == emitNoResolved || newResolved.IsEmpty() {
+	if newResolved.IsEmpty() {
+		return nil
+	}
+	if cf.freqEmitResolved == emitNoResolved {
+		// A draining changefeed always emits a final resolved timestamp once it
+		// reaches its end time so that a replacement changefeed knows where to
+		// pick up from.
+		if cf.drainBoundaryReached() {
+			return emitResolvedTimestamp(cf.Ctx(), cf.encoder, cf.sink, newResolved)
+		}
 		return nil
 	}
+	if cf.resolvedPerTable {
+		return cf.maybeEmitPerTableResolved()
+	}
+	if cf.resolvedTables != nil {
+		return cf.maybeEmitTableResolved(newResolved)
+	}
 	sinceEmitted := newResolved.GoTime().Sub(cf.lastEmitResolved)
 	shouldEmit := sinceEmitted >= cf.freqEmitResolved || cf.frontier.schemaChangeBoundaryReached()
 	if !shouldEmit {
 		return nil
 	}
+	// The digests are written before the resolved timestamp is emitted, so
+	// that they may be looked up once it's received.
+	if cf.contentDigestWriter != nil {
+		if err := cf.contentDigestWriter.write(cf.Ctx(), newResolved); err != nil {
+			return errors.Wrap(err, `writing content digests`)
+		}
+	}
 	if err := emitResolvedTimestamp(cf.Ctx(), cf.encoder, cf.sink, newResolved); err != nil {
 		return err
 	}
@@ -1401,6 +2083,52 @@ func (cf *changeFrontier) maybeEmitResolved(newResolved hlc.Timestamp) error {
 	return nil
 }
 
+// drainBoundaryReached returns true if the changefeed is draining and its
+// frontier has reached the end time set by CANCEL CHANGEFEED ... AT TIME.
+func (cf *changeFrontier) drainBoundaryReached() bool {
+	return cf.spec.Feed.Draining &&
+		cf.frontier.schemaChangeBoundaryReached() &&
+		cf.frontier.boundaryType == jobspb.ResolvedSpan_EXIT &&
+		!cf.spec.Feed.EndTime.Less(cf.frontier.boundaryTime)
+}
+
+// maybeEmitTableResolved emits the resolved timestamp to the topics of the
+// tables whose interval has elapsed since they were last sent one.
+func (cf *changeFrontier) maybeEmitTableResolved(newResolved hlc.Timestamp) error {
+	boundaryReached := cf.frontier.schemaChangeBoundaryReached()
+	var due []*tableResolvedInterval
+	for _, t := range cf.resolvedTables {
+		if boundaryReached || newResolved.GoTime().Sub(t.lastEmitted) >= t.freq {
+			due = append(due, t)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	sink, ok := cf.sink.(TargetResolvedTimestampSink)
+	if !ok {
+		return errors.AssertionFailedf(`sink does not support per table resolved timestamps`)
+	}
+	include := func(target changefeedbase.Target) bool {
+		for _, t := range due {
+			if t.matches(target) {
+				return true
+			}
+		}
+		return false
+	}
+	if err := sink.EmitResolvedTimestampForTargets(cf.Ctx(), cf.encoder, newResolved, include); err != nil {
+		return err
+	}
+	if log.V(2) {
+		log.Infof(cf.Ctx(), `resolved %s for %d tables`, newResolved, len(due))
+	}
+	for _, t := range due {
+		t.lastEmitted = newResolved.GoTime()
+	}
+	return nil
+}
+
 func (cf *changeFrontier) isBehind() bool {
 	frontier := cf.frontier.Frontier()
 	if frontier.IsEmpty() {
@@ -1650,9 +2378,9 @@ func (f *schemaChangeFrontier) schemaChangeBoundaryReached() (r bool) {
 // hasLaggingSpans returns true when the time between the earliest and latest
 // resolved spans has exceeded the configured HighwaterLagCheckpointThreshold
 func (f *schemaChangeFrontier) hasLaggingSpans(
-	defaultIfEmpty hlc.Timestamp, sv *settings.Values,
+	defaultIfEmpty hlc.Timestamp, sv *settings.Values, overrides changefeedbase.SettingsOverrides,
 ) bool {
-	lagThresholdNanos := int64(changefeedbase.FrontierHighwaterLagCheckpointThreshold.Get(sv))
+	lagThresholdNanos := int64(overrides.GetDuration(changefeedbase.FrontierHighwaterLagCheckpointThreshold, sv))
 	if lagThresholdNanos == 0 {
 		return false
 	}
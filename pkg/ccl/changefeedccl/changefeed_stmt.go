@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/backupccl/backupresolver"
@@ -26,10 +27,12 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/featureflag"
 	"github.com/cockroachdb/cockroach/pkg/jobs"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/protectedts"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/protectedts/ptpb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/server/status"
 	"github.com/cockroachdb/cockroach/pkg/server/telemetry"
 	"github.com/cockroachdb/cockroach/pkg/settings"
@@ -40,10 +43,12 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/exprutil"
 	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgnotice"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/asof"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/catconstants"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
 	"github.com/cockroachdb/cockroach/pkg/sql/sessiondatapb"
@@ -51,6 +56,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/log/eventpb"
+	"github.com/cockroachdb/cockroach/pkg/util/retry"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
@@ -89,12 +95,47 @@ func getChangefeedStatement(stmt tree.Statement) *annotatedChangefeedStatement {
 	case *annotatedChangefeedStatement:
 		return changefeed
 	case *tree.CreateChangefeed:
-		return &annotatedChangefeedStatement{CreateChangefeed: changefeed}
+		return &annotatedChangefeedStatement{CreateChangefeed: withNullSink(changefeed)}
 	default:
 		return nil
 	}
 }
 
+// nullSinkURI is the sink used by changefeeds created WITH dry_run or
+// sink='null'. The null sink discards every message while still recording
+// sink metrics.
+const nullSinkURI = changefeedbase.SinkSchemeNull + `://`
+
+// withNullSink returns the statement that should be planned for the given
+// CREATE CHANGEFEED. A dry run, or a changefeed selecting the null sink with
+// the sink option, without an INTO clause runs as a job emitting to the null
+// sink rather than as a sinkless changefeed. The value of the sink option,
+// which may not be known until it's evaluated, is validated with the other
+// options.
+func withNullSink(changefeed *tree.CreateChangefeed) *tree.CreateChangefeed {
+	if changefeed.SinkURI != nil {
+		return changefeed
+	}
+	for _, opt := range changefeed.Options {
+		switch opt.Key.Normalize() {
+		case changefeedbase.OptDryRun, changefeedbase.OptSink:
+			withSink := *changefeed
+			withSink.SinkURI = tree.NewDString(nullSinkURI)
+			return &withSink
+		}
+	}
+	return changefeed
+}
+
+// sinkURIExprs returns the sink expressions of a CREATE CHANGEFEED, which may
+// emit to multiple sinks.
+func sinkURIExprs(changefeed *tree.CreateChangefeed) tree.Exprs {
+	if t, ok := changefeed.SinkURI.(*tree.Tuple); ok {
+		return t.Exprs
+	}
+	return tree.Exprs{changefeed.SinkURI}
+}
+
 var (
 	sinklessHeader = colinfo.ResultColumns{
 		{Name: "table", Typ: types.String},
@@ -114,7 +155,7 @@ func changefeedTypeCheck(
 		return false, nil, nil
 	}
 	if err := exprutil.TypeCheck(ctx, `CREATE CHANGEFEED`, p.SemaCtx(),
-		exprutil.Strings{changefeedStmt.SinkURI},
+		exprutil.Strings(sinkURIExprs(changefeedStmt.CreateChangefeed)),
 		&exprutil.KVOptions{
 			KVOptions:  changefeedStmt.Options,
 			Validation: changefeedvalidators.CreateOptionValidations,
@@ -129,6 +170,16 @@ func changefeedTypeCheck(
 	return true, withSinkHeader, nil
 }
 
+// createsJobInTxn returns whether the job of the given CREATE CHANGEFEED is
+// created in the transaction of the statement, and started once it commits.
+// This is the case of changefeeds with a sink created in a transaction of
+// several statements, which may create the target tables of the changefeed as
+// well.
+func createsJobInTxn(p sql.PlanHookState, changefeedStmt *annotatedChangefeedStatement) bool {
+	return changefeedStmt.SinkURI != nil && changefeedStmt.CreatedByInfo == nil &&
+		changefeedStmt.alterChangefeedAsOf.IsEmpty() && !p.ExtendedEvalContext().TxnIsSingleStmt
+}
+
 // changefeedPlanHook implements sql.PlanHookFn.
 func changefeedPlanHook(
 	ctx context.Context, stmt tree.Statement, p sql.PlanHookState,
@@ -140,6 +191,7 @@ func changefeedPlanHook(
 
 	exprEval := p.ExprEvaluator("CREATE CHANGEFEED")
 	var sinkURI string
+	var additionalSinkURIs []string
 	unspecifiedSink := changefeedStmt.SinkURI == nil
 	avoidBuffering := unspecifiedSink
 	var header colinfo.ResultColumns
@@ -154,11 +206,17 @@ func changefeedPlanHook(
 		avoidBuffering = true
 		header = sinklessHeader
 	} else {
-		var err error
-		sinkURI, err = exprEval.String(ctx, changefeedStmt.SinkURI)
+		sinkURIs, err := exprEval.StringArray(ctx, sinkURIExprs(changefeedStmt.CreateChangefeed))
+		if err != nil {
+			return nil, nil, nil, false, changefeedbase.MarkTaggedError(err, changefeedbase.UserInput)
+		}
+		// Kafka sinks which mirror to other clusters emit to each of them as a
+		// separate sink.
+		sinkURIs, err = expandKafkaMirrors(sinkURIs)
 		if err != nil {
 			return nil, nil, nil, false, changefeedbase.MarkTaggedError(err, changefeedbase.UserInput)
 		}
+		sinkURI, additionalSinkURIs = sinkURIs[0], sinkURIs[1:]
 		header = withSinkHeader
 	}
 
@@ -183,6 +241,11 @@ func changefeedPlanHook(
 			// already sent the wrong result column headers.
 			return errors.New(`omit the SINK clause for inline results`)
 		}
+		for _, u := range additionalSinkURIs {
+			if u == `` {
+				return errors.New(`sink URIs must not be empty`)
+			}
+		}
 
 		opts := changefeedbase.MakeStatementOptions(rawOpts)
 
@@ -191,6 +254,7 @@ func changefeedPlanHook(
 			p,
 			changefeedStmt,
 			sinkURI,
+			additionalSinkURIs,
 			opts,
 			jobspb.InvalidJobID,
 			`changefeed.create`,
@@ -203,7 +267,9 @@ func changefeedPlanHook(
 		progress := jobspb.Progress{
 			Progress: &jobspb.Progress_HighWater{},
 			Details: &jobspb.Progress_Changefeed{
-				Changefeed: &jobspb.ChangefeedProgress{},
+				Changefeed: &jobspb.ChangefeedProgress{
+					Checkpoint: restoredCheckpoint(sourceCodec(p.ExecCfg().Codec, details.TenantID), details, opts),
+				},
 			},
 		}
 
@@ -224,8 +290,12 @@ func changefeedPlanHook(
 			telemetry.Count(`changefeed.create.core`)
 			logChangefeedCreateTelemetry(ctx, jr, changefeedStmt.Select != nil)
 
-			var err error
-			for r := getRetry(ctx); r.Next(); {
+			retryOpts, err := opts.GetRetryOptions()
+			if err != nil {
+				return err
+			}
+			for r := getRetry(ctx, retryOpts); r.Next(); {
+				startPos := positionOf(progress)
 				if err = distChangefeedFlow(ctx, p, 0 /* jobID */, details, progress, resultsCh); err == nil {
 					return nil
 				}
@@ -242,6 +312,15 @@ func changefeedPlanHook(
 
 				// All other errors retry.
 				progress = p.ExtendedEvalContext().ChangefeedState.(*coreChangefeedProgress).progress
+
+				// Sinkless changefeeds cannot be paused, so fail instead.
+				r.Failed(startPos.advancedTo(positionOf(progress)))
+				if r.Exhausted() {
+					err = errors.Wrapf(err, "giving up after %d consecutive retryable errors (%s=%d)",
+						retryOpts.MaxAttemptsBeforePause,
+						changefeedbase.OptRetryMaxAttemptsBeforePause, retryOpts.MaxAttemptsBeforePause)
+					break
+				}
 			}
 			// TODO(yevgeniy): This seems wrong -- core changefeeds always terminate
 			// with an error.  Perhaps rename this telemetry to indicate number of
@@ -263,7 +342,7 @@ func changefeedPlanHook(
 		jobID := p.ExecCfg().JobRegistry.MakeJobID()
 		{
 			var ptr *ptpb.Record
-			codec := p.ExecCfg().Codec
+			codec := sourceCodec(p.ExecCfg().Codec, details.TenantID)
 			ptr = createProtectedTimestampRecord(
 				ctx,
 				codec,
@@ -275,10 +354,16 @@ func changefeedPlanHook(
 
 			jr.Progress = *progress.GetChangefeed()
 
-			if changefeedStmt.CreatedByInfo != nil {
+			createdInTxn := createsJobInTxn(p, changefeedStmt)
+			if changefeedStmt.CreatedByInfo != nil || createdInTxn {
 				// This changefeed statement invoked by the scheduler.  As such, the scheduler
 				// must have specified transaction to use, and is responsible for committing
 				// transaction.
+				//
+				// Likewise, a changefeed created in a transaction of several
+				// statements, which may create its target tables, is created in
+				// that transaction, so that it is not created if the transaction
+				// aborts.
 
 				_, err := p.ExecCfg().JobRegistry.CreateAdoptableJobWithTxn(ctx, *jr, jobID, p.InternalSQLTxn())
 				if err != nil {
@@ -292,6 +377,16 @@ func changefeedPlanHook(
 					}
 				}
 
+				if createdInTxn {
+					// Start the job once the transaction commits rather than
+					// waiting for the registry to adopt it.
+					registry := p.ExecCfg().JobRegistry
+					p.Txn().AddCommitTrigger(func(ctx context.Context) {
+						registry.NotifyToResume(ctx, jobID)
+					})
+					logChangefeedCreateTelemetry(ctx, jr, changefeedStmt.Select != nil)
+				}
+
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
@@ -352,6 +447,7 @@ func createChangefeedJobRecord(
 	p sql.PlanHookState,
 	changefeedStmt *annotatedChangefeedStatement,
 	sinkURI string,
+	additionalSinkURIs []string,
 	opts changefeedbase.StatementOptions,
 	jobID jobspb.JobID,
 	telemetryPath string,
@@ -362,7 +458,8 @@ func createChangefeedJobRecord(
 		p.BufferClientNotice(ctx, pgnotice.Newf("%s", warning))
 	}
 
-	jobDescription, err := changefeedJobDescription(ctx, changefeedStmt.CreateChangefeed, sinkURI, opts)
+	jobDescription, err := changefeedJobDescription(
+		ctx, changefeedStmt.CreateChangefeed, sinkURI, additionalSinkURIs, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -370,6 +467,14 @@ func createChangefeedJobRecord(
 	statementTime := hlc.Timestamp{
 		WallTime: p.ExtendedEvalContext().GetStmtTimestamp().UnixNano(),
 	}
+	if createsJobInTxn(p, changefeedStmt) {
+		// The changefeed starts at the commit timestamp of the transaction
+		// creating it, so that the tables the transaction creates exist as of
+		// the statement time, and the rows it writes are part of the initial
+		// scan. This fixes the commit timestamp of the transaction, which
+		// restarts rather than being pushed.
+		statementTime = p.Txn().CommitTimestamp()
+	}
 	var initialHighWater hlc.Timestamp
 	evalTimestamp := func(s string) (hlc.Timestamp, error) {
 		if knobs, ok := p.ExecCfg().DistSQLSrv.TestingKnobs.Changefeed.(*TestingKnobs); ok {
@@ -391,6 +496,37 @@ func createChangefeedJobRecord(
 		}
 		statementTime = initialHighWater
 	}
+	generation := int64(1)
+	if restored, ok, err := opts.GetRestoreCheckpoint(); err != nil {
+		return nil, err
+	} else if ok {
+		// The changefeed resumes from the high-water of the changefeed which
+		// exported the checkpoint, as though it were a cursor or, if that
+		// changefeed had not completed its initial scan, performs the rest of
+		// the scan at the statement time of that changefeed. Either is checked
+		// as a cursor is, since the checkpoint may have been exported by
+		// another cluster.
+		restoredTime := restored.StatementTime
+		if !restored.HighWater.IsEmpty() {
+			restoredTime = restored.HighWater
+		}
+		asOf, err := p.EvalAsOfTimestamp(ctx, tree.AsOfClause{Expr: tree.NewStrVal(restoredTime.AsOfSystemTime())})
+		if err != nil {
+			return nil, errors.Wrapf(err, `invalid %s`, changefeedbase.OptRestoreCheckpoint)
+		}
+		statementTime = asOf.Timestamp
+		if !restored.HighWater.IsEmpty() {
+			initialHighWater = asOf.Timestamp
+		}
+		// The changefeed is the next generation of the changefeed which
+		// exported the checkpoint.
+		generation = feedGeneration(restored.Generation) + 1
+	}
+	for _, warning := range opts.LintWarnings(initialHighWater, hlc.Timestamp{
+		WallTime: p.ExtendedEvalContext().GetStmtTimestamp().UnixNano(),
+	}) {
+		p.BufferClientNotice(ctx, pgnotice.Newf("%s", warning))
+	}
 
 	checkPrivs := true
 	if !changefeedStmt.alterChangefeedAsOf.IsEmpty() {
@@ -406,6 +542,52 @@ func createChangefeedJobRecord(
 		checkPrivs = false
 	}
 
+	source, err := resolveSourceTenant(ctx, p, opts)
+	if err != nil {
+		return nil, err
+	}
+	if source.isSet() {
+		if changefeedStmt.Select != nil {
+			return nil, errors.Errorf(`%s cannot be used with CDC queries`, changefeedbase.OptTenant)
+		}
+		for _, t := range changefeedStmt.Targets {
+			if t.View {
+				return nil, errors.Errorf(`CHANGEFEED FOR VIEW cannot be used with %s`, changefeedbase.OptTenant)
+			}
+		}
+	}
+
+	if expanded, err := expandViewTarget(
+		ctx, p, changefeedStmt.CreateChangefeed, statementTime, initialHighWater,
+	); err != nil {
+		return nil, err
+	} else if expanded != changefeedStmt.CreateChangefeed {
+		viewStmt := *changefeedStmt
+		viewStmt.CreateChangefeed = expanded
+		changefeedStmt = &viewStmt
+	}
+
+	tableOnlyTargetList := tree.BackupTargetList{}
+	for _, t := range changefeedStmt.Targets {
+		tableOnlyTargetList.Tables.TablePatterns = append(tableOnlyTargetList.Tables.TablePatterns, t.TableName)
+	}
+
+	// This grabs table descriptors once to get their ids.
+	targetDescs, err := getTableDescriptors(ctx, p, source, &tableOnlyTargetList, statementTime, initialHighWater)
+	if err != nil {
+		return nil, err
+	}
+
+	if changefeedStmt.alterChangefeedAsOf.IsEmpty() {
+		// When altering a changefeed, the targets were already handled when
+		// the changefeed was created.
+		if err := handleSchemaChangesInProgress(
+			ctx, p, opts, source, &tableOnlyTargetList, targetDescs,
+		); err != nil {
+			return nil, err
+		}
+	}
+
 	endTime := hlc.Timestamp{}
 
 	if opts.HasEndTime() {
@@ -429,19 +611,12 @@ func createChangefeedJobRecord(
 		}
 	}
 
-	tableOnlyTargetList := tree.BackupTargetList{}
-	for _, t := range changefeedStmt.Targets {
-		tableOnlyTargetList.Tables.TablePatterns = append(tableOnlyTargetList.Tables.TablePatterns, t.TableName)
-	}
-
-	// This grabs table descriptors once to get their ids.
-	targetDescs, err := getTableDescriptors(ctx, p, &tableOnlyTargetList, statementTime, initialHighWater)
+	qualifiers, err := opts.GetTableNameQualifiers()
 	if err != nil {
 		return nil, err
 	}
-
-	targets, tables, err := getTargetsAndTables(ctx, p, targetDescs, changefeedStmt.Targets,
-		changefeedStmt.originalSpecs, opts.ShouldUseFullStatementTimeName(), sinkURI)
+	targets, tables, err := getTargetsAndTables(ctx, p, source, targetDescs, changefeedStmt.Targets,
+		changefeedStmt.originalSpecs, opts.ShouldUseFullStatementTimeName(), qualifiers, sinkURI)
 
 	if err != nil {
 		return nil, err
@@ -453,10 +628,13 @@ func createChangefeedJobRecord(
 	details := jobspb.ChangefeedDetails{
 		Tables:               tables,
 		SinkURI:              sinkURI,
+		AdditionalSinkURIs:   additionalSinkURIs,
 		StatementTime:        statementTime,
 		EndTime:              endTime,
 		TargetSpecifications: targets,
 		SessionData:          &sd.SessionData,
+		TenantID:             source.id,
+		Generation:           generation,
 	}
 
 	specs := AllTargets(details)
@@ -470,6 +648,30 @@ func createChangefeedJobRecord(
 			for _, warning := range changefeedvalidators.WarningsForTable(table, tolerances) {
 				p.BufferClientNotice(ctx, pgnotice.Newf("%s", warning))
 			}
+			if changefeedvalidators.IsAuditSystemTable(table) {
+				isAdmin, err := p.HasAdminRole(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if !isAdmin {
+					return nil, pgerror.Newf(pgcode.InsufficientPrivilege,
+						`only users with the admin role are allowed to create changefeeds on system tables`)
+				}
+			}
+			if opts.IsSet(changefeedbase.OptDeleteAfterEmit) {
+				if source.isSet() {
+					return nil, errors.Errorf(`%s cannot be used with the tables of another tenant`,
+						changefeedbase.OptDeleteAfterEmit)
+				}
+				if err := authorizeUserToDeleteEmittedRows(ctx, p, desc); err != nil {
+					return nil, err
+				}
+			}
+			if source.isSet() {
+				// The admin role in the system tenant, required to watch the tables
+				// of a secondary tenant, stands in for privileges on those tables.
+				continue
+			}
 
 			hasSelect, hasChangefeed, err := checkPrivilegesForDescriptor(ctx, p, desc)
 			if err != nil {
@@ -480,12 +682,37 @@ func createChangefeedJobRecord(
 		}
 	}
 	if checkPrivs {
-		if err := authorizeUserToCreateChangefeed(ctx, p, sinkURI, hasSelectPrivOnAllTables, hasChangefeedPrivOnAllTables); err != nil {
+		sinkURIs := append([]string{sinkURI}, additionalSinkURIs...)
+		if err := authorizeUserToCreateChangefeed(ctx, p, sinkURIs, hasSelectPrivOnAllTables, hasChangefeedPrivOnAllTables); err != nil {
+			return nil, err
+		}
+		if err := authorizeUserToUseSchemaRegistry(ctx, p, opts.AsMap()[changefeedbase.OptConfluentSchemaRegistry]); err != nil {
+			return nil, err
+		}
+		overrides, err := opts.GetSettingsOverrides()
+		if err != nil {
+			return nil, err
+		}
+		if err := authorizeUserToOverrideSettings(ctx, p, overrides); err != nil {
 			return nil, err
 		}
 	}
 
 	if changefeedStmt.Select != nil {
+		if opts.IsSet(changefeedbase.OptDeleteBeforeImage) {
+			return nil, errors.WithHint(
+				errors.Errorf(`%s cannot be used with CDC queries`, changefeedbase.OptDeleteBeforeImage),
+				`select cdc_prev to include the previous row`)
+		}
+		for _, desc := range targetDescs {
+			// The expression is planned in a transaction of its own, which cannot
+			// read the uncommitted descriptors of this one.
+			if desc.IsUncommittedVersion() {
+				return nil, errors.Errorf(
+					`CDC queries cannot target table %s, which was created or altered in the same transaction`,
+					desc.GetName())
+			}
+		}
 		// Serialize changefeed expression.
 		normalized, withDiff, err := validateAndNormalizeChangefeedExpression(
 			ctx, p, opts, changefeedStmt.Select, targetDescs, targets, statementTime,
@@ -561,14 +788,49 @@ func createChangefeedJobRecord(
 	if err = validateDetailsAndOptions(details, opts); err != nil {
 		return nil, err
 	}
+	if name := opts.GetDeadLetterTable(); name != `` {
+		if details.DeadLetterTableID, err = resolveDeadLetterTable(ctx, p, name); err != nil {
+			return nil, err
+		}
+	}
+	if name := opts.GetContentDigestTable(); name != `` {
+		if details.ContentDigestTableID, err = resolveContentDigestTable(ctx, p, name); err != nil {
+			return nil, err
+		}
+	}
 
 	encodingOpts, err := opts.GetEncodingOptions()
 	if err != nil {
 		return nil, err
 	}
-	if _, err := getEncoder(encodingOpts, AllTargets(details)); err != nil {
+	if err := resolveSchemaRegistryURI(ctx, p.ExecCfg().InternalDB, &encodingOpts); err != nil {
 		return nil, err
 	}
+	if _, err := getEncoder(encodingOpts, AllTargets(details), schemaRegistryForSinkURI(sinkURI)); err != nil {
+		return nil, err
+	}
+
+	if err := validateFanOutSinkURIs(sinkURI, additionalSinkURIs); err != nil {
+		return nil, err
+	}
+
+	if opts.IsSet(changefeedbase.OptDryRun) && len(additionalSinkURIs) > 0 {
+		return nil, errors.WithHintf(
+			errors.Newf(`%s cannot be used with multiple sinks`, changefeedbase.OptDryRun),
+			`omit the INTO clause to run a dry run`)
+	}
+	if opts.IsSet(changefeedbase.OptDryRun) && parsedSink.Scheme != changefeedbase.SinkSchemeNull {
+		return nil, errors.WithHintf(
+			errors.Newf(`%s discards all messages and cannot be used with sink %s`,
+				changefeedbase.OptDryRun, parsedSink.Scheme),
+			`omit the INTO clause to run a dry run`)
+	}
+	if opts.IsSet(changefeedbase.OptSink) &&
+		(len(additionalSinkURIs) > 0 || parsedSink.Scheme != changefeedbase.SinkSchemeNull) {
+		return nil, errors.WithHintf(
+			errors.Newf(`%s cannot be used with an INTO clause`, changefeedbase.OptSink),
+			`omit the INTO clause to select the sink with the %s option`, changefeedbase.OptSink)
+	}
 
 	if !unspecifiedSink && p.ExecCfg().ExternalIODirConfig.DisableOutbound {
 		return nil, errors.Errorf("Outbound IO is disabled by configuration, cannot create changefeed into %s", parsedSink.Scheme)
@@ -581,6 +843,14 @@ func createChangefeedJobRecord(
 			telemetrySink = `sinkless`
 		}
 		telemetry.Count(telemetryPath + `.sink.` + telemetrySink)
+		for _, u := range additionalSinkURIs {
+			if additionalSink, err := url.Parse(u); err == nil {
+				telemetry.Count(telemetryPath + `.sink.` + additionalSink.Scheme)
+			}
+		}
+		if len(additionalSinkURIs) > 0 {
+			telemetry.Count(telemetryPath + `.fan_out`)
+		}
 		telemetry.Count(telemetryPath + `.format.` + string(encodingOpts.Format))
 		telemetry.CountBucketed(telemetryPath+`.num_tables`, int64(len(tables)))
 	}
@@ -659,6 +929,14 @@ func createChangefeedJobRecord(
 	if err != nil {
 		return nil, err
 	}
+	ptsExpirationAction, err := opts.GetPTSExpirationAction()
+	if err != nil {
+		return nil, err
+	}
+	if opts.IsSet(changefeedbase.OptPTSExpirationAction) && ptsExpiration == 0 {
+		return nil, errors.Errorf(`%s requires %s to be set`,
+			changefeedbase.OptPTSExpirationAction, changefeedbase.OptExpirePTSAfter)
+	}
 
 	if ptsExpiration > 0 && ptsExpiration < time.Hour {
 		// This threshold is rather arbitrary.  But we want to warn users about
@@ -677,14 +955,19 @@ func createChangefeedJobRecord(
 		Description: jobDescription,
 		Username:    p.User(),
 		DescriptorIDs: func() (sqlDescIDs []descpb.ID) {
+			if source.isSet() {
+				// The IDs of the targets refer to descriptors of another tenant.
+				return nil
+			}
 			for _, desc := range targetDescs {
 				sqlDescIDs = append(sqlDescIDs, desc.GetID())
 			}
 			return sqlDescIDs
 		}(),
-		Details:       details,
-		CreatedBy:     changefeedStmt.CreatedByInfo,
-		MaximumPTSAge: ptsExpiration,
+		Details:                details,
+		CreatedBy:              changefeedStmt.CreatedByInfo,
+		MaximumPTSAge:          ptsExpiration,
+		ReleasePTSOnExpiration: ptsExpirationAction == changefeedbase.OptPTSExpirationActionRelease,
 	}
 
 	return jr, nil
@@ -713,6 +996,7 @@ func validateSettings(ctx context.Context, p sql.PlanHookState) error {
 func getTableDescriptors(
 	ctx context.Context,
 	p sql.PlanHookState,
+	source sourceTenant,
 	targets *tree.BackupTargetList,
 	statementTime hlc.Timestamp,
 	initialHighWater hlc.Timestamp,
@@ -734,7 +1018,15 @@ func getTableDescriptors(
 		}
 	}
 
-	_, _, _, targetDescs, err := backupresolver.ResolveTargetsToDescriptors(ctx, p, statementTime, targets)
+	var targetDescs map[tree.TablePattern]catalog.Descriptor
+	var err error
+	if source.isSet() {
+		targetDescs, err = resolveSourceTenantTargets(ctx, p.ExecCfg(), source, targets, statementTime)
+	} else if resolvesInTxn(p, statementTime) {
+		targetDescs, err = resolveTargetsInTxn(ctx, p, targets, statementTime)
+	} else {
+		_, _, _, targetDescs, err = backupresolver.ResolveTargetsToDescriptors(ctx, p, statementTime, targets)
+	}
 	if err != nil {
 		var m *backupresolver.MissingTableErr
 		if errors.As(err, &m) {
@@ -752,18 +1044,133 @@ func getTableDescriptors(
 	return targetDescs, err
 }
 
+// resolvesInTxn returns whether the descriptors as of statementTime are those
+// of the transaction of p, which is the case if it is the fixed commit
+// timestamp of the transaction. The transaction may have created or altered
+// the descriptors, whose intents could not be read by another transaction.
+func resolvesInTxn(p sql.PlanHookState, statementTime hlc.Timestamp) bool {
+	return p.Txn().CommitTimestampFixed() && statementTime == p.Txn().CommitTimestamp()
+}
+
+// resolveTargetsInTxn resolves targets to the descriptors of the transaction
+// of p, including those it created.
+func resolveTargetsInTxn(
+	ctx context.Context,
+	p sql.PlanHookState,
+	targets *tree.BackupTargetList,
+	statementTime hlc.Timestamp,
+) (map[tree.TablePattern]catalog.Descriptor, error) {
+	all, err := p.InternalSQLTxn().Descriptors().GetAllDescriptors(ctx, p.Txn())
+	if err != nil {
+		return nil, err
+	}
+	matched, err := backupresolver.DescriptorsMatchingTargets(ctx,
+		p.CurrentDatabase(), p.CurrentSearchPath(), all.OrderedDescriptors(), *targets, statementTime)
+	if err != nil {
+		return nil, err
+	}
+	return matched.DescsByTablePattern, nil
+}
+
+// handleSchemaChangesInProgress applies the schema_change_in_progress option
+// to target tables which have a schema change in progress at the statement
+// time. The changefeed starts from the statement time regardless, so waiting
+// only delays its creation until the schema changes have completed.
+func handleSchemaChangesInProgress(
+	ctx context.Context,
+	p sql.PlanHookState,
+	opts changefeedbase.StatementOptions,
+	source sourceTenant,
+	targets *tree.BackupTargetList,
+	targetDescs map[tree.TablePattern]catalog.Descriptor,
+) error {
+	policy, err := opts.GetSchemaChangeInProgressPolicy()
+	if err != nil {
+		return err
+	}
+	changing := tablesWithSchemaChangesInProgress(targetDescs)
+	if len(changing) == 0 {
+		return nil
+	}
+
+	switch policy {
+	case changefeedbase.OptSchemaChangeInProgressError:
+		return errors.WithHintf(
+			pgerror.Newf(pgcode.ObjectNotInPrerequisiteState,
+				`CHANGEFEED target %s has a schema change in progress`, strings.Join(changing, `, `)),
+			`retry once the schema change completes, or specify %s=%s to wait for it`,
+			changefeedbase.OptSchemaChangeInProgress, changefeedbase.OptSchemaChangeInProgressWait)
+	case changefeedbase.OptSchemaChangeInProgressProceed:
+		p.BufferClientNotice(ctx, pgnotice.Newf(
+			`%s has a schema change in progress; the changefeed will start from the version `+
+				`before the schema change, and handle the change according to %s once it completes`,
+			strings.Join(changing, `, `), changefeedbase.OptSchemaChangePolicy))
+		return nil
+	}
+
+	// The notice is sent rather than buffered, since buffered notices only
+	// reach the client once the statement completes.
+	if err := p.SendClientNotice(ctx, pgnotice.Newf(
+		`waiting for the schema change in progress on %s to complete`, strings.Join(changing, `, `)),
+	); err != nil {
+		return err
+	}
+	maxWait := changefeedbase.SchemaChangeInProgressMaxWait.Get(&p.ExecCfg().Settings.SV)
+	waitCtx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+	opt := retry.Options{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second}
+	for r := retry.StartWithCtx(waitCtx, opt); r.Next(); {
+		// The targets are read as of now, since they remain unchanged as of
+		// the statement time.
+		current, err := getTableDescriptors(waitCtx, p, source, targets, p.ExecCfg().Clock.Now(), hlc.Timestamp{})
+		if err != nil {
+			return err
+		}
+		if len(tablesWithSchemaChangesInProgress(current)) == 0 {
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.WithHintf(
+		pgerror.Newf(pgcode.ObjectNotInPrerequisiteState,
+			`schema change in progress on %s did not complete within %s`,
+			strings.Join(changing, `, `), maxWait),
+		`retry once the schema change completes, or raise %s`,
+		changefeedbase.SchemaChangeInProgressMaxWait.Key())
+}
+
+// tablesWithSchemaChangesInProgress returns the names of the target tables
+// which have a schema change in progress.
+func tablesWithSchemaChangesInProgress(
+	targetDescs map[tree.TablePattern]catalog.Descriptor,
+) []string {
+	var names []string
+	for _, desc := range targetDescs {
+		if table, ok := desc.(catalog.TableDescriptor); ok && table.HasConcurrentSchemaChanges() {
+			names = append(names, table.GetName())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func getTargetsAndTables(
 	ctx context.Context,
 	p sql.PlanHookState,
+	source sourceTenant,
 	targetDescs map[tree.TablePattern]catalog.Descriptor,
 	rawTargets tree.ChangefeedTargets,
 	originalSpecs map[tree.ChangefeedTarget]jobspb.ChangefeedTargetSpecification,
 	fullTableName bool,
+	qualifiers changefeedbase.TableNameQualifiers,
 	sinkURI string,
 ) ([]jobspb.ChangefeedTargetSpecification, jobspb.ChangefeedTargets, error) {
 	tables := make(jobspb.ChangefeedTargets, len(targetDescs))
 	targets := make([]jobspb.ChangefeedTargetSpecification, len(rawTargets))
 	seen := make(map[jobspb.ChangefeedTargetSpecification]tree.ChangefeedTarget)
+	byTable := make(map[descpb.ID]tree.ChangefeedTarget, len(rawTargets))
 
 	for i, ct := range rawTargets {
 		desc, ok := targetDescs[ct.TableName]
@@ -774,7 +1181,40 @@ func getTargetsAndTables(
 		if !ok {
 			return nil, nil, errors.Errorf(`CHANGEFEED cannot target %s`, tree.AsString(&ct))
 		}
+		if td.IsSequence() && !ct.Sequence {
+			return nil, nil, errors.WithHint(
+				errors.Errorf(`CHANGEFEED cannot target sequences: %s`, td.GetName()),
+				`use CHANGEFEED FOR SEQUENCE to watch a sequence`)
+		}
+		if ct.Sequence && !td.IsSequence() {
+			return nil, nil, errors.Errorf(`CHANGEFEED cannot target %s: %q is not a sequence`,
+				tree.AsString(&ct), td.GetName())
+		}
+		if td.IsView() && !td.MaterializedView() {
+			return nil, nil, errors.WithHint(
+				errors.Errorf(`CHANGEFEED cannot target views: %s`, td.GetName()),
+				`use CHANGEFEED FOR VIEW to watch a view`)
+		}
+		var index catalog.Index
+		if ct.IndexName != "" {
+			var err error
+			if index, err = findTargetIndex(td, string(ct.IndexName)); err != nil {
+				return nil, nil, err
+			}
+		}
+		// Index targets share the keys of their table's spans with any other
+		// target of the table, which would watch another index.
+		if other, ok := byTable[td.GetID()]; ok && (other.IndexName != "" || ct.IndexName != "") {
+			return nil, nil, errors.Errorf(
+				"CHANGEFEED cannot target both %s and %s: an index must be the only target of its table",
+				tree.AsString(&other), tree.AsString(&ct))
+		}
+		byTable[td.GetID()] = ct
 
+		qualifiedName, err := getQualifiedTableName(ctx, p.ExecCfg(), source.id, p.Txn(), td)
+		if err != nil {
+			return nil, nil, err
+		}
 		if spec, ok := originalSpecs[ct]; ok {
 			targets[i] = spec
 			if table, ok := tables[td.GetID()]; ok {
@@ -786,11 +1226,12 @@ func getTargetsAndTables(
 			} else {
 				tables[td.GetID()] = jobspb.ChangefeedTargetTable{
 					StatementTimeName: spec.StatementTimeName,
+					QualifiedName:     qualifiedName,
 				}
 			}
 		} else {
 
-			name, err := getChangefeedTargetName(ctx, td, p.ExecCfg(), p.Txn(), fullTableName)
+			name, err := getChangefeedTargetName(ctx, td, p.ExecCfg(), source, p.Txn(), fullTableName, qualifiers)
 
 			if err != nil {
 				return nil, nil, err
@@ -798,6 +1239,7 @@ func getTargetsAndTables(
 
 			tables[td.GetID()] = jobspb.ChangefeedTargetTable{
 				StatementTimeName: name,
+				QualifiedName:     qualifiedName,
 			}
 			typ := jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY
 			if ct.FamilyName != "" {
@@ -807,11 +1249,17 @@ func getTargetsAndTables(
 					typ = jobspb.ChangefeedTargetSpecification_EACH_FAMILY
 				}
 			}
+			var indexID descpb.IndexID
+			if index != nil {
+				typ = jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX
+				indexID = index.GetID()
+			}
 			targets[i] = jobspb.ChangefeedTargetSpecification{
 				Type:              typ,
 				TableID:           td.GetID(),
 				FamilyName:        string(ct.FamilyName),
 				StatementTimeName: tables[td.GetID()].StatementTimeName,
+				IndexID:           indexID,
 			}
 		}
 		if dup, isDup := seen[targets[i]]; isDup {
@@ -826,6 +1274,165 @@ func getTargetsAndTables(
 	return targets, tables, nil
 }
 
+// findTargetIndex returns the secondary index of the table watched by an index
+// target. Only forward indexes whose entries are each encoded in a single key
+// may be watched, so that each entry is emitted as a single message.
+func findTargetIndex(td catalog.TableDescriptor, name string) (catalog.Index, error) {
+	index := catalog.FindPublicNonPrimaryIndex(td, func(idx catalog.Index) bool {
+		return idx.GetName() == name
+	})
+	if index == nil {
+		if td.GetPrimaryIndex().GetName() == name {
+			return nil, errors.WithHintf(
+				errors.Errorf(`CHANGEFEED cannot target primary index %s of table %s`, name, td.GetName()),
+				`use CHANGEFEED FOR TABLE %s to watch the primary index`, td.GetName())
+		}
+		return nil, pgerror.Newf(pgcode.UndefinedObject,
+			`index %q not found on table %s`, name, td.GetName())
+	}
+	if index.GetType() != descpb.IndexDescriptor_FORWARD {
+		return nil, errors.Errorf(`CHANGEFEED cannot target index %s: only forward indexes are supported`, name)
+	}
+	if td.NumFamilies() > 1 && index.NumSecondaryStoredColumns() > 0 {
+		return nil, errors.Errorf(`CHANGEFEED cannot target index %s: `+
+			`indexes storing columns of tables with multiple column families are not supported`, name)
+	}
+	return index, nil
+}
+
+// expandViewTarget rewrites a CHANGEFEED FOR VIEW into a changefeed on the
+// table underlying the view, with the query of the view as its CDC
+// expression, so that the changefeed emits rows in the shape of the view.
+// Only views which select from a single table may be watched. Statements
+// without a view target are returned unchanged.
+func expandViewTarget(
+	ctx context.Context,
+	p sql.PlanHookState,
+	stmt *tree.CreateChangefeed,
+	statementTime hlc.Timestamp,
+	initialHighWater hlc.Timestamp,
+) (*tree.CreateChangefeed, error) {
+	var view *tree.ChangefeedTarget
+	for i := range stmt.Targets {
+		if stmt.Targets[i].View {
+			view = &stmt.Targets[i]
+		}
+	}
+	if view == nil {
+		return stmt, nil
+	}
+	if len(stmt.Targets) > 1 {
+		return nil, errors.Errorf(`CHANGEFEED FOR VIEW cannot watch other tables or views`)
+	}
+
+	viewTargetList := tree.BackupTargetList{}
+	viewTargetList.Tables.TablePatterns = tree.TablePatterns{view.TableName}
+	descs, err := getTableDescriptors(ctx, p, sourceTenant{}, &viewTargetList, statementTime, initialHighWater)
+	if err != nil {
+		return nil, err
+	}
+	td, ok := descs[view.TableName].(catalog.TableDescriptor)
+	if !ok || !td.IsView() {
+		return nil, errors.Errorf(`CHANGEFEED cannot target %s: not a view`, tree.AsString(view))
+	}
+	if td.MaterializedView() {
+		return nil, errors.Errorf(`CHANGEFEED cannot target materialized views: %s`, td.GetName())
+	}
+
+	unsupported := errors.WithHint(
+		errors.Errorf(`CHANGEFEED cannot target view %s: only views selecting from a single table are supported`,
+			td.GetName()),
+		`use CREATE CHANGEFEED ... AS SELECT to watch the underlying tables`)
+	parsed, err := parser.ParseOne(td.GetViewQuery())
+	if err != nil {
+		return nil, errors.Wrapf(err, `parsing query of view %s`, td.GetName())
+	}
+	sel, ok := parsed.AST.(*tree.Select)
+	if !ok {
+		return nil, unsupported
+	}
+	for {
+		if sel.With != nil || sel.OrderBy != nil || sel.Limit != nil {
+			return nil, unsupported
+		}
+		paren, ok := sel.Select.(*tree.ParenSelect)
+		if !ok {
+			break
+		}
+		sel = paren.Select
+	}
+	clause, ok := sel.Select.(*tree.SelectClause)
+	if !ok || len(clause.From.Tables) != 1 {
+		return nil, unsupported
+	}
+	target, err := tree.ChangefeedTargetFromTableExpr(clause.From.Tables[0])
+	if err != nil {
+		return nil, unsupported
+	}
+
+	// The columns of a view may be renamed by CREATE VIEW v (x, y) AS ...,
+	// in which case its query doesn't name them.
+	if cols := td.PublicColumns(); len(cols) == len(clause.Exprs) && !hasStar(clause.Exprs) {
+		for i := range clause.Exprs {
+			clause.Exprs[i].As = tree.UnrestrictedName(cols[i].GetName())
+		}
+	}
+
+	expanded := *stmt
+	expanded.Targets = tree.ChangefeedTargets{target}
+	expanded.Select = clause
+	return &expanded, nil
+}
+
+// hasStar returns whether any of the expressions is a star, which expands to
+// an unknown number of columns.
+func hasStar(exprs tree.SelectExprs) bool {
+	for _, e := range exprs {
+		switch e.Expr.(type) {
+		case tree.UnqualifiedStar, *tree.AllColumnsSelector:
+			return true
+		}
+	}
+	return false
+}
+
+// validateResolvedTableIntervals checks that per table resolved intervals, if
+// any, are supported by the sink and name targets of the changefeed, as well
+// as that the sink supports the resolved_per_table option if it's set.
+func validateResolvedTableIntervals(
+	sink Sink, details jobspb.ChangefeedDetails, opts changefeedbase.StatementOptions,
+) error {
+	if opts.IsSet(changefeedbase.OptResolvedPerTable) && !canEmitResolvedTimestampForTargets(sink) {
+		return errors.Errorf(`%s is not supported by this sink`, changefeedbase.OptResolvedPerTable)
+	}
+	tables, err := opts.GetResolvedTimestampTableIntervals()
+	if err != nil || tables == nil {
+		return err
+	}
+	if opts.IsSet(changefeedbase.OptContentDigestTable) {
+		return errors.Errorf(`%s cannot be used with per table %s intervals`,
+			changefeedbase.OptContentDigestTable, changefeedbase.OptResolvedTimestamps)
+	}
+	if !canEmitResolvedTimestampForTargets(sink) {
+		return errors.Errorf(`per table %s intervals are not supported by this sink`,
+			changefeedbase.OptResolvedTimestamps)
+	}
+	targets := AllTargets(details)
+	for table, freq := range tables {
+		interval := tableResolvedInterval{table: table, freq: freq}
+		var found bool
+		_ = targets.EachTarget(func(t changefeedbase.Target) error {
+			found = found || interval.matches(t)
+			return nil
+		})
+		if !found {
+			return errors.Errorf(`option %s names %s, which is not a target of the changefeed`,
+				changefeedbase.OptResolvedTimestamps, table)
+		}
+	}
+	return nil
+}
+
 func validateSink(
 	ctx context.Context,
 	p sql.PlanHookState,
@@ -845,6 +1452,19 @@ func validateSink(
 	if err != nil {
 		return err
 	}
+	if f, ok := canarySink.(*fanOutSink); ok {
+		// Sinks which may be isolated while the changefeed runs must still be
+		// reachable when it is created.
+		if err := f.isolationError(); err != nil {
+			return errors.CombineErrors(err, canarySink.Close())
+		}
+	}
+	if err := validateResolvedTableIntervals(canarySink, details, opts); err != nil {
+		return errors.CombineErrors(err, canarySink.Close())
+	}
+	if err := validateCloudStorageRetention(details.SinkURI, opts); err != nil {
+		return errors.CombineErrors(err, canarySink.Close())
+	}
 	if err := canarySink.Close(); err != nil {
 		return err
 	}
@@ -879,9 +1499,50 @@ func validateSink(
 	return nil
 }
 
+// restoredCheckpoint returns the spans of the checkpoint which the changefeed
+// resumes from, if any. Spans outside of the tables watched by the changefeed,
+// such as those of tables restored with new IDs, are dropped, leaving the
+// changefeed to catch up on them from its high-water or statement time.
+func restoredCheckpoint(
+	codec keys.SQLCodec, details jobspb.ChangefeedDetails, opts changefeedbase.StatementOptions,
+) *jobspb.ChangefeedProgress_Checkpoint {
+	restored, ok, err := opts.GetRestoreCheckpoint()
+	if err != nil || !ok || len(restored.Checkpoint.Spans) == 0 {
+		return nil
+	}
+	var tableSpans roachpb.SpanGroup
+	_ = AllTargets(details).EachTableID(func(id descpb.ID) error {
+		prefix := codec.TablePrefix(uint32(id))
+		tableSpans.Add(roachpb.Span{Key: prefix, EndKey: prefix.PrefixEnd()})
+		return nil
+	})
+	checkpoint := &jobspb.ChangefeedProgress_Checkpoint{Timestamp: restored.Checkpoint.Timestamp}
+	for _, sp := range restored.Checkpoint.Spans {
+		if tableSpans.Encloses(sp) {
+			checkpoint.Spans = append(checkpoint.Spans, sp)
+		}
+	}
+	if len(checkpoint.Spans) == 0 {
+		return nil
+	}
+	return checkpoint
+}
+
 func requiresKeyInValue(s Sink) bool {
+	if f, ok := s.(*fanOutSink); ok {
+		for _, c := range f.sinks {
+			if c.sink != nil && requiresKeyInValue(c.sink) {
+				return true
+			}
+		}
+		return false
+	}
 	switch s.getConcreteType() {
-	case sinkTypeCloudstorage, sinkTypeWebhook:
+	case sinkTypeCloudstorage:
+		// TODO: Avro does not support key_in_value yet, so deleted keys are
+		// not recoverable from avro files.
+		return schemaRegistryForSink(s) == nil
+	case sinkTypeWebhook:
 		return true
 	default:
 		return false
@@ -889,6 +1550,14 @@ func requiresKeyInValue(s Sink) bool {
 }
 
 func requiresTopicInValue(s Sink) bool {
+	if f, ok := s.(*fanOutSink); ok {
+		for _, c := range f.sinks {
+			if c.sink != nil && requiresTopicInValue(c.sink) {
+				return true
+			}
+		}
+		return false
+	}
 	return s.getConcreteType() == sinkTypeWebhook
 }
 
@@ -896,30 +1565,34 @@ func changefeedJobDescription(
 	ctx context.Context,
 	changefeed *tree.CreateChangefeed,
 	sinkURI string,
+	additionalSinkURIs []string,
 	opts changefeedbase.StatementOptions,
 ) (string, error) {
-	cleanedSinkURI, err := cloud.SanitizeExternalStorageURI(sinkURI, []string{
-		changefeedbase.SinkParamSASLPassword,
-		changefeedbase.SinkParamCACert,
-		changefeedbase.SinkParamClientCert,
-	})
-	if err != nil {
-		return "", err
-	}
+	var sinkExprs tree.Exprs
+	for _, u := range append([]string{sinkURI}, additionalSinkURIs...) {
+		cleanedSinkURI, err := cloud.SanitizeExternalStorageURI(u, changefeedbase.RedactedSinkParams)
+		if err != nil {
+			return "", err
+		}
 
-	cleanedSinkURI, err = changefeedbase.RedactUserFromURI(cleanedSinkURI)
-	if err != nil {
-		return "", err
-	}
+		cleanedSinkURI, err = changefeedbase.RedactUserFromURI(cleanedSinkURI)
+		if err != nil {
+			return "", err
+		}
 
-	logSanitizedChangefeedDestination(ctx, cleanedSinkURI)
+		logSanitizedChangefeedDestination(ctx, cleanedSinkURI)
+		sinkExprs = append(sinkExprs, tree.NewDString(cleanedSinkURI))
+	}
 
 	c := &tree.CreateChangefeed{
 		Targets: changefeed.Targets,
-		SinkURI: tree.NewDString(cleanedSinkURI),
+		SinkURI: sinkExprs[0],
 		Select:  changefeed.Select,
 	}
-	if err = opts.ForEachWithRedaction(func(k string, v string) {
+	if len(sinkExprs) > 1 {
+		c.SinkURI = &tree.Tuple{Exprs: sinkExprs}
+	}
+	if err := opts.ForEachWithRedaction(func(k string, v string) {
 		opt := tree.KVOption{Key: tree.Name(k)}
 		if len(v) > 0 {
 			opt.Value = tree.NewDString(v)
@@ -970,6 +1643,96 @@ func validateDetailsAndOptions(
 			}
 		}
 	}
+	if opts.IsSet(changefeedbase.OptDeleteAfterEmit) {
+		if details.SinkURI == `` {
+			return errors.Errorf(`%s requires a sink`, changefeedbase.OptDeleteAfterEmit)
+		}
+		if details.Select != `` {
+			return errors.Errorf(`%s cannot be used with CDC queries, which may not emit every row`,
+				changefeedbase.OptDeleteAfterEmit)
+		}
+		for _, ts := range details.TargetSpecifications {
+			if ts.Type == jobspb.ChangefeedTargetSpecification_COLUMN_FAMILY {
+				return errors.Errorf(`%s cannot be used with column family targets, `+
+					`as deleting a row deletes its other families`, changefeedbase.OptDeleteAfterEmit)
+			}
+			if ts.Type == jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX {
+				return errors.Errorf(`%s cannot be used with index targets, `+
+					`whose messages aren't keyed by the primary key of their rows`, changefeedbase.OptDeleteAfterEmit)
+			}
+		}
+	}
+	if opts.IsSet(changefeedbase.OptCoalesceWindow) && details.SinkURI == `` {
+		return errors.Errorf(`%s requires a sink`, changefeedbase.OptCoalesceWindow)
+	}
+	for _, o := range []string{changefeedbase.OptDeadLetterTable, changefeedbase.OptContentDigestTable} {
+		if !opts.IsSet(o) {
+			continue
+		}
+		if details.SinkURI == `` {
+			return errors.Errorf(`%s requires a sink`, o)
+		}
+		if details.TenantID.IsSet() {
+			return errors.Errorf(`%s cannot be used with the tables of another tenant`, o)
+		}
+	}
+	if err := validateOnCompletion(details, opts); err != nil {
+		return err
+	}
+	return validateOnTruncate(details, opts)
+}
+
+// validateOnCompletion validates the on_completion option, which is only
+// usable by changefeeds which complete.
+func validateOnCompletion(
+	details jobspb.ChangefeedDetails, opts changefeedbase.StatementOptions,
+) error {
+	action, err := opts.GetOnCompletion()
+	if err != nil || action == changefeedbase.OptOnCompletionNoop {
+		return err
+	}
+	scanType, err := opts.GetInitialScanType()
+	if err != nil {
+		return err
+	}
+	if scanType != changefeedbase.OnlyInitialScan && !opts.HasEndTime() {
+		return errors.Errorf(`%s=%s requires %s or %s`, changefeedbase.OptOnCompletion, action,
+			changefeedbase.OptInitialScanOnly, changefeedbase.OptEndTime)
+	}
+	if action == changefeedbase.OptOnCompletionEmitEOF {
+		encodingOpts, err := opts.GetEncodingOptions()
+		if err != nil {
+			return err
+		}
+		if encodingOpts.Format != changefeedbase.OptFormatJSON {
+			return errors.Errorf(`%s=%s is only usable with %s=%s`, changefeedbase.OptOnCompletion,
+				action, changefeedbase.OptFormat, changefeedbase.OptFormatJSON)
+		}
+	}
+	u, err := url.Parse(details.SinkURI)
+	if err != nil {
+		return err
+	}
+	// Only kafka sinks emit to, or delete, the topics of some targets. The
+	// sinks of external connections are checked once they are built, when
+	// the changefeed completes.
+	if u.Scheme != changefeedbase.SinkSchemeKafka &&
+		u.Scheme != changefeedbase.SinkSchemeExternalConnection {
+		return errors.Errorf(`%s=%s is only usable with kafka sinks`,
+			changefeedbase.OptOnCompletion, action)
+	}
+	if action == changefeedbase.OptOnCompletionDeleteTopics && u.Scheme == changefeedbase.SinkSchemeKafka {
+		// Topics are deleted only if the changefeed created them, which it
+		// only does under auto_create_topics. Require it, rather than let the
+		// option silently do nothing.
+		var autoCreate bool
+		_, err := strToBool(u.Query().Get(changefeedbase.SinkParamAutoCreateTopics), &autoCreate)
+		if err != nil || !autoCreate {
+			return errors.Errorf(`%s=%s requires the sink parameter %s=true, since only the `+
+				`topics created by the changefeed are deleted`, changefeedbase.OptOnCompletion,
+				action, changefeedbase.SinkParamAutoCreateTopics)
+		}
+	}
 	return nil
 }
 
@@ -1024,6 +1787,33 @@ func (b *changefeedResumer) setJobRunningStatus(
 	return timeutil.Now()
 }
 
+// setJobRetryableError records a retryable error, and its class, in the running
+// status and progress of the job. Like setJobRunningStatus, the job is updated
+// at most once per runStatusUpdateFrequency.
+func (b *changefeedResumer) setJobRetryableError(
+	ctx context.Context, lastUpdate time.Time, errorClass changefeedbase.ErrorClass, err error,
+) time.Time {
+	if timeutil.Since(lastUpdate) < runStatusUpdateFrequency {
+		return lastUpdate
+	}
+
+	if err := b.job.NoTxn().Update(ctx, func(
+		txn isql.Txn, md jobs.JobMetadata, ju *jobs.JobUpdater,
+	) error {
+		if err := md.CheckRunningOrReverting(); err != nil {
+			return err
+		}
+		md.Progress.RunningStatus = fmt.Sprintf("retryable %s error: %s", errorClass, err)
+		md.Progress.GetChangefeed().RetryableErrorClass = errorClass
+		ju.UpdateProgress(md.Progress)
+		return nil
+	}); err != nil {
+		log.Warningf(ctx, "failed to set running status: %v", err)
+	}
+
+	return timeutil.Now()
+}
+
 // Resume is part of the jobs.Resumer interface.
 func (b *changefeedResumer) Resume(ctx context.Context, execCtx interface{}) error {
 	jobExec := execCtx.(sql.JobExecContext)
@@ -1032,6 +1822,10 @@ func (b *changefeedResumer) Resume(ctx context.Context, execCtx interface{}) err
 	details := b.job.Details().(jobspb.ChangefeedDetails)
 	progress := b.job.Progress()
 
+	if err := b.waitForAdmission(ctx, execCfg); err != nil {
+		return err
+	}
+
 	err := b.resumeWithRetries(ctx, jobExec, jobID, details, progress, execCfg)
 	if err != nil {
 		return b.handleChangefeedError(ctx, err, details, jobExec)
@@ -1045,6 +1839,35 @@ func (b *changefeedResumer) handleChangefeedError(
 	details jobspb.ChangefeedDetails,
 	jobExec sql.JobExecContext,
 ) error {
+	// Changefeeds which exceeded max_emitted_bytes_per_day are always paused,
+	// regardless of on_error, so that they stop emitting to the sink until an
+	// operator resumes them.
+	if errors.Is(changefeedErr, errEmittedBytesQuotaExceeded) {
+		const errorFmt = "job is being paused because it %v"
+		errorMessage := fmt.Sprintf(errorFmt, changefeedErr)
+		log.Warningf(ctx, errorFmt, changefeedErr)
+		return b.pauseWithRunningStatus(ctx, jobExec, errorMessage)
+	}
+
+	// Changefeeds which emitted a message violating their output contract are
+	// paused, so that the contract or the changefeed can be fixed before it
+	// emits anything else.
+	if errors.Is(changefeedErr, errContractViolation) {
+		const errorFmt = "job is being paused because a %v"
+		errorMessage := fmt.Sprintf(errorFmt, changefeedErr)
+		log.Warningf(ctx, errorFmt, changefeedErr)
+		return b.pauseWithRunningStatus(ctx, jobExec, errorMessage)
+	}
+
+	// Changefeeds which exhausted their retry attempts are always paused,
+	// regardless of on_error, so that they get operator attention.
+	if errors.Is(changefeedErr, errRetryAttemptsExhausted) {
+		const errorFmt = "job is being paused after %v"
+		errorMessage := fmt.Sprintf(errorFmt, changefeedErr)
+		log.Warningf(ctx, errorFmt, changefeedErr)
+		return b.pauseWithRunningStatus(ctx, jobExec, errorMessage)
+	}
+
 	opts := changefeedbase.MakeStatementOptions(details.Opts)
 	onError, errErr := opts.GetOnError()
 	if errErr != nil {
@@ -1056,29 +1879,42 @@ func (b *changefeedResumer) handleChangefeedError(
 		return changefeedErr
 	// pause instead of failing
 	case changefeedbase.OptOnErrorPause:
-		// note: we only want the job to pause here if a failure happens, not a
-		// user-initiated cancellation. if the job has been canceled, the ctx
-		// will handle it and the pause will return an error.
 		const errorFmt = "job failed (%v) but is being paused because of %s=%s"
 		errorMessage := fmt.Sprintf(errorFmt, changefeedErr,
 			changefeedbase.OptOnError, changefeedbase.OptOnErrorPause)
-		return b.job.NoTxn().PauseRequestedWithFunc(ctx, func(ctx context.Context,
-			planHookState interface{}, txn isql.Txn, progress *jobspb.Progress) error {
-			err := b.OnPauseRequest(ctx, jobExec, txn, progress)
-			if err != nil {
-				return err
-			}
-			// directly update running status to avoid the running/reverted job status check
-			progress.RunningStatus = errorMessage
-			log.Warningf(ctx, errorFmt, changefeedErr, changefeedbase.OptOnError, changefeedbase.OptOnErrorPause)
-			return nil
-		}, errorMessage)
+		log.Warningf(ctx, errorFmt, changefeedErr, changefeedbase.OptOnError, changefeedbase.OptOnErrorPause)
+		return b.pauseWithRunningStatus(ctx, jobExec, errorMessage)
 	default:
 		return errors.Wrapf(changefeedErr, "unrecognized option value: %s=%s for handling error",
 			changefeedbase.OptOnError, details.Opts[changefeedbase.OptOnError])
 	}
 }
 
+// pauseWithRunningStatus requests that the job be paused, recording the
+// provided message as its running status.
+func (b *changefeedResumer) pauseWithRunningStatus(
+	ctx context.Context, jobExec sql.JobExecContext, errorMessage string,
+) error {
+	// note: we only want the job to pause here if a failure happens, not a
+	// user-initiated cancellation. if the job has been canceled, the ctx
+	// will handle it and the pause will return an error.
+	return b.job.NoTxn().PauseRequestedWithFunc(ctx, func(ctx context.Context,
+		planHookState interface{}, txn isql.Txn, progress *jobspb.Progress) error {
+		err := b.OnPauseRequest(ctx, jobExec, txn, progress)
+		if err != nil {
+			return err
+		}
+		// directly update running status to avoid the running/reverted job status check
+		progress.RunningStatus = errorMessage
+		return nil
+	}, errorMessage)
+}
+
+// errRetryAttemptsExhausted marks errors returned by resumeWithRetries once
+// the changefeed has encountered retry_max_attempts_before_pause consecutive
+// retryable errors without making progress in between.
+var errRetryAttemptsExhausted = errors.New("retry attempts exhausted")
+
 func (b *changefeedResumer) resumeWithRetries(
 	ctx context.Context,
 	jobExec sql.JobExecContext,
@@ -1093,8 +1929,20 @@ func (b *changefeedResumer) resumeWithRetries(
 	// or for many other reasons.
 	var lastRunStatusUpdate time.Time
 
-	for r := getRetry(ctx); r.Next(); {
+	retryOpts, err := changefeedbase.MakeStatementOptions(details.Opts).GetRetryOptions()
+	if err != nil {
+		return err
+	}
+
+	for r := getRetry(ctx, retryOpts); r.Next(); {
+		startPos := positionOf(progress)
+		// failed is set if the attempt failed with a retryable error, which
+		// counts towards the retry limit unless the attempt made progress.
+		var failed error
 		err := maybeUpgradePreProductionReadyExpression(ctx, jobID, details, jobExec)
+		if err == nil {
+			err = b.maybeEmitPendingEndOfStream(ctx, execCfg, jobExec.User(), jobID, details, &progress)
+		}
 
 		if err == nil {
 			// startedCh is normally used to signal back to the creator of the job that
@@ -1104,7 +1952,11 @@ func (b *changefeedResumer) resumeWithRetries(
 			startedCh := make(chan tree.Datums, 1)
 			err = distChangefeedFlow(ctx, jobExec, jobID, details, progress, startedCh)
 			if err == nil {
-				return nil // Changefeed completed -- e.g. due to initial_scan=only mode.
+				// Changefeed completed -- e.g. due to initial_scan=only mode.
+				if err := runOnCompletion(ctx, execCfg, jobExec.User(), jobID, details); err != nil {
+					return errors.Wrapf(err, `running %s`, changefeedbase.OptOnCompletion)
+				}
+				return nil
 			}
 
 			if knobs, ok := execCfg.DistSQLSrv.TestingKnobs.Changefeed.(*TestingKnobs); ok {
@@ -1123,15 +1975,54 @@ func (b *changefeedResumer) resumeWithRetries(
 			return err
 		}
 
-		// All other errors retry.
-		log.Warningf(ctx, `WARNING: CHANGEFEED job %d encountered retryable error: %v`, jobID, err)
-		lastRunStatusUpdate = b.setJobRunningStatus(ctx, lastRunStatusUpdate, "retryable error: %s", err)
-		if metrics, ok := execCfg.JobRegistry.MetricsStruct().Changefeed.(*Metrics); ok {
-			sli, err := metrics.getSLIMetrics(details.Opts[changefeedbase.OptMetricsScope])
-			if err != nil {
+		var truncated bool
+		if !errors.Is(err, sql.ErrPlanChanged) {
+			var truncateErr error
+			truncated, truncateErr = b.maybeHandleTruncate(ctx, execCfg, jobExec.User(), jobID, details, err)
+			if truncateErr != nil {
+				if !changefeedbase.IsRetryableError(truncateErr) {
+					return truncateErr
+				}
+				// The truncation markers could not be emitted, which is
+				// retried like the other failures of the changefeed.
+				err = truncateErr
+			}
+		}
+
+		if errors.Is(err, sql.ErrPlanChanged) {
+			// The changefeed is replanned because the ranges it watches have
+			// moved. This is not a failure, so it does not count against the
+			// retry limit, and the flow is restarted after a fixed backoff.
+			log.Infof(ctx, "CHANGEFEED job %d replanning: %v", jobID, err)
+			if err := r.Replanned(ctx); err != nil {
 				return err
 			}
-			sli.ErrorRetries.Inc(1)
+		} else if truncated {
+			// The changefeed restarts to re-scan its truncated tables, as
+			// configured by on_truncate. This is not a failure either.
+			r.Reset()
+		} else if waited, offlineErr := b.maybeWaitForOfflineTables(
+			ctx, execCfg, jobID, details, err,
+		); offlineErr != nil {
+			return offlineErr
+		} else if waited {
+			// The changefeed restarts once its offline tables are back online,
+			// or to re-scan them once they are, as configured by on_offline.
+			r.Reset()
+		} else {
+			// All other errors retry.
+			errorClass := changefeedbase.ClassifyError(err)
+			log.Warningf(ctx, `WARNING: CHANGEFEED job %d encountered retryable %s error: %v`,
+				jobID, errorClass, err)
+			lastRunStatusUpdate = b.setJobRetryableError(ctx, lastRunStatusUpdate, errorClass, err)
+			if metrics, ok := execCfg.JobRegistry.MetricsStruct().Changefeed.(*Metrics); ok {
+				sli, err := metrics.getSLIMetrics(details.Opts[changefeedbase.OptMetricsScope])
+				if err != nil {
+					return err
+				}
+				sli.ErrorRetries.Inc(1)
+			}
+			failed = err
 		}
 		// Re-load the job in order to update our progress object, which may have
 		// been updated by the changeFrontier processor since the flow started.
@@ -1147,6 +2038,16 @@ func (b *changefeedResumer) resumeWithRetries(
 			progress = reloadedJob.Progress()
 			details = reloadedJob.Details().(jobspb.ChangefeedDetails)
 		}
+
+		if failed != nil {
+			r.Failed(startPos.advancedTo(positionOf(progress)))
+			if r.Exhausted() {
+				return errors.Mark(errors.Wrapf(failed, "%d consecutive retryable errors (%s=%d)",
+					retryOpts.MaxAttemptsBeforePause,
+					changefeedbase.OptRetryMaxAttemptsBeforePause, retryOpts.MaxAttemptsBeforePause),
+					errRetryAttemptsExhausted)
+			}
+		}
 	}
 	return errors.Wrap(ctx.Err(), `ran out of retries`)
 }
@@ -1228,7 +2129,7 @@ func (b *changefeedResumer) OnPauseRequest(
 		}
 		pts := execCfg.ProtectedTimestampProvider.WithTxn(txn)
 		ptr := createProtectedTimestampRecord(
-			ctx, execCfg.Codec, b.job.ID(), AllTargets(details), *resolved, cp,
+			ctx, sourceCodec(execCfg.Codec, details.TenantID), b.job.ID(), AllTargets(details), *resolved, cp,
 		)
 		return pts.Protect(ctx, ptr)
 	}
@@ -1239,9 +2140,13 @@ func (b *changefeedResumer) OnPauseRequest(
 // getQualifiedTableName returns the database-qualified name of the table
 // or view represented by the provided descriptor.
 func getQualifiedTableName(
-	ctx context.Context, execCfg *sql.ExecutorConfig, txn *kv.Txn, desc catalog.TableDescriptor,
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	tenantID roachpb.TenantID,
+	txn *kv.Txn,
+	desc catalog.TableDescriptor,
 ) (string, error) {
-	tbName, err := getQualifiedTableNameObj(ctx, execCfg, txn, desc)
+	tbName, err := getQualifiedTableNameObj(ctx, execCfg, tenantID, txn, desc)
 	if err != nil {
 		return "", err
 	}
@@ -1249,11 +2154,16 @@ func getQualifiedTableName(
 }
 
 // getQualifiedTableNameObj returns the database-qualified name of the table
-// or view represented by the provided descriptor.
+// or view represented by the provided descriptor, which belongs to the
+// secondary tenant with the provided ID, if set.
 func getQualifiedTableNameObj(
-	ctx context.Context, execCfg *sql.ExecutorConfig, txn *kv.Txn, desc catalog.TableDescriptor,
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	tenantID roachpb.TenantID,
+	txn *kv.Txn,
+	desc catalog.TableDescriptor,
 ) (tree.TableName, error) {
-	col := execCfg.CollectionFactory.NewCollection(ctx)
+	col := sourceCollectionFactory(execCfg, tenantID).NewCollection(ctx)
 	db, err := col.ByID(txn).Get().Database(ctx, desc.GetParentID())
 	if err != nil {
 		return tree.TableName{}, err
@@ -1275,13 +2185,43 @@ func getChangefeedTargetName(
 	ctx context.Context,
 	desc catalog.TableDescriptor,
 	execCfg *sql.ExecutorConfig,
+	source sourceTenant,
 	txn *kv.Txn,
 	qualified bool,
+	qualifiers changefeedbase.TableNameQualifiers,
 ) (string, error) {
-	if qualified {
-		return getQualifiedTableName(ctx, execCfg, txn, desc)
+	if !qualified {
+		return desc.GetName(), nil
+	}
+	name, err := getQualifiedTableName(ctx, execCfg, source.id, txn, desc)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	if qualifiers.ClusterAlias != "" {
+		parts = append(parts, qualifiers.ClusterAlias)
+	}
+	if qualifiers.TenantName {
+		tenantName := getTenantName(execCfg)
+		if source.isSet() {
+			tenantName = source.name
+		}
+		parts = append(parts, string(tenantName))
+	}
+	return strings.Join(append(parts, name), "."), nil
+}
+
+// getTenantName returns the name of the tenant the changefeed is created in.
+func getTenantName(execCfg *sql.ExecutorConfig) roachpb.TenantName {
+	if execCfg.NodeInfo.TenantName != nil {
+		if name := execCfg.NodeInfo.TenantName(); name != "" {
+			return name
+		}
+	}
+	if execCfg.Codec.ForSystemTenant() {
+		return catconstants.SystemTenantName
 	}
-	return desc.GetName(), nil
+	return roachpb.TenantName(fmt.Sprintf("tenant-%d", execCfg.Codec.TenantID.ToUint64()))
 }
 
 func logChangefeedCreateTelemetry(ctx context.Context, jr *jobs.Record, isTransformation bool) {
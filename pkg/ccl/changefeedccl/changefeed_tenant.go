@@ -0,0 +1,225 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/kv"
+	"github.com/cockroachdb/cockroach/pkg/multitenant/mtinfopb"
+	"github.com/cockroachdb/cockroach/pkg/multitenant/tenantcapabilities/tenantcapabilitiespb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descs"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/catconstants"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/errors"
+)
+
+// sourceTenant identifies the secondary tenant whose tables a changefeed
+// created in the system tenant watches. The zero value refers to the tenant
+// the changefeed is created in.
+type sourceTenant struct {
+	id   roachpb.TenantID
+	name roachpb.TenantName
+}
+
+func (s sourceTenant) isSet() bool {
+	return s.id.IsSet()
+}
+
+// resolveSourceTenant looks up the tenant named by the tenant option, if any,
+// and verifies that the changefeed may watch its tables. Only admins of the
+// system tenant may create such changefeeds, and only over tenants which were
+// granted the can_be_changefeed_source capability.
+func resolveSourceTenant(
+	ctx context.Context, p sql.PlanHookState, opts changefeedbase.StatementOptions,
+) (sourceTenant, error) {
+	name, ok := opts.GetTenant()
+	if !ok {
+		return sourceTenant{}, nil
+	}
+	if !p.ExecCfg().Codec.ForSystemTenant() {
+		return sourceTenant{}, pgerror.Newf(pgcode.InsufficientPrivilege,
+			"only the system tenant can create changefeeds with the %s option", changefeedbase.OptTenant)
+	}
+	if err := p.RequireAdminRole(ctx,
+		fmt.Sprintf("create a changefeed with the %s option", changefeedbase.OptTenant)); err != nil {
+		return sourceTenant{}, err
+	}
+	info, err := p.LookupTenantInfo(ctx,
+		&tree.TenantSpec{IsName: true, Expr: tree.NewDString(name)}, "CREATE CHANGEFEED")
+	if err != nil {
+		return sourceTenant{}, err
+	}
+	if err := checkSourceTenant(info); err != nil {
+		return sourceTenant{}, err
+	}
+	return sourceTenant{id: roachpb.MustMakeTenantID(info.ID), name: info.Name}, nil
+}
+
+// checkSourceTenant returns an error if changefeeds may not watch the tables
+// of the provided tenant.
+func checkSourceTenant(info *mtinfopb.TenantInfo) error {
+	if roachpb.IsSystemTenantID(info.ID) {
+		return pgerror.Newf(pgcode.InvalidParameterValue,
+			"%s must name a secondary tenant, not %q", changefeedbase.OptTenant, catconstants.SystemTenantName)
+	}
+	if info.DataState != mtinfopb.DataStateReady {
+		return pgerror.Newf(pgcode.ObjectNotInPrerequisiteState,
+			"tenant %q is not ready (data state %s)", info.Name, info.DataState)
+	}
+	if !info.Capabilities.CanBeChangefeedSource {
+		return errors.WithHintf(
+			pgerror.Newf(pgcode.InsufficientPrivilege,
+				"tenant %q does not have capability %q", info.Name, tenantcapabilitiespb.CanBeChangefeedSource),
+			"run ALTER TENANT %s GRANT CAPABILITY %s to allow changefeeds over its tables",
+			tree.NameString(string(info.Name)), tenantcapabilitiespb.CanBeChangefeedSource)
+	}
+	return nil
+}
+
+// verifySourceTenant checks, when the changefeed job starts, that the
+// changefeed may still watch the tables of the tenant it was created over.
+// Revoking the capability, or dropping the tenant, fails the changefeed.
+func verifySourceTenant(
+	ctx context.Context, execCfg *sql.ExecutorConfig, tenantID roachpb.TenantID,
+) error {
+	if !tenantID.IsSet() {
+		return nil
+	}
+	var info *mtinfopb.TenantInfo
+	if err := execCfg.InternalDB.Txn(ctx, func(ctx context.Context, txn isql.Txn) (err error) {
+		info, err = sql.GetTenantRecordByID(ctx, txn, tenantID, execCfg.Settings)
+		return err
+	}); err != nil {
+		if pgerror.GetPGCode(err) == pgcode.UndefinedObject {
+			return changefeedbase.WithTerminalError(err)
+		}
+		return err
+	}
+	if err := checkSourceTenant(info); err != nil {
+		return changefeedbase.WithTerminalError(err)
+	}
+	return nil
+}
+
+// sourceCodec returns the codec of the keyspace watched by the changefeed:
+// the codec of the secondary tenant, if one is set, and the provided codec of
+// the local tenant otherwise.
+func sourceCodec(local keys.SQLCodec, tenantID roachpb.TenantID) keys.SQLCodec {
+	if tenantID.IsSet() {
+		return keys.MakeSQLCodec(tenantID)
+	}
+	return local
+}
+
+// sourceCollectionFactory returns a factory of descriptor collections for the
+// keyspace watched by the changefeed.
+func sourceCollectionFactory(
+	execCfg *sql.ExecutorConfig, tenantID roachpb.TenantID,
+) *descs.CollectionFactory {
+	if tenantID.IsSet() {
+		return descs.NewBareBonesCollectionFactory(execCfg.Settings, keys.MakeSQLCodec(tenantID))
+	}
+	return execCfg.CollectionFactory
+}
+
+// sourceDescsTxn runs f in a transaction with a descriptor collection for the
+// keyspace watched by the changefeed. Leases are only held on descriptors of
+// the local tenant, so descriptors of a secondary tenant are read directly from
+// storage.
+func sourceDescsTxn(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	tenantID roachpb.TenantID,
+	f func(ctx context.Context, txn *kv.Txn, descriptors *descs.Collection) error,
+) error {
+	if !tenantID.IsSet() {
+		return sql.DescsTxn(ctx, execCfg, func(
+			ctx context.Context, txn isql.Txn, descriptors *descs.Collection,
+		) error {
+			return f(ctx, txn.KV(), descriptors)
+		})
+	}
+	cf := sourceCollectionFactory(execCfg, tenantID)
+	return execCfg.DB.Txn(ctx, func(ctx context.Context, txn *kv.Txn) error {
+		descriptors := cf.NewCollection(ctx)
+		defer descriptors.ReleaseAll(ctx)
+		return f(ctx, txn, descriptors)
+	})
+}
+
+// resolveSourceTenantTargets resolves the targets of a changefeed over the
+// tables of a secondary tenant. Since there is no session in that tenant to
+// supply a current database or search path, the targets must be qualified by
+// their database name.
+func resolveSourceTenantTargets(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	source sourceTenant,
+	targets *tree.BackupTargetList,
+	ts hlc.Timestamp,
+) (map[tree.TablePattern]catalog.Descriptor, error) {
+	targetDescs := make(map[tree.TablePattern]catalog.Descriptor, len(targets.Tables.TablePatterns))
+	err := sourceDescsTxn(ctx, execCfg, source.id, func(
+		ctx context.Context, txn *kv.Txn, descriptors *descs.Collection,
+	) error {
+		if err := txn.SetFixedTimestamp(ctx, ts); err != nil {
+			return err
+		}
+		for _, pattern := range targets.Tables.TablePatterns {
+			np, err := pattern.NormalizeTablePattern()
+			if err != nil {
+				return err
+			}
+			tn, ok := np.(*tree.TableName)
+			if !ok {
+				return errors.Errorf(`CHANGEFEED cannot target %s`, tree.AsString(pattern))
+			}
+			var dbName, scName string
+			switch {
+			case tn.ExplicitCatalog:
+				dbName, scName = tn.Catalog(), tn.Schema()
+			case tn.ExplicitSchema:
+				dbName, scName = tn.Schema(), catconstants.PublicSchemaName
+			default:
+				return pgerror.Newf(pgcode.InvalidName,
+					"target %s of a changefeed with the %s option must be qualified by its database name",
+					tree.AsString(tn), changefeedbase.OptTenant)
+			}
+			db, err := descriptors.ByName(txn).Get().Database(ctx, dbName)
+			if err != nil {
+				return err
+			}
+			sc, err := descriptors.ByName(txn).Get().Schema(ctx, db, scName)
+			if err != nil {
+				return err
+			}
+			table, err := descriptors.ByName(txn).Get().Table(ctx, db, sc, tn.Table())
+			if err != nil {
+				return err
+			}
+			targetDescs[pattern] = table
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return targetDescs, nil
+}
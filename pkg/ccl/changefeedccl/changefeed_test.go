@@ -12,6 +12,7 @@ import (
 	"context"
 	gosql "database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -66,11 +67,14 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfra"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfrapb"
 	"github.com/cockroachdb/cockroach/pkg/sql/flowinfra"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
 	"github.com/cockroachdb/cockroach/pkg/sql/parser"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/physicalplan"
 	"github.com/cockroachdb/cockroach/pkg/sql/randgen"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sqlinstance"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlliveness"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlliveness/sqllivenesstestutils"
 	"github.com/cockroachdb/cockroach/pkg/storage"
@@ -96,6 +100,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/dustin/go-humanize"
 	"github.com/lib/pq"
+	"github.com/linkedin/goavro/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -212,6 +217,126 @@ func TestChangefeedReplanning(t *testing.T) {
 	cdcTest(t, testFn, feedTestForceSink("kafka"))
 }
 
+func TestChangefeedReplanOnRangeShift(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	span := func(start, end string) roachpb.Span {
+		return roachpb.Span{Key: roachpb.Key(start), EndKey: roachpb.Key(end)}
+	}
+	makePlan := func(placements map[base.SQLInstanceID][]roachpb.Span) *sql.PhysicalPlan {
+		p := &sql.PhysicalPlan{PhysicalPlan: physicalplan.PhysicalPlan{
+			PhysicalInfrastructure: &physicalplan.PhysicalInfrastructure{},
+		}}
+		for id, spans := range placements {
+			spec := &execinfrapb.ChangeAggregatorSpec{}
+			for _, sp := range spans {
+				spec.Watches = append(spec.Watches, execinfrapb.ChangeAggregatorSpec_Watch{Span: sp})
+			}
+			p.Processors = append(p.Processors, physicalplan.Processor{
+				SQLInstanceID: id,
+				Spec: execinfrapb.ProcessorSpec{
+					Core: execinfrapb.ProcessorCoreUnion{ChangeAggregator: spec},
+				},
+			})
+		}
+		// The change frontier is ignored.
+		p.Processors = append(p.Processors, physicalplan.Processor{
+			SQLInstanceID: 1,
+			Spec: execinfrapb.ProcessorSpec{
+				Core: execinfrapb.ProcessorCoreUnion{ChangeFrontier: &execinfrapb.ChangeFrontierSpec{}},
+			},
+		})
+		return p
+	}
+
+	initial := makePlan(map[base.SQLInstanceID][]roachpb.Span{
+		1: {span("a", "c")},
+		2: {span("c", "e")},
+	})
+
+	for _, tc := range []struct {
+		name      string
+		plan      *sql.PhysicalPlan
+		moved     int
+		total     int
+		threshold float64
+		replan    bool
+	}{
+		{
+			name:      "unchanged",
+			plan:      initial,
+			moved:     0,
+			total:     2,
+			threshold: 0.25,
+			replan:    false,
+		},
+		{
+			name: "split on the same node",
+			plan: makePlan(map[base.SQLInstanceID][]roachpb.Span{
+				1: {span("a", "b"), span("b", "c")},
+				2: {span("c", "e")},
+			}),
+			moved:     0,
+			total:     3,
+			threshold: 0.25,
+			replan:    false,
+		},
+		{
+			name: "split and moved",
+			plan: makePlan(map[base.SQLInstanceID][]roachpb.Span{
+				1: {span("a", "b")},
+				2: {span("b", "c"), span("c", "e")},
+			}),
+			moved:     1,
+			total:     3,
+			threshold: 0.25,
+			replan:    true,
+		},
+		{
+			name: "moved below threshold",
+			plan: makePlan(map[base.SQLInstanceID][]roachpb.Span{
+				1: {span("a", "b")},
+				2: {span("b", "c"), span("c", "e")},
+			}),
+			moved:     1,
+			total:     3,
+			threshold: 0.5,
+			replan:    false,
+		},
+		{
+			name: "moved to a new node",
+			plan: makePlan(map[base.SQLInstanceID][]roachpb.Span{
+				3: {span("a", "c")},
+				2: {span("c", "e")},
+			}),
+			moved:     1,
+			total:     2,
+			threshold: 0.25,
+			replan:    true,
+		},
+		{
+			name: "disabled",
+			plan: makePlan(map[base.SQLInstanceID][]roachpb.Span{
+				2: {span("a", "c")},
+				1: {span("c", "e")},
+			}),
+			moved:     2,
+			total:     2,
+			threshold: 0,
+			replan:    false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			moved, total := countMovedWatches(initial, tc.plan)
+			require.Equal(t, tc.moved, moved)
+			require.Equal(t, tc.total, total)
+			decide := replanOnRangeShift(func() float64 { return tc.threshold })
+			require.Equal(t, tc.replan, decide(context.Background(), initial, tc.plan))
+		})
+	}
+}
+
 func TestChangefeedBasics(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -483,6 +608,154 @@ func TestChangefeedDiff(t *testing.T) {
 	cdcTest(t, testFn)
 }
 
+func TestChangefeedDeleteBeforeImage(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (0, 'initial')`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH delete_before_image`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"after": {"a": 0, "b": "initial"}, "before": null}`,
+		})
+
+		// Updates don't carry their previous row, as they would with diff.
+		sqlDB.Exec(t, `UPSERT INTO foo VALUES (0, 'updated'), (1, 'a')`)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"after": {"a": 0, "b": "updated"}, "before": null}`,
+			`foo: [1]->{"after": {"a": 1, "b": "a"}, "before": null}`,
+		})
+
+		sqlDB.Exec(t, `DELETE FROM foo WHERE a = 0`)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"after": null, "before": {"a": 0, "b": "updated"}}`,
+		})
+
+		expectErrCreatingFeed(t, f, `CREATE CHANGEFEED FOR foo WITH delete_before_image, diff`,
+			`delete_before_image cannot be used with diff`)
+		expectErrCreatingFeed(t, f, `CREATE CHANGEFEED FOR foo WITH delete_before_image, envelope=bare`,
+			`delete_before_image is only usable with envelope=wrapped`)
+		expectErrCreatingFeed(t, f,
+			`CREATE CHANGEFEED WITH delete_before_image AS SELECT * FROM foo`,
+			`delete_before_image cannot be used with CDC queries`)
+	}
+
+	cdcTest(t, testFn)
+}
+
+func TestChangefeedMarkTTLDeletes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, expire_at TIMESTAMPTZ) `+
+			`WITH (ttl_expiration_expression = 'expire_at', ttl_job_cron = '@yearly')`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (0, '2000-01-01'), (1, '2000-01-01')`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH mark_ttl_deletes, diff, initial_scan='no'`)
+		defer closeFeed(t, foo)
+
+		// The first delete is issued like the TTL job issues its deletes, so
+		// it's designated a TTL delete, while the second is a plain delete
+		// even though its row has expired.
+		execCfg := s.Server.ExecutorConfig().(sql.ExecutorConfig)
+		require.NoError(t, execCfg.InternalDB.Txn(context.Background(), func(ctx context.Context, txn isql.Txn) error {
+			if err := txn.KV().SetRowLevelTTL(); err != nil {
+				return err
+			}
+			_, err := txn.Exec(ctx, "ttl-delete", txn.KV(), `DELETE FROM foo WHERE a = 0`)
+			return err
+		}))
+		sqlDB.Exec(t, `DELETE FROM foo WHERE a = 1`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (2, '2100-01-01')`)
+		sqlDB.Exec(t, `UPDATE foo SET expire_at = '2200-01-01' WHERE a = 2`)
+
+		msgs, err := readNextMessages(context.Background(), foo, 4)
+		require.NoError(t, err)
+		var ops []string
+		for _, m := range msgs {
+			var value struct {
+				Op string `json:"op"`
+			}
+			require.NoError(t, json.Unmarshal(m.Value, &value))
+			ops = append(ops, fmt.Sprintf(`%s: %s`, m.Key, value.Op))
+		}
+		// Sinks only order the messages of each key.
+		sort.Strings(ops)
+		require.Equal(t, []string{
+			`[0]: ttl_delete`, `[1]: delete`, `[2]: insert`, `[2]: update`,
+		}, ops)
+
+		expectErrCreatingFeed(t, f, `CREATE CHANGEFEED FOR foo WITH mark_ttl_deletes, diff, envelope=bare`,
+			`mark_ttl_deletes is only usable with format=json and envelope=wrapped or envelope=cloudevents`)
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
+func TestChangefeedBareEnvelope(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (0, 'initial')`)
+
+		// The columns of rows are at the top level of their messages on every
+		// sink, while the metadata some sinks add to the value, such as the
+		// topic, is nested under __crdb__ and stripped by the test feeds.
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH envelope=bare`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"a": 0, "b": "initial"}`,
+		})
+
+		sqlDB.Exec(t, `UPSERT INTO foo VALUES (0, 'updated'), (1, 'a')`)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"a": 0, "b": "updated"}`,
+			`foo: [1]->{"a": 1, "b": "a"}`,
+		})
+
+		expectErrCreatingFeed(t, f, `CREATE CHANGEFEED FOR foo WITH bare_metadata_key='_meta'`,
+			`bare_metadata_key is only usable with envelope=bare`)
+		expectErrCreatingFeed(t, f, `CREATE CHANGEFEED FOR foo WITH envelope=bare, bare_metadata_key=''`,
+			`bare_metadata_key must not be empty`)
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
+func TestChangefeedBareMetadataKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (0, 'initial')`)
+
+		foo := feed(t, f,
+			`CREATE CHANGEFEED FOR foo WITH envelope=bare, bare_metadata_key='_meta', topic_in_value`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"_meta": {"topic": "foo"}, "a": 0, "b": "initial"}`,
+		})
+
+		// Sinks which add metadata to each message don't support the row
+		// envelope, which has no room for it.
+		sqlDB.ExpectErr(t, `this sink is incompatible with envelope=row`,
+			`CREATE CHANGEFEED FOR foo INTO 'webhook-https://fake-host' WITH envelope=row`)
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
 func TestChangefeedTenants(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -577,6 +850,60 @@ func TestChangefeedTenantsExternalIOEnabled(t *testing.T) {
 	})
 }
 
+func TestChangefeedOverSecondaryTenant(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	s, db, cleanup := startTestFullServer(t, feedTestOptions{})
+	defer cleanup()
+	sysSQL := sqlutils.MakeSQLRunner(db)
+
+	_, tenantDB := serverutils.StartTenant(t, s, base.TestTenantArgs{
+		TenantID:   serverutils.TestTenantID(),
+		TenantName: "cdc-source",
+	})
+	tenantSQL := sqlutils.MakeSQLRunner(tenantDB)
+	tenantSQL.Exec(t, `CREATE DATABASE IF NOT EXISTS d`)
+	tenantSQL.Exec(t, `CREATE TABLE d.foo (a INT PRIMARY KEY, b STRING)`)
+	tenantSQL.Exec(t, `INSERT INTO d.foo VALUES (1, 'a')`)
+
+	t.Run("requires capability", func(t *testing.T) {
+		sysSQL.ExpectErr(t, `tenant "cdc-source" does not have capability "can_be_changefeed_source"`,
+			`CREATE CHANGEFEED FOR d.foo WITH tenant='cdc-source'`)
+	})
+
+	sysSQL.Exec(t, `ALTER TENANT "cdc-source" GRANT CAPABILITY can_be_changefeed_source`)
+
+	t.Run("requires existing tenant", func(t *testing.T) {
+		sysSQL.ExpectErr(t, `tenant "missing" does not exist`,
+			`CREATE CHANGEFEED FOR d.foo WITH tenant='missing'`)
+	})
+	t.Run("requires qualified targets", func(t *testing.T) {
+		sysSQL.ExpectErr(t, `must be qualified by its database name`,
+			`CREATE CHANGEFEED FOR foo WITH tenant='cdc-source'`)
+	})
+	t.Run("rejects cdc queries", func(t *testing.T) {
+		sysSQL.ExpectErr(t, `tenant cannot be used with CDC queries`,
+			`CREATE CHANGEFEED WITH tenant='cdc-source' AS SELECT * FROM d.foo`)
+	})
+	t.Run("emits rows of the tenant", func(t *testing.T) {
+		f, cleanup := makeFeedFactory(t, "sinkless", s, db)
+		defer cleanup()
+		foo := feed(t, f, `CREATE CHANGEFEED FOR d.foo WITH tenant='cdc-source'`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [1]->{"after": {"a": 1, "b": "a"}}`,
+		})
+		tenantSQL.Exec(t, `INSERT INTO d.foo VALUES (2, 'b')`)
+		tenantSQL.Exec(t, `ALTER TABLE d.foo ADD COLUMN c INT DEFAULT 3`)
+		assertPayloads(t, foo, []string{
+			`foo: [2]->{"after": {"a": 2, "b": "b"}}`,
+			`foo: [1]->{"after": {"a": 1, "b": "a", "c": 3}}`,
+			`foo: [2]->{"after": {"a": 2, "b": "b", "c": 3}}`,
+		})
+	})
+}
+
 func TestChangefeedEnvelope(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -617,6 +944,52 @@ func TestChangefeedEnvelope(t *testing.T) {
 	cdcTest(t, testFn, feedTestRestrictSinks("sinkless", "enterprise", "kafka"))
 }
 
+// TestChangefeedSinklessAvroInlineSchema verifies that sinkless changefeeds
+// emit avro without a schema registry by inlining the schema into each
+// message.
+func TestChangefeedSinklessAvroInlineSchema(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	decode := func(t *testing.T, msg []byte) map[string]interface{} {
+		t.Helper()
+		ocf, err := goavro.NewOCFReader(strings.NewReader(string(msg)))
+		require.NoError(t, err)
+		require.True(t, ocf.Scan())
+		record, err := ocf.Read()
+		require.NoError(t, err)
+		require.False(t, ocf.Scan())
+		return record.(map[string]interface{})
+	}
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'a')`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH format=avro, diff, resolved`)
+		defer closeFeed(t, foo)
+
+		var sawRow, sawResolved bool
+		for !sawRow || !sawResolved {
+			m, err := foo.Next()
+			require.NoError(t, err)
+			if m.Resolved != nil {
+				require.Contains(t, decode(t, m.Resolved), `resolved`)
+				sawResolved = true
+				continue
+			}
+			require.Equal(t, map[string]interface{}{`a`: int64(1)}, decode(t, m.Key))
+			value := decode(t, m.Value)
+			require.Contains(t, value, `after`)
+			require.Contains(t, value, `before`)
+			sawRow = true
+		}
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("sinkless"))
+}
+
 func TestChangefeedFullTableName(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -631,6 +1004,26 @@ func TestChangefeedFullTableName(t *testing.T) {
 			defer closeFeed(t, foo)
 			assertPayloads(t, foo, []string{`d.public.foo: [1]->{"after": {"a": 1, "b": "a"}}`})
 		})
+		t.Run(`cluster_alias`, func(t *testing.T) {
+			foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH full_table_name, cluster_alias='east'`)
+			defer closeFeed(t, foo)
+			assertPayloads(t, foo, []string{`east.d.public.foo: [1]->{"after": {"a": 1, "b": "a"}}`})
+		})
+		t.Run(`include_tenant_name`, func(t *testing.T) {
+			execCfg := s.Server.ExecutorConfig().(sql.ExecutorConfig)
+			tenantName := execCfg.NodeInfo.TenantName()
+			require.NotEmpty(t, tenantName)
+
+			foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH full_table_name, cluster_alias='east', include_tenant_name`)
+			defer closeFeed(t, foo)
+			assertPayloads(t, foo, []string{
+				fmt.Sprintf(`east.%s.d.public.foo: [1]->{"after": {"a": 1, "b": "a"}}`, tenantName),
+			})
+		})
+		t.Run(`without full_table_name`, func(t *testing.T) {
+			sqlDB.ExpectErr(t, `cluster_alias is only usable with full_table_name`,
+				`CREATE CHANGEFEED FOR foo INTO 'null://' WITH cluster_alias='east'`)
+		})
 	})
 }
 
@@ -830,6 +1223,36 @@ func TestChangefeedMVCCTimestamps(t *testing.T) {
 	cdcTest(t, testFn)
 }
 
+func TestChangefeedMVCCTimestampFormats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		var mvccTimestamp string
+		sqlDB.QueryRow(t, `INSERT INTO foo VALUES (1) RETURNING cluster_logical_timestamp()`).Scan(&mvccTimestamp)
+		ts, err := hlc.ParseHLC(mvccTimestamp)
+		require.NoError(t, err)
+
+		split := feed(t, f, `CREATE CHANGEFEED FOR foo WITH mvcc_timestamp = 'split'`)
+		defer closeFeed(t, split)
+		assertPayloads(t, split, []string{fmt.Sprintf(
+			`foo: [1]->{"after": {"a": 1}, "mvcc_timestamp_logical": %d, "mvcc_timestamp_wall": %d}`,
+			ts.Logical, ts.WallTime)})
+
+		nanos := feed(t, f, `CREATE CHANGEFEED FOR foo WITH mvcc_timestamp = 'nanos'`)
+		defer closeFeed(t, nanos)
+		assertPayloads(t, nanos, []string{fmt.Sprintf(
+			`foo: [1]->{"after": {"a": 1}, "mvcc_timestamp": %d}`, ts.WallTime)})
+
+		sqlDB.ExpectErr(t, `mvcc_timestamp=split is only usable with format=json or format=msgpack`,
+			`CREATE CHANGEFEED FOR foo INTO 'kafka://nope' WITH mvcc_timestamp = 'split', format = 'avro', confluent_schema_registry = 'http://nope'`)
+	}
+
+	cdcTest(t, testFn)
+}
+
 func TestChangefeedResolvedFrequency(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -860,6 +1283,35 @@ func TestChangefeedResolvedFrequency(t *testing.T) {
 	cdcTest(t, testFn)
 }
 
+func TestChangefeedResolvedPerTable(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `CREATE TABLE bar (a INT PRIMARY KEY)`)
+
+		foobar := feed(t, f, `CREATE CHANGEFEED FOR foo, bar WITH resolved='10ms', resolved_per_table`)
+		defer closeFeed(t, foobar)
+
+		// Each table is sent its own resolved timestamps on its topic.
+		resolved := make(map[string]hlc.Timestamp)
+		for len(resolved) < 2 {
+			m, err := foobar.Next()
+			require.NoError(t, err)
+			resolved[m.Topic] = extractResolvedTimestamp(t, m)
+		}
+		require.Contains(t, resolved, `foo`)
+		require.Contains(t, resolved, `bar`)
+
+		sqlDB.ExpectErr(t, `resolved_per_table requires resolved`,
+			`CREATE CHANGEFEED FOR foo INTO 'kafka://nope' WITH resolved_per_table`)
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
 func TestChangefeedRandomExpressions(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -1054,6 +1506,149 @@ func TestChangefeedInitialScan(t *testing.T) {
 				})
 			})
 		}
+
+		// The initial scan of a changefeed with a cursor is performed as of the
+		// cursor, and the changes committed between the cursor and the creation
+		// of the changefeed are then streamed.
+		t.Run(`cursor - scan as of cursor then stream`, func(t *testing.T) {
+			sqlDB.Exec(t, `CREATE TABLE initial_scan (a INT PRIMARY KEY)`)
+			defer sqlDB.Exec(t, `DROP TABLE initial_scan`)
+			sqlDB.Exec(t, `INSERT INTO initial_scan VALUES (1), (2), (3)`)
+			var tsStr string
+			sqlDB.QueryRow(t, `SELECT cluster_logical_timestamp()`).Scan(&tsStr)
+			sqlDB.Exec(t, `DELETE FROM initial_scan WHERE a = 3`)
+			sqlDB.Exec(t, `INSERT INTO initial_scan VALUES (4)`)
+
+			initialScan := feed(t, f, `CREATE CHANGEFEED FOR initial_scan WITH initial_scan='yes', cursor=$1`, tsStr)
+			defer closeFeed(t, initialScan)
+
+			assertPayloads(t, initialScan, []string{
+				`initial_scan: [1]->{"after": {"a": 1}}`,
+				`initial_scan: [2]->{"after": {"a": 2}}`,
+				`initial_scan: [3]->{"after": {"a": 3}}`,
+			})
+			assertPayloads(t, initialScan, []string{
+				`initial_scan: [3]->{"after": null}`,
+				`initial_scan: [4]->{"after": {"a": 4}}`,
+			})
+		})
+	}
+
+	cdcTest(t, testFn)
+}
+
+func TestChangefeedSequence(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE SEQUENCE seq`)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+
+		sqlDB.ExpectErr(t, `CHANGEFEED cannot target sequences: seq`,
+			`CREATE CHANGEFEED FOR seq`)
+		sqlDB.ExpectErr(t, `"foo" is not a sequence`,
+			`CREATE CHANGEFEED FOR SEQUENCE foo`)
+
+		seq := feed(t, f, `CREATE CHANGEFEED FOR SEQUENCE seq WITH no_initial_scan, resolved='10ms'`)
+		defer closeFeed(t, seq)
+		expectResolvedTimestamp(t, seq)
+
+		// All events for a sequence share the same (empty) key.
+		sqlDB.Exec(t, `SELECT nextval('seq')`)
+		sqlDB.Exec(t, `SELECT nextval('seq')`)
+		assertPayloads(t, seq, []string{
+			`seq: []->{"after": {"value": 1}}`,
+			`seq: []->{"after": {"value": 2}}`,
+		})
+		sqlDB.Exec(t, `SELECT setval('seq', 10)`)
+		assertPayloads(t, seq, []string{
+			`seq: []->{"after": {"value": 10}}`,
+		})
+	}
+
+	cdcTest(t, testFn)
+}
+
+func TestChangefeedView(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING, c INT)`)
+		sqlDB.Exec(t, `CREATE TABLE bar (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `CREATE VIEW big (k, label) AS SELECT a, upper(b) FROM foo WHERE c > 10`)
+		sqlDB.Exec(t, `CREATE VIEW joined AS SELECT foo.a FROM foo JOIN bar ON foo.a = bar.a`)
+
+		sqlDB.ExpectErr(t, `CHANGEFEED cannot target views: big`,
+			`CREATE CHANGEFEED FOR big`)
+		sqlDB.ExpectErr(t, `CHANGEFEED cannot target VIEW foo: not a view`,
+			`CREATE CHANGEFEED FOR VIEW foo`)
+		sqlDB.ExpectErr(t, `only views selecting from a single table are supported`,
+			`CREATE CHANGEFEED FOR VIEW joined`)
+		sqlDB.ExpectErr(t, `CHANGEFEED FOR VIEW cannot watch other tables or views`,
+			`CREATE CHANGEFEED FOR VIEW big, TABLE bar`)
+
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'one', 1), (2, 'two', 20)`)
+		big := feed(t, f, `CREATE CHANGEFEED FOR VIEW big`)
+		defer closeFeed(t, big)
+		assertPayloads(t, big, []string{
+			`foo: [2]->{"k": 2, "label": "TWO"}`,
+		})
+
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (3, 'three', 30), (4, 'four', 4)`)
+		assertPayloads(t, big, []string{
+			`foo: [3]->{"k": 3, "label": "THREE"}`,
+		})
+	}
+
+	cdcTest(t, testFn)
+}
+
+func TestChangefeedSecondaryIndex(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (
+  a INT PRIMARY KEY, region STRING, b STRING, c INT,
+  INDEX idx_region (region) STORING (b),
+  INVERTED INDEX idx_inverted (region gin_trgm_ops)
+)`)
+		sqlDB.Exec(t, `CREATE TABLE bar (a INT PRIMARY KEY, b INT, FAMILY (a), FAMILY (b), INDEX (a) STORING (b))`)
+
+		sqlDB.ExpectErr(t, `index "missing" not found on table foo`,
+			`CREATE CHANGEFEED FOR foo@missing`)
+		sqlDB.ExpectErr(t, `CHANGEFEED cannot target primary index foo_pkey of table foo`,
+			`CREATE CHANGEFEED FOR foo@foo_pkey`)
+		sqlDB.ExpectErr(t, `only forward indexes are supported`,
+			`CREATE CHANGEFEED FOR foo@idx_inverted`)
+		sqlDB.ExpectErr(t, `indexes storing columns of tables with multiple column families are not supported`,
+			`CREATE CHANGEFEED FOR bar@bar_a_idx`)
+		sqlDB.ExpectErr(t, `an index must be the only target of its table`,
+			`CREATE CHANGEFEED FOR foo@idx_region, foo`)
+
+		// Entries of the index are keyed by the indexed columns, followed by the
+		// primary key, and hold the columns of the index.
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'east', 'one', 1), (2, 'west', 'two', 2)`)
+		byRegion := feed(t, f, `CREATE CHANGEFEED FOR foo@idx_region`)
+		defer closeFeed(t, byRegion)
+		assertPayloads(t, byRegion, []string{
+			`foo: ["east", 1]->{"after": {"a": 1, "b": "one", "region": "east"}}`,
+			`foo: ["west", 2]->{"after": {"a": 2, "b": "two", "region": "west"}}`,
+		})
+
+		// Changes to columns the index doesn't hold aren't emitted, while
+		// changes to its key move the entry.
+		sqlDB.Exec(t, `UPDATE foo SET c = 10 WHERE a = 1`)
+		sqlDB.Exec(t, `UPDATE foo SET region = 'north' WHERE a = 1`)
+		assertPayloads(t, byRegion, []string{
+			`foo: ["east", 1]->{"after": null}`,
+			`foo: ["north", 1]->{"after": {"a": 1, "b": "one", "region": "north"}}`,
+		})
 	}
 
 	cdcTest(t, testFn)
@@ -2462,6 +3057,51 @@ func TestChangefeedEachColumnFamily(t *testing.T) {
 	cdcTest(t, testFn)
 }
 
+func TestChangefeedColumnFamilyTopicNaming(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING, c STRING, FAMILY most (a,b), FAMILY only_c (c))`)
+		sqlDB.Exec(t, `INSERT INTO foo values (0, 'dog', 'cat')`)
+
+		sqlDB.ExpectErr(t, `family_topic_format must contain {family}`,
+			`CREATE CHANGEFEED FOR foo WITH split_column_families, family_topic_format='{table}'`)
+		sqlDB.ExpectErr(t, `merge_column_families is not usable with family_topic_format`,
+			`CREATE CHANGEFEED FOR foo WITH split_column_families, merge_column_families, family_topic_format='{table}_{family}'`)
+		sqlDB.ExpectErr(t, `merge_column_families is only usable with format=json`,
+			`CREATE CHANGEFEED FOR foo WITH split_column_families, merge_column_families, format=avro, confluent_schema_registry='http://localhost'`)
+
+		t.Run(`family_topic_format`, func(t *testing.T) {
+			foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH split_column_families, family_topic_format='{family}_of_{table}'`)
+			defer closeFeed(t, foo)
+			assertPayloads(t, foo, []string{
+				`most_of_foo: [0]->{"after": {"a": 0, "b": "dog"}}`,
+				`only_c_of_foo: [0]->{"after": {"c": "cat"}}`,
+			})
+		})
+
+		t.Run(`merge_column_families`, func(t *testing.T) {
+			foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH split_column_families, merge_column_families`)
+			defer closeFeed(t, foo)
+			assertPayloads(t, foo, []string{
+				`foo: [0]->{"after": {"a": 0, "b": "dog"}, "family": "most"}`,
+				`foo: [0]->{"after": {"c": "cat"}, "family": "only_c"}`,
+			})
+
+			// Adding a family does not introduce a new topic.
+			sqlDB.Exec(t, `ALTER TABLE foo ADD COLUMN d STRING CREATE FAMILY only_d`)
+			sqlDB.Exec(t, `UPDATE foo SET d='cow' WHERE a=0`)
+			assertPayloads(t, foo, []string{
+				`foo: [0]->{"after": {"d": "cow"}, "family": "only_d"}`,
+			})
+		})
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
 func TestChangefeedSingleColumnFamily(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -2741,6 +3381,14 @@ func TestChangefeedCreateAuthorizationWithChangefeedPriv(t *testing.T) {
 		)
 	})
 
+	// Only admins may watch system tables.
+	withUser(t, "user1", func(userDB *sqlutils.SQLRunner) {
+		userDB.ExpectErr(t,
+			"only users with the admin role are allowed to create changefeeds on system tables",
+			"CREATE CHANGEFEED for system.eventlog INTO 'external://nope'",
+		)
+	})
+
 	// With require_external_connection_sink enabled, the user requires USAGE on the external connection.
 	rootDB.Exec(t, "SET CLUSTER SETTING changefeed.permissions.require_external_connection_sink = true")
 	withUser(t, "user1", func(userDB *sqlutils.SQLRunner) {
@@ -2756,6 +3404,24 @@ func TestChangefeedCreateAuthorizationWithChangefeedPriv(t *testing.T) {
 		)
 	})
 	rootDB.Exec(t, "SET CLUSTER SETTING changefeed.permissions.require_external_connection_sink = false")
+
+	// Only admins and users with the MODIFYCLUSTERSETTING privilege may raise
+	// cluster settings for a changefeed, though anyone may lower them.
+	withUser(t, "user1", func(userDB *sqlutils.SQLRunner) {
+		userDB.ExpectErr(t,
+			"only users with the admin role or the MODIFYCLUSTERSETTING system privilege may raise changefeed.memory.per_changefeed_limit with the settings option",
+			"CREATE CHANGEFEED for table_a INTO 'external://nope' WITH settings='changefeed.memory.per_changefeed_limit=100GiB'",
+		)
+		userDB.Exec(t,
+			"CREATE CHANGEFEED for table_a INTO 'external://nope' WITH settings='changefeed.memory.per_changefeed_limit=1MiB'",
+		)
+	})
+	rootDB.Exec(t, "GRANT SYSTEM MODIFYCLUSTERSETTING TO user1")
+	withUser(t, "user1", func(userDB *sqlutils.SQLRunner) {
+		userDB.Exec(t,
+			"CREATE CHANGEFEED for table_a INTO 'external://nope' WITH settings='changefeed.memory.per_changefeed_limit=100GiB'",
+		)
+	})
 }
 
 func TestChangefeedGrant(t *testing.T) {
@@ -2873,85 +3539,441 @@ func TestChangefeedBareAvro(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
 
-	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
-		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo values (0, 'dog')`)
+		foo := feed(t, f, `CREATE CHANGEFEED WITH format=avro, schema_change_policy=stop AS SELECT * FROM foo`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: {"a":{"long":0}}->{"record":{"foo":{"a":{"long":0},"b":{"string":"dog"}}}}`,
+		})
+	}
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
+func TestChangefeedExpressionUsesSerializedSessionData(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+
+		sqlDB.ExecMultiple(t,
+			// Create target table in a different database.
+			// Session data should be serialized to point to the
+			// correct database.
+			`CREATE DATABASE session`,
+			`USE session`,
+			`CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`,
+			`INSERT INTO foo values (0, 'hello')`,
+			`INSERT INTO foo values (1, 'howdy')`,
+		)
+
+		// Trigram similarity threshold should be 30%; so that "howdy" matches,
+		// but hello doesn't.  This threshold should be serialized
+		// in the changefeed jobs record, and correctly propagated to the aggregators.
+		foo := feed(t, f, `CREATE CHANGEFEED WITH schema_change_policy=stop `+
+			`AS SELECT * FROM foo WHERE b % 'how'`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{`foo: [1]->{"a": 1, "b": "howdy"}`})
+	}
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
+func TestChangefeedBareJSON(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo values (0, 'dog')`)
+		foo := feed(t, f, `CREATE CHANGEFEED WITH schema_change_policy=stop AS SELECT * FROM foo`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{`foo: [0]->{"a": 0, "b": "dog"}`})
+	}
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+	cdcTest(t, testFn, feedTestForceSink("enterprise"))
+	cdcTest(t, testFn, feedTestForceSink("pubsub"))
+	cdcTest(t, testFn, feedTestForceSink("sinkless"))
+	cdcTest(t, testFn, feedTestForceSink("webhook"))
+	cdcTest(t, testFn, feedTestForceSink("cloudstorage"))
+}
+
+func TestChangefeedAvroNotice(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	s, stop := makeServer(t)
+	defer stop()
+	schemaReg := cdctest.StartTestSchemaRegistry()
+	defer schemaReg.Close()
+
+	sqlDB := sqlutils.MakeSQLRunner(s.DB)
+	sqlDB.Exec(t, "CREATE table foo (i int)")
+	sqlDB.Exec(t, `INSERT INTO foo VALUES (0)`)
+
+	sql := fmt.Sprintf("CREATE CHANGEFEED FOR d.foo INTO 'null://' WITH format=experimental_avro, confluent_schema_registry='%s'", schemaReg.URL())
+	expectNotice(t, s.Server, sql, `avro is no longer experimental, use format=avro`)
+}
+
+func TestChangefeedAuditSystemTables(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE ROLE auditor`)
+		sqlDB.Exec(t, `CREATE USER analyst`)
+
+		roleMembers := feed(t, f, `CREATE CHANGEFEED FOR system.role_members WITH initial_scan='no'`)
+		defer closeFeed(t, roleMembers)
+
+		sqlDB.Exec(t, `GRANT auditor TO analyst`)
+		var roleID, memberID string
+		sqlDB.QueryRow(t,
+			`SELECT role_id::STRING, member_id::STRING FROM system.role_members WHERE role = 'auditor'`,
+		).Scan(&roleID, &memberID)
+		assertPayloads(t, roleMembers, []string{fmt.Sprintf(
+			`role_members: ["auditor", "analyst"]->{"after": {"isAdmin": false, "member": "analyst", "member_id": "%s", "role": "auditor", "role_id": "%s"}}`,
+			memberID, roleID,
+		)})
+
+		// The hashed passwords of users aren't emitted.
+		passwords := feed(t, f,
+			`CREATE CHANGEFEED FOR TABLE system.users FAMILY "fam_2_hashedPassword" WITH initial_scan='no'`)
+		defer closeFeed(t, passwords)
+		sqlDB.Exec(t, `ALTER USER analyst WITH PASSWORD 'hunter2'`)
+		assertPayloads(t, passwords, []string{
+			`users.fam_2_hashedPassword: ["analyst"]->{"after": {}}`,
+		})
+
+		// Other system tables may not be watched.
+		sqlDB.ExpectErr(t, `CHANGEFEEDs are not supported on system tables`,
+			`CREATE CHANGEFEED FOR system.jobs INTO 'null://'`)
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
+func TestChangefeedDeleteAfterEmit(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE outbox (id INT PRIMARY KEY, payload STRING)`)
+		sqlDB.Exec(t, `INSERT INTO outbox VALUES (1, 'a'), (2, 'b')`)
+		assertOutboxEmpty := func() {
+			testutils.SucceedsSoon(t, func() error {
+				var count int
+				sqlDB.QueryRow(t, `SELECT count(*) FROM outbox`).Scan(&count)
+				if count != 0 {
+					return errors.Newf("%d rows remain in outbox", count)
+				}
+				return nil
+			})
+		}
+
+		outbox := feed(t, f, `CREATE CHANGEFEED FOR outbox WITH delete_after_emit`)
+		defer closeFeed(t, outbox)
+		assertPayloads(t, outbox, []string{
+			`outbox: [1]->{"after": {"id": 1, "payload": "a"}}`,
+			`outbox: [2]->{"after": {"id": 2, "payload": "b"}}`,
+		})
+		assertOutboxEmpty()
+
+		// The deletions of emitted rows are not emitted.
+		sqlDB.Exec(t, `INSERT INTO outbox VALUES (3, 'c')`)
+		assertPayloads(t, outbox, []string{
+			`outbox: [3]->{"after": {"id": 3, "payload": "c"}}`,
+		})
+		assertOutboxEmpty()
+		sqlDB.Exec(t, `INSERT INTO outbox VALUES (4, 'd')`)
+		assertPayloads(t, outbox, []string{
+			`outbox: [4]->{"after": {"id": 4, "payload": "d"}}`,
+		})
+		assertOutboxEmpty()
+
+		// Deletions by other writers are emitted.
+		sqlDB.Exec(t, `INSERT INTO outbox VALUES (5, 'e')`)
+		sqlDB.Exec(t, `DELETE FROM outbox WHERE id = 5`)
+		assertPayloads(t, outbox, []string{
+			`outbox: [5]->{"after": {"id": 5, "payload": "e"}}`,
+			`outbox: [5]->{"after": null}`,
+		})
+
+		sqlDB.ExpectErr(t, `delete_after_emit requires a sink`,
+			`CREATE CHANGEFEED FOR outbox WITH delete_after_emit`)
+		sqlDB.ExpectErr(t, `delete_after_emit is not usable with delete_before_image`,
+			`CREATE CHANGEFEED FOR outbox INTO 'null://' WITH delete_after_emit, delete_before_image`)
+		sqlDB.ExpectErr(t, `delete_after_emit cannot be used with CDC queries`,
+			`CREATE CHANGEFEED INTO 'null://' WITH delete_after_emit AS SELECT * FROM outbox WHERE id > 10`)
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
+func TestChangefeedDeadLetterTable(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `CREATE TABLE dlq (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			job_id INT8 NOT NULL,
+			table_id INT8 NOT NULL,
+			key BYTES NOT NULL,
+			pretty_key STRING NOT NULL,
+			mvcc_timestamp DECIMAL NOT NULL,
+			error STRING NOT NULL,
+			created TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1), (2), (3)`)
+
+		// The query fails to be evaluated for a = 2.
+		foo := feed(t, f, `CREATE CHANGEFEED WITH dead_letter_table='dlq' AS SELECT a, 6 // (a - 2) AS q FROM foo`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [1]->{"a": 1, "q": -6}`,
+			`foo: [3]->{"a": 3, "q": 6}`,
+		})
+		jobID := foo.(cdctest.EnterpriseTestFeed).JobID()
+
+		var fooID int
+		sqlDB.QueryRow(t, `SELECT 'foo'::REGCLASS::OID::INT8`).Scan(&fooID)
+		// waitForDeadLetter waits for the event of a = 2 to be in the dead letter
+		// table with an MVCC timestamp other than prevMVCC, which it returns.
+		waitForDeadLetter := func(prevMVCC string) (mvcc string) {
+			testutils.SucceedsSoon(t, func() error {
+				rows := sqlDB.QueryStr(t,
+					`SELECT table_id, pretty_key, error, mvcc_timestamp FROM dlq WHERE job_id = $1`, jobID)
+				if len(rows) != 1 || rows[0][3] == prevMVCC {
+					return errors.Newf("expected a new dead letter, found %v", rows)
+				}
+				require.Equal(t, strconv.Itoa(fooID), rows[0][0])
+				require.Equal(t, fmt.Sprintf(`/Table/%d/1/2/0`, fooID), rows[0][1])
+				require.Contains(t, rows[0][2], `division by zero`)
+				mvcc = rows[0][3]
+				return nil
+			})
+			return mvcc
+		}
+		mvcc := waitForDeadLetter(``)
+
+		// Replaying the event rewrites its row, and as it still fails, it is
+		// written back into the table.
+		sqlDB.CheckQueryResults(t,
+			fmt.Sprintf(`SELECT crdb_internal.changefeed_replay_dead_letters('dlq', %d)`, jobID),
+			[][]string{{`1`}})
+		waitForDeadLetter(mvcc)
 
-		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
-		sqlDB.Exec(t, `INSERT INTO foo values (0, 'dog')`)
-		foo := feed(t, f, `CREATE CHANGEFEED WITH format=avro, schema_change_policy=stop AS SELECT * FROM foo`)
-		defer closeFeed(t, foo)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (4)`)
 		assertPayloads(t, foo, []string{
-			`foo: {"a":{"long":0}}->{"record":{"foo":{"a":{"long":0},"b":{"string":"dog"}}}}`,
+			`foo: [4]->{"a": 4, "q": 3}`,
 		})
+
+		// Keys outside of the watched tables, e.g. of the descriptor table, are
+		// never rewritten.
+		sqlDB.Exec(t, `INSERT INTO dlq (job_id, table_id, key, pretty_key, mvcc_timestamp, error)
+			VALUES ($1, 3, '\x8b'::BYTES, '', 0, '')`, jobID)
+		sqlDB.ExpectErr(t, `is outside of the tables watched by changefeed`,
+			fmt.Sprintf(`SELECT crdb_internal.changefeed_replay_dead_letters('dlq', %d)`, jobID))
+		sqlDB.Exec(t, `DELETE FROM dlq WHERE table_id = 3`)
+
+		sqlDB.ExpectErr(t, `dead_letter_table requires a sink`,
+			`CREATE CHANGEFEED FOR foo WITH dead_letter_table='dlq'`)
+		sqlDB.ExpectErr(t, `relation "missing" does not exist`,
+			`CREATE CHANGEFEED FOR foo INTO 'null://' WITH dead_letter_table='missing'`)
+		sqlDB.Exec(t, `CREATE TABLE bad_dlq (id INT PRIMARY KEY, job_id INT8)`)
+		sqlDB.ExpectErr(t, `dead_letter_table bad_dlq has no column table_id`,
+			`CREATE CHANGEFEED FOR foo INTO 'null://' WITH dead_letter_table='bad_dlq'`)
 	}
-	cdcTest(t, testFn, feedTestForceSink("kafka"))
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
 }
 
-func TestChangefeedExpressionUsesSerializedSessionData(t *testing.T) {
+func TestChangefeedContentDigestTable(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
 
 	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
 		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `CREATE TABLE bar (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `CREATE TABLE digests (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			job_id INT8 NOT NULL,
+			topic STRING NOT NULL,
+			since DECIMAL,
+			resolved DECIMAL NOT NULL,
+			messages INT8 NOT NULL,
+			content_hash_xor BYTES NOT NULL
+		)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1), (2)`)
+		sqlDB.Exec(t, `INSERT INTO bar VALUES (1)`)
 
-		sqlDB.ExecMultiple(t,
-			// Create target table in a different database.
-			// Session data should be serialized to point to the
-			// correct database.
-			`CREATE DATABASE session`,
-			`USE session`,
-			`CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`,
-			`INSERT INTO foo values (0, 'hello')`,
-			`INSERT INTO foo values (1, 'howdy')`,
-		)
+		digestFeed := feed(t, f, `CREATE CHANGEFEED FOR foo, bar
+			WITH content_hash, resolved='10ms', content_digest_table='digests'`)
+		defer closeFeed(t, digestFeed)
+		jobID := digestFeed.(cdctest.EnterpriseTestFeed).JobID()
 
-		// Trigram similarity threshold should be 30%; so that "howdy" matches,
-		// but hello doesn't.  This threshold should be serialized
-		// in the changefeed jobs record, and correctly propagated to the aggregators.
-		foo := feed(t, f, `CREATE CHANGEFEED WITH schema_change_policy=stop `+
-			`AS SELECT * FROM foo WHERE b % 'how'`)
-		defer closeFeed(t, foo)
-		assertPayloads(t, foo, []string{`foo: [1]->{"a": 1, "b": "howdy"}`})
+		msgs, err := readNextMessages(context.Background(), digestFeed, 3)
+		require.NoError(t, err)
+		// The digest of each topic holds the XOR of the content hashes of its
+		// messages.
+		xors := make(map[string][]byte)
+		for _, m := range msgs {
+			var value struct {
+				ContentHash string `json:"content_hash"`
+			}
+			require.NoError(t, json.Unmarshal(m.Value, &value))
+			hash, err := hex.DecodeString(value.ContentHash)
+			require.NoError(t, err)
+			xor := xors[m.Topic]
+			if xor == nil {
+				xor = make([]byte, len(hash))
+			}
+			for i := range hash {
+				xor[i] ^= hash[i]
+			}
+			xors[m.Topic] = xor
+		}
+		testutils.SucceedsSoon(t, func() error {
+			rows := sqlDB.QueryStr(t, `SELECT topic, sum(messages)::INT8, xor_agg(content_hash_xor)
+				FROM digests WHERE job_id = $1 GROUP BY topic ORDER BY topic`, jobID)
+			expected := [][]string{
+				{`bar`, `1`, `\x` + hex.EncodeToString(xors[`bar`])},
+				{`foo`, `2`, `\x` + hex.EncodeToString(xors[`foo`])},
+			}
+			if fmt.Sprint(expected) != fmt.Sprint(rows) {
+				return errors.Newf("expected digests %v, found %v", expected, rows)
+			}
+			return nil
+		})
+
+		sqlDB.ExpectErr(t, `content_digest_table requires content_hash`,
+			`CREATE CHANGEFEED FOR foo INTO 'null://' WITH resolved, content_digest_table='digests'`)
+		sqlDB.Exec(t, `CREATE TABLE bad_digests (id INT PRIMARY KEY, job_id INT8)`)
+		sqlDB.ExpectErr(t, `content_digest_table bad_digests has no column topic`,
+			`CREATE CHANGEFEED FOR foo INTO 'null://' WITH content_hash, resolved, content_digest_table='bad_digests'`)
 	}
+
 	cdcTest(t, testFn, feedTestForceSink("kafka"))
 }
 
-func TestChangefeedBareJSON(t *testing.T) {
+func TestChangefeedOutputContract(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
 
 	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
 		sqlDB := sqlutils.MakeSQLRunner(s.DB)
-
 		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
-		sqlDB.Exec(t, `INSERT INTO foo values (0, 'dog')`)
-		foo := feed(t, f, `CREATE CHANGEFEED WITH schema_change_policy=stop AS SELECT * FROM foo`)
+		sqlDB.Exec(t, `CREATE TABLE dlq (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			job_id INT8 NOT NULL,
+			table_id INT8 NOT NULL,
+			key BYTES NOT NULL,
+			pretty_key STRING NOT NULL,
+			mvcc_timestamp DECIMAL NOT NULL,
+			error STRING NOT NULL,
+			created TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'x'), (2, NULL), (3, 'z')`)
+
+		const contract = `{"type": "object", "properties": ` +
+			`{"after": {"type": "object", "properties": {"b": {"type": "string"}}}}}`
+		const violation = `message violates output_contract: value at $.after.b is of type null, expected string`
+
+		// The message of the second row violates the contract, so its event is
+		// written into the dead letter table instead of being emitted.
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH output_contract=$1, `+
+			`on_contract_violation='dead_letter', dead_letter_table='dlq'`, contract)
 		defer closeFeed(t, foo)
-		assertPayloads(t, foo, []string{`foo: [0]->{"a": 0, "b": "dog"}`})
+		assertPayloads(t, foo, []string{
+			`foo: [1]->{"after": {"a": 1, "b": "x"}}`,
+			`foo: [3]->{"after": {"a": 3, "b": "z"}}`,
+		})
+		jobID := foo.(cdctest.EnterpriseTestFeed).JobID()
+		testutils.SucceedsSoon(t, func() error {
+			rows := sqlDB.QueryStr(t, `SELECT pretty_key, error FROM dlq WHERE job_id = $1`, jobID)
+			if len(rows) != 1 {
+				return errors.Newf("expected a dead letter, found %v", rows)
+			}
+			require.Contains(t, rows[0][0], `/1/2/0`)
+			require.Equal(t, violation, rows[0][1])
+			return nil
+		})
+
+		// By default, the changefeed pauses on the first violation.
+		paused := feed(t, f, `CREATE CHANGEFEED FOR foo WITH output_contract=$1`, contract)
+		defer closeFeed(t, paused)
+		pausedJob := paused.(cdctest.EnterpriseTestFeed)
+		require.NoError(t, pausedJob.WaitForStatus(func(s jobs.Status) bool { return s == jobs.StatusPaused }))
+		registry := s.Server.JobRegistry().(*jobs.Registry)
+		job, err := registry.LoadJob(context.Background(), pausedJob.JobID())
+		require.NoError(t, err)
+		require.Contains(t, job.Progress().RunningStatus, violation)
+
+		sqlDB.ExpectErr(t, `unsupported JSON schema keyword "pattern"`,
+			`CREATE CHANGEFEED FOR foo INTO 'null://' WITH output_contract='{"pattern": "x"}'`)
 	}
-	cdcTest(t, testFn, feedTestForceSink("kafka"))
-	cdcTest(t, testFn, feedTestForceSink("enterprise"))
-	cdcTest(t, testFn, feedTestForceSink("pubsub"))
-	cdcTest(t, testFn, feedTestForceSink("sinkless"))
-	cdcTest(t, testFn, feedTestForceSink("webhook"))
-	cdcTest(t, testFn, feedTestForceSink("cloudstorage"))
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
 }
 
-func TestChangefeedAvroNotice(t *testing.T) {
+func TestChangefeedSchemaRegistryExternalConnection(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
 
 	s, stop := makeServer(t)
 	defer stop()
-	schemaReg := cdctest.StartTestSchemaRegistry()
-	defer schemaReg.Close()
+
+	cert, certBase64, err := cdctest.NewCACertBase64Encoded()
+	require.NoError(t, err)
+	reg, err := cdctest.StartTestSchemaRegistryWithTLS(cert, false /* requireClientCert */)
+	require.NoError(t, err)
+	defer reg.Close()
+
+	regURL, err := url.Parse(reg.URL())
+	require.NoError(t, err)
+	regURL.Scheme = changefeedbase.SchemaRegistrySchemeConfluent
+	regURL.User = url.UserPassword(`registry-user`, `registry-password`)
+	regURL.RawQuery = url.Values{changefeedbase.RegistryParamCACert: {certBase64}}.Encode()
 
 	sqlDB := sqlutils.MakeSQLRunner(s.DB)
-	sqlDB.Exec(t, "CREATE table foo (i int)")
-	sqlDB.Exec(t, `INSERT INTO foo VALUES (0)`)
+	sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+	sqlDB.Exec(t, `INSERT INTO foo VALUES (1)`)
+	sqlDB.Exec(t, fmt.Sprintf(`CREATE EXTERNAL CONNECTION registry AS '%s'`, regURL))
 
-	sql := fmt.Sprintf("CREATE CHANGEFEED FOR d.foo INTO 'null://' WITH format=experimental_avro, confluent_schema_registry='%s'", schemaReg.URL())
-	expectNotice(t, s.Server, sql, `avro is no longer experimental, use format=avro`)
+	// The external connection must be to a schema registry.
+	sqlDB.Exec(t, `CREATE EXTERNAL CONNECTION nope AS 'kafka://nope'`)
+	sqlDB.ExpectErr(t, `external connection nope is not a schema registry`,
+		`CREATE CHANGEFEED FOR foo INTO 'null://' WITH format=avro, confluent_schema_registry='external://nope'`)
+
+	var jobID jobspb.JobID
+	sqlDB.QueryRow(t,
+		`CREATE CHANGEFEED FOR foo INTO 'null://' WITH format=avro, confluent_schema_registry='external://registry'`,
+	).Scan(&jobID)
+
+	// The job refers to the connection, not to the credentials it holds.
+	var description string
+	sqlDB.QueryRow(t, `SELECT description FROM [SHOW JOB $1]`, jobID).Scan(&description)
+	require.Contains(t, description, `external://registry`)
+	require.NotContains(t, description, `registry-password`)
+
+	// The changefeed registers its schemas with the registry of the connection.
+	testutils.SucceedsSoon(t, func() error {
+		if len(reg.Subjects()) == 0 {
+			return errors.New(`no schemas registered yet`)
+		}
+		return nil
+	})
 }
 
 func TestChangefeedOutputTopics(t *testing.T) {
@@ -3100,6 +4122,70 @@ func TestChangefeedFailOnTableOffline(t *testing.T) {
 	})
 }
 
+func TestChangefeedWaitOnTableOffline(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	dataSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			if _, err := w.Write([]byte("42,42\n")); err != nil {
+				t.Logf("failed to write: %s", err.Error())
+			}
+		}
+	}))
+	defer dataSrv.Close()
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, "SET CLUSTER SETTING kv.closed_timestamp.target_duration = '50ms'")
+		sqlDB.Exec(t, `CREATE TABLE for_import (a INT PRIMARY KEY, b INT)`)
+		sqlDB.Exec(t, `INSERT INTO for_import VALUES (0, NULL)`)
+		forImport := feed(t, f, `CREATE CHANGEFEED FOR for_import WITH on_offline='wait'`)
+		defer closeFeed(t, forImport)
+		assertPayloads(t, forImport, []string{
+			`for_import: [0]->{"after": {"a": 0, "b": null}}`,
+		})
+
+		// Pause the import after it ingests its rows, leaving the table
+		// offline, which the changefeed waits for.
+		sqlDB.Exec(t, "SET CLUSTER SETTING jobs.debug.pausepoints = 'import.after_ingest'")
+		sqlDB.ExpectErr(t, `pause point`, `IMPORT INTO for_import CSV DATA ($1)`, dataSrv.URL)
+		jobFeed := forImport.(cdctest.EnterpriseTestFeed)
+		testutils.SucceedsSoon(t, func() error {
+			status, err := jobFeed.FetchRunningStatus()
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(status, `waiting for offline tables for_import (importing) since`) ||
+				!strings.Contains(status, `pausing the emission of all targets`) {
+				return errors.Errorf(`unexpected running status: %s`, status)
+			}
+			return nil
+		})
+
+		// Once the import completes, the changefeed re-scans the table.
+		sqlDB.Exec(t, "SET CLUSTER SETTING jobs.debug.pausepoints = ''")
+		var importJobID string
+		sqlDB.QueryRow(t, `SELECT job_id FROM [SHOW JOBS] WHERE job_type = 'IMPORT'`).Scan(&importJobID)
+		sqlDB.Exec(t, `RESUME JOB $1`, importJobID)
+		sqlDB.CheckQueryResultsRetry(
+			t,
+			fmt.Sprintf(`SELECT count(*) FROM [SHOW JOBS] WHERE job_type='IMPORT' AND status='%s'`, jobs.StatusSucceeded),
+			[][]string{{"1"}},
+		)
+		assertPayloads(t, forImport, []string{
+			`for_import: [0]->{"after": {"a": 0, "b": null}}`,
+			`for_import: [42]->{"after": {"a": 42, "b": 42}}`,
+		})
+		sqlDB.Exec(t, `INSERT INTO for_import VALUES (1, 1)`)
+		assertPayloads(t, forImport, []string{
+			`for_import: [1]->{"after": {"a": 1, "b": 1}}`,
+		})
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
 func TestChangefeedRestartMultiNode(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -3183,7 +4269,7 @@ func TestChangefeedStopPolicyMultiNode(t *testing.T) {
 
 	f := makeKafkaFeedFactory(cluster, db)
 	feed := feed(t, f, "CREATE CHANGEFEED FOR test_tab WITH schema_change_policy='stop'")
-	defer closeFeed(t, feed)
+	defer closeFeed(t, digestFeed)
 	sqlDB.Exec(t, `INSERT INTO test_tab VALUES (1)`)
 	assertPayloads(t, feed, []string{
 		`test_tab: [0]->{"after": {"a": 0}}`,
@@ -3783,6 +4869,88 @@ func TestChangefeedTruncateOrDrop(t *testing.T) {
 	// will sometimes fail, non deterministic
 }
 
+func TestChangefeedOnTruncate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	t.Run("rescan", func(t *testing.T) {
+		testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+			sqlDB := sqlutils.MakeSQLRunner(s.DB)
+			sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+			sqlDB.Exec(t, `INSERT INTO foo VALUES (1), (2)`)
+
+			foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH on_truncate='rescan'`)
+			defer closeFeed(t, foo)
+			assertPayloads(t, foo, []string{
+				`foo: [1]->{"after": {"a": 1}}`,
+				`foo: [2]->{"after": {"a": 2}}`,
+			})
+
+			// The changefeed carries on over the new primary index of the table.
+			sqlDB.Exec(t, `TRUNCATE TABLE foo`)
+			sqlDB.Exec(t, `INSERT INTO foo VALUES (3)`)
+			assertPayloads(t, foo, []string{
+				`foo: [3]->{"after": {"a": 3}}`,
+			})
+		}
+
+		cdcTest(t, testFn, feedTestEnterpriseSinks)
+	})
+
+	t.Run("emit_marker", func(t *testing.T) {
+		testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+			sqlDB := sqlutils.MakeSQLRunner(s.DB)
+			sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+			sqlDB.Exec(t, `CREATE TABLE bar (b INT PRIMARY KEY)`)
+			sqlDB.Exec(t, `INSERT INTO foo VALUES (1)`)
+			sqlDB.Exec(t, `INSERT INTO bar VALUES (1)`)
+
+			sqlDB.ExpectErr(t, `on_truncate=emit_marker is only usable with kafka sinks`,
+				`CREATE CHANGEFEED FOR foo INTO 'null://' WITH on_truncate='emit_marker'`)
+
+			foo := feed(t, f, `CREATE CHANGEFEED FOR foo, bar WITH on_truncate='emit_marker'`)
+			defer closeFeed(t, foo)
+			assertPayloads(t, foo, []string{
+				`foo: [1]->{"after": {"a": 1}}`,
+				`bar: [1]->{"after": {"b": 1}}`,
+			})
+
+			// Only the truncated table's topic is sent the truncation marker,
+			// ahead of the rows written after the truncation.
+			sqlDB.Exec(t, `TRUNCATE TABLE foo`)
+			m, err := foo.Next()
+			require.NoError(t, err)
+			require.Equal(t, `foo`, m.Topic)
+			var marker struct {
+				Truncated string `json:"truncated"`
+			}
+			require.NoError(t, json.Unmarshal(m.Resolved, &marker))
+			require.NotEmpty(t, marker.Truncated)
+
+			jobFeed := foo.(cdctest.EnterpriseTestFeed)
+			testutils.SucceedsSoon(t, func() error {
+				status, err := jobFeed.FetchRunningStatus()
+				if err != nil {
+					return err
+				}
+				if !strings.Contains(status, `re-scanning foo`) {
+					return errors.Errorf(`unexpected running status: %s`, status)
+				}
+				return nil
+			})
+
+			sqlDB.Exec(t, `INSERT INTO foo VALUES (2)`)
+			sqlDB.Exec(t, `INSERT INTO bar VALUES (2)`)
+			assertPayloads(t, foo, []string{
+				`foo: [2]->{"after": {"a": 2}}`,
+				`bar: [2]->{"after": {"b": 2}}`,
+			})
+		}
+
+		cdcTest(t, testFn, feedTestForceSink("kafka"), feedTestNoExternalConnection)
+	})
+}
+
 func TestChangefeedMonitoring(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -3900,7 +5068,8 @@ func TestChangefeedRetryableError(t *testing.T) {
 		knobs.BeforeEmitRow = func(_ context.Context) error {
 			switch atomic.LoadInt64(&failEmit) {
 			case 1:
-				return changefeedbase.MarkRetryableError(fmt.Errorf("synthetic retryable error"))
+				return changefeedbase.MarkErrorClass(changefeedbase.MarkRetryableError(
+					fmt.Errorf("synthetic retryable error")), changefeedbase.ErrorClassQuota)
 			case 2:
 				return changefeedbase.WithTerminalError(errors.New("synthetic terminal error"))
 			default:
@@ -3938,7 +5107,7 @@ func TestChangefeedRetryableError(t *testing.T) {
 		jobID := foo.(cdctest.EnterpriseTestFeed).JobID()
 		job, err := registry.LoadJob(context.Background(), jobID)
 		require.NoError(t, err)
-		require.Contains(t, job.Progress().RunningStatus, "synthetic retryable error")
+		require.Contains(t, job.Progress().RunningStatus, "retryable quota error: synthetic retryable error")
 
 		// Verify `SHOW JOBS` also shows this information.
 		var runningStatus string
@@ -3947,6 +5116,10 @@ func TestChangefeedRetryableError(t *testing.T) {
 		).Scan(&runningStatus)
 		require.Contains(t, runningStatus, "synthetic retryable error")
 
+		// SHOW CHANGEFEED JOBS shows the class of the error.
+		sqlDB.CheckQueryResultsRetry(t, fmt.Sprintf(
+			`SELECT error_class FROM [SHOW CHANGEFEED JOB %d]`, jobID), [][]string{{`quota`}})
+
 		// Fix the sink and insert another row. Check that nothing funky happened.
 		atomic.StoreInt64(&failEmit, 0)
 		sqlDB.Exec(t, `INSERT INTO foo VALUES (3)`)
@@ -3954,6 +5127,8 @@ func TestChangefeedRetryableError(t *testing.T) {
 			`foo: [2]->{"after": {"a": 2}}`,
 			`foo: [3]->{"after": {"a": 3}}`,
 		})
+		sqlDB.CheckQueryResultsRetry(t, fmt.Sprintf(
+			`SELECT error_class IS NULL FROM [SHOW CHANGEFEED JOB %d]`, jobID), [][]string{{`true`}})
 
 		// Set sink to return a terminal error and insert a row. Ensure that we
 		// eventually get the error message back out.
@@ -4209,6 +5384,59 @@ func TestChangefeedCanceledWhenPTSIsOld(t *testing.T) {
 	cdcTest(t, testFn, feedTestEnterpriseSinks, withSettings(st))
 }
 
+// TestChangefeedReleasesPTSWhenOld verifies a paused changefeed job configured
+// to release its PTS record once too old does so, rather than being canceled.
+func TestChangefeedReleasesPTSWhenOld(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+
+		sqlDB.Exec(t, `SET CLUSTER SETTING kv.closed_timestamp.target_duration = '100ms';`)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b INT)`)
+
+		feed, err := f.Feed("CREATE CHANGEFEED FOR TABLE foo WITH protect_data_from_gc_on_pause, " +
+			"gc_protect_expires_after='24h', gc_protect_expiration_action='release'")
+		require.NoError(t, err)
+		defer func() {
+			closeFeed(t, feed)
+		}()
+
+		jobFeed := feed.(cdctest.EnterpriseTestFeed)
+		require.NoError(t, jobFeed.Pause())
+
+		var numRecords int
+		sqlDB.QueryRow(t, `SELECT count(*) FROM system.protected_ts_records`).Scan(&numRecords)
+		require.Equal(t, 1, numRecords)
+
+		sqlDB.Exec(t, fmt.Sprintf("ALTER CHANGEFEED %d SET gc_protect_expires_after = '250ms'", jobFeed.JobID()))
+
+		// Stale PTS record should be released, leaving the job paused.
+		testutils.SucceedsSoon(t, func() error {
+			sqlDB.QueryRow(t, `SELECT count(*) FROM system.protected_ts_records`).Scan(&numRecords)
+			if numRecords != 0 {
+				return errors.Newf("expected protected timestamp record to be released")
+			}
+			return nil
+		})
+		sqlDB.CheckQueryResults(t,
+			fmt.Sprintf(`SELECT status FROM [SHOW JOB %d]`, jobFeed.JobID()),
+			[][]string{{`paused`}})
+
+		// The job no longer references the released record.
+		registry := s.Server.JobRegistry().(*jobs.Registry)
+		job, err := registry.LoadJob(context.Background(), jobFeed.JobID())
+		require.NoError(t, err)
+		require.Equal(t, uuid.Nil, job.Progress().GetChangefeed().ProtectedTimestampRecord)
+	}
+
+	// Ensure metrics poller loop runs fast.
+	st := cluster.MakeTestingClusterSettings()
+	jobs.PollJobsMetricsInterval.Override(context.Background(), &st.SV, 100*time.Millisecond)
+	cdcTest(t, testFn, feedTestEnterpriseSinks, withSettings(st))
+}
+
 // TestChangefeedSchemaTTL ensures that changefeeds fail with an error in the case
 // where the feed has fallen behind the GC TTL of the table's schema.
 func TestChangefeedSchemaTTL(t *testing.T) {
@@ -4342,6 +5570,11 @@ func TestChangefeedErrors(t *testing.T) {
 		`EXPERIMENTAL CHANGEFEED FOR foo WITH envelope=nope`,
 	)
 
+	sqlDB.ExpectErr(
+		t, `setting changefeed.node_throttle_config cannot be overridden by a changefeed`,
+		`EXPERIMENTAL CHANGEFEED FOR foo WITH settings='changefeed.node_throttle_config={}'`,
+	)
+
 	sqlDB.ExpectErr(
 		t, `time: invalid duration "bar"`,
 		`EXPERIMENTAL CHANGEFEED FOR foo WITH resolved='bar'`,
@@ -4441,6 +5674,10 @@ func TestChangefeedErrors(t *testing.T) {
 		t, `no scheme found for sink URL`,
 		`CREATE CHANGEFEED FOR foo INTO 'kafka%3A%2F%2Fnope%0A'`,
 	)
+	sqlDB.ExpectErr(
+		t, `unsupported sink: ftps`,
+		`CREATE CHANGEFEED FOR foo INTO 'ftps://host/path'`,
+	)
 
 	// Check that confluent_schema_registry is only accepted if format is avro.
 	// TODO: This should be testing it as a WITH option and check avro_schema_prefix too
@@ -4598,6 +5835,11 @@ func TestChangefeedErrors(t *testing.T) {
 		`CREATE CHANGEFEED FOR foo INTO $1 WITH format='avro', confluent_schema_registry=$2`,
 		`experimental-nodelocal://0/bar`, schemaReg.URL(),
 	)
+	sqlDB.ExpectErr(
+		t, `this sink is incompatible with format=avro and diff`,
+		`CREATE CHANGEFEED FOR foo INTO $1 WITH format='avro', diff`,
+		`nodelocal://0/bar`,
+	)
 	sqlDB.ExpectErr(
 		t, `this sink is incompatible with envelope=key_only`,
 		`CREATE CHANGEFEED FOR foo INTO $1 WITH envelope='key_only'`,
@@ -4836,20 +6078,52 @@ func TestChangefeedErrors(t *testing.T) {
 		`webhook-https://fake-host?client_cert=Zm9v`,
 	)
 	sqlDB.ExpectErr(
-		t, `client_key requires client_cert to be set`,
-		`CREATE CHANGEFEED FOR foo INTO $1`,
-		`webhook-https://fake-host?client_key=Zm9v`,
-	)
+		t, `client_key requires client_cert to be set`,
+		`CREATE CHANGEFEED FOR foo INTO $1`,
+		`webhook-https://fake-host?client_key=Zm9v`,
+	)
+
+	// Sanity check on_error option
+	sqlDB.ExpectErr(
+		t, `option "on_error" requires a value`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH on_error`,
+		`kafka://nope`)
+	sqlDB.ExpectErr(
+		t, `unknown on_error: not_valid, valid values are 'pause' and 'fail'`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH on_error='not_valid'`,
+		`kafka://nope`)
+
+	// Sanity check retry options
+	sqlDB.ExpectErr(
+		t, `option retry_min_backoff must be a duration greater than 0`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH retry_min_backoff='0s'`,
+		`kafka://nope`)
+	sqlDB.ExpectErr(
+		t, `retry_min_backoff='1m' must not be greater than retry_max_backoff='10s'`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH retry_min_backoff='1m', retry_max_backoff='10s'`,
+		`kafka://nope`)
+	sqlDB.ExpectErr(
+		t, `option retry_max_attempts_before_pause must be a positive integer: 'lots'`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH retry_max_attempts_before_pause='lots'`,
+		`kafka://nope`)
+	sqlDB.ExpectErr(
+		t, `option retry_max_attempts_before_pause must be a positive integer: '0'`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH retry_max_attempts_before_pause='0'`,
+		`kafka://nope`)
 
-	// Sanity check on_error option
+	// Sanity check batch_envelope_size option
 	sqlDB.ExpectErr(
-		t, `option "on_error" requires a value`,
-		`CREATE CHANGEFEED FOR foo into $1 WITH on_error`,
+		t, `option batch_envelope_size must be a positive integer: '-1'`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH batch_envelope_size='-1'`,
 		`kafka://nope`)
 	sqlDB.ExpectErr(
-		t, `unknown on_error: not_valid, valid values are 'pause' and 'fail'`,
-		`CREATE CHANGEFEED FOR foo into $1 WITH on_error='not_valid'`,
+		t, `batch_envelope_size is only usable with format=json`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH batch_envelope_size='10', format=csv, initial_scan='only'`,
 		`kafka://nope`)
+	sqlDB.ExpectErr(
+		t, `this sink is incompatible with option batch_envelope_size`,
+		`CREATE CHANGEFEED FOR foo into $1 WITH batch_envelope_size='10'`,
+		`webhook-https://fake-host`)
 }
 
 func TestChangefeedDescription(t *testing.T) {
@@ -5949,7 +7223,7 @@ func TestChangefeedHandlesDrainingNodes(t *testing.T) {
 	defer closeSink()
 
 	feed := feed(t, f, "CREATE CHANGEFEED FOR foo")
-	defer closeFeed(t, feed)
+	defer closeFeed(t, digestFeed)
 
 	// At this point, the job created by feed will fail to start running on node 0 due to draining
 	// registry.  However, this job will be retried, and it should succeed.
@@ -6059,7 +7333,7 @@ func TestChangefeedPropagatesTerminalError(t *testing.T) {
 		f, closeSink := makeFeedFactoryWithOptions(t, sinkType, tc, tc.ServerConn(coordinatorID), opts)
 		defer closeSink()
 		feed := feed(t, f, "CREATE CHANGEFEED FOR foo")
-		defer closeFeed(t, feed)
+		defer closeFeed(t, digestFeed)
 
 		// We don't know if we picked enterprise or core feed; regardless, consuming
 		// from feed should eventually return an error.
@@ -6647,6 +7921,7 @@ func TestCheckpointFrequency(t *testing.T) {
 		nil, /* job */
 		nil, /* core progress */
 		cluster.MakeTestingClusterSettings(),
+		changefeedbase.SettingsOverrides{},
 		MakeMetrics(time.Second).(*Metrics), ts,
 	)
 
@@ -6778,83 +8053,724 @@ func TestChangefeedOnErrorOption(t *testing.T) {
 				`foo: [1]->{"after": {"a": 1, "b": "a"}}`,
 			})
 
-			closeFeed(t, foo)
-			// cancellation should still go through if option is in place
-			// to avoid race condition, check only that the job is progressing to be
-			// canceled (we don't know what stage it will be in)
-			require.NoError(t, feedJob.WaitForStatus(func(s jobs.Status) bool {
-				return s == jobs.StatusCancelRequested ||
-					s == jobs.StatusReverting ||
-					s == jobs.StatusCanceled
-			}))
-		})
+			closeFeed(t, foo)
+			// cancellation should still go through if option is in place
+			// to avoid race condition, check only that the job is progressing to be
+			// canceled (we don't know what stage it will be in)
+			require.NoError(t, feedJob.WaitForStatus(func(s jobs.Status) bool {
+				return s == jobs.StatusCancelRequested ||
+					s == jobs.StatusReverting ||
+					s == jobs.StatusCanceled
+			}))
+		})
+
+		t.Run(`fail on error`, func(t *testing.T) {
+			sqlDB.Exec(t, `CREATE TABLE bar (a INT PRIMARY KEY, b STRING)`)
+
+			knobs := s.TestingKnobs.
+				DistSQL.(*execinfra.TestingKnobs).
+				Changefeed.(*TestingKnobs)
+			knobs.BeforeEmitRow = func(_ context.Context) error {
+				return changefeedbase.WithTerminalError(errors.New("should fail with custom error"))
+			}
+
+			foo := feed(t, f, `CREATE CHANGEFEED FOR bar WITH on_error = 'fail'`)
+			sqlDB.Exec(t, `INSERT INTO bar VALUES (1, 'a')`)
+			defer closeFeed(t, foo)
+
+			feedJob := foo.(cdctest.EnterpriseTestFeed)
+
+			require.NoError(t, feedJob.WaitForStatus(func(s jobs.Status) bool { return s == jobs.StatusFailed }))
+			require.EqualError(t, feedJob.FetchTerminalJobErr(), "should fail with custom error")
+		})
+
+		t.Run(`default`, func(t *testing.T) {
+			sqlDB.Exec(t, `CREATE TABLE quux (a INT PRIMARY KEY, b STRING)`)
+
+			knobs := s.TestingKnobs.
+				DistSQL.(*execinfra.TestingKnobs).
+				Changefeed.(*TestingKnobs)
+			knobs.BeforeEmitRow = func(_ context.Context) error {
+				return changefeedbase.WithTerminalError(errors.New("should fail with custom error"))
+			}
+
+			foo := feed(t, f, `CREATE CHANGEFEED FOR quux`)
+			sqlDB.Exec(t, `INSERT INTO quux VALUES (1, 'a')`)
+			defer closeFeed(t, foo)
+
+			feedJob := foo.(cdctest.EnterpriseTestFeed)
+
+			// if no option is provided, fail should be the default behavior
+			require.NoError(t, feedJob.WaitForStatus(func(s jobs.Status) bool { return s == jobs.StatusFailed }))
+			require.EqualError(t, feedJob.FetchTerminalJobErr(), "should fail with custom error")
+		})
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
+func TestChangefeedRetryMaxAttemptsBeforePause(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+
+		knobs := s.TestingKnobs.
+			DistSQL.(*execinfra.TestingKnobs).
+			Changefeed.(*TestingKnobs)
+		var attempts int32
+		knobs.BeforeEmitRow = func(_ context.Context) error {
+			atomic.AddInt32(&attempts, 1)
+			return errors.New("should be retried")
+		}
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH `+
+			`retry_min_backoff='1ms', retry_max_backoff='10ms', retry_max_attempts_before_pause='3'`)
+		defer closeFeed(t, foo)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'a')`)
+
+		feedJob := foo.(cdctest.EnterpriseTestFeed)
+		require.NoError(t, feedJob.WaitForStatus(func(s jobs.Status) bool { return s == jobs.StatusPaused }))
+		require.GreaterOrEqual(t, atomic.LoadInt32(&attempts), int32(3))
+
+		registry := s.Server.JobRegistry().(*jobs.Registry)
+		job, err := registry.LoadJob(context.Background(), feedJob.JobID())
+		require.NoError(t, err)
+		require.Contains(t, job.Progress().RunningStatus,
+			"3 consecutive retryable errors (retry_max_attempts_before_pause=3)")
+
+		knobs.BeforeEmitRow = nil
+		require.NoError(t, feedJob.Resume())
+		assertPayloads(t, foo, []string{
+			`foo: [1]->{"after": {"a": 1, "b": "a"}}`,
+		})
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
+func TestChangefeedRetryMaxAttemptsIgnoresReplans(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+
+		knobs := s.TestingKnobs.
+			DistSQL.(*execinfra.TestingKnobs).
+			Changefeed.(*TestingKnobs)
+		// The flow fails four times, alternating between replans and errors, so
+		// that only two of the failures count against the retry limit of three.
+		const failedFlows = 4
+		var failures int32
+		knobs.BeforeEmitRow = func(_ context.Context) error {
+			if atomic.LoadInt32(&failures) < failedFlows {
+				return errors.New("should be retried")
+			}
+			return nil
+		}
+		knobs.HandleDistChangefeedError = func(err error) error {
+			if atomic.AddInt32(&failures, 1)%2 == 1 {
+				return sql.ErrPlanChanged
+			}
+			return err
+		}
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH `+
+			`retry_min_backoff='1ms', retry_max_backoff='10ms', retry_max_attempts_before_pause='3'`)
+		defer closeFeed(t, foo)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'a')`)
+
+		assertPayloads(t, foo, []string{
+			`foo: [1]->{"after": {"a": 1, "b": "a"}}`,
+		})
+		require.GreaterOrEqual(t, atomic.LoadInt32(&failures), int32(failedFlows))
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
+func TestChangefeedAdmission(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1)`)
+		metrics := s.Server.JobRegistry().(*jobs.Registry).MetricsStruct().Changefeed.(*Metrics)
+
+		for _, tc := range []struct {
+			setting string
+			// pending returns an error unless the changefeed shows as pending.
+			pending func(jobID jobspb.JobID) error
+		}{
+			{
+				// The aggregator of the changefeed waits for admission to the node.
+				setting: changefeedbase.MaxRunningPerNode.Key(),
+				pending: func(jobspb.JobID) error {
+					if n := metrics.PendingFlows.Value(); n != 1 {
+						return errors.Newf("expected 1 pending aggregator, got %d", n)
+					}
+					return nil
+				},
+			},
+			{
+				setting: changefeedbase.MaxRunningPerCluster.Key(),
+				pending: func(jobID jobspb.JobID) error {
+					var status string
+					sqlDB.QueryRow(t,
+						`SELECT running_status FROM [SHOW CHANGEFEED JOB $1]`, jobID).Scan(&status)
+					if !strings.HasPrefix(status, pendingClusterAdmission) {
+						return errors.Newf("expected status %q, got %q", pendingClusterAdmission, status)
+					}
+					return nil
+				},
+			},
+		} {
+			t.Run(tc.setting, func(t *testing.T) {
+				sqlDB.Exec(t, fmt.Sprintf(`SET CLUSTER SETTING %s = 1`, tc.setting))
+				defer sqlDB.Exec(t, fmt.Sprintf(`RESET CLUSTER SETTING %s`, tc.setting))
+
+				running := feed(t, f, `CREATE CHANGEFEED FOR foo`)
+				assertPayloads(t, running, []string{`foo: [1]->{"after": {"a": 1}}`})
+
+				// The second changefeed waits for the first one to stop, and shows
+				// as pending in the meantime.
+				pending := feed(t, f, `CREATE CHANGEFEED FOR foo`)
+				defer closeFeed(t, pending)
+				jobID := pending.(cdctest.EnterpriseTestFeed).JobID()
+				testutils.SucceedsSoon(t, func() error { return tc.pending(jobID) })
+
+				closeFeed(t, running)
+				assertPayloads(t, pending, []string{`foo: [1]->{"after": {"a": 1}}`})
+			})
+		}
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
+func TestChangefeedChaosKnobs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		knobs := s.TestingKnobs.DistSQL.(*execinfra.TestingKnobs).Changefeed.(*TestingKnobs)
+
+		t.Run("sink write latency", func(t *testing.T) {
+			sqlDB.Exec(t, `CREATE TABLE latency (a INT PRIMARY KEY)`)
+			sqlDB.Exec(t, `INSERT INTO latency VALUES (1)`)
+			var writes int64
+			knobs.SinkWriteLatency = func() time.Duration {
+				atomic.AddInt64(&writes, 1)
+				return 10 * time.Millisecond
+			}
+			defer func() { knobs.SinkWriteLatency = nil }()
+
+			latency := feed(t, f, `CREATE CHANGEFEED FOR latency`)
+			defer closeFeed(t, latency)
+			assertPayloads(t, latency, []string{`latency: [1]->{"after": {"a": 1}}`})
+			require.Less(t, int64(0), atomic.LoadInt64(&writes))
+		})
+
+		t.Run("drop rangefeed values", func(t *testing.T) {
+			sqlDB.Exec(t, `CREATE TABLE dropped (a INT PRIMARY KEY)`)
+			var drop int32 = 1
+			knobs.FeedKnobs.ShouldDropValue = func(*kvpb.RangeFeedValue) bool {
+				return atomic.LoadInt32(&drop) == 1
+			}
+			defer func() { knobs.FeedKnobs.ShouldDropValue = nil }()
+
+			dropped := feed(t, f, `CREATE CHANGEFEED FOR dropped WITH initial_scan='no'`)
+			defer closeFeed(t, dropped)
+			sqlDB.Exec(t, `INSERT INTO dropped VALUES (1)`)
+			// The insert of the first row is lost, so the insert of the second
+			// row is the first message.
+			atomic.StoreInt32(&drop, 0)
+			sqlDB.Exec(t, `INSERT INTO dropped VALUES (2)`)
+			assertPayloads(t, dropped, []string{`dropped: [2]->{"after": {"a": 2}}`})
+		})
+
+		t.Run("stall frontier", func(t *testing.T) {
+			sqlDB.Exec(t, `CREATE TABLE stalled (a INT PRIMARY KEY)`)
+			sqlDB.Exec(t, `INSERT INTO stalled VALUES (1)`)
+			var stall int32 = 1
+			knobs.StallFrontier = func(jobspb.ResolvedSpan) bool {
+				return atomic.LoadInt32(&stall) == 1
+			}
+			defer func() { knobs.StallFrontier = nil }()
+
+			stalled := feed(t, f, `CREATE CHANGEFEED FOR stalled`)
+			defer closeFeed(t, stalled)
+			jobID := stalled.(cdctest.EnterpriseTestFeed).JobID()
+			// Rows are still emitted while the frontier stalls, but the
+			// high-water doesn't advance until it's released.
+			assertPayloads(t, stalled, []string{`stalled: [1]->{"after": {"a": 1}}`})
+			sqlDB.CheckQueryResults(t,
+				`SELECT high_water_timestamp IS NULL FROM [SHOW CHANGEFEED JOB $1]`,
+				[][]string{{`true`}}, jobID)
+			atomic.StoreInt32(&stall, 0)
+			testutils.SucceedsSoon(t, func() error {
+				var highWaterSet bool
+				sqlDB.QueryRow(t,
+					`SELECT high_water_timestamp IS NOT NULL FROM [SHOW CHANGEFEED JOB $1]`, jobID,
+				).Scan(&highWaterSet)
+				if !highWaterSet {
+					return errors.New(`high-water not advanced yet`)
+				}
+				return nil
+			})
+		})
+
+		t.Run("force schema change backfills", func(t *testing.T) {
+			sqlDB.Exec(t, `CREATE TABLE backfilled (a INT PRIMARY KEY)`)
+			sqlDB.Exec(t, `INSERT INTO backfilled VALUES (1)`)
+			knobs.ForceSchemaChangeBackfills = true
+			defer func() { knobs.ForceSchemaChangeBackfills = false }()
+
+			backfilled := feed(t, f, `CREATE CHANGEFEED FOR backfilled`)
+			defer closeFeed(t, backfilled)
+			assertPayloads(t, backfilled, []string{`backfilled: [1]->{"after": {"a": 1}}`})
+			// Adding a nullable column doesn't backfill the table, and so isn't
+			// emitted by default, but the knob forces a backfill, which emits the
+			// row with the new column.
+			sqlDB.Exec(t, `ALTER TABLE backfilled ADD COLUMN b INT`)
+			for {
+				msgs, err := readNextMessages(context.Background(), backfilled, 1)
+				require.NoError(t, err)
+				if string(msgs[0].Value) == `{"after": {"a": 1, "b": null}}` {
+					break
+				}
+			}
+		})
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
+func TestDistSenderRangeFeedPopulatesVirtualTable(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	s, cleanup := makeServer(t)
+	defer cleanup()
+
+	sqlDB := sqlutils.MakeSQLRunner(s.DB)
+	sqlDB.Exec(t, `SET CLUSTER SETTING kv.rangefeed.enabled='true';`)
+	sqlDB.Exec(t, `CREATE TABLE tbl (a INT, b STRING);`)
+	sqlDB.Exec(t, `INSERT INTO tbl VALUES (1, 'one'), (2, 'two'), (3, 'three');`)
+	sqlDB.Exec(t, `CREATE CHANGEFEED FOR tbl INTO 'null://';`)
+
+	var tableID int
+	sqlDB.QueryRow(t, "SELECT table_id FROM crdb_internal.tables WHERE name='tbl'").Scan(&tableID)
+	tableKey := s.Codec.TablePrefix(uint32(tableID))
+
+	numRangesQuery := fmt.Sprintf(
+		"SELECT count(*) FROM crdb_internal.active_range_feeds WHERE range_start LIKE '%s/%%'",
+		tableKey)
+	sqlDB.CheckQueryResultsRetry(t, numRangesQuery, [][]string{{"1"}})
+}
+
+func TestChangefeedSchemaChangeInProgress(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	s, cleanup := makeServer(t)
+	defer cleanup()
+
+	sqlDB := sqlutils.MakeSQLRunner(s.DB)
+	sqlDB.Exec(t, `SET CLUSTER SETTING kv.rangefeed.enabled = true`)
+	sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+	sqlDB.Exec(t, `INSERT INTO foo VALUES (1)`)
+
+	// Leave a schema change in progress by pausing its job.
+	sqlDB.Exec(t, `SET CLUSTER SETTING jobs.debug.pausepoints = 'newschemachanger.before.exec'`)
+	alterDone := make(chan error, 1)
+	go func() {
+		_, err := s.DB.Exec(`ALTER TABLE foo ADD COLUMN b INT DEFAULT 1`)
+		alterDone <- err
+	}()
+	var jobID int64
+	testutils.SucceedsSoon(t, func() error {
+		return s.DB.QueryRow(`SELECT job_id FROM [SHOW JOBS] WHERE job_type = 'NEW SCHEMA CHANGE' AND status = $1`,
+			string(jobs.StatusPaused)).Scan(&jobID)
+	})
+
+	sqlDB.ExpectErr(t, `CHANGEFEED target foo has a schema change in progress`,
+		`CREATE CHANGEFEED FOR foo INTO 'null://' WITH schema_change_in_progress = 'error'`)
+	sqlDB.Exec(t, `SET CLUSTER SETTING changefeed.schema_change_in_progress.max_wait = '10ms'`)
+	sqlDB.ExpectErr(t, `schema change in progress on foo did not complete within 10ms`,
+		`CREATE CHANGEFEED FOR foo INTO 'null://' WITH schema_change_in_progress = 'wait'`)
+	sqlDB.Exec(t, `RESET CLUSTER SETTING changefeed.schema_change_in_progress.max_wait`)
+	sqlDB.Exec(t, `CREATE CHANGEFEED FOR foo INTO 'null://'`)
+
+	createDone := make(chan error, 1)
+	go func() {
+		_, err := s.DB.Exec(`CREATE CHANGEFEED FOR foo INTO 'null://' WITH schema_change_in_progress = 'wait'`)
+		createDone <- err
+	}()
+	select {
+	case err := <-createDone:
+		t.Fatalf("changefeed created before the schema change completed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sqlDB.Exec(t, `SET CLUSTER SETTING jobs.debug.pausepoints = ''`)
+	sqlDB.Exec(t, `RESUME JOB $1`, jobID)
+	require.NoError(t, <-alterDone)
+	require.NoError(t, <-createDone)
+}
+
+func TestChangefeedDryRun(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	s, cleanup := makeServer(t)
+	defer cleanup()
+
+	sqlDB := sqlutils.MakeSQLRunner(s.DB)
+	sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+	sqlDB.Exec(t, `INSERT INTO foo VALUES (1), (2), (3)`)
+
+	sqlDB.ExpectErr(t, `dry_run discards all messages and cannot be used with sink kafka`,
+		`CREATE CHANGEFEED FOR foo INTO 'kafka://nope' WITH dry_run`)
+
+	// A dry run without INTO runs as a job emitting to the null sink.
+	var jobID jobspb.JobID
+	sqlDB.QueryRow(t, `CREATE CHANGEFEED FOR foo WITH dry_run`).Scan(&jobID)
+	defer sqlDB.Exec(t, `CANCEL JOB $1`, jobID)
+
+	var sinkURI string
+	sqlDB.QueryRow(t, `SELECT sink_uri FROM [SHOW CHANGEFEED JOB $1]`, jobID).Scan(&sinkURI)
+	require.Equal(t, `null://`, sinkURI)
+
+	testutils.SucceedsSoon(t, func() error {
+		if c := s.Server.MustGetSQLCounter(`changefeed.emitted_messages`); c < 3 {
+			return errors.Errorf(`expected >= 3 got %d`, c)
+		}
+		if c := s.Server.MustGetSQLCounter(`changefeed.flushes`); c <= 0 {
+			return errors.Errorf(`expected > 0 got %d`, c)
+		}
+		return nil
+	})
+
+	// The null sink can also be selected with the sink option.
+	sqlDB.ExpectErr(t, `unknown sink: kafka`,
+		`CREATE CHANGEFEED FOR foo WITH sink='kafka'`)
+	sqlDB.ExpectErr(t, `sink cannot be used with an INTO clause`,
+		`CREATE CHANGEFEED FOR foo INTO 'kafka://nope' WITH sink='null'`)
+	sqlDB.ExpectErr(t, `delete_after_emit is not usable with sink`,
+		`CREATE CHANGEFEED FOR foo WITH sink='null', delete_after_emit`)
+
+	var nullSinkJobID jobspb.JobID
+	sqlDB.QueryRow(t, `CREATE CHANGEFEED FOR foo WITH sink='null'`).Scan(&nullSinkJobID)
+	defer sqlDB.Exec(t, `CANCEL JOB $1`, nullSinkJobID)
+	sqlDB.QueryRow(t, `SELECT sink_uri FROM [SHOW CHANGEFEED JOB $1]`, nullSinkJobID).Scan(&sinkURI)
+	require.Equal(t, `null://`, sinkURI)
+}
+
+func TestChangefeedCreatedInTransaction(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	s, cleanup := makeServer(t)
+	defer cleanup()
+	sqlDB := sqlutils.MakeSQLRunner(s.DB)
 
-		t.Run(`fail on error`, func(t *testing.T) {
-			sqlDB.Exec(t, `CREATE TABLE bar (a INT PRIMARY KEY, b STRING)`)
+	cert, _, err := cdctest.NewCACertBase64Encoded()
+	require.NoError(t, err)
+	sinkDest, err := cdctest.StartMockWebhookSink(cert)
+	require.NoError(t, err)
+	defer sinkDest.Close()
+	sinkURI := fmt.Sprintf("webhook-%s?insecure_tls_skip_verify=true", sinkDest.URL())
+
+	// A changefeed created along with its table emits the rows written by the
+	// transaction, and those written once it commits.
+	tx, err := s.DB.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec(`CREATE TABLE foo (a INT PRIMARY KEY)`)
+	require.NoError(t, err)
+	_, err = tx.Exec(`INSERT INTO foo VALUES (1)`)
+	require.NoError(t, err)
+	var jobID jobspb.JobID
+	require.NoError(t, tx.QueryRow(`CREATE CHANGEFEED FOR foo INTO $1`, sinkURI).Scan(&jobID))
+	require.NoError(t, tx.Commit())
+	defer sqlDB.Exec(t, `CANCEL JOB $1`, jobID)
+	sqlDB.Exec(t, `INSERT INTO foo VALUES (2)`)
 
-			knobs := s.TestingKnobs.
-				DistSQL.(*execinfra.TestingKnobs).
-				Changefeed.(*TestingKnobs)
-			knobs.BeforeEmitRow = func(_ context.Context) error {
-				return changefeedbase.WithTerminalError(errors.New("should fail with custom error"))
+	var received strings.Builder
+	testutils.SucceedsSoon(t, func() error {
+		for msg := sinkDest.Pop(); msg != ``; msg = sinkDest.Pop() {
+			received.WriteString(msg)
+		}
+		for _, key := range []string{`"key": [1]`, `"key": [2]`} {
+			if !strings.Contains(received.String(), key) {
+				return errors.Newf(`no message with %s in %s`, key, received.String())
 			}
+		}
+		return nil
+	})
 
-			foo := feed(t, f, `CREATE CHANGEFEED FOR bar WITH on_error = 'fail'`)
-			sqlDB.Exec(t, `INSERT INTO bar VALUES (1, 'a')`)
-			defer closeFeed(t, foo)
+	// A changefeed created in a transaction which aborts is not created.
+	tx, err = s.DB.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec(`CREATE TABLE bar (a INT PRIMARY KEY)`)
+	require.NoError(t, err)
+	var abortedJobID jobspb.JobID
+	require.NoError(t, tx.QueryRow(`CREATE CHANGEFEED FOR bar INTO $1`, sinkURI).Scan(&abortedJobID))
+	require.NoError(t, tx.Rollback())
+	sqlDB.CheckQueryResults(t,
+		fmt.Sprintf(`SELECT count(*) FROM system.jobs WHERE id = %d`, abortedJobID), [][]string{{`0`}})
+
+	// CDC queries are planned outside of the transaction, which cannot see the
+	// tables it creates.
+	tx, err = s.DB.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec(`CREATE TABLE baz (a INT PRIMARY KEY)`)
+	require.NoError(t, err)
+	_, err = tx.Exec(`CREATE CHANGEFEED INTO $1 AS SELECT * FROM baz`, sinkURI)
+	require.Error(t, err)
+	require.Contains(t, err.Error(),
+		`CDC queries cannot target table baz, which was created or altered in the same transaction`)
+	require.NoError(t, tx.Rollback())
+}
+
+func TestChangefeedFanOut(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
 
-			feedJob := foo.(cdctest.EnterpriseTestFeed)
+	s, cleanup := makeServer(t)
+	defer cleanup()
 
-			require.NoError(t, feedJob.WaitForStatus(func(s jobs.Status) bool { return s == jobs.StatusFailed }))
-			require.EqualError(t, feedJob.FetchTerminalJobErr(), "should fail with custom error")
-		})
+	sqlDB := sqlutils.MakeSQLRunner(s.DB)
+	sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+	sqlDB.Exec(t, `INSERT INTO foo VALUES (1), (2), (3)`)
+
+	sqlDB.ExpectErr(t, `failure_policy is only supported when emitting to multiple sinks`,
+		`CREATE CHANGEFEED FOR foo INTO 'null://?failure_policy=isolate'`)
+	sqlDB.ExpectErr(t, `failure_policy=isolate is not supported for the first sink`,
+		`CREATE CHANGEFEED FOR foo INTO ('null://?failure_policy=isolate', 'null://')`)
+	sqlDB.ExpectErr(t, `unknown failure_policy "ignore"`,
+		`CREATE CHANGEFEED FOR foo INTO ('null://', 'null://?failure_policy=ignore')`)
+	sqlDB.ExpectErr(t, `dry_run cannot be used with multiple sinks`,
+		`CREATE CHANGEFEED FOR foo INTO ('null://', 'null://') WITH dry_run`)
 
-		t.Run(`default`, func(t *testing.T) {
-			sqlDB.Exec(t, `CREATE TABLE quux (a INT PRIMARY KEY, b STRING)`)
+	var jobID jobspb.JobID
+	sqlDB.QueryRow(t,
+		`CREATE CHANGEFEED FOR foo INTO ('null://', 'null://?failure_policy=isolate')`,
+	).Scan(&jobID)
+	defer sqlDB.Exec(t, `CANCEL JOB $1`, jobID)
 
-			knobs := s.TestingKnobs.
-				DistSQL.(*execinfra.TestingKnobs).
-				Changefeed.(*TestingKnobs)
-			knobs.BeforeEmitRow = func(_ context.Context) error {
-				return changefeedbase.WithTerminalError(errors.New("should fail with custom error"))
-			}
+	var description string
+	sqlDB.QueryRow(t, `SELECT description FROM [SHOW JOB $1]`, jobID).Scan(&description)
+	require.Equal(t,
+		`CREATE CHANGEFEED FOR TABLE foo INTO ('null://', 'null://?failure_policy=isolate')`,
+		description)
 
-			foo := feed(t, f, `CREATE CHANGEFEED FOR quux`)
-			sqlDB.Exec(t, `INSERT INTO quux VALUES (1, 'a')`)
-			defer closeFeed(t, foo)
+	// Each row is emitted to both sinks.
+	testutils.SucceedsSoon(t, func() error {
+		if c := s.Server.MustGetSQLCounter(`changefeed.emitted_messages`); c < 6 {
+			return errors.Errorf(`expected >= 6 got %d`, c)
+		}
+		return nil
+	})
+}
 
-			feedJob := foo.(cdctest.EnterpriseTestFeed)
+// TestChangefeedExternalSinks runs against real sinks, and is skipped unless
+// they are configured. See testfeed_external_test.go.
+func TestChangefeedExternalSinks(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
 
-			// if no option is provided, fail should be the default behavior
-			require.NoError(t, feedJob.WaitForStatus(func(s jobs.Status) bool { return s == jobs.StatusFailed }))
-			require.EqualError(t, feedJob.FetchTerminalJobErr(), "should fail with custom error")
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		require.NotEmpty(t, f.(cdctest.ExternalSinkFeedFactory).SinkURI())
+
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (0, 'initial')`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH resolved`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"after": {"a": 0, "b": "initial"}}`,
+		})
+
+		sqlDB.Exec(t, `UPSERT INTO foo VALUES (0, 'updated'), (1, 'new')`)
+		sqlDB.Exec(t, `DELETE FROM foo WHERE a = 1`)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"after": {"a": 0, "b": "updated"}}`,
+			`foo: [1]->{"after": {"a": 1, "b": "new"}}`,
+			`foo: [1]->{"after": null}`,
 		})
+		expectResolvedTimestamp(t, foo)
 	}
 
-	cdcTest(t, testFn, feedTestEnterpriseSinks)
+	// The Pub/Sub emulator accepts no credentials.
+	skipPubsubCredentials := withKnobsFn(func(knobs *base.TestingKnobs) {
+		knobs.DistSQL.(*execinfra.TestingKnobs).Changefeed.(*TestingKnobs).
+			PubsubClientSkipCredentialsCheck = true
+	})
+	for _, sinkType := range []string{`external-kafka`, `external-pubsub`} {
+		cdcTest(t, testFn, feedTestForceSink(sinkType), feedTestNoExternalConnection,
+			skipPubsubCredentials)
+	}
 }
 
-func TestDistSenderRangeFeedPopulatesVirtualTable(t *testing.T) {
+// TestChangefeedExternalKafkaDelivery checks the ordering and delivery
+// guarantees of changefeeds against a real Kafka broker, which the in-memory
+// fake can't exercise: that the messages of each row are consumed in order,
+// and that the duplicates emitted around restarts are all above the last
+// resolved timestamp, with and without the idempotent and transactional
+// producers, and that the messages of aborted transactions are never
+// consumed. It is skipped unless Docker is available to start the broker, or
+// a broker is configured. See testfeed_external_test.go.
+func TestChangefeedExternalKafkaDelivery(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
 
-	s, cleanup := makeServer(t)
-	defer cleanup()
+	const numRows, numRestarts = 20, 3
 
-	sqlDB := sqlutils.MakeSQLRunner(s.DB)
-	sqlDB.Exec(t, `SET CLUSTER SETTING kv.rangefeed.enabled='true';`)
-	sqlDB.Exec(t, `CREATE TABLE tbl (a INT, b STRING);`)
-	sqlDB.Exec(t, `INSERT INTO tbl VALUES (1, 'one'), (2, 'two'), (3, 'three');`)
-	sqlDB.Exec(t, `CREATE CHANGEFEED FOR tbl INTO 'null://';`)
+	// Once armed, the sinks let the next row be emitted and then hold every
+	// later write, so that the row is left in a transaction which isn't
+	// committed.
+	const (
+		holdDisarmed int32 = iota
+		holdArmed
+		holdRowEmitting
+		holdHeld
+	)
 
-	var tableID int
-	sqlDB.QueryRow(t, "SELECT table_id FROM crdb_internal.tables WHERE name='tbl'").Scan(&tableID)
-	tableKey := s.Codec.TablePrefix(uint32(tableID))
+	testFn := func(sinkConfig string) cdcTestFn {
+		return func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+			sqlDB := sqlutils.MakeSQLRunner(s.DB)
+			sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b INT)`)
+			sqlDB.Exec(t, `INSERT INTO foo SELECT i, 0 FROM generate_series(1, $1) AS g(i)`, numRows)
+
+			transactional := strings.Contains(sinkConfig, `Transactional`)
+			holdState := holdDisarmed
+			if transactional {
+				// The sinks are wrapped to inject latency when they are created,
+				// so the knobs are set before the changefeed starts.
+				knobs := s.TestingKnobs.
+					DistSQL.(*execinfra.TestingKnobs).
+					Changefeed.(*TestingKnobs)
+				knobs.BeforeEmitRow = func(context.Context) error {
+					atomic.CompareAndSwapInt32(&holdState, holdArmed, holdRowEmitting)
+					return nil
+				}
+				knobs.SinkWriteLatency = func() time.Duration {
+					if atomic.CompareAndSwapInt32(&holdState, holdRowEmitting, holdHeld) {
+						return 0
+					}
+					if atomic.LoadInt32(&holdState) == holdHeld {
+						// Held until the changefeed is canceled.
+						return time.Hour
+					}
+					return 0
+				}
+			}
 
-	numRangesQuery := fmt.Sprintf(
-		"SELECT count(*) FROM crdb_internal.active_range_feeds WHERE range_start LIKE '%s/%%'",
-		tableKey)
-	sqlDB.CheckQueryResultsRetry(t, numRangesQuery, [][]string{{"1"}})
+			foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH updated, resolved = '100ms', `+
+				`min_checkpoint_frequency = '100ms', kafka_sink_config = $1`, sinkConfig)
+			defer closeFeed(t, foo)
+			kafkaFeed := foo.(*externalKafkaFeed)
+
+			dups := cdctest.NewDuplicateValidator(`foo`)
+			v := cdctest.Validators{cdctest.NewOrderValidator(`foo`), dups}
+			// consumeRound consumes messages, including duplicates, until every
+			// row has been seen with its value for the round, followed by a
+			// resolved timestamp.
+			consumeRound := func(round int) {
+				t.Helper()
+				remaining := make(map[string]struct{}, numRows)
+				for i := 1; i <= numRows; i++ {
+					remaining[fmt.Sprintf(`[%d]`, i)] = struct{}{}
+				}
+				for {
+					m, err := kafkaFeed.nextWithDuplicates()
+					require.NoError(t, err)
+					if m.Resolved != nil {
+						_, resolved, err := cdctest.ParseJSONValueTimestamps(m.Resolved)
+						require.NoError(t, err)
+						require.NoError(t, v.NoteResolved(m.Partition, resolved))
+						if len(remaining) == 0 {
+							return
+						}
+						continue
+					}
+					updated, _, err := cdctest.ParseJSONValueTimestamps(m.Value)
+					require.NoError(t, err)
+					require.NoError(t, v.NoteRow(m.Partition, string(m.Key), string(m.Value), updated))
+					if strings.Contains(string(m.Value), fmt.Sprintf(`"b": %d}`, round)) {
+						delete(remaining, string(m.Key))
+					}
+				}
+			}
+
+			consumeRound(0)
+			sqlDB.Exec(t, `UPDATE foo SET b = 1`)
+			consumeRound(1)
+			if sinkConfig != `{}` {
+				// Without restarts, the idempotent producer, which the
+				// transactional producer is, keeps retried messages from being
+				// duplicated.
+				require.Zero(t, dups.NumDuplicates)
+			}
+
+			// Restart the changefeed right after updating the rows, which
+			// re-emits those of their messages above its last checkpoint.
+			for round := 2; round < 2+numRestarts; round++ {
+				sqlDB.Exec(t, `UPDATE foo SET b = $1`, round)
+				require.NoError(t, kafkaFeed.Pause())
+				require.NoError(t, kafkaFeed.Resume())
+				consumeRound(round)
+			}
+			require.Empty(t, v.Failures())
+			t.Logf(`%d duplicates across %d restarts`, dups.NumDuplicates, numRestarts)
+
+			if !transactional {
+				return
+			}
+			// Cancel the changefeed while a row is produced in a transaction
+			// which the held sink can't commit. Closing the sink aborts the
+			// transaction, so the row is never consumed.
+			atomic.StoreInt32(&holdState, holdArmed)
+			sqlDB.Exec(t, `UPDATE foo SET b = -1`)
+			testutils.SucceedsSoon(t, func() error {
+				if atomic.LoadInt32(&holdState) != holdHeld {
+					return errors.New(`row not yet emitted`)
+				}
+				return nil
+			})
+			sqlDB.Exec(t, `CANCEL JOB $1`, kafkaFeed.JobID())
+			require.NoError(t, kafkaFeed.WaitForStatus(func(s jobs.Status) bool {
+				return s == jobs.StatusCanceled
+			}))
+			deadline := time.After(5 * time.Second)
+			for consuming := true; consuming; {
+				select {
+				case m := <-kafkaFeed.source:
+					require.NotContains(t, string(m.Value), `"b": -1}`)
+				case <-deadline:
+					consuming = false
+				}
+			}
+		}
+	}
+
+	for name, sinkConfig := range map[string]string{
+		`default`:       `{}`,
+		`idempotent`:    `{"Idempotent": true}`,
+		`transactional`: `{"Transactional": true}`,
+	} {
+		cdcTestNamed(t, name, testFn(sinkConfig), feedTestForceSink(`external-kafka`),
+			feedTestNoExternalConnection)
+	}
 }
 
 func TestChangefeedCaseInsensitiveOpts(t *testing.T) {
@@ -6923,7 +8839,7 @@ func TestChangefeedEndTime(t *testing.T) {
 
 		fakeEndTime := s.Server.Clock().Now().Add(int64(time.Hour), 0).AsOfSystemTime()
 		feed := feed(t, f, "CREATE CHANGEFEED FOR foo WITH end_time = $1", fakeEndTime)
-		defer closeFeed(t, feed)
+		defer closeFeed(t, digestFeed)
 
 		assertPayloads(t, feed, []string{
 			`foo: [1]->{"after": {"a": 1}}`,
@@ -6971,7 +8887,7 @@ func TestChangefeedEndTimeWithCursor(t *testing.T) {
 
 		fakeEndTime := s.Server.Clock().Now().Add(int64(time.Hour), 0).AsOfSystemTime()
 		feed := feed(t, f, "CREATE CHANGEFEED FOR foo WITH cursor = $1, end_time = $2, no_initial_scan", tsCursor, fakeEndTime)
-		defer closeFeed(t, feed)
+		defer closeFeed(t, digestFeed)
 
 		assertPayloads(t, feed, []string{
 			`foo: [4]->{"after": {"a": 4}}`,
@@ -6991,6 +8907,62 @@ func TestChangefeedEndTimeWithCursor(t *testing.T) {
 	cdcTest(t, testFn, feedTestEnterpriseSinks)
 }
 
+func TestChangefeedCancelAtTime(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+
+		sqlDB.Exec(t, "CREATE TABLE foo (a INT PRIMARY KEY)")
+		sqlDB.Exec(t, "INSERT INTO foo VALUES (1)")
+
+		feed := feed(t, f, "CREATE CHANGEFEED FOR foo")
+		defer closeFeed(t, digestFeed)
+		assertPayloads(t, feed, []string{
+			`foo: [1]->{"after": {"a": 1}}`,
+		})
+
+		drainTime := s.Server.Clock().Now().Add(int64(5*time.Second), 0)
+		jobID := digestFeed.(cdctest.EnterpriseTestFeed).JobID()
+		sqlDB.Exec(t, "INSERT INTO foo VALUES (2)")
+		// The aggregators could emit changes past a drain time too close to
+		// now before noticing it.
+		sqlDB.ExpectErr(t, "must be at least .* in the future",
+			"CANCEL CHANGEFEED $1 AT TIME $2", jobID, s.Server.Clock().Now().AsOfSystemTime())
+		sqlDB.Exec(t, "CANCEL CHANGEFEED $1 AT TIME $2", jobID, drainTime.AsOfSystemTime())
+		sqlDB.ExpectErr(t, "already draining",
+			"CANCEL CHANGEFEED $1 AT TIME $2", jobID, drainTime.AsOfSystemTime())
+
+		// Rows written after the drain time must not be emitted.
+		testutils.SucceedsSoon(t, func() error {
+			if now := s.Server.Clock().Now(); now.LessEq(drainTime) {
+				return errors.Newf("clock %s has not passed drain time %s", now, drainTime)
+			}
+			return nil
+		})
+		sqlDB.Exec(t, "INSERT INTO foo VALUES (3)")
+
+		// The changefeed emits a final resolved timestamp even though the
+		// resolved option was not specified, and then completes.
+		for {
+			m, err := feed.Next()
+			require.NoError(t, err)
+			if m.Resolved != nil {
+				require.Equal(t, drainTime.Prev(), extractResolvedTimestamp(t, m))
+				break
+			}
+			require.NotContains(t, string(m.Value), `"a": 3`)
+		}
+
+		require.NoError(t, feed.(cdctest.EnterpriseTestFeed).WaitForStatus(func(s jobs.Status) bool {
+			return s == jobs.StatusSucceeded
+		}))
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
 func TestChangefeedOnlyInitialScan(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -7012,7 +8984,7 @@ func TestChangefeedOnlyInitialScan(t *testing.T) {
 				}()
 
 				feed := feed(t, f, changefeedStmt)
-				defer closeFeed(t, feed)
+				defer closeFeed(t, digestFeed)
 
 				// Insert few more rows after the feed started -- we should not see those emitted.
 				sqlDB.Exec(t, "INSERT INTO foo VALUES (5005), (5007), (5009)")
@@ -7044,6 +9016,88 @@ func TestChangefeedOnlyInitialScan(t *testing.T) {
 	cdcTest(t, testFn, feedTestEnterpriseSinks, feedTestOmitSinks("enterprise", "webhook"))
 }
 
+func TestChangefeedCoalesceWindow(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b INT)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 1), (2, 1)`)
+
+		sqlDB.ExpectErr(t, `coalesce_window requires a sink`,
+			`EXPERIMENTAL CHANGEFEED FOR foo WITH coalesce_window='1s'`)
+		sqlDB.ExpectErr(t, `option coalesce_window must be a duration greater than 0`,
+			`CREATE CHANGEFEED FOR foo INTO 'null://' WITH coalesce_window='0s'`)
+		sqlDB.ExpectErr(t, `coalesce_window is not usable with diff because the before value of a collapsed message`,
+			`CREATE CHANGEFEED FOR foo INTO 'null://' WITH coalesce_window='1s', diff`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH coalesce_window='100ms'`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [1]->{"after": {"a": 1, "b": 1}}`,
+			`foo: [2]->{"after": {"a": 2, "b": 1}}`,
+		})
+
+		// Messages held back within the window are emitted once the sink is
+		// flushed, at the latest.
+		sqlDB.Exec(t, `UPDATE foo SET b = 2 WHERE a = 1`)
+		assertPayloads(t, foo, []string{
+			`foo: [1]->{"after": {"a": 1, "b": 2}}`,
+		})
+	}
+
+	cdcTest(t, testFn, feedTestEnterpriseSinks)
+}
+
+func TestChangefeedOnCompletion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1), (2)`)
+
+		sqlDB.ExpectErr(t, `on_completion=emit_eof requires initial_scan_only or end_time`,
+			`CREATE CHANGEFEED FOR foo INTO 'kafka://nope' WITH on_completion='emit_eof'`)
+		sqlDB.ExpectErr(t, `on_completion=emit_eof is only usable with format=json`,
+			`CREATE CHANGEFEED FOR foo INTO 'kafka://nope' WITH initial_scan='only', `+
+				`on_completion='emit_eof', format='csv'`)
+		sqlDB.ExpectErr(t, `on_completion=delete_topics is only usable with kafka sinks`,
+			`CREATE CHANGEFEED FOR foo INTO 'null://' WITH initial_scan='only', `+
+				`on_completion='delete_topics'`)
+		sqlDB.ExpectErr(t, `on_completion=delete_topics requires the sink parameter auto_create_topics=true`,
+			`CREATE CHANGEFEED FOR foo INTO 'kafka://nope' WITH initial_scan='only', `+
+				`on_completion='delete_topics'`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH initial_scan='only', on_completion='emit_eof'`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [1]->{"after": {"a": 1}}`,
+			`foo: [2]->{"after": {"a": 2}}`,
+		})
+
+		// Once the initial scan completes, the end-of-stream marker is
+		// emitted to the topic of the table.
+		m, err := foo.Next()
+		require.NoError(t, err)
+		require.Equal(t, `foo`, m.Topic)
+		var marker struct {
+			EndOfStream string `json:"end_of_stream"`
+		}
+		require.NoError(t, json.Unmarshal(m.Resolved, &marker))
+		require.NotEmpty(t, marker.EndOfStream)
+
+		jobFeed := foo.(cdctest.EnterpriseTestFeed)
+		require.NoError(t, jobFeed.WaitForStatus(func(s jobs.Status) bool {
+			return s == jobs.StatusSucceeded
+		}))
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"), feedTestNoExternalConnection)
+}
+
 func TestChangefeedOnlyInitialScanCSV(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -7221,7 +9275,7 @@ CREATE CHANGEFEED
 WITH schema_change_policy='stop'
 AS SELECT * FROM `+fromClause+` 
 WHERE e IN ('open', 'closed') AND event_op() != 'delete'`)
-			defer closeFeed(t, feed)
+			defer closeFeed(t, digestFeed)
 
 			assertPayloads(t, feed, []string{
 				topic + `: [2, "two"]->{"a": 2, "b": "two", "c": null, "e": "closed"}`,
@@ -7249,6 +9303,41 @@ INSERT INTO foo (a, b, e) VALUES (3, 'tres', 'closed'); -- should be emitted
 	})
 }
 
+// TestChangefeedEventMetadataFunctions verifies that projections can tell
+// rows emitted by the initial scan from those emitted for writes.
+func TestChangefeedEventMetadataFunctions(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, status STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (0, 'open'), (1, 'open')`)
+
+		feed := feed(t, f, `
+CREATE CHANGEFEED AS
+SELECT a, status, event_op() AS op, event_is_backfill() AS backfill,
+  event_mvcc_timestamp() = crdb_internal_mvcc_timestamp AS mvcc
+FROM foo
+WHERE event_is_backfill() OR status IS DISTINCT FROM (cdc_prev).status`)
+		defer closeFeed(t, digestFeed)
+
+		assertPayloads(t, feed, []string{
+			`foo: [0]->{"a": 0, "backfill": true, "mvcc": true, "op": "insert", "status": "open"}`,
+			`foo: [1]->{"a": 1, "backfill": true, "mvcc": true, "op": "insert", "status": "open"}`,
+		})
+
+		// Only the row whose status changed is emitted.
+		sqlDB.Exec(t, `UPDATE foo SET status = 'open' WHERE a = 0`)
+		sqlDB.Exec(t, `UPDATE foo SET status = 'closed' WHERE a = 1`)
+		assertPayloads(t, feed, []string{
+			`foo: [1]->{"a": 1, "backfill": false, "mvcc": true, "op": "update", "status": "closed"}`,
+		})
+	}
+
+	cdcTest(t, testFn)
+}
+
 // Some predicates and projections can be verified when creating changefeed.
 // The types of errors that can be detected early on is restricted to simple checks
 // (such as type checking, non-existent columns, etc).  More complex errors detected
@@ -8187,6 +10276,78 @@ func TestPartitionSpans(t *testing.T) {
 	}
 }
 
+func TestAssignSpans(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	mkPart := func(n base.SQLInstanceID, spans ...roachpb.Span) sql.SpanPartition {
+		return sql.SpanPartition{SQLInstanceID: n, Spans: spans}
+	}
+	mkSpan := func(start, end string) roachpb.Span {
+		return roachpb.Span{Key: []byte(start), EndKey: []byte(end)}
+	}
+	spans := func(s ...roachpb.Span) roachpb.Spans {
+		return s
+	}
+	const sensitivity = 0.01
+
+	t.Run("write_rate", func(t *testing.T) {
+		// The first table is hot, and shares its node with two other ranges.
+		writeRates := map[string]float64{"a": 100, "b": 10, "c": 10, "d": 1, "e": -1}
+		estimator := knobLoadEstimator(func(rangeSpan roachpb.Span) rangeLoad {
+			return rangeLoad{writeRate: writeRates[string(rangeSpan.Key)]}
+		})
+		resolver := &echoResolver{result: []roachpb.Spans{
+			spans(mkSpan("a", "b"), mkSpan("b", "c"), mkSpan("c", "d")),
+			spans(mkSpan("d", "e")),
+			spans(mkSpan("e", "f")),
+		}}
+		p, err := assignSpansByLoad(context.Background(), resolver, estimator, sensitivity,
+			[]sql.SpanPartition{
+				mkPart(1, mkSpan("a", "d")),
+				mkPart(2, mkSpan("d", "e")),
+				mkPart(3, mkSpan("e", "f")),
+			},
+			func(l rangeLoad) float64 { return l.writeRate })
+		require.NoError(t, err)
+		// The hot range is left alone on an aggregator. The write rate of the
+		// last range is unknown, and weighed as the average.
+		require.Equal(t, []sql.SpanPartition{
+			mkPart(1, mkSpan("b", "e")),
+			mkPart(2, mkSpan("a", "b")),
+			mkPart(3, mkSpan("e", "f")),
+		}, p)
+	})
+
+	t.Run("locality_bucketed", func(t *testing.T) {
+		mkInstance := func(n base.SQLInstanceID, region string) sqlinstance.InstanceInfo {
+			return sqlinstance.InstanceInfo{
+				InstanceID: n,
+				Locality:   roachpb.Locality{Tiers: []roachpb.Tier{{Key: "region", Value: region}}},
+			}
+		}
+		resolver := &echoResolver{result: []roachpb.Spans{
+			spans(mkSpan("a", "b"), mkSpan("b", "c"), mkSpan("c", "d"), mkSpan("d", "e")),
+			spans(mkSpan("e", "f")),
+		}}
+		p, err := assignSpansByLocality(context.Background(), resolver, sensitivity,
+			[]sql.SpanPartition{
+				mkPart(1, mkSpan("a", "e")),
+				mkPart(3, mkSpan("e", "f")),
+			},
+			[]sqlinstance.InstanceInfo{
+				mkInstance(1, "us-east1"), mkInstance(2, "us-east1"), mkInstance(3, "us-west1"),
+			})
+		require.NoError(t, err)
+		// The ranges of the first node are spread across its region, but not
+		// to the node in the other region.
+		require.Equal(t, []sql.SpanPartition{
+			mkPart(1, mkSpan("c", "e")),
+			mkPart(2, mkSpan("a", "c")),
+			mkPart(3, mkSpan("e", "f")),
+		}, p)
+	})
+}
+
 func TestChangefeedMetricsScopeNotice(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -0,0 +1,209 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/utilccl"
+	"github.com/cockroachdb/cockroach/pkg/jobs"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/volatility"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/json"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+)
+
+// changefeedUsage summarizes the running changefeeds of the cluster for the
+// crdb_internal.changefeed_usage builtin, so that capacity and licensing
+// dashboards don't have to decode the payload of every changefeed job.
+type changefeedUsage struct {
+	active int64
+	// bySink, byFormat, byEnvelope and byOption count the changefeeds by sink
+	// scheme, format, envelope and by each option they were created with. A
+	// changefeed emitting to several sinks of the same scheme counts once.
+	bySink, byFormat, byEnvelope, byOption map[string]int64
+	// emittedMessagesPerSecond and emittedBytesPerSecond are the sums of the
+	// rates at which the running changefeeds emit, as last recorded in their
+	// progress.
+	emittedMessagesPerSecond, emittedBytesPerSecond float64
+	// unreadable is the number of running changefeeds whose jobs couldn't be
+	// decoded, which are left out of the other counts rather than failing the
+	// builtin.
+	unreadable int64
+}
+
+func makeChangefeedUsage() changefeedUsage {
+	return changefeedUsage{
+		bySink:     make(map[string]int64),
+		byFormat:   make(map[string]int64),
+		byEnvelope: make(map[string]int64),
+		byOption:   make(map[string]int64),
+	}
+}
+
+// add accounts for a running changefeed. progress is nil if the job has yet
+// to record any.
+func (u *changefeedUsage) add(
+	details jobspb.ChangefeedDetails, progress *jobspb.ChangefeedProgress,
+) error {
+	encodingOpts, err := changefeedbase.MakeStatementOptions(details.Opts).GetEncodingOptions()
+	if err != nil {
+		return err
+	}
+	schemes := make(map[string]struct{})
+	for _, sinkURI := range append([]string{details.SinkURI}, details.AdditionalSinkURIs...) {
+		scheme := `sinkless`
+		if sinkURI != `` {
+			// Only the scheme is reported, never the URI, which may hold
+			// credentials.
+			parsed, err := url.Parse(sinkURI)
+			if err != nil {
+				return errors.Wrap(err, `parsing sink URI`)
+			}
+			scheme = parsed.Scheme
+		}
+		schemes[scheme] = struct{}{}
+	}
+
+	u.active++
+	u.byFormat[string(encodingOpts.Format)]++
+	u.byEnvelope[string(encodingOpts.Envelope)]++
+	for opt := range details.Opts {
+		u.byOption[opt]++
+	}
+	for scheme := range schemes {
+		u.bySink[scheme]++
+	}
+	if progress != nil {
+		u.emittedMessagesPerSecond += progress.Throughput.EmittedMessagesPerSecond
+		u.emittedBytesPerSecond += progress.Throughput.EmittedBytesPerSecond
+	}
+	return nil
+}
+
+func (u *changefeedUsage) toJSON() (json.JSON, error) {
+	counts := func(m map[string]int64) json.JSON {
+		b := json.NewObjectBuilder(len(m))
+		for k, v := range m {
+			b.Add(k, json.FromInt64(v))
+		}
+		return b.Build()
+	}
+	messagesPerSecond, err := json.FromFloat64(u.emittedMessagesPerSecond)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSecond, err := json.FromFloat64(u.emittedBytesPerSecond)
+	if err != nil {
+		return nil, err
+	}
+	b := json.NewObjectBuilder(8)
+	b.Add(`active_changefeeds`, json.FromInt64(u.active))
+	b.Add(`unreadable_changefeeds`, json.FromInt64(u.unreadable))
+	b.Add(`sinks`, counts(u.bySink))
+	b.Add(`formats`, counts(u.byFormat))
+	b.Add(`envelopes`, counts(u.byEnvelope))
+	b.Add(`options`, counts(u.byOption))
+	b.Add(`emitted_messages_per_second`, messagesPerSecond)
+	b.Add(`emitted_bytes_per_second`, bytesPerSecond)
+	return b.Build(), nil
+}
+
+// addJob accounts for the running changefeed job with the given payload and
+// progress, the latter of which is NULL if the job has yet to record any.
+func (u *changefeedUsage) addJob(payloadBytes, progressBytes tree.Datum) error {
+	payload, err := jobs.UnmarshalPayload(payloadBytes)
+	if err != nil {
+		return err
+	}
+	details := payload.GetChangefeed()
+	if details == nil {
+		return errors.AssertionFailedf(`job has no changefeed details`)
+	}
+	var changefeedProgress *jobspb.ChangefeedProgress
+	if progressBytes != tree.DNull {
+		progress, err := jobs.UnmarshalProgress(progressBytes)
+		if err != nil {
+			return err
+		}
+		changefeedProgress = progress.GetChangefeed()
+	}
+	return u.add(*details, changefeedProgress)
+}
+
+const runningChangefeedsQuery = `
+SELECT id, payload, progress
+FROM crdb_internal.system_jobs
+WHERE job_type = $1 AND status = $2`
+
+// getChangefeedUsage implements the crdb_internal.changefeed_usage builtin.
+func getChangefeedUsage(ctx context.Context, evalCtx *eval.Context) (json.JSON, error) {
+	// The usage covers the changefeeds of every user.
+	isAdmin, err := evalCtx.SessionAccessor.HasAdminRole(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, pgerror.New(pgcode.InsufficientPrivilege,
+			`only users with the admin role can view changefeed usage`)
+	}
+
+	it, err := evalCtx.Planner.QueryIteratorEx(ctx, `crdb_internal.changefeed_usage`,
+		sessiondata.NodeUserSessionDataOverride, runningChangefeedsQuery,
+		jobspb.TypeChangefeed.String(), string(jobs.StatusRunning))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = it.Close() }()
+
+	usage := makeChangefeedUsage()
+	var ok bool
+	for ok, err = it.Next(ctx); ok; ok, err = it.Next(ctx) {
+		row := it.Cur()
+		// A job which can't be decoded is counted as unreadable rather than
+		// failing the usage of every other changefeed.
+		if err := usage.addJob(row[1], row[2]); err != nil {
+			usage.unreadable++
+			log.Warningf(ctx, "changefeed usage: skipping job %s: %v", row[0], err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usage.toJSON()
+}
+
+func init() {
+	utilccl.RegisterCCLBuiltin("crdb_internal.changefeed_usage",
+		`Returns the number of running changefeeds by sink scheme, format, envelope `+
+			`and option, and the rates at which they emit messages and bytes.`,
+		tree.Overload{
+			Types:      tree.ParamTypes{},
+			ReturnType: tree.FixedReturnType(types.Jsonb),
+			Fn: func(ctx context.Context, evalCtx *eval.Context, _ tree.Datums) (tree.Datum, error) {
+				usage, err := getChangefeedUsage(ctx, evalCtx)
+				if err != nil {
+					return nil, err
+				}
+				return tree.NewDJSON(usage), nil
+			},
+			Class:      tree.NormalClass,
+			Info:       "Returns usage statistics of the running changefeeds of the cluster.",
+			Volatility: volatility.Volatile,
+		})
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdctest"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
+	"github.com/cockroachdb/cockroach/pkg/util/json"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangefeedUsageAggregation(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	usage := makeChangefeedUsage()
+	require.NoError(t, usage.add(jobspb.ChangefeedDetails{
+		SinkURI: `kafka://broker-1:9092?topic_prefix=a`,
+		Opts:    map[string]string{`diff`: ``, `resolved`: `10s`},
+	}, &jobspb.ChangefeedProgress{
+		Throughput: jobspb.ChangefeedProgress_Throughput{
+			EmittedMessagesPerSecond: 15, EmittedBytesPerSecond: 1500.5,
+		},
+	}))
+	// The sinks of a changefeed count once per scheme, and changefeeds which
+	// have yet to record progress have yet to emit.
+	require.NoError(t, usage.add(jobspb.ChangefeedDetails{
+		SinkURI:            `kafka://broker-2:9092`,
+		AdditionalSinkURIs: []string{`kafka://broker-3:9092`, `webhook-https://example.com`},
+		Opts:               map[string]string{`format`: `avro`, `envelope`: `key_only`, `resolved`: ``},
+	}, nil))
+	// Jobs which can't be decoded are left out of the counts entirely.
+	require.Error(t, usage.add(jobspb.ChangefeedDetails{
+		SinkURI: `kafka://broker-1:9092`,
+		Opts:    map[string]string{`format`: `avro`, `envelope`: `row`},
+	}, nil))
+	require.Error(t, usage.addJob(tree.NewDBytes(`not a payload`), tree.DNull))
+	require.Error(t, usage.addJob(tree.NewDString(``), tree.DNull))
+
+	expected, err := json.ParseJSON(`{
+		"active_changefeeds": 2,
+		"emitted_bytes_per_second": 1500.5,
+		"emitted_messages_per_second": 15,
+		"envelopes": {"key_only": 1, "wrapped": 1},
+		"formats": {"avro": 1, "json": 1},
+		"options": {"diff": 1, "envelope": 1, "format": 1, "resolved": 2},
+		"sinks": {"kafka": 2, "webhook-https": 1},
+		"unreadable_changefeeds": 0
+	}`)
+	require.NoError(t, err)
+	actual, err := usage.toJSON()
+	require.NoError(t, err)
+	require.Equal(t, expected.String(), actual.String())
+}
+
+func TestChangefeedUsageBuiltin(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (0)`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH diff`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{
+			`foo: [0]->{"after": {"a": 0}, "before": null}`,
+		})
+
+		sqlDB.CheckQueryResultsRetry(t, `
+SELECT u->>'active_changefeeds', u->'sinks'->>'kafka', u->'formats'->>'json',
+	u->'envelopes'->>'wrapped', u->'options'->>'diff'
+FROM (SELECT crdb_internal.changefeed_usage() AS u)`,
+			[][]string{{`1`, `1`, `1`, `1`, `1`}},
+		)
+
+		sqlDB.Exec(t, `CREATE USER regularUser`)
+		asUser(t, f, `regularUser`, func(userDB *sqlutils.SQLRunner) {
+			userDB.ExpectErr(t, `only users with the admin role can view changefeed usage`,
+				`SELECT crdb_internal.changefeed_usage()`)
+		})
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
@@ -10,11 +10,17 @@ package changefeedbase
 
 import (
 	"context"
+	"net"
 
 	"github.com/cockroachdb/cockroach/pkg/jobs"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/lease"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/grpcutil"
 	"github.com/cockroachdb/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // FailureType is the reason for the changefeed failure that maps to the
@@ -35,6 +41,92 @@ const (
 	UnknownError FailureType = "unknown_error"
 )
 
+// ErrorClass is the class of a changefeed error. The class of the last
+// retryable error a changefeed encountered is recorded in its running status
+// and shown by SHOW CHANGEFEED JOBS, so that operators can alert on the cause
+// of retries.
+type ErrorClass = string
+
+const (
+	// ErrorClassAuth applies to errors authenticating with, or being authorized
+	// by, a sink or schema registry.
+	ErrorClassAuth ErrorClass = "auth"
+
+	// ErrorClassNetwork applies to errors connecting to sinks or to other nodes,
+	// and to sinks which are unavailable or timed out.
+	ErrorClassNetwork ErrorClass = "network"
+
+	// ErrorClassQuota applies to errors due to exhausted memory budgets, and to
+	// sinks which rejected messages because of their quotas or size limits.
+	ErrorClassQuota ErrorClass = "quota"
+
+	// ErrorClassSchema applies to errors due to schema changes of the watched
+	// tables, and to schemas rejected by a schema registry.
+	ErrorClassSchema ErrorClass = "schema"
+
+	// ErrorClassInternal applies to all errors not otherwise classified.
+	ErrorClassInternal ErrorClass = "internal"
+)
+
+// errorClasses are the classes ClassifyError checks for explicit marks.
+var errorClasses = []ErrorClass{
+	ErrorClassAuth, ErrorClassNetwork, ErrorClassQuota, ErrorClassSchema, ErrorClassInternal,
+}
+
+type classifiedError struct {
+	class ErrorClass
+}
+
+func (e *classifiedError) Error() string {
+	return e.class + " changefeed error"
+}
+
+// MarkErrorClass marks the given error as being of the given class. Sinks mark
+// the errors they can classify better than ClassifyError, such as those
+// identified by the status codes of their responses.
+func MarkErrorClass(cause error, class ErrorClass) error {
+	if cause == nil {
+		return nil
+	}
+	return errors.Mark(cause, &classifiedError{class: class})
+}
+
+// ClassifyError returns the class of the given error, which is the class it
+// was marked with if any.
+func ClassifyError(err error) ErrorClass {
+	for _, class := range errorClasses {
+		if errors.Is(err, &classifiedError{class: class}) {
+			return class
+		}
+	}
+
+	switch status.Code(errors.UnwrapAll(err)) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return ErrorClassAuth
+	case codes.ResourceExhausted:
+		return ErrorClassQuota
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return ErrorClassNetwork
+	}
+
+	switch pgerror.GetPGCode(err) {
+	case pgcode.InsufficientPrivilege, pgcode.InvalidAuthorizationSpecification,
+		pgcode.InvalidPassword:
+		return ErrorClassAuth
+	case pgcode.OutOfMemory, pgcode.ConfigurationLimitExceeded:
+		return ErrorClassQuota
+	case pgcode.UndefinedTable, pgcode.UndefinedColumn, pgcode.UndefinedObject,
+		pgcode.WrongObjectType:
+		return ErrorClassSchema
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || grpcutil.IsClosedConnection(err) {
+		return ErrorClassNetwork
+	}
+	return ErrorClassInternal
+}
+
 // Used for categorizing errors in logging
 type taggedError struct {
 	wrapped error
@@ -102,6 +194,11 @@ func MarkRetryableError(cause error) error {
 	return errors.Mark(cause, &retryableError{})
 }
 
+// IsRetryableError returns whether the given error was marked as retryable.
+func IsRetryableError(err error) bool {
+	return errors.Is(err, &retryableError{})
+}
+
 // AsTerminalError determines if the cause error is a terminal changefeed
 // error.  Returns non-nil error if changefeed should terminate with the
 // returned error.
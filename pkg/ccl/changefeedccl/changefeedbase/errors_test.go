@@ -0,0 +1,51 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedbase
+
+import (
+	"net"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifyError(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	for _, tc := range []struct {
+		err   error
+		class ErrorClass
+	}{
+		{errors.New("boom"), ErrorClassInternal},
+		// Marks take precedence over the classification of the error.
+		{MarkErrorClass(errors.New("boom"), ErrorClassSchema), ErrorClassSchema},
+		{MarkErrorClass(status.Error(codes.Unavailable, "boom"), ErrorClassAuth), ErrorClassAuth},
+		// Marks survive wrapping, including as retryable errors.
+		{errors.Wrap(MarkRetryableError(
+			MarkErrorClass(errors.New("boom"), ErrorClassQuota)), "emitting"), ErrorClassQuota},
+		{status.Error(codes.PermissionDenied, "boom"), ErrorClassAuth},
+		{status.Error(codes.ResourceExhausted, "boom"), ErrorClassQuota},
+		{errors.Wrap(status.Error(codes.Unavailable, "boom"), "dialing"), ErrorClassNetwork},
+		{pgerror.New(pgcode.InsufficientPrivilege, "boom"), ErrorClassAuth},
+		{pgerror.New(pgcode.OutOfMemory, "memory budget exceeded"), ErrorClassQuota},
+		{pgerror.New(pgcode.UndefinedTable, "boom"), ErrorClassSchema},
+		{errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "sink"),
+			ErrorClassNetwork},
+	} {
+		require.Equal(t, tc.class, ClassifyError(tc.err), "%v", tc.err)
+	}
+}
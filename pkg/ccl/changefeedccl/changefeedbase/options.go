@@ -9,13 +9,19 @@
 package changefeedbase
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/errors"
 )
 
@@ -44,6 +50,30 @@ type FormatType string
 // OnErrorType configures the job behavior when an error occurs.
 type OnErrorType string
 
+// ContractViolationPolicy configures the job behavior when the value of a
+// message violates its output contract.
+type ContractViolationPolicy string
+
+// OnCompletionAction configures what the changefeed does with its sink once
+// it completes.
+type OnCompletionAction string
+
+// TruncatePolicy configures how a changefeed handles the truncation of a
+// target table.
+type TruncatePolicy string
+
+// OfflinePolicy configures how a changefeed handles a target table which is
+// taken offline.
+type OfflinePolicy string
+
+// PTSExpirationAction configures the job behavior when its protected
+// timestamp record is older than gc_protect_expires_after.
+type PTSExpirationAction string
+
+// SchemaChangeInProgressPolicy configures how a changefeed is created when a
+// target table has a schema change in progress.
+type SchemaChangeInProgressPolicy string
+
 // SchemaChangeEventClass defines a set of schema change event types which
 // trigger the action defined by the SchemaChangeEventPolicy.
 type SchemaChangeEventClass string
@@ -56,6 +86,32 @@ type SchemaChangePolicy string
 // include virtual columns in an event
 type VirtualColumnVisibility string
 
+// MVCCTimestampFormat configures how the mvcc_timestamp option encodes the
+// MVCC timestamp of a change in its message.
+type MVCCTimestampFormat string
+
+// KeyFormat configures how the primary key of a row is encoded in the key
+// of a message.
+type KeyFormat string
+
+// CloudEventsMode configures how the attributes of CloudEvents are sent by
+// sinks which support both modes of the CloudEvents protocol bindings.
+type CloudEventsMode string
+
+// AvroDecimalEncoding configures how DECIMAL columns are encoded in avro.
+type AvroDecimalEncoding string
+
+// AvroIntervalEncoding configures how INTERVAL columns are encoded in avro.
+type AvroIntervalEncoding string
+
+// AvroGeospatialEncoding configures how GEOMETRY and GEOGRAPHY columns are
+// encoded in avro.
+type AvroGeospatialEncoding string
+
+// AvroSubjectNameStrategy configures the subjects under which avro schemas
+// are registered in the schema registry.
+type AvroSubjectNameStrategy string
+
 // InitialScanType configures whether the changefeed will perform an
 // initial scan, and the type of initial scan that it will perform
 type InitialScanType int
@@ -74,35 +130,209 @@ const (
 // Constants for the options.
 const (
 	OptAvroSchemaPrefix         = `avro_schema_prefix`
+	OptAvroDecimal              = `avro_decimal`
+	OptAvroUnboundedDecimal     = `avro_unbounded_decimal`
+	OptAvroInterval             = `avro_interval`
+	OptAvroGeospatial           = `avro_geospatial`
+	OptAvroSubjectNameStrategy  = `avro_subject_name_strategy`
+	OptAvroSubjectTemplate      = `avro_subject_template`
 	OptConfluentSchemaRegistry  = `confluent_schema_registry`
 	OptCursor                   = `cursor`
 	OptEndTime                  = `end_time`
 	OptEnvelope                 = `envelope`
+	OptCloudEventsMode          = `cloudevents_mode`
 	OptFormat                   = `format`
 	OptFullTableName            = `full_table_name`
+	OptClusterAlias             = `cluster_alias`
+	OptIncludeTenantName        = `include_tenant_name`
 	OptKeyInValue               = `key_in_value`
+	OptKeyFormat                = `key_format`
+	OptKeyDelimiter             = `key_delimiter`
+	OptBareMetadataKey          = `bare_metadata_key`
+	OptJSONSchema               = `json_schema`
 	OptTopicInValue             = `topic_in_value`
 	OptResolvedTimestamps       = `resolved`
+	OptResolvedPerTable         = `resolved_per_table`
 	OptMinCheckpointFrequency   = `min_checkpoint_frequency`
 	OptUpdatedTimestamps        = `updated`
 	OptMVCCTimestamps           = `mvcc_timestamp`
+	OptLatencyTimestamps        = `latency_timestamps`
+	OptEnumCodes                = `enum_codes`
+	OptContentHash              = `content_hash`
+	OptSourceGeneration         = `source_generation`
 	OptDiff                     = `diff`
+	OptDeleteBeforeImage        = `delete_before_image`
+	OptMarkTTLDeletes           = `mark_ttl_deletes`
+	OptDeleteAfterEmit          = `delete_after_emit`
 	OptCompression              = `compression`
 	OptSchemaChangeEvents       = `schema_change_events`
 	OptSchemaChangePolicy       = `schema_change_policy`
 	OptSplitColumnFamilies      = `split_column_families`
+	OptFamilyTopicFormat        = `family_topic_format`
+	OptMergeColumnFamilies      = `merge_column_families`
 	OptProtectDataFromGCOnPause = `protect_data_from_gc_on_pause`
 	OptExpirePTSAfter           = `gc_protect_expires_after`
+	OptPTSExpirationAction      = `gc_protect_expiration_action`
 	OptWebhookAuthHeader        = `webhook_auth_header`
 	OptWebhookClientTimeout     = `webhook_client_timeout`
 	OptOnError                  = `on_error`
 	OptMetricsScope             = `metrics_label`
 	OptUnordered                = `unordered`
 	OptVirtualColumns           = `virtual_columns`
+	OptSchemaChangeInProgress   = `schema_change_in_progress`
+
+	OptBatchEnvelopeSize = `batch_envelope_size`
+	OptDryRun            = `dry_run`
+	// OptSink selects the sink of a changefeed created without an INTO
+	// clause. The only sink which can be selected this way is the null sink,
+	// which discards every message.
+	OptSink = `sink`
+	// OptRestoreCheckpoint resumes the changefeed from a checkpoint exported
+	// by SHOW CHANGEFEED JOB ... WITH CHECKPOINT.
+	OptRestoreCheckpoint = `restore_checkpoint`
+	// OptTenant names the secondary tenant whose tables a changefeed created
+	// in the system tenant watches.
+	OptTenant = `tenant`
+
+	OptRetryMinBackoff             = `retry_min_backoff`
+	OptRetryMaxBackoff             = `retry_max_backoff`
+	OptRetryMaxAttemptsBeforePause = `retry_max_attempts_before_pause`
+
+	// OptMaxEmittedBytesPerDay pauses the changefeed once it has written more
+	// than the given number of bytes, after compression, to its sink within a
+	// day. The day is recorded in the job progress, so resuming the
+	// changefeed doesn't restore the quota.
+	OptMaxEmittedBytesPerDay = `max_emitted_bytes_per_day`
+
+	// OptSampleRate emits only the changes of a sample of the rows of the
+	// watched tables, chosen deterministically by the hash of their primary
+	// key, e.g. sample_rate=0.01 emits the changes of about 1% of rows.
+	OptSampleRate = `sample_rate`
+
+	// OptEmissionWindow restricts the emission of changes to a daily window of
+	// time, e.g. emission_window='22:00-06:00 UTC'. Outside of the window, the
+	// changefeed holds changes, up to its memory budget, and emits them once
+	// the window opens.
+	OptEmissionWindow = `emission_window`
+
+	// OptCoalesceWindow collapses the updates to a row within a window of
+	// time, e.g. coalesce_window='500ms', into a single message holding its
+	// latest value, trading latency for fewer messages on hot rows. It is
+	// not usable with diff or delete_before_image, since the message of the
+	// latest update carries the before value of that update only.
+	OptCoalesceWindow = `coalesce_window`
+
+	// OptDeadLetterTable names a table of the cluster, e.g.
+	// dead_letter_table='db.dlq', into which the events which fail to be
+	// encoded are written, along with their error, instead of failing the
+	// changefeed.
+	OptDeadLetterTable = `dead_letter_table`
+
+	// OptContentDigestTable names a table of the cluster, e.g.
+	// content_digest_table='db.digests', into which the digests of the
+	// messages emitted by the changefeed under the content_hash option are
+	// written with each resolved timestamp.
+	OptContentDigestTable = `content_digest_table`
+
+	// OptOutputContract is a JSON Schema, e.g.
+	// output_contract='{"type": "object", "required": ["after"]}', to which
+	// the values of messages must conform. Messages which violate it are not
+	// emitted, and are handled according to OptOnContractViolation.
+	OptOutputContract      = `output_contract`
+	OptOnContractViolation = `on_contract_violation`
+
+	// OptTraceContext stamps the messages sent to kafka, webhook and pubsub
+	// sinks with the W3C traceparent of the tracing span which emitted them,
+	// as a header or attribute, so that their downstream processing can be
+	// stitched into the trace of the changefeed. Only the messages emitted
+	// within sampled traces carry one.
+	OptTraceContext = `trace_context`
+
+	// OptOnCompletion finalizes or cleans up the sink of a changefeed which
+	// completes, i.e. one with initial_scan='only' or an end_time, once it
+	// has emitted all of its changes.
+	OptOnCompletion = `on_completion`
+
+	// OptOnTruncate configures how a changefeed handles a TRUNCATE of one of
+	// its target tables, which replaces the primary index the changefeed
+	// watches with a new, empty, one.
+	OptOnTruncate = `on_truncate`
+
+	// OptOnOffline configures how a changefeed handles one of its target
+	// tables being taken offline, e.g. by an IMPORT INTO.
+	OptOnOffline = `on_offline`
+
+	// OptSettings overrides changefeed cluster settings for the changefeed,
+	// e.g. settings='changefeed.memory.per_changefeed_limit=1GiB'. Raising a
+	// setting above its value for the cluster requires the admin role or the
+	// MODIFYCLUSTERSETTING privilege.
+	OptSettings = `settings`
 
 	OptVirtualColumnsOmitted VirtualColumnVisibility = `omitted`
 	OptVirtualColumnsNull    VirtualColumnVisibility = `null`
 
+	// OptMVCCTimestampDecimal encodes the MVCC timestamp as a decimal string
+	// of the HLC timestamp, e.g. "1690000000123456789.0000000001".
+	OptMVCCTimestampDecimal MVCCTimestampFormat = `decimal`
+	// OptMVCCTimestampSplit encodes the wall time and logical component of
+	// the MVCC timestamp as separate integer fields, mvcc_timestamp_wall and
+	// mvcc_timestamp_logical.
+	OptMVCCTimestampSplit MVCCTimestampFormat = `split`
+	// OptMVCCTimestampNanos encodes the wall time of the MVCC timestamp as an
+	// integer number of nanoseconds since the Unix epoch, leaving out its
+	// logical component.
+	OptMVCCTimestampNanos MVCCTimestampFormat = `nanos`
+
+	// OptKeyFormatArray encodes the key as a JSON array of the primary key
+	// column values, in index order.
+	OptKeyFormatArray KeyFormat = `array`
+	// OptKeyFormatObject encodes the key as a JSON object from primary key
+	// column name to value.
+	OptKeyFormatObject KeyFormat = `object`
+	// OptKeyFormatDelimited encodes the key as the text of the primary key
+	// column values joined by the key_delimiter option. Backslashes and
+	// delimiters within values are escaped with a backslash, and NULL values
+	// are encoded as \N.
+	OptKeyFormatDelimited KeyFormat = `delimited`
+	// OptKeyFormatHash encodes the key as the hex SHA-256 hash of its array
+	// encoding.
+	OptKeyFormatHash KeyFormat = `hash`
+
+	// DefaultKeyDelimiter is the separator used by key_format=delimited when
+	// key_delimiter is not specified.
+	DefaultKeyDelimiter = `/`
+
+	// OptAvroDecimalColumn encodes decimals as the avro decimal logical type,
+	// with the precision and scale of the column.
+	OptAvroDecimalColumn AvroDecimalEncoding = `column`
+	// OptAvroDecimalString encodes decimals as strings, which is exact for any
+	// precision.
+	OptAvroDecimalString AvroDecimalEncoding = `string`
+
+	// OptAvroIntervalISO8601 encodes intervals as ISO 8601 duration strings.
+	OptAvroIntervalISO8601 AvroIntervalEncoding = `iso8601`
+	// OptAvroIntervalMicros encodes intervals as a number of microseconds,
+	// assuming 30 day months and 24 hour days.
+	OptAvroIntervalMicros AvroIntervalEncoding = `micros`
+
+	// OptAvroGeospatialEWKB encodes spatial objects as EWKB bytes.
+	OptAvroGeospatialEWKB AvroGeospatialEncoding = `ewkb`
+	// OptAvroGeospatialGeoJSON encodes spatial objects as GeoJSON strings.
+	OptAvroGeospatialGeoJSON AvroGeospatialEncoding = `geojson`
+
+	// OptAvroSubjectNameStrategyTopic registers schemas under the subject
+	// <topic>-key or <topic>-value, like the TopicNameStrategy of Confluent
+	// serializers.
+	OptAvroSubjectNameStrategyTopic AvroSubjectNameStrategy = `topic`
+	// OptAvroSubjectNameStrategyRecord registers schemas under the subject
+	// of the fully-qualified name of their record, like the
+	// RecordNameStrategy of Confluent serializers.
+	OptAvroSubjectNameStrategyRecord AvroSubjectNameStrategy = `record`
+	// OptAvroSubjectNameStrategyTopicRecord registers schemas under the
+	// subject <topic>-<record>, like the TopicRecordNameStrategy of Confluent
+	// serializers.
+	OptAvroSubjectNameStrategyTopicRecord AvroSubjectNameStrategy = `topic_record`
+
 	// OptSchemaChangeEventClassColumnChange corresponds to all schema change
 	// events which add or remove any column.
 	OptSchemaChangeEventClassColumnChange SchemaChangeEventClass = `column_changes`
@@ -139,20 +369,104 @@ const (
 
 	OptInitialScanOnly = `initial_scan_only`
 
+	// OptEndOfStream, given to ALTER CHANGEFEED ... DROP, emits a message
+	// marking the end of the stream of changes for each dropped target, at
+	// the high-water of the changefeed once it resumes.
+	OptEndOfStream = `end_of_stream`
+
 	OptEnvelopeKeyOnly       EnvelopeType = `key_only`
 	OptEnvelopeRow           EnvelopeType = `row`
 	OptEnvelopeDeprecatedRow EnvelopeType = `deprecated_row`
 	OptEnvelopeWrapped       EnvelopeType = `wrapped`
 	OptEnvelopeBare          EnvelopeType = `bare`
+	// OptEnvelopeCloudEvents wraps each message in a CNCF CloudEvents 1.0
+	// event, whose data is the wrapped envelope of the row.
+	OptEnvelopeCloudEvents EnvelopeType = `cloudevents`
+	// OptEnvelopeGoldenGate emits each row in the JSON format of the Oracle
+	// GoldenGate Kafka handler, with its operation type, timestamps and
+	// before and after images.
+	OptEnvelopeGoldenGate EnvelopeType = `goldengate`
+
+	// OptCloudEventsModeStructured sends each event, with its attributes and
+	// data, as a single JSON document.
+	OptCloudEventsModeStructured CloudEventsMode = `structured`
+	// OptCloudEventsModeBinary sends the attributes of each event as message
+	// headers, and its data as the message value.
+	OptCloudEventsModeBinary CloudEventsMode = `binary`
 
 	OptFormatJSON    FormatType = `json`
 	OptFormatAvro    FormatType = `avro`
 	OptFormatCSV     FormatType = `csv`
 	OptFormatParquet FormatType = `parquet`
+	// OptFormatMsgpack encodes messages as MessagePack. They have the same
+	// structure as those of format=json, with map keys in ascending byte order.
+	OptFormatMsgpack FormatType = `msgpack`
 
 	OptOnErrorFail  OnErrorType = `fail`
 	OptOnErrorPause OnErrorType = `pause`
 
+	// OptOnContractViolationPause pauses the changefeed on the first message
+	// which violates its output contract.
+	OptOnContractViolationPause ContractViolationPolicy = `pause`
+	// OptOnContractViolationDeadLetter writes the events whose messages
+	// violate the output contract into the dead letter table.
+	OptOnContractViolationDeadLetter ContractViolationPolicy = `dead_letter`
+
+	// OptOnCompletionNoop leaves the sink as it is.
+	OptOnCompletionNoop OnCompletionAction = `noop`
+	// OptOnCompletionEmitEOF emits an end-of-stream marker to the topic of
+	// each target.
+	OptOnCompletionEmitEOF OnCompletionAction = `emit_eof`
+	// OptOnCompletionDeleteTopics deletes, along with all of the messages
+	// they hold, the kafka topics which the changefeed created under the
+	// auto_create_topics sink parameter, e.g. the temporary topics of a
+	// backfill which has been consumed. Topics which existed before the
+	// changefeed are never deleted. It requires auto_create_topics=true.
+	OptOnCompletionDeleteTopics OnCompletionAction = `delete_topics`
+
+	// OptOnTruncateFail fails the changefeed once a target table is
+	// truncated.
+	OptOnTruncateFail TruncatePolicy = `fail`
+	// OptOnTruncateRescan restarts the changefeed at the truncation, watching
+	// the new primary index of the table, which is scanned as of the
+	// truncation.
+	OptOnTruncateRescan TruncatePolicy = `rescan`
+	// OptOnTruncateEmitMarker emits a truncation marker to the topic of the
+	// truncated table, and then restarts the changefeed like
+	// OptOnTruncateRescan.
+	OptOnTruncateEmitMarker TruncatePolicy = `emit_marker`
+
+	// OptOnOfflineFail fails the changefeed once a target table is taken
+	// offline.
+	OptOnOfflineFail OfflinePolicy = `fail`
+	// OptOnOfflineWait pauses the emission of the changefeed while a target
+	// table is offline, and resumes it, re-scanning the table, once the table
+	// is back online. The emission of all the targets of the changefeed is
+	// paused, not only that of the offline table, so that the high-water of
+	// the changefeed keeps covering all of its targets.
+	OptOnOfflineWait OfflinePolicy = `wait`
+
+	// OptPTSExpirationActionCancel cancels the paused changefeed once its
+	// protected timestamp expires.
+	OptPTSExpirationActionCancel PTSExpirationAction = `cancel`
+	// OptPTSExpirationActionRelease releases the protected timestamp of the
+	// paused changefeed once it expires, leaving the changefeed paused. The
+	// data it has yet to emit may then be garbage collected.
+	OptPTSExpirationActionRelease PTSExpirationAction = `release`
+
+	// OptSchemaChangeInProgressProceed creates the changefeed from the version
+	// of the table before the schema change, which the changefeed then
+	// handles according to schema_change_policy once it completes.
+	OptSchemaChangeInProgressProceed SchemaChangeInProgressPolicy = `proceed`
+	// OptSchemaChangeInProgressWait waits, for up to
+	// changefeed.schema_change_in_progress.max_wait, for the schema change to
+	// complete before creating the changefeed. The changefeed still starts
+	// from the statement time, and handles the schema change, whose outcome is
+	// then known, according to schema_change_policy.
+	OptSchemaChangeInProgressWait SchemaChangeInProgressPolicy = `wait`
+	// OptSchemaChangeInProgressError fails the creation of the changefeed.
+	OptSchemaChangeInProgressError SchemaChangeInProgressPolicy = `error`
+
 	DeprecatedOptFormatAvro                   = `experimental_avro`
 	DeprecatedSinkSchemeCloudStorageAzure     = `experimental-azure`
 	DeprecatedSinkSchemeCloudStorageGCS       = `experimental-gs`
@@ -164,44 +478,107 @@ const (
 	// OptKafkaSinkConfig is a JSON configuration for kafka sink (kafkaSinkConfig).
 	OptKafkaSinkConfig   = `kafka_sink_config`
 	OptWebhookSinkConfig = `webhook_sink_config`
+	// OptPubsubSinkConfig is a JSON configuration for pubsub sink
+	// (pubsubSinkConfig).
+	OptPubsubSinkConfig = `pubsub_sink_config`
 
 	// OptSink allows users to alter the Sink URI of an existing changefeed.
 	// Note that this option is only allowed for alter changefeed statements.
 	OptSink = `sink`
 
-	SinkParamCACert                 = `ca_cert`
-	SinkParamClientCert             = `client_cert`
-	SinkParamClientKey              = `client_key`
-	SinkParamFileSize               = `file_size`
-	SinkParamPartitionFormat        = `partition_format`
-	SinkParamSchemaTopic            = `schema_topic`
-	SinkParamTLSEnabled             = `tls_enabled`
-	SinkParamSkipTLSVerify          = `insecure_tls_skip_verify`
-	SinkParamTopicPrefix            = `topic_prefix`
-	SinkParamTopicName              = `topic_name`
-	SinkSchemeCloudStorageAzure     = `azure`
-	SinkSchemeCloudStorageGCS       = `gs`
-	SinkSchemeCloudStorageHTTP      = `http`
-	SinkSchemeCloudStorageHTTPS     = `https`
-	SinkSchemeCloudStorageNodelocal = `nodelocal`
-	SinkSchemeCloudStorageS3        = `s3`
-	SinkSchemeExperimentalSQL       = `experimental-sql`
-	SinkSchemeHTTP                  = `http`
-	SinkSchemeHTTPS                 = `https`
-	SinkSchemeKafka                 = `kafka`
-	SinkSchemeNull                  = `null`
-	SinkSchemeWebhookHTTP           = `webhook-http`
-	SinkSchemeWebhookHTTPS          = `webhook-https`
-	SinkSchemeExternalConnection    = `external`
-	SinkParamSASLEnabled            = `sasl_enabled`
-	SinkParamSASLHandshake          = `sasl_handshake`
-	SinkParamSASLUser               = `sasl_user`
-	SinkParamSASLPassword           = `sasl_password`
-	SinkParamSASLMechanism          = `sasl_mechanism`
+	SinkParamCACert                  = `ca_cert`
+	SinkParamClientCert              = `client_cert`
+	SinkParamClientKey               = `client_key`
+	SinkParamFileSize                = `file_size`
+	SinkParamFileNameTemplate        = `file_name_template`
+	SinkParamPartitionFormat         = `partition_format`
+	SinkParamSchemaTopic             = `schema_topic`
+	SinkParamTLSEnabled              = `tls_enabled`
+	SinkParamSkipTLSVerify           = `insecure_tls_skip_verify`
+	SinkParamTopicPrefix             = `topic_prefix`
+	SinkParamTopicName               = `topic_name`
+	SinkParamAutoCreateTopics        = `auto_create_topics`
+	SinkParamTopicPartitions         = `topic_partitions`
+	SinkParamTopicReplicationFactor  = `topic_replication_factor`
+	SinkParamTopicCleanupPolicy      = `topic_cleanup_policy`
+	SinkParamFailurePolicy           = `failure_policy`
+	SinkParamCacheKey                = `cache_key`
+	SinkParamCacheOp                 = `cache_op`
+	SinkParamCacheTTL                = `cache_ttl`
+	SinkParamCachePassword           = `cache_password`
+	SinkParamProxyURL                = `proxy_url`
+	SinkParamPreflightCheck          = `preflight_check`
+	SinkParamSQLHistory              = `history`
+	SinkParamSQLTableName            = `table_name`
+	SinkParamResolvedPartition       = `resolved_partition`
+	SinkParamResolvedTopic           = `resolved_topic`
+	SinkSchemeCloudStorageAzure      = `azure`
+	SinkSchemeCloudStorageDatabricks = `databricks`
+	SinkSchemeCloudStorageGCS        = `gs`
+	SinkSchemeCloudStorageHTTP       = `http`
+	SinkSchemeCloudStorageHTTPS      = `https`
+	SinkSchemeCloudStorageNodelocal  = `nodelocal`
+	SinkSchemeCloudStorageS3         = `s3`
+	SinkSchemeCloudStorageSFTP       = `sftp`
+	SinkSchemeExperimentalSQL        = `experimental-sql`
+	SinkSchemeFile                   = `file`
+	SinkSchemeFTPS                   = `ftps`
+	SinkSchemeHTTP                   = `http`
+	SinkSchemeHTTPS                  = `https`
+	SinkSchemeKafka                  = `kafka`
+	SinkSchemeMemcached              = `memcached`
+	SinkSchemeNull                   = `null`
+	SinkSchemeRedis                  = `redis`
+	SinkSchemeStream                 = `stream`
+	SinkSchemeSidecar                = `sidecar`
+	SinkSchemeWebhookHTTP            = `webhook-http`
+	SinkSchemeWebhookHTTPS           = `webhook-https`
+	SinkSchemeExternalConnection     = `external`
+	SinkParamSASLEnabled             = `sasl_enabled`
+	SinkParamSASLHandshake           = `sasl_handshake`
+	SinkParamSASLUser                = `sasl_user`
+	SinkParamSASLPassword            = `sasl_password`
+	SinkParamSASLMechanism           = `sasl_mechanism`
+
+	// SinkParamMirror and SinkParamMirrorFailurePolicy configure a kafka sink
+	// to also produce every message to the clusters with the given bootstrap
+	// brokers, and the failure_policy of each of those clusters.
+	SinkParamMirror              = `mirror`
+	SinkParamMirrorFailurePolicy = `mirror_failure_policy`
+
+	// SinkParamSegmentSize, SinkParamRetention and SinkParamMaxBufferSize
+	// configure the file sink: the size at which it starts a new segment
+	// file, and the age and total size beyond which it deletes the oldest
+	// segments of its changefeed, which are bounded unless set to 0.
+	// SinkParamRetention is also the age past which the cloud storage sink
+	// deletes the files of its changefeed.
+	SinkParamSegmentSize   = `segment_size`
+	SinkParamRetention     = `retention`
+	SinkParamMaxBufferSize = `max_buffer_size`
+
+	// SinkParamWebhookAuthHeader is the Authorization header of the requests
+	// of a webhook sink, for when the header is held, and rotated, by an
+	// external connection rather than given by OptWebhookAuthHeader.
+	SinkParamWebhookAuthHeader = `auth_header`
 
 	RegistryParamCACert     = `ca_cert`
 	RegistryParamClientCert = `client_cert`
 	RegistryParamClientKey  = `client_key`
+	RegistryParamProxyURL   = `proxy_url`
+
+	// RegistryParamSkipTLSVerify, RegistryParamTimeout, RegistryParamRetryMax
+	// and RegistryParamRetryBackoff configure the connections to a schema
+	// registry: whether its certificate is verified, the timeout of each of
+	// its requests, and how many times, and after what initial backoff, failed
+	// requests are retried before the changefeed errors.
+	RegistryParamSkipTLSVerify = `insecure_tls_skip_verify`
+	RegistryParamTimeout       = `timeout`
+	RegistryParamRetryMax      = `retry_max`
+	RegistryParamRetryBackoff  = `retry_backoff`
+
+	// SchemaRegistrySchemeConfluent is the scheme of external connections to
+	// a confluent schema registry, which is contacted over HTTPS.
+	SchemaRegistrySchemeConfluent = `confluent-schema-registry`
 
 	// Topics is used to store the topics generated by the sink in the options
 	// struct so that they can be displayed in the show changefeed jobs query.
@@ -209,6 +586,21 @@ const (
 	Topics = `topics`
 )
 
+// Values of the failure_policy sink parameter, which controls whether a
+// changefeed emitting to multiple sinks fails when one of them fails.
+const (
+	SinkFailurePolicyFail    = `fail`
+	SinkFailurePolicyIsolate = `isolate`
+)
+
+// Values of the cache_op sink parameter of the memcached and redis sinks,
+// which controls whether changed rows are deleted from or written to the
+// cache.
+const (
+	SinkCacheOpDelete = `delete`
+	SinkCacheOpSet    = `set`
+)
+
 func makeStringSet(opts ...string) map[string]struct{} {
 	res := make(map[string]struct{}, len(opts))
 	for _, opt := range opts {
@@ -302,63 +694,131 @@ var jsonOption = OptionPermittedValues{Type: OptionTypeJSON}
 // PlanHookState.TypeAsStringOpts().
 var ChangefeedOptionExpectValues = map[string]OptionPermittedValues{
 	OptAvroSchemaPrefix:         stringOption,
+	OptAvroDecimal:              enum("column", "string"),
+	OptAvroUnboundedDecimal:     stringOption,
+	OptAvroInterval:             enum("iso8601", "micros"),
+	OptAvroGeospatial:           enum("ewkb", "geojson"),
+	OptAvroSubjectNameStrategy:  enum("topic", "record", "topic_record"),
+	OptAvroSubjectTemplate:      stringOption,
 	OptConfluentSchemaRegistry:  stringOption,
 	OptCursor:                   timestampOption,
 	OptEndTime:                  timestampOption,
-	OptEnvelope:                 enum("row", "key_only", "wrapped", "deprecated_row", "bare"),
-	OptFormat:                   enum("json", "avro", "csv", "experimental_avro", "parquet"),
+	OptEnvelope:                 enum("row", "key_only", "wrapped", "deprecated_row", "bare", "cloudevents", "goldengate"),
+	OptCloudEventsMode:          enum("structured", "binary"),
+	OptFormat:                   enum("json", "avro", "csv", "experimental_avro", "parquet", "msgpack"),
 	OptFullTableName:            flagOption,
+	OptClusterAlias:             stringOption,
+	OptIncludeTenantName:        flagOption,
 	OptKeyInValue:               flagOption,
 	OptTopicInValue:             flagOption,
 	OptResolvedTimestamps:       durationOption.thatCanBeZero().orEmptyMeans("0"),
+	OptResolvedPerTable:         flagOption,
 	OptMinCheckpointFrequency:   durationOption.thatCanBeZero(),
 	OptUpdatedTimestamps:        flagOption,
-	OptMVCCTimestamps:           flagOption,
+	OptMVCCTimestamps:           enum("decimal", "split", "nanos").orEmptyMeans("decimal"),
+	OptLatencyTimestamps:        flagOption,
+	OptEnumCodes:                flagOption,
+	OptContentHash:              flagOption,
+	OptSourceGeneration:         flagOption,
 	OptDiff:                     flagOption,
+	OptDeleteBeforeImage:        flagOption,
+	OptMarkTTLDeletes:           flagOption,
+	OptDeleteAfterEmit:          flagOption,
 	OptCompression:              enum("gzip", "zstd"),
 	OptSchemaChangeEvents:       enum("column_changes", "default"),
 	OptSchemaChangePolicy:       enum("backfill", "nobackfill", "stop", "ignore"),
 	OptSplitColumnFamilies:      flagOption,
+	OptFamilyTopicFormat:        stringOption,
+	OptMergeColumnFamilies:      flagOption,
 	OptInitialScan:              enum("yes", "no", "only").orEmptyMeans("yes"),
 	OptNoInitialScan:            flagOption,
 	OptInitialScanOnly:          flagOption,
 	OptProtectDataFromGCOnPause: flagOption,
 	OptExpirePTSAfter:           durationOption.thatCanBeZero(),
+	OptPTSExpirationAction:      enum("cancel", "release"),
 	OptKafkaSinkConfig:          jsonOption,
 	OptWebhookSinkConfig:        jsonOption,
+	OptPubsubSinkConfig:         jsonOption,
 	OptWebhookAuthHeader:        stringOption,
 	OptWebhookClientTimeout:     durationOption,
 	OptOnError:                  enum("pause", "fail"),
 	OptMetricsScope:             stringOption,
 	OptUnordered:                flagOption,
 	OptVirtualColumns:           enum("omitted", "null"),
+	OptKeyFormat:                enum("array", "object", "delimited", "hash"),
+	OptSchemaChangeInProgress:   enum("proceed", "wait", "error"),
+	OptKeyDelimiter:             stringOption,
+	OptBareMetadataKey:          stringOption,
+	OptJSONSchema:               flagOption,
+
+	OptBatchEnvelopeSize: stringOption,
+	OptDryRun:            flagOption,
+	OptSink:              enum(SinkSchemeNull),
+	OptRestoreCheckpoint: stringOption,
+	OptTenant:            stringOption,
+
+	OptRetryMinBackoff:             durationOption,
+	OptRetryMaxBackoff:             durationOption,
+	OptRetryMaxAttemptsBeforePause: stringOption,
+
+	OptMaxEmittedBytesPerDay: stringOption,
+	OptSampleRate:            stringOption,
+	OptEmissionWindow:        stringOption,
+	OptCoalesceWindow:        durationOption,
+	OptDeadLetterTable:       stringOption,
+	OptContentDigestTable:    stringOption,
+	OptOutputContract:        stringOption,
+	OptOnContractViolation:   enum("pause", "dead_letter"),
+	OptTraceContext:          flagOption,
+	OptOnCompletion:          enum("noop", "emit_eof", "delete_topics"),
+	OptOnTruncate:            enum("fail", "rescan", "emit_marker"),
+	OptOnOffline:             enum("fail", "wait"),
+	OptSettings:              stringOption,
 }
 
 // CommonOptions is options common to all sinks
 var CommonOptions = makeStringSet(OptCursor, OptEndTime, OptEnvelope,
-	OptFormat, OptFullTableName,
-	OptKeyInValue, OptTopicInValue,
-	OptResolvedTimestamps, OptUpdatedTimestamps,
-	OptMVCCTimestamps, OptDiff, OptSplitColumnFamilies,
-	OptSchemaChangeEvents, OptSchemaChangePolicy,
+	OptFormat, OptFullTableName, OptClusterAlias, OptIncludeTenantName,
+	OptKeyInValue, OptTopicInValue, OptKeyFormat, OptKeyDelimiter, OptBareMetadataKey, OptJSONSchema,
+	OptResolvedTimestamps, OptResolvedPerTable, OptUpdatedTimestamps,
+	OptMVCCTimestamps, OptLatencyTimestamps, OptEnumCodes, OptContentHash, OptSourceGeneration, OptDiff,
+	OptDeleteBeforeImage, OptMarkTTLDeletes, OptDeleteAfterEmit, OptSplitColumnFamilies, OptFamilyTopicFormat,
+	OptMergeColumnFamilies, OptSchemaChangeEvents, OptSchemaChangePolicy, OptSchemaChangeInProgress,
 	OptProtectDataFromGCOnPause, OptOnError,
 	OptInitialScan, OptNoInitialScan, OptInitialScanOnly, OptUnordered,
-	OptMinCheckpointFrequency, OptMetricsScope, OptVirtualColumns, Topics, OptExpirePTSAfter)
+	OptMinCheckpointFrequency, OptMetricsScope, OptVirtualColumns, Topics, OptExpirePTSAfter,
+	OptPTSExpirationAction,
+	OptRetryMinBackoff, OptRetryMaxBackoff, OptRetryMaxAttemptsBeforePause, OptDryRun, OptSink,
+	OptAvroDecimal, OptAvroUnboundedDecimal, OptAvroInterval, OptAvroGeospatial,
+	OptRestoreCheckpoint, OptMaxEmittedBytesPerDay, OptTenant, OptSettings, OptSampleRate,
+	OptEmissionWindow, OptDeadLetterTable, OptContentDigestTable, OptOutputContract, OptOnContractViolation,
+	OptOnCompletion, OptOnTruncate, OptOnOffline, OptCoalesceWindow)
 
 // SQLValidOptions is options exclusive to SQL sink
 var SQLValidOptions map[string]struct{} = nil
 
 // KafkaValidOptions is options exclusive to Kafka sink
-var KafkaValidOptions = makeStringSet(OptAvroSchemaPrefix, OptConfluentSchemaRegistry, OptKafkaSinkConfig)
+var KafkaValidOptions = makeStringSet(OptAvroSchemaPrefix, OptConfluentSchemaRegistry, OptKafkaSinkConfig, OptBatchEnvelopeSize,
+	OptCloudEventsMode, OptAvroSubjectNameStrategy, OptAvroSubjectTemplate, OptTraceContext)
 
 // CloudStorageValidOptions is options exclusive to cloud storage sink
 var CloudStorageValidOptions = makeStringSet(OptCompression)
 
 // WebhookValidOptions is options exclusive to webhook sink
-var WebhookValidOptions = makeStringSet(OptWebhookAuthHeader, OptWebhookClientTimeout, OptWebhookSinkConfig)
+var WebhookValidOptions = makeStringSet(OptWebhookAuthHeader, OptWebhookClientTimeout, OptWebhookSinkConfig,
+	OptCloudEventsMode, OptCompression, OptTraceContext)
+
+// CacheValidOptions is options exclusive to the memcached and redis sinks
+var CacheValidOptions map[string]struct{} = nil
+
+// StreamValidOptions is options exclusive to the stream sink
+var StreamValidOptions map[string]struct{} = nil
+
+// FileValidOptions is options exclusive to the file sink
+var FileValidOptions map[string]struct{} = nil
 
 // PubsubValidOptions is options exclusive to pubsub sink
-var PubsubValidOptions = makeStringSet()
+var PubsubValidOptions = makeStringSet(OptBatchEnvelopeSize, OptPubsubSinkConfig, OptTraceContext)
 
 // ExternalConnectionValidOptions is options exclusive to the external
 // connection sink.
@@ -370,7 +830,9 @@ var ExternalConnectionValidOptions = unionStringSets(SQLValidOptions, KafkaValid
 
 // CaseInsensitiveOpts options which supports case Insensitive value
 var CaseInsensitiveOpts = makeStringSet(OptFormat, OptEnvelope, OptCompression, OptSchemaChangeEvents,
-	OptSchemaChangePolicy, OptOnError, OptInitialScan)
+	OptSchemaChangePolicy, OptOnError, OptInitialScan, OptAvroDecimal, OptAvroInterval, OptAvroGeospatial,
+	OptCloudEventsMode, OptPTSExpirationAction, OptAvroSubjectNameStrategy, OptOnContractViolation,
+	OptOnCompletion, OptOnTruncate, OptOnOffline, OptMVCCTimestamps)
 
 // redactionFunc is a function applied to a string option which returns its redacted value.
 type redactionFunc func(string) (string, error)
@@ -379,8 +841,9 @@ var redactSimple = func(string) (string, error) {
 	return "redacted", nil
 }
 
-// RedactUserFromURI takes a URI string and removes the user from it.
-// If there is no user, the original URI is returned.
+// RedactUserFromURI takes a URI string and removes the user from it, and from
+// the URL of its proxy, if any. If there is no user, the original URI is
+// returned.
 func RedactUserFromURI(uri string) (string, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
@@ -389,6 +852,27 @@ func RedactUserFromURI(uri string) (string, error) {
 	if u.User != nil {
 		u.User = url.User(`redacted`)
 	}
+	return RedactProxyUserFromURI(u.String())
+}
+
+// RedactProxyUserFromURI takes a URI string and removes the user from the URL
+// of its proxy, given by its proxy_url parameter. If there is no proxy, the
+// original URI is returned.
+func RedactProxyUserFromURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if q.Get(SinkParamProxyURL) == "" {
+		return uri, nil
+	}
+	proxyURI, err := RedactUserFromURI(q.Get(SinkParamProxyURL))
+	if err != nil {
+		return "", err
+	}
+	q.Set(SinkParamProxyURL, proxyURI)
+	u.RawQuery = q.Encode()
 	return u.String(), nil
 }
 
@@ -399,6 +883,16 @@ var RedactedOptions = map[string]redactionFunc{
 	OptConfluentSchemaRegistry: RedactUserFromURI,
 }
 
+// RedactedSinkParams are sink URI query parameters whose values should be
+// replaced with "redacted" in job descriptions and SHOW CHANGEFEED JOBS.
+var RedactedSinkParams = []string{
+	SinkParamSASLPassword,
+	SinkParamCACert,
+	SinkParamClientCert,
+	SinkParamWebhookAuthHeader,
+	SinkParamCachePassword,
+}
+
 // NoLongerExperimental aliases options prefixed with experimental that no longer need to be
 var NoLongerExperimental = map[string]string{
 	DeprecatedOptFormatAvro:                   string(OptFormatAvro),
@@ -412,8 +906,8 @@ var NoLongerExperimental = map[string]string{
 
 // InitialScanOnlyUnsupportedOptions is options that are not supported with the
 // initial scan only option
-var InitialScanOnlyUnsupportedOptions = makeStringSet(OptEndTime, OptResolvedTimestamps, OptDiff,
-	OptMVCCTimestamps, OptUpdatedTimestamps)
+var InitialScanOnlyUnsupportedOptions = makeStringSet(OptEndTime, OptResolvedTimestamps, OptResolvedPerTable, OptDiff,
+	OptDeleteBeforeImage, OptMVCCTimestamps, OptUpdatedTimestamps, OptDeleteAfterEmit)
 
 // AlterChangefeedUnsupportedOptions are changefeed options that we do not allow
 // users to alter.
@@ -422,7 +916,8 @@ var InitialScanOnlyUnsupportedOptions = makeStringSet(OptEndTime, OptResolvedTim
 // allowed to alter either of these options. We need to support the alteration
 // of these fields.
 var AlterChangefeedUnsupportedOptions = makeStringSet(OptCursor, OptInitialScan,
-	OptNoInitialScan, OptInitialScanOnly, OptEndTime)
+	OptNoInitialScan, OptInitialScanOnly, OptEndTime, OptRestoreCheckpoint,
+	OptSchemaChangeInProgress, OptTenant)
 
 // AlterChangefeedOptionExpectValues is used to parse alter changefeed options
 // using PlanHookState.TypeAsStringOpts().
@@ -442,6 +937,12 @@ var AlterChangefeedTargetOptions = map[string]OptionPermittedValues{
 	OptNoInitialScan: flagOption,
 }
 
+// AlterChangefeedDropTargetOptions is used to parse the options of targets
+// dropped by an alter changefeed using PlanHookState.TypeAsStringOpts().
+var AlterChangefeedDropTargetOptions = map[string]OptionPermittedValues{
+	OptEndOfStream: flagOption,
+}
+
 type incompatibleOptions struct {
 	opt1   string
 	opt2   string
@@ -459,6 +960,15 @@ func makeInvertedIndex(pairs []incompatibleOptions) map[string][]incompatibleOpt
 
 var incompatibleOptionsMap = makeInvertedIndex([]incompatibleOptions{
 	{opt1: OptUnordered, opt2: OptResolvedTimestamps, reason: `resolved timestamps cannot be guaranteed to be correct in unordered mode`},
+	{opt1: OptMergeColumnFamilies, opt2: OptFamilyTopicFormat, reason: `merged column families are emitted to the topic of their table`},
+	{opt1: OptDeleteAfterEmit, opt2: OptDeleteBeforeImage, reason: `deletions are not emitted under delete_after_emit`},
+	{opt1: OptDeleteAfterEmit, opt2: OptMarkTTLDeletes, reason: `deletions are not emitted under delete_after_emit`},
+	{opt1: OptDeleteAfterEmit, opt2: OptDryRun, reason: `rows would be deleted without being emitted`},
+	{opt1: OptDeleteAfterEmit, opt2: OptSink, reason: `rows would be deleted without being emitted`},
+	{opt1: OptDeleteAfterEmit, opt2: OptSampleRate, reason: `rows left out of the sample would be deleted without being emitted`},
+	{opt1: OptResolvedPerTable, opt2: OptContentDigestTable, reason: `content digests are written with the resolved timestamps of the changefeed`},
+	{opt1: OptCoalesceWindow, opt2: OptDiff, reason: `the before value of a collapsed message would be that of its last update rather than its first`},
+	{opt1: OptCoalesceWindow, opt2: OptDeleteBeforeImage, reason: `the before value of a collapsed message would be that of its last update rather than its first`},
 })
 
 // MakeStatementOptions wraps and canonicalizes the options we get
@@ -508,6 +1018,43 @@ func (s StatementOptions) DeprecationWarnings() []string {
 	return []string{}
 }
 
+// LintWarnings returns warnings about combinations of options which are valid,
+// but which probably don't do what the user intended. Options which can't be
+// parsed are left to validation, and don't produce warnings. cursor is the
+// evaluated cursor of the changefeed, if it has one, and now the time of the
+// statement creating it.
+func (s StatementOptions) LintWarnings(cursor, now hlc.Timestamp) []string {
+	var warnings []string
+
+	format := s.m[OptFormat]
+	if (strings.EqualFold(format, string(OptFormatAvro)) ||
+		strings.EqualFold(format, string(DeprecatedOptFormatAvro))) &&
+		!s.IsSet(OptConfluentSchemaRegistry) {
+		warnings = append(warnings, fmt.Sprintf(
+			`%s=%s without %s requires a sink which embeds the schemas of messages, such as cloud storage`,
+			OptFormat, OptFormatAvro, OptConfluentSchemaRegistry))
+	}
+
+	if resolved, emit, err := s.GetResolvedTimestampInterval(); err == nil && emit {
+		if freq, err := s.GetMinCheckpointFrequency(); err == nil && freq != nil {
+			if resolved == nil || *resolved < *freq {
+				warnings = append(warnings, fmt.Sprintf(
+					`resolved timestamps are emitted at most once every %s=%s`,
+					OptMinCheckpointFrequency, *freq))
+			}
+		}
+	}
+
+	if s.HasStartCursor() && now.Less(cursor) &&
+		(s.IsSet(OptNoInitialScan) || strings.EqualFold(s.m[OptInitialScan], `no`)) {
+		warnings = append(warnings, fmt.Sprintf(
+			`%s %s is in the future, so the changefeed emits nothing until then`,
+			OptCursor, cursor.AsOfSystemTime()))
+	}
+
+	return warnings
+}
+
 // ForEachWithRedaction iterates a function over the raw key/value pairs.
 // Meant for serialization.
 func (s StatementOptions) ForEachWithRedaction(fn func(k string, v string)) error {
@@ -548,6 +1095,40 @@ func (s StatementOptions) GetEndTime() string {
 	return s.m[OptEndTime]
 }
 
+// GetRestoreCheckpoint returns the checkpoint which the changefeed resumes
+// from, if the restore_checkpoint option is set.
+func (s StatementOptions) GetRestoreCheckpoint() (jobspb.ChangefeedCheckpointExport, bool, error) {
+	var export jobspb.ChangefeedCheckpointExport
+	v, ok := s.m[OptRestoreCheckpoint]
+	if !ok {
+		return export, false, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err == nil {
+		err = export.Unmarshal(b)
+	}
+	if err != nil || export.StatementTime.IsEmpty() {
+		return export, false, errors.Newf(
+			`invalid %s: expected a checkpoint shown by SHOW CHANGEFEED JOB ... WITH CHECKPOINT`,
+			OptRestoreCheckpoint)
+	}
+	return export, true, nil
+}
+
+// GetTenant returns the name of the secondary tenant whose tables the
+// changefeed watches, if the tenant option is set.
+func (s StatementOptions) GetTenant() (string, bool) {
+	v, ok := s.m[OptTenant]
+	return v, ok
+}
+
+// restoresFromHighWater returns true if the changefeed resumes from a
+// checkpoint of a changefeed which had completed its initial scan.
+func (s StatementOptions) restoresFromHighWater() bool {
+	export, ok, err := s.GetRestoreCheckpoint()
+	return err == nil && ok && !export.HighWater.IsEmpty()
+}
+
 func (s StatementOptions) getEnumValue(k string) (string, error) {
 	enumOptions := ChangefeedOptionExpectValues[k]
 	rawVal, present := s.m[k]
@@ -591,6 +1172,8 @@ func (s StatementOptions) getJSONValue(k string) SinkSpecificJSONConfig {
 
 // GetInitialScanType determines the type of initial scan the changefeed
 // should perform on the first run given the options provided from the user.
+// When combined with a cursor, an initial scan is performed as of the cursor
+// timestamp, after which changes are streamed starting from that timestamp.
 func (s StatementOptions) GetInitialScanType() (InitialScanType, error) {
 	_, initialScanSet := s.m[OptInitialScan]
 	_, initialScanOnlySet := s.m[OptInitialScanOnly]
@@ -640,8 +1223,9 @@ func (s StatementOptions) GetInitialScanType() (InitialScanType, error) {
 
 	// If we reach this point, this implies that the user did not specify any initial scan
 	// options. In this case the default behaviour is to perform an initial scan if the
-	// cursor is not specified.
-	if !s.HasStartCursor() {
+	// cursor is not specified, and the changefeed isn't resuming from the high-water of
+	// another.
+	if !s.HasStartCursor() && !s.restoresFromHighWater() {
 		return InitialScan, nil
 	}
 
@@ -667,37 +1251,141 @@ func (s StatementOptions) ShouldUseFullStatementTimeName() bool {
 	return qualified
 }
 
+// TableNameQualifiers are the names which precede the database in the
+// fully-qualified table names of a changefeed, so that the topics of
+// changefeeds from different clusters or tenants can be told apart.
+type TableNameQualifiers struct {
+	// ClusterAlias is an operator-specified name for the cluster.
+	ClusterAlias string
+	// TenantName is true if the name of the tenant is included.
+	TenantName bool
+}
+
+// GetTableNameQualifiers returns the names which precede the database in
+// fully-qualified table names.
+func (s StatementOptions) GetTableNameQualifiers() (TableNameQualifiers, error) {
+	alias, hasAlias := s.m[OptClusterAlias]
+	_, tenantName := s.m[OptIncludeTenantName]
+	if !s.ShouldUseFullStatementTimeName() {
+		if hasAlias {
+			return TableNameQualifiers{}, errors.Errorf(`%s is only usable with %s`,
+				OptClusterAlias, OptFullTableName)
+		}
+		if tenantName {
+			return TableNameQualifiers{}, errors.Errorf(`%s is only usable with %s`,
+				OptIncludeTenantName, OptFullTableName)
+		}
+	}
+	if hasAlias && alias == `` {
+		return TableNameQualifiers{}, errors.Errorf(`%s must not be empty`, OptClusterAlias)
+	}
+	return TableNameQualifiers{ClusterAlias: alias, TenantName: tenantName}, nil
+}
+
 // CanHandle tracks whether users have explicitly specificed how to handle
 // unusual table schemas.
 type CanHandle struct {
 	MultipleColumnFamilies bool
 	VirtualColumns         bool
+	// Truncate is set if the changefeed continues past the truncation of a
+	// target table, rather than failing.
+	Truncate bool
+	// Offline is set if the changefeed waits for a target table which is
+	// taken offline to come back online, rather than failing.
+	Offline bool
 }
 
 // GetCanHandle returns a populated CanHandle.
 func (s StatementOptions) GetCanHandle() CanHandle {
 	_, families := s.m[OptSplitColumnFamilies]
 	_, virtual := s.m[OptVirtualColumns]
+	truncate, err := s.GetOnTruncate()
+	offline, offlineErr := s.GetOnOffline()
 	return CanHandle{
 		MultipleColumnFamilies: families,
 		VirtualColumns:         virtual,
+		Truncate:               err == nil && truncate != OptOnTruncateFail,
+		Offline:                offlineErr == nil && offline == OptOnOfflineWait,
 	}
 }
 
 // EncodingOptions describe how events are encoded when
 // sent to the sink.
 type EncodingOptions struct {
-	Format            FormatType
-	VirtualColumns    VirtualColumnVisibility
-	Envelope          EnvelopeType
-	KeyInValue        bool
-	TopicInValue      bool
+	Format         FormatType
+	VirtualColumns VirtualColumnVisibility
+	Envelope       EnvelopeType
+	KeyInValue     bool
+	TopicInValue   bool
+	// KeyFormat and KeyDelimiter control the encoding of message keys;
+	// KeyDelimiter is only used with KeyFormat=delimited.
+	KeyFormat    KeyFormat
+	KeyDelimiter string
+	// BareMetadataKey, if set, is the key under which the metadata of
+	// messages in the bare envelope is nested, in place of __crdb__.
+	BareMetadataKey string
+	// JSONSchema wraps each message in the schema and payload envelope of
+	// the Kafka Connect JsonConverter, describing the types and nullability
+	// of its columns.
+	JSONSchema        bool
 	UpdatedTimestamps bool
 	MVCCTimestamps    bool
+	// MVCCTimestampFormat is how the MVCC timestamp of each change is
+	// encoded if MVCCTimestamps is set.
+	MVCCTimestampFormat MVCCTimestampFormat
+	// LatencyTimestamps adds the wall time at which each message was
+	// written to the sink, and the MVCC wall time of the change, as decimal
+	// seconds and as nanoseconds.
+	LatencyTimestamps bool
+	// EnumCodes encodes the values of enums as the name of the value along
+	// with its numeric code, the OID of the value in pg_catalog.pg_enum.
+	EnumCodes bool
+	// ContentHash adds a SHA-256 of the canonical encoding of each row to
+	// its message.
+	ContentHash bool
+	// SourceGeneration adds the ID of the cluster running the changefeed,
+	// SourceClusterID, and the generation of the changefeed, Generation, to
+	// each message, which are set by the processors of the changefeed.
+	SourceGeneration  bool
+	SourceClusterID   string
+	Generation        int64
 	Diff              bool
 	AvroSchemaPrefix  string
 	SchemaRegistryURI string
 	Compression       string
+	// DeleteBeforeImage adds the previous row to the messages of deletions,
+	// without the previous row of other changes which Diff adds.
+	DeleteBeforeImage bool
+	// MarkTTLDeletes adds the operation of each change to its message,
+	// designating the deletes of the row-level TTL job as ttl_delete rather
+	// than delete.
+	MarkTTLDeletes bool
+	// FamilyTopicFormat, if set, is the pattern used to name the topic of a
+	// column family, e.g. `{table}.{family}`.
+	FamilyTopicFormat string
+	// MergeColumnFamilies emits all column families of a table to the
+	// topic of the table, recording the family in the message.
+	MergeColumnFamilies bool
+	// CloudEventsMode is the mode in which sinks send the events of the
+	// cloudevents envelope.
+	CloudEventsMode CloudEventsMode
+	// TraceContext stamps messages with the W3C traceparent of the tracing
+	// span which emitted them.
+	TraceContext bool
+	// AvroDecimal, AvroInterval and AvroGeospatial control the avro encoding
+	// of types which have no lossless native avro representation.
+	AvroDecimal    AvroDecimalEncoding
+	AvroInterval   AvroIntervalEncoding
+	AvroGeospatial AvroGeospatialEncoding
+	// AvroUnboundedDecimalPrecision and AvroUnboundedDecimalScale, if set, are
+	// the precision and scale used to encode DECIMAL columns declared without
+	// a precision.
+	AvroUnboundedDecimalPrecision int
+	AvroUnboundedDecimalScale     int
+	// AvroSubjectNameStrategy and AvroSubjectTemplate, of which at most one is
+	// set, control the subjects under which avro schemas are registered.
+	AvroSubjectNameStrategy AvroSubjectNameStrategy
+	AvroSubjectTemplate     string
 }
 
 // GetEncodingOptions populates and validates an EncodingOptions.
@@ -733,16 +1421,111 @@ func (s StatementOptions) GetEncodingOptions() (EncodingOptions, error) {
 	} else {
 		o.Envelope = EnvelopeType(envelope)
 	}
+	cloudEventsMode, err := s.getEnumValue(OptCloudEventsMode)
+	if err != nil {
+		return o, err
+	}
+	if cloudEventsMode != `` {
+		o.CloudEventsMode = CloudEventsMode(cloudEventsMode)
+	} else if o.Envelope == OptEnvelopeCloudEvents {
+		o.CloudEventsMode = OptCloudEventsModeStructured
+	}
+
+	keyFormat, err := s.getEnumValue(OptKeyFormat)
+	if err != nil {
+		return o, err
+	}
+	if keyFormat == `` {
+		o.KeyFormat = OptKeyFormatArray
+	} else {
+		o.KeyFormat = KeyFormat(keyFormat)
+	}
+	if v, ok := s.m[OptKeyDelimiter]; ok {
+		if v == `` {
+			return o, errors.Errorf(`%s must not be empty`, OptKeyDelimiter)
+		}
+		o.KeyDelimiter = v
+	} else if o.KeyFormat == OptKeyFormatDelimited {
+		o.KeyDelimiter = DefaultKeyDelimiter
+	}
+	if v, ok := s.m[OptBareMetadataKey]; ok {
+		if v == `` {
+			return o, errors.Errorf(`%s must not be empty`, OptBareMetadataKey)
+		}
+		o.BareMetadataKey = v
+	}
+
+	avroDecimal, err := s.getEnumValue(OptAvroDecimal)
+	if err != nil {
+		return o, err
+	}
+	if avroDecimal == `` {
+		o.AvroDecimal = OptAvroDecimalColumn
+	} else {
+		o.AvroDecimal = AvroDecimalEncoding(avroDecimal)
+	}
+	avroInterval, err := s.getEnumValue(OptAvroInterval)
+	if err != nil {
+		return o, err
+	}
+	if avroInterval == `` {
+		o.AvroInterval = OptAvroIntervalISO8601
+	} else {
+		o.AvroInterval = AvroIntervalEncoding(avroInterval)
+	}
+	avroGeospatial, err := s.getEnumValue(OptAvroGeospatial)
+	if err != nil {
+		return o, err
+	}
+	if avroGeospatial == `` {
+		o.AvroGeospatial = OptAvroGeospatialEWKB
+	} else {
+		o.AvroGeospatial = AvroGeospatialEncoding(avroGeospatial)
+	}
+	avroSubjectNameStrategy, err := s.getEnumValue(OptAvroSubjectNameStrategy)
+	if err != nil {
+		return o, err
+	}
+	o.AvroSubjectNameStrategy = AvroSubjectNameStrategy(avroSubjectNameStrategy)
+	if v, ok := s.m[OptAvroSubjectTemplate]; ok {
+		if v == `` {
+			return o, errors.Errorf(`%s must not be empty`, OptAvroSubjectTemplate)
+		}
+		o.AvroSubjectTemplate = v
+	}
+	if v, ok := s.m[OptAvroUnboundedDecimal]; ok {
+		o.AvroUnboundedDecimalPrecision, o.AvroUnboundedDecimalScale, err = parseDecimalPrecisionAndScale(v)
+		if err != nil {
+			return o, errors.Wrapf(err, "option %s", OptAvroUnboundedDecimal)
+		}
+	}
 
 	_, o.KeyInValue = s.m[OptKeyInValue]
 	_, o.TopicInValue = s.m[OptTopicInValue]
+	_, o.JSONSchema = s.m[OptJSONSchema]
 	_, o.UpdatedTimestamps = s.m[OptUpdatedTimestamps]
 	_, o.MVCCTimestamps = s.m[OptMVCCTimestamps]
+	if o.MVCCTimestamps {
+		mvccTimestampFormat, err := s.getEnumValue(OptMVCCTimestamps)
+		if err != nil {
+			return o, err
+		}
+		o.MVCCTimestampFormat = MVCCTimestampFormat(mvccTimestampFormat)
+	}
+	_, o.LatencyTimestamps = s.m[OptLatencyTimestamps]
+	_, o.EnumCodes = s.m[OptEnumCodes]
+	_, o.ContentHash = s.m[OptContentHash]
+	_, o.SourceGeneration = s.m[OptSourceGeneration]
 	_, o.Diff = s.m[OptDiff]
+	_, o.DeleteBeforeImage = s.m[OptDeleteBeforeImage]
+	_, o.MarkTTLDeletes = s.m[OptMarkTTLDeletes]
+	_, o.MergeColumnFamilies = s.m[OptMergeColumnFamilies]
+	_, o.TraceContext = s.m[OptTraceContext]
 
 	o.SchemaRegistryURI = s.m[OptConfluentSchemaRegistry]
 	o.AvroSchemaPrefix = s.m[OptAvroSchemaPrefix]
 	o.Compression = s.m[OptCompression]
+	o.FamilyTopicFormat = s.m[OptFamilyTopicFormat]
 
 	s.cache.EncodingOptions = o
 	return o, o.Validate()
@@ -755,7 +1538,135 @@ func (e EncodingOptions) Validate() error {
 			OptEnvelope, OptEnvelopeRow, OptFormat, OptFormatAvro,
 		)
 	}
-	if e.Envelope != OptEnvelopeWrapped && e.Format != OptFormatJSON && e.Format != OptFormatParquet {
+	if e.Envelope == OptEnvelopeCloudEvents && e.Format != OptFormatJSON {
+		return errors.Errorf(`%s=%s is only usable with %s=%s`,
+			OptEnvelope, OptEnvelopeCloudEvents, OptFormat, OptFormatJSON)
+	}
+	if e.Envelope == OptEnvelopeGoldenGate && e.Format != OptFormatJSON {
+		return errors.Errorf(`%s=%s is only usable with %s=%s`,
+			OptEnvelope, OptEnvelopeGoldenGate, OptFormat, OptFormatJSON)
+	}
+	if e.Envelope == OptEnvelopeGoldenGate && !e.Diff {
+		return errors.Errorf(`%s=%s requires %s, which distinguishes inserts from updates`,
+			OptEnvelope, OptEnvelopeGoldenGate, OptDiff)
+	}
+	if e.CloudEventsMode != `` && e.Envelope != OptEnvelopeCloudEvents {
+		return errors.Errorf(`%s is only usable with %s=%s`,
+			OptCloudEventsMode, OptEnvelope, OptEnvelopeCloudEvents)
+	}
+	if e.JSONSchema && (e.Format != OptFormatJSON ||
+		(e.Envelope != OptEnvelopeBare && e.Envelope != OptEnvelopeRow)) {
+		return errors.Errorf(`%s is only usable with %s=%s and %s=%s or %s=%s`,
+			OptJSONSchema, OptFormat, OptFormatJSON, OptEnvelope, OptEnvelopeBare, OptEnvelope, OptEnvelopeRow)
+	}
+	if e.JSONSchema {
+		for _, v := range []struct {
+			k string
+			b bool
+		}{
+			{OptKeyInValue, e.KeyInValue},
+			{OptSourceGeneration, e.SourceGeneration},
+			{OptEnumCodes, e.EnumCodes},
+		} {
+			if v.b {
+				return errors.Errorf(`%s cannot be used with %s`, OptJSONSchema, v.k)
+			}
+		}
+	}
+	if e.FamilyTopicFormat != `` && !strings.Contains(e.FamilyTopicFormat, FamilyTopicFormatFamily) {
+		return errors.Errorf(`%s must contain %s: '%s'`,
+			OptFamilyTopicFormat, FamilyTopicFormatFamily, e.FamilyTopicFormat)
+	}
+	if e.Format != OptFormatAvro {
+		nonDefaultAvro := []struct {
+			k string
+			b bool
+		}{
+			{OptAvroDecimal, e.AvroDecimal != OptAvroDecimalColumn},
+			{OptAvroUnboundedDecimal, e.AvroUnboundedDecimalPrecision != 0},
+			{OptAvroInterval, e.AvroInterval != OptAvroIntervalISO8601},
+			{OptAvroGeospatial, e.AvroGeospatial != OptAvroGeospatialEWKB},
+			{OptAvroSubjectNameStrategy, e.AvroSubjectNameStrategy != ``},
+			{OptAvroSubjectTemplate, e.AvroSubjectTemplate != ``},
+		}
+		for _, v := range nonDefaultAvro {
+			if v.b {
+				return errors.Errorf(`%s is only usable with %s=%s`, v.k, OptFormat, OptFormatAvro)
+			}
+		}
+	}
+	if e.AvroSubjectNameStrategy != `` && e.AvroSubjectTemplate != `` {
+		return errors.Errorf(`%s cannot be used with %s`,
+			OptAvroSubjectNameStrategy, OptAvroSubjectTemplate)
+	}
+	if e.AvroSubjectTemplate != `` && !strings.Contains(e.AvroSubjectTemplate, AvroSubjectTemplateType) &&
+		!strings.Contains(e.AvroSubjectTemplate, AvroSubjectTemplateRecord) {
+		return errors.Errorf(`%s must contain %s or %s so that keys and values have distinct subjects: '%s'`,
+			OptAvroSubjectTemplate, AvroSubjectTemplateType, AvroSubjectTemplateRecord, e.AvroSubjectTemplate)
+	}
+	if e.AvroUnboundedDecimalPrecision != 0 && e.AvroDecimal == OptAvroDecimalString {
+		return errors.Errorf(`%s cannot be used with %s=%s`,
+			OptAvroUnboundedDecimal, OptAvroDecimal, OptAvroDecimalString)
+	}
+	if e.MergeColumnFamilies && e.Format != OptFormatJSON {
+		return errors.Errorf(`%s is only usable with %s=%s`,
+			OptMergeColumnFamilies, OptFormat, OptFormatJSON)
+	}
+	if e.MVCCTimestamps && (e.MVCCTimestampFormat == OptMVCCTimestampSplit ||
+		e.MVCCTimestampFormat == OptMVCCTimestampNanos) &&
+		e.Format != OptFormatJSON && e.Format != OptFormatMsgpack {
+		return errors.Errorf(`%s=%s is only usable with %s=%s or %s=%s`,
+			OptMVCCTimestamps, e.MVCCTimestampFormat, OptFormat, OptFormatJSON, OptFormat, OptFormatMsgpack)
+	}
+	if e.LatencyTimestamps && e.Format != OptFormatJSON {
+		return errors.Errorf(`%s is only usable with %s=%s`,
+			OptLatencyTimestamps, OptFormat, OptFormatJSON)
+	}
+	if e.EnumCodes && e.Format != OptFormatJSON && e.Format != OptFormatAvro {
+		return errors.Errorf(`%s is only usable with %s=%s or %s=%s`,
+			OptEnumCodes, OptFormat, OptFormatJSON, OptFormat, OptFormatAvro)
+	}
+	if e.ContentHash && (e.Format != OptFormatJSON || e.Envelope != OptEnvelopeWrapped) {
+		return errors.Errorf(`%s is only usable with %s=%s and %s=%s`,
+			OptContentHash, OptFormat, OptFormatJSON, OptEnvelope, OptEnvelopeWrapped)
+	}
+	if e.SourceGeneration && e.Format != OptFormatJSON {
+		return errors.Errorf(`%s is only usable with %s=%s`,
+			OptSourceGeneration, OptFormat, OptFormatJSON)
+	}
+	if e.DeleteBeforeImage && e.Diff {
+		return errors.Errorf(`%s cannot be used with %s, which includes the previous row of deletions`,
+			OptDeleteBeforeImage, OptDiff)
+	}
+	if e.DeleteBeforeImage && e.Envelope != OptEnvelopeWrapped {
+		return errors.Errorf(`%s is only usable with %s=%s`,
+			OptDeleteBeforeImage, OptEnvelope, OptEnvelopeWrapped)
+	}
+	if e.MarkTTLDeletes && (e.Format != OptFormatJSON ||
+		(e.Envelope != OptEnvelopeWrapped && e.Envelope != OptEnvelopeCloudEvents)) {
+		return errors.Errorf(`%s is only usable with %s=%s and %s=%s or %s=%s`,
+			OptMarkTTLDeletes, OptFormat, OptFormatJSON,
+			OptEnvelope, OptEnvelopeWrapped, OptEnvelope, OptEnvelopeCloudEvents)
+	}
+	if e.KeyFormat != `` && e.KeyFormat != OptKeyFormatArray &&
+		e.Format != OptFormatJSON && e.Format != OptFormatMsgpack {
+		return errors.Errorf(`%s=%s is only usable with %s=%s or %s=%s`,
+			OptKeyFormat, e.KeyFormat, OptFormat, OptFormatJSON, OptFormat, OptFormatMsgpack)
+	}
+	if e.KeyDelimiter != `` && e.KeyFormat != OptKeyFormatDelimited {
+		return errors.Errorf(`%s is only usable with %s=%s`,
+			OptKeyDelimiter, OptKeyFormat, OptKeyFormatDelimited)
+	}
+	if e.BareMetadataKey != `` && e.Envelope != OptEnvelopeBare {
+		return errors.Errorf(`%s is only usable with %s=%s`,
+			OptBareMetadataKey, OptEnvelope, OptEnvelopeBare)
+	}
+	if e.BareMetadataKey != `` && e.Format != OptFormatJSON && e.Format != OptFormatMsgpack {
+		return errors.Errorf(`%s is only usable with %s=%s or %s=%s`,
+			OptBareMetadataKey, OptFormat, OptFormatJSON, OptFormat, OptFormatMsgpack)
+	}
+	if e.Envelope != OptEnvelopeWrapped && e.Format != OptFormatJSON && e.Format != OptFormatMsgpack &&
+		e.Format != OptFormatParquet {
 		requiresWrap := []struct {
 			k string
 			b bool
@@ -776,6 +1687,39 @@ func (e EncodingOptions) Validate() error {
 	return nil
 }
 
+// parseDecimalPrecisionAndScale parses a "precision,scale" pair, such as
+// "38,9", as used in the avro_unbounded_decimal option.
+func parseDecimalPrecisionAndScale(v string) (precision int, scale int, _ error) {
+	parts := strings.Split(v, `,`)
+	if len(parts) != 2 {
+		return 0, 0, errors.Errorf(`expected "precision,scale": '%s'`, v)
+	}
+	precision, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || precision <= 0 {
+		return 0, 0, errors.Errorf(`precision must be a positive integer: '%s'`, v)
+	}
+	scale, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || scale < 0 || scale > precision {
+		return 0, 0, errors.Errorf(`scale must be between 0 and the precision: '%s'`, v)
+	}
+	return precision, scale, nil
+}
+
+// Placeholders which may be used in the family_topic_format option.
+const (
+	FamilyTopicFormatTable  = `{table}`
+	FamilyTopicFormatFamily = `{family}`
+)
+
+// Placeholders which may be used in the avro_subject_template option: the
+// topic, the fully-qualified name of the avro record, and whether the schema
+// is of keys or values.
+const (
+	AvroSubjectTemplateTopic  = `{topic}`
+	AvroSubjectTemplateRecord = `{record}`
+	AvroSubjectTemplateType   = `{type}`
+)
+
 // SchemaChangeHandlingOptions specify how the feed should
 // behave when a target is affected by a schema change.
 type SchemaChangeHandlingOptions struct {
@@ -814,13 +1758,24 @@ func (s StatementOptions) GetSchemaChangeHandlingOptions() (SchemaChangeHandling
 // kvfeed or rangefeed want to know about.
 type Filters struct {
 	WithDiff bool
+	// DiffOnlyDeletes is set if the previous values fetched with WithDiff are
+	// only needed for deletions.
+	DiffOnlyDeletes bool
+	// SkipDeletes is set if the deletions issued by the changefeed itself are
+	// not emitted, as under delete_after_emit, where it deletes the rows it
+	// emitted.
+	SkipDeletes bool
 }
 
 // GetFilters returns a populated Filters.
 func (s StatementOptions) GetFilters() Filters {
 	_, withDiff := s.m[OptDiff]
+	_, deleteBeforeImage := s.m[OptDeleteBeforeImage]
+	_, deleteAfterEmit := s.m[OptDeleteAfterEmit]
 	return Filters{
-		WithDiff: withDiff,
+		WithDiff:        withDiff || deleteBeforeImage,
+		DiffOnlyDeletes: deleteBeforeImage && !withDiff,
+		SkipDeletes:     deleteAfterEmit,
 	}
 }
 
@@ -852,18 +1807,66 @@ func (s StatementOptions) GetKafkaConfigJSON() SinkSpecificJSONConfig {
 	return s.getJSONValue(OptKafkaSinkConfig)
 }
 
+// GetPubsubConfigJSON returns arbitrary json to be interpreted
+// by the pubsub sink.
+func (s StatementOptions) GetPubsubConfigJSON() SinkSpecificJSONConfig {
+	return s.getJSONValue(OptPubsubSinkConfig)
+}
+
 // GetResolvedTimestampInterval gets the best-effort interval at which resolved timestamps
 // should be emitted. Nil or 0 means emit as often as possible. False means do not emit at all.
-// Returns an error for negative or invalid duration value.
+// Returns an error for negative or invalid duration value. If the intervals are
+// given per table, this is the shortest of them.
 func (s StatementOptions) GetResolvedTimestampInterval() (*time.Duration, bool, error) {
 	str, ok := s.m[OptResolvedTimestamps]
 	if ok && str == OptEmitAllResolvedTimestamps {
 		return nil, true, nil
 	}
+	if tables, err := s.GetResolvedTimestampTableIntervals(); err != nil || tables != nil {
+		var min *time.Duration
+		for _, d := range tables {
+			d := d
+			if min == nil || d < *min {
+				min = &d
+			}
+		}
+		return min, min != nil, err
+	}
 	d, err := s.getDurationValue(OptResolvedTimestamps)
 	return d, d != nil, err
 }
 
+// GetResolvedTimestampTableIntervals returns the intervals at which resolved
+// timestamps should be emitted to the topics of individual tables, when the
+// resolved option is a list of table=interval pairs, such as
+// `orders=1s,audit=1m`. Tables which are not listed are not sent resolved
+// timestamps. Returns nil if the option is not a list of pairs.
+func (s StatementOptions) GetResolvedTimestampTableIntervals() (map[string]time.Duration, error) {
+	str := s.m[OptResolvedTimestamps]
+	if !strings.Contains(str, `=`) {
+		return nil, nil
+	}
+	intervals := make(map[string]time.Duration)
+	for _, pair := range strings.Split(str, `,`) {
+		table, interval, ok := strings.Cut(pair, `=`)
+		table = strings.TrimSpace(table)
+		if !ok || table == `` {
+			return nil, errors.Errorf("expected table=interval in option %s: '%s'", OptResolvedTimestamps, pair)
+		}
+		if _, ok := intervals[table]; ok {
+			return nil, errors.Errorf("table %s is listed more than once in option %s", table, OptResolvedTimestamps)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing option %s", OptResolvedTimestamps)
+		} else if d < 0 {
+			return nil, errors.Errorf("negative durations are not accepted: %s='%s'", OptResolvedTimestamps, pair)
+		}
+		intervals[table] = d
+	}
+	return intervals, nil
+}
+
 // GetMetricScope returns a namespace for metrics affected by this changefeed, or
 // false if none has been provided.
 func (s StatementOptions) GetMetricScope() (string, bool) {
@@ -900,6 +1903,294 @@ func (s StatementOptions) GetPTSExpiration() (time.Duration, error) {
 	return *exp, nil
 }
 
+// GetPTSExpirationAction returns what to do once the protected timestamp
+// record is older than the maximum age returned by GetPTSExpiration.
+func (s StatementOptions) GetPTSExpirationAction() (PTSExpirationAction, error) {
+	v, err := s.getEnumValue(OptPTSExpirationAction)
+	if err != nil || v == `` {
+		return OptPTSExpirationActionCancel, err
+	}
+	return PTSExpirationAction(v), nil
+}
+
+// GetBatchEnvelopeSize returns the number of rows which should be packed into
+// each message emitted to the sink, or 0 if rows should be emitted
+// individually.
+func (s StatementOptions) GetBatchEnvelopeSize() (int, error) {
+	v, ok := s.m[OptBatchEnvelopeSize]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, errors.Errorf("option %s must be a positive integer: '%s'", OptBatchEnvelopeSize, v)
+	}
+	if format := s.m[OptFormat]; format != `` && format != string(OptFormatJSON) {
+		return 0, errors.Errorf(`%s is only usable with %s=%s`, OptBatchEnvelopeSize, OptFormat, OptFormatJSON)
+	}
+	return n, nil
+}
+
+// GetMaxEmittedBytesPerDay returns the number of bytes the changefeed may emit
+// within a day before it is paused, or 0 if it is unlimited.
+func (s StatementOptions) GetMaxEmittedBytesPerDay() (int64, error) {
+	v, ok := s.m[OptMaxEmittedBytesPerDay]
+	if !ok {
+		return 0, nil
+	}
+	n, err := humanizeutil.ParseBytes(v)
+	if err != nil || n <= 0 {
+		return 0, errors.Errorf("option %s must be a positive size: '%s'", OptMaxEmittedBytesPerDay, v)
+	}
+	return n, nil
+}
+
+// MinSampleRate is the smallest rate accepted by the sample_rate option.
+// Smaller rates would sample too few rows to tell apart from an empty
+// sample, and eventually none at all.
+const MinSampleRate = 1e-6
+
+// GetSampleRate returns the fraction of rows whose changes the changefeed
+// emits, which is 1 unless the sample_rate option is specified.
+func (s StatementOptions) GetSampleRate() (float64, error) {
+	v, ok := s.m[OptSampleRate]
+	if !ok {
+		return 1, nil
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil || !(rate >= MinSampleRate && rate <= 1) {
+		return 0, errors.Errorf("option %s must be a number in the range [%g, 1]: '%s'",
+			OptSampleRate, MinSampleRate, v)
+	}
+	return rate, nil
+}
+
+// EmissionWindow is the daily window of time within which a changefeed emits
+// changes under the emission_window option.
+type EmissionWindow struct {
+	// start and end are the minutes since midnight, in loc, at which the window
+	// opens and closes. Windows which end before they start span midnight.
+	start, end int
+	loc        *time.Location
+}
+
+// ParseEmissionWindow parses a window of the form 'HH:MM-HH:MM [time zone]',
+// e.g. '22:00-06:00 UTC' or '01:00-05:00 America/New_York'. The time zone
+// defaults to UTC.
+func ParseEmissionWindow(s string) (EmissionWindow, error) {
+	var w EmissionWindow
+	fields := strings.Fields(s)
+	if len(fields) != 1 && len(fields) != 2 {
+		return w, errors.Errorf("expected a window of the form 'HH:MM-HH:MM [time zone]'")
+	}
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return w, errors.Errorf("expected a window of the form 'HH:MM-HH:MM [time zone]'")
+	}
+	for i, dest := range []*int{&w.start, &w.end} {
+		t, err := time.Parse("15:04", bounds[i])
+		if err != nil {
+			return w, errors.Errorf("invalid time of day '%s', expected HH:MM", bounds[i])
+		}
+		*dest = t.Hour()*60 + t.Minute()
+	}
+	if w.start == w.end {
+		return w, errors.Errorf("window must not be empty")
+	}
+	w.loc = time.UTC
+	if len(fields) == 2 {
+		loc, err := timeutil.LoadLocation(fields[1])
+		if err != nil {
+			return w, errors.Wrapf(err, "invalid time zone '%s'", fields[1])
+		}
+		w.loc = loc
+	}
+	return w, nil
+}
+
+// Contains returns whether t falls within the window.
+func (w EmissionWindow) Contains(t time.Time) bool {
+	t = t.In(w.loc)
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.start <= m && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// UntilOpen returns how long after t the window next opens, or 0 if t falls
+// within the window.
+func (w EmissionWindow) UntilOpen(t time.Time) time.Duration {
+	if w.Contains(t) {
+		return 0
+	}
+	t = t.In(w.loc)
+	y, m, d := t.Date()
+	// time.Date normalizes the minutes into the time of day.
+	open := time.Date(y, m, d, 0, w.start, 0, 0, w.loc)
+	if !open.After(t) {
+		open = time.Date(y, m, d+1, 0, w.start, 0, 0, w.loc)
+	}
+	return open.Sub(t)
+}
+
+// GetEmissionWindow returns the window within which the changefeed emits
+// changes, or nil if it emits them at any time.
+func (s StatementOptions) GetEmissionWindow() (*EmissionWindow, error) {
+	v, ok := s.m[OptEmissionWindow]
+	if !ok {
+		return nil, nil
+	}
+	w, err := ParseEmissionWindow(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "option %s", OptEmissionWindow)
+	}
+	return &w, nil
+}
+
+// GetCoalesceWindow returns the window within which the updates to a row are
+// collapsed into a single message, or 0 if each update is emitted.
+func (s StatementOptions) GetCoalesceWindow() (time.Duration, error) {
+	w, err := s.getDurationValue(OptCoalesceWindow)
+	if err != nil || w == nil {
+		return 0, err
+	}
+	return *w, nil
+}
+
+// GetDeadLetterTable returns the name of the table into which the events
+// which fail to be encoded are written, or the empty string if they fail the
+// changefeed.
+func (s StatementOptions) GetDeadLetterTable() string {
+	return s.m[OptDeadLetterTable]
+}
+
+// GetContentDigestTable returns the name of the table into which the digests
+// of the messages emitted under the content_hash option are written, or the
+// empty string if they aren't written.
+func (s StatementOptions) GetContentDigestTable() string {
+	return s.m[OptContentDigestTable]
+}
+
+// GetOutputContract returns the contract to which the values of messages
+// must conform, or nil if there is none.
+func (s StatementOptions) GetOutputContract() (*OutputContract, error) {
+	v, ok := s.m[OptOutputContract]
+	if !ok {
+		return nil, nil
+	}
+	c, err := ParseOutputContract(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "option %s", OptOutputContract)
+	}
+	return c, nil
+}
+
+// GetOnContractViolation returns how messages which violate the output
+// contract are handled.
+func (s StatementOptions) GetOnContractViolation() (ContractViolationPolicy, error) {
+	v, err := s.getEnumValue(OptOnContractViolation)
+	if err != nil {
+		return ``, err
+	}
+	if v == `` {
+		return OptOnContractViolationPause, nil
+	}
+	return ContractViolationPolicy(v), nil
+}
+
+// GetOnCompletion returns what the changefeed does with its sink once it
+// completes.
+func (s StatementOptions) GetOnCompletion() (OnCompletionAction, error) {
+	v, err := s.getEnumValue(OptOnCompletion)
+	if err != nil {
+		return ``, err
+	}
+	if v == `` {
+		return OptOnCompletionNoop, nil
+	}
+	return OnCompletionAction(v), nil
+}
+
+// GetOnTruncate returns how the changefeed handles the truncation of a
+// target table.
+func (s StatementOptions) GetOnTruncate() (TruncatePolicy, error) {
+	v, err := s.getEnumValue(OptOnTruncate)
+	if err != nil {
+		return ``, err
+	}
+	if v == `` {
+		return OptOnTruncateFail, nil
+	}
+	return TruncatePolicy(v), nil
+}
+
+// GetOnOffline returns how the changefeed handles a target table being taken
+// offline.
+func (s StatementOptions) GetOnOffline() (OfflinePolicy, error) {
+	v, err := s.getEnumValue(OptOnOffline)
+	if err != nil {
+		return ``, err
+	}
+	if v == `` {
+		return OptOnOfflineFail, nil
+	}
+	return OfflinePolicy(v), nil
+}
+
+// GetSettingsOverrides returns the cluster settings which the changefeed
+// overrides for itself.
+func (s StatementOptions) GetSettingsOverrides() (SettingsOverrides, error) {
+	o, err := ParseSettingsOverrides(s.m[OptSettings])
+	if err != nil {
+		return o, errors.Wrapf(err, "option %s", OptSettings)
+	}
+	return o, nil
+}
+
+// RetryOptions controls how a changefeed retries after encountering a
+// retryable error. Zero values mean that the default is used.
+type RetryOptions struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttemptsBeforePause is the number of consecutive retryable errors,
+	// between which the changefeed made no progress, after which the
+	// changefeed is paused rather than retried. Zero means retry indefinitely.
+	MaxAttemptsBeforePause int
+}
+
+// GetRetryOptions returns the retry policy requested for the changefeed.
+func (s StatementOptions) GetRetryOptions() (RetryOptions, error) {
+	var o RetryOptions
+	minBackoff, err := s.getDurationValue(OptRetryMinBackoff)
+	if err != nil {
+		return o, err
+	}
+	if minBackoff != nil {
+		o.MinBackoff = *minBackoff
+	}
+	maxBackoff, err := s.getDurationValue(OptRetryMaxBackoff)
+	if err != nil {
+		return o, err
+	}
+	if maxBackoff != nil {
+		o.MaxBackoff = *maxBackoff
+	}
+	if minBackoff != nil && maxBackoff != nil && o.MinBackoff > o.MaxBackoff {
+		return o, errors.Errorf("%s='%s' must not be greater than %s='%s'",
+			OptRetryMinBackoff, s.m[OptRetryMinBackoff], OptRetryMaxBackoff, s.m[OptRetryMaxBackoff])
+	}
+	if v, ok := s.m[OptRetryMaxAttemptsBeforePause]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return o, errors.Errorf("option %s must be a positive integer: '%s'",
+				OptRetryMaxAttemptsBeforePause, v)
+		}
+		o.MaxAttemptsBeforePause = n
+	}
+	return o, nil
+}
+
 // ForceKeyInValue sets the encoding option KeyInValue to true and then validates the
 // resoluting encoding options.
 func (s StatementOptions) ForceKeyInValue() error {
@@ -955,6 +2246,16 @@ func (s StatementOptions) GetOnError() (OnErrorType, error) {
 	return OnErrorType(v), nil
 }
 
+// GetSchemaChangeInProgressPolicy returns how to create the changefeed when a
+// target table has a schema change in progress.
+func (s StatementOptions) GetSchemaChangeInProgressPolicy() (SchemaChangeInProgressPolicy, error) {
+	v, err := s.getEnumValue(OptSchemaChangeInProgress)
+	if err != nil || v == `` {
+		return OptSchemaChangeInProgressProceed, err
+	}
+	return SchemaChangeInProgressPolicy(v), nil
+}
+
 func describeEnum(strs ...string) string {
 	switch len(strs) {
 	case 1:
@@ -987,6 +2288,14 @@ func (s StatementOptions) ValidateForCreateChangefeed(isPredicateChangefeed bool
 	if err != nil {
 		return err
 	}
+	if _, ok, err := s.GetRestoreCheckpoint(); err != nil {
+		return err
+	} else if ok && s.HasStartCursor() {
+		return errors.Newf(`cannot specify both %s and %s`, OptRestoreCheckpoint, OptCursor)
+	}
+	if _, err := s.GetTableNameQualifiers(); err != nil {
+		return err
+	}
 	scanType, err := s.GetInitialScanType()
 	if err != nil {
 		return err
@@ -1023,6 +2332,37 @@ func (s StatementOptions) ValidateForCreateChangefeed(isPredicateChangefeed bool
 			}
 		}
 	}
+	if _, err := s.GetRetryOptions(); err != nil {
+		return err
+	}
+	if _, err := s.GetBatchEnvelopeSize(); err != nil {
+		return err
+	}
+	if _, err := s.GetMaxEmittedBytesPerDay(); err != nil {
+		return err
+	}
+	if _, err := s.GetSampleRate(); err != nil {
+		return err
+	}
+	if _, err := s.GetEmissionWindow(); err != nil {
+		return err
+	}
+	if err := s.validateOutputContract(); err != nil {
+		return err
+	}
+	if _, err := s.GetSettingsOverrides(); err != nil {
+		return err
+	}
+	if s.IsSet(OptResolvedPerTable) && !s.IsSet(OptResolvedTimestamps) {
+		return errors.Errorf(`%s requires %s`, OptResolvedPerTable, OptResolvedTimestamps)
+	}
+	if s.IsSet(OptContentDigestTable) {
+		for _, o := range []string{OptContentHash, OptResolvedTimestamps} {
+			if !s.IsSet(o) {
+				return errors.Errorf(`%s requires %s`, OptContentDigestTable, o)
+			}
+		}
+	}
 	for o := range s.m {
 		for _, pair := range incompatibleOptionsMap[o] {
 			if s.IsSet(pair.opt1) && s.IsSet(pair.opt2) {
@@ -1033,6 +2373,34 @@ func (s StatementOptions) ValidateForCreateChangefeed(isPredicateChangefeed bool
 	return nil
 }
 
+// validateOutputContract validates the output_contract option and the
+// options which go with it.
+func (s StatementOptions) validateOutputContract() error {
+	if _, err := s.GetOutputContract(); err != nil {
+		return err
+	}
+	policy, err := s.GetOnContractViolation()
+	if err != nil {
+		return err
+	}
+	if !s.IsSet(OptOutputContract) {
+		if s.IsSet(OptOnContractViolation) {
+			return errors.Errorf(`%s is only usable with %s`, OptOnContractViolation, OptOutputContract)
+		}
+		return nil
+	}
+	if format, err := s.getEnumValue(OptFormat); err != nil {
+		return err
+	} else if format != `` && FormatType(format) != OptFormatJSON {
+		return errors.Errorf(`%s is only usable with %s=%s`, OptOutputContract, OptFormat, OptFormatJSON)
+	}
+	if policy == OptOnContractViolationDeadLetter && !s.IsSet(OptDeadLetterTable) {
+		return errors.Errorf(`%s=%s requires %s`,
+			OptOnContractViolation, OptOnContractViolationDeadLetter, OptDeadLetterTable)
+	}
+	return nil
+}
+
 func (s StatementOptions) validateAgainst(m map[string]OptionPermittedValues) error {
 	for k := range ChangefeedOptionExpectValues {
 		permitted := m[k]
@@ -1042,6 +2410,13 @@ func (s StatementOptions) validateAgainst(m map[string]OptionPermittedValues) er
 		case OptionTypeString, OptionTypeTimestamp, OptionTypeJSON:
 			// Consumer (usually a sink) must parse and validate these
 		case OptionTypeDuration:
+			if k == OptResolvedTimestamps {
+				// The resolved option may also be a list of per table intervals.
+				if _, _, err := s.GetResolvedTimestampInterval(); err != nil {
+					return err
+				}
+				continue
+			}
 			if _, err := s.getDurationValue(k); err != nil {
 				return err
 			}
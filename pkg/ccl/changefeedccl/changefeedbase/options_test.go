@@ -9,9 +9,13 @@
 package changefeedbase
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/stretchr/testify/require"
@@ -40,6 +44,51 @@ func TestOptionsValidations(t *testing.T) {
 		{map[string]string{"initial_scan_only": "", "resolved": ""}, true, "cannot specify both initial_scan='only'"},
 		{map[string]string{"initial_scan_only": "", "resolved": ""}, true, "cannot specify both initial_scan='only'"},
 		{map[string]string{"diff": "", "format": "parquet"}, true, ""},
+		{map[string]string{"resolved": "orders=1s,audit=1m"}, false, ""},
+		{map[string]string{"resolved": "orders=1s,=1m"}, false, "expected table=interval"},
+		{map[string]string{"resolved": "orders=1s,orders=1m"}, false, "listed more than once"},
+		{map[string]string{"resolved": "orders=soon"}, false, "problem parsing option resolved"},
+		{map[string]string{"resolved": "1s", "resolved_per_table": ""}, false, ""},
+		{map[string]string{"resolved_per_table": ""}, false, "resolved_per_table requires resolved"},
+		{map[string]string{"resolved": "", "resolved_per_table": "", "content_hash": "", "content_digest_table": "d"}, false, "is not usable with"},
+		{map[string]string{"resolved": "", "content_hash": "", "content_digest_table": "d"}, false, ""},
+		{map[string]string{"resolved": "", "content_digest_table": "d"}, false, "content_digest_table requires content_hash"},
+		{map[string]string{"content_hash": "", "content_digest_table": "d"}, false, "content_digest_table requires resolved"},
+		{map[string]string{"full_table_name": "", "cluster_alias": "east", "include_tenant_name": ""}, false, ""},
+		{map[string]string{"cluster_alias": "east"}, false, "cluster_alias is only usable with full_table_name"},
+		{map[string]string{"include_tenant_name": ""}, false, "include_tenant_name is only usable with full_table_name"},
+		{map[string]string{"full_table_name": "", "cluster_alias": ""}, false, "cluster_alias must not be empty"},
+		{map[string]string{"max_emitted_bytes_per_day": "10GiB"}, false, ""},
+		{map[string]string{"max_emitted_bytes_per_day": "0"}, false, "max_emitted_bytes_per_day must be a positive size"},
+		{map[string]string{"max_emitted_bytes_per_day": "lots"}, false, "max_emitted_bytes_per_day must be a positive size"},
+		{map[string]string{"settings": "changefeed.memory.per_changefeed_limit=1GiB,changefeed.idle_timeout=1m"}, false, ""},
+		{map[string]string{"settings": "changefeed.idle_timeout"}, false, "expected name=value"},
+		{map[string]string{"settings": "changefeed.node_throttle_config=x"}, false, "cannot be overridden by a changefeed"},
+		{map[string]string{"settings": "changefeed.idle_timeout=1m,changefeed.idle_timeout=2m"}, false, "overridden more than once"},
+		{map[string]string{"settings": "changefeed.frontier_checkpoint_frequency=-1s"}, false, "invalid value for setting"},
+		{map[string]string{"settings": "changefeed.memory.per_changefeed_limit=lots"}, false, "invalid value for setting"},
+		{map[string]string{"sample_rate": "0.01"}, false, ""},
+		{map[string]string{"sample_rate": "1"}, false, ""},
+		{map[string]string{"sample_rate": "0.000001"}, false, ""},
+		{map[string]string{"sample_rate": "1e-20"}, false, "sample_rate must be a number in the range [1e-06, 1]"},
+		{map[string]string{"sample_rate": "0"}, false, "sample_rate must be a number in the range [1e-06, 1]"},
+		{map[string]string{"sample_rate": "1.5"}, false, "sample_rate must be a number in the range [1e-06, 1]"},
+		{map[string]string{"sample_rate": "some"}, false, "sample_rate must be a number in the range [1e-06, 1]"},
+		{map[string]string{"sample_rate": "0.5", "delete_after_emit": ""}, false, "is not usable with"},
+		{map[string]string{"emission_window": "22:00-06:00 UTC"}, false, ""},
+		{map[string]string{"emission_window": "01:30-05:00 America/New_York"}, false, ""},
+		{map[string]string{"emission_window": "22:00"}, false, "expected a window of the form"},
+		{map[string]string{"emission_window": "22:00-25:00"}, false, "invalid time of day '25:00'"},
+		{map[string]string{"emission_window": "22:00-22:00"}, false, "window must not be empty"},
+		{map[string]string{"emission_window": "22:00-06:00 Mars/Olympus"}, false, "invalid time zone"},
+		{map[string]string{"output_contract": `{"type": "object", "required": ["after"]}`}, false, ""},
+		{map[string]string{"output_contract": `{"type": "object"`}, false, "parsing JSON schema"},
+		{map[string]string{"output_contract": `{"minLength": 1}`}, false, `unsupported JSON schema keyword "minLength"`},
+		{map[string]string{"output_contract": `{}`, "format": "avro"}, false, "output_contract is only usable with format=json"},
+		{map[string]string{"on_contract_violation": "pause"}, false, "on_contract_violation is only usable with output_contract"},
+		{map[string]string{"output_contract": `{}`, "on_contract_violation": "dead_letter"}, false,
+			"on_contract_violation=dead_letter requires dead_letter_table"},
+		{map[string]string{"output_contract": `{}`, "on_contract_violation": "dead_letter", "dead_letter_table": "dlq"}, false, ""},
 	}
 
 	for _, test := range tests {
@@ -53,3 +102,221 @@ func TestOptionsValidations(t *testing.T) {
 		}
 	}
 }
+
+func TestResolvedTimestampTableIntervals(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	o := MakeStatementOptions(map[string]string{"resolved": "orders=1s, audit=1m"})
+	tables, err := o.GetResolvedTimestampTableIntervals()
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{"orders": time.Second, "audit": time.Minute}, tables)
+	freq, emit, err := o.GetResolvedTimestampInterval()
+	require.NoError(t, err)
+	require.True(t, emit)
+	require.Equal(t, time.Second, *freq)
+
+	o = MakeStatementOptions(map[string]string{"resolved": "10s"})
+	tables, err = o.GetResolvedTimestampTableIntervals()
+	require.NoError(t, err)
+	require.Nil(t, tables)
+	freq, emit, err = o.GetResolvedTimestampInterval()
+	require.NoError(t, err)
+	require.True(t, emit)
+	require.Equal(t, 10*time.Second, *freq)
+}
+
+func TestAvroSubjectNamingOptions(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tests := []struct {
+		input     map[string]string
+		expectErr string
+	}{
+		{map[string]string{"format": "avro", "avro_subject_name_strategy": "topic_record"}, ""},
+		{map[string]string{"format": "avro", "avro_subject_name_strategy": "nope"}, "unknown avro_subject_name_strategy"},
+		{map[string]string{"avro_subject_name_strategy": "record"}, "avro_subject_name_strategy is only usable with format=avro"},
+		{map[string]string{"format": "avro", "avro_subject_template": "cdc.{topic}-{type}"}, ""},
+		{map[string]string{"format": "avro", "avro_subject_template": ""}, "avro_subject_template must not be empty"},
+		{map[string]string{"format": "avro", "avro_subject_template": "cdc.{topic}"}, "must contain {type} or {record}"},
+		{map[string]string{"format": "avro", "avro_subject_template": "{record}", "avro_subject_name_strategy": "record"}, "cannot be used with"},
+	}
+
+	for _, test := range tests {
+		_, err := MakeStatementOptions(test.input).GetEncodingOptions()
+		if test.expectErr == "" {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err, fmt.Sprintf("%v should not be valid", test.input))
+			require.Contains(t, err.Error(), test.expectErr)
+		}
+	}
+}
+
+func TestSettingsOverrides(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	sv := &cluster.MakeTestingClusterSettings().SV
+	o := MakeStatementOptions(map[string]string{
+		"settings": "changefeed.memory.per_changefeed_limit=1GiB, changefeed.idle_timeout=1m",
+	})
+	overrides, err := o.GetSettingsOverrides()
+	require.NoError(t, err)
+	require.Equal(t, int64(1<<30), overrides.GetByteSize(PerChangefeedMemLimit, sv))
+	require.Equal(t, time.Minute, overrides.GetDuration(IdleTimeout, sv))
+	require.Equal(t, FrontierCheckpointFrequency.Get(sv),
+		overrides.GetDuration(FrontierCheckpointFrequency, sv))
+	require.Equal(t, []string{`changefeed.memory.per_changefeed_limit`}, overrides.Raised(sv))
+	IdleTimeout.Override(context.Background(), sv, 30*time.Second)
+	require.Equal(t, []string{`changefeed.idle_timeout`, `changefeed.memory.per_changefeed_limit`},
+		overrides.Raised(sv))
+
+	overrides, err = MakeDefaultOptions().GetSettingsOverrides()
+	require.NoError(t, err)
+	require.Equal(t, PerChangefeedMemLimit.Get(sv), overrides.GetByteSize(PerChangefeedMemLimit, sv))
+}
+
+func TestEmissionWindow(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	at := func(hour, min int) time.Time {
+		return time.Date(2023, 3, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	// A window spanning midnight.
+	w, err := ParseEmissionWindow("22:00-06:00 UTC")
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		t         time.Time
+		untilOpen time.Duration
+	}{
+		{at(22, 0), 0},
+		{at(23, 59), 0},
+		{at(0, 0), 0},
+		{at(5, 59), 0},
+		{at(6, 0), 16 * time.Hour},
+		{at(12, 30), 9*time.Hour + 30*time.Minute},
+		{at(21, 59), time.Minute},
+	} {
+		require.Equal(t, tc.untilOpen == 0, w.Contains(tc.t), tc.t)
+		require.Equal(t, tc.untilOpen, w.UntilOpen(tc.t), tc.t)
+	}
+
+	// A window within a day, in another time zone.
+	w, err = ParseEmissionWindow("01:00-05:00 America/New_York")
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		t         time.Time
+		untilOpen time.Duration
+	}{
+		{at(6, 0), 0},
+		{at(9, 59), 0},
+		{at(10, 0), 20 * time.Hour},
+		{at(5, 0), time.Hour},
+	} {
+		require.Equal(t, tc.untilOpen == 0, w.Contains(tc.t), tc.t)
+		require.Equal(t, tc.untilOpen, w.UntilOpen(tc.t), tc.t)
+	}
+
+	// The time zone defaults to UTC.
+	w, err = ParseEmissionWindow("10:00-11:00")
+	require.NoError(t, err)
+	require.True(t, w.Contains(at(10, 30)))
+	require.False(t, w.Contains(at(11, 0)))
+}
+
+func TestOutputContract(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	c, err := ParseOutputContract(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"required": ["after"],
+		"additionalProperties": false,
+		"properties": {
+			"after": {
+				"type": ["object", "null"],
+				"required": ["id"],
+				"properties": {
+					"id": {"type": "integer"},
+					"status": {"enum": ["open", "closed"]},
+					"tags": {"type": "array", "items": {"type": "string"}}
+				}
+			},
+			"updated": {"type": "string"}
+		}
+	}`)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		value     string
+		violation string
+	}{
+		{value: `{"after": {"id": 1, "status": "open", "tags": ["a"], "other": 1.5}}`},
+		{value: `{"after": null, "updated": "1.0"}`},
+		{value: `{"after": {"id": 1.0}}`},
+		{value: `{"before": null}`, violation: `object at $ is missing required property "after"`},
+		{value: `{"after": null, "key": [1]}`, violation: `object at $ has unexpected property "key"`},
+		{value: `{"after": {"id": "1"}}`, violation: `value at $.after.id is of type string, expected integer`},
+		{value: `{"after": {"id": 1.5}}`, violation: `value at $.after.id is of type number, expected integer`},
+		{value: `{"after": {"id": 1, "status": "lost"}}`, violation: `value at $.after.status is not one of the values of its enum`},
+		{value: `{"after": {"id": 1, "tags": ["a", 2]}}`, violation: `value at $.after.tags[1] is of type integer, expected string`},
+		{value: `[]`, violation: `value at $ is of type array, expected object`},
+	} {
+		err := c.Validate([]byte(tc.value))
+		if tc.violation == "" {
+			require.NoError(t, err, tc.value)
+		} else {
+			require.EqualError(t, err, tc.violation, tc.value)
+		}
+	}
+}
+
+func TestLintWarnings(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	now := hlc.Timestamp{WallTime: 100}
+	past, future := hlc.Timestamp{WallTime: 10}, hlc.Timestamp{WallTime: 1000}
+	tests := []struct {
+		input    map[string]string
+		cursor   hlc.Timestamp
+		warnings []string
+	}{
+		{map[string]string{}, hlc.Timestamp{}, nil},
+		{map[string]string{"format": "avro", "confluent_schema_registry": "http://r"}, hlc.Timestamp{}, nil},
+		{map[string]string{"format": "json", "avro_schema_prefix": "p"}, hlc.Timestamp{}, nil},
+		{map[string]string{"format": "experimental_avro"}, hlc.Timestamp{}, []string{
+			"format=avro without confluent_schema_registry requires a sink which embeds the schemas of messages, such as cloud storage",
+		}},
+		{map[string]string{"format": "AVRO"}, hlc.Timestamp{}, []string{
+			"format=avro without confluent_schema_registry requires a sink which embeds the schemas of messages, such as cloud storage",
+		}},
+		{map[string]string{"resolved": "10s", "min_checkpoint_frequency": "10s"}, hlc.Timestamp{}, nil},
+		{map[string]string{"resolved": "1s"}, hlc.Timestamp{}, nil},
+		{map[string]string{"resolved": "1s", "min_checkpoint_frequency": "10s"}, hlc.Timestamp{}, []string{
+			"resolved timestamps are emitted at most once every min_checkpoint_frequency=10s",
+		}},
+		{map[string]string{"resolved": "", "min_checkpoint_frequency": "10s"}, hlc.Timestamp{}, []string{
+			"resolved timestamps are emitted at most once every min_checkpoint_frequency=10s",
+		}},
+		{map[string]string{"resolved": "soon", "min_checkpoint_frequency": "10s"}, hlc.Timestamp{}, nil},
+		{map[string]string{"cursor": "1", "no_initial_scan": ""}, past, nil},
+		{map[string]string{"cursor": "1", "initial_scan": "yes"}, future, nil},
+		{map[string]string{"cursor": "1", "no_initial_scan": ""}, future, []string{
+			"cursor 1000.0000000000 is in the future, so the changefeed emits nothing until then",
+		}},
+		{map[string]string{"cursor": "1", "initial_scan": "no"}, future, []string{
+			"cursor 1000.0000000000 is in the future, so the changefeed emits nothing until then",
+		}},
+	}
+
+	for _, test := range tests {
+		o := MakeStatementOptions(test.input)
+		require.Equal(t, test.warnings, o.LintWarnings(test.cursor, now), "%v", test.input)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// OutputContract is a JSON Schema to which the values of the messages of a
+// changefeed must conform, given by the output_contract option. It supports
+// the subset of JSON Schema which describes the shape of documents: the type,
+// properties, required, additionalProperties, items and enum keywords, along
+// with annotations such as title and description. Schemas with any other
+// keyword are rejected, rather than partially enforced.
+type OutputContract struct {
+	root *contractSchema
+}
+
+type contractSchema struct {
+	types                []string
+	properties           map[string]*contractSchema
+	required             []string
+	additionalProperties *contractSchema
+	noAdditional         bool
+	items                *contractSchema
+	enum                 []interface{}
+}
+
+// contractTypes are the types of JSON Schema.
+var contractTypes = map[string]struct{}{
+	`object`: {}, `array`: {}, `string`: {}, `number`: {}, `integer`: {}, `boolean`: {}, `null`: {},
+}
+
+// contractAnnotations are the keywords of JSON Schema which don't constrain
+// documents.
+var contractAnnotations = map[string]struct{}{
+	`$schema`: {}, `$id`: {}, `$comment`: {}, `title`: {}, `description`: {}, `default`: {},
+	`examples`: {},
+}
+
+// ParseOutputContract parses a JSON Schema document.
+func ParseOutputContract(s string) (*OutputContract, error) {
+	v, err := decodeContractJSON([]byte(s))
+	if err != nil {
+		return nil, errors.Wrap(err, `parsing JSON schema`)
+	}
+	root, err := parseContractSchema(v, `$`)
+	if err != nil {
+		return nil, err
+	}
+	return &OutputContract{root: root}, nil
+}
+
+func decodeContractJSON(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New(`unexpected data after JSON document`)
+	}
+	return v, nil
+}
+
+func parseContractSchema(v interface{}, path string) (*contractSchema, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.Newf(`schema at %s must be an object`, path)
+	}
+	// Parse the keywords in order, so that errors are deterministic.
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var s contractSchema
+	for _, k := range keys {
+		v := m[k]
+		switch k {
+		case `type`:
+			switch t := v.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				for _, e := range t {
+					name, ok := e.(string)
+					if !ok {
+						return nil, errors.Newf(`type at %s must be a string or an array of strings`, path)
+					}
+					s.types = append(s.types, name)
+				}
+			default:
+				return nil, errors.Newf(`type at %s must be a string or an array of strings`, path)
+			}
+			for _, t := range s.types {
+				if _, ok := contractTypes[t]; !ok {
+					return nil, errors.Newf(`unknown type %q at %s`, t, path)
+				}
+			}
+		case `properties`:
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errors.Newf(`properties at %s must be an object`, path)
+			}
+			s.properties = make(map[string]*contractSchema, len(props))
+			for name, p := range props {
+				ps, err := parseContractSchema(p, path+`.`+name)
+				if err != nil {
+					return nil, err
+				}
+				s.properties[name] = ps
+			}
+		case `required`:
+			req, ok := v.([]interface{})
+			if !ok {
+				return nil, errors.Newf(`required at %s must be an array of strings`, path)
+			}
+			for _, e := range req {
+				name, ok := e.(string)
+				if !ok {
+					return nil, errors.Newf(`required at %s must be an array of strings`, path)
+				}
+				s.required = append(s.required, name)
+			}
+		case `additionalProperties`:
+			if b, ok := v.(bool); ok {
+				s.noAdditional = !b
+				continue
+			}
+			ap, err := parseContractSchema(v, path+`.*`)
+			if err != nil {
+				return nil, err
+			}
+			s.additionalProperties = ap
+		case `items`:
+			items, err := parseContractSchema(v, path+`[*]`)
+			if err != nil {
+				return nil, err
+			}
+			s.items = items
+		case `enum`:
+			enum, ok := v.([]interface{})
+			if !ok {
+				return nil, errors.Newf(`enum at %s must be an array`, path)
+			}
+			s.enum = enum
+		default:
+			if _, ok := contractAnnotations[k]; !ok {
+				return nil, errors.Newf(`unsupported JSON schema keyword %q at %s`, k, path)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// Validate returns an error describing the first violation of the contract
+// by the given JSON value.
+func (c *OutputContract) Validate(value []byte) error {
+	v, err := decodeContractJSON(value)
+	if err != nil {
+		return errors.Wrap(err, `decoding message`)
+	}
+	return c.root.validate(v, `$`)
+}
+
+func (s *contractSchema) validate(v interface{}, path string) error {
+	if len(s.types) > 0 {
+		t := contractTypeOf(v)
+		matched := false
+		for _, want := range s.types {
+			if want == t || (want == `number` && t == `integer`) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.Newf(`value at %s is of type %s, expected %s`,
+				path, t, strings.Join(s.types, ` or `))
+		}
+	}
+
+	if s.enum != nil {
+		matched := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(e, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.Newf(`value at %s is not one of the values of its enum`, path)
+		}
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := t[name]; !ok {
+				return errors.Newf(`object at %s is missing required property %q`, path, name)
+			}
+		}
+		names := make([]string, 0, len(t))
+		for name := range t {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ps, ok := s.properties[name]
+			switch {
+			case ok:
+			case s.noAdditional:
+				return errors.Newf(`object at %s has unexpected property %q`, path, name)
+			case s.additionalProperties != nil:
+				ps = s.additionalProperties
+			default:
+				continue
+			}
+			if err := ps.validate(t[name], path+`.`+name); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.items != nil {
+			for i, e := range t {
+				if err := s.items.validate(e, fmt.Sprintf(`%s[%d]`, path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// contractTypeOf returns the JSON Schema type of a decoded JSON value.
+func contractTypeOf(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return `null`
+	case bool:
+		return `boolean`
+	case string:
+		return `string`
+	case json.Number:
+		if _, err := strconv.ParseInt(t.String(), 10, 64); err == nil {
+			return `integer`
+		}
+		if f, err := t.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return `integer`
+		}
+		return `number`
+	case []interface{}:
+		return `array`
+	case map[string]interface{}:
+		return `object`
+	default:
+		return fmt.Sprintf(`%T`, v)
+	}
+}
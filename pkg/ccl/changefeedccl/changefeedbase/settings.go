@@ -10,10 +10,15 @@ package changefeedbase
 
 import (
 	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
 	"github.com/cockroachdb/errors"
 )
 
@@ -132,6 +137,18 @@ var ScanRequestSize = settings.RegisterIntSetting(
 	1<<19, // 1/2 MiB
 ).WithPublic()
 
+// ScanStoreOverloadThreshold is the IO overload score above which changefeed
+// scans are paused. A score of 1 is the point at which IO admission control
+// considers a store overloaded. It is disabled by default.
+var ScanStoreOverloadThreshold = settings.RegisterFloatSetting(
+	settings.TenantWritable,
+	"changefeed.backfill.store_overload_threshold",
+	"pause changefeed initial, backfill and catch-up scans, for at most 5 minutes, while the IO "+
+		"overload score of a store holding the spans they read exceeds this value; 0 disables",
+	0,
+	settings.NonNegativeFloat,
+)
+
 // SinkThrottleConfig describes throttling configuration for the sink.
 // 0 values for any of the settings disable that setting.
 type SinkThrottleConfig struct {
@@ -238,6 +255,17 @@ var EventConsumerWorkers = settings.RegisterIntSetting(
 	0,
 ).WithPublic()
 
+// StreamingValueThreshold is the size of events whose values are encoded
+// straight into the buffers handed to the sink.
+var StreamingValueThreshold = settings.RegisterByteSizeSetting(
+	settings.TenantWritable,
+	"changefeed.encoder.streaming_value_threshold",
+	"the size of row changes, as accounted for in the memory of the changefeed, from which "+
+		"their values are encoded straight into the buffers handed to the sink, which lowers the "+
+		"peak memory of changefeeds on tables with large JSONB or BYTES columns (0 disables)",
+	1<<20, // 1 MiB
+).WithPublic()
+
 // EventConsumerWorkerQueueSize specifies the maximum number of events a worker buffer.
 var EventConsumerWorkerQueueSize = settings.RegisterIntSetting(
 	settings.TenantWritable,
@@ -271,6 +299,43 @@ var EventConsumerElasticCPUControlEnabled = settings.RegisterBoolSetting(
 	true,
 )
 
+// SidecarSinks registers the unix sockets of sidecar processes, to which
+// changefeeds with a sidecar://name sink stream their rows.
+var SidecarSinks = settings.RegisterValidatedStringSetting(
+	settings.TenantReadOnly,
+	"changefeed.sidecar_sinks",
+	"comma-separated list of name=path pairs registering the unix sockets of sidecar "+
+		"processes, to which changefeeds with a sidecar://name sink emit using the stream protocol",
+	"",
+	func(_ *settings.Values, s string) error {
+		_, err := ParseSidecarSinks(s)
+		return err
+	},
+)
+
+// ParseSidecarSinks parses the value of the changefeed.sidecar_sinks setting
+// into a map from the name of each sidecar to the path of its socket.
+func ParseSidecarSinks(s string) (map[string]string, error) {
+	sidecars := make(map[string]string)
+	if s == "" {
+		return sidecars, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, path, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" || path == "" {
+			return nil, errors.Errorf("expected name=path, got %q", pair)
+		}
+		if !filepath.IsAbs(path) {
+			return nil, errors.Errorf("the socket of sidecar %s must be an absolute path, got %q", name, path)
+		}
+		if _, ok := sidecars[name]; ok {
+			return nil, errors.Errorf("sidecar %s is registered more than once", name)
+		}
+		sidecars[name] = path
+	}
+	return sidecars, nil
+}
+
 // RequireExternalConnectionSink is used to restrict non-admins with the CHANGEFEED privilege
 // to create changefeeds to external connections only.
 var RequireExternalConnectionSink = settings.RegisterBoolSetting(
@@ -281,3 +346,195 @@ var RequireExternalConnectionSink = settings.RegisterBoolSetting(
 		" see https://www.cockroachlabs.com/docs/stable/create-external-connection.html",
 	false,
 )
+
+// MaxRunningPerNode is the maximum number of changefeeds whose aggregators run
+// concurrently on each node.
+var MaxRunningPerNode = settings.RegisterIntSetting(
+	settings.TenantWritable,
+	"changefeed.max_running_per_node",
+	"maximum number of changefeeds which run concurrently on a node; the aggregators "+
+		"of changefeeds beyond the limit wait for admission, and restart their changefeed "+
+		"if they aren't admitted within a minute (0 disables the limit)",
+	0,
+	settings.NonNegativeInt,
+).WithPublic()
+
+// MaxRunningPerCluster is the maximum number of changefeeds which run
+// concurrently in the cluster.
+var MaxRunningPerCluster = settings.RegisterIntSetting(
+	settings.TenantWritable,
+	"changefeed.max_running_per_cluster",
+	"maximum number of changefeeds which run concurrently in the cluster; changefeeds "+
+		"beyond the limit wait for admission, which is enforced on a best effort basis "+
+		"(0 disables the limit)",
+	0,
+	settings.NonNegativeInt,
+).WithPublic()
+
+// SinkClientPoolEnabled enables sharing the clients of sinks among the
+// changefeeds running on a node.
+var SinkClientPoolEnabled = settings.RegisterBoolSetting(
+	settings.TenantWritable,
+	"changefeed.sink_client_pool.enabled",
+	"if true, the kafka, webhook and pubsub sinks of the changefeeds running on a node "+
+		"share their clients, and connections, with the other sinks of the node configured "+
+		"with the same sink URI",
+	false,
+).WithPublic()
+
+// SinkClientPoolMaxClients is the maximum number of clients which the sinks
+// of the changefeeds running on a node share.
+var SinkClientPoolMaxClients = settings.RegisterIntSetting(
+	settings.TenantWritable,
+	"changefeed.sink_client_pool.max_clients",
+	"maximum number of distinct sink clients shared by the changefeeds running on a node "+
+		"when changefeed.sink_client_pool.enabled is set; changefeeds which need another "+
+		"client fail with a retryable error (0 disables the limit)",
+	0,
+	settings.NonNegativeInt,
+).WithPublic()
+
+// SchemaChangeInProgressMaxWait bounds the time the creation of a changefeed
+// with schema_change_in_progress=wait waits for schema changes to complete.
+var SchemaChangeInProgressMaxWait = settings.RegisterDurationSetting(
+	settings.TenantWritable,
+	"changefeed.schema_change_in_progress.max_wait",
+	"maximum time the creation of a changefeed with schema_change_in_progress = 'wait' waits "+
+		"for the schema changes in progress on its targets to complete before failing",
+	5*time.Minute,
+	settings.PositiveDuration,
+).WithPublic()
+
+// overridableSettings are the cluster settings which a changefeed may
+// override for itself with the settings option, by key.
+var overridableSettings = func() map[string]settings.NonMaskedSetting {
+	m := make(map[string]settings.NonMaskedSetting)
+	for _, s := range []settings.NonMaskedSetting{
+		PerChangefeedMemLimit,
+		IdleTimeout,
+		FrontierCheckpointFrequency,
+		FrontierHighwaterLagCheckpointThreshold,
+		FrontierCheckpointMaxBytes,
+		MinHighWaterMarkCheckpointAdvance,
+		ProtectTimestampInterval,
+		EventConsumerWorkers,
+		EventConsumerWorkerQueueSize,
+	} {
+		m[s.Key()] = s
+	}
+	return m
+}()
+
+// SettingsOverrides holds the values of cluster settings which a changefeed
+// overrides for itself. The zero value overrides no settings.
+type SettingsOverrides struct {
+	ints      map[string]int64
+	durations map[string]time.Duration
+}
+
+// ParseSettingsOverrides parses the value of the settings option, a
+// comma-separated list of name=value pairs of overridable cluster settings.
+func ParseSettingsOverrides(s string) (SettingsOverrides, error) {
+	o := SettingsOverrides{
+		ints:      make(map[string]int64),
+		durations: make(map[string]time.Duration),
+	}
+	if s == "" {
+		return o, nil
+	}
+	seen := make(map[string]struct{})
+	for _, pair := range strings.Split(s, ",") {
+		name, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" || v == "" {
+			return o, errors.Errorf("expected name=value, got %q", pair)
+		}
+		setting, ok := overridableSettings[name]
+		if !ok {
+			return o, errors.Errorf("setting %s cannot be overridden by a changefeed", name)
+		}
+		if _, ok := seen[name]; ok {
+			return o, errors.Errorf("setting %s is overridden more than once", name)
+		}
+		seen[name] = struct{}{}
+		switch setting := setting.(type) {
+		case *settings.ByteSizeSetting:
+			n, err := humanizeutil.ParseBytes(v)
+			if err == nil {
+				err = setting.Validate(n)
+			}
+			if err != nil {
+				return o, errors.Wrapf(err, "invalid value for setting %s", name)
+			}
+			o.ints[name] = n
+		case *settings.IntSetting:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err == nil {
+				err = setting.Validate(n)
+			}
+			if err != nil {
+				return o, errors.Wrapf(err, "invalid value for setting %s", name)
+			}
+			o.ints[name] = n
+		case *settings.DurationSetting:
+			d, err := time.ParseDuration(v)
+			if err == nil {
+				err = setting.Validate(d)
+			}
+			if err != nil {
+				return o, errors.Wrapf(err, "invalid value for setting %s", name)
+			}
+			o.durations[name] = d
+		default:
+			return o, errors.AssertionFailedf("unexpected type %T of setting %s", setting, name)
+		}
+	}
+	return o, nil
+}
+
+// Raised returns the keys, sorted, of the settings which are overridden to
+// values above those of the cluster settings.
+func (o SettingsOverrides) Raised(sv *settings.Values) []string {
+	var raised []string
+	for key, v := range o.ints {
+		var current int64
+		switch s := overridableSettings[key].(type) {
+		case *settings.ByteSizeSetting:
+			current = s.Get(sv)
+		case *settings.IntSetting:
+			current = s.Get(sv)
+		}
+		if v > current {
+			raised = append(raised, key)
+		}
+	}
+	for key, v := range o.durations {
+		if v > overridableSettings[key].(*settings.DurationSetting).Get(sv) {
+			raised = append(raised, key)
+		}
+	}
+	sort.Strings(raised)
+	return raised
+}
+
+// GetInt returns the value of the given setting for the changefeed.
+func (o SettingsOverrides) GetInt(s *settings.IntSetting, sv *settings.Values) int64 {
+	if v, ok := o.ints[s.Key()]; ok {
+		return v
+	}
+	return s.Get(sv)
+}
+
+// GetByteSize returns the value of the given setting for the changefeed.
+func (o SettingsOverrides) GetByteSize(s *settings.ByteSizeSetting, sv *settings.Values) int64 {
+	return o.GetInt(&s.IntSetting, sv)
+}
+
+// GetDuration returns the value of the given setting for the changefeed.
+func (o SettingsOverrides) GetDuration(
+	s *settings.DurationSetting, sv *settings.Values,
+) time.Duration {
+	if v, ok := o.durations[s.Key()]; ok {
+		return v
+	}
+	return s.Get(sv)
+}
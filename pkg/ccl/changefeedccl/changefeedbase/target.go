@@ -19,6 +19,11 @@ type Target struct {
 	TableID           descpb.ID
 	FamilyName        string
 	StatementTimeName StatementTimeName
+	// IndexID is the secondary index watched by SECONDARY_INDEX targets.
+	IndexID descpb.IndexID
+	// TopicName, if set, is used in place of the StatementTimeName to name
+	// the topic of the target.
+	TopicName string
 }
 
 // StatementTimeName is the original way a table was referred to when it was added to
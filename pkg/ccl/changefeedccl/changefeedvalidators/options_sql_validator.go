@@ -37,3 +37,6 @@ var AlterOptionValidations = makeValMap(changefeedbase.AlterChangefeedOptionExpe
 
 // AlterTargetOptionValidations do a basic check on the target-level options in an ALTER CHANGEFEED.
 var AlterTargetOptionValidations = makeValMap(changefeedbase.AlterChangefeedTargetOptions)
+
+// AlterDropTargetOptionValidations do a basic check on the options of targets dropped in an ALTER CHANGEFEED.
+var AlterDropTargetOptionValidations = makeValMap(changefeedbase.AlterChangefeedDropTargetOptions)
@@ -9,12 +9,48 @@
 package changefeedvalidators
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/catconstants"
 	"github.com/cockroachdb/errors"
 )
 
+// auditSystemTables are the system tables which changefeeds may watch, so
+// that changes of interest to auditors, such as to users, roles, privileges
+// and the cluster's event log, may be streamed to a sink. Only admins may
+// create changefeeds on them. The hashed password of each user in
+// system.users isn't emitted; see cdcevent.credentialColumns.
+var auditSystemTables = map[catconstants.SystemTableName]struct{}{
+	catconstants.EventLogTableName:        {},
+	catconstants.UsersTableName:           {},
+	catconstants.RoleMembersTableName:     {},
+	catconstants.RoleOptionsTableName:     {},
+	catconstants.SystemPrivilegeTableName: {},
+}
+
+// IsAuditSystemTable returns whether the table is one of the system tables
+// which changefeeds may watch.
+func IsAuditSystemTable(tableDesc catalog.TableDescriptor) bool {
+	if !catalog.IsSystemDescriptor(tableDesc) {
+		return false
+	}
+	_, ok := auditSystemTables[catconstants.SystemTableName(tableDesc.GetName())]
+	return ok
+}
+
+func auditSystemTableNames() string {
+	names := make([]string, 0, len(auditSystemTables))
+	for name := range auditSystemTables {
+		names = append(names, "system."+string(name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
 // ValidateTable validates that a table descriptor can be watched by a CHANGEFEED.
 func ValidateTable(
 	targets changefeedbase.Targets,
@@ -35,10 +71,12 @@ func validateTable(
 	// Technically, the only non-user table known not to work is system.jobs
 	// (which creates a cycle since the resolved timestamp high-water mark is
 	// saved in it), but our philosophy currently is that any use case for
-	// changefeeds on system tables would be better served by e.g. better
-	// logging and monitoring features.
-	if catalog.IsSystemDescriptor(tableDesc) {
-		return errors.Errorf(`CHANGEFEEDs are not supported on system tables`)
+	// changefeeds on system tables other than auditing would be better served
+	// by e.g. better logging and monitoring features.
+	if catalog.IsSystemDescriptor(tableDesc) && !IsAuditSystemTable(tableDesc) {
+		return errors.WithHintf(
+			errors.Errorf(`CHANGEFEEDs are not supported on system tables`),
+			`the only system tables which may be watched are %s`, auditSystemTableNames())
 	}
 	if tableDesc.IsView() {
 		return errors.Errorf(`CHANGEFEED cannot target views: %s`, tableDesc.GetName())
@@ -46,11 +84,11 @@ func validateTable(
 	if tableDesc.IsVirtualTable() {
 		return errors.Errorf(`CHANGEFEED cannot target virtual tables: %s`, tableDesc.GetName())
 	}
-	if tableDesc.IsSequence() {
-		return errors.Errorf(`CHANGEFEED cannot target sequences: %s`, tableDesc.GetName())
-	}
-	if tableDesc.Offline() {
-		return errors.Errorf("CHANGEFEED cannot target offline table: %s (offline reason: %q)", tableDesc.GetName(), tableDesc.GetOfflineReason())
+	if tableDesc.Offline() && !canHandle.Offline {
+		return errors.WithHintf(
+			errors.Errorf("CHANGEFEED cannot target offline table: %s (offline reason: %q)", tableDesc.GetName(), tableDesc.GetOfflineReason()),
+			`set %s to %s to pause the changefeed, for all of its targets, until its tables come back online`,
+			changefeedbase.OptOnOffline, changefeedbase.OptOnOfflineWait)
 	}
 	found, err := targets.EachHavingTableID(tableDesc.GetID(), func(t changefeedbase.Target) error {
 		if tableDesc.Dropped() {
@@ -80,6 +118,11 @@ func validateTable(
 			if cols == 0 {
 				return errors.Errorf("CHANGEFEED targeting nonexistent or removed column family %s of table %s", t.FamilyName, tableDesc.GetName())
 			}
+		case jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX:
+			index := catalog.FindIndexByID(tableDesc, t.IndexID)
+			if index == nil || !index.Public() {
+				return errors.Errorf("CHANGEFEED targeting nonexistent or removed index %d of table %s", t.IndexID, tableDesc.GetName())
+			}
 		}
 		return nil
 	})
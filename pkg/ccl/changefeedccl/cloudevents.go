@@ -0,0 +1,168 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	gojson "encoding/json"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/errors"
+)
+
+// The attributes of the events of the cloudevents envelope, as specified by
+// CloudEvents 1.0 (https://github.com/cloudevents/spec).
+//
+// The source of an event is the topic of its row, and its subject is the key
+// of the row. The id of an event is the MVCC timestamp and key of the row, so
+// that consumers may use it to discard duplicate deliveries. The type of an
+// event is the operation which produced it: an insert or update if the
+// changefeed has the diff option, and otherwise an upsert, or a delete.
+const (
+	cloudEventsSpecVersion = `1.0`
+	cloudEventsSource      = `/cockroachdb/changefeed`
+	cloudEventsTypePrefix  = `com.cockroachlabs.changefeed.`
+
+	cloudEventsTypeInsert      = cloudEventsTypePrefix + `row.insert`
+	cloudEventsTypeUpdate      = cloudEventsTypePrefix + `row.update`
+	cloudEventsTypeUpsert      = cloudEventsTypePrefix + `row.upsert`
+	cloudEventsTypeDelete      = cloudEventsTypePrefix + `row.delete`
+	cloudEventsTypeResolved    = cloudEventsTypePrefix + `resolved`
+	cloudEventsTypeEndOfStream = cloudEventsTypePrefix + `end_of_stream`
+	cloudEventsTypeTruncated   = cloudEventsTypePrefix + `truncated`
+
+	// cloudEventsContentType and cloudEventsBatchContentType are the content
+	// types of an event, and of a batch of events, in structured mode.
+	cloudEventsContentType      = `application/cloudevents+json`
+	cloudEventsBatchContentType = `application/cloudevents-batch+json`
+
+	// cloudEventsDataAttribute and cloudEventsDataContentTypeAttribute are
+	// not sent as attributes in binary mode; they're the value and content
+	// type of the message.
+	cloudEventsDataAttribute            = `data`
+	cloudEventsDataContentTypeAttribute = `datacontenttype`
+)
+
+// cloudEventKeys are the keys of a structured event.
+var cloudEventKeys = []string{
+	`specversion`, `id`, `source`, `type`, `subject`, `time`,
+	cloudEventsDataContentTypeAttribute, cloudEventsDataAttribute,
+}
+
+// cloudEvent is a structured event.
+type cloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            string      `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// cloudEventSource returns the source of the events of a topic.
+func cloudEventSource(topic string) string {
+	if topic == `` {
+		return cloudEventsSource
+	}
+	return cloudEventsSource + `/` + topic
+}
+
+// cloudEventRowType returns the type of the event of a row.
+func cloudEventRowType(updated, prev cdcevent.Row, withDiff bool) string {
+	switch {
+	case updated.IsDeleted():
+		return cloudEventsTypeDelete
+	case !withDiff:
+		return cloudEventsTypeUpsert
+	case prev.IsInitialized() && !prev.IsDeleted():
+		return cloudEventsTypeUpdate
+	default:
+		return cloudEventsTypeInsert
+	}
+}
+
+// cloudEventTime formats a timestamp as the time of an event.
+func cloudEventTime(ts hlc.Timestamp) string {
+	return ts.GoTime().UTC().Format(time.RFC3339Nano)
+}
+
+// binaryCloudEvent is an event in binary mode.
+type binaryCloudEvent struct {
+	// attributes are the attributes of the event other than its data and data
+	// content type, sorted by name.
+	attributes []cloudEventAttribute
+	// contentType is the content type of data.
+	contentType string
+	data        []byte
+}
+
+type cloudEventAttribute struct {
+	name, value string
+}
+
+// binaryCloudEventEncoder is implemented by encoders which, as they encode
+// the events of rows in structured mode, encode them in binary mode too, so
+// that sinks sending them in binary mode don't parse them again.
+type binaryCloudEventEncoder interface {
+	// lastBinaryCloudEvent returns the event of the last row encoded, in
+	// binary mode.
+	lastBinaryCloudEvent() *binaryCloudEvent
+}
+
+type binaryCloudEventKey struct{}
+
+// withBinaryCloudEvent returns a context carrying the event of the row
+// emitted within it, in binary mode, to the sink.
+func withBinaryCloudEvent(ctx context.Context, event *binaryCloudEvent) context.Context {
+	return context.WithValue(ctx, binaryCloudEventKey{}, event)
+}
+
+// binaryCloudEventFromContext returns the event carried by the context, or
+// nil if it carries none.
+func binaryCloudEventFromContext(ctx context.Context) *binaryCloudEvent {
+	event, _ := ctx.Value(binaryCloudEventKey{}).(*binaryCloudEvent)
+	return event
+}
+
+// makeBinaryCloudEvent converts an event encoded in structured mode to
+// binary mode. It's used for the events which aren't carried to the sink in
+// binary mode already: those of resolved timestamps, which are encoded by the
+// sink, and of rows whose context isn't kept by a sink buffering them.
+func makeBinaryCloudEvent(structured []byte) (binaryCloudEvent, error) {
+	var fields map[string]gojson.RawMessage
+	if err := gojson.Unmarshal(structured, &fields); err != nil {
+		return binaryCloudEvent{}, errors.Wrap(err, `decoding structured cloud event`)
+	}
+	var event binaryCloudEvent
+	for name, raw := range fields {
+		switch name {
+		case cloudEventsDataAttribute:
+			event.data = raw
+		case cloudEventsDataContentTypeAttribute:
+			if err := gojson.Unmarshal(raw, &event.contentType); err != nil {
+				return binaryCloudEvent{}, errors.Wrapf(err, `decoding cloud event attribute %s`, name)
+			}
+		default:
+			var value string
+			if err := gojson.Unmarshal(raw, &value); err != nil {
+				return binaryCloudEvent{}, errors.Wrapf(err, `decoding cloud event attribute %s`, name)
+			}
+			event.attributes = append(event.attributes, cloudEventAttribute{name: name, value: value})
+		}
+	}
+	sort.Slice(event.attributes, func(i, j int) bool {
+		return event.attributes[i].name < event.attributes[j].name
+	})
+	return event, nil
+}
@@ -0,0 +1,332 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/security/username"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/json"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// The content_hash option lets consumers verify that the messages they
+// receive are those the changefeed emitted. Each message carries the SHA-256
+// of the canonical encoding of its row, computed by rowContentHash. Under the
+// content_digest_table option, the digests of the messages are written into a
+// table of the cluster, out of band of the sink, e.g. with
+//
+//	CREATE TABLE db.digests (
+//	  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+//	  job_id INT8 NOT NULL,
+//	  topic STRING NOT NULL,
+//	  since DECIMAL,
+//	  resolved DECIMAL NOT NULL,
+//	  messages INT8 NOT NULL,
+//	  content_hash_xor BYTES NOT NULL
+//	);
+//	CREATE CHANGEFEED FOR foo INTO 'kafka://...'
+//	  WITH content_hash, resolved, content_digest_table='db.digests';
+//
+// Before each resolved timestamp is emitted, a digest is written for each
+// topic the changefeed has emitted messages to: the number of messages of the
+// topic whose updated timestamp is greater than the since timestamp of the
+// digest and no greater than the resolved timestamp, and the XOR of their
+// content hashes. Topics are named as by the changefeed, without the prefix
+// or renaming of any sink. Since changefeeds deliver messages at least once,
+// consumers should discard duplicate messages, with the same key and updated
+// timestamp, before comparing them to a digest. Digests of messages emitted
+// before a changefeed restarted, but not yet covered by a resolved timestamp,
+// are lost, which is why the since timestamp of the first digest after the
+// restart may be later than the previous resolved timestamp.
+
+// contentDigestTableColumns are the columns the changefeed writes into its
+// content digest table. The table may have other columns, as long as they
+// have defaults.
+var contentDigestTableColumns = []string{
+	`job_id`, `topic`, `since`, `resolved`, `messages`, `content_hash_xor`,
+}
+
+const contentDigestTableSchema = `CREATE TABLE <name> (id UUID PRIMARY KEY DEFAULT gen_random_uuid(), ` +
+	`job_id INT8 NOT NULL, topic STRING NOT NULL, since DECIMAL, resolved DECIMAL NOT NULL, ` +
+	`messages INT8 NOT NULL, content_hash_xor BYTES NOT NULL)`
+
+// resolveContentDigestTable resolves the table named by the
+// content_digest_table option, checking that it has the columns the
+// changefeed writes and that the user may insert into it.
+func resolveContentDigestTable(
+	ctx context.Context, p sql.PlanHookState, name string,
+) (descpb.ID, error) {
+	return resolveWritableTable(ctx, p, changefeedbase.OptContentDigestTable, name,
+		contentDigestTableColumns, contentDigestTableSchema)
+}
+
+// rowContentHash returns the content hash of a row: the SHA-256 of its primary
+// key as a JSON array, its updated timestamp as in the updated field of
+// messages, and its value as a JSON object (null for deletions), each followed
+// by a newline.
+func rowContentHash(key json.JSON, updated hlc.Timestamp, after json.JSON) [sha256.Size]byte {
+	h := sha256.New()
+	for _, s := range []string{key.String(), timestampToString(updated), after.String()} {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{'\n'})
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// contentHasher is implemented by encoders which add content hashes to
+// messages.
+type contentHasher interface {
+	// lastContentHash returns the content hash of the last value encoded.
+	lastContentHash() [sha256.Size]byte
+}
+
+// contentDigest is the number of messages in a digest and the XOR of their
+// content hashes.
+type contentDigest struct {
+	messages int64
+	xor      [sha256.Size]byte
+}
+
+func (d *contentDigest) add(messages int64, xor []byte) {
+	d.messages += messages
+	for i := 0; i < len(d.xor) && i < len(xor); i++ {
+		d.xor[i] ^= xor[i]
+	}
+}
+
+// contentDigestKey identifies the digest of the messages emitted to a topic
+// with an updated timestamp.
+type contentDigestKey struct {
+	topic   string
+	updated hlc.Timestamp
+}
+
+// contentDigests accumulates the digests of the messages a changeAggregator
+// emits, by topic and updated timestamp, which are reported to the
+// changeFrontier. It is shared by the event consumers of the aggregator.
+type contentDigests struct {
+	mu struct {
+		syncutil.Mutex
+		digests map[contentDigestKey]*contentDigest
+	}
+}
+
+func newContentDigests() *contentDigests {
+	d := &contentDigests{}
+	d.mu.digests = make(map[contentDigestKey]*contentDigest)
+	return d
+}
+
+// record records a message emitted to the topic with the specified updated
+// timestamp and content hash. A nil contentDigests records nothing.
+func (d *contentDigests) record(topic string, updated hlc.Timestamp, hash [sha256.Size]byte) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := contentDigestKey{topic: topic, updated: updated}
+	digest, ok := d.mu.digests[key]
+	if !ok {
+		digest = &contentDigest{}
+		d.mu.digests[key] = digest
+	}
+	digest.add(1, hash[:])
+}
+
+// drain returns the digests recorded since drain was last called, sorted by
+// updated timestamp and topic.
+func (d *contentDigests) drain() []jobspb.ResolvedSpans_ContentDigest {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.mu.digests) == 0 {
+		return nil
+	}
+	digests := make([]jobspb.ResolvedSpans_ContentDigest, 0, len(d.mu.digests))
+	for key, digest := range d.mu.digests {
+		digests = append(digests, jobspb.ResolvedSpans_ContentDigest{
+			Topic:          key.topic,
+			Updated:        key.updated,
+			Messages:       digest.messages,
+			ContentHashXor: append([]byte(nil), digest.xor[:]...),
+		})
+		delete(d.mu.digests, key)
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		if digests[i].Updated != digests[j].Updated {
+			return digests[i].Updated.Less(digests[j].Updated)
+		}
+		return digests[i].Topic < digests[j].Topic
+	})
+	return digests
+}
+
+// resolvedContentDigests combines the digests reported by the aggregators
+// into the digests of each topic written with resolved timestamps by the
+// changeFrontier.
+type resolvedContentDigests struct {
+	// since is the resolved timestamp of the previous digests, or the
+	// high-water of the changefeed when it started.
+	since hlc.Timestamp
+	// frontier is the frontier the reported digests were last folded at.
+	frontier hlc.Timestamp
+	// folded are the digests, by topic, of the reported messages whose
+	// updated timestamp is no greater than frontier, all of which precede the
+	// next resolved timestamp. Topics are kept once they have been reported,
+	// so that their digests are written for intervals without messages too.
+	folded map[string]*contentDigest
+	// pending are the digests of the reported messages whose updated
+	// timestamp is greater than frontier.
+	pending map[contentDigestKey]*contentDigest
+}
+
+func newResolvedContentDigests() *resolvedContentDigests {
+	return &resolvedContentDigests{
+		folded:  make(map[string]*contentDigest),
+		pending: make(map[contentDigestKey]*contentDigest),
+	}
+}
+
+// foldedDigest returns the folded digest of a topic.
+func (r *resolvedContentDigests) foldedDigest(topic string) *contentDigest {
+	digest, ok := r.folded[topic]
+	if !ok {
+		digest = &contentDigest{}
+		r.folded[topic] = digest
+	}
+	return digest
+}
+
+// add adds digests reported by an aggregator.
+func (r *resolvedContentDigests) add(digests []jobspb.ResolvedSpans_ContentDigest) {
+	for _, d := range digests {
+		if d.Updated.LessEq(r.frontier) {
+			r.foldedDigest(d.Topic).add(d.Messages, d.ContentHashXor)
+			continue
+		}
+		key := contentDigestKey{topic: d.Topic, updated: d.Updated}
+		digest, ok := r.pending[key]
+		if !ok {
+			digest = &contentDigest{}
+			r.pending[key] = digest
+		}
+		digest.add(d.Messages, d.ContentHashXor)
+	}
+}
+
+// fold folds the pending digests at or below frontier, which the aggregators
+// won't report any more messages at, into the digests of their topics.
+func (r *resolvedContentDigests) fold(frontier hlc.Timestamp) {
+	if frontier.LessEq(r.frontier) {
+		return
+	}
+	r.frontier = frontier
+	for key, digest := range r.pending {
+		if key.updated.LessEq(frontier) {
+			r.foldedDigest(key.topic).add(digest.messages, digest.xor[:])
+			delete(r.pending, key)
+		}
+	}
+}
+
+// topicContentDigest is the digest of the messages of a topic.
+type topicContentDigest struct {
+	topic  string
+	digest contentDigest
+}
+
+// take returns the digests, sorted by topic, of the messages emitted since
+// the previous digests up to and including resolved, along with the since
+// timestamp of the digests.
+func (r *resolvedContentDigests) take(
+	resolved hlc.Timestamp,
+) (hlc.Timestamp, []topicContentDigest) {
+	r.fold(resolved)
+	since := r.since
+	r.since = resolved
+	digests := make([]topicContentDigest, 0, len(r.folded))
+	for topic, digest := range r.folded {
+		digests = append(digests, topicContentDigest{topic: topic, digest: *digest})
+		*digest = contentDigest{}
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].topic < digests[j].topic })
+	return since, digests
+}
+
+// contentDigestWriter writes the digests of the messages of a changefeed into
+// its content digest table.
+type contentDigestWriter struct {
+	db      isql.DB
+	user    username.SQLUsername
+	jobID   jobspb.JobID
+	tableID descpb.ID
+	digests *resolvedContentDigests
+}
+
+func newContentDigestWriter(
+	db isql.DB,
+	user username.SQLUsername,
+	jobID jobspb.JobID,
+	tableID descpb.ID,
+	digests *resolvedContentDigests,
+) *contentDigestWriter {
+	return &contentDigestWriter{
+		db:      db,
+		user:    user,
+		jobID:   jobID,
+		tableID: tableID,
+		digests: digests,
+	}
+}
+
+// write writes the digest of each topic of the messages emitted since the
+// previous digests up to and including resolved into the content digest
+// table.
+func (w *contentDigestWriter) write(ctx context.Context, resolved hlc.Timestamp) error {
+	since, digests := w.digests.take(resolved)
+	if len(digests) == 0 {
+		return nil
+	}
+	var sinceDatum tree.Datum = tree.DNull
+	if since.IsSet() {
+		sinceDatum = eval.TimestampToDecimalDatum(since)
+	}
+	stmt := fmt.Sprintf(`INSERT INTO [%d AS t] (%s) VALUES ($1, $2, $3, $4, $5, $6)`,
+		w.tableID, strings.Join(contentDigestTableColumns, `, `))
+	return w.db.Txn(ctx, func(ctx context.Context, txn isql.Txn) error {
+		for _, d := range digests {
+			if _, err := txn.ExecEx(ctx, "changefeed-content-digest", txn.KV(),
+				sessiondata.InternalExecutorOverride{User: w.user}, stmt,
+				int64(w.jobID), d.topic, sinceDatum, eval.TimestampToDecimalDatum(resolved),
+				d.digest.messages, d.digest.xor[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONEncoderContentHash(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+	require.NoError(t, err)
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(1)},
+		rowenc.EncDatum{Datum: tree.NewDString(`bar`)},
+	}, false)
+	deleted := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(1)},
+		rowenc.EncDatum{Datum: tree.DNull},
+	}, true)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	evCtx := eventContext{updated: hlc.Timestamp{WallTime: 1500000000123456789, Logical: 3}}
+
+	opts := changefeedbase.EncodingOptions{
+		Format:      changefeedbase.OptFormatJSON,
+		Envelope:    changefeedbase.OptEnvelopeWrapped,
+		ContentHash: true,
+	}
+	require.NoError(t, opts.Validate())
+	e, err := makeJSONEncoder(opts)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		row       cdcevent.Row
+		canonical string
+		after     string
+	}{
+		{
+			row:       row,
+			canonical: "[1]\n1500000000123456789.0000000003\n{\"a\": 1, \"b\": \"bar\"}\n",
+			after:     `{"a": 1, "b": "bar"}`,
+		},
+		{
+			row:       deleted,
+			canonical: "[1]\n1500000000123456789.0000000003\nnull\n",
+			after:     `null`,
+		},
+	} {
+		sum := sha256.Sum256([]byte(tc.canonical))
+		value, err := e.EncodeValue(context.Background(), evCtx, tc.row, prevRow)
+		require.NoError(t, err)
+		// The content hash implies the updated field, which is part of it.
+		require.Equal(t, fmt.Sprintf(
+			`{"after": %s, "content_hash": "%s", "updated": "1500000000123456789.0000000003"}`,
+			tc.after, hex.EncodeToString(sum[:])), string(value))
+		require.Equal(t, sum, e.lastContentHash())
+	}
+
+	for _, o := range []changefeedbase.EncodingOptions{
+		{Format: changefeedbase.OptFormatAvro, Envelope: changefeedbase.OptEnvelopeWrapped, ContentHash: true},
+		{Format: changefeedbase.OptFormatJSON, Envelope: changefeedbase.OptEnvelopeBare, ContentHash: true},
+	} {
+		require.EqualError(t, o.Validate(),
+			`content_hash is only usable with format=json and envelope=wrapped`)
+	}
+}
+
+func TestContentDigests(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ts := func(wall int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wall} }
+	hash := func(s string) [sha256.Size]byte { return sha256.Sum256([]byte(s)) }
+	xor := func(hashes ...[sha256.Size]byte) []byte {
+		var d contentDigest
+		for _, h := range hashes {
+			d.add(0, h[:])
+		}
+		return d.xor[:]
+	}
+
+	// Aggregators report digests by topic and updated timestamp.
+	agg := newContentDigests()
+	agg.record(`foo`, ts(20), hash(`b`))
+	agg.record(`foo`, ts(10), hash(`a`))
+	agg.record(`foo`, ts(20), hash(`c`))
+	agg.record(`bar`, ts(20), hash(`e`))
+	drained := agg.drain()
+	require.Equal(t, []jobspb.ResolvedSpans_ContentDigest{
+		{Topic: `foo`, Updated: ts(10), Messages: 1, ContentHashXor: xor(hash(`a`))},
+		{Topic: `bar`, Updated: ts(20), Messages: 1, ContentHashXor: xor(hash(`e`))},
+		{Topic: `foo`, Updated: ts(20), Messages: 2, ContentHashXor: xor(hash(`b`), hash(`c`))},
+	}, drained)
+	require.Nil(t, agg.drain())
+
+	// A nil contentDigests records nothing.
+	(*contentDigests)(nil).record(`foo`, ts(10), hash(`a`))
+	require.Nil(t, (*contentDigests)(nil).drain())
+
+	// The changeFrontier takes the digest of each topic of the messages up to
+	// each resolved timestamp.
+	digests := newResolvedContentDigests()
+	digests.since = ts(5)
+	digests.add(drained)
+	digests.add([]jobspb.ResolvedSpans_ContentDigest{
+		{Topic: `foo`, Updated: ts(30), Messages: 1, ContentHashXor: xor(hash(`d`))},
+	})
+	digests.fold(ts(15))
+
+	digest := func(messages int64, hashes ...[sha256.Size]byte) contentDigest {
+		d := contentDigest{messages: messages}
+		copy(d.xor[:], xor(hashes...))
+		return d
+	}
+	since, taken := digests.take(ts(20))
+	require.Equal(t, ts(5), since)
+	require.Equal(t, []topicContentDigest{
+		{topic: `bar`, digest: digest(1, hash(`e`))},
+		{topic: `foo`, digest: digest(3, hash(`a`), hash(`b`), hash(`c`))},
+	}, taken)
+
+	// Topics without messages since the previous digests have empty digests.
+	since, taken = digests.take(ts(40))
+	require.Equal(t, ts(20), since)
+	require.Equal(t, []topicContentDigest{
+		{topic: `bar`, digest: digest(0)},
+		{topic: `foo`, digest: digest(1, hash(`d`))},
+	}, taken)
+}
@@ -0,0 +1,299 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/utilccl"
+	"github.com/cockroachdb/cockroach/pkg/jobs"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/security/username"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/volatility"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+)
+
+// The events of a changefeed which fail to be encoded, or to be evaluated by
+// its CDC query, are poison: retrying them fails again, and would stall the
+// changefeed forever. Under the dead_letter_table option, they are written
+// into a table of the cluster instead, e.g. with
+//
+//	CREATE TABLE db.dlq (
+//	  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+//	  job_id INT8 NOT NULL,
+//	  table_id INT8 NOT NULL,
+//	  key BYTES NOT NULL,
+//	  pretty_key STRING NOT NULL,
+//	  mvcc_timestamp DECIMAL NOT NULL,
+//	  error STRING NOT NULL,
+//	  created TIMESTAMPTZ NOT NULL DEFAULT now()
+//	);
+//	CREATE CHANGEFEED FOR foo INTO 'kafka://...' WITH dead_letter_table='db.dlq';
+//
+// so that they can be triaged with SQL. Once the cause of the failure is
+// fixed, e.g. by updating the rows or the CDC query, the events are replayed
+// with
+//
+//	SELECT crdb_internal.changefeed_replay_dead_letters('db.dlq', <job id>);
+//
+// which deletes the entries of the changefeed from the table and rewrites
+// the current values of their keys, so that the changefeed emits them again.
+
+// deadLetterTableColumns are the columns the changefeed writes into its dead
+// letter table. The table may have other columns, as long as they have
+// defaults.
+var deadLetterTableColumns = []string{
+	`job_id`, `table_id`, `key`, `pretty_key`, `mvcc_timestamp`, `error`,
+}
+
+const deadLetterTableSchema = `CREATE TABLE <name> (id UUID PRIMARY KEY DEFAULT gen_random_uuid(), ` +
+	`job_id INT8 NOT NULL, table_id INT8 NOT NULL, key BYTES NOT NULL, pretty_key STRING NOT NULL, ` +
+	`mvcc_timestamp DECIMAL NOT NULL, error STRING NOT NULL, created TIMESTAMPTZ NOT NULL DEFAULT now())`
+
+// resolveDeadLetterTable resolves the table named by the dead_letter_table
+// option, checking that it has the columns the changefeed writes and that the
+// user may insert into it.
+func resolveDeadLetterTable(
+	ctx context.Context, p sql.PlanHookState, name string,
+) (descpb.ID, error) {
+	return resolveWritableTable(ctx, p, changefeedbase.OptDeadLetterTable, name,
+		deadLetterTableColumns, deadLetterTableSchema)
+}
+
+// resolveWritableTable resolves the table named by the given option, checking
+// that it has the given columns, which the changefeed writes, and that the user
+// may insert into it. The schema is suggested to create the table with if it
+// lacks any of them.
+func resolveWritableTable(
+	ctx context.Context, p sql.PlanHookState, option, name string, columns []string, schema string,
+) (descpb.ID, error) {
+	tn, err := parser.ParseQualifiedTableName(name)
+	if err != nil {
+		return 0, errors.Wrapf(err, `option %s`, option)
+	}
+	_, desc, err := p.ResolveMutableTableDescriptor(ctx, tn, true /* required */, tree.ResolveRequireTableDesc)
+	if err != nil {
+		return 0, errors.Wrapf(err, `option %s`, option)
+	}
+	for _, col := range columns {
+		if catalog.FindColumnByName(desc, col) == nil {
+			return 0, errors.WithHintf(
+				pgerror.Newf(pgcode.UndefinedColumn, `%s %s has no column %s`, option, name, col),
+				`create the table with %s`, schema)
+		}
+	}
+	if err := authorizeUserToWriteTable(ctx, p, desc); err != nil {
+		return 0, err
+	}
+	return desc.GetID(), nil
+}
+
+// deadLetterWriter writes the poison events of a changefeed into its dead
+// letter table.
+type deadLetterWriter struct {
+	db       isql.DB
+	user     username.SQLUsername
+	jobID    jobspb.JobID
+	tableID  descpb.ID
+	logEvery log.EveryN
+}
+
+func newDeadLetterWriter(
+	db isql.DB, user username.SQLUsername, jobID jobspb.JobID, tableID descpb.ID,
+) *deadLetterWriter {
+	return &deadLetterWriter{
+		db:       db,
+		user:     user,
+		jobID:    jobID,
+		tableID:  tableID,
+		logEvery: log.Every(time.Minute),
+	}
+}
+
+// write writes the event kv of the table with the given ID, which failed with
+// eventErr, into the dead letter table.
+func (w *deadLetterWriter) write(
+	ctx context.Context, kv roachpb.KeyValue, tableID descpb.ID, eventErr error,
+) error {
+	if w.logEvery.ShouldLog() {
+		log.Warningf(ctx, "writing event %s@%s to dead letter table %d: %v",
+			kv.Key, kv.Value.Timestamp, w.tableID, eventErr)
+	}
+	stmt := fmt.Sprintf(`INSERT INTO [%d AS t] (%s) VALUES ($1, $2, $3, $4, $5, $6)`,
+		w.tableID, strings.Join(deadLetterTableColumns, `, `))
+	_, err := w.db.Executor().ExecEx(ctx, "changefeed-dead-letter", nil, /* txn */
+		sessiondata.InternalExecutorOverride{User: w.user}, stmt,
+		int64(w.jobID), int64(tableID), []byte(kv.Key), kv.Key.String(),
+		eval.TimestampToDecimalDatum(kv.Value.Timestamp), eventErr.Error())
+	return err
+}
+
+// isPoisonEvent returns whether the given error of an event, which failed to
+// be evaluated or encoded, is not going to go away by retrying the event.
+func isPoisonEvent(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !changefeedbase.IsRetryableError(err) &&
+		changefeedbase.ClassifyError(err) == changefeedbase.ErrorClassInternal
+}
+
+// replayDeadLetters implements the crdb_internal.changefeed_replay_dead_letters
+// builtin. It deletes the entries of the given changefeed from the dead letter
+// table, and rewrites the current values of their keys, or deletes them again
+// if they no longer exist, so that the changefeed emits them again. It returns
+// the number of replayed entries.
+func replayDeadLetters(
+	ctx context.Context, evalCtx *eval.Context, table string, jobID int64,
+) (int64, error) {
+	// The table holds the keys of the rows of any table watched by the
+	// changefeed, which are rewritten below any privilege check.
+	isAdmin, err := evalCtx.SessionAccessor.HasAdminRole(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !isAdmin {
+		return 0, pgerror.New(pgcode.InsufficientPrivilege,
+			`only users with the admin role can replay dead letters`)
+	}
+
+	row, err := evalCtx.Planner.QueryRowEx(ctx, `changefeed-replay-dead-letters`,
+		sessiondata.NoSessionDataOverride, `SELECT $1::STRING::REGCLASS::OID::INT8`, table)
+	if err != nil {
+		return 0, err
+	}
+	tableID := int64(tree.MustBeDInt(row[0]))
+
+	targetSpans, err := deadLetterTargetSpans(ctx, evalCtx, jobID)
+	if err != nil {
+		return 0, err
+	}
+
+	it, err := evalCtx.Planner.QueryIteratorEx(ctx, `changefeed-replay-dead-letters`,
+		sessiondata.NodeUserSessionDataOverride,
+		fmt.Sprintf(`DELETE FROM [%d AS t] WHERE job_id = $1 RETURNING key`, tableID), jobID)
+	if err != nil {
+		return 0, err
+	}
+	var replayKeys []roachpb.Key
+	var ok bool
+	for ok, err = it.Next(ctx); ok; ok, err = it.Next(ctx) {
+		replayKeys = append(replayKeys, roachpb.Key(tree.MustBeDBytes(it.Cur()[0])))
+	}
+	if closeErr := it.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Anyone allowed to insert into the dead letter table can write keys into
+	// it, so only the keys of the tables watched by the changefeed are
+	// rewritten.
+	for _, key := range replayKeys {
+		if !targetSpans.ContainsKey(key) {
+			return 0, pgerror.Newf(pgcode.InsufficientPrivilege,
+				`dead letter key %s is outside of the tables watched by changefeed %d`, key, jobID)
+		}
+	}
+
+	for _, key := range replayKeys {
+		kv, err := evalCtx.Txn.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if !kv.Exists() {
+			if _, err := evalCtx.Txn.Del(ctx, key); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		// Put the value without its checksum, which is recomputed for the key.
+		value := roachpb.Value{RawBytes: kv.Value.RawBytes}
+		value.ClearChecksum()
+		if err := evalCtx.Txn.Put(ctx, key, &value); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(replayKeys)), nil
+}
+
+// deadLetterTargetSpans returns the spans of the tables watched by the
+// changefeed with the given job ID.
+func deadLetterTargetSpans(
+	ctx context.Context, evalCtx *eval.Context, jobID int64,
+) (roachpb.Spans, error) {
+	row, err := evalCtx.Planner.QueryRowEx(ctx, `changefeed-replay-dead-letters`,
+		sessiondata.NodeUserSessionDataOverride,
+		`SELECT payload FROM crdb_internal.system_jobs WHERE id = $1 AND job_type = $2`,
+		jobID, jobspb.TypeChangefeed.String())
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		return nil, pgerror.Newf(pgcode.UndefinedObject, `changefeed %d does not exist`, jobID)
+	}
+	payload, err := jobs.UnmarshalPayload(row[0])
+	if err != nil {
+		return nil, err
+	}
+	details := payload.GetChangefeed()
+	if details == nil {
+		return nil, pgerror.Newf(pgcode.UndefinedObject, `job %d is not a changefeed`, jobID)
+	}
+	var spans roachpb.Spans
+	targets := AllTargets(*details)
+	if err := targets.EachTableID(func(id descpb.ID) error {
+		prefix := evalCtx.Codec.TablePrefix(uint32(id))
+		spans = append(spans, roachpb.Span{Key: prefix, EndKey: prefix.PrefixEnd()})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return spans, nil
+}
+
+func init() {
+	utilccl.RegisterCCLBuiltin("crdb_internal.changefeed_replay_dead_letters",
+		`Replays the events of a changefeed written into its dead letter table.`,
+		tree.Overload{
+			Types: tree.ParamTypes{
+				{Name: "dead_letter_table", Typ: types.String},
+				{Name: "job_id", Typ: types.Int},
+			},
+			ReturnType: tree.FixedReturnType(types.Int),
+			Fn: func(ctx context.Context, evalCtx *eval.Context, args tree.Datums) (tree.Datum, error) {
+				replayed, err := replayDeadLetters(ctx, evalCtx,
+					string(tree.MustBeDString(args[0])), int64(tree.MustBeDInt(args[1])))
+				if err != nil {
+					return nil, err
+				}
+				return tree.NewDInt(tree.DInt(replayed)), nil
+			},
+			Class: tree.NormalClass,
+			Info: "Deletes the entries of the changefeed with the given job ID from the " +
+				"dead letter table, and rewrites the current values of their keys so that " +
+				"the changefeed emits them again. Returns the number of replayed entries.",
+			Volatility: volatility.Volatile,
+		})
+}
@@ -0,0 +1,266 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/security/username"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// deleteAfterEmitBatchSize is the number of rows deleted by each statement
+// run under the delete_after_emit option.
+const deleteAfterEmitBatchSize = 1000
+
+// emittedRowDeleter deletes, under the delete_after_emit option, the rows of
+// the target tables of a changefeed once they have been emitted, which is once
+// the frontier of the changefeed has passed their MVCC timestamp. This turns
+// a table into a transactional outbox: rows inserted into it are emitted and
+// then cleaned up, without a separate job to do so.
+//
+// A row updated after it was emitted has an MVCC timestamp past the frontier,
+// so it is retained until the update is emitted in turn. The deletions
+// themselves are not emitted: each batch of rows is deleted in a transaction
+// which records its commit timestamp in the progress of the job, which the
+// aggregators consult, through issuedDeletes, to skip the deletions issued by
+// the changefeed while still emitting those of other writers.
+//
+// Rows are deleted by a goroutine of its own, so that checkpoints of the
+// changefeed don't wait on the deletions.
+type emittedRowDeleter struct {
+	db       isql.DB
+	registry *jobs.Registry
+	jobID    jobspb.JobID
+	user     username.SQLUsername
+	tableIDs []descpb.ID
+	// after is the timestamp after which rows were last written for them to be
+	// emitted by the changefeed. It is empty if the changefeed emitted every
+	// row in an initial scan, and the time from which it emits changes
+	// otherwise.
+	after hlc.Timestamp
+	// deletedThrough is the frontier as of which rows were last deleted.
+	deletedThrough hlc.Timestamp
+	logEvery       log.EveryN
+
+	// notify is signaled when the frontier through which rows are to be
+	// deleted advances, and done is closed once the goroutine deleting rows
+	// exits.
+	notify chan struct{}
+	done   chan struct{}
+	mu     struct {
+		syncutil.Mutex
+		frontier hlc.Timestamp
+	}
+}
+
+// makeEmittedRowDeleter returns the emittedRowDeleter of the changefeed
+// described by details.
+func makeEmittedRowDeleter(
+	db isql.DB,
+	registry *jobs.Registry,
+	jobID jobspb.JobID,
+	user username.SQLUsername,
+	details jobspb.ChangefeedDetails,
+) (*emittedRowDeleter, error) {
+	opts := changefeedbase.MakeStatementOptions(details.Opts)
+	scanType, err := opts.GetInitialScanType()
+	if err != nil {
+		return nil, err
+	}
+	d := &emittedRowDeleter{
+		db:       db,
+		registry: registry,
+		jobID:    jobID,
+		user:     user,
+		logEvery: log.Every(time.Minute),
+		notify:   make(chan struct{}, 1),
+	}
+	if scanType == changefeedbase.NoInitialScan {
+		d.after = details.StatementTime
+	}
+	targets := AllTargets(details)
+	if err := targets.EachTableID(func(id descpb.ID) error {
+		d.tableIDs = append(d.tableIDs, id)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// start starts the goroutine deleting rows, which runs until ctx is canceled.
+func (d *emittedRowDeleter) start(ctx context.Context, stopper *stop.Stopper) error {
+	d.done = make(chan struct{})
+	if err := stopper.RunAsyncTask(ctx, "changefeed-delete-after-emit", func(ctx context.Context) {
+		defer close(d.done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.notify:
+				d.mu.Lock()
+				frontier := d.mu.frontier
+				d.mu.Unlock()
+				d.deleteThrough(ctx, frontier)
+			}
+		}
+	}); err != nil {
+		close(d.done)
+		return err
+	}
+	return nil
+}
+
+// wait waits for the goroutine deleting rows to exit once its context is
+// canceled.
+func (d *emittedRowDeleter) wait() {
+	if d.done != nil {
+		<-d.done
+	}
+}
+
+// noteFrontier requests that the rows emitted as of frontier be deleted.
+func (d *emittedRowDeleter) noteFrontier(frontier hlc.Timestamp) {
+	d.mu.Lock()
+	d.mu.frontier.Forward(frontier)
+	d.mu.Unlock()
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deleteThrough deletes the rows emitted as of frontier. Failures are logged
+// rather than returned: the rows are deleted after a later checkpoint of the
+// changefeed instead.
+func (d *emittedRowDeleter) deleteThrough(ctx context.Context, frontier hlc.Timestamp) {
+	if frontier.IsEmpty() || !d.deletedThrough.Less(frontier) {
+		return
+	}
+	for _, id := range d.tableIDs {
+		if err := d.deleteTableThrough(ctx, id, frontier); err != nil {
+			if d.logEvery.ShouldLog() {
+				log.Warningf(ctx, "failed to delete rows emitted from table %d as of %s: %v",
+					id, frontier, err)
+			}
+			return
+		}
+	}
+	d.deletedThrough = frontier
+}
+
+func (d *emittedRowDeleter) deleteTableThrough(
+	ctx context.Context, id descpb.ID, frontier hlc.Timestamp,
+) error {
+	stmt := fmt.Sprintf(`DELETE FROM [%d AS t] WHERE crdb_internal_mvcc_timestamp > $1 `+
+		`AND crdb_internal_mvcc_timestamp <= $2 LIMIT %d`, id, deleteAfterEmitBatchSize)
+	for {
+		var deleted int
+		if err := d.db.Txn(ctx, func(ctx context.Context, txn isql.Txn) error {
+			// The commit timestamp of the transaction, which is the timestamp of
+			// the deletions, is fixed so that it can be recorded along with them.
+			deletedAt := txn.KV().CommitTimestamp()
+			var err error
+			deleted, err = txn.ExecEx(ctx, "changefeed-delete-after-emit", txn.KV(),
+				sessiondata.InternalExecutorOverride{User: d.user}, stmt,
+				eval.TimestampToDecimalDatum(d.after), eval.TimestampToDecimalDatum(frontier))
+			if err != nil || deleted == 0 {
+				return err
+			}
+			job, err := d.registry.LoadJobWithTxn(ctx, d.jobID, txn)
+			if err != nil {
+				return err
+			}
+			return job.WithTxn(txn).Update(ctx, func(
+				txn isql.Txn, md jobs.JobMetadata, ju *jobs.JobUpdater,
+			) error {
+				cf := md.Progress.GetChangefeed()
+				if cf == nil {
+					return nil
+				}
+				cf.DeleteAfterEmitTimestamps = append(cf.DeleteAfterEmitTimestamps, deletedAt)
+				ju.UpdateProgress(md.Progress)
+				return nil
+			})
+		}); err != nil {
+			return err
+		}
+		if deleted < deleteAfterEmitBatchSize {
+			return nil
+		}
+	}
+}
+
+// trimDeleteAfterEmitTimestamps returns the timestamps of the deletions issued
+// under delete_after_emit which are past frontier. The aggregators no longer
+// need to recognize the deletions at or below the checkpointed frontier, as
+// they have emitted every change up to it.
+func trimDeleteAfterEmitTimestamps(
+	timestamps []hlc.Timestamp, frontier hlc.Timestamp,
+) []hlc.Timestamp {
+	var trimmed []hlc.Timestamp
+	for _, ts := range timestamps {
+		if frontier.Less(ts) {
+			trimmed = append(trimmed, ts)
+		}
+	}
+	return trimmed
+}
+
+// issuedDeletes recognizes, in an aggregator, the deletions issued by the
+// changefeed under delete_after_emit from the timestamps its emittedRowDeleter
+// records in the progress of the job. The timestamps are recorded in the
+// transaction of the deletions, so they can be read once the deletions are
+// seen by the rangefeed. The job is only loaded for deletions at timestamps
+// not already known, which, as the deletions of other writers are rare in the
+// outbox tables the option is meant for, seldom happens.
+type issuedDeletes struct {
+	registry *jobs.Registry
+	jobID    jobspb.JobID
+	// timestamps are the sorted timestamps of the deletions of the changefeed
+	// last loaded from its job.
+	timestamps []hlc.Timestamp
+}
+
+// issued returns whether the deletion at ts was issued by the changefeed.
+func (d *issuedDeletes) issued(ctx context.Context, ts hlc.Timestamp) (bool, error) {
+	if d.contains(ts) {
+		return true, nil
+	}
+	job, err := d.registry.LoadJob(ctx, d.jobID)
+	if err != nil {
+		return false, err
+	}
+	cf := job.Progress().GetChangefeed()
+	if cf == nil {
+		return false, nil
+	}
+	d.timestamps = append(d.timestamps[:0], cf.DeleteAfterEmitTimestamps...)
+	sort.Slice(d.timestamps, func(i, j int) bool { return d.timestamps[i].Less(d.timestamps[j]) })
+	return d.contains(ts), nil
+}
+
+func (d *issuedDeletes) contains(ts hlc.Timestamp) bool {
+	i := sort.Search(len(d.timestamps), func(i int) bool { return !d.timestamps[i].Less(ts) })
+	return i < len(d.timestamps) && d.timestamps[i] == ts
+}
@@ -0,0 +1,178 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
+	"github.com/cockroachdb/errors"
+)
+
+// errEmittedBytesQuotaExceeded marks errors returned by changefeeds which
+// emitted more than max_emitted_bytes_per_day.
+var errEmittedBytesQuotaExceeded = errors.New("emitted bytes quota exceeded")
+
+// emittedBytesQuotaWindow is the window over which max_emitted_bytes_per_day
+// is enforced.
+const emittedBytesQuotaWindow = 24 * time.Hour
+
+// emittedBytesQuota tracks the bytes emitted by a changefeed against
+// max_emitted_bytes_per_day. The aggregators count the bytes they write to
+// the sink, after compression, and report them along with their resolved
+// spans to the changeFrontier, which enforces the quota for the changefeed as
+// a whole. The window is recorded in the job progress, so that restarting or
+// resuming the changefeed doesn't restore the quota.
+type emittedBytesQuota struct {
+	limit int64
+	now   func() time.Time
+
+	windowStart time.Time
+	emitted     int64
+}
+
+// newEmittedBytesQuota returns a quota which carries on from the window
+// recorded in the job progress, if any.
+func newEmittedBytesQuota(
+	limit int64, now func() time.Time, window jobspb.ChangefeedProgress_EmittedBytesQuotaWindow,
+) *emittedBytesQuota {
+	q := &emittedBytesQuota{limit: limit, now: now}
+	if window.Start.IsEmpty() {
+		q.windowStart = now()
+	} else {
+		q.windowStart = window.Start.GoTime()
+		q.emitted = window.EmittedBytes
+	}
+	return q
+}
+
+// record adds bytes to the bytes emitted in the current window, starting a
+// new window if the current one has ended.
+func (q *emittedBytesQuota) record(bytes int64) {
+	if q == nil {
+		return
+	}
+	if now := q.now(); now.Sub(q.windowStart) >= emittedBytesQuotaWindow {
+		q.windowStart = now
+		q.emitted = 0
+	}
+	q.emitted += bytes
+}
+
+// check returns a terminal error marked with errEmittedBytesQuotaExceeded if
+// more than the quota was emitted in the current window. A nil quota is
+// never exceeded.
+func (q *emittedBytesQuota) check() error {
+	if q == nil || q.emitted <= q.limit {
+		return nil
+	}
+	return changefeedbase.WithTerminalError(errors.Mark(errors.Newf(
+		"emitted %s since %s, exceeding %s=%s",
+		humanizeutil.IBytes(q.emitted), q.windowStart.UTC().Format(time.RFC3339),
+		changefeedbase.OptMaxEmittedBytesPerDay, humanizeutil.IBytes(q.limit),
+	), errEmittedBytesQuotaExceeded))
+}
+
+// window returns the current window, to record in the job progress.
+func (q *emittedBytesQuota) window() jobspb.ChangefeedProgress_EmittedBytesQuotaWindow {
+	if q == nil {
+		return jobspb.ChangefeedProgress_EmittedBytesQuotaWindow{}
+	}
+	return jobspb.ChangefeedProgress_EmittedBytesQuotaWindow{
+		Start:        hlc.Timestamp{WallTime: q.windowStart.UnixNano()},
+		EmittedBytes: q.emitted,
+	}
+}
+
+// emittedBytesQuotaRecorder wraps a metricsRecorder to count the bytes written
+// to the sink, after compression, until they are reported to the
+// changeFrontier to be counted against max_emitted_bytes_per_day.
+type emittedBytesQuotaRecorder struct {
+	inner   metricsRecorder
+	emitted int64 // accessed atomically
+}
+
+var _ metricsRecorder = (*emittedBytesQuotaRecorder)(nil)
+
+func (r *emittedBytesQuotaRecorder) recordOneMessage() recordOneMessageCallback {
+	innerCallback := r.inner.recordOneMessage()
+	return func(mvcc hlc.Timestamp, bytes int, compressedBytes int) {
+		innerCallback(mvcc, bytes, compressedBytes)
+		r.record(bytes, compressedBytes)
+	}
+}
+
+func (r *emittedBytesQuotaRecorder) recordEmittedBatch(
+	startTime time.Time, numMessages int, mvcc hlc.Timestamp, bytes int, compressedBytes int,
+) {
+	r.inner.recordEmittedBatch(startTime, numMessages, mvcc, bytes, compressedBytes)
+	r.record(bytes, compressedBytes)
+}
+
+func (r *emittedBytesQuotaRecorder) record(bytes int, compressedBytes int) {
+	if compressedBytes == sinkDoesNotCompress {
+		compressedBytes = bytes
+	}
+	atomic.AddInt64(&r.emitted, int64(compressedBytes))
+}
+
+// drain returns the bytes counted since the last call, and resets the count.
+// A nil recorder counts no bytes.
+func (r *emittedBytesQuotaRecorder) drain() int64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.SwapInt64(&r.emitted, 0)
+}
+
+func (r *emittedBytesQuotaRecorder) recordMessageSize(sz int64) {
+	r.inner.recordMessageSize(sz)
+}
+
+func (r *emittedBytesQuotaRecorder) recordInternalRetry(numMessages int64, reducedBatchSize bool) {
+	r.inner.recordInternalRetry(numMessages, reducedBatchSize)
+}
+
+func (r *emittedBytesQuotaRecorder) recordResolvedCallback() func() {
+	return r.inner.recordResolvedCallback()
+}
+
+func (r *emittedBytesQuotaRecorder) recordFlushRequestCallback() func() {
+	return r.inner.recordFlushRequestCallback()
+}
+
+func (r *emittedBytesQuotaRecorder) getBackfillCallback() func() func() {
+	return r.inner.getBackfillCallback()
+}
+
+func (r *emittedBytesQuotaRecorder) getBackfillRangeCallback() func(int64) (func(), func()) {
+	return r.inner.getBackfillRangeCallback()
+}
+
+func (r *emittedBytesQuotaRecorder) recordSizeBasedFlush() {
+	r.inner.recordSizeBasedFlush()
+}
+
+func (r *emittedBytesQuotaRecorder) recordSinkHostIO(
+	host string, startTime time.Time, numMessages int, bytes int, err error,
+) {
+	r.inner.recordSinkHostIO(host, startTime, numMessages, bytes, err)
+}
+
+func (r *emittedBytesQuotaRecorder) recordKafkaThrottle(throttleTime time.Duration) {
+	r.inner.recordKafkaThrottle(throttleTime)
+}
+
+func (r *emittedBytesQuotaRecorder) recordCredentialReload() {
+	r.inner.recordCredentialReload()
+}
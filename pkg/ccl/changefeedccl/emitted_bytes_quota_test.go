@@ -0,0 +1,58 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmittedBytesQuota(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	quota := newEmittedBytesQuota(100, func() time.Time { return now },
+		jobspb.ChangefeedProgress_EmittedBytesQuotaWindow{})
+
+	// The aggregators count the bytes written to the sink, after compression.
+	recorder := &emittedBytesQuotaRecorder{inner: (*sliMetrics)(nil)}
+	recorder.recordOneMessage()(hlc.Timestamp{}, 60, sinkDoesNotCompress)
+	recorder.recordEmittedBatch(now, 2, hlc.Timestamp{}, 400, 40)
+	require.EqualValues(t, 100, recorder.drain())
+	require.Zero(t, recorder.drain())
+
+	quota.record(100)
+	require.NoError(t, quota.check())
+	quota.record(1)
+	err := quota.check()
+	require.True(t, errors.Is(err, errEmittedBytesQuotaExceeded))
+	require.Regexp(t, `emitted 101 B since 2023-01-01T00:00:00Z, exceeding max_emitted_bytes_per_day=100 B`, err)
+
+	// A quota created from the window recorded in the job progress carries on
+	// from it.
+	now = now.Add(time.Hour)
+	resumed := newEmittedBytesQuota(100, func() time.Time { return now }, quota.window())
+	require.Regexp(t, `emitted 101 B since 2023-01-01T00:00:00Z`, resumed.check())
+
+	// The bytes emitted in a window don't count against the next one.
+	now = now.Add(emittedBytesQuotaWindow)
+	resumed.record(100)
+	require.NoError(t, resumed.check())
+
+	// A nil quota is never exceeded.
+	require.NoError(t, (*emittedBytesQuota)(nil).check())
+}
@@ -9,12 +9,16 @@
 package changefeedccl
 
 import (
+	"bytes"
 	"context"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/errors"
+	"github.com/lib/pq/oid"
 )
 
 // Encoder turns a row into a serialized changefeed key, value, or resolved
@@ -41,16 +45,44 @@ type Encoder interface {
 	EncodeResolvedTimestamp(context.Context, string, hlc.Timestamp) ([]byte, error)
 }
 
+// streamingEncoder is implemented by encoders which can write the value of a
+// row straight into a buffer. EncodeValue encodes into a buffer of the encoder,
+// which the event consumer then copies into its own buffers, so that a row
+// with multi-MB JSONB or BYTES columns is held in memory several times over,
+// and the buffer of the encoder stays as large as the widest row it encoded.
+// The event consumer instead encodes the values of wide rows, per
+// changefeed.encoder.streaming_value_threshold, straight into a buffer which
+// it hands to the sink.
+type streamingEncoder interface {
+	Encoder
+	// EncodeValueTo appends the encoded value of the given row to buf, as
+	// EncodeValue would return it, returning false if the row has no value.
+	// Large datums are written straight into buf, rather than encoded into
+	// intermediate buffers first.
+	EncodeValueTo(
+		ctx context.Context,
+		buf *bytes.Buffer,
+		evCtx eventContext,
+		updatedRow cdcevent.Row,
+		prevRow cdcevent.Row,
+	) (bool, error)
+}
+
+// getEncoder returns the Encoder for the given options. reg, if non-nil, is
+// the schema registry provided by the sink (see schemaRegistryForSink) and is
+// used by formats which require one when none was configured by the user.
 func getEncoder(
-	opts changefeedbase.EncodingOptions, targets changefeedbase.Targets,
+	opts changefeedbase.EncodingOptions, targets changefeedbase.Targets, reg schemaRegistry,
 ) (Encoder, error) {
 	switch opts.Format {
 	case changefeedbase.OptFormatJSON:
 		return makeJSONEncoder(opts)
 	case changefeedbase.OptFormatAvro, changefeedbase.DeprecatedOptFormatAvro:
-		return newConfluentAvroEncoder(opts, targets)
+		return newConfluentAvroEncoder(opts, targets, reg)
 	case changefeedbase.OptFormatCSV:
 		return newCSVEncoder(opts), nil
+	case changefeedbase.OptFormatMsgpack:
+		return makeMsgpackEncoder(opts)
 	case changefeedbase.OptFormatParquet:
 		//We will return no encoder for parquet format because there is a separate
 		//sink implemented for parquet format for cloud storage, which does the job
@@ -68,3 +100,10 @@ func getEncoder(
 func timestampToString(t hlc.Timestamp) string {
 	return t.WithSynthetic(false).AsOfSystemTime()
 }
+
+// enumCode returns the code of an enum value emitted with the enum_codes
+// option: the OID of the value in pg_enum, which is stable across values being
+// added to the enum and the value being renamed.
+func enumCode(d *tree.DEnum) oid.Oid {
+	return sql.EnumMemberOid(d.EnumTyp.Oid(), d.PhysicalRep)
+}
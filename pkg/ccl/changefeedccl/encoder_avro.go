@@ -12,6 +12,7 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"strings"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
@@ -22,9 +23,11 @@ import (
 	"github.com/cockroachdb/errors"
 )
 
+// The types of the schemas registered in the schema registry, which are the
+// suffixes of their subjects under the topic subject name strategy.
 const (
-	confluentSubjectSuffixKey   = `-key`
-	confluentSubjectSuffixValue = `-value`
+	confluentSubjectTypeKey   = `key`
+	confluentSubjectTypeValue = `value`
 )
 
 // confluentAvroEncoder encodes changefeed entries as Avro's binary or textual
@@ -33,10 +36,13 @@ const (
 type confluentAvroEncoder struct {
 	schemaRegistry            schemaRegistry
 	schemaPrefix              string
+	subjectNameStrategy       changefeedbase.AvroSubjectNameStrategy
+	subjectTemplate           string
 	updatedField, beforeField bool
 	virtualColumnVisibility   changefeedbase.VirtualColumnVisibility
 	targets                   changefeedbase.Targets
 	envelopeType              changefeedbase.EnvelopeType
+	typeOpts                  avroTypeOptions
 
 	keyCache   *cache.UnorderedCache // [tableIDAndVersion]confluentRegisteredKeySchema
 	valueCache *cache.UnorderedCache // [tableIDAndVersionPair]confluentRegisteredEnvelopeSchema
@@ -74,17 +80,20 @@ var encoderCacheConfig = cache.Config{
 }
 
 func newConfluentAvroEncoder(
-	opts changefeedbase.EncodingOptions, targets changefeedbase.Targets,
+	opts changefeedbase.EncodingOptions, targets changefeedbase.Targets, reg schemaRegistry,
 ) (*confluentAvroEncoder, error) {
 	e := &confluentAvroEncoder{
 		schemaPrefix:            opts.AvroSchemaPrefix,
+		subjectNameStrategy:     opts.AvroSubjectNameStrategy,
+		subjectTemplate:         opts.AvroSubjectTemplate,
 		targets:                 targets,
 		virtualColumnVisibility: opts.VirtualColumns,
 		envelopeType:            opts.Envelope,
+		typeOpts:                makeAvroTypeOptions(opts),
 	}
 
 	e.updatedField = opts.UpdatedTimestamps
-	e.beforeField = opts.Diff
+	e.beforeField = opts.Diff || opts.DeleteBeforeImage
 
 	// TODO: Implement this.
 	if opts.KeyInValue {
@@ -97,16 +106,17 @@ func newConfluentAvroEncoder(
 		return nil, errors.Errorf(`%s is not supported with %s=%s`,
 			changefeedbase.OptTopicInValue, changefeedbase.OptFormat, changefeedbase.OptFormatAvro)
 	}
-	if len(opts.SchemaRegistryURI) == 0 {
+	if len(opts.SchemaRegistryURI) != 0 {
+		var err error
+		reg, err = newConfluentSchemaRegistry(opts.SchemaRegistryURI)
+		if err != nil {
+			return nil, err
+		}
+	} else if reg == nil {
 		return nil, errors.Errorf(`WITH option %s is required for %s=%s`,
 			changefeedbase.OptConfluentSchemaRegistry, changefeedbase.OptFormat, changefeedbase.OptFormatAvro)
 	}
 
-	reg, err := newConfluentSchemaRegistry(opts.SchemaRegistryURI)
-	if err != nil {
-		return nil, err
-	}
-
 	e.schemaRegistry = reg
 	e.keyCache = cache.NewUnorderedCache(encoderCacheConfig)
 	e.valueCache = cache.NewUnorderedCache(encoderCacheConfig)
@@ -122,7 +132,8 @@ func (e *confluentAvroEncoder) rawTableName(eventMeta cdcevent.Metadata) (string
 		return eventMeta.TableName, errors.Newf("Could not find Target for %s", eventMeta)
 	}
 	switch target.Type {
-	case jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY:
+	case jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY,
+		jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX:
 		return e.schemaPrefix + string(target.StatementTimeName), nil
 	case jobspb.ChangefeedTargetSpecification_EACH_FAMILY:
 		return fmt.Sprintf("%s%s.%s", e.schemaPrefix, target.StatementTimeName, eventMeta.FamilyName), nil
@@ -151,15 +162,13 @@ func (e *confluentAvroEncoder) EncodeKey(ctx context.Context, row cdcevent.Row)
 		if err != nil {
 			return nil, err
 		}
-		registered.schema, err = primaryIndexToAvroSchema(row, tableName, e.schemaPrefix)
+		registered.schema, err = primaryIndexToAvroSchema(row, tableName, e.schemaPrefix, e.typeOpts)
 		if err != nil {
 			return nil, err
 		}
 
-		// NB: This uses the kafka name escaper because it has to match the name
-		// of the kafka topic.
-		subject := SQLNameToKafkaName(tableName) + confluentSubjectSuffixKey
-		registered.registryID, err = e.register(ctx, &registered.schema.avroRecord, subject)
+		registered.registryID, err = e.register(
+			ctx, &registered.schema.avroRecord, tableName, confluentSubjectTypeKey)
 		if err != nil {
 			return nil, err
 		}
@@ -209,13 +218,13 @@ func (e *confluentAvroEncoder) EncodeValue(
 		var beforeDataSchema, afterDataSchema, recordDataSchema *avroDataRecord
 		if e.beforeField && prevRow.IsInitialized() {
 			var err error
-			beforeDataSchema, err = tableToAvroSchema(prevRow, `before`, e.schemaPrefix)
+			beforeDataSchema, err = tableToAvroSchema(prevRow, `before`, e.schemaPrefix, e.typeOpts)
 			if err != nil {
 				return nil, err
 			}
 		}
 
-		currentSchema, err := tableToAvroSchema(updatedRow, avroSchemaNoSuffix, e.schemaPrefix)
+		currentSchema, err := tableToAvroSchema(updatedRow, avroSchemaNoSuffix, e.schemaPrefix, e.typeOpts)
 		if err != nil {
 			return nil, err
 		}
@@ -244,10 +253,8 @@ func (e *confluentAvroEncoder) EncodeValue(
 			return nil, err
 		}
 
-		// NB: This uses the kafka name escaper because it has to match the name
-		// of the kafka topic.
-		subject := SQLNameToKafkaName(name) + confluentSubjectSuffixValue
-		registered.registryID, err = e.register(ctx, &registered.schema.avroRecord, subject)
+		registered.registryID, err = e.register(
+			ctx, &registered.schema.avroRecord, name, confluentSubjectTypeValue)
 		if err != nil {
 			return nil, err
 		}
@@ -283,10 +290,8 @@ func (e *confluentAvroEncoder) EncodeResolvedTimestamp(
 			return nil, err
 		}
 
-		// NB: This uses the kafka name escaper because it has to match the name
-		// of the kafka topic.
-		subject := SQLNameToKafkaName(topic) + confluentSubjectSuffixValue
-		registered.registryID, err = e.register(ctx, &registered.schema.avroRecord, subject)
+		registered.registryID, err = e.register(
+			ctx, &registered.schema.avroRecord, topic, confluentSubjectTypeValue)
 		if err != nil {
 			return nil, err
 		}
@@ -309,8 +314,35 @@ func (e *confluentAvroEncoder) EncodeResolvedTimestamp(
 	return registered.schema.BinaryFromRow(header, meta, nilRow, nilRow, nilRow)
 }
 
+// register registers the schema of the keys or values of the given topic,
+// under the subject given by the subject naming options.
 func (e *confluentAvroEncoder) register(
-	ctx context.Context, schema *avroRecord, subject string,
+	ctx context.Context, schema *avroRecord, topic string, subjectType string,
 ) (int32, error) {
-	return e.schemaRegistry.RegisterSchemaForSubject(ctx, subject, schema.codec.Schema())
+	return e.schemaRegistry.RegisterSchemaForSubject(
+		ctx, e.subject(schema, topic, subjectType), schema.codec.Schema())
+}
+
+// subject returns the subject under which the schema of the keys or values of
+// the given topic is registered.
+func (e *confluentAvroEncoder) subject(schema *avroRecord, topic string, subjectType string) string {
+	// NB: This uses the kafka name escaper because it has to match the name
+	// of the kafka topic.
+	topic = SQLNameToKafkaName(topic)
+	record := avroUnionKey(schema)
+	if e.subjectTemplate != `` {
+		return strings.NewReplacer(
+			changefeedbase.AvroSubjectTemplateTopic, topic,
+			changefeedbase.AvroSubjectTemplateRecord, record,
+			changefeedbase.AvroSubjectTemplateType, subjectType,
+		).Replace(e.subjectTemplate)
+	}
+	switch e.subjectNameStrategy {
+	case changefeedbase.OptAvroSubjectNameStrategyRecord:
+		return record
+	case changefeedbase.OptAvroSubjectNameStrategyTopicRecord:
+		return topic + `-` + record
+	default:
+		return topic + `-` + subjectType
+	}
 }
@@ -11,7 +11,12 @@ package changefeedccl
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	gojson "encoding/json"
+	"fmt"
+	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,42 +33,124 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/cache"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/json"
+	"github.com/cockroachdb/cockroach/pkg/util/stringencoding"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 )
 
 // jsonEncoder encodes changefeed entries as JSON. Keys are the primary key
-// columns in a JSON array. Values are a JSON object mapping every column name
-// to its value. Updated timestamps in rows and resolved timestamp payloads are
-// stored in a sub-object under the `__crdb__` key in the top-level JSON object.
+// columns in a JSON array, unless another key_format is specified. Values are
+// a JSON object mapping every column name to its value. Updated timestamps in rows and resolved timestamp payloads are
+// stored in a sub-object under the `__crdb__` key, or that of the
+// bare_metadata_key option, in the top-level JSON object.
 type jsonEncoder struct {
 	updatedField, mvccTimestampField, beforeField, keyInValue, topicInValue bool
+	familyInValue, latencyFields, enumCodes                                 bool
 	envelopeType                                                            changefeedbase.EnvelopeType
+	mvccTimestampFormat                                                     changefeedbase.MVCCTimestampFormat
+
+	// keyFormat is the encoding of message keys. keyEscaper escapes
+	// keyDelimiter in the values of delimited keys.
+	keyFormat    changefeedbase.KeyFormat
+	keyDelimiter string
+	keyEscaper   *strings.Replacer
+
+	// metaKey is the key under which the metadata of messages in the bare
+	// envelope is nested.
+	metaKey string
+
+	// jsonSchema is set if messages are wrapped in the schema and payload
+	// envelope of the Kafka Connect JsonConverter, as described in
+	// json_schema.go.
+	jsonSchema bool
+
+	// now is the clock read for the current_ts of the goldengate envelope.
+	now func() time.Time
+
+	// ttlDeletes is set if messages carry the operation of their change,
+	// which is an insert or update if withDiff is set, and otherwise an
+	// upsert, or a delete or TTL delete.
+	ttlDeletes, withDiff bool
+
+	// contentHash is set if messages carry the content hash of their row,
+	// the last of which is kept in contentHashSum. It implies updatedField,
+	// since the updated timestamp is part of the hash.
+	contentHash    bool
+	contentHashSum [sha256.Size]byte
+
+	// binaryCloudEvents is set if the events of the cloudevents envelope are
+	// sent in binary mode, in which case the event of the last row encoded is
+	// kept in lastCloudEvent too.
+	binaryCloudEvents bool
+	lastCloudEvent    *binaryCloudEvent
+
+	// source, if set, holds the ID of the cluster running the changefeed and
+	// the generation of the changefeed, which are added to each message under
+	// the source_generation option.
+	source       json.JSON
+	sourceMarker map[string]interface{}
+
+	// streamer, if set, streams the large datums of values encoded by
+	// EncodeValueTo. It is unset if the content hash of rows, which is
+	// computed from their JSON, is needed.
+	streamer *datumStreamer
 
 	buf             bytes.Buffer
 	versionEncoder  func(ed *cdcevent.EventDescriptor) *versionEncoder
 	envelopeEncoder func(evCtx eventContext, updated, prev cdcevent.Row) (json.JSON, error)
 }
 
-var _ Encoder = &jsonEncoder{}
+var _ streamingEncoder = &jsonEncoder{}
 
 func canJSONEncodeMetadata(e changefeedbase.EnvelopeType) bool {
 	// bare envelopes use the _crdb_ key to avoid collisions with column names.
 	// wrapped envelopes can put metadata at the top level because the columns
-	// are nested under the "after:" key.
-	return e == changefeedbase.OptEnvelopeBare || e == changefeedbase.OptEnvelopeWrapped
+	// are nested under the "after:" key, as do cloudevents envelopes in the data
+	// of their events.
+	return e == changefeedbase.OptEnvelopeBare || e == changefeedbase.OptEnvelopeWrapped ||
+		e == changefeedbase.OptEnvelopeCloudEvents
 }
 
 func makeJSONEncoder(opts changefeedbase.EncodingOptions) (*jsonEncoder, error) {
 	versionCache := cache.NewUnorderedCache(cdcevent.DefaultCacheConfig)
+	metaKey := jsonMetaSentinel
+	if opts.BareMetadataKey != `` {
+		metaKey = opts.BareMetadataKey
+	}
+	binaryCloudEvents := opts.Envelope == changefeedbase.OptEnvelopeCloudEvents &&
+		opts.CloudEventsMode == changefeedbase.OptCloudEventsModeBinary
+	var streamer *datumStreamer
+	// The content hashes, and the data of binary events, of rows are computed
+	// from their JSON, so their datums can't be streamed.
+	if !opts.ContentHash && !binaryCloudEvents {
+		streamer = newDatumStreamer()
+	}
 	e := &jsonEncoder{
-		envelopeType:       opts.Envelope,
-		updatedField:       opts.UpdatedTimestamps,
-		mvccTimestampField: opts.MVCCTimestamps,
+		envelopeType:        opts.Envelope,
+		updatedField:        opts.UpdatedTimestamps || opts.ContentHash,
+		mvccTimestampField:  opts.MVCCTimestamps,
+		mvccTimestampFormat: opts.MVCCTimestampFormat,
 		// In the bare envelope we don't output diff directly, it's incorporated into the
 		// projection as desired.
-		beforeField:  opts.Diff && opts.Envelope != changefeedbase.OptEnvelopeBare,
+		beforeField:  (opts.Diff || opts.DeleteBeforeImage) && opts.Envelope != changefeedbase.OptEnvelopeBare,
 		keyInValue:   opts.KeyInValue,
 		topicInValue: opts.TopicInValue,
+		// Merged column families share a topic, so the family is recorded
+		// in the message instead.
+		familyInValue:     opts.MergeColumnFamilies,
+		ttlDeletes:        opts.MarkTTLDeletes,
+		withDiff:          opts.Diff,
+		latencyFields:     opts.LatencyTimestamps,
+		enumCodes:         opts.EnumCodes,
+		contentHash:       opts.ContentHash,
+		binaryCloudEvents: binaryCloudEvents,
+		now:               timeutil.Now,
+		keyFormat:         opts.KeyFormat,
+		keyDelimiter:      opts.KeyDelimiter,
+		metaKey:           metaKey,
+		jsonSchema:        opts.JSONSchema,
+		streamer:          streamer,
 		versionEncoder: func(ed *cdcevent.EventDescriptor) *versionEncoder {
 			key := cdcevent.CacheKey{
 				ID:       ed.TableID,
@@ -71,11 +158,28 @@ func makeJSONEncoder(opts changefeedbase.EncodingOptions) (*jsonEncoder, error)
 				FamilyID: ed.FamilyID,
 			}
 			return cdcevent.GetCachedOrCreate(key, versionCache, func() interface{} {
-				return &versionEncoder{}
+				return &versionEncoder{
+					enumCodes: opts.EnumCodes, metaKey: metaKey, jsonAsText: opts.JSONSchema, streamer: streamer,
+				}
 			}).(*versionEncoder)
 		},
 	}
 
+	if opts.SourceGeneration {
+		e.sourceMarker = map[string]interface{}{
+			"cluster_id": opts.SourceClusterID,
+			"generation": opts.Generation,
+		}
+		b := json.NewObjectBuilder(2)
+		b.Add("cluster_id", json.FromString(opts.SourceClusterID))
+		b.Add("generation", json.FromInt64(opts.Generation))
+		e.source = b.Build()
+	}
+
+	if e.keyFormat == changefeedbase.OptKeyFormatDelimited {
+		e.keyEscaper = strings.NewReplacer(`\`, `\\`, e.keyDelimiter, `\`+e.keyDelimiter)
+	}
+
 	if !canJSONEncodeMetadata(e.envelopeType) {
 		if e.keyInValue {
 			return nil, errors.Errorf(`%s is only usable with %s=%s`,
@@ -85,16 +189,33 @@ func makeJSONEncoder(opts changefeedbase.EncodingOptions) (*jsonEncoder, error)
 			return nil, errors.Errorf(`%s is only usable with %s=%s`,
 				changefeedbase.OptTopicInValue, changefeedbase.OptEnvelope, changefeedbase.OptEnvelopeWrapped)
 		}
+		if e.familyInValue {
+			return nil, errors.Errorf(`%s is only usable with %s=%s`,
+				changefeedbase.OptMergeColumnFamilies, changefeedbase.OptEnvelope, changefeedbase.OptEnvelopeWrapped)
+		}
+		if e.source != nil {
+			return nil, errors.Errorf(`%s is only usable with %s=%s`,
+				changefeedbase.OptSourceGeneration, changefeedbase.OptEnvelope, changefeedbase.OptEnvelopeWrapped)
+		}
 	}
 
 	if e.envelopeType == changefeedbase.OptEnvelopeWrapped {
 		if err := e.initWrappedEnvelope(); err != nil {
 			return nil, err
 		}
+	} else if e.envelopeType == changefeedbase.OptEnvelopeCloudEvents {
+		if err := e.initCloudEventsEnvelope(); err != nil {
+			return nil, err
+		}
+	} else if e.envelopeType == changefeedbase.OptEnvelopeGoldenGate {
+		e.initGoldenGateEnvelope()
 	} else {
 		if err := e.initRawEnvelope(); err != nil {
 			return nil, err
 		}
+		if e.jsonSchema {
+			e.initConnectSchema()
+		}
 	}
 
 	return e, nil
@@ -103,19 +224,135 @@ func makeJSONEncoder(opts changefeedbase.EncodingOptions) (*jsonEncoder, error)
 // versionEncoder memoizes version specific encoding state.
 type versionEncoder struct {
 	valueBuilder *json.FixedKeysObjectBuilder
+	// enumCodes is set if enum values are encoded along with their codes.
+	enumCodes bool
+	// metaKey is the key under which the metadata of the row is nested.
+	metaKey string
+	// jsonAsText is set if JSONB values are encoded as their text, for
+	// consumers of the json_schema option, whose types have no place for
+	// arbitrary JSON.
+	jsonAsText bool
+	// valueConnectSchema and keyConnectSchema memoize the schemas of the
+	// values and keys of the version under the json_schema option.
+	valueConnectSchema, keyConnectSchema json.JSON
+	// streamer, if set, replaces the large datums of rows with placeholders
+	// while it is streaming a value.
+	streamer *datumStreamer
 }
 
 // EncodeKey implements the Encoder interface.
 func (e *jsonEncoder) EncodeKey(_ context.Context, row cdcevent.Row) ([]byte, error) {
-	j, err := e.versionEncoder(row.EventDescriptor).encodeKeyRaw(row)
+	if e.keyFormat == changefeedbase.OptKeyFormatDelimited {
+		// Delimited keys are their text, rather than a JSON string.
+		e.buf.Reset()
+		if err := e.writeDelimitedKey(&e.buf, row); err != nil {
+			return nil, err
+		}
+		return e.buf.Bytes(), nil
+	}
+
+	key, err := e.encodeKey(row)
 	if err != nil {
 		return nil, err
 	}
+	if e.keyFormat == changefeedbase.OptKeyFormatHash {
+		// Hashed keys are their hex digest, rather than a JSON string.
+		digest, err := key.AsText()
+		if err != nil {
+			return nil, err
+		}
+		e.buf.Reset()
+		e.buf.WriteString(*digest)
+		return e.buf.Bytes(), nil
+	}
+	if e.jsonSchema && e.keyFormat == changefeedbase.OptKeyFormatObject {
+		schema, err := e.versionEncoder(row.EventDescriptor).connectKeySchema(row)
+		if err != nil {
+			return nil, err
+		}
+		key = connectEnvelope(schema, key)
+	}
 	e.buf.Reset()
-	j.Format(&e.buf)
+	key.Format(&e.buf)
 	return e.buf.Bytes(), nil
 }
 
+// encodeKey encodes the primary key of the row in the key_format of the
+// encoder, as it's included in values under key_in_value. Delimited and hashed
+// keys are JSON strings.
+func (e *jsonEncoder) encodeKey(row cdcevent.Row) (json.JSON, error) {
+	switch e.keyFormat {
+	case changefeedbase.OptKeyFormatObject:
+		return encodeKeyObject(row)
+	case changefeedbase.OptKeyFormatDelimited:
+		var buf strings.Builder
+		if err := e.writeDelimitedKey(&buf, row); err != nil {
+			return nil, err
+		}
+		return json.FromString(buf.String()), nil
+	}
+	key, err := e.versionEncoder(row.EventDescriptor).encodeKeyRaw(row)
+	if err != nil {
+		return nil, err
+	}
+	if e.keyFormat == changefeedbase.OptKeyFormatHash {
+		sum := sha256.Sum256([]byte(key.String()))
+		return json.FromString(hex.EncodeToString(sum[:])), nil
+	}
+	return key, nil
+}
+
+// encodeKeyObject encodes the primary key as a JSON object from column name
+// to value.
+func encodeKeyObject(row cdcevent.Row) (json.JSON, error) {
+	kb := json.NewObjectBuilder(1)
+	if err := row.ForEachKeyColumn().Datum(func(d tree.Datum, col cdcevent.ResultColumn) error {
+		j, err := tree.AsJSON(d, sessiondatapb.DataConversionConfig{}, time.UTC)
+		if err != nil {
+			return err
+		}
+		kb.Add(col.Name, j)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return kb.Build(), nil
+}
+
+// delimitedKeyNull is the text of NULL values in delimited keys, which is
+// distinct from that of any string, since backslashes within values are
+// escaped.
+const delimitedKeyNull = `\N`
+
+// writeDelimitedKey writes the primary key as the text of each column joined
+// by the key delimiter. Backslashes and delimiters within a value are escaped
+// with a backslash so that distinct keys remain distinct.
+func (e *jsonEncoder) writeDelimitedKey(w io.StringWriter, row cdcevent.Row) error {
+	first := true
+	return row.ForEachKeyColumn().Datum(func(d tree.Datum, col cdcevent.ResultColumn) error {
+		j, err := tree.AsJSON(d, sessiondatapb.DataConversionConfig{}, time.UTC)
+		if err != nil {
+			return err
+		}
+		text, err := j.AsText()
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := w.WriteString(e.keyDelimiter); err != nil {
+				return err
+			}
+		}
+		first = false
+		if text == nil {
+			_, err = w.WriteString(delimitedKeyNull)
+		} else {
+			_, err = w.WriteString(e.keyEscaper.Replace(*text))
+		}
+		return err
+	})
+}
+
 func (e *versionEncoder) encodeKeyRaw(row cdcevent.Row) (json.JSON, error) {
 	kb := json.NewArrayBuilder(1)
 	if err := row.ForEachKeyColumn().Datum(func(d tree.Datum, col cdcevent.ResultColumn) error {
@@ -132,14 +369,14 @@ func (e *versionEncoder) encodeKeyRaw(row cdcevent.Row) (json.JSON, error) {
 	return kb.Build(), nil
 }
 
-func (e *versionEncoder) encodeKeyInValue(
-	updated cdcevent.Row, b *json.FixedKeysObjectBuilder,
-) error {
-	keyEntries, err := e.encodeKeyRaw(updated)
+// encodeKeyInValue sets the key field of the value of the row under
+// key_in_value to its key.
+func (e *jsonEncoder) encodeKeyInValue(updated cdcevent.Row, b *json.FixedKeysObjectBuilder) error {
+	key, err := e.encodeKey(updated)
 	if err != nil {
 		return err
 	}
-	return b.Set("key", keyEntries)
+	return b.Set("key", key)
 }
 
 var emptyJSONValue = func() json.JSON {
@@ -154,7 +391,7 @@ func (e *versionEncoder) rowAsGoNative(row cdcevent.Row, meta json.JSON) (json.J
 	if !row.HasValues() || row.IsDeleted() {
 		if meta != nil {
 			b := json.NewObjectBuilder(1)
-			b.Add(jsonMetaSentinel, meta)
+			b.Add(e.metaKey, meta)
 			return b.Build(), nil
 		}
 		return json.NullJSONValue, nil
@@ -167,7 +404,7 @@ func (e *versionEncoder) rowAsGoNative(row cdcevent.Row, meta json.JSON) (json.J
 			return nil
 		})
 		if meta != nil {
-			keys = append(keys, jsonMetaSentinel)
+			keys = append(keys, e.metaKey)
 		}
 		b, err := json.NewFixedKeysObjectBuilder(keys)
 		if err != nil {
@@ -177,7 +414,13 @@ func (e *versionEncoder) rowAsGoNative(row cdcevent.Row, meta json.JSON) (json.J
 	}
 
 	if err := row.ForEachColumn().Datum(func(d tree.Datum, col cdcevent.ResultColumn) error {
-		j, err := tree.AsJSON(d, sessiondatapb.DataConversionConfig{}, time.UTC)
+		if dj, ok := d.(*tree.DJSON); ok && e.jsonAsText {
+			return e.valueBuilder.Set(col.Name, json.FromString(dj.JSON.String()))
+		}
+		if j, ok := e.streamer.placeholder(d); ok {
+			return e.valueBuilder.Set(col.Name, j)
+		}
+		j, err := datumAsJSON(d, e.enumCodes)
 		if err != nil {
 			return err
 		}
@@ -187,7 +430,7 @@ func (e *versionEncoder) rowAsGoNative(row cdcevent.Row, meta json.JSON) (json.J
 	}
 
 	if meta != nil {
-		if err := e.valueBuilder.Set(jsonMetaSentinel, meta); err != nil {
+		if err := e.valueBuilder.Set(e.metaKey, meta); err != nil {
 			return nil, err
 		}
 	}
@@ -195,6 +438,51 @@ func (e *versionEncoder) rowAsGoNative(row cdcevent.Row, meta json.JSON) (json.J
 	return e.valueBuilder.Build()
 }
 
+// datumAsJSON converts a datum to JSON. If enumCodes is set, enum values,
+// including those nested in arrays and tuples, are encoded as an object holding
+// both the name of the value and its code, the OID of the value in pg_enum.
+// Unlike the position of a value in its enum, the code is unaffected by values
+// being added to the enum or the value being renamed.
+func datumAsJSON(d tree.Datum, enumCodes bool) (json.JSON, error) {
+	if !enumCodes {
+		return tree.AsJSON(d, sessiondatapb.DataConversionConfig{}, time.UTC)
+	}
+	switch t := d.(type) {
+	case *tree.DEnum:
+		b := json.NewObjectBuilder(2)
+		b.Add("name", json.FromString(t.LogicalRep))
+		b.Add("code", json.FromInt64(int64(enumCode(t))))
+		return b.Build(), nil
+	case *tree.DArray:
+		b := json.NewArrayBuilder(t.Len())
+		for _, elem := range t.Array {
+			j, err := datumAsJSON(elem, enumCodes)
+			if err != nil {
+				return nil, err
+			}
+			b.Add(j)
+		}
+		return b.Build(), nil
+	case *tree.DTuple:
+		b := json.NewObjectBuilder(len(t.D))
+		labels := t.ResolvedType().TupleLabels()
+		for i, elem := range t.D {
+			j, err := datumAsJSON(elem, enumCodes)
+			if err != nil {
+				return nil, err
+			}
+			key := fmt.Sprintf("f%d", i+1)
+			if i < len(labels) {
+				key = labels[i]
+			}
+			b.Add(key, j)
+		}
+		return b.Build(), nil
+	default:
+		return tree.AsJSON(d, sessiondatapb.DataConversionConfig{}, time.UTC)
+	}
+}
+
 func (e *jsonEncoder) initRawEnvelope() error {
 	// Determine if we need to add crdb meta.
 	var metaKeys []string
@@ -202,7 +490,7 @@ func (e *jsonEncoder) initRawEnvelope() error {
 		metaKeys = append(metaKeys, "updated")
 	}
 	if e.mvccTimestampField {
-		metaKeys = append(metaKeys, "mvcc_timestamp")
+		metaKeys = append(metaKeys, e.mvccTimestampKeys()...)
 	}
 	if e.keyInValue {
 		metaKeys = append(metaKeys, "key")
@@ -210,6 +498,15 @@ func (e *jsonEncoder) initRawEnvelope() error {
 	if e.topicInValue {
 		metaKeys = append(metaKeys, "topic")
 	}
+	if e.familyInValue {
+		metaKeys = append(metaKeys, "family")
+	}
+	if e.latencyFields {
+		metaKeys = append(metaKeys, latencyFieldKeys...)
+	}
+	if e.source != nil {
+		metaKeys = append(metaKeys, "source")
+	}
 
 	// Setup builder for crdb meta if needed.
 	var metaBuilder *json.FixedKeysObjectBuilder
@@ -237,13 +534,13 @@ func (e *jsonEncoder) initRawEnvelope() error {
 		}
 
 		if e.mvccTimestampField {
-			if err := metaBuilder.Set("mvcc_timestamp", json.FromString(timestampToString(evCtx.mvcc))); err != nil {
+			if err := e.setMVCCTimestampFields(metaBuilder, evCtx.mvcc); err != nil {
 				return nil, err
 			}
 		}
 
 		if e.keyInValue {
-			if err := ve.encodeKeyInValue(updated, metaBuilder); err != nil {
+			if err := e.encodeKeyInValue(updated, metaBuilder); err != nil {
 				return nil, err
 			}
 		}
@@ -254,6 +551,24 @@ func (e *jsonEncoder) initRawEnvelope() error {
 			}
 		}
 
+		if e.familyInValue {
+			if err := metaBuilder.Set("family", json.FromString(updated.FamilyName)); err != nil {
+				return nil, err
+			}
+		}
+
+		if e.latencyFields {
+			if err := e.setLatencyFields(metaBuilder, evCtx.mvcc); err != nil {
+				return nil, err
+			}
+		}
+
+		if e.source != nil {
+			if err := metaBuilder.Set("source", e.source); err != nil {
+				return nil, err
+			}
+		}
+
 		meta, err := metaBuilder.Build()
 		if err != nil {
 			return nil, err
@@ -274,11 +589,26 @@ func (e *jsonEncoder) initWrappedEnvelope() error {
 	if e.topicInValue {
 		keys = append(keys, "topic")
 	}
+	if e.familyInValue {
+		keys = append(keys, "family")
+	}
+	if e.ttlDeletes {
+		keys = append(keys, "op")
+	}
 	if e.updatedField {
 		keys = append(keys, "updated")
 	}
 	if e.mvccTimestampField {
-		keys = append(keys, "mvcc_timestamp")
+		keys = append(keys, e.mvccTimestampKeys()...)
+	}
+	if e.latencyFields {
+		keys = append(keys, latencyFieldKeys...)
+	}
+	if e.contentHash {
+		keys = append(keys, "content_hash")
+	}
+	if e.source != nil {
+		keys = append(keys, "source")
 	}
 	b, err := json.NewFixedKeysObjectBuilder(keys)
 	if err != nil {
@@ -312,7 +642,7 @@ func (e *jsonEncoder) initWrappedEnvelope() error {
 		}
 
 		if e.keyInValue {
-			if err := ve.encodeKeyInValue(updated, b); err != nil {
+			if err := e.encodeKeyInValue(updated, b); err != nil {
 				return nil, err
 			}
 		}
@@ -323,6 +653,19 @@ func (e *jsonEncoder) initWrappedEnvelope() error {
 			}
 		}
 
+		if e.familyInValue {
+			if err := b.Set("family", json.FromString(updated.FamilyName)); err != nil {
+				return nil, err
+			}
+		}
+
+		if e.ttlDeletes {
+			op := rowOp(updated, prev, evCtx.rowLevelTTL, e.withDiff)
+			if err := b.Set("op", json.FromString(op)); err != nil {
+				return nil, err
+			}
+		}
+
 		if e.updatedField {
 			if err := b.Set("updated", json.FromString(timestampToString(evCtx.updated))); err != nil {
 				return nil, err
@@ -330,7 +673,30 @@ func (e *jsonEncoder) initWrappedEnvelope() error {
 		}
 
 		if e.mvccTimestampField {
-			if err := b.Set("mvcc_timestamp", json.FromString(timestampToString(evCtx.mvcc))); err != nil {
+			if err := e.setMVCCTimestampFields(b, evCtx.mvcc); err != nil {
+				return nil, err
+			}
+		}
+
+		if e.latencyFields {
+			if err := e.setLatencyFields(b, evCtx.mvcc); err != nil {
+				return nil, err
+			}
+		}
+
+		if e.contentHash {
+			key, err := ve.encodeKeyRaw(updated)
+			if err != nil {
+				return nil, err
+			}
+			e.contentHashSum = rowContentHash(key, evCtx.updated, after)
+			if err := b.Set("content_hash", json.FromString(hex.EncodeToString(e.contentHashSum[:]))); err != nil {
+				return nil, err
+			}
+		}
+
+		if e.source != nil {
+			if err := b.Set("source", e.source); err != nil {
 				return nil, err
 			}
 		}
@@ -340,43 +706,441 @@ func (e *jsonEncoder) initWrappedEnvelope() error {
 	return nil
 }
 
+// initCloudEventsEnvelope wraps the wrapped envelope of each row in a
+// CloudEvents event, whose attributes are described in cloudevents.go.
+func (e *jsonEncoder) initCloudEventsEnvelope() error {
+	if err := e.initWrappedEnvelope(); err != nil {
+		return err
+	}
+	dataEncoder := e.envelopeEncoder
+	b, err := json.NewFixedKeysObjectBuilder(cloudEventKeys)
+	if err != nil {
+		return err
+	}
+
+	e.envelopeEncoder = func(evCtx eventContext, updated, prev cdcevent.Row) (json.JSON, error) {
+		data, err := dataEncoder(evCtx, updated, prev)
+		if err != nil {
+			return nil, err
+		}
+		key, err := e.versionEncoder(updated.EventDescriptor).encodeKeyRaw(updated)
+		if err != nil {
+			return nil, err
+		}
+		subject := key.String()
+		id := timestampToString(evCtx.mvcc) + "/" + subject
+		source := cloudEventSource(evCtx.topic)
+		typ := cloudEventRowType(updated, prev, e.beforeField)
+		eventTime := cloudEventTime(evCtx.updated)
+		if e.binaryCloudEvents {
+			var buf bytes.Buffer
+			data.Format(&buf)
+			// The attributes are sorted by name, as makeBinaryCloudEvent sorts
+			// them.
+			e.lastCloudEvent = &binaryCloudEvent{
+				attributes: []cloudEventAttribute{
+					{name: "id", value: id},
+					{name: "source", value: source},
+					{name: "specversion", value: cloudEventsSpecVersion},
+					{name: "subject", value: subject},
+					{name: "time", value: eventTime},
+					{name: "type", value: typ},
+				},
+				contentType: applicationTypeJSON,
+				data:        buf.Bytes(),
+			}
+		}
+		for _, f := range []struct {
+			key   string
+			value json.JSON
+		}{
+			{"specversion", json.FromString(cloudEventsSpecVersion)},
+			{"id", json.FromString(id)},
+			{"source", json.FromString(source)},
+			{"type", json.FromString(typ)},
+			{"subject", json.FromString(subject)},
+			{"time", json.FromString(eventTime)},
+			{cloudEventsDataContentTypeAttribute, json.FromString(applicationTypeJSON)},
+			{cloudEventsDataAttribute, data},
+		} {
+			if err := b.Set(f.key, f.value); err != nil {
+				return nil, err
+			}
+		}
+		return b.Build()
+	}
+	return nil
+}
+
+// initGoldenGateEnvelope encodes each row in the format of the Oracle
+// GoldenGate Kafka handler, which is described in goldengate.go.
+func (e *jsonEncoder) initGoldenGateEnvelope() {
+	e.envelopeEncoder = func(evCtx eventContext, updated, prev cdcevent.Row) (json.JSON, error) {
+		b := json.NewObjectBuilder(8)
+		b.Add("table", json.FromString(evCtx.topic))
+		b.Add("op_type", json.FromString(goldenGateOpType(updated, prev)))
+		b.Add("op_ts", json.FromString(goldenGateOpTime(evCtx.mvcc)))
+		b.Add("current_ts", json.FromString(goldenGateCurrentTime(e.now())))
+		b.Add("pos", json.FromString(goldenGatePos(evCtx.mvcc)))
+
+		primaryKeys := json.NewArrayBuilder(1)
+		if err := updated.ForEachKeyColumn().Col(func(col cdcevent.ResultColumn) error {
+			primaryKeys.Add(json.FromString(col.Name))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		b.Add("primary_keys", primaryKeys.Build())
+
+		if prev.IsInitialized() && !prev.IsDeleted() {
+			before, err := e.versionEncoder(prev.EventDescriptor).rowAsGoNative(prev, nil)
+			if err != nil {
+				return nil, err
+			}
+			b.Add("before", before)
+		}
+		if !updated.IsDeleted() {
+			after, err := e.versionEncoder(updated.EventDescriptor).rowAsGoNative(updated, nil)
+			if err != nil {
+				return nil, err
+			}
+			b.Add("after", after)
+		}
+		return b.Build(), nil
+	}
+}
+
+// mvccTimestampKeys returns the fields added by the mvcc_timestamp option,
+// which depend on the format of the timestamp.
+func (e *jsonEncoder) mvccTimestampKeys() []string {
+	if e.mvccTimestampFormat == changefeedbase.OptMVCCTimestampSplit {
+		return []string{"mvcc_timestamp_wall", "mvcc_timestamp_logical"}
+	}
+	return []string{"mvcc_timestamp"}
+}
+
+// setMVCCTimestampFields sets the fields added by the mvcc_timestamp option
+// to the MVCC timestamp of the change. Unlike the decimal string, the integer
+// formats can be compared numerically by consumers.
+func (e *jsonEncoder) setMVCCTimestampFields(
+	b *json.FixedKeysObjectBuilder, mvcc hlc.Timestamp,
+) error {
+	switch e.mvccTimestampFormat {
+	case changefeedbase.OptMVCCTimestampSplit:
+		if err := b.Set("mvcc_timestamp_wall", json.FromInt64(mvcc.WallTime)); err != nil {
+			return err
+		}
+		return b.Set("mvcc_timestamp_logical", json.FromInt64(int64(mvcc.Logical)))
+	case changefeedbase.OptMVCCTimestampNanos:
+		return b.Set("mvcc_timestamp", json.FromInt64(mvcc.WallTime))
+	default:
+		return b.Set("mvcc_timestamp", json.FromString(timestampToString(mvcc)))
+	}
+}
+
+// latencyFieldKeys are the fields added by the latency_timestamps option. The
+// emit time is the wall time at which the message was written to the sink, and
+// the commit time is the wall time of the MVCC timestamp of the change. Each is given both as decimal seconds and
+// as nanoseconds since the Unix epoch, so that consumers can compute the
+// latency of the changefeed without parsing HLC timestamps.
+var latencyFieldKeys = []string{"emit_time", "emit_time_ns", "commit_time", "commit_time_ns"}
+
+// The messages are written to the sink after they're encoded, possibly long
+// after if the sink buffers them, so the encoder sets the emit time fields to
+// placeholders, which the sink replaces with the time at which it writes each
+// message by calling stampEmitTime. The placeholders are as wide as the times
+// which replace them, so that they can be replaced in place.
+var (
+	emitTimePlaceholder   = json.FromString(`9999999999.999999999`)
+	emitTimeNsPlaceholder = func() json.JSON {
+		j, err := json.ParseJSON(`9999999999999999999`)
+		if err != nil {
+			panic(err)
+		}
+		return j
+	}()
+	// emitTimePlaceholders is the encoding of the emit time fields as set by
+	// the encoder, which are adjacent since the keys of objects are sorted.
+	emitTimePlaceholders = []byte(`"emit_time": "9999999999.999999999", "emit_time_ns": 9999999999999999999`)
+)
+
+// stampEmitTime replaces the placeholders of the emit time fields of the value
+// of a message, if it has them, with the given time. The value is modified in
+// place.
+func stampEmitTime(value []byte, now time.Time) {
+	i := bytes.Index(value, emitTimePlaceholders)
+	if i < 0 {
+		return
+	}
+	nanos := now.UnixNano()
+	stamped := fmt.Appendf(make([]byte, 0, len(emitTimePlaceholders)),
+		`"emit_time": "%s", "emit_time_ns": %d`, nanosToDecimalSeconds(nanos), nanos)
+	if len(stamped) != len(emitTimePlaceholders) {
+		// Only times between 2001 and 2286 are as wide as the placeholders.
+		return
+	}
+	copy(value[i:], stamped)
+}
+
+func (e *jsonEncoder) setLatencyFields(b *json.FixedKeysObjectBuilder, mvcc hlc.Timestamp) error {
+	for _, f := range []struct {
+		key   string
+		value json.JSON
+	}{
+		{"emit_time", emitTimePlaceholder},
+		{"emit_time_ns", emitTimeNsPlaceholder},
+		{"commit_time", json.FromString(nanosToDecimalSeconds(mvcc.WallTime))},
+		{"commit_time_ns", json.FromInt64(mvcc.WallTime)},
+	} {
+		if err := b.Set(f.key, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nanosToDecimalSeconds formats nanoseconds since the Unix epoch as decimal
+// seconds, e.g. 1690000000.123456789.
+func nanosToDecimalSeconds(nanos int64) string {
+	return fmt.Sprintf("%d.%09d", nanos/int64(time.Second), nanos%int64(time.Second))
+}
+
 // EncodeValue implements the Encoder interface.
 func (e *jsonEncoder) EncodeValue(
-	ctx context.Context, evCtx eventContext, updatedRow cdcevent.Row, prevRow cdcevent.Row,
+	_ context.Context, evCtx eventContext, updatedRow cdcevent.Row, prevRow cdcevent.Row,
 ) ([]byte, error) {
-	if e.envelopeType == changefeedbase.OptEnvelopeKeyOnly {
-		return nil, nil
+	j, err := e.encodeValueJSON(evCtx, updatedRow, prevRow)
+	if err != nil || j == nil {
+		return nil, err
 	}
+	e.buf.Reset()
+	j.Format(&e.buf)
+	return e.buf.Bytes(), nil
+}
 
-	if updatedRow.IsDeleted() && !canJSONEncodeMetadata(e.envelopeType) {
-		return nil, nil
+// EncodeValueTo implements the streamingEncoder interface. The large datums
+// of the row are written straight into buf, rather than converted to JSON
+// and copied from the buffer of the encoder.
+func (e *jsonEncoder) EncodeValueTo(
+	_ context.Context,
+	buf *bytes.Buffer,
+	evCtx eventContext,
+	updatedRow cdcevent.Row,
+	prevRow cdcevent.Row,
+) (bool, error) {
+	if e.streamer == nil {
+		j, err := e.encodeValueJSON(evCtx, updatedRow, prevRow)
+		if err != nil || j == nil {
+			return false, err
+		}
+		j.Format(buf)
+		return true, nil
 	}
 
-	j, err := e.envelopeEncoder(evCtx, updatedRow, prevRow)
-	if err != nil {
-		return nil, err
+	e.streamer.start()
+	defer e.streamer.stop()
+	j, err := e.encodeValueJSON(evCtx, updatedRow, prevRow)
+	if err != nil || j == nil {
+		return false, err
 	}
 	e.buf.Reset()
 	j.Format(&e.buf)
-	return e.buf.Bytes(), nil
+	if err := e.streamer.splice(buf, e.buf.Bytes()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// streamingDatumThreshold is the size from which the BYTES, STRING and JSONB
+// datums of a streamed value are streamed.
+const streamingDatumThreshold = 64 << 10 // 64 KiB
+
+// datumStreamer streams the large datums of a value into the buffer it is
+// encoded to. While the JSON of the value is built, each large datum is
+// replaced by a placeholder string: a token unique to the streamer followed
+// by the index of the datum. The formatted JSON, which is small, is then
+// copied into the buffer, and each placeholder is replaced by the datum it
+// stands for, encoded as it would have been as JSON.
+type datumStreamer struct {
+	// marker is the start of a formatted placeholder: a quote and the token.
+	marker []byte
+	active bool
+	datums []tree.Datum
+}
+
+func newDatumStreamer() *datumStreamer {
+	return &datumStreamer{marker: []byte(`"crdb-streamed-datum-` + uuid.MakeV4().String() + `-`)}
+}
+
+func (s *datumStreamer) start() {
+	s.active = true
+}
+
+func (s *datumStreamer) stop() {
+	s.active = false
+	for i := range s.datums {
+		s.datums[i] = nil
+	}
+	s.datums = s.datums[:0]
+}
+
+// placeholder returns the placeholder for the given datum if the streamer is
+// streaming a value and the datum is large enough to be streamed.
+func (s *datumStreamer) placeholder(d tree.Datum) (json.JSON, bool) {
+	if s == nil || !s.active {
+		return nil, false
+	}
+	var size int
+	switch t := d.(type) {
+	case *tree.DBytes:
+		size = len(*t)
+	case *tree.DString:
+		size = len(*t)
+	case *tree.DJSON:
+		size = int(t.JSON.Size())
+	}
+	if size < streamingDatumThreshold {
+		return nil, false
+	}
+	s.datums = append(s.datums, d)
+	return json.FromString(string(s.marker[1:]) + strconv.Itoa(len(s.datums)-1)), true
+}
+
+// splice writes the formatted JSON to buf, replacing the placeholders in it
+// with the datums they stand for.
+func (s *datumStreamer) splice(buf *bytes.Buffer, formatted []byte) error {
+	for {
+		i := bytes.Index(formatted, s.marker)
+		if i < 0 {
+			buf.Write(formatted)
+			return nil
+		}
+		buf.Write(formatted[:i])
+		formatted = formatted[i+len(s.marker):]
+		end := bytes.IndexByte(formatted, '"')
+		if end < 0 {
+			return errors.AssertionFailedf("unterminated streamed datum placeholder")
+		}
+		idx, err := strconv.Atoi(string(formatted[:end]))
+		if err != nil || idx >= len(s.datums) {
+			return errors.AssertionFailedf("invalid streamed datum placeholder %q", formatted[:end])
+		}
+		formatted = formatted[end+1:]
+
+		// The datums are encoded as by tree.AsJSON.
+		switch t := s.datums[idx].(type) {
+		case *tree.DBytes:
+			buf.Grow(len(*t)*2 + 5)
+			buf.WriteString(`"\\x`)
+			for j := 0; j < len(*t); j++ {
+				buf.Write(stringencoding.RawHexMap[(*t)[j]])
+			}
+			buf.WriteByte('"')
+		case *tree.DString:
+			json.FromString(string(*t)).Format(buf)
+		case *tree.DJSON:
+			t.JSON.Format(buf)
+		default:
+			return errors.AssertionFailedf("unexpected streamed datum %T", t)
+		}
+	}
+}
+
+// encodeValueJSON returns the value of the message for the given row, or nil
+// if the message has no value.
+func (e *jsonEncoder) encodeValueJSON(
+	evCtx eventContext, updatedRow cdcevent.Row, prevRow cdcevent.Row,
+) (json.JSON, error) {
+	if e.envelopeType == changefeedbase.OptEnvelopeKeyOnly {
+		return nil, nil
+	}
+
+	// The goldengate envelope encodes deletes with the before image of the row.
+	if updatedRow.IsDeleted() && !canJSONEncodeMetadata(e.envelopeType) &&
+		e.envelopeType != changefeedbase.OptEnvelopeGoldenGate {
+		return nil, nil
+	}
+
+	return e.envelopeEncoder(evCtx, updatedRow, prevRow)
+}
+
+// lastContentHash implements the contentHasher interface.
+func (e *jsonEncoder) lastContentHash() [sha256.Size]byte {
+	return e.contentHashSum
+}
+
+// lastBinaryCloudEvent implements the binaryCloudEventEncoder interface.
+func (e *jsonEncoder) lastBinaryCloudEvent() *binaryCloudEvent {
+	return e.lastCloudEvent
 }
 
 // EncodeResolvedTimestamp implements the Encoder interface.
 func (e *jsonEncoder) EncodeResolvedTimestamp(
-	_ context.Context, _ string, resolved hlc.Timestamp,
+	_ context.Context, topic string, resolved hlc.Timestamp,
+) ([]byte, error) {
+	return e.encodeTimestampMarker(topic, `resolved`, cloudEventsTypeResolved, resolved)
+}
+
+// EncodeEndOfStream encodes a message marking the end of the stream of
+// changes for a target, emitted when the target is dropped from a changefeed.
+// It is shaped like a resolved timestamp message, keyed by `end_of_stream`.
+func (e *jsonEncoder) EncodeEndOfStream(topic string, ts hlc.Timestamp) ([]byte, error) {
+	return e.encodeTimestampMarker(topic, `end_of_stream`, cloudEventsTypeEndOfStream, ts)
+}
+
+// EncodeTruncated encodes a message marking the truncation of a target at
+// ts, emitted under on_truncate=emit_marker before the rows of the table are
+// re-scanned. It is shaped like a resolved timestamp message, keyed by
+// `truncated`.
+func (e *jsonEncoder) EncodeTruncated(topic string, ts hlc.Timestamp) ([]byte, error) {
+	return e.encodeTimestampMarker(topic, `truncated`, cloudEventsTypeTruncated, ts)
+}
+
+// encodeTimestampMarker encodes a message holding ts under key.
+func (e *jsonEncoder) encodeTimestampMarker(
+	topic string, key string, cloudEventsType string, ts hlc.Timestamp,
 ) ([]byte, error) {
+	return gojson.Marshal(e.timestampMarker(topic, key, cloudEventsType, ts))
+}
+
+// timestampMarker returns the contents of a message holding ts under key, in
+// a form which can be marshaled as JSON.
+func (e *jsonEncoder) timestampMarker(
+	topic string, key string, cloudEventsType string, ts hlc.Timestamp,
+) interface{} {
 	meta := map[string]interface{}{
-		`resolved`: eval.TimestampToDecimalDatum(resolved).Decimal.String(),
+		key: eval.TimestampToDecimalDatum(ts).Decimal.String(),
+	}
+	if e.sourceMarker != nil {
+		meta["source"] = e.sourceMarker
 	}
 	var jsonEntries interface{}
-	if e.envelopeType == changefeedbase.OptEnvelopeWrapped {
+	if e.envelopeType == changefeedbase.OptEnvelopeWrapped ||
+		e.envelopeType == changefeedbase.OptEnvelopeGoldenGate {
 		jsonEntries = meta
+	} else if e.envelopeType == changefeedbase.OptEnvelopeCloudEvents {
+		jsonEntries = cloudEvent{
+			SpecVersion:     cloudEventsSpecVersion,
+			ID:              timestampToString(ts),
+			Source:          cloudEventSource(topic),
+			Type:            cloudEventsType,
+			Time:            cloudEventTime(ts),
+			DataContentType: applicationTypeJSON,
+			Data:            meta,
+		}
 	} else {
-		jsonEntries = map[string]interface{}{
-			jsonMetaSentinel: meta,
+		marker := map[string]interface{}{
+			e.metaKey: meta,
+		}
+		jsonEntries = marker
+		if e.jsonSchema {
+			jsonEntries = map[string]interface{}{
+				"schema":  gojson.RawMessage(connectMarkerSchema(``, marker).String()),
+				"payload": marker,
+			}
 		}
 	}
-	return gojson.Marshal(jsonEntries)
+	return jsonEntries
 }
 
 var placeholderCtx = eventContext{topic: "topic"}
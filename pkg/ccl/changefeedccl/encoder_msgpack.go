@@ -0,0 +1,80 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/json"
+)
+
+// applicationTypeMsgpack is the content type of messages in format=msgpack.
+const applicationTypeMsgpack = `application/msgpack`
+
+// msgpackEncoder encodes changefeed entries as MessagePack. Messages have the
+// same structure as those of the JSON encoder with the same options: keys are
+// in the key_format of the changefeed, with delimited and hashed keys encoded
+// as strings, values are maps from column name to value and metadata is found
+// under the same keys. See msgpack.go for the guarantees made about the
+// encoding.
+type msgpackEncoder struct {
+	jsonEncoder *jsonEncoder
+	buf         []byte
+}
+
+var _ Encoder = &msgpackEncoder{}
+
+func makeMsgpackEncoder(opts changefeedbase.EncodingOptions) (*msgpackEncoder, error) {
+	e, err := makeJSONEncoder(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &msgpackEncoder{jsonEncoder: e}, nil
+}
+
+// EncodeKey implements the Encoder interface.
+func (e *msgpackEncoder) EncodeKey(_ context.Context, row cdcevent.Row) ([]byte, error) {
+	j, err := e.jsonEncoder.encodeKey(row)
+	if err != nil {
+		return nil, err
+	}
+	return e.encode(j)
+}
+
+// EncodeValue implements the Encoder interface.
+func (e *msgpackEncoder) EncodeValue(
+	_ context.Context, evCtx eventContext, updatedRow cdcevent.Row, prevRow cdcevent.Row,
+) ([]byte, error) {
+	j, err := e.jsonEncoder.encodeValueJSON(evCtx, updatedRow, prevRow)
+	if err != nil || j == nil {
+		return nil, err
+	}
+	return e.encode(j)
+}
+
+// EncodeResolvedTimestamp implements the Encoder interface.
+func (e *msgpackEncoder) EncodeResolvedTimestamp(
+	_ context.Context, topic string, resolved hlc.Timestamp,
+) ([]byte, error) {
+	j, err := json.MakeJSON(e.jsonEncoder.timestampMarker(
+		topic, `resolved`, cloudEventsTypeResolved, resolved))
+	if err != nil {
+		return nil, err
+	}
+	return e.encode(j)
+}
+
+func (e *msgpackEncoder) encode(j json.JSON) ([]byte, error) {
+	var err error
+	e.buf, err = appendMsgpackJSON(e.buf[:0], j)
+	return e.buf, err
+}
@@ -9,13 +9,16 @@
 package changefeedccl
 
 import (
+	"bytes"
 	"context"
 	gosql "database/sql"
 	"encoding/base64"
 	"fmt"
 	"math/rand"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach-go/v2/crdb"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
@@ -30,6 +33,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/json"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/randutil"
@@ -236,7 +240,7 @@ func TestEncoders(t *testing.T) {
 				return
 			}
 			require.NoError(t, o.Validate())
-			e, err := getEncoder(o, targets)
+			e, err := getEncoder(o, targets, nil /* reg */)
 			require.NoError(t, err)
 
 			rowInsert := cdcevent.TestingMakeEventRow(tableDesc, 0, row, false)
@@ -267,6 +271,653 @@ func TestEncoders(t *testing.T) {
 	}
 }
 
+func TestJSONEncoderLatencyTimestamps(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+	require.NoError(t, err)
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(1)},
+		rowenc.EncDatum{Datum: tree.NewDString(`bar`)},
+	}, false)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	evCtx := eventContext{mvcc: hlc.Timestamp{WallTime: 1500000000123456789, Logical: 3}}
+
+	for _, tc := range []struct {
+		envelope changefeedbase.EnvelopeType
+		expected string
+		// stamped is the value once the emit time is stamped by the sink.
+		stamped string
+	}{
+		{
+			envelope: changefeedbase.OptEnvelopeWrapped,
+			expected: `{"after": {"a": 1, "b": "bar"}, ` +
+				`"commit_time": "1500000000.123456789", "commit_time_ns": 1500000000123456789, ` +
+				`"emit_time": "9999999999.999999999", "emit_time_ns": 9999999999999999999}`,
+			stamped: `{"after": {"a": 1, "b": "bar"}, ` +
+				`"commit_time": "1500000000.123456789", "commit_time_ns": 1500000000123456789, ` +
+				`"emit_time": "1500000001.000000005", "emit_time_ns": 1500000001000000005}`,
+		},
+		{
+			envelope: changefeedbase.OptEnvelopeBare,
+			expected: `{"__crdb__": {` +
+				`"commit_time": "1500000000.123456789", "commit_time_ns": 1500000000123456789, ` +
+				`"emit_time": "9999999999.999999999", "emit_time_ns": 9999999999999999999}, ` +
+				`"a": 1, "b": "bar"}`,
+			stamped: `{"__crdb__": {` +
+				`"commit_time": "1500000000.123456789", "commit_time_ns": 1500000000123456789, ` +
+				`"emit_time": "1500000001.000000005", "emit_time_ns": 1500000001000000005}, ` +
+				`"a": 1, "b": "bar"}`,
+		},
+	} {
+		t.Run(string(tc.envelope), func(t *testing.T) {
+			opts := changefeedbase.EncodingOptions{
+				Format:            changefeedbase.OptFormatJSON,
+				Envelope:          tc.envelope,
+				LatencyTimestamps: true,
+			}
+			require.NoError(t, opts.Validate())
+			e, err := makeJSONEncoder(opts)
+			require.NoError(t, err)
+
+			value, err := e.EncodeValue(context.Background(), evCtx, row, prevRow)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(value))
+
+			stampEmitTime(value, time.Unix(1500000001, 5))
+			require.Equal(t, tc.stamped, string(value))
+		})
+	}
+
+	opts := changefeedbase.EncodingOptions{
+		Format:            changefeedbase.OptFormatAvro,
+		Envelope:          changefeedbase.OptEnvelopeWrapped,
+		LatencyTimestamps: true,
+	}
+	require.EqualError(t, opts.Validate(), `latency_timestamps is only usable with format=json`)
+}
+
+func TestJSONEncoderBareMetadataKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT PRIMARY KEY)`)
+	require.NoError(t, err)
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(1)},
+	}, false)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	ts := hlc.Timestamp{WallTime: 1, Logical: 2}
+
+	opts := changefeedbase.EncodingOptions{
+		Format:            changefeedbase.OptFormatJSON,
+		Envelope:          changefeedbase.OptEnvelopeBare,
+		UpdatedTimestamps: true,
+		BareMetadataKey:   `_meta`,
+	}
+	require.NoError(t, opts.Validate())
+	e, err := makeJSONEncoder(opts)
+	require.NoError(t, err)
+
+	value, err := e.EncodeValue(context.Background(), eventContext{updated: ts}, row, prevRow)
+	require.NoError(t, err)
+	require.Equal(t, `{"_meta": {"updated": "1.0000000002"}, "a": 1}`, string(value))
+
+	resolved, err := e.EncodeResolvedTimestamp(context.Background(), `foo`, ts)
+	require.NoError(t, err)
+	require.Equal(t, `{"_meta":{"resolved":"1.0000000002"}}`, string(resolved))
+
+	opts.Envelope = changefeedbase.OptEnvelopeWrapped
+	require.EqualError(t, opts.Validate(), `bare_metadata_key is only usable with envelope=bare`)
+	opts.Envelope, opts.Format = changefeedbase.OptEnvelopeBare, changefeedbase.OptFormatAvro
+	require.EqualError(t, opts.Validate(), `bare_metadata_key is only usable with format=json or format=msgpack`)
+}
+
+func TestJSONEncoderJSONSchema(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT PRIMARY KEY, b STRING, c JSONB NOT NULL)`)
+	require.NoError(t, err)
+	j, err := tree.ParseDJSON(`{"k": 1}`)
+	require.NoError(t, err)
+	encRow := rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(1)},
+		rowenc.EncDatum{Datum: tree.NewDString(`x`)},
+		rowenc.EncDatum{Datum: j},
+	}
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, encRow, false)
+	deleted := cdcevent.TestingMakeEventRow(tableDesc, 0, encRow, true)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	ts := hlc.Timestamp{WallTime: 1, Logical: 2}
+
+	opts := changefeedbase.EncodingOptions{
+		Format:     changefeedbase.OptFormatJSON,
+		Envelope:   changefeedbase.OptEnvelopeBare,
+		KeyFormat:  changefeedbase.OptKeyFormatObject,
+		JSONSchema: true,
+	}
+	require.NoError(t, opts.Validate())
+	e, err := makeJSONEncoder(opts)
+	require.NoError(t, err)
+
+	const schema = `{"fields": [` +
+		`{"field": "a", "optional": false, "type": "int64"}, ` +
+		`{"field": "b", "optional": true, "type": "string"}, ` +
+		`{"field": "c", "optional": false, "type": "string"}` +
+		`], "name": "foo", "optional": true, "type": "struct"}`
+
+	key, err := e.EncodeKey(context.Background(), row)
+	require.NoError(t, err)
+	require.Equal(t, `{"payload": {"a": 1}, "schema": {"fields": [`+
+		`{"field": "a", "optional": false, "type": "int64"}`+
+		`], "name": "foo.key", "optional": false, "type": "struct"}}`, string(key))
+
+	// JSONB values, which Connect has no type for, are sent as their text.
+	value, err := e.EncodeValue(context.Background(), eventContext{updated: ts}, row, prevRow)
+	require.NoError(t, err)
+	require.Equal(t, `{"payload": {"a": 1, "b": "x", "c": "{\"k\": 1}"}, "schema": `+schema+`}`, string(value))
+
+	value, err = e.EncodeValue(context.Background(), eventContext{updated: ts}, deleted, prevRow)
+	require.NoError(t, err)
+	require.Equal(t, `{"payload": null, "schema": `+schema+`}`, string(value))
+
+	resolved, err := e.EncodeResolvedTimestamp(context.Background(), `foo`, ts)
+	require.NoError(t, err)
+	require.Equal(t, `{"payload":{"__crdb__":{"resolved":"1.0000000002"}},"schema":{"fields":[`+
+		`{"field":"__crdb__","fields":[{"field":"resolved","optional":true,"type":"string"}],"optional":true,"type":"struct"}`+
+		`],"optional":false,"type":"struct"}}`, string(resolved))
+
+	opts.Envelope = changefeedbase.OptEnvelopeWrapped
+	require.EqualError(t, opts.Validate(),
+		`json_schema is only usable with format=json and envelope=bare or envelope=row`)
+	opts.Envelope, opts.KeyInValue = changefeedbase.OptEnvelopeBare, true
+	require.EqualError(t, opts.Validate(), `json_schema cannot be used with key_in_value`)
+}
+
+func TestJSONEncoderSourceGeneration(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT PRIMARY KEY)`)
+	require.NoError(t, err)
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(1)},
+	}, false)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	ts := hlc.Timestamp{WallTime: 1, Logical: 2}
+
+	for _, tc := range []struct {
+		envelope         changefeedbase.EnvelopeType
+		expectedValue    string
+		expectedResolved string
+	}{
+		{
+			envelope:         changefeedbase.OptEnvelopeWrapped,
+			expectedValue:    `{"after": {"a": 1}, "source": {"cluster_id": "c1", "generation": 3}}`,
+			expectedResolved: `{"resolved":"1.0000000002","source":{"cluster_id":"c1","generation":3}}`,
+		},
+		{
+			envelope:         changefeedbase.OptEnvelopeBare,
+			expectedValue:    `{"__crdb__": {"source": {"cluster_id": "c1", "generation": 3}}, "a": 1}`,
+			expectedResolved: `{"__crdb__":{"resolved":"1.0000000002","source":{"cluster_id":"c1","generation":3}}}`,
+		},
+	} {
+		t.Run(string(tc.envelope), func(t *testing.T) {
+			opts := changefeedbase.EncodingOptions{
+				Format:           changefeedbase.OptFormatJSON,
+				Envelope:         tc.envelope,
+				SourceGeneration: true,
+				SourceClusterID:  `c1`,
+				Generation:       3,
+			}
+			require.NoError(t, opts.Validate())
+			e, err := makeJSONEncoder(opts)
+			require.NoError(t, err)
+
+			value, err := e.EncodeValue(context.Background(), eventContext{updated: ts}, row, prevRow)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedValue, string(value))
+
+			resolved, err := e.EncodeResolvedTimestamp(context.Background(), `foo`, ts)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedResolved, string(resolved))
+		})
+	}
+
+	opts := changefeedbase.EncodingOptions{
+		Format:           changefeedbase.OptFormatAvro,
+		Envelope:         changefeedbase.OptEnvelopeWrapped,
+		SourceGeneration: true,
+	}
+	require.EqualError(t, opts.Validate(), `source_generation is only usable with format=json`)
+}
+
+func TestJSONEncoderKeyFormat(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT, b STRING, c INT, PRIMARY KEY (a, b))`)
+	require.NoError(t, err)
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(1)},
+		rowenc.EncDatum{Datum: tree.NewDString(`a/b\c`)},
+		rowenc.EncDatum{Datum: tree.NewDInt(2)},
+	}, false)
+
+	for _, tc := range []struct {
+		format    changefeedbase.KeyFormat
+		delimiter string
+		expected  string
+	}{
+		{format: ``, expected: `[1, "a/b\\c"]`},
+		{format: changefeedbase.OptKeyFormatArray, expected: `[1, "a/b\\c"]`},
+		{format: changefeedbase.OptKeyFormatObject, expected: `{"a": 1, "b": "a/b\\c"}`},
+		{format: changefeedbase.OptKeyFormatDelimited, delimiter: `/`, expected: `1/a\/b\\c`},
+		{format: changefeedbase.OptKeyFormatDelimited, delimiter: `::`, expected: `1::a/b\\c`},
+		{format: changefeedbase.OptKeyFormatHash,
+			expected: `03341b2f1803faae8a3892edced399e3073e1d526d78476e9e98c027839fdb79`},
+	} {
+		t.Run(string(tc.format)+tc.delimiter, func(t *testing.T) {
+			opts := changefeedbase.EncodingOptions{
+				Format:       changefeedbase.OptFormatJSON,
+				Envelope:     changefeedbase.OptEnvelopeWrapped,
+				KeyInValue:   true,
+				KeyFormat:    tc.format,
+				KeyDelimiter: tc.delimiter,
+			}
+			require.NoError(t, opts.Validate())
+			e, err := makeJSONEncoder(opts)
+			require.NoError(t, err)
+
+			key, err := e.EncodeKey(context.Background(), row)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(key))
+
+			// The key in the value is in the same format, as a string if the
+			// key isn't JSON.
+			expectedInValue := tc.expected
+			if tc.format == changefeedbase.OptKeyFormatDelimited || tc.format == changefeedbase.OptKeyFormatHash {
+				expectedInValue = json.FromString(tc.expected).String()
+			}
+			prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+			value, err := e.EncodeValue(context.Background(), eventContext{}, row, prevRow)
+			require.NoError(t, err)
+			j, err := json.ParseJSON(string(value))
+			require.NoError(t, err)
+			keyInValue, err := j.FetchValKey(`key`)
+			require.NoError(t, err)
+			require.Equal(t, expectedInValue, keyInValue.String())
+		})
+	}
+
+	t.Run("delimited null", func(t *testing.T) {
+		opts := changefeedbase.EncodingOptions{
+			Format:       changefeedbase.OptFormatJSON,
+			Envelope:     changefeedbase.OptEnvelopeWrapped,
+			KeyFormat:    changefeedbase.OptKeyFormatDelimited,
+			KeyDelimiter: `/`,
+		}
+		e, err := makeJSONEncoder(opts)
+		require.NoError(t, err)
+		// NULL is distinct from every string, including the empty string and
+		// that of its own escape.
+		for _, tc := range []struct {
+			b        tree.Datum
+			expected string
+		}{
+			{b: tree.DNull, expected: `1/\N`},
+			{b: tree.NewDString(`\N`), expected: `1/\\N`},
+			{b: tree.NewDString(``), expected: `1/`},
+		} {
+			row := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+				rowenc.EncDatum{Datum: tree.NewDInt(1)},
+				rowenc.EncDatum{Datum: tc.b},
+				rowenc.EncDatum{Datum: tree.NewDInt(2)},
+			}, false)
+			key, err := e.EncodeKey(context.Background(), row)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(key))
+		}
+	})
+
+	opts := changefeedbase.EncodingOptions{
+		Format:    changefeedbase.OptFormatAvro,
+		Envelope:  changefeedbase.OptEnvelopeWrapped,
+		KeyFormat: changefeedbase.OptKeyFormatObject,
+	}
+	require.EqualError(t, opts.Validate(),
+		`key_format=object is only usable with format=json or format=msgpack`)
+	opts = changefeedbase.EncodingOptions{
+		Format:       changefeedbase.OptFormatJSON,
+		Envelope:     changefeedbase.OptEnvelopeWrapped,
+		KeyFormat:    changefeedbase.OptKeyFormatHash,
+		KeyDelimiter: `/`,
+	}
+	require.EqualError(t, opts.Validate(), `key_delimiter is only usable with key_format=delimited`)
+}
+
+func TestJSONEncoderStreamingValue(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT PRIMARY KEY, b BYTES, c JSONB)`)
+	require.NoError(t, err)
+	datums := rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(1)},
+		rowenc.EncDatum{Datum: tree.NewDBytes(tree.DBytes(strings.Repeat("b", 1<<20)))},
+		rowenc.EncDatum{Datum: tree.NewDJSON(json.FromString(strings.Repeat("c", 1<<20)))},
+	}
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, datums, false)
+	deleted := cdcevent.TestingMakeEventRow(tableDesc, 0, datums, true)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	evCtx := eventContext{updated: hlc.Timestamp{WallTime: 1, Logical: 2}}
+
+	for _, envelope := range []changefeedbase.EnvelopeType{
+		changefeedbase.OptEnvelopeWrapped, changefeedbase.OptEnvelopeBare,
+	} {
+		t.Run(string(envelope), func(t *testing.T) {
+			e, err := makeJSONEncoder(changefeedbase.EncodingOptions{
+				Format:            changefeedbase.OptFormatJSON,
+				Envelope:          envelope,
+				UpdatedTimestamps: true,
+			})
+			require.NoError(t, err)
+
+			// The streamed value is appended to the buffer, and matches the
+			// value EncodeValue returns. Its large datums are written straight
+			// into the buffer, and not into that of the encoder.
+			buf := bytes.NewBufferString(`prefix`)
+			ok, err := e.EncodeValueTo(context.Background(), buf, evCtx, row, prevRow)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Less(t, e.buf.Len(), 1<<10)
+			expected, err := e.EncodeValue(context.Background(), evCtx, row, prevRow)
+			require.NoError(t, err)
+			require.Equal(t, `prefix`+string(expected), buf.String())
+
+			// Deletes have no value in the bare envelope.
+			expected, err = e.EncodeValue(context.Background(), evCtx, deleted, prevRow)
+			require.NoError(t, err)
+			buf.Reset()
+			ok, err = e.EncodeValueTo(context.Background(), buf, evCtx, deleted, prevRow)
+			require.NoError(t, err)
+			require.Equal(t, expected != nil, ok)
+			require.Equal(t, string(expected), buf.String())
+		})
+	}
+}
+
+func TestJSONEncoderCloudEvents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+	require.NoError(t, err)
+	datums := func(b string) rowenc.EncDatumRow {
+		return rowenc.EncDatumRow{
+			rowenc.EncDatum{Datum: tree.NewDInt(1)},
+			rowenc.EncDatum{Datum: tree.NewDString(b)},
+		}
+	}
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, datums(`bar`), false)
+	deleted := cdcevent.TestingMakeEventRow(tableDesc, 0, datums(`bar`), true)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, datums(`baz`), false)
+	noPrevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	ts := hlc.Timestamp{WallTime: 1500000000123456789, Logical: 3}
+	evCtx := eventContext{updated: ts, mvcc: ts, topic: `foo`}
+
+	const attributes = `"datacontenttype": "application/json", ` +
+		`"id": "1500000000123456789.0000000003/[1]", "source": "/cockroachdb/changefeed/foo", ` +
+		`"specversion": "1.0", "subject": "[1]", "time": "2017-07-14T02:40:00.123456789Z", `
+	for _, tc := range []struct {
+		name          string
+		diff          bool
+		updated, prev cdcevent.Row
+		expected      string
+	}{
+		{
+			name: `upsert`, updated: row, prev: noPrevRow,
+			expected: `{"data": {"after": {"a": 1, "b": "bar"}}, ` + attributes +
+				`"type": "com.cockroachlabs.changefeed.row.upsert"}`,
+		},
+		{
+			name: `delete`, updated: deleted, prev: noPrevRow,
+			expected: `{"data": {"after": null}, ` + attributes +
+				`"type": "com.cockroachlabs.changefeed.row.delete"}`,
+		},
+		{
+			name: `insert`, diff: true, updated: row, prev: noPrevRow,
+			expected: `{"data": {"after": {"a": 1, "b": "bar"}, "before": null}, ` + attributes +
+				`"type": "com.cockroachlabs.changefeed.row.insert"}`,
+		},
+		{
+			name: `update`, diff: true, updated: row, prev: prevRow,
+			expected: `{"data": {"after": {"a": 1, "b": "bar"}, "before": {"a": 1, "b": "baz"}}, ` + attributes +
+				`"type": "com.cockroachlabs.changefeed.row.update"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := changefeedbase.EncodingOptions{
+				Format:          changefeedbase.OptFormatJSON,
+				Envelope:        changefeedbase.OptEnvelopeCloudEvents,
+				CloudEventsMode: changefeedbase.OptCloudEventsModeStructured,
+				Diff:            tc.diff,
+			}
+			require.NoError(t, opts.Validate())
+			e, err := makeJSONEncoder(opts)
+			require.NoError(t, err)
+
+			value, err := e.EncodeValue(context.Background(), evCtx, tc.updated, tc.prev)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(value))
+		})
+	}
+
+	t.Run(`resolved`, func(t *testing.T) {
+		e, err := makeJSONEncoder(changefeedbase.EncodingOptions{
+			Format:   changefeedbase.OptFormatJSON,
+			Envelope: changefeedbase.OptEnvelopeCloudEvents,
+		})
+		require.NoError(t, err)
+		value, err := e.EncodeResolvedTimestamp(context.Background(), `foo`, ts)
+		require.NoError(t, err)
+		require.Equal(t, `{"specversion":"1.0","id":"1500000000123456789.0000000003",`+
+			`"source":"/cockroachdb/changefeed/foo","type":"com.cockroachlabs.changefeed.resolved",`+
+			`"time":"2017-07-14T02:40:00.123456789Z","datacontenttype":"application/json",`+
+			`"data":{"resolved":"1500000000123456789.0000000003"}}`, string(value))
+	})
+
+	t.Run(`binary`, func(t *testing.T) {
+		e, err := makeJSONEncoder(changefeedbase.EncodingOptions{
+			Format:          changefeedbase.OptFormatJSON,
+			Envelope:        changefeedbase.OptEnvelopeCloudEvents,
+			CloudEventsMode: changefeedbase.OptCloudEventsModeBinary,
+		})
+		require.NoError(t, err)
+		value, err := e.EncodeValue(context.Background(), evCtx, row, noPrevRow)
+		require.NoError(t, err)
+		event, err := makeBinaryCloudEvent(value)
+		require.NoError(t, err)
+		// The encoder encodes the event in binary mode as the sink would
+		// convert it.
+		require.Equal(t, &event, e.lastBinaryCloudEvent())
+		require.Equal(t, binaryCloudEvent{
+			attributes: []cloudEventAttribute{
+				{name: `id`, value: `1500000000123456789.0000000003/[1]`},
+				{name: `source`, value: `/cockroachdb/changefeed/foo`},
+				{name: `specversion`, value: `1.0`},
+				{name: `subject`, value: `[1]`},
+				{name: `time`, value: `2017-07-14T02:40:00.123456789Z`},
+				{name: `type`, value: `com.cockroachlabs.changefeed.row.upsert`},
+			},
+			contentType: `application/json`,
+			data:        []byte(`{"after": {"a": 1, "b": "bar"}}`),
+		}, event)
+	})
+
+	for _, tc := range []struct {
+		opts     changefeedbase.EncodingOptions
+		expected string
+	}{
+		{
+			opts: changefeedbase.EncodingOptions{
+				Format:   changefeedbase.OptFormatAvro,
+				Envelope: changefeedbase.OptEnvelopeCloudEvents,
+			},
+			expected: `envelope=cloudevents is only usable with format=json`,
+		},
+		{
+			opts: changefeedbase.EncodingOptions{
+				Format:          changefeedbase.OptFormatJSON,
+				Envelope:        changefeedbase.OptEnvelopeWrapped,
+				CloudEventsMode: changefeedbase.OptCloudEventsModeBinary,
+			},
+			expected: `cloudevents_mode is only usable with envelope=cloudevents`,
+		},
+	} {
+		require.EqualError(t, tc.opts.Validate(), tc.expected)
+	}
+}
+
+func TestJSONEncoderGoldenGate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(`CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+	require.NoError(t, err)
+	datums := func(b string) rowenc.EncDatumRow {
+		return rowenc.EncDatumRow{
+			rowenc.EncDatum{Datum: tree.NewDInt(1)},
+			rowenc.EncDatum{Datum: tree.NewDString(b)},
+		}
+	}
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, datums(`bar`), false)
+	deleted := cdcevent.TestingMakeEventRow(tableDesc, 0, datums(`bar`), true)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, datums(`baz`), false)
+	noPrevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	ts := hlc.Timestamp{WallTime: 1500000000123456789, Logical: 3}
+	evCtx := eventContext{updated: ts, mvcc: ts, topic: `foo`}
+
+	fields := func(opType string) string {
+		return `"current_ts": "2017-07-14T02:40:01.000005", "op_ts": "2017-07-14 02:40:00.123456", ` +
+			`"op_type": "` + opType + `", "pos": "15000000001234567890000000003", ` +
+			`"primary_keys": ["a"], "table": "foo"`
+	}
+	for _, tc := range []struct {
+		name          string
+		updated, prev cdcevent.Row
+		expected      string
+	}{
+		{
+			name: `insert`, updated: row, prev: noPrevRow,
+			expected: `{"after": {"a": 1, "b": "bar"}, ` + fields(`I`) + `}`,
+		},
+		{
+			name: `update`, updated: row, prev: prevRow,
+			expected: `{"after": {"a": 1, "b": "bar"}, "before": {"a": 1, "b": "baz"}, ` + fields(`U`) + `}`,
+		},
+		{
+			name: `delete`, updated: deleted, prev: prevRow,
+			expected: `{"before": {"a": 1, "b": "baz"}, ` + fields(`D`) + `}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := changefeedbase.EncodingOptions{
+				Format:   changefeedbase.OptFormatJSON,
+				Envelope: changefeedbase.OptEnvelopeGoldenGate,
+				Diff:     true,
+			}
+			require.NoError(t, opts.Validate())
+			e, err := makeJSONEncoder(opts)
+			require.NoError(t, err)
+			e.now = func() time.Time { return time.Unix(1500000001, 5000) }
+
+			value, err := e.EncodeValue(context.Background(), evCtx, tc.updated, tc.prev)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(value))
+		})
+	}
+
+	t.Run(`resolved`, func(t *testing.T) {
+		e, err := makeJSONEncoder(changefeedbase.EncodingOptions{
+			Format:   changefeedbase.OptFormatJSON,
+			Envelope: changefeedbase.OptEnvelopeGoldenGate,
+			Diff:     true,
+		})
+		require.NoError(t, err)
+		value, err := e.EncodeResolvedTimestamp(context.Background(), `foo`, ts)
+		require.NoError(t, err)
+		require.Equal(t, `{"resolved":"1500000000123456789.0000000003"}`, string(value))
+	})
+
+	for _, tc := range []struct {
+		opts     changefeedbase.EncodingOptions
+		expected string
+	}{
+		{
+			opts: changefeedbase.EncodingOptions{
+				Format:   changefeedbase.OptFormatAvro,
+				Envelope: changefeedbase.OptEnvelopeGoldenGate,
+				Diff:     true,
+			},
+			expected: `envelope=goldengate is only usable with format=json`,
+		},
+		{
+			opts: changefeedbase.EncodingOptions{
+				Format:   changefeedbase.OptFormatJSON,
+				Envelope: changefeedbase.OptEnvelopeGoldenGate,
+			},
+			expected: `envelope=goldengate requires diff, which distinguishes inserts from updates`,
+		},
+	} {
+		require.EqualError(t, tc.opts.Validate(), tc.expected)
+	}
+}
+
+func TestJSONEncoderEnumCodes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TYPE status AS ENUM ('open', 'closed')`)
+		sqlDB.Exec(t, `CREATE TYPE ticket AS (id INT, status status)`)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b status, c status[], d ticket)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'open', ARRAY['open', NULL, 'closed'], (7, 'closed'))`)
+
+		// The codes are the OIDs of the values in pg_enum.
+		code := func(label string) int64 {
+			var c int64
+			sqlDB.QueryRow(t, `SELECT oid::INT8 FROM pg_enum WHERE enumlabel = $1`, label).Scan(&c)
+			return c
+		}
+		openCode, closedCode := code(`open`), code(`closed`)
+
+		foo := feed(t, f, `CREATE CHANGEFEED FOR foo WITH enum_codes`)
+		defer closeFeed(t, foo)
+		assertPayloads(t, foo, []string{fmt.Sprintf(
+			`foo: [1]->{"after": {"a": 1, "b": {"code": %[1]d, "name": "open"}, `+
+				`"c": [{"code": %[1]d, "name": "open"}, null, {"code": %[2]d, "name": "closed"}], `+
+				`"d": {"id": 7, "status": {"code": %[2]d, "name": "closed"}}}}`,
+			openCode, closedCode)})
+
+		// Codes are unaffected by values being added or renamed.
+		sqlDB.Exec(t, `ALTER TYPE status ADD VALUE 'review' BEFORE 'closed'`)
+		sqlDB.Exec(t, `ALTER TYPE status RENAME VALUE 'open' TO 'active'`)
+		sqlDB.Exec(t, `UPDATE foo SET c = ARRAY['review', 'active'] WHERE a = 1`)
+		assertPayloads(t, foo, []string{fmt.Sprintf(
+			`foo: [1]->{"after": {"a": 1, "b": {"code": %[1]d, "name": "active"}, `+
+				`"c": [{"code": %[3]d, "name": "review"}, {"code": %[1]d, "name": "active"}], `+
+				`"d": {"id": 7, "status": {"code": %[2]d, "name": "closed"}}}}`,
+			openCode, closedCode, code(`review`))})
+		require.Equal(t, openCode, code(`active`))
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
 func TestAvroEncoder(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -382,7 +1033,7 @@ func TestAvroEncoderWithTLS(t *testing.T) {
 				StatementTimeName: changefeedbase.StatementTimeName(tableDesc.GetName()),
 			})
 
-			e, err := getEncoder(opts, targets)
+			e, err := getEncoder(opts, targets, nil /* reg */)
 			require.NoError(t, err)
 
 			rowInsert := cdcevent.TestingMakeEventRow(tableDesc, 0, row, false)
@@ -414,7 +1065,7 @@ func TestAvroEncoderWithTLS(t *testing.T) {
 			defer noCertReg.Close()
 			opts.SchemaRegistryURI = noCertReg.URL()
 
-			enc, err := getEncoder(opts, targets)
+			enc, err := getEncoder(opts, targets, nil /* reg */)
 			require.NoError(t, err)
 			_, err = enc.EncodeKey(context.Background(), rowInsert)
 			require.Regexp(t, "x509", err)
@@ -427,7 +1078,7 @@ func TestAvroEncoderWithTLS(t *testing.T) {
 			defer wrongCertReg.Close()
 			opts.SchemaRegistryURI = wrongCertReg.URL()
 
-			enc, err = getEncoder(opts, targets)
+			enc, err = getEncoder(opts, targets, nil /* reg */)
 			require.NoError(t, err)
 			_, err = enc.EncodeKey(context.Background(), rowInsert)
 			require.Regexp(t, `contacting confluent schema registry.*: x509`, err)
@@ -750,6 +1401,41 @@ func TestAvroSchemaNamespace(t *testing.T) {
 	cdcTest(t, testFn, feedTestForceSink("kafka"))
 }
 
+func TestAvroSubjectNaming(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE DATABASE movr`)
+		sqlDB.Exec(t, `CREATE TABLE movr.drivers (id INT PRIMARY KEY, name STRING)`)
+		sqlDB.Exec(t, `INSERT INTO movr.drivers VALUES (1, 'Alice')`)
+
+		for _, tc := range []struct {
+			opts     string
+			subjects []string
+		}{
+			{`avro_subject_name_strategy=topic`, []string{`drivers-key`, `drivers-value`}},
+			{`avro_subject_name_strategy=record`, []string{`drivers`, `drivers_envelope`}},
+			{`avro_subject_name_strategy=topic_record`, []string{`drivers-drivers`, `drivers-drivers_envelope`}},
+			{`avro_subject_template='cdc.{topic}.{type}'`, []string{`cdc.drivers.key`, `cdc.drivers.value`}},
+		} {
+			t.Run(tc.opts, func(t *testing.T) {
+				testFeed := feed(t, f, fmt.Sprintf(`CREATE CHANGEFEED FOR movr.drivers `+
+					`WITH format=%s, %s`, changefeedbase.OptFormatAvro, tc.opts))
+				defer closeFeed(t, testFeed)
+
+				assertPayloads(t, testFeed, []string{
+					`drivers: {"id":{"long":1}}->{"after":{"drivers":{"id":{"long":1},"name":{"string":"Alice"}}}}`,
+				})
+				assertRegisteredSubjects(t, testFeed.(*kafkaFeed).registry, tc.subjects)
+			})
+		}
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("kafka"))
+}
+
 func TestTableNameCollision(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -916,7 +1602,7 @@ func BenchmarkEncoders(b *testing.B) {
 	bench := func(b *testing.B, fn encodeFn, opts changefeedbase.EncodingOptions, updatedRows, prevRows []cdcevent.Row) {
 		b.ReportAllocs()
 		b.StopTimer()
-		encoder, err := getEncoder(opts, targets)
+		encoder, err := getEncoder(opts, targets, nil /* reg */)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -0,0 +1,209 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/security/username"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/errors"
+)
+
+// endOfStreamEncoder encodes resolved timestamps as end-of-stream markers,
+// which lets them be emitted to the topics of chosen targets through
+// TargetResolvedTimestampSink.
+type endOfStreamEncoder struct {
+	*jsonEncoder
+}
+
+// EncodeResolvedTimestamp implements the Encoder interface.
+func (e endOfStreamEncoder) EncodeResolvedTimestamp(
+	_ context.Context, topic string, resolved hlc.Timestamp,
+) ([]byte, error) {
+	return e.EncodeEndOfStream(topic, resolved)
+}
+
+// emitEndOfStream emits, to the sink of the changefeed described by details,
+// a message marking the end of the stream of changes for each of the
+// specified targets as of ts. The targets are ones being dropped from the
+// changefeed, or those of a changefeed which completed, so no changes after
+// ts will be emitted for them. opt names the option which requested the
+// markers, in errors.
+func emitEndOfStream(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	user username.SQLUsername,
+	jobID jobspb.JobID,
+	details jobspb.ChangefeedDetails,
+	targets []changefeedbase.Target,
+	ts hlc.Timestamp,
+	opt string,
+) error {
+	return emitTargetMarkers(ctx, execCfg, user, jobID, details, targets, ts, opt,
+		func(e *jsonEncoder) Encoder { return endOfStreamEncoder{e} })
+}
+
+// emitTargetMarkers emits, to the sink of the changefeed described by
+// details, the marker encoded by the encoder returned by marker, in place of
+// a resolved timestamp, as of ts to the topic of each of the specified
+// targets. opt names the option which requested the markers, in errors.
+func emitTargetMarkers(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	user username.SQLUsername,
+	jobID jobspb.JobID,
+	details jobspb.ChangefeedDetails,
+	targets []changefeedbase.Target,
+	ts hlc.Timestamp,
+	opt string,
+	marker func(*jsonEncoder) Encoder,
+) error {
+	if err := validateTargetMarkersFormat(details, opt); err != nil {
+		return err
+	}
+	encodingOpts, err := changefeedbase.MakeStatementOptions(details.Opts).GetEncodingOptions()
+	if err != nil {
+		return err
+	}
+	encoder, err := getEncoder(encodingOpts, AllTargets(details), nil /* reg */)
+	if err != nil {
+		return err
+	}
+	jsonEnc, ok := encoder.(*jsonEncoder)
+	if !ok {
+		return errors.AssertionFailedf(`unexpected encoder %T`, encoder)
+	}
+
+	sink, err := dialSinkOfJob(ctx, execCfg, user, jobID, details)
+	if err != nil {
+		return err
+	}
+	if !canEmitResolvedTimestampForTargets(sink) {
+		return errors.CombineErrors(
+			pgerror.Newf(pgcode.FeatureNotSupported, `%s is not supported by this sink`, opt),
+			sink.Close())
+	}
+
+	dropped := make(map[changefeedbase.Target]struct{}, len(targets))
+	for _, t := range targets {
+		dropped[t] = struct{}{}
+	}
+	include := func(t changefeedbase.Target) bool {
+		_, ok := dropped[t]
+		return ok
+	}
+	if err := sink.(TargetResolvedTimestampSink).EmitResolvedTimestampForTargets(
+		ctx, marker(jsonEnc), ts, include,
+	); err != nil {
+		return errors.CombineErrors(err, sink.Close())
+	}
+	if err := sink.Flush(ctx); err != nil {
+		return errors.CombineErrors(err, sink.Close())
+	}
+	return sink.Close()
+}
+
+// targetList returns the targets as a list.
+func targetList(targets changefeedbase.Targets) []changefeedbase.Target {
+	list := make([]changefeedbase.Target, 0, targets.Size)
+	_ = targets.EachTarget(func(t changefeedbase.Target) error {
+		list = append(list, t)
+		return nil
+	})
+	return list
+}
+
+// validateTargetMarkersFormat returns an error if the changefeed described by
+// details can't emit markers to the topics of its targets because of its
+// format. opt names the option which requested the markers, in errors.
+func validateTargetMarkersFormat(details jobspb.ChangefeedDetails, opt string) error {
+	encodingOpts, err := changefeedbase.MakeStatementOptions(details.Opts).GetEncodingOptions()
+	if err != nil {
+		return err
+	}
+	if encodingOpts.Format != changefeedbase.OptFormatJSON {
+		return pgerror.Newf(pgcode.InvalidParameterValue,
+			`%s is only supported with %s=%s`, opt,
+			changefeedbase.OptFormat, changefeedbase.OptFormatJSON)
+	}
+	return nil
+}
+
+// maybeEmitPendingEndOfStream emits the end-of-stream markers recorded in the
+// progress of the job by ALTER CHANGEFEED for the targets it dropped. They're
+// emitted at the high-water of the job, from which it resumes without those
+// targets, and then cleared from its progress.
+func (b *changefeedResumer) maybeEmitPendingEndOfStream(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	user username.SQLUsername,
+	jobID jobspb.JobID,
+	details jobspb.ChangefeedDetails,
+	progress *jobspb.Progress,
+) error {
+	cf := progress.GetChangefeed()
+	if cf == nil || len(cf.EndOfStreamTargets) == 0 {
+		return nil
+	}
+	ts := details.StatementTime
+	if hw := progress.GetHighWater(); hw != nil && !hw.IsEmpty() {
+		ts = *hw
+	}
+	// The dropped targets are no longer among those of the changefeed, so
+	// the sink is dialed for them alone.
+	droppedDetails := details
+	droppedDetails.TargetSpecifications = cf.EndOfStreamTargets
+	if err := emitEndOfStream(ctx, execCfg, user, jobID, droppedDetails,
+		targetList(AllTargets(droppedDetails)), ts, changefeedbase.OptEndOfStream,
+	); err != nil {
+		return errors.Wrap(err, `failed to emit end of stream`)
+	}
+	if err := b.job.NoTxn().Update(ctx, func(
+		txn isql.Txn, md jobs.JobMetadata, ju *jobs.JobUpdater,
+	) error {
+		if cf := md.Progress.GetChangefeed(); cf != nil {
+			cf.EndOfStreamTargets = nil
+		}
+		ju.UpdateProgress(md.Progress)
+		return nil
+	}); err != nil {
+		return err
+	}
+	cf.EndOfStreamTargets = nil
+	return nil
+}
+
+// dialSinkOfJob builds and dials the sink of the changefeed described by
+// details, outside of its flow.
+func dialSinkOfJob(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	user username.SQLUsername,
+	jobID jobspb.JobID,
+	details jobspb.ChangefeedDetails,
+) (Sink, error) {
+	opts := changefeedbase.MakeStatementOptions(details.Opts)
+	metrics := execCfg.JobRegistry.MetricsStruct().Changefeed.(*Metrics)
+	scope, _ := opts.GetMetricScope()
+	sli, err := metrics.getSLIMetrics(scope)
+	if err != nil {
+		return nil, err
+	}
+	var nilOracle timestampLowerBoundOracle
+	return getAndDialSink(ctx, &execCfg.DistSQLSrv.ServerConfig, details,
+		nilOracle, user, jobID, sli)
+}
@@ -9,9 +9,12 @@
 package changefeedccl
 
 import (
+	"bytes"
 	"context"
 	"hash"
 	"hash/crc32"
+	"hash/fnv"
+	"math"
 	"runtime"
 	"time"
 
@@ -20,8 +23,10 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
 	"github.com/cockroachdb/cockroach/pkg/clusterversion"
+	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfra"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfrapb"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
@@ -35,6 +40,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/span"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/errors"
 )
 
@@ -47,6 +53,8 @@ type eventContext struct {
 	updated, mvcc hlc.Timestamp
 	// topic is set to the string to be included if TopicInValue is true
 	topic string
+	// rowLevelTTL is set if the change was written by the row-level TTL job.
+	rowLevelTTL bool
 }
 
 type eventConsumer interface {
@@ -72,8 +80,57 @@ type kvEventToRowConsumer struct {
 	topicDescriptorCache map[TopicIdentifier]TopicDescriptor
 	topicNamer           *TopicNamer
 
+	// schemaSink, if set, is told the columns of each table version, which are
+	// recorded in describedSchemas once it has been.
+	schemaSink       SchemaDescribingSink
+	describedSchemas map[TopicIdentifier]descpb.DescriptorVersion
+
 	metrics *sliMetrics
 
+	// emittedByTable, if set, accumulates the messages and bytes emitted for
+	// each table.
+	emittedByTable *tableEmittedCounts
+
+	// contentDigests, if set, accumulates the digests of the messages emitted
+	// under the content_hash option, whose content hashes are returned by
+	// contentHasher.
+	contentDigests *contentDigests
+	contentHasher  contentHasher
+
+	// cloudEvents, if set, returns the events of rows in binary mode, which
+	// are carried to the sink by the contexts rows are emitted in.
+	cloudEvents binaryCloudEventEncoder
+
+	// sampleThreshold, if nonzero, is the threshold below which the hashes of
+	// the primary keys of rows fall for their changes to be emitted under the
+	// sample_rate option.
+	sampleThreshold uint64
+	sampleHasher    hash.Hash64
+
+	// issuedDeletes, if set, recognizes the deletions issued by the changefeed
+	// under delete_after_emit, which are not emitted.
+	issuedDeletes *issuedDeletes
+
+	// deadLetters, if set, writes the events which fail to be evaluated or
+	// encoded into the dead letter table of the changefeed.
+	deadLetters *deadLetterWriter
+
+	// contract, if set, is the output contract to which the values of
+	// messages must conform, whose violations are handled according to
+	// contractPolicy.
+	contract       *changefeedbase.OutputContract
+	contractPolicy changefeedbase.ContractViolationPolicy
+
+	// streamingValueThreshold, if nonzero, is the size of the allocations of
+	// events from which their values are encoded straight into the buffers
+	// handed to the sink, if the encoder is a streamingEncoder.
+	streamingValueThreshold int64
+
+	// tracer, if set, starts the span in which each row is emitted, whose
+	// traceparent the sink stamps on its message under the trace_context
+	// option.
+	tracer *tracing.Tracer
+
 	// This pacer is used to incorporate event consumption to elastic CPU
 	// control. This helps ensure that event encoding/decoding does not throttle
 	// foreground SQL traffic.
@@ -96,26 +153,39 @@ func newEventConsumer(
 	sink EventSink,
 	metrics *Metrics,
 	sliMetrics *sliMetrics,
+	emittedByTable *tableEmittedCounts,
+	contentDigests *contentDigests,
 	knobs TestingKnobs,
 ) (eventConsumer, EventSink, error) {
 	encodingOpts, err := feed.Opts.GetEncodingOptions()
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := resolveSchemaRegistryURI(ctx, cfg.DB, &encodingOpts); err != nil {
+		return nil, nil, err
+	}
+	encodingOpts = withSourceGeneration(encodingOpts, cfg.LogicalClusterID, spec.Feed)
+	settingsOverrides, err := feed.Opts.GetSettingsOverrides()
+	if err != nil {
+		return nil, nil, err
+	}
 
 	pacerRequestUnit := changefeedbase.EventConsumerPacerRequestSize.Get(&cfg.Settings.SV)
 	enablePacer := changefeedbase.EventConsumerElasticCPUControlEnabled.Get(&cfg.Settings.SV)
 
 	makeConsumer := func(s EventSink, frontier frontier) (eventConsumer, error) {
 		var err error
-		encoder, err := getEncoder(encodingOpts, feed.Targets)
+		encoder, err := getEncoder(encodingOpts, feed.Targets, schemaRegistryForSink(s))
 		if err != nil {
 			return nil, err
 		}
 
 		var topicNamer *TopicNamer
-		if encodingOpts.TopicInValue {
-			topicNamer, err = MakeTopicNamer(feed.Targets)
+		// The topics of messages are named for the encoder, if it puts them in
+		// messages, and for the digests of the content_hash option.
+		if encodingOpts.TopicInValue || encodingOpts.Envelope == changefeedbase.OptEnvelopeCloudEvents ||
+			encodingOpts.Envelope == changefeedbase.OptEnvelopeGoldenGate || encodingOpts.ContentHash {
+			topicNamer, err = MakeTopicNamer(feed.Targets, familyTopicNameOptions(encodingOpts)...)
 			if err != nil {
 				return nil, err
 			}
@@ -143,10 +213,10 @@ func newEventConsumer(
 
 		execCfg := cfg.ExecutorConfig.(*sql.ExecutorConfig)
 		return newKVEventToRowConsumer(ctx, execCfg, frontier, cursor, s,
-			encoder, feed, spec, knobs, topicNamer, sliMetrics, pacer)
+			encoder, feed, spec, knobs, topicNamer, sliMetrics, emittedByTable, contentDigests, pacer)
 	}
 
-	numWorkers := changefeedbase.EventConsumerWorkers.Get(&cfg.Settings.SV)
+	numWorkers := settingsOverrides.GetInt(changefeedbase.EventConsumerWorkers, &cfg.Settings.SV)
 	if numWorkers == 0 {
 		// Pick a reasonable default.
 		numWorkers = defaultNumWorkers()
@@ -179,7 +249,7 @@ func newEventConsumer(
 		doneCh:       make(chan struct{}),
 		numWorkers:   numWorkers,
 		workerCh:     make([]chan kvevent.Event, numWorkers),
-		workerChSize: changefeedbase.EventConsumerWorkerQueueSize.Get(&cfg.Settings.SV),
+		workerChSize: settingsOverrides.GetInt(changefeedbase.EventConsumerWorkerQueueSize, &cfg.Settings.SV),
 		spanFrontier: spanFrontier,
 	}
 	ss := &safeSink{wrapped: sink, beforeFlush: c.Flush}
@@ -220,11 +290,13 @@ func newKVEventToRowConsumer(
 	knobs TestingKnobs,
 	topicNamer *TopicNamer,
 	metrics *sliMetrics,
+	emittedByTable *tableEmittedCounts,
+	contentDigests *contentDigests,
 	pacer *admission.Pacer,
 ) (_ *kvEventToRowConsumer, err error) {
 	includeVirtual := details.Opts.IncludeVirtual()
 	keyOnly := details.Opts.KeyOnly()
-	decoder, err := cdcevent.NewEventDecoder(ctx, cfg, details.Targets, includeVirtual, keyOnly)
+	decoder, err := cdcevent.NewEventDecoder(ctx, cfg, spec.Feed.TenantID, details.Targets, includeVirtual, keyOnly)
 	if err != nil {
 		return nil, err
 	}
@@ -242,6 +314,55 @@ func newKVEventToRowConsumer(
 		return nil, err
 	}
 
+	var hasher contentHasher
+	if contentDigests != nil {
+		var ok bool
+		if hasher, ok = encoder.(contentHasher); !ok {
+			return nil, errors.AssertionFailedf(`encoder %T does not compute content hashes`, encoder)
+		}
+	}
+
+	var cloudEvents binaryCloudEventEncoder
+	if encodingOpts.Envelope == changefeedbase.OptEnvelopeCloudEvents &&
+		encodingOpts.CloudEventsMode == changefeedbase.OptCloudEventsModeBinary {
+		cloudEvents, _ = encoder.(binaryCloudEventEncoder)
+	}
+
+	sampleRate, err := details.Opts.GetSampleRate()
+	if err != nil {
+		return nil, err
+	}
+	var sampleThreshold uint64
+	if sampleRate < 1 {
+		sampleThreshold = uint64(sampleRate * math.MaxUint64)
+	}
+
+	var deadLetters *deadLetterWriter
+	if spec.Feed.DeadLetterTableID != 0 {
+		deadLetters = newDeadLetterWriter(cfg.InternalDB, spec.User(), spec.JobID, spec.Feed.DeadLetterTableID)
+	}
+
+	var deletes *issuedDeletes
+	if details.Opts.GetFilters().SkipDeletes && spec.JobID != 0 {
+		deletes = &issuedDeletes{registry: cfg.JobRegistry, jobID: spec.JobID}
+	}
+
+	contract, err := details.Opts.GetOutputContract()
+	if err != nil {
+		return nil, err
+	}
+	contractPolicy, err := details.Opts.GetOnContractViolation()
+	if err != nil {
+		return nil, err
+	}
+
+	var tracer *tracing.Tracer
+	if encodingOpts.TraceContext {
+		tracer = cfg.AmbientCtx.Tracer
+	}
+
+	schemaSink, _ := asSchemaDescribingSink(sink)
+
 	return &kvEventToRowConsumer{
 		frontier:             frontier,
 		encoder:              encoder,
@@ -252,10 +373,25 @@ func newKVEventToRowConsumer(
 		knobs:                knobs,
 		topicDescriptorCache: make(map[TopicIdentifier]TopicDescriptor),
 		topicNamer:           topicNamer,
+		schemaSink:           schemaSink,
+		describedSchemas:     make(map[TopicIdentifier]descpb.DescriptorVersion),
 		evaluator:            evaluator,
 		encodingFormat:       encodingOpts.Format,
 		metrics:              metrics,
+		emittedByTable:       emittedByTable,
+		contentDigests:       contentDigests,
+		contentHasher:        hasher,
+		cloudEvents:          cloudEvents,
+		sampleThreshold:      sampleThreshold,
+		sampleHasher:         fnv.New64a(),
+		issuedDeletes:        deletes,
+		deadLetters:          deadLetters,
+		contract:             contract,
+		contractPolicy:       contractPolicy,
+		tracer:               tracer,
 		pacer:                pacer,
+
+		streamingValueThreshold: changefeedbase.StreamingValueThreshold.Get(&cfg.Settings.SV),
 	}, nil
 }
 
@@ -330,6 +466,19 @@ func (c *kvEventToRowConsumer) ConsumeEvent(ctx context.Context, ev kvevent.Even
 		}
 	}
 
+	if c.sampleThreshold != 0 {
+		sampled, err := c.sampled(ev.KV().Key)
+		if err != nil {
+			return err
+		}
+		if !sampled {
+			c.metrics.FilteredMessages.Inc(1)
+			a := ev.DetachAlloc()
+			a.Release(ctx)
+			return nil
+		}
+	}
+
 	schemaTimestamp := ev.KV().Value.Timestamp
 	prevSchemaTimestamp := schemaTimestamp
 	keyOnly := c.details.Opts.KeyOnly()
@@ -343,15 +492,37 @@ func (c *kvEventToRowConsumer) ConsumeEvent(ctx context.Context, ev kvevent.Even
 	if err != nil {
 		// Column families are stored contiguously, so we'll get
 		// events for each one even if we're not watching them all.
-		if errors.Is(err, cdcevent.ErrUnwatchedFamily) {
+		// The rows of an offline table are scanned once it comes back
+		// online.
+		if errors.Is(err, cdcevent.ErrUnwatchedFamily) || errors.Is(err, cdcevent.ErrOfflineTable) {
 			return nil
 		}
 		return err
 	}
 
+	filters := c.details.Opts.GetFilters()
+	// Under delete_after_emit, the changefeed deletes the rows it emitted, and
+	// those deletions are not emitted in turn.
+	if filters.SkipDeletes && updatedRow.IsDeleted() && c.issuedDeletes != nil {
+		issued, err := c.issuedDeletes.issued(ctx, updatedRow.MvccTimestamp)
+		if err != nil {
+			return changefeedbase.MarkRetryableError(err)
+		}
+		if issued {
+			a := ev.DetachAlloc()
+			a.Release(ctx)
+			return nil
+		}
+	}
+
 	// Get prev value, if necessary.
 	prevRow, err := func() (cdcevent.Row, error) {
-		if !c.details.Opts.GetFilters().WithDiff {
+		if !filters.WithDiff {
+			return cdcevent.Row{}, nil
+		}
+		// With delete_before_image, only deletions carry their previous row,
+		// which encoders otherwise emit as if there were none.
+		if filters.DiffOnlyDeletes && !updatedRow.IsDeleted() {
 			return cdcevent.Row{}, nil
 		}
 		return c.decoder.DecodeKV(ctx, ev.PrevKeyValue(), cdcevent.PrevRow, prevSchemaTimestamp, keyOnly)
@@ -359,16 +530,18 @@ func (c *kvEventToRowConsumer) ConsumeEvent(ctx context.Context, ev kvevent.Even
 	if err != nil {
 		// Column families are stored contiguously, so we'll get
 		// events for each one even if we're not watching them all.
-		if errors.Is(err, cdcevent.ErrUnwatchedFamily) {
+		// The rows of an offline table are scanned once it comes back
+		// online.
+		if errors.Is(err, cdcevent.ErrUnwatchedFamily) || errors.Is(err, cdcevent.ErrOfflineTable) {
 			return nil
 		}
 		return err
 	}
 
 	if c.evaluator != nil {
-		projection, err := c.evaluator.Eval(ctx, updatedRow, prevRow)
+		projection, err := c.evaluator.Eval(ctx, updatedRow, prevRow, !ev.BackfillTimestamp().IsEmpty())
 		if err != nil {
-			return err
+			return c.handlePoisonEvent(ctx, ev.KV(), updatedRow.TableID, ev.DetachAlloc(), err)
 		}
 
 		if !projection.IsInitialized() {
@@ -384,14 +557,76 @@ func (c *kvEventToRowConsumer) ConsumeEvent(ctx context.Context, ev kvevent.Even
 		updatedRow, prevRow = projection, cdcevent.Row{}
 	}
 
-	return c.encodeAndEmit(ctx, updatedRow, prevRow, schemaTimestamp, ev.DetachAlloc())
+	alloc := ev.DetachAlloc()
+	if err := c.encodeAndEmit(ctx, ev.KV().Key, updatedRow, prevRow, schemaTimestamp, ev.RowLevelTTL(), alloc); err != nil {
+		if errors.Is(err, errEncodingFailed) {
+			return c.handlePoisonEvent(ctx, ev.KV(), updatedRow.TableID, alloc, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// errEncodingFailed marks the errors of events which could not be encoded,
+// whose allocations were not yet handed to the sink.
+var errEncodingFailed = errors.New("encoding failed")
+
+// errContractViolation marks the errors of events whose messages violate the
+// output contract of the changefeed.
+var errContractViolation = errors.New("output contract violated")
+
+// contractViolation returns the error of an event whose message violates the
+// output contract. Under on_contract_violation=dead_letter, the event is
+// handled like one which failed to be encoded, and otherwise the error pauses
+// the changefeed.
+func (c *kvEventToRowConsumer) contractViolation(err error) error {
+	err = errors.Mark(errors.Wrapf(err, `message violates %s`, changefeedbase.OptOutputContract),
+		errContractViolation)
+	if c.contractPolicy == changefeedbase.OptOnContractViolationDeadLetter {
+		return errors.Mark(err, errEncodingFailed)
+	}
+	return changefeedbase.WithTerminalError(err)
+}
+
+// handlePoisonEvent writes the event kv of the table with the given ID, which
+// failed with err, into the dead letter table of the changefeed if it has one
+// and the event would fail again if retried. It returns err otherwise, or if
+// the event could not be written.
+func (c *kvEventToRowConsumer) handlePoisonEvent(
+	ctx context.Context, kv roachpb.KeyValue, tableID descpb.ID, alloc kvevent.Alloc, err error,
+) error {
+	if c.deadLetters == nil || !isPoisonEvent(ctx, err) {
+		return err
+	}
+	if writeErr := c.deadLetters.write(ctx, kv, tableID, err); writeErr != nil {
+		return errors.CombineErrors(err, errors.Wrap(writeErr, `writing event to dead letter table`))
+	}
+	alloc.Release(ctx)
+	return nil
+}
+
+// sampled returns whether the changes of the row with the given key are part
+// of the sample emitted under the sample_rate option. The sample consists of
+// the rows whose primary key, including the table prefix but not the column
+// family, hashes below sampleThreshold, so that every change to a row, and
+// every family of it, is either emitted or not, on every node.
+func (c *kvEventToRowConsumer) sampled(key roachpb.Key) (bool, error) {
+	rowKey, err := keys.EnsureSafeSplitKey(key)
+	if err != nil {
+		return false, err
+	}
+	c.sampleHasher.Reset()
+	_, _ = c.sampleHasher.Write(rowKey)
+	return c.sampleHasher.Sum64() < c.sampleThreshold, nil
 }
 
 func (c *kvEventToRowConsumer) encodeAndEmit(
 	ctx context.Context,
+	key roachpb.Key,
 	updatedRow cdcevent.Row,
 	prevRow cdcevent.Row,
 	schemaTS hlc.Timestamp,
+	rowLevelTTL bool,
 	alloc kvevent.Alloc,
 ) error {
 	topic, err := c.topicForEvent(updatedRow.Metadata)
@@ -412,8 +647,9 @@ func (c *kvEventToRowConsumer) encodeAndEmit(
 	}
 
 	evCtx := eventContext{
-		updated: schemaTS,
-		mvcc:    updatedRow.MvccTimestamp,
+		updated:     schemaTS,
+		mvcc:        updatedRow.MvccTimestamp,
+		rowLevelTTL: rowLevelTTL,
 	}
 
 	if c.topicNamer != nil {
@@ -430,40 +666,143 @@ func (c *kvEventToRowConsumer) encodeAndEmit(
 		}
 	}
 
+	if err := c.maybeDescribeSchema(topic, updatedRow); err != nil {
+		return err
+	}
+
 	if c.encodingFormat == changefeedbase.OptFormatParquet {
-		return c.encodeForParquet(
+		if err := c.encodeForParquet(
 			ctx, updatedRow, prevRow, topic, schemaTS, updatedRow.MvccTimestamp, alloc,
-		)
+		); err != nil {
+			return err
+		}
+		// Parquet rows are encoded by the sink, so the size of the datums they
+		// hold is recorded instead of the size of the encoded row.
+		size, err := parquetRowSize(updatedRow)
+		if err != nil {
+			return err
+		}
+		c.emittedByTable.record(updatedRow.Metadata, key, updatedRow.MvccTimestamp, size)
+		return nil
 	}
 	var keyCopy, valueCopy []byte
 	encodedKey, err := c.encoder.EncodeKey(ctx, updatedRow)
 	if err != nil {
-		return err
+		return errors.Mark(err, errEncodingFailed)
 	}
 	c.scratch, keyCopy = c.scratch.Copy(encodedKey, 0 /* extraCap */)
 	// TODO(yevgeniy): Some refactoring is needed in the encoder: namely, prevRow
 	// might not be available at all when working with changefeed expressions.
-	encodedValue, err := c.encoder.EncodeValue(ctx, evCtx, updatedRow, prevRow)
+	var encodedValue []byte
+	encoder, streamed := c.streamingEncoderFor(alloc)
+	if streamed {
+		encodedValue, err = c.streamValue(ctx, encoder, evCtx, updatedRow, prevRow, alloc)
+	} else {
+		encodedValue, err = c.encoder.EncodeValue(ctx, evCtx, updatedRow, prevRow)
+	}
 	if err != nil {
-		return err
+		return errors.Mark(err, errEncodingFailed)
+	}
+	if c.contract != nil && encodedValue != nil {
+		if err := c.contract.Validate(encodedValue); err != nil {
+			return c.contractViolation(err)
+		}
+	}
+	if streamed {
+		// The streamed value is owned by the consumer already.
+		valueCopy = encodedValue
+	} else {
+		c.scratch, valueCopy = c.scratch.Copy(encodedValue, 0 /* extraCap */)
 	}
-	c.scratch, valueCopy = c.scratch.Copy(encodedValue, 0 /* extraCap */)
 
 	// Since we're done processing/converting this event, and will not use much more
 	// than len(key)+len(bytes) worth of resources, adjust allocation to match.
 	alloc.AdjustBytesToTarget(ctx, int64(len(keyCopy)+len(valueCopy)))
 
+	if c.tracer != nil {
+		var sp *tracing.Span
+		ctx, sp = startEmitRowSpan(ctx, c.tracer)
+		defer sp.Finish()
+	}
+	if c.cloudEvents != nil {
+		ctx = withBinaryCloudEvent(ctx, c.cloudEvents.lastBinaryCloudEvent())
+	}
 	if err := c.sink.EmitRow(
 		ctx, topic, keyCopy, valueCopy, schemaTS, updatedRow.MvccTimestamp, alloc,
 	); err != nil {
 		return err
 	}
+	c.emittedByTable.record(updatedRow.Metadata, key, updatedRow.MvccTimestamp, len(keyCopy)+len(valueCopy))
+	if c.contentHasher != nil {
+		c.contentDigests.record(evCtx.topic, schemaTS, c.contentHasher.lastContentHash())
+	}
 	if log.V(3) {
 		log.Infof(ctx, `r %s: %s -> %s`, updatedRow.TableName, keyCopy, valueCopy)
 	}
 	return nil
 }
 
+// maybeDescribeSchema tells the sink the columns of the table version of the
+// row, if it describes schemas and hasn't been told them yet.
+func (c *kvEventToRowConsumer) maybeDescribeSchema(
+	topic TopicDescriptor, updatedRow cdcevent.Row,
+) error {
+	if c.schemaSink == nil {
+		return nil
+	}
+	id := topic.GetTopicIdentifier()
+	if version, ok := c.describedSchemas[id]; ok && version == topic.GetVersion() {
+		return nil
+	}
+	var keyCols, valueCols []cdcevent.ResultColumn
+	if err := updatedRow.ForEachKeyColumn().Col(func(col cdcevent.ResultColumn) error {
+		keyCols = append(keyCols, col)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := updatedRow.ForEachColumn().Col(func(col cdcevent.ResultColumn) error {
+		valueCols = append(valueCols, col)
+		return nil
+	}); err != nil {
+		return err
+	}
+	c.schemaSink.DescribeSchema(topic, keyCols, valueCols)
+	c.describedSchemas[id] = topic.GetVersion()
+	return nil
+}
+
+// streamingEncoderFor returns the encoder with which to stream the value of
+// the event with the given allocation, if it is at least
+// streamingValueThreshold large and the encoder can stream values.
+func (c *kvEventToRowConsumer) streamingEncoderFor(alloc kvevent.Alloc) (streamingEncoder, bool) {
+	if c.streamingValueThreshold == 0 || alloc.Bytes() < c.streamingValueThreshold {
+		return nil, false
+	}
+	encoder, ok := c.encoder.(streamingEncoder)
+	return encoder, ok
+}
+
+// streamValue encodes the value of a row into a buffer of its own, which is
+// handed to the sink as is, rather than through the buffers of the encoder and
+// the scratch space of the consumer, sizing the buffer after the allocation of
+// the event. The value is nil if the row has none.
+func (c *kvEventToRowConsumer) streamValue(
+	ctx context.Context,
+	encoder streamingEncoder,
+	evCtx eventContext,
+	updatedRow cdcevent.Row,
+	prevRow cdcevent.Row,
+	alloc kvevent.Alloc,
+) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, alloc.Bytes()))
+	hasValue, err := encoder.EncodeValueTo(ctx, buf, evCtx, updatedRow, prevRow)
+	if err != nil || !hasValue {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // Close closes this consumer.
 func (c *kvEventToRowConsumer) Close() error {
 	c.pacer.Close()
@@ -473,6 +812,19 @@ func (c *kvEventToRowConsumer) Close() error {
 	return nil
 }
 
+// parquetRowSize returns the in-memory size of the datums of the columns the
+// parquet writer writes for the row.
+func parquetRowSize(row cdcevent.Row) (int, error) {
+	var size uintptr
+	if err := row.ForAllColumns().Datum(func(d tree.Datum, col cdcevent.ResultColumn) error {
+		size += d.Size()
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return int(size), nil
+}
+
 func (c *kvEventToRowConsumer) encodeForParquet(
 	ctx context.Context,
 	updatedRow cdcevent.Row,
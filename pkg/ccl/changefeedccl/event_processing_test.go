@@ -9,6 +9,8 @@
 package changefeedccl
 
 import (
+	"hash/fnv"
+	"math"
 	"math/rand"
 	"testing"
 
@@ -206,6 +208,41 @@ func TestShardingByKey(t *testing.T) {
 	}
 }
 
+func TestSampleByKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	sampleRate := 0.1
+	makeConsumer := func() *kvEventToRowConsumer {
+		return &kvEventToRowConsumer{
+			sampleThreshold: uint64(sampleRate * math.MaxUint64),
+			sampleHasher:    fnv.New64a(),
+		}
+	}
+	c1, c2 := makeConsumer(), makeConsumer()
+
+	const numRows = 10000
+	numSampled := 0
+	for i := 0; i < numRows; i++ {
+		rowKey, err := keyside.Encode(
+			keys.SystemSQLCodec.IndexPrefix(42, 1), tree.NewDInt(tree.DInt(i)), encoding.Ascending,
+		)
+		require.NoError(t, err)
+		sampled, err := c1.sampled(keys.MakeFamilyKey(rowKey, 0))
+		require.NoError(t, err)
+		if sampled {
+			numSampled++
+		}
+
+		// Every family of a row, on every consumer, is sampled alike.
+		for _, family := range []uint32{0, 1, 7} {
+			familySampled, err := c2.sampled(keys.MakeFamilyKey(rowKey, family))
+			require.NoError(t, err)
+			require.Equal(t, sampled, familySampled)
+		}
+	}
+	require.InDelta(t, sampleRate, float64(numSampled)/numRows, 0.02)
+}
+
 func BenchmarkShardingByKey(b *testing.B) {
 	rng, _ := randutil.NewTestRand()
 	p := parallelEventConsumer{numWorkers: 32, hasher: makeHasher()}
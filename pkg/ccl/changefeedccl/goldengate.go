@@ -0,0 +1,74 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+)
+
+// The goldengate envelope emits each row in the JSON format of the Oracle
+// GoldenGate Kafka handler, which is also produced by Qlik Replicate and
+// understood by much of the ETL built for them, e.g.
+//
+//	{
+//	  "table": "db.public.foo",
+//	  "op_type": "U",
+//	  "op_ts": "2023-06-02 22:14:36.123456",
+//	  "current_ts": "2023-06-02T22:14:37.000123",
+//	  "pos": "16857440761234567890000000000",
+//	  "primary_keys": ["a"],
+//	  "before": {"a": 1, "b": "x"},
+//	  "after": {"a": 1, "b": "y"}
+//	}
+//
+// The table of a row is its topic, op_ts is the commit time of the change and
+// current_ts the time it was encoded. The position of a change is its MVCC
+// timestamp, formatted so that positions sort as strings in the order of the
+// changes. Inserts have no before image, and deletes no after image.
+const (
+	goldenGateOpInsert = `I`
+	goldenGateOpUpdate = `U`
+	goldenGateOpDelete = `D`
+
+	goldenGateOpTimeFormat      = `2006-01-02 15:04:05.000000`
+	goldenGateCurrentTimeFormat = `2006-01-02T15:04:05.000000`
+)
+
+// goldenGateOpType returns the operation type of the change of a row. It
+// requires the previous row, which is given by the diff option.
+func goldenGateOpType(updated, prev cdcevent.Row) string {
+	switch {
+	case updated.IsDeleted():
+		return goldenGateOpDelete
+	case prev.IsInitialized() && !prev.IsDeleted():
+		return goldenGateOpUpdate
+	default:
+		return goldenGateOpInsert
+	}
+}
+
+// goldenGateOpTime formats the commit time of a change.
+func goldenGateOpTime(ts hlc.Timestamp) string {
+	return ts.GoTime().UTC().Format(goldenGateOpTimeFormat)
+}
+
+// goldenGateCurrentTime formats the time at which a change is encoded.
+func goldenGateCurrentTime(t time.Time) string {
+	return t.UTC().Format(goldenGateCurrentTimeFormat)
+}
+
+// goldenGatePos formats the MVCC timestamp of a change as its position: the
+// zero-padded wall time followed by the zero-padded logical time.
+func goldenGatePos(ts hlc.Timestamp) string {
+	return fmt.Sprintf(`%019d%010d`, ts.WallTime, ts.Logical)
+}
@@ -946,6 +946,20 @@ func makeFeedFactoryWithOptions(
 	case "pubsub":
 		f := makePubsubFeedFactory(srvOrCluster, db)
 		return f, func() {}
+	case "external-kafka":
+		brokers := os.Getenv(externalKafkaBrokersEnv)
+		cleanup := func() {}
+		if brokers == "" {
+			brokers, cleanup = startKafkaContainer(t)
+		}
+		f := makeExternalKafkaFeedFactory(srvOrCluster, db, brokers)
+		return f, cleanup
+	case "external-pubsub":
+		if os.Getenv(pubsubEmulatorHostEnv) == "" {
+			skip.IgnoreLint(t, pubsubEmulatorHostEnv+" env var must be set")
+		}
+		f := makeExternalPubsubFeedFactory(srvOrCluster, db)
+		return f, func() {}
 	case "sinkless":
 		sink, cleanup := pgURLForUser(username.RootUser)
 		f := makeSinklessFeedFactory(s, sink, pgURLForUser)
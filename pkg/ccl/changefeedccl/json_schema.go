@@ -0,0 +1,269 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/json"
+	"github.com/cockroachdb/errors"
+)
+
+// The json_schema option wraps each message in the envelope of the Kafka
+// Connect JsonConverter with schemas.enable=true, which describes the types
+// and nullability of the columns of the row, e.g.
+//
+//	{
+//	  "payload": {"a": 1, "b": "x"},
+//	  "schema": {"fields": [
+//	    {"field": "a", "optional": false, "type": "int64"},
+//	    {"field": "b", "optional": true, "type": "string"}
+//	  ], "name": "foo", "optional": true, "type": "struct"}
+//	}
+//
+// so that consumers which need the types of columns, such as the Connect JDBC
+// sink, can consume changefeeds without avro and a schema registry. Connect
+// has no type for arbitrary JSON, so JSONB values are sent as their text.
+// Deletes in the bare envelope have a null payload, which the JsonConverter
+// reads as a tombstone. Keys are wrapped as well under key_format=object,
+// and sent as they are otherwise.
+const (
+	connectTypeStruct  = `struct`
+	connectTypeArray   = `array`
+	connectTypeString  = `string`
+	connectTypeBoolean = `boolean`
+	connectTypeInt16   = `int16`
+	connectTypeInt32   = `int32`
+	connectTypeInt64   = `int64`
+	connectTypeFloat   = `float`
+	connectTypeDouble  = `double`
+)
+
+// connectFieldSchema returns the Connect schema of a field of the given type.
+// The values of types which have no Connect equivalent are encoded as JSON
+// strings, and so are described as strings.
+func connectFieldSchema(name string, typ *types.T, optional bool) (json.JSON, error) {
+	b := json.NewObjectBuilder(4)
+	if name != `` {
+		b.Add("field", json.FromString(name))
+	}
+	switch typ.Family() {
+	case types.BoolFamily:
+		b.Add("type", json.FromString(connectTypeBoolean))
+	case types.IntFamily:
+		switch typ.Width() {
+		case 16:
+			b.Add("type", json.FromString(connectTypeInt16))
+		case 32:
+			b.Add("type", json.FromString(connectTypeInt32))
+		default:
+			b.Add("type", json.FromString(connectTypeInt64))
+		}
+	case types.OidFamily:
+		b.Add("type", json.FromString(connectTypeInt64))
+	case types.FloatFamily:
+		if typ.Width() == 32 {
+			b.Add("type", json.FromString(connectTypeFloat))
+		} else {
+			b.Add("type", json.FromString(connectTypeDouble))
+		}
+	case types.DecimalFamily:
+		b.Add("type", json.FromString(connectTypeDouble))
+	case types.ArrayFamily:
+		if typ.ArrayContents().Family() == types.JsonFamily {
+			return nil, errors.Errorf(`%s does not support columns of type %s`,
+				changefeedbase.OptJSONSchema, typ.SQLString())
+		}
+		items, err := connectFieldSchema(``, typ.ArrayContents(), true /* optional */)
+		if err != nil {
+			return nil, err
+		}
+		b.Add("type", json.FromString(connectTypeArray))
+		b.Add("items", items)
+	case types.GeometryFamily, types.GeographyFamily, types.TupleFamily:
+		return nil, errors.Errorf(`%s does not support columns of type %s`,
+			changefeedbase.OptJSONSchema, typ.SQLString())
+	default:
+		b.Add("type", json.FromString(connectTypeString))
+	}
+	b.Add("optional", json.FromBool(optional))
+	return b.Build(), nil
+}
+
+// connectStructSchema returns the Connect schema of a struct with the given
+// fields. The struct is the field of another struct if field is set, and is
+// named if name is set.
+func connectStructSchema(field, name string, fields []json.JSON, optional bool) json.JSON {
+	b := json.NewObjectBuilder(5)
+	if field != `` {
+		b.Add("field", json.FromString(field))
+	}
+	b.Add("type", json.FromString(connectTypeStruct))
+	if name != `` {
+		b.Add("name", json.FromString(name))
+	}
+	b.Add("optional", json.FromBool(optional))
+	fieldsBuilder := json.NewArrayBuilder(len(fields))
+	for _, f := range fields {
+		fieldsBuilder.Add(f)
+	}
+	b.Add("fields", fieldsBuilder.Build())
+	return b.Build()
+}
+
+// connectPrimitive returns the schema of an optional field of a primitive
+// Connect type.
+func connectPrimitive(name string, connectType string) json.JSON {
+	b := json.NewObjectBuilder(3)
+	b.Add("field", json.FromString(name))
+	b.Add("type", json.FromString(connectType))
+	b.Add("optional", json.FromBool(true))
+	return b.Build()
+}
+
+// connectMetaSchema returns the schema of the metadata nested in the messages
+// of rows under the metadata key of the bare envelope, or nil if there is
+// none. key_in_value and source_generation, whose metadata isn't a primitive,
+// can't be used with json_schema.
+func (e *jsonEncoder) connectMetaSchema() json.JSON {
+	var fields []json.JSON
+	if e.updatedField {
+		fields = append(fields, connectPrimitive("updated", connectTypeString))
+	}
+	if e.mvccTimestampField {
+		switch e.mvccTimestampFormat {
+		case changefeedbase.OptMVCCTimestampSplit:
+			fields = append(fields,
+				connectPrimitive("mvcc_timestamp_wall", connectTypeInt64),
+				connectPrimitive("mvcc_timestamp_logical", connectTypeInt32),
+			)
+		case changefeedbase.OptMVCCTimestampNanos:
+			fields = append(fields, connectPrimitive("mvcc_timestamp", connectTypeInt64))
+		default:
+			fields = append(fields, connectPrimitive("mvcc_timestamp", connectTypeString))
+		}
+	}
+	if e.topicInValue {
+		fields = append(fields, connectPrimitive("topic", connectTypeString))
+	}
+	if e.familyInValue {
+		fields = append(fields, connectPrimitive("family", connectTypeString))
+	}
+	if e.latencyFields {
+		fields = append(fields,
+			connectPrimitive("emit_time", connectTypeString),
+			connectPrimitive("emit_time_ns", connectTypeInt64),
+			connectPrimitive("commit_time", connectTypeString),
+			connectPrimitive("commit_time_ns", connectTypeInt64),
+		)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return connectStructSchema(e.metaKey, ``, fields, true /* optional */)
+}
+
+// connectSchema returns the schema of the messages of rows of the version of
+// the table, which is memoized.
+func (e *versionEncoder) connectSchema(row cdcevent.Row, metaSchema json.JSON) (json.JSON, error) {
+	if e.valueConnectSchema != nil {
+		return e.valueConnectSchema, nil
+	}
+	var fields []json.JSON
+	if err := row.ForEachColumn().Col(func(col cdcevent.ResultColumn) error {
+		f, err := connectFieldSchema(col.Name, col.Typ, col.Nullable())
+		if err != nil {
+			return err
+		}
+		fields = append(fields, f)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if metaSchema != nil {
+		fields = append(fields, metaSchema)
+	}
+	// The payload of deletes is null, so the row is optional in messages
+	// which may be deletes.
+	e.valueConnectSchema = connectStructSchema(``, row.TableName, fields, true /* optional */)
+	return e.valueConnectSchema, nil
+}
+
+// connectKeySchema returns the schema of the keys of rows of the version of
+// the table under key_format=object, which is memoized.
+func (e *versionEncoder) connectKeySchema(row cdcevent.Row) (json.JSON, error) {
+	if e.keyConnectSchema != nil {
+		return e.keyConnectSchema, nil
+	}
+	var fields []json.JSON
+	if err := row.ForEachKeyColumn().Col(func(col cdcevent.ResultColumn) error {
+		f, err := connectFieldSchema(col.Name, col.Typ, col.Nullable())
+		if err != nil {
+			return err
+		}
+		fields = append(fields, f)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	e.keyConnectSchema = connectStructSchema(``, row.TableName+".key", fields, false /* optional */)
+	return e.keyConnectSchema, nil
+}
+
+// connectEnvelope wraps the payload of a message with its schema.
+func connectEnvelope(schema, payload json.JSON) json.JSON {
+	b := json.NewObjectBuilder(2)
+	b.Add("schema", schema)
+	b.Add("payload", payload)
+	return b.Build()
+}
+
+// initConnectSchema wraps the messages of rows of the raw envelope in the
+// envelope of the Connect JsonConverter.
+func (e *jsonEncoder) initConnectSchema() {
+	payloadEncoder := e.envelopeEncoder
+	metaSchema := e.connectMetaSchema()
+	e.envelopeEncoder = func(evCtx eventContext, updated, prev cdcevent.Row) (json.JSON, error) {
+		schema, err := e.versionEncoder(updated.EventDescriptor).connectSchema(updated, metaSchema)
+		if err != nil {
+			return nil, err
+		}
+		payload := json.NullJSONValue
+		if !updated.IsDeleted() {
+			payload, err = payloadEncoder(evCtx, updated, prev)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return connectEnvelope(schema, payload), nil
+	}
+}
+
+// connectMarkerSchema returns the schema of the contents of a timestamp
+// marker, an object whose values are strings or objects of the same. The
+// contents are the field of another struct if field is set.
+func connectMarkerSchema(field string, marker map[string]interface{}) json.JSON {
+	keys := make([]string, 0, len(marker))
+	for k := range marker {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]json.JSON, 0, len(keys))
+	for _, k := range keys {
+		if nested, ok := marker[k].(map[string]interface{}); ok {
+			fields = append(fields, connectMarkerSchema(k, nested))
+		} else {
+			fields = append(fields, connectPrimitive(k, connectTypeString))
+		}
+	}
+	return connectStructSchema(field, ``, fields, field != `` /* optional */)
+}
@@ -8,7 +8,11 @@
 
 package kvevent
 
-import "context"
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
 
 // Alloc describes the resources allocated on behalf of an event.
 // Allocations should eventually be released.
@@ -103,6 +107,83 @@ func (a *Alloc) Merge(other *Alloc) {
 	}
 }
 
+// SharedAlloc is an allocation held by several holders, such as the sinks a
+// message is emitted to, which is released once each holder has released its
+// share of it.
+type SharedAlloc struct {
+	bytes      int64
+	onReleased func(*SharedAlloc)
+
+	mu struct {
+		syncutil.Mutex
+		alloc    Alloc
+		released []bool
+		held     int
+	}
+}
+
+// Share returns a SharedAlloc which owns the allocation, shared by n holders.
+// onReleased, if non-nil, is called once the allocation has been released. A
+// zero allocation is shared as nil, whose shares are zero allocations.
+func Share(a Alloc, n int, onReleased func(*SharedAlloc)) *SharedAlloc {
+	if a.isZero() {
+		return nil
+	}
+	s := &SharedAlloc{bytes: a.bytes, onReleased: onReleased}
+	s.mu.alloc = a
+	s.mu.released = make([]bool, n)
+	s.mu.held = n
+	return s
+}
+
+// Alloc returns the share of the i-th holder. It has the size of the shared
+// allocation, and releasing it releases the holder's share.
+func (s *SharedAlloc) Alloc(i int) Alloc {
+	if s == nil {
+		return Alloc{}
+	}
+	return Alloc{bytes: s.bytes, entries: 1, ap: sharePool{s: s, i: i}}
+}
+
+// Release releases the share of the i-th holder, unless it has already been
+// released, and releases the allocation once every share has been.
+func (s *SharedAlloc) Release(ctx context.Context, i int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.mu.released[i] {
+		s.mu.Unlock()
+		return
+	}
+	s.mu.released[i] = true
+	s.mu.held--
+	done := s.mu.held == 0
+	s.mu.Unlock()
+	if !done {
+		return
+	}
+	s.mu.alloc.Release(ctx)
+	if s.onReleased != nil {
+		s.onReleased(s)
+	}
+}
+
+// sharePool is the pool of a share of a SharedAlloc.
+type sharePool struct {
+	s *SharedAlloc
+	i int
+}
+
+// Release implements the pool interface. Bytes released on their own, by
+// AdjustBytesToTarget, remain held by the other holders.
+func (p sharePool) Release(ctx context.Context, bytes, entries int64) {
+	if entries == 0 {
+		return
+	}
+	p.s.Release(ctx, p.i)
+}
+
 func (a *Alloc) clear()       { *a = Alloc{} }
 func (a *Alloc) isZero() bool { return a.ap == nil }
 func (a *Alloc) init(bytes int64, p pool) {
@@ -103,6 +103,48 @@ func TestAllocAdjust(t *testing.T) {
 	a.Release(ctx)
 }
 
+func TestSharedAlloc(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	p := &testAllocPool{}
+	var released int
+	s := Share(p.alloc(10), 3, func(*SharedAlloc) { released++ })
+
+	a0, a1 := s.Alloc(0), s.Alloc(1)
+	require.EqualValues(t, 10, a0.Bytes())
+	require.EqualValues(t, 1, a0.Events())
+
+	// Partial releases of a share leave the allocation held.
+	a0.AdjustBytesToTarget(ctx, 4)
+	require.EqualValues(t, 10, p.getN())
+	a0.Release(ctx)
+	require.EqualValues(t, 10, p.getN())
+
+	// Shares merged into other allocations are released along with them.
+	other := p.alloc(5)
+	other.Merge(&a1)
+	other.Release(ctx)
+	require.EqualValues(t, 10, p.getN())
+
+	// Releasing a share more than once has no effect.
+	s.Release(ctx, 0)
+	require.EqualValues(t, 10, p.getN())
+	require.Zero(t, released)
+
+	s.Release(ctx, 2)
+	require.EqualValues(t, 0, p.getN())
+	require.Equal(t, 1, released)
+
+	// Zero allocations are shared as zero allocations.
+	zero := Share(Alloc{}, 2, nil)
+	require.Nil(t, zero)
+	a := zero.Alloc(0)
+	require.EqualValues(t, 0, a.Bytes())
+	zero.Release(ctx, 1)
+}
+
 type testAllocPool struct {
 	syncutil.Mutex
 	n int64
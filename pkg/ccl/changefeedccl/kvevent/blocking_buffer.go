@@ -28,6 +28,7 @@ import (
 type blockingBuffer struct {
 	sv       *settings.Values
 	metrics  *Metrics
+	limit    int64         // Limit of the monitor of the bound account.
 	qp       allocPool     // Pool for memory allocations.
 	signalCh chan struct{} // Signal when new events are available.
 
@@ -78,6 +79,7 @@ func newMemBuffer(
 		signalCh: make(chan struct{}, 1),
 		metrics:  metrics,
 		sv:       sv,
+		limit:    acc.Monitor().Limit(),
 	}
 	b.mu.queue = &bufferEventChunkQueue{}
 
@@ -230,7 +232,9 @@ func (b *blockingBuffer) enqueue(ctx context.Context, e Event) (err error) {
 // AcquireMemory acquires specified number of bytes form the memory monitor,
 // blocking acquisition if needed.
 func (b *blockingBuffer) AcquireMemory(ctx context.Context, n int64) (alloc Alloc, _ error) {
-	if l := changefeedbase.PerChangefeedMemLimit.Get(b.sv); n > l {
+	// The limit of the monitor is the per changefeed limit, which the
+	// changefeed may have overridden.
+	if l := b.limit; n > l {
 		return alloc, errors.Newf("event size %d exceeds per changefeed limit %d", alloc, l)
 	}
 	alloc.init(n, &b.qp)
@@ -141,6 +141,12 @@ func (e *Event) PrevKeyValue() roachpb.KeyValue {
 	return roachpb.KeyValue{Key: v.Key, Value: v.PrevValue}
 }
 
+// RowLevelTTL returns true if this is a KV event written by the row-level
+// TTL job, i.e. the delete of an expired row.
+func (e *Event) RowLevelTTL() bool {
+	return e.ev.Val.RowLevelTTL
+}
+
 func (e *Event) boundaryType() jobspb.ResolvedSpan_BoundaryType {
 	switch e.et {
 	case resolvedNone:
@@ -51,6 +51,12 @@ var (
 		Measurement: "Nanoseconds",
 		Unit:        metric.Unit_NANOSECONDS,
 	}
+	metaChangefeedScanThrottledNanos = metric.Metadata{
+		Name:        "changefeed.scan_throttled_nanos",
+		Help:        "Total time changefeed scans were paused because a store was overloaded",
+		Measurement: "Nanoseconds",
+		Unit:        metric.Unit_NANOSECONDS,
+	}
 )
 
 // Metrics is a metric.Struct for kvfeed metrics.
@@ -61,6 +67,7 @@ type Metrics struct {
 	BufferPushbackNanos      *metric.Counter
 	BufferEntriesMemAcquired *metric.Counter
 	BufferEntriesMemReleased *metric.Counter
+	ScanThrottledNanos       *metric.Counter
 }
 
 // MakeMetrics constructs a Metrics struct with the provided histogram window.
@@ -72,6 +79,7 @@ func MakeMetrics(histogramWindow time.Duration) Metrics {
 		BufferEntriesMemAcquired: metric.NewCounter(metaChangefeedBufferMemAcquired),
 		BufferEntriesMemReleased: metric.NewCounter(metaChangefeedBufferMemReleased),
 		BufferPushbackNanos:      metric.NewCounter(metaChangefeedBufferPushbackNanos),
+		ScanThrottledNanos:       metric.NewCounter(metaChangefeedScanThrottledNanos),
 	}
 }
 
@@ -81,6 +81,8 @@ type Config struct {
 // error when it finishes.
 func Run(ctx context.Context, cfg Config) error {
 
+	distSender := cfg.DB.NonTransactionalSender().(*kv.CrossRangeTxnWrapperSender).Wrapped().(*kvcoord.DistSender)
+	throttle := makeStoreOverloadThrottle(cfg.Gossip, distSender, &cfg.Settings.SV, cfg.Metrics)
 	var sc kvScanner
 	{
 		sc = &scanRequestScanner{
@@ -88,14 +90,10 @@ func Run(ctx context.Context, cfg Config) error {
 			gossip:                  cfg.Gossip,
 			db:                      cfg.DB,
 			onBackfillRangeCallback: cfg.OnBackfillRangeCallback,
+			throttle:                throttle,
 		}
 	}
-	var pff physicalFeedFactory
-	{
-		sender := cfg.DB.NonTransactionalSender()
-		distSender := sender.(*kv.CrossRangeTxnWrapperSender).Wrapped().(*kvcoord.DistSender)
-		pff = rangefeedFactory(distSender.RangeFeedSpans)
-	}
+	pff := rangefeedFactory(distSender.RangeFeedSpans)
 
 	bf := func() kvevent.Buffer {
 		return kvevent.NewMemBuffer(cfg.MM.MakeBoundAccount(), &cfg.Settings.SV, cfg.Metrics)
@@ -110,6 +108,7 @@ func Run(ctx context.Context, cfg Config) error {
 		cfg.SchemaFeed,
 		sc, pff, bf, cfg.UseMux, cfg.Targets, cfg.Knobs)
 	f.onBackfillCallback = cfg.OnBackfillCallback
+	f.throttle = throttle
 
 	g := ctxgroup.WithContext(ctx)
 	g.GoCtx(cfg.SchemaFeed.Run)
@@ -178,6 +177,9 @@ type kvFeed struct {
 	codec               keys.SQLCodec
 
 	onBackfillCallback func() func()
+	// throttle, if set, delays the catch-up scans of rangefeeds while a store
+	// is overloaded.
+	throttle           *storeOverloadThrottle
 	schemaChangeEvents changefeedbase.SchemaChangeEventClass
 	schemaChangePolicy changefeedbase.SchemaChangePolicy
 
@@ -313,8 +315,16 @@ func (f *kvFeed) run(ctx context.Context) (err error) {
 		// should not trigger a failure in the `stop` policy because this change is
 		// effectively invisible to consumers.
 		primaryIndexChange, noColumnChanges := isPrimaryKeyChange(events, f.targets)
-		if primaryIndexChange && (noColumnChanges ||
-			f.schemaChangePolicy != changefeedbase.OptSchemaChangePolicyStop) {
+		// A truncation, which the schema feed only lets through if the
+		// changefeed handles it, replaces the primary index of the table like a
+		// primary key change, so the changefeed restarts to watch the new
+		// primary index whatever the policy. Likewise, a table being taken
+		// offline, or coming back online, which the schema feed only lets
+		// through if the changefeed waits for it, restarts the changefeed, so
+		// that it waits for the table at the boundary, and then re-scans it.
+		if hasTruncate(events) || hasOfflineChange(events) ||
+			(primaryIndexChange && (noColumnChanges ||
+				f.schemaChangePolicy != changefeedbase.OptSchemaChangePolicyStop)) {
 			boundaryType = jobspb.ResolvedSpan_RESTART
 		} else if f.schemaChangePolicy == changefeedbase.OptSchemaChangePolicyStop {
 			boundaryType = jobspb.ResolvedSpan_EXIT
@@ -348,6 +358,24 @@ func isPrimaryKeyChange(
 	return isPrimaryIndexChange, isPrimaryIndexChange && hasNoColumnChanges
 }
 
+func hasTruncate(events []schemafeed.TableEvent) bool {
+	for _, ev := range events {
+		if schemafeed.IsTruncate(ev) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOfflineChange(events []schemafeed.TableEvent) bool {
+	for _, ev := range events {
+		if schemafeed.IsOffline(ev) || schemafeed.IsBackOnline(ev) {
+			return true
+		}
+	}
+	return false
+}
+
 // filterCheckpointSpans filters spans which have already been completed,
 // and returns the list of spans that still need to be done.
 func filterCheckpointSpans(spans []roachpb.Span, completed []roachpb.Span) []roachpb.Span {
@@ -372,6 +400,7 @@ func (f *kvFeed) scanIfShould(
 	// updates after that timestamp.
 	isInitialScan := initialScan && f.withInitialBackfill
 	var spansToScan []roachpb.Span
+	var rescan bool
 	if isInitialScan {
 		scanTime = highWater
 		spansToScan = f.spans
@@ -390,6 +419,16 @@ func (f *kvFeed) scanIfShould(
 			if schemafeed.IsOnlyPrimaryIndexChange(ev) {
 				continue
 			}
+			// The rows of an offline table can't be read. Those of a table which
+			// comes back online, which may have been bulk ingested while it was
+			// offline, are scanned as it comes back instead.
+			if schemafeed.IsOffline(ev) {
+				continue
+			}
+			// The new primary index of a truncated table is scanned as of the
+			// truncation, as the changefeed restarts at it, whatever the policy,
+			// as is a table which comes back online.
+			rescan = rescan || schemafeed.IsTruncate(ev) || schemafeed.IsBackOnline(ev)
 			tablePrefix := f.codec.TablePrefix(uint32(ev.After.GetID()))
 			tableSpan := roachpb.Span{Key: tablePrefix, EndKey: tablePrefix.PrefixEnd()}
 			for _, sp := range f.spans {
@@ -416,7 +455,8 @@ func (f *kvFeed) scanIfShould(
 	// spans which we no longer need to scan.
 	spansToBackfill := filterCheckpointSpans(spansToScan, f.checkpoint)
 
-	if (!isInitialScan && f.schemaChangePolicy == changefeedbase.OptSchemaChangePolicyNoBackfill) ||
+	if (!isInitialScan && !rescan &&
+		f.schemaChangePolicy == changefeedbase.OptSchemaChangePolicyNoBackfill) ||
 		len(spansToBackfill) == 0 {
 		return spansToScan, scanTime, nil
 	}
@@ -488,6 +528,10 @@ func (f *kvFeed) runUntilTableEvent(
 		return copyFromSourceToDestUntilTableEvent(ctx, f.writer, memBuf, resumeFrontier, f.tableFeed, f.endTime, f.knobs)
 	})
 	g.GoCtx(func(ctx context.Context) error {
+		// Starting the rangefeeds performs a catch-up scan from the frontier.
+		if err := f.throttle.Wait(ctx, f.spans...); err != nil {
+			return err
+		}
 		return f.physicalFeed.Run(ctx, memBuf, physicalCfg)
 	})
 
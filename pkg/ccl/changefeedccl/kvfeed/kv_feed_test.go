@@ -158,7 +158,7 @@ func TestKVFeed(t *testing.T) {
 			return nil
 		})
 		// Wait for the feed to fail rather than canceling it.
-		if tc.schemaChangePolicy == changefeedbase.OptSchemaChangePolicyStop {
+		if tc.expErrRE != "" {
 			testG.Go(func() error {
 				_ = g.Wait()
 				return nil
@@ -314,6 +314,34 @@ func TestKVFeed(t *testing.T) {
 			expEvents: 2,
 			expErrRE:  "schema change ...",
 		},
+		{
+			name:               "truncate - restart",
+			schemaChangeEvents: changefeedbase.OptSchemaChangeEventClassDefault,
+			schemaChangePolicy: changefeedbase.OptSchemaChangePolicyBackfill,
+			needsInitialScan:   true,
+			initialHighWater:   ts(2),
+			spans: []roachpb.Span{
+				tableSpan(codec, 42),
+			},
+			events: []kvpb.RangeFeedEvent{
+				kvEvent(codec, 42, "a", "b", ts(3)),
+				checkpointEvent(tableSpan(codec, 42), ts(4)),
+				kvEvent(codec, 42, "a", "b", ts(5)),
+				checkpointEvent(tableSpan(codec, 42), ts(2)), // ensure that events are filtered
+				checkpointEvent(tableSpan(codec, 42), ts(5)),
+			},
+			// The truncated table isn't backfilled over its old primary index,
+			// but the feed restarts to watch its new one.
+			expScans: []hlc.Timestamp{
+				ts(2),
+			},
+			descs: []catalog.TableDescriptor{
+				makeTableDesc(42, 1, ts(1), 2, 1),
+				makeTableDesc(42, 2, ts(4), 2, 2),
+			},
+			expEvents: 2,
+			expErrRE:  "schema change ...",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			runTest(t, tc)
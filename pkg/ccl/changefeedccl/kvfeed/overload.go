@@ -0,0 +1,199 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package kvfeed
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/gossip"
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvclient/kvcoord"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/retry"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+const (
+	// storeScoresRefreshInterval is how often the overload scores gossiped by
+	// the stores are decoded anew.
+	storeScoresRefreshInterval = time.Second
+	// maxStoreOverloadWait bounds the time a scan waits for the stores it
+	// reads from to recover, so that a store which stays overloaded delays
+	// the changefeed rather than stalling it.
+	maxStoreOverloadWait = 5 * time.Minute
+)
+
+// storeOverloadThrottle pauses scans while a store holding the spans they read
+// is overloaded, so that backfills and catch-up scans do not add read load to
+// an LSM which is already unhealthy.
+type storeOverloadThrottle struct {
+	sv      *settings.Values
+	metrics *kvevent.Metrics
+	// scores returns the IO overload score of each store of the cluster.
+	scores func() map[roachpb.StoreID]float64
+	// storesOf returns the stores holding replicas of the spans.
+	storesOf func(ctx context.Context, spans []roachpb.Span) (map[roachpb.StoreID]struct{}, error)
+	// refreshInterval is how long the result of scores is cached for, and
+	// maxWait bounds the time Wait blocks for.
+	refreshInterval, maxWait time.Duration
+
+	mu struct {
+		syncutil.Mutex
+		scores    map[roachpb.StoreID]float64
+		refreshed time.Time
+	}
+}
+
+var logThrottleEvery = log.Every(time.Minute)
+
+func makeStoreOverloadThrottle(
+	gw gossip.OptionalGossip, ds *kvcoord.DistSender, sv *settings.Values, metrics *kvevent.Metrics,
+) *storeOverloadThrottle {
+	return &storeOverloadThrottle{
+		sv:      sv,
+		metrics: metrics,
+		scores: func() map[roachpb.StoreID]float64 {
+			return storeOverloadScores(gw)
+		},
+		storesOf: func(ctx context.Context, spans []roachpb.Span) (map[roachpb.StoreID]struct{}, error) {
+			return replicaStores(ctx, ds, spans)
+		},
+		refreshInterval: storeScoresRefreshInterval,
+		maxWait:         maxStoreOverloadWait,
+	}
+}
+
+// Wait blocks while a store holding replicas of the spans has an IO overload
+// score above the changefeed.backfill.store_overload_threshold setting, for
+// at most maxWait. The time spent waiting is added to the ScanThrottledNanos
+// metric.
+func (t *storeOverloadThrottle) Wait(ctx context.Context, spans ...roachpb.Span) error {
+	if t == nil {
+		return nil
+	}
+	// The replicas of the spans are only looked up if some store of the
+	// cluster is overloaded.
+	if !t.overloaded(nil /* stores */) {
+		return nil
+	}
+	stores, err := t.storesOf(ctx, spans)
+	if err != nil {
+		log.Warningf(ctx, "could not determine the stores of the spans of a changefeed scan: %v", err)
+		stores = nil
+	}
+	if !t.overloaded(stores) {
+		return nil
+	}
+	start := timeutil.Now()
+	defer func() {
+		if t.metrics != nil {
+			t.metrics.ScanThrottledNanos.Inc(timeutil.Since(start).Nanoseconds())
+		}
+	}()
+	opts := retry.Options{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second}
+	for r := retry.StartWithCtx(ctx, opts); r.Next(); {
+		if !t.overloaded(stores) {
+			return nil
+		}
+		if waited := timeutil.Since(start); waited >= t.maxWait {
+			log.Warningf(ctx, "resuming changefeed scan after pausing it for %s, "+
+				"though its stores remain overloaded", waited)
+			return nil
+		}
+		if logThrottleEvery.ShouldLog() {
+			log.Infof(ctx, "pausing changefeed scan while the store overload score is %.2f",
+				t.maxScore(stores))
+		}
+	}
+	return ctx.Err()
+}
+
+// overloaded returns whether any of the stores, or of all of the stores of the
+// cluster if stores is nil, has an overload score above the threshold.
+func (t *storeOverloadThrottle) overloaded(stores map[roachpb.StoreID]struct{}) bool {
+	threshold := changefeedbase.ScanStoreOverloadThreshold.Get(t.sv)
+	return threshold > 0 && t.maxScore(stores) > threshold
+}
+
+// maxScore returns the highest overload score of the stores, or of all of the
+// stores of the cluster if stores is nil.
+func (t *storeOverloadThrottle) maxScore(stores map[roachpb.StoreID]struct{}) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mu.scores == nil || timeutil.Since(t.mu.refreshed) >= t.refreshInterval {
+		t.mu.scores = t.scores()
+		t.mu.refreshed = timeutil.Now()
+	}
+	var max float64
+	for storeID, score := range t.mu.scores {
+		if _, ok := stores[storeID]; (ok || stores == nil) && score > max {
+			max = score
+		}
+	}
+	return max
+}
+
+// storeOverloadScores returns the IO overload score, as computed by IO
+// admission control, gossiped by each store of the cluster. It returns no
+// scores where gossip is unavailable, as in tenants.
+func storeOverloadScores(gw gossip.OptionalGossip) map[roachpb.StoreID]float64 {
+	scores := make(map[roachpb.StoreID]float64)
+	g, err := gw.OptionalErr(47971)
+	if err != nil {
+		return scores
+	}
+	_ = g.IterateInfos(gossip.KeyStoreDescPrefix, func(_ string, i gossip.Info) error {
+		// A descriptor which can't be read carries no overload signal.
+		bytes, err := i.Value.GetBytes()
+		if err != nil {
+			return nil //nolint:returnerrcheck
+		}
+		var desc roachpb.StoreDescriptor
+		if err := protoutil.Unmarshal(bytes, &desc); err != nil {
+			return nil //nolint:returnerrcheck
+		}
+		scores[desc.StoreID], _ = desc.Capacity.IOThreshold.Score()
+		return nil
+	})
+	return scores
+}
+
+// replicaStores returns the stores holding replicas of the ranges of the
+// spans, as known to the range cache of the DistSender.
+func replicaStores(
+	ctx context.Context, ds *kvcoord.DistSender, spans []roachpb.Span,
+) (map[roachpb.StoreID]struct{}, error) {
+	stores := make(map[roachpb.StoreID]struct{})
+	it := kvcoord.MakeRangeIterator(ds)
+	for _, sp := range spans {
+		rSpan, err := keys.SpanAddr(sp)
+		if err != nil {
+			return nil, err
+		}
+		for it.Seek(ctx, rSpan.Key, kvcoord.Ascending); ; it.Next(ctx) {
+			if !it.Valid() {
+				return nil, it.Error()
+			}
+			for _, r := range it.Desc().Replicas().Descriptors() {
+				stores[r.StoreID] = struct{}{}
+			}
+			if !it.NeedAnother(rSpan) {
+				break
+			}
+		}
+	}
+	return stores, nil
+}
@@ -97,6 +97,9 @@ func (p *rangefeed) addEventsToBuffer(ctx context.Context) error {
 						return err
 					}
 				}
+				if p.knobs.ShouldDropValue != nil && p.knobs.ShouldDropValue(t) {
+					continue
+				}
 				if p.knobs.ModifyTimestamps != nil {
 					e = kvcoord.RangeFeedMessage{RangeFeedEvent: e.ShallowCopy(), RegisteredSpan: e.RegisteredSpan}
 					p.knobs.ModifyTimestamps(&e.Val.Value.Timestamp)
@@ -55,6 +55,8 @@ type scanRequestScanner struct {
 	gossip                  gossip.OptionalGossip
 	db                      *kv.DB
 	onBackfillRangeCallback func(int64) (func(), func())
+	// throttle, if set, pauses scans while a store is overloaded.
+	throttle *storeOverloadThrottle
 }
 
 var _ kvScanner = (*scanRequestScanner)(nil)
@@ -187,6 +189,9 @@ func (p *scanRequestScanner) exportSpan(
 	var scanDuration, bufferDuration time.Duration
 	targetBytesPerScan := changefeedbase.ScanRequestSize.Get(&p.settings.SV)
 	for remaining := &span; remaining != nil; {
+		if err := p.throttle.Wait(ctx, *remaining); err != nil {
+			return err
+		}
 		start := timeutil.Now()
 		b := txn.NewBatch()
 		r := kvpb.NewScan(remaining.Key, remaining.EndKey, false /* forUpdate */).(*kvpb.ScanRequest)
@@ -11,14 +11,17 @@ package kvfeed
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/desctestutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
@@ -113,3 +116,55 @@ INSERT INTO t VALUES (1), (2), (3);
 	require.Equal(t, span, sink.resolved[2].Span)
 	require.Equal(t, exportTime, sink.resolved[2].Timestamp)
 }
+
+func TestStoreOverloadThrottle(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	metrics := kvevent.MakeMetrics(time.Minute)
+	changefeedbase.ScanStoreOverloadThreshold.Override(ctx, &st.SV, 1)
+	// Store 1 holds the spans being scanned, store 2 doesn't.
+	scores := []float64{2, 2, 2, 1.5, 0.5}
+	otherScore := 5.0
+	throttle := &storeOverloadThrottle{
+		sv:      &st.SV,
+		metrics: &metrics,
+		scores: func() map[roachpb.StoreID]float64 {
+			s := scores[0]
+			if len(scores) > 1 {
+				scores = scores[1:]
+			}
+			return map[roachpb.StoreID]float64{1: s, 2: otherScore}
+		},
+		storesOf: func(context.Context, []roachpb.Span) (map[roachpb.StoreID]struct{}, error) {
+			return map[roachpb.StoreID]struct{}{1: {}}, nil
+		},
+		maxWait: time.Hour,
+	}
+
+	// Scans wait until the score of their stores drops below the threshold.
+	require.NoError(t, throttle.Wait(ctx))
+	require.Equal(t, []float64{0.5}, scores)
+	throttled := metrics.ScanThrottledNanos.Count()
+	require.Greater(t, throttled, int64(0))
+
+	// They don't wait when their stores are healthy, even if another store is
+	// overloaded, or when throttling is disabled.
+	require.NoError(t, throttle.Wait(ctx))
+	scores = []float64{5}
+	changefeedbase.ScanStoreOverloadThreshold.Override(ctx, &st.SV, 0)
+	require.NoError(t, throttle.Wait(ctx))
+	require.Equal(t, throttled, metrics.ScanThrottledNanos.Count())
+
+	// They wait for at most maxWait.
+	changefeedbase.ScanStoreOverloadThreshold.Override(ctx, &st.SV, 1)
+	throttle.maxWait = time.Millisecond
+	require.NoError(t, throttle.Wait(ctx))
+	require.Greater(t, metrics.ScanThrottledNanos.Count(), throttled)
+
+	// A nil throttle never waits.
+	var nilThrottle *storeOverloadThrottle
+	require.NoError(t, nilThrottle.Wait(ctx))
+}
@@ -21,6 +21,9 @@ type TestingKnobs struct {
 	BeforeScanRequest func(b *kv.Batch) error
 	// OnRangeFeedValue invoked when rangefeed receives a value.
 	OnRangeFeedValue func() error
+	// ShouldDropValue invoked when rangefeed receives a value. Returns true
+	// if the value should be dropped, as if it had been lost.
+	ShouldDropValue func(*kvpb.RangeFeedValue) bool
 	// ShouldSkipCheckpoint invoked when rangefed receives a checkpoint.
 	// Returns true if checkpoint should be skipped.
 	ShouldSkipCheckpoint func(*kvpb.RangeFeedCheckpoint) bool
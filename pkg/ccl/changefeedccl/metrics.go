@@ -63,11 +63,30 @@ type AggMetrics struct {
 	RunningCount              *aggmetric.AggGauge
 	BatchReductionCount       *aggmetric.AggGauge
 	InternalRetryMessageCount *aggmetric.AggGauge
+	KafkaThrottlingNanos      *aggmetric.AggHistogram
+	CredentialReloads         *aggmetric.AggCounter
+	DuplicateMessages         *aggmetric.AggCounter
+	CheckpointedEmittedBytes  *aggmetric.AggCounter
+
+	// Metrics broken down by the host of the downstream sink, rather than by
+	// scope.
+	SinkHostEmittedBytes    *aggmetric.AggCounter
+	SinkHostEmittedMessages *aggmetric.AggCounter
+	SinkHostErrors          *aggmetric.AggCounter
+	SinkHostLatency         *aggmetric.AggHistogram
+
+	// Metrics broken down by the table the messages were emitted for, within
+	// each scope.
+	TableEmittedMessages   *aggmetric.AggCounter
+	TableEmittedBytes      *aggmetric.AggCounter
+	TableDuplicateMessages *aggmetric.AggCounter
 
 	// There is always at least 1 sliMetrics created for defaultSLI scope.
 	mu struct {
 		syncutil.Mutex
 		sliMetrics map[string]*sliMetrics
+		sinkHosts  map[string]*sinkHostMetrics
+		tables     map[tableMetricsKey]*tableMetrics
 	}
 }
 
@@ -90,6 +109,9 @@ type metricsRecorder interface {
 	getBackfillCallback() func() func()
 	getBackfillRangeCallback() func(int64) (func(), func())
 	recordSizeBasedFlush()
+	recordSinkHostIO(host string, startTime time.Time, numMessages int, bytes int, err error)
+	recordKafkaThrottle(throttleTime time.Duration)
+	recordCredentialReload()
 }
 
 var _ metricsRecorder = (*sliMetrics)(nil)
@@ -117,6 +139,35 @@ type sliMetrics struct {
 	RunningCount              *aggmetric.Gauge
 	BatchReductionCount       *aggmetric.Gauge
 	InternalRetryMessageCount *aggmetric.Gauge
+	KafkaThrottlingNanos      *aggmetric.Histogram
+	CredentialReloads         *aggmetric.Counter
+	DuplicateMessages         *aggmetric.Counter
+	CheckpointedEmittedBytes  *aggmetric.Counter
+
+	scope string
+	agg   *AggMetrics
+}
+
+// sinkHostMetrics holds metrics about the I/O performed against a single
+// downstream host, such as a kafka broker or a webhook endpoint.
+type sinkHostMetrics struct {
+	EmittedBytes    *aggmetric.Counter
+	EmittedMessages *aggmetric.Counter
+	Errors          *aggmetric.Counter
+	Latency         *aggmetric.Histogram
+}
+
+// tableMetricsKey identifies the tableMetrics of a table within a scope.
+type tableMetricsKey struct {
+	scope string
+	table string
+}
+
+// tableMetrics holds metrics about the messages emitted for a single table.
+type tableMetrics struct {
+	EmittedMessages   *aggmetric.Counter
+	EmittedBytes      *aggmetric.Counter
+	DuplicateMessages *aggmetric.Counter
 }
 
 // sinkDoesNotCompress is a sentinel value indicating the sink
@@ -240,6 +291,72 @@ func (m *sliMetrics) recordSizeBasedFlush() {
 	m.SizeBasedFlushes.Inc(1)
 }
 
+// recordSinkHostIO records the outcome of a single request sent to the
+// specified sink host, which was started at startTime and carried numMessages
+// messages.
+func (m *sliMetrics) recordSinkHostIO(
+	host string, startTime time.Time, numMessages int, bytes int, err error,
+) {
+	if m == nil || m.agg == nil {
+		return
+	}
+
+	hm := m.agg.getOrCreateSinkHost(host)
+	if err != nil {
+		hm.Errors.Inc(1)
+		return
+	}
+	hm.EmittedMessages.Inc(int64(numMessages))
+	hm.EmittedBytes.Inc(int64(bytes))
+	hm.Latency.RecordValue(timeutil.Since(startTime).Nanoseconds())
+}
+
+// recordKafkaThrottle records the time for which a kafka broker throttled a
+// produce request due to a quota being exceeded.
+func (m *sliMetrics) recordKafkaThrottle(throttleTime time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.KafkaThrottlingNanos.RecordValue(throttleTime.Nanoseconds())
+}
+
+// recordCredentialReload records that a sink reloaded rotated credentials.
+func (m *sliMetrics) recordCredentialReload() {
+	if m == nil {
+		return
+	}
+
+	m.CredentialReloads.Inc(1)
+}
+
+// getTableMetrics returns the metrics of the table with the specified label
+// within the scope. Callers cache them, since they're kept in a map shared by
+// every changefeed.
+func (m *sliMetrics) getTableMetrics(table string) *tableMetrics {
+	if m == nil || m.agg == nil {
+		return nil
+	}
+	return m.agg.getOrCreateTable(m.scope, table)
+}
+
+// recordTableEmitted records in tm, the metrics of a table returned by
+// getTableMetrics, a message of the specified size emitted for the table,
+// which is a duplicate if it had already been emitted before the changefeed
+// restarted.
+func (m *sliMetrics) recordTableEmitted(tm *tableMetrics, bytes int, duplicate bool) {
+	if m == nil || tm == nil {
+		return
+	}
+
+	tm.EmittedMessages.Inc(1)
+	tm.EmittedBytes.Inc(int64(bytes))
+	if duplicate {
+		m.DuplicateMessages.Inc(1)
+		tm.DuplicateMessages.Inc(1)
+	}
+}
+
 type wrappingCostController struct {
 	ctx      context.Context
 	inner    metricsRecorder
@@ -310,6 +427,20 @@ func (w *wrappingCostController) recordSizeBasedFlush() {
 	w.inner.recordSizeBasedFlush()
 }
 
+func (w *wrappingCostController) recordSinkHostIO(
+	host string, startTime time.Time, numMessages int, bytes int, err error,
+) {
+	w.inner.recordSinkHostIO(host, startTime, numMessages, bytes, err)
+}
+
+func (w *wrappingCostController) recordKafkaThrottle(throttleTime time.Duration) {
+	w.inner.recordKafkaThrottle(throttleTime)
+}
+
+func (w *wrappingCostController) recordCredentialReload() {
+	w.inner.recordCredentialReload()
+}
+
 var (
 	metaChangefeedForwardedResolvedMessages = metric.Metadata{
 		Name:        "changefeed.forwarded_resolved_messages",
@@ -368,6 +499,24 @@ var (
 		Measurement: "Replans",
 		Unit:        metric.Unit_COUNT,
 	}
+	metaChangefeedAdmittedFlows = metric.Metadata{
+		Name:        "changefeed.admission.admitted",
+		Help:        "Number of changefeed aggregators admitted to run on this node",
+		Measurement: "Changefeeds",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaChangefeedPendingFlows = metric.Metadata{
+		Name:        "changefeed.admission.pending",
+		Help:        "Number of changefeed aggregators waiting for admission on this node",
+		Measurement: "Changefeeds",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaChangefeedPooledSinkClients = metric.Metadata{
+		Name:        "changefeed.sink_client_pool.clients",
+		Help:        "Number of sink clients shared by the changefeeds running on this node",
+		Measurement: "Clients",
+		Unit:        metric.Unit_COUNT,
+	}
 	metaChangefeedEventConsumerFlushNanos = metric.Metadata{
 		Name:        "changefeed.nprocs_flush_nanos",
 		Help:        "Total time spent idle waiting for the parallel consumer to flush",
@@ -494,6 +643,73 @@ func newAggregateMetrics(histogramWindow time.Duration) *AggMetrics {
 		Measurement: "Messages",
 		Unit:        metric.Unit_COUNT,
 	}
+	metaKafkaThrottlingNanos := metric.Metadata{
+		Name:        "changefeed.kafka_throttling_hist_nanos",
+		Help:        "Time for which kafka brokers throttled produce requests due to exceeded quotas",
+		Measurement: "Nanoseconds",
+		Unit:        metric.Unit_NANOSECONDS,
+	}
+	metaCredentialReloads := metric.Metadata{
+		Name:        "changefeed.sink_credentials.reloads",
+		Help:        "Number of times sinks reloaded credentials rotated in the external connection holding their URI",
+		Measurement: "Reloads",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaDuplicateMessages := metric.Metadata{
+		Name:        "changefeed.duplicate_messages",
+		Help:        "Messages re-emitted by all feeds after restarting, which had already been emitted before",
+		Measurement: "Messages",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaCheckpointedEmittedBytes := metric.Metadata{
+		Name: "changefeed.checkpointed_emitted_bytes",
+		Help: "Bytes emitted by all feeds, counted once recorded in the progress of their jobs; " +
+			"matches the emitted_bytes of SHOW CHANGEFEED JOBS, for the chargeback of egress",
+		Measurement: "Bytes",
+		Unit:        metric.Unit_BYTES,
+	}
+	metaSinkHostEmittedBytes := metric.Metadata{
+		Name:        "changefeed.sink_host.emitted_bytes",
+		Help:        "Bytes acknowledged by each downstream sink host",
+		Measurement: "Bytes",
+		Unit:        metric.Unit_BYTES,
+	}
+	metaSinkHostEmittedMessages := metric.Metadata{
+		Name:        "changefeed.sink_host.emitted_messages",
+		Help:        "Messages acknowledged by each downstream sink host",
+		Measurement: "Messages",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaSinkHostErrors := metric.Metadata{
+		Name:        "changefeed.sink_host.errors",
+		Help:        "Requests to each downstream sink host which failed",
+		Measurement: "Errors",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaSinkHostLatency := metric.Metadata{
+		Name:        "changefeed.sink_host.latency",
+		Help:        "Time between a request being sent to a downstream sink host and its acknowledgement",
+		Measurement: "Nanoseconds",
+		Unit:        metric.Unit_NANOSECONDS,
+	}
+	metaTableEmittedMessages := metric.Metadata{
+		Name:        "changefeed.table.emitted_messages",
+		Help:        "Messages emitted by all feeds for each watched table",
+		Measurement: "Messages",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaTableEmittedBytes := metric.Metadata{
+		Name:        "changefeed.table.emitted_bytes",
+		Help:        "Bytes emitted by all feeds for each watched table",
+		Measurement: "Bytes",
+		Unit:        metric.Unit_BYTES,
+	}
+	metaTableDuplicateMessages := metric.Metadata{
+		Name:        "changefeed.table.duplicate_messages",
+		Help:        "Messages re-emitted by all feeds for each watched table after restarting",
+		Measurement: "Messages",
+		Unit:        metric.Unit_COUNT,
+	}
 	// NB: When adding new histograms, use sigFigs = 1.  Older histograms
 	// retain significant figures of 2.
 	b := aggmetric.MakeBuilder("scope")
@@ -546,8 +762,35 @@ func newAggregateMetrics(histogramWindow time.Duration) *AggMetrics {
 		RunningCount:              b.Gauge(metaChangefeedRunning),
 		BatchReductionCount:       b.Gauge(metaBatchReductionCount),
 		InternalRetryMessageCount: b.Gauge(metaInternalRetryMessageCount),
+		KafkaThrottlingNanos: b.Histogram(metric.HistogramOptions{
+			Metadata: metaKafkaThrottlingNanos,
+			Duration: histogramWindow,
+			MaxVal:   changefeedBatchHistMaxLatency.Nanoseconds(),
+			SigFigs:  1,
+			Buckets:  metric.IOLatencyBuckets,
+		}),
+		CredentialReloads:        b.Counter(metaCredentialReloads),
+		DuplicateMessages:        b.Counter(metaDuplicateMessages),
+		CheckpointedEmittedBytes: b.Counter(metaCheckpointedEmittedBytes),
 	}
+	hb := aggmetric.MakeBuilder("host")
+	a.SinkHostEmittedBytes = hb.Counter(metaSinkHostEmittedBytes)
+	a.SinkHostEmittedMessages = hb.Counter(metaSinkHostEmittedMessages)
+	a.SinkHostErrors = hb.Counter(metaSinkHostErrors)
+	a.SinkHostLatency = hb.Histogram(metric.HistogramOptions{
+		Metadata: metaSinkHostLatency,
+		Duration: histogramWindow,
+		MaxVal:   changefeedBatchHistMaxLatency.Nanoseconds(),
+		SigFigs:  1,
+		Buckets:  metric.IOLatencyBuckets,
+	})
+	tb := aggmetric.MakeBuilder("scope", "table")
+	a.TableEmittedMessages = tb.Counter(metaTableEmittedMessages)
+	a.TableEmittedBytes = tb.Counter(metaTableEmittedBytes)
+	a.TableDuplicateMessages = tb.Counter(metaTableDuplicateMessages)
 	a.mu.sliMetrics = make(map[string]*sliMetrics)
+	a.mu.sinkHosts = make(map[string]*sinkHostMetrics)
+	a.mu.tables = make(map[tableMetricsKey]*tableMetrics)
 	_, err := a.getOrCreateScope(defaultSLIScope)
 	if err != nil {
 		// defaultSLIScope must always exist.
@@ -601,12 +844,82 @@ func (a *AggMetrics) getOrCreateScope(scope string) (*sliMetrics, error) {
 		RunningCount:              a.RunningCount.AddChild(scope),
 		BatchReductionCount:       a.BatchReductionCount.AddChild(scope),
 		InternalRetryMessageCount: a.InternalRetryMessageCount.AddChild(scope),
+		KafkaThrottlingNanos:      a.KafkaThrottlingNanos.AddChild(scope),
+		CredentialReloads:         a.CredentialReloads.AddChild(scope),
+		DuplicateMessages:         a.DuplicateMessages.AddChild(scope),
+		CheckpointedEmittedBytes:  a.CheckpointedEmittedBytes.AddChild(scope),
+		scope:                     scope,
+		agg:                       a,
 	}
 
 	a.mu.sliMetrics[scope] = sm
 	return sm, nil
 }
 
+// maxSinkHosts bounds the number of distinct sink hosts for which metrics are
+// kept; I/O to any additional hosts is attributed to otherSinkHost.
+const maxSinkHosts = 1024
+
+const otherSinkHost = "other"
+
+// getOrCreateSinkHost returns the sinkHostMetrics for the specified host.
+func (a *AggMetrics) getOrCreateSinkHost(host string) *sinkHostMetrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if hm, ok := a.mu.sinkHosts[host]; ok {
+		return hm
+	}
+	if len(a.mu.sinkHosts) >= maxSinkHosts {
+		host = otherSinkHost
+		if hm, ok := a.mu.sinkHosts[host]; ok {
+			return hm
+		}
+	}
+
+	hm := &sinkHostMetrics{
+		EmittedBytes:    a.SinkHostEmittedBytes.AddChild(host),
+		EmittedMessages: a.SinkHostEmittedMessages.AddChild(host),
+		Errors:          a.SinkHostErrors.AddChild(host),
+		Latency:         a.SinkHostLatency.AddChild(host),
+	}
+	a.mu.sinkHosts[host] = hm
+	return hm
+}
+
+// maxTables bounds the number of distinct tables, across all scopes, for
+// which metrics are kept; messages emitted for any additional tables are
+// attributed to otherTable in their scope.
+const maxTables = 1024
+
+const otherTable = "other"
+
+// getOrCreateTable returns the tableMetrics for the specified table within
+// the specified scope.
+func (a *AggMetrics) getOrCreateTable(scope, table string) *tableMetrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := tableMetricsKey{scope: scope, table: table}
+	if tm, ok := a.mu.tables[key]; ok {
+		return tm
+	}
+	if len(a.mu.tables) >= maxTables {
+		key.table = otherTable
+		if tm, ok := a.mu.tables[key]; ok {
+			return tm
+		}
+	}
+
+	tm := &tableMetrics{
+		EmittedMessages:   a.TableEmittedMessages.AddChild(key.scope, key.table),
+		EmittedBytes:      a.TableEmittedBytes.AddChild(key.scope, key.table),
+		DuplicateMessages: a.TableDuplicateMessages.AddChild(key.scope, key.table),
+	}
+	a.mu.tables[key] = tm
+	return tm
+}
+
 // Metrics are for production monitoring of changefeeds.
 type Metrics struct {
 	AggMetrics                     *AggMetrics
@@ -622,6 +935,18 @@ type Metrics struct {
 	ParallelConsumerFlushNanos     metric.IHistogram
 	ParallelConsumerConsumeNanos   metric.IHistogram
 	ParallelConsumerInFlightEvents *metric.Gauge
+	AdmittedFlows                  *metric.Gauge
+	PendingFlows                   *metric.Gauge
+	PooledSinkClients              *metric.Gauge
+
+	// admission admits the aggregators which run on this node, and
+	// clusterAdmission counts the changefeeds running in the cluster for the
+	// changefeeds of this node waiting for admission.
+	admission        *flowAdmission
+	clusterAdmission clusterAdmission
+	// sinkClients holds the clients shared by the sinks of the changefeeds
+	// which run on this node.
+	sinkClients *sinkClientPool
 
 	mu struct {
 		syncutil.Mutex
@@ -673,7 +998,12 @@ func MakeMetrics(histogramWindow time.Duration) metric.Struct {
 			Mode:     metric.HistogramModePrometheus,
 		}),
 		ParallelConsumerInFlightEvents: metric.NewGauge(metaChangefeedEventConsumerInFlightEvents),
+		AdmittedFlows:                  metric.NewGauge(metaChangefeedAdmittedFlows),
+		PendingFlows:                   metric.NewGauge(metaChangefeedPendingFlows),
+		PooledSinkClients:              metric.NewGauge(metaChangefeedPooledSinkClients),
 	}
+	m.admission = newFlowAdmission(m.AdmittedFlows, m.PendingFlows)
+	m.sinkClients = newSinkClientPool(m.PooledSinkClients)
 
 	m.mu.resolved = make(map[int]hlc.Timestamp)
 	m.mu.id = 1 // start the first id at 1 so we can detect initialization
@@ -0,0 +1,168 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/cockroachdb/cockroach/pkg/util/json"
+	"github.com/cockroachdb/errors"
+)
+
+// This file implements the subset of the MessagePack specification
+// (https://github.com/msgpack/msgpack/blob/master/spec.md) needed to transcode
+// JSON documents, which is what format=msgpack emits. The encoding of a given
+// document is deterministic, which consumers may rely upon:
+//
+//   - Map keys are written in ascending byte order, in maps at every depth.
+//     This is the order of the keys of the same message in format=json.
+//   - Integers are written in the shortest encoding which holds them:
+//     non-negative integers as unsigned, negative integers as signed.
+//   - Other numbers are written as 64-bit floats.
+//   - Strings, arrays and maps are written with the shortest header which
+//     holds their length.
+
+// appendMsgpackJSON appends the MessagePack encoding of j to buf.
+func appendMsgpackJSON(buf []byte, j json.JSON) ([]byte, error) {
+	switch j.Type() {
+	case json.NullJSONType:
+		return appendMsgpackNil(buf), nil
+	case json.TrueJSONType:
+		return appendMsgpackBool(buf, true), nil
+	case json.FalseJSONType:
+		return appendMsgpackBool(buf, false), nil
+	case json.StringJSONType:
+		s, err := j.AsText()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackString(buf, *s), nil
+	case json.NumberJSONType:
+		d, ok := j.AsDecimal()
+		if !ok {
+			return nil, errors.AssertionFailedf("could not convert %s to a number", j)
+		}
+		if i, err := d.Int64(); err == nil {
+			return appendMsgpackInt(buf, i), nil
+		}
+		f, err := d.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackFloat(buf, f), nil
+	case json.ArrayJSONType:
+		n := j.Len()
+		buf = appendMsgpackArrayHeader(buf, n)
+		for i := 0; i < n; i++ {
+			elem, err := j.FetchValIdx(i)
+			if err != nil {
+				return nil, err
+			}
+			if buf, err = appendMsgpackJSON(buf, elem); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case json.ObjectJSONType:
+		it, err := j.ObjectIter()
+		if err != nil {
+			return nil, err
+		}
+		buf = appendMsgpackMapHeader(buf, j.Len())
+		for it.Next() {
+			buf = appendMsgpackString(buf, it.Key())
+			if buf, err = appendMsgpackJSON(buf, it.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, errors.AssertionFailedf("unknown JSON type %s", j.Type())
+	}
+}
+
+func appendMsgpackNil(buf []byte) []byte {
+	return append(buf, 0xc0)
+}
+
+func appendMsgpackBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 0xc3)
+	}
+	return append(buf, 0xc2)
+}
+
+func appendMsgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		// positive fixint
+		return append(buf, byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		return append(buf, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(i))
+	case i >= 0 && i <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(i))
+	case i >= 0:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), uint64(i))
+	case i >= -32:
+		// negative fixint
+		return append(buf, byte(i))
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(i))
+	}
+}
+
+func appendMsgpackFloat(buf []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(f))
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+	return append(buf, s...)
+}
+
+func appendMsgpackArrayHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, 0xdf), uint32(n))
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"encoding/hex"
+	gojson "encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/json"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// msgpackKV is an entry of a decoded MessagePack map; maps are decoded as
+// slices of entries so that the order of their keys can be checked.
+type msgpackKV struct {
+	key   string
+	value interface{}
+}
+
+// decodeMsgpack decodes a single value, which must consume all of b, with
+// github.com/tinylib/msgp as the reference decoder.
+func decodeMsgpack(b []byte) (interface{}, error) {
+	v, rest, err := decodeMsgpackValue(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.Newf("%d trailing bytes", len(rest))
+	}
+	return v, nil
+}
+
+func decodeMsgpackValue(b []byte) (_ interface{}, rest []byte, _ error) {
+	switch typ := msgp.NextType(b); typ {
+	case msgp.NilType:
+		rest, err := msgp.ReadNilBytes(b)
+		return nil, rest, err
+	case msgp.BoolType:
+		return msgp.ReadBoolBytes(b)
+	case msgp.IntType:
+		return msgp.ReadInt64Bytes(b)
+	case msgp.UintType:
+		u, rest, err := msgp.ReadUint64Bytes(b)
+		if err != nil || u > math.MaxInt64 {
+			return u, rest, err
+		}
+		return int64(u), rest, nil
+	case msgp.Float32Type, msgp.Float64Type:
+		return msgp.ReadFloat64Bytes(b)
+	case msgp.StrType:
+		return msgp.ReadStringBytes(b)
+	case msgp.ArrayType:
+		n, rest, err := msgp.ReadArrayHeaderBytes(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], rest, err = decodeMsgpackValue(rest); err != nil {
+				return nil, nil, err
+			}
+		}
+		return a, rest, nil
+	case msgp.MapType:
+		n, rest, err := msgp.ReadMapHeaderBytes(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		m := make([]msgpackKV, n)
+		for i := range m {
+			var k string
+			if k, rest, err = msgp.ReadStringBytes(rest); err != nil {
+				return nil, nil, err
+			}
+			m[i].key = k
+			if m[i].value, rest, err = decodeMsgpackValue(rest); err != nil {
+				return nil, nil, err
+			}
+		}
+		return m, rest, nil
+	default:
+		return nil, nil, errors.Newf("unexpected MessagePack type %s", typ)
+	}
+}
+
+// msgpackAsGoJSON converts a decoded MessagePack value into the form returned
+// by encoding/json, checking that the keys of every map are in ascending
+// order.
+func msgpackAsGoJSON(t *testing.T, v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = msgpackAsGoJSON(t, v[i])
+		}
+		return v
+	case []msgpackKV:
+		m := make(map[string]interface{}, len(v))
+		keys := make([]string, len(v))
+		for i, kv := range v {
+			keys[i] = kv.key
+			m[kv.key] = msgpackAsGoJSON(t, kv.value)
+		}
+		require.True(t, sort.StringsAreSorted(keys), "map keys are not sorted: %v", keys)
+		return m
+	default:
+		return v
+	}
+}
+
+func TestMsgpackScalars(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	for _, tc := range []struct {
+		json string
+		hex  string
+	}{
+		{`null`, `c0`},
+		{`true`, `c3`},
+		{`false`, `c2`},
+		{`0`, `00`},
+		{`127`, `7f`},
+		{`128`, `cc80`},
+		{`256`, `cd0100`},
+		{`65536`, `ce00010000`},
+		{`4294967296`, `cf0000000100000000`},
+		{`-1`, `ff`},
+		{`-32`, `e0`},
+		{`-33`, `d0df`},
+		{`-129`, `d1ff7f`},
+		{`-32769`, `d2ffff7fff`},
+		{`-2147483649`, `d3ffffffff7fffffff`},
+		{`1.5`, `cb3ff8000000000000`},
+		{`""`, `a0`},
+		{`"a"`, `a161`},
+		{`[]`, `90`},
+		{`[1, "a"]`, `9201a161`},
+		{`{}`, `80`},
+		{`{"b": 1, "a": 2}`, `82a16102a16201`},
+	} {
+		t.Run(tc.json, func(t *testing.T) {
+			j, err := json.ParseJSON(tc.json)
+			require.NoError(t, err)
+			b, err := appendMsgpackJSON(nil, j)
+			require.NoError(t, err)
+			require.Equal(t, tc.hex, hex.EncodeToString(b))
+		})
+	}
+
+	// Strings, arrays and maps with longer lengths use wider headers.
+	for _, tc := range []struct {
+		n      int
+		header string
+	}{
+		{31, `bf`},
+		{32, `d920`},
+		{256, `da0100`},
+		{65536, `db00010000`},
+	} {
+		b := appendMsgpackString(nil, strings.Repeat("x", tc.n))
+		require.Equal(t, tc.header, hex.EncodeToString(b[:len(b)-tc.n]))
+		v, err := decodeMsgpack(b)
+		require.NoError(t, err)
+		require.Equal(t, strings.Repeat("x", tc.n), v)
+	}
+	require.Equal(t, `9f`, hex.EncodeToString(appendMsgpackArrayHeader(nil, 15)))
+	require.Equal(t, `dc0010`, hex.EncodeToString(appendMsgpackArrayHeader(nil, 16)))
+	require.Equal(t, `dd00010000`, hex.EncodeToString(appendMsgpackArrayHeader(nil, 65536)))
+	require.Equal(t, `8f`, hex.EncodeToString(appendMsgpackMapHeader(nil, 15)))
+	require.Equal(t, `de0010`, hex.EncodeToString(appendMsgpackMapHeader(nil, 16)))
+	require.Equal(t, `df00010000`, hex.EncodeToString(appendMsgpackMapHeader(nil, 65536)))
+}
+
+func TestMsgpackEncoder(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	tableDesc, err := parseTableDesc(
+		`CREATE TABLE foo (a INT PRIMARY KEY, b STRING, c FLOAT, d INT[], e JSONB)`)
+	require.NoError(t, err)
+	row := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(-1000)},
+		rowenc.EncDatum{Datum: tree.NewDString(`bar`)},
+		rowenc.EncDatum{Datum: tree.NewDFloat(2.5)},
+		rowenc.EncDatum{Datum: func() tree.Datum {
+			arr := tree.NewDArray(types.Int)
+			require.NoError(t, arr.Append(tree.NewDInt(1)))
+			require.NoError(t, arr.Append(tree.DNull))
+			return arr
+		}()},
+		rowenc.EncDatum{Datum: tree.NewDJSON(json.FromString(`baz`))},
+	}, false)
+	deleted := cdcevent.TestingMakeEventRow(tableDesc, 0, rowenc.EncDatumRow{
+		rowenc.EncDatum{Datum: tree.NewDInt(-1000)},
+		rowenc.EncDatum{Datum: tree.DNull},
+		rowenc.EncDatum{Datum: tree.DNull},
+		rowenc.EncDatum{Datum: tree.DNull},
+		rowenc.EncDatum{Datum: tree.DNull},
+	}, true)
+	prevRow := cdcevent.TestingMakeEventRow(tableDesc, 0, nil, false)
+	ts := hlc.Timestamp{WallTime: 1, Logical: 2}
+	evCtx := eventContext{updated: ts, mvcc: ts, topic: `foo`}
+
+	for _, tc := range []struct {
+		name string
+		opts changefeedbase.EncodingOptions
+	}{
+		{
+			name: `wrapped`,
+			opts: changefeedbase.EncodingOptions{Envelope: changefeedbase.OptEnvelopeWrapped},
+		},
+		{
+			name: `wrapped with metadata`,
+			opts: changefeedbase.EncodingOptions{
+				Envelope:          changefeedbase.OptEnvelopeWrapped,
+				UpdatedTimestamps: true,
+				MVCCTimestamps:    true,
+				KeyInValue:        true,
+				TopicInValue:      true,
+			},
+		},
+		{
+			name: `bare`,
+			opts: changefeedbase.EncodingOptions{
+				Envelope:          changefeedbase.OptEnvelopeBare,
+				UpdatedTimestamps: true,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			jsonOpts, msgpackOpts := tc.opts, tc.opts
+			jsonOpts.Format = changefeedbase.OptFormatJSON
+			msgpackOpts.Format = changefeedbase.OptFormatMsgpack
+			require.NoError(t, msgpackOpts.Validate())
+			je, err := getEncoder(jsonOpts, changefeedbase.Targets{}, nil)
+			require.NoError(t, err)
+			me, err := getEncoder(msgpackOpts, changefeedbase.Targets{}, nil)
+			require.NoError(t, err)
+
+			// Every message decodes to the same document as the message of the
+			// JSON encoder with the same options.
+			requireSameDocument := func(jsonBytes, msgpackBytes []byte) {
+				t.Helper()
+				var expected interface{}
+				require.NoError(t, gojson.Unmarshal(jsonBytes, &expected))
+				v, err := decodeMsgpack(msgpackBytes)
+				require.NoError(t, err)
+				require.Equal(t, expected, msgpackAsGoJSON(t, v))
+			}
+
+			ctx := context.Background()
+			for _, r := range []cdcevent.Row{row, deleted} {
+				jk, err := je.EncodeKey(ctx, r)
+				require.NoError(t, err)
+				mk, err := me.EncodeKey(ctx, r)
+				require.NoError(t, err)
+				requireSameDocument(jk, mk)
+
+				jv, err := je.EncodeValue(ctx, evCtx, r, prevRow)
+				require.NoError(t, err)
+				jv = append([]byte(nil), jv...)
+				mv, err := me.EncodeValue(ctx, evCtx, r, prevRow)
+				require.NoError(t, err)
+				requireSameDocument(jv, mv)
+
+				// The encoding is deterministic.
+				mv = append([]byte(nil), mv...)
+				again, err := me.EncodeValue(ctx, evCtx, r, prevRow)
+				require.NoError(t, err)
+				require.Equal(t, mv, again)
+			}
+
+			jr, err := je.EncodeResolvedTimestamp(ctx, `foo`, ts)
+			require.NoError(t, err)
+			mr, err := me.EncodeResolvedTimestamp(ctx, `foo`, ts)
+			require.NoError(t, err)
+			requireSameDocument(jr, mr)
+		})
+	}
+
+	// Keys are in the key_format of the changefeed, like those of format=json,
+	// with delimited and hashed keys encoded as strings.
+	for _, keyFormat := range []changefeedbase.KeyFormat{
+		changefeedbase.OptKeyFormatArray,
+		changefeedbase.OptKeyFormatObject,
+		changefeedbase.OptKeyFormatDelimited,
+		changefeedbase.OptKeyFormatHash,
+	} {
+		t.Run(`key_format=`+string(keyFormat), func(t *testing.T) {
+			opts := changefeedbase.EncodingOptions{
+				Envelope:  changefeedbase.OptEnvelopeWrapped,
+				KeyFormat: keyFormat,
+			}
+			if keyFormat == changefeedbase.OptKeyFormatDelimited {
+				opts.KeyDelimiter = `/`
+			}
+			jsonOpts, msgpackOpts := opts, opts
+			jsonOpts.Format = changefeedbase.OptFormatJSON
+			msgpackOpts.Format = changefeedbase.OptFormatMsgpack
+			require.NoError(t, msgpackOpts.Validate())
+			je, err := getEncoder(jsonOpts, changefeedbase.Targets{}, nil)
+			require.NoError(t, err)
+			me, err := getEncoder(msgpackOpts, changefeedbase.Targets{}, nil)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			jk, err := je.EncodeKey(ctx, row)
+			require.NoError(t, err)
+			mk, err := me.EncodeKey(ctx, row)
+			require.NoError(t, err)
+			v, err := decodeMsgpack(mk)
+			require.NoError(t, err)
+
+			switch keyFormat {
+			case changefeedbase.OptKeyFormatDelimited, changefeedbase.OptKeyFormatHash:
+				require.Equal(t, string(jk), v)
+			default:
+				var expected interface{}
+				require.NoError(t, gojson.Unmarshal(jk, &expected))
+				require.Equal(t, expected, msgpackAsGoJSON(t, v))
+			}
+		})
+	}
+
+	// Messages of a webhook batch are wrapped like those of format=json.
+	payload, err := encodePayloadMsgpackWebhook([]messagePayload{
+		{val: appendMsgpackString(nil, `a`)},
+		{val: appendMsgpackInt(nil, 1)},
+	})
+	require.NoError(t, err)
+	v, err := decodeMsgpack(payload.data)
+	require.NoError(t, err)
+	require.Equal(t, []msgpackKV{
+		{key: `length`, value: int64(2)},
+		{key: `payload`, value: []interface{}{`a`, int64(1)}},
+	}, v)
+
+	_, err = changefeedbase.MakeStatementOptions(map[string]string{
+		changefeedbase.OptFormat:   string(changefeedbase.OptFormatMsgpack),
+		changefeedbase.OptEnvelope: string(changefeedbase.OptEnvelopeCloudEvents),
+	}).GetEncodingOptions()
+	require.Error(t, err)
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/security/username"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+)
+
+// runOnCompletion finalizes or cleans up the sink of the changefeed described
+// by details, which has completed, as configured by its on_completion option.
+// The action may run again if the job is resumed before it is marked as
+// succeeded, so it must be idempotent.
+func runOnCompletion(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	user username.SQLUsername,
+	jobID jobspb.JobID,
+	details jobspb.ChangefeedDetails,
+) error {
+	opts := changefeedbase.MakeStatementOptions(details.Opts)
+	action, err := opts.GetOnCompletion()
+	if err != nil {
+		return err
+	}
+	switch action {
+	case changefeedbase.OptOnCompletionNoop:
+		return nil
+	case changefeedbase.OptOnCompletionEmitEOF:
+		// Changefeeds with initial_scan='only' emit the rows as of their
+		// statement time, and others every change up to their end time.
+		ts := details.EndTime
+		if ts.IsEmpty() {
+			ts = details.StatementTime
+		}
+		log.Infof(ctx, "changefeed completed, emitting end of stream as of %s", ts)
+		return emitEndOfStream(ctx, execCfg, user, jobID, details, targetList(AllTargets(details)), ts,
+			changefeedbase.OptOnCompletion)
+	case changefeedbase.OptOnCompletionDeleteTopics:
+		// Only the topics the changefeed created are deleted, never those
+		// which existed before it, and which other producers may use.
+		job, err := execCfg.JobRegistry.LoadJob(ctx, jobID)
+		if err != nil {
+			return err
+		}
+		var createdTopics []string
+		if progress := job.Progress().GetChangefeed(); progress != nil {
+			createdTopics = progress.CreatedTopics
+		}
+		if len(createdTopics) == 0 {
+			log.Infof(ctx, "changefeed completed without creating any topic, none to delete")
+			return nil
+		}
+		sink, err := dialSinkOfJob(ctx, execCfg, user, jobID, details)
+		if err != nil {
+			return err
+		}
+		deleter, ok := asTopicDeletingSink(sink)
+		if !ok {
+			return errors.CombineErrors(
+				pgerror.Newf(pgcode.FeatureNotSupported, `%s=%s is not supported by this sink`,
+					changefeedbase.OptOnCompletion, action),
+				sink.Close())
+		}
+		log.Infof(ctx, "changefeed completed, deleting the topics it created: %s", createdTopics)
+		if err := deleter.DeleteTopics(ctx, createdTopics); err != nil {
+			return errors.CombineErrors(err, sink.Close())
+		}
+		return sink.Close()
+	default:
+		return errors.AssertionFailedf(`unknown %s: %s`, changefeedbase.OptOnCompletion, action)
+	}
+}
+
+// addCreatedTopics returns the sorted union of the topics in a and b.
+func addCreatedTopics(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	union := make([]string, 0, len(a)+len(b))
+	union = append(append(union, a...), b...)
+	sort.Strings(union)
+	j := 0
+	for i := range union {
+		if i == 0 || union[i] != union[j-1] {
+			union[j] = union[i]
+			j++
+		}
+	}
+	return union[:j]
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/kv"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descs"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/retry"
+	"github.com/cockroachdb/errors"
+)
+
+// A target table is taken offline while e.g. an IMPORT INTO ingests into it,
+// during which its rows can't be read. By default, the schema feed fails the
+// changefeed once one of its target tables goes offline. Under
+// on_offline=wait, the KV feed instead resolves its spans before the table
+// goes offline with a RESTART boundary, and the resumer waits for the table
+// to come back online before restarting the changefeed, recording the offline
+// tables, and why they are offline, in the running status of the job. The
+// emission of the changefeed's other targets waits as well, so that the
+// high-water of the job keeps covering all of its targets. Once restarted,
+// the changefeed skips the rows written while the table was offline, and
+// restarts once more as the table comes back online, re-scanning the table as
+// of then.
+
+// offlineTablesPollOptions are the options with which the resumer polls the
+// offline tables of a changefeed until they come back online.
+var offlineTablesPollOptions = retry.Options{
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+}
+
+// maybeWaitForOfflineTables handles the restart of the changefeed described
+// by details, which failed with err, if it restarts at a schema change
+// boundary at which some of its target tables were taken offline, or came
+// back online, as configured by its on_offline option. It waits for the
+// offline tables to come back online. It returns false if the changefeed
+// doesn't wait for offline tables, or if none of its targets were taken
+// offline or came back online at the boundary.
+func (b *changefeedResumer) maybeWaitForOfflineTables(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	jobID jobspb.JobID,
+	details jobspb.ChangefeedDetails,
+	err error,
+) (bool, error) {
+	policy, policyErr := changefeedbase.MakeStatementOptions(details.Opts).GetOnOffline()
+	if policyErr != nil || policy != changefeedbase.OptOnOfflineWait ||
+		pgerror.GetPGCode(err) != pgcode.SchemaChangeOccurred {
+		return false, policyErr
+	}
+
+	job, loadErr := execCfg.JobRegistry.LoadClaimedJob(ctx, jobID)
+	if loadErr != nil {
+		return false, loadErr
+	}
+	highWater := job.Progress().GetHighWater()
+	if highWater == nil || highWater.IsEmpty() {
+		return false, nil
+	}
+	before, err := fetchTargetTables(ctx, execCfg, details, *highWater)
+	if err != nil {
+		return false, err
+	}
+	boundary := highWater.Next()
+	after, err := fetchTargetTables(ctx, execCfg, details, boundary)
+	if err != nil {
+		return false, err
+	}
+
+	var offline, backOnline []catalog.TableDescriptor
+	for _, desc := range after {
+		if desc.Offline() {
+			offline = append(offline, desc)
+		} else if prev, ok := before[desc.GetID()]; ok && prev.Offline() {
+			backOnline = append(backOnline, desc)
+		}
+	}
+	if len(offline) == 0 {
+		if len(backOnline) == 0 {
+			return false, nil
+		}
+		names := offlineTableNames(backOnline, false /* withReason */)
+		log.Infof(ctx, "CHANGEFEED job %d restarting after %s came back online at %s (%s=%s)",
+			jobID, names, boundary, changefeedbase.OptOnOffline, policy)
+		b.setJobRunningStatus(ctx, time.Time{}, "re-scanning %s, back online at %s (%s=%s)",
+			names, boundary.AsOfSystemTime(), changefeedbase.OptOnOffline, policy)
+		return true, nil
+	}
+
+	names := offlineTableNames(offline, true /* withReason */)
+	log.Infof(ctx, "CHANGEFEED job %d waiting for offline tables %s at %s (%s=%s)",
+		jobID, names, boundary, changefeedbase.OptOnOffline, policy)
+	b.setJobRunningStatus(ctx, time.Time{},
+		"waiting for offline tables %s since %s, pausing the emission of all targets (%s=%s)",
+		names, boundary.AsOfSystemTime(), changefeedbase.OptOnOffline, policy)
+	for r := retry.StartWithCtx(ctx, offlineTablesPollOptions); r.Next(); {
+		current, err := fetchTargetTables(ctx, execCfg, details, execCfg.Clock.Now())
+		if err != nil {
+			return false, err
+		}
+		stillOffline := false
+		for _, desc := range offline {
+			if cur, ok := current[desc.GetID()]; ok && cur.Offline() {
+				stillOffline = true
+				break
+			}
+		}
+		if !stillOffline {
+			// The changefeed restarts at the boundary, and restarts once more
+			// when it reaches the tables coming back online. Tables which were
+			// dropped instead fail it then.
+			return true, nil
+		}
+	}
+	return false, ctx.Err()
+}
+
+// fetchTargetTables returns the descriptors of the target tables of the
+// changefeed described by details at ts, including those of offline tables.
+func fetchTargetTables(
+	ctx context.Context, execCfg *sql.ExecutorConfig, details jobspb.ChangefeedDetails, ts hlc.Timestamp,
+) (map[descpb.ID]catalog.TableDescriptor, error) {
+	targets := AllTargets(details)
+	var tables map[descpb.ID]catalog.TableDescriptor
+	if err := sourceDescsTxn(ctx, execCfg, details.TenantID, func(
+		ctx context.Context, txn *kv.Txn, descriptors *descs.Collection,
+	) error {
+		tables = make(map[descpb.ID]catalog.TableDescriptor, targets.NumUniqueTables())
+		if err := txn.SetFixedTimestamp(ctx, ts); err != nil {
+			return err
+		}
+		return targets.EachTableID(func(id descpb.ID) error {
+			desc, err := descriptors.ByID(txn).Get().Table(ctx, id)
+			if err != nil {
+				return err
+			}
+			tables[id] = desc
+			return nil
+		})
+	}); err != nil {
+		return nil, errors.Wrap(err, `fetching target tables`)
+	}
+	return tables, nil
+}
+
+func offlineTableNames(tables []catalog.TableDescriptor, withReason bool) string {
+	names := make([]string, 0, len(tables))
+	for _, desc := range tables {
+		if withReason && desc.GetOfflineReason() != "" {
+			names = append(names, fmt.Sprintf("%s (%s)", desc.GetName(), desc.GetOfflineReason()))
+		} else {
+			names = append(names, desc.GetName())
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/schemafeed"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/security/username"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+)
+
+// A TRUNCATE replaces the primary index of a table, which a changefeed
+// watches, with a new, empty, one. By default, the schema feed fails the
+// changefeed once one of its target tables is truncated. Under
+// on_truncate=rescan or emit_marker, the KV feed instead resolves its spans
+// at the truncation with a RESTART boundary, like it does for a primary key
+// change, and the changefeed restarts at it watching the new primary index,
+// which is scanned as of the truncation. When the job restarts, the resumer
+// records the truncation in the running status of the job, and, under
+// emit_marker, emits a truncation marker to the topic of each truncated
+// target before the rows of the table are re-scanned.
+
+// truncateMarkerEncoder encodes resolved timestamps as truncation markers,
+// which lets them be emitted to the topics of chosen targets through
+// TargetResolvedTimestampSink.
+type truncateMarkerEncoder struct {
+	*jsonEncoder
+}
+
+// EncodeResolvedTimestamp implements the Encoder interface.
+func (e truncateMarkerEncoder) EncodeResolvedTimestamp(
+	_ context.Context, topic string, resolved hlc.Timestamp,
+) ([]byte, error) {
+	return e.EncodeTruncated(topic, resolved)
+}
+
+// maybeHandleTruncate handles the restart of the changefeed described by
+// details, which failed with err, if it restarts at a schema change boundary
+// at which some of its target tables were truncated, as configured by its
+// on_truncate option. It returns false if the changefeed doesn't handle
+// truncations, or if none of its targets were truncated at the boundary. It
+// returns a retryable error if it fails to emit truncation markers.
+func (b *changefeedResumer) maybeHandleTruncate(
+	ctx context.Context,
+	execCfg *sql.ExecutorConfig,
+	user username.SQLUsername,
+	jobID jobspb.JobID,
+	details jobspb.ChangefeedDetails,
+	err error,
+) (bool, error) {
+	policy, policyErr := changefeedbase.MakeStatementOptions(details.Opts).GetOnTruncate()
+	if policyErr != nil || policy == changefeedbase.OptOnTruncateFail ||
+		pgerror.GetPGCode(err) != pgcode.SchemaChangeOccurred {
+		return false, policyErr
+	}
+
+	// The high-water of the job was checkpointed at the boundary, which the
+	// schema changes, including the truncations, follow.
+	job, loadErr := execCfg.JobRegistry.LoadClaimedJob(ctx, jobID)
+	if loadErr != nil {
+		return false, loadErr
+	}
+	highWater := job.Progress().GetHighWater()
+	if highWater == nil || highWater.IsEmpty() {
+		return false, nil
+	}
+	truncated, findErr := truncatedTargets(ctx, execCfg, details, *highWater)
+	if findErr != nil || len(truncated) == 0 {
+		return false, findErr
+	}
+
+	truncatedAt := highWater.Next()
+	names := make([]string, 0, len(truncated))
+	for _, t := range truncated {
+		names = append(names, string(t.StatementTimeName))
+	}
+	log.Infof(ctx, "CHANGEFEED job %d restarting after the truncation of %s at %s (%s=%s)",
+		jobID, strings.Join(names, ", "), truncatedAt, changefeedbase.OptOnTruncate, policy)
+	if policy == changefeedbase.OptOnTruncateEmitMarker {
+		if err := emitTargetMarkers(ctx, execCfg, user, jobID, details, truncated, truncatedAt,
+			changefeedbase.OptOnTruncate,
+			func(e *jsonEncoder) Encoder { return truncateMarkerEncoder{e} },
+		); err != nil {
+			// Failures to emit to the sink are retried, like those of the flow.
+			return false, changefeedbase.MarkRetryableError(errors.Wrap(err, `failed to emit truncate markers`))
+		}
+	}
+	b.setJobRunningStatus(ctx, time.Time{}, "re-scanning %s, truncated at %s (%s=%s)",
+		strings.Join(names, ", "), truncatedAt.AsOfSystemTime(), changefeedbase.OptOnTruncate, policy)
+	return true, nil
+}
+
+// truncatedTargets returns the targets of the changefeed described by
+// details whose tables were truncated right after ts.
+func truncatedTargets(
+	ctx context.Context, execCfg *sql.ExecutorConfig, details jobspb.ChangefeedDetails, ts hlc.Timestamp,
+) ([]changefeedbase.Target, error) {
+	targets := AllTargets(details)
+	before, err := fetchTableDescriptors(ctx, execCfg, details.TenantID, targets, ts)
+	if err != nil {
+		return nil, err
+	}
+	after, err := fetchTableDescriptors(ctx, execCfg, details.TenantID, targets, ts.Next())
+	if err != nil {
+		return nil, err
+	}
+	beforeByID := make(map[descpb.ID]catalog.TableDescriptor, len(before))
+	for _, desc := range before {
+		beforeByID[desc.GetID()] = desc
+	}
+	var truncated []changefeedbase.Target
+	for _, desc := range after {
+		prev, ok := beforeByID[desc.GetID()]
+		if !ok || !schemafeed.IsTruncate(schemafeed.TableEvent{Before: prev, After: desc}) {
+			continue
+		}
+		if _, err := targets.EachHavingTableID(desc.GetID(), func(t changefeedbase.Target) error {
+			truncated = append(truncated, t)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return truncated, nil
+}
+
+// validateOnTruncate validates the on_truncate option. Truncation markers
+// are emitted like end-of-stream markers, so they have the same
+// requirements.
+func validateOnTruncate(details jobspb.ChangefeedDetails, opts changefeedbase.StatementOptions) error {
+	policy, err := opts.GetOnTruncate()
+	if err != nil || policy != changefeedbase.OptOnTruncateEmitMarker {
+		return err
+	}
+	encodingOpts, err := opts.GetEncodingOptions()
+	if err != nil {
+		return err
+	}
+	if encodingOpts.Format != changefeedbase.OptFormatJSON {
+		return errors.Errorf(`%s=%s is only usable with %s=%s`, changefeedbase.OptOnTruncate,
+			policy, changefeedbase.OptFormat, changefeedbase.OptFormatJSON)
+	}
+	u, err := url.Parse(details.SinkURI)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != changefeedbase.SinkSchemeKafka &&
+		u.Scheme != changefeedbase.SinkSchemeExternalConnection {
+		return errors.Errorf(`%s=%s is only usable with kafka sinks`,
+			changefeedbase.OptOnTruncate, policy)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/utilccl"
+	"github.com/cockroachdb/cockroach/pkg/kv"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/volatility"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+)
+
+// The crdb_internal.preview_changefeed builtin returns the first messages a
+// changefeed would emit for the current rows of its targets, e.g.
+//
+//	SELECT * FROM crdb_internal.preview_changefeed(
+//	  'CREATE CHANGEFEED FOR foo INTO ''kafka://...'' WITH format=json, envelope=bare', 5);
+//
+// so that options and CDC queries can be iterated on without emitting to a
+// sink. The changefeed runs as a sinkless changefeed which performs an initial
+// scan, and so goes through the same encoders and CDC query evaluation as it
+// would with a sink. Its options which concern the delivery of messages rather
+// than their contents are left out of the preview.
+
+// previewOmittedOptions are the options which are left out of the changefeed
+// run for a preview: those which would keep it from scanning the current
+// rows, or which require a sink or a job. Sink specific options, which aren't
+// in changefeedbase.CommonOptions, are left out as well.
+var previewOmittedOptions = map[string]struct{}{
+	changefeedbase.OptCursor:                 {},
+	changefeedbase.OptEndTime:                {},
+	changefeedbase.OptInitialScan:            {},
+	changefeedbase.OptNoInitialScan:          {},
+	changefeedbase.OptInitialScanOnly:        {},
+	changefeedbase.OptResolvedTimestamps:     {},
+	changefeedbase.OptResolvedPerTable:       {},
+	changefeedbase.OptMinCheckpointFrequency: {},
+	changefeedbase.OptUnordered:              {},
+	changefeedbase.OptDryRun:                 {},
+	changefeedbase.OptSink:                   {},
+	changefeedbase.OptDeleteAfterEmit:        {},
+	changefeedbase.OptDeadLetterTable:        {},
+	changefeedbase.OptContentDigestTable:     {},
+	changefeedbase.OptOnCompletion:           {},
+	changefeedbase.OptOnTruncate:             {},
+	changefeedbase.OptOnOffline:              {},
+	changefeedbase.OptEmissionWindow:         {},
+	changefeedbase.OptMaxEmittedBytesPerDay:  {},
+	changefeedbase.OptCoalesceWindow:         {},
+}
+
+// previewChangefeedStmt returns the sinkless changefeed run to preview the
+// given CREATE CHANGEFEED statement. It emits resolved timestamps, the first
+// of which marks the end of its initial scan.
+func previewChangefeedStmt(stmt string) (string, error) {
+	preview, err := sinklessChangefeedStmt(stmt, previewOmittedOptions)
+	if err != nil {
+		return ``, err
+	}
+	preview.Options = append(preview.Options,
+		tree.KVOption{Key: tree.Name(changefeedbase.OptResolvedTimestamps)})
+	return tree.AsString(preview), nil
+}
+
+// sinklessChangefeedStmt parses the given CREATE CHANGEFEED statement, and
+// returns it without its sink, its sink specific options, or those of its
+// options which are in omitted.
+func sinklessChangefeedStmt(
+	stmt string, omitted map[string]struct{},
+) (*tree.CreateChangefeed, error) {
+	parsed, err := parser.ParseOne(stmt)
+	if err != nil {
+		return nil, pgerror.Wrap(err, pgcode.InvalidParameterValue, `parsing changefeed statement`)
+	}
+	changefeed, ok := parsed.AST.(*tree.CreateChangefeed)
+	if !ok {
+		return nil, pgerror.Newf(pgcode.InvalidParameterValue,
+			`expected a CREATE CHANGEFEED statement, got %s`, parsed.AST.StatementTag())
+	}
+	sinkless := *changefeed
+	sinkless.SinkURI = nil
+	sinkless.Options = nil
+	for _, opt := range changefeed.Options {
+		if _, ok := changefeedbase.CommonOptions[string(opt.Key)]; !ok {
+			continue
+		}
+		if _, ok := omitted[string(opt.Key)]; ok {
+			continue
+		}
+		sinkless.Options = append(sinkless.Options, opt)
+	}
+	return &sinkless, nil
+}
+
+var previewChangefeedGeneratorType = types.MakeLabeledTuple(
+	[]*types.T{types.String, types.String, types.String},
+	[]string{"topic", "key", "value"},
+)
+
+// previewChangefeedGenerator implements the crdb_internal.preview_changefeed
+// builtin.
+type previewChangefeedGenerator struct {
+	evalCtx *eval.Context
+	stmt    string
+	limit   int64
+
+	it      isql.Rows
+	emitted int64
+	cur     tree.Datums
+}
+
+var _ eval.ValueGenerator = &previewChangefeedGenerator{}
+
+// ResolvedType implements the eval.ValueGenerator interface.
+func (g *previewChangefeedGenerator) ResolvedType() *types.T {
+	return previewChangefeedGeneratorType
+}
+
+// Start implements the eval.ValueGenerator interface.
+func (g *previewChangefeedGenerator) Start(ctx context.Context, _ *kv.Txn) error {
+	// The changefeed runs outside of the transaction of the statement, which
+	// sinkless changefeeds can't be run in, but as its user, so that it is
+	// subject to the same privilege checks as the changefeed it previews.
+	execCfg := g.evalCtx.Planner.ExecutorConfig().(*sql.ExecutorConfig)
+	it, err := execCfg.InternalDB.Executor().QueryIteratorEx(ctx, `preview-changefeed`, nil, /* txn */
+		sessiondata.InternalExecutorOverride{
+			User:     g.evalCtx.SessionData().User(),
+			Database: g.evalCtx.SessionData().Database,
+		}, g.stmt)
+	if err != nil {
+		return err
+	}
+	g.it = it
+	return nil
+}
+
+// Next implements the eval.ValueGenerator interface.
+func (g *previewChangefeedGenerator) Next(ctx context.Context) (bool, error) {
+	if g.emitted >= g.limit {
+		return false, nil
+	}
+	ok, err := g.it.Next(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+	row := g.it.Cur()
+	// Resolved timestamps, which have no topic, are only emitted once the
+	// initial scan completes.
+	if row[0] == tree.DNull {
+		return false, nil
+	}
+	g.emitted++
+	g.cur = tree.Datums{row[0], renderPreviewBytes(row[1]), renderPreviewBytes(row[2])}
+	return true, nil
+}
+
+// Values implements the eval.ValueGenerator interface.
+func (g *previewChangefeedGenerator) Values() (tree.Datums, error) {
+	return g.cur, nil
+}
+
+// Close implements the eval.ValueGenerator interface. It stops the
+// changefeed, which may not have completed its initial scan.
+func (g *previewChangefeedGenerator) Close(ctx context.Context) {
+	if g.it != nil {
+		_ = g.it.Close()
+	}
+}
+
+// renderPreviewBytes renders the key or value of a message as text if it is
+// valid UTF-8, as is that of the text formats, or as an escaped byte string
+// otherwise.
+func renderPreviewBytes(d tree.Datum) tree.Datum {
+	if d == tree.DNull {
+		return d
+	}
+	b := tree.MustBeDBytes(d)
+	if utf8.ValidString(string(b)) {
+		return tree.NewDString(string(b))
+	}
+	return tree.NewDString(tree.AsStringWithFlags(d, tree.FmtBareStrings))
+}
+
+func init() {
+	utilccl.RegisterCCLBuiltin("crdb_internal.preview_changefeed",
+		`Returns the first messages a changefeed would emit for the current rows of its targets.`,
+		tree.Overload{
+			Types: tree.ParamTypes{
+				{Name: "changefeed", Typ: types.String},
+				{Name: "limit", Typ: types.Int},
+			},
+			ReturnType: tree.FixedReturnType(previewChangefeedGeneratorType),
+			Generator: eval.GeneratorOverload(func(
+				_ context.Context, evalCtx *eval.Context, args tree.Datums,
+			) (eval.ValueGenerator, error) {
+				limit := int64(tree.MustBeDInt(args[1]))
+				if limit <= 0 {
+					return nil, pgerror.Newf(pgcode.InvalidParameterValue,
+						`limit must be positive: %d`, limit)
+				}
+				stmt, err := previewChangefeedStmt(string(tree.MustBeDString(args[0])))
+				if err != nil {
+					return nil, err
+				}
+				return &previewChangefeedGenerator{evalCtx: evalCtx, stmt: stmt, limit: limit}, nil
+			}),
+			Class: tree.GeneratorClass,
+			Info: "Runs the given CREATE CHANGEFEED statement as a sinkless changefeed over the " +
+				"current rows of its targets, and returns the topic, key and value of up to limit " +
+				"of the messages it emits, rendered as text. Options which concern the delivery " +
+				"of messages rather than their contents are ignored.",
+			Volatility: volatility.Volatile,
+		})
+}
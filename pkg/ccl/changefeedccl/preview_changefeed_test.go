@@ -0,0 +1,88 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdctest"
+	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewChangefeedStmt(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	for _, tc := range []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			// Sink specific options, and those which keep the changefeed from
+			// scanning the current rows, are left out.
+			stmt: `CREATE CHANGEFEED FOR foo INTO 'kafka://broker' WITH envelope = 'bare', ` +
+				`resolved = '10s', initial_scan = 'no', kafka_sink_config = '{}', diff`,
+			expected: `EXPERIMENTAL CHANGEFEED FOR TABLE foo WITH envelope = 'bare', diff, resolved`,
+		},
+		{
+			stmt:     `CREATE CHANGEFEED INTO 'null://' WITH format = 'json' AS SELECT a FROM foo`,
+			expected: `CREATE CHANGEFEED WITH format = 'json', resolved AS SELECT a FROM foo`,
+		},
+	} {
+		stmt, err := previewChangefeedStmt(tc.stmt)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, stmt)
+	}
+
+	_, err := previewChangefeedStmt(`SELECT 1`)
+	require.EqualError(t, err, `expected a CREATE CHANGEFEED statement, got SELECT`)
+}
+
+func TestPreviewChangefeedBuiltin(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testFn := func(t *testing.T, s TestServer, f cdctest.TestFeedFactory) {
+		sqlDB := sqlutils.MakeSQLRunner(s.DB)
+		sqlDB.Exec(t, `CREATE TABLE foo (a INT PRIMARY KEY, b STRING)`)
+		sqlDB.Exec(t, `INSERT INTO foo VALUES (1, 'x'), (2, 'y'), (3, 'z')`)
+
+		// The preview stops once the initial scan completes, if it doesn't
+		// reach its limit first.
+		sqlDB.CheckQueryResults(t, `
+SELECT * FROM crdb_internal.preview_changefeed(
+	'CREATE CHANGEFEED FOR foo INTO ''null://'' WITH envelope = ''bare'', key_format = ''object''', 10
+) ORDER BY key`, [][]string{
+			{`foo`, `{"a": 1}`, `{"a": 1, "b": "x"}`},
+			{`foo`, `{"a": 2}`, `{"a": 2, "b": "y"}`},
+			{`foo`, `{"a": 3}`, `{"a": 3, "b": "z"}`},
+		})
+		sqlDB.CheckQueryResults(t, `
+SELECT count(*) FROM crdb_internal.preview_changefeed('CREATE CHANGEFEED FOR foo INTO ''null://''', 2)`,
+			[][]string{{`2`}})
+
+		sqlDB.CheckQueryResults(t, `
+SELECT * FROM crdb_internal.preview_changefeed(
+	'CREATE CHANGEFEED INTO ''null://'' AS SELECT b FROM foo WHERE a > 1', 10
+) ORDER BY key`, [][]string{
+			{`foo`, `[2]`, `{"b": "y"}`},
+			{`foo`, `[3]`, `{"b": "z"}`},
+		})
+
+		sqlDB.ExpectErr(t, `expected a CREATE CHANGEFEED statement`,
+			`SELECT * FROM crdb_internal.preview_changefeed('SELECT 1', 1)`)
+		sqlDB.ExpectErr(t, `limit must be positive`,
+			`SELECT * FROM crdb_internal.preview_changefeed('CREATE CHANGEFEED FOR foo', 0)`)
+	}
+
+	cdcTest(t, testFn, feedTestForceSink("sinkless"))
+}
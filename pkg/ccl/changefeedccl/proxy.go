@@ -0,0 +1,160 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/net/proxy"
+)
+
+// The webhook and pubsub sinks, and the confluent schema registry, may be
+// reached through a proxy given by the proxy_url parameter of their URI, e.g.
+//
+//	webhook-https://sink:8443?proxy_url=http%3A%2F%2Fuser%3Apassword%40proxy%3A3128
+//
+// HTTP and HTTPS proxies are asked to tunnel connections with CONNECT, while
+// SOCKS5 proxies are used as such. Credentials for the proxy are taken from
+// the user info of its URL. As the parameter is part of the URI, it may also
+// be stored in an external connection.
+
+// parseProxyURL parses the value of the proxy_url parameter param. It returns
+// nil if the parameter is empty.
+func parseProxyURL(param string, value string) (*url.URL, error) {
+	if value == `` {
+		return nil, nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, `param %s must be a URL`, param)
+	}
+	switch u.Scheme {
+	case `http`, `https`, `socks5`:
+	default:
+		return nil, errors.Errorf(`param %s has unsupported scheme %q, expected one of http, https or socks5`,
+			param, u.Scheme)
+	}
+	if u.Host == `` {
+		return nil, errors.Errorf(`param %s must specify the host of the proxy`, param)
+	}
+	return u, nil
+}
+
+// setTransportProxy configures transport to connect through the proxy at
+// proxyURL. The transport sends the credentials of the proxy, if any, in the
+// Proxy-Authorization header of HTTP proxies and in the handshake of SOCKS5
+// proxies.
+func setTransportProxy(transport *http.Transport, proxyURL *url.URL) {
+	transport.Proxy = http.ProxyURL(proxyURL)
+}
+
+// proxyDialFunc returns a function dialing TCP connections through the proxy
+// at proxyURL, for clients which do not use an http.Transport.
+func proxyDialFunc(
+	proxyURL *url.URL,
+) (func(ctx context.Context, addr string) (net.Conn, error), error) {
+	dialer := &net.Dialer{}
+	if proxyURL.Scheme == `socks5` {
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		socks, err := proxy.SOCKS5(`tcp`, proxyURL.Host, auth, dialer)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, addr string) (net.Conn, error) {
+			return socks.(proxy.ContextDialer).DialContext(ctx, `tcp`, addr)
+		}, nil
+	}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialHTTPConnect(ctx, dialer, proxyURL, addr)
+	}, nil
+}
+
+// dialHTTPConnect opens a connection to addr tunneled through the HTTP(S)
+// proxy at proxyURL.
+func dialHTTPConnect(
+	ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string,
+) (_ net.Conn, retErr error) {
+	conn, err := dialer.DialContext(ctx, `tcp`, proxyURL.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, `dialing proxy`)
+	}
+	defer func() {
+		if retErr != nil {
+			_ = conn.Close()
+		}
+	}()
+	if proxyURL.Scheme == `https` {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+	}
+
+	// Bound the handshake with the proxy by the deadline of ctx, if any.
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := proxyURL.User.Username() + `:` + password
+		req.Header.Set(`Proxy-Authorization`,
+			`Basic `+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, errors.Wrap(err, `writing CONNECT request to proxy`)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, errors.Wrap(err, `reading CONNECT response from proxy`)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(`proxy %s refused to connect to %s: %s`,
+			proxyURL.Redacted(), addr, resp.Status)
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	if br.Buffered() > 0 {
+		// The proxy sent data from addr along with its response.
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads are served from r first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -12,7 +12,10 @@ import (
 	"context"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/retry"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
@@ -20,8 +23,9 @@ import (
 var useFastRetry = envutil.EnvOrDefaultBool(
 	"COCKROACH_CHANGEFEED_TESTING_FAST_RETRY", false)
 
-// getRetry returns retry object for changefeed.
-func getRetry(ctx context.Context) Retry {
+// getRetry returns retry object for changefeed. Backoffs specified in
+// retryOpts override the defaults.
+func getRetry(ctx context.Context, retryOpts changefeedbase.RetryOptions) Retry {
 	opts := retry.Options{
 		InitialBackoff: 5 * time.Second,
 		Multiplier:     2,
@@ -36,7 +40,24 @@ func getRetry(ctx context.Context) Retry {
 		}
 	}
 
-	return Retry{Retry: retry.StartWithCtx(ctx, opts)}
+	if retryOpts.MinBackoff > 0 {
+		opts.InitialBackoff = retryOpts.MinBackoff
+		if opts.MaxBackoff < opts.InitialBackoff {
+			opts.MaxBackoff = opts.InitialBackoff
+		}
+	}
+	if retryOpts.MaxBackoff > 0 {
+		opts.MaxBackoff = retryOpts.MaxBackoff
+		if opts.InitialBackoff > opts.MaxBackoff {
+			opts.InitialBackoff = opts.MaxBackoff
+		}
+	}
+
+	return Retry{
+		Retry:          retry.StartWithCtx(ctx, opts),
+		initialBackoff: opts.InitialBackoff,
+		maxAttempts:    retryOpts.MaxAttemptsBeforePause,
+	}
 }
 
 func testingUseFastRetry() func() {
@@ -55,7 +76,13 @@ const resetRetryAfter = 10 * time.Minute
 // long time.
 type Retry struct {
 	retry.Retry
-	lastRetry time.Time
+	lastRetry      time.Time
+	initialBackoff time.Duration
+	maxAttempts    int
+	// failures is the number of consecutive failed attempts which made no
+	// progress. Unlike the attempts of retry.Retry, it doesn't count the
+	// attempts which ended in a replan.
+	failures int
 }
 
 // Next returns whether the retry loop should continue, and blocks for the
@@ -68,6 +95,76 @@ func (r *Retry) Next() bool {
 	}()
 	if timeutil.Since(r.lastRetry) > resetRetryAfter {
 		r.Reset()
+		r.failures = 0
 	}
 	return r.Retry.Next()
 }
+
+// Failed records that the current attempt failed. If the attempt made
+// progress, the failures before it are forgotten and the backoff is reset, so
+// that only the failures which follow each other without any progress count
+// towards the retry limit.
+func (r *Retry) Failed(madeProgress bool) {
+	if madeProgress {
+		r.Reset()
+		r.failures = 0
+	}
+	r.failures++
+}
+
+// Replanned resets the backoff after the current attempt ended in a replan,
+// which isn't a failure, and waits for the initial backoff so that a flow
+// which keeps being replanned can't restart in a tight loop.
+func (r *Retry) Replanned(ctx context.Context) error {
+	r.Reset()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(r.initialBackoff):
+		return nil
+	}
+}
+
+// Exhausted returns true if the number of consecutive failed attempts without
+// progress, including the current one, has reached the maximum configured via
+// the retry_max_attempts_before_pause option.
+func (r *Retry) Exhausted() bool {
+	return r.maxAttempts > 0 && r.failures >= r.maxAttempts
+}
+
+// changefeedPosition is the position of a changefeed, as recorded in its
+// progress.
+type changefeedPosition struct {
+	highWater  hlc.Timestamp
+	checkpoint jobspb.ChangefeedProgress_Checkpoint
+}
+
+// positionOf returns the position recorded in the progress of a changefeed.
+func positionOf(progress jobspb.Progress) changefeedPosition {
+	var pos changefeedPosition
+	if hw := progress.GetHighWater(); hw != nil {
+		pos.highWater = *hw
+	}
+	if cf := progress.GetChangefeed(); cf != nil && cf.Checkpoint != nil {
+		pos.checkpoint = *cf.Checkpoint
+	}
+	return pos
+}
+
+// advancedTo returns whether the changefeed made progress from pos to next,
+// by advancing either its high-water or its checkpoint.
+func (pos changefeedPosition) advancedTo(next changefeedPosition) bool {
+	if pos.highWater.Less(next.highWater) {
+		return true
+	}
+	if !pos.checkpoint.Timestamp.Equal(next.checkpoint.Timestamp) ||
+		len(pos.checkpoint.Spans) != len(next.checkpoint.Spans) {
+		return true
+	}
+	for i := range pos.checkpoint.Spans {
+		if !pos.checkpoint.Spans[i].Equal(next.checkpoint.Spans[i]) {
+			return true
+		}
+	}
+	return false
+}
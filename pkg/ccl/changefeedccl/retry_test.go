@@ -0,0 +1,84 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryExhaustedAfterConsecutiveFailures(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	r := getRetry(context.Background(), changefeedbase.RetryOptions{MaxAttemptsBeforePause: 3})
+	r.Failed(false /* madeProgress */)
+	r.Failed(false /* madeProgress */)
+	require.False(t, r.Exhausted())
+
+	// An attempt which made progress before failing forgets the failures
+	// before it.
+	r.Failed(true /* madeProgress */)
+	require.False(t, r.Exhausted())
+	r.Failed(false /* madeProgress */)
+	require.False(t, r.Exhausted())
+	r.Failed(false /* madeProgress */)
+	require.True(t, r.Exhausted())
+
+	// Without a limit, the retries are never exhausted.
+	r = getRetry(context.Background(), changefeedbase.RetryOptions{})
+	for i := 0; i < 10; i++ {
+		r.Failed(false /* madeProgress */)
+	}
+	require.False(t, r.Exhausted())
+}
+
+func TestChangefeedPositionAdvancedTo(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ts := func(wall int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wall} }
+	highWater := func(wall int64) jobspb.Progress {
+		hw := ts(wall)
+		return jobspb.Progress{Progress: &jobspb.Progress_HighWater{HighWater: &hw}}
+	}
+	checkpoint := func(wall int64, keys ...string) jobspb.Progress {
+		cp := &jobspb.ChangefeedProgress_Checkpoint{Timestamp: ts(wall)}
+		for _, k := range keys {
+			cp.Spans = append(cp.Spans, roachpb.Span{Key: roachpb.Key(k), EndKey: roachpb.Key(k).Next()})
+		}
+		return jobspb.Progress{Details: &jobspb.Progress_Changefeed{
+			Changefeed: &jobspb.ChangefeedProgress{Checkpoint: cp},
+		}}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		from, to jobspb.Progress
+		expected bool
+	}{
+		{name: "no progress", from: jobspb.Progress{}, to: jobspb.Progress{}},
+		{name: "same high-water", from: highWater(1), to: highWater(1)},
+		{name: "high-water advanced", from: highWater(1), to: highWater(2), expected: true},
+		{name: "first high-water", from: jobspb.Progress{}, to: highWater(1), expected: true},
+		{name: "same checkpoint", from: checkpoint(1, "a"), to: checkpoint(1, "a")},
+		{name: "checkpoint grew", from: checkpoint(1, "a"), to: checkpoint(1, "a", "b"), expected: true},
+		{name: "checkpoint moved", from: checkpoint(1, "a"), to: checkpoint(1, "b"), expected: true},
+		{name: "checkpoint advanced", from: checkpoint(1, "a"), to: checkpoint(2, "a"), expected: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, positionOf(tc.from).advancedTo(positionOf(tc.to)))
+		})
+	}
+}
@@ -486,7 +486,7 @@ func emitSchedule(
 	resultsCh chan<- tree.Datums,
 ) error {
 	opts := changefeedbase.MakeStatementOptions(createChangefeedOpts)
-	redactedChangefeedNode, err := changefeedJobDescription(ctx, createChangefeedNode, sinkURI, opts)
+	redactedChangefeedNode, err := changefeedJobDescription(ctx, createChangefeedNode, sinkURI, nil /* additionalSinkURIs */, opts)
 	if err != nil {
 		return err
 	}
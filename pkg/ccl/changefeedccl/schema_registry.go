@@ -14,8 +14,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
@@ -96,6 +100,72 @@ func getAndDeleteParams(u *url.URL) (schemaRegistryParams, error) {
 	return s, nil
 }
 
+// schemaRegistryConfig configures the connections to a schema registry.
+type schemaRegistryConfig struct {
+	tlsSkipVerify bool
+	timeout       time.Duration
+	retryOpts     retry.Options
+}
+
+func defaultSchemaRegistryConfig() schemaRegistryConfig {
+	retryOpts := base.DefaultRetryOptions()
+	retryOpts.MaxRetries = 2
+	return schemaRegistryConfig{
+		timeout:   httputil.StandardHTTPTimeout,
+		retryOpts: retryOpts,
+	}
+}
+
+// getAndDeleteConfig returns the configuration of the connections to the
+// schema registry given by the query params of its url, which it removes.
+func getAndDeleteConfig(u *url.URL) (schemaRegistryConfig, error) {
+	query := u.Query()
+	cfg := defaultSchemaRegistryConfig()
+	if v := query.Get(changefeedbase.RegistryParamSkipTLSVerify); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, errors.Wrapf(err, "param %s must be a bool", changefeedbase.RegistryParamSkipTLSVerify)
+		}
+		cfg.tlsSkipVerify = skip
+	}
+	for k, dest := range map[string]*time.Duration{
+		changefeedbase.RegistryParamTimeout:      &cfg.timeout,
+		changefeedbase.RegistryParamRetryBackoff: &cfg.retryOpts.InitialBackoff,
+	} {
+		if v := query.Get(k); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, errors.Wrapf(err, "param %s must be a duration", k)
+			}
+			if d <= 0 {
+				return cfg, errors.Errorf("param %s must be positive: %s", k, v)
+			}
+			*dest = d
+		}
+	}
+	if v := query.Get(changefeedbase.RegistryParamRetryMax); v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil || retries < 0 {
+			return cfg, errors.Errorf("param %s must be a non-negative integer: %s",
+				changefeedbase.RegistryParamRetryMax, v)
+		}
+		cfg.retryOpts.MaxRetries = retries
+	}
+	if cfg.retryOpts.MaxBackoff < cfg.retryOpts.InitialBackoff {
+		cfg.retryOpts.MaxBackoff = cfg.retryOpts.InitialBackoff
+	}
+	for _, k := range []string{
+		changefeedbase.RegistryParamSkipTLSVerify,
+		changefeedbase.RegistryParamTimeout,
+		changefeedbase.RegistryParamRetryMax,
+		changefeedbase.RegistryParamRetryBackoff,
+	} {
+		query.Del(k)
+	}
+	u.RawQuery = query.Encode()
+	return cfg, nil
+}
+
 func newConfluentSchemaRegistry(baseURL string) (*confluentSchemaRegistry, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
@@ -106,39 +176,63 @@ func newConfluentSchemaRegistry(baseURL string) (*confluentSchemaRegistry, error
 		return nil, errors.Errorf("unsupported scheme: %q", u.Scheme)
 	}
 
+	query := u.Query()
+	proxyURL, err := parseProxyURL(changefeedbase.RegistryParamProxyURL,
+		query.Get(changefeedbase.RegistryParamProxyURL))
+	if err != nil {
+		return nil, err
+	}
+	query.Del(changefeedbase.RegistryParamProxyURL)
+	u.RawQuery = query.Encode()
+
 	s, err := getAndDeleteParams(u)
 	if err != nil {
 		return nil, err
 	}
 
-	httpClient, err := setupHTTPClient(u, s)
+	cfg, err := getAndDeleteConfig(u)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := setupHTTPClient(u, s, cfg, proxyURL)
 	if err != nil {
 		return nil, err
 	}
 
-	retryOpts := base.DefaultRetryOptions()
-	retryOpts.MaxRetries = 2
 	return &confluentSchemaRegistry{
 		baseURL:   u,
 		client:    httpClient,
-		retryOpts: retryOpts,
+		retryOpts: cfg.retryOpts,
 	}, nil
 }
 
 // Setup the httputil.Client to use when dialing Confluent schema registry. If `ca_cert`
 // is set as a query param in the registry URL, client should trust the corresponding
-// cert while dialing. Otherwise, use the DefaultClient.
-func setupHTTPClient(baseURL *url.URL, s schemaRegistryParams) (*httputil.Client, error) {
-	if len(s) == 0 {
+// cert while dialing, and if `insecure_tls_skip_verify` is set, it trusts any cert.
+// If `proxy_url` is set, client connects through that proxy. Requests time out after
+// `timeout`. Otherwise, use the DefaultClient.
+func setupHTTPClient(
+	baseURL *url.URL, s schemaRegistryParams, cfg schemaRegistryConfig, proxyURL *url.URL,
+) (*httputil.Client, error) {
+	if len(s) == 0 && proxyURL == nil && !cfg.tlsSkipVerify &&
+		cfg.timeout == httputil.StandardHTTPTimeout {
 		return httputil.DefaultClient, nil
 	}
 	httpClient, err := newClientFromTLSKeyPair(s.caCert(), s.clientCert(), s.clientKey())
 	if err != nil {
 		return nil, err
 	}
-	if baseURL.Scheme == "http" {
+	if (len(s) > 0 || cfg.tlsSkipVerify) && baseURL.Scheme == "http" {
 		log.Warningf(context.Background(), "TLS configuration provided but schema registry %s uses HTTP", baseURL)
 	}
+	transport := httpClient.Transport.(*http.Transport)
+	transport.TLSClientConfig.InsecureSkipVerify = cfg.tlsSkipVerify
+	transport.DialContext = (&net.Dialer{Timeout: cfg.timeout}).DialContext
+	httpClient.Timeout = cfg.timeout
+	if proxyURL != nil {
+		setTransportProxy(transport, proxyURL)
+	}
 	return httpClient, nil
 }
 
@@ -160,7 +254,8 @@ func (r *confluentSchemaRegistry) Ping(ctx context.Context) error {
 		// don't care about the response here, only that the
 		// service is up.
 		if resp.StatusCode >= 500 {
-			return errors.Errorf("unexpected schema registry response: %s", resp.Status)
+			return markHTTPErrorClass(
+				errors.Errorf("unexpected schema registry response: %s", resp.Status), resp.StatusCode)
 		}
 		return nil
 	})
@@ -186,14 +281,20 @@ func (r *confluentSchemaRegistry) RegisterSchemaForSubject(
 
 	var id int32
 	err := r.doWithRetry(ctx, func() error {
-		resp, err := r.client.Post(ctx, u, confluentSchemaContentType, &buf)
+		resp, err := r.client.Post(ctx, u, confluentSchemaContentType, bytes.NewReader(buf.Bytes()))
 		if err != nil {
 			return errors.Wrap(err, "contacting confluent schema registry")
 		}
 		defer gracefulClose(ctx, resp.Body)
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			body, _ := io.ReadAll(resp.Body)
-			return errors.Errorf("registering schema to %s %s: %s", u, resp.Status, body)
+			err := errors.Errorf("registering schema to %s %s: %s", u, resp.Status, body)
+			// The registry responds with 409 to schemas incompatible with the
+			// subject's previous versions, and with 422 to invalid schemas.
+			if resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusUnprocessableEntity {
+				return changefeedbase.MarkErrorClass(err, changefeedbase.ErrorClassSchema)
+			}
+			return markHTTPErrorClass(err, resp.StatusCode)
 		}
 		var res confluentSchemaVersionResponse
 		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
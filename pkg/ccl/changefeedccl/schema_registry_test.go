@@ -10,9 +10,16 @@ package changefeedccl
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdctest"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/stretchr/testify/require"
@@ -31,6 +38,13 @@ func TestConfluentSchemaRegistry(t *testing.T) {
 		_, err := newConfluentSchemaRegistry(url)
 		require.Error(t, err)
 	})
+	t.Run("external connection uri uses https", func(t *testing.T) {
+		u, err := schemaRegistryURIFromConnection("confluent-schema-registry://u:p@myhost:8081/p?ca_cert=Zm9v")
+		require.NoError(t, err)
+		require.Equal(t, "https://u:p@myhost:8081/p?ca_cert=Zm9v", u)
+		_, err = schemaRegistryURIFromConnection("kafka://myhost")
+		require.Error(t, err)
+	})
 }
 
 func TestConfluentSchemaRegistryPing(t *testing.T) {
@@ -50,9 +64,112 @@ func TestConfluentSchemaRegistryPing(t *testing.T) {
 		require.NoError(t, err)
 		require.NoError(t, reg.Ping(context.Background()), "Ping")
 	})
+	t.Run("ping works through a proxy", func(t *testing.T) {
+		proxy := startConnectProxy(t, "proxy-user", "proxy-pwd")
+		u, err := url.Parse(regServer.URL())
+		require.NoError(t, err)
+		u.RawQuery = url.Values{
+			changefeedbase.RegistryParamProxyURL: {proxy.proxyURL("proxy-user", "proxy-pwd")},
+		}.Encode()
+		reg, err := newConfluentSchemaRegistry(u.String())
+		require.NoError(t, err)
+		require.Empty(t, reg.baseURL.RawQuery)
+		require.NoError(t, reg.Ping(context.Background()))
+		require.EqualValues(t, 1, atomic.LoadInt32(&proxy.requests))
+	})
+	t.Run("Ping errors with bad proxy", func(t *testing.T) {
+		u, err := url.Parse(regServer.URL())
+		require.NoError(t, err)
+		u.RawQuery = url.Values{
+			changefeedbase.RegistryParamProxyURL: {"http://host-does-exist-and-we-care:3128"},
+		}.Encode()
+		reg, err := newConfluentSchemaRegistry(u.String())
+		require.NoError(t, err)
+		require.Error(t, reg.Ping(context.Background()))
+	})
 	t.Run("Ping errors with bad host", func(t *testing.T) {
 		reg, err := newConfluentSchemaRegistry("http://host-does-exist-and-we-care")
 		require.NoError(t, err)
 		require.Error(t, reg.Ping(context.Background()))
 	})
 }
+
+func TestConfluentSchemaRegistryConfig(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+
+	t.Run("config params are parsed and removed", func(t *testing.T) {
+		reg, err := newConfluentSchemaRegistry("https://myhost:8081?" + url.Values{
+			changefeedbase.RegistryParamSkipTLSVerify: {"true"},
+			changefeedbase.RegistryParamTimeout:       {"10s"},
+			changefeedbase.RegistryParamRetryMax:      {"5"},
+			changefeedbase.RegistryParamRetryBackoff:  {"2s"},
+		}.Encode())
+		require.NoError(t, err)
+		require.Empty(t, reg.baseURL.RawQuery)
+		require.Equal(t, 10*time.Second, reg.client.Timeout)
+		require.True(t, reg.client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+		require.Equal(t, 5, reg.retryOpts.MaxRetries)
+		require.Equal(t, 2*time.Second, reg.retryOpts.InitialBackoff)
+		require.Equal(t, 2*time.Second, reg.retryOpts.MaxBackoff)
+	})
+	t.Run("invalid config params error", func(t *testing.T) {
+		for param, value := range map[string]string{
+			changefeedbase.RegistryParamSkipTLSVerify: "maybe",
+			changefeedbase.RegistryParamTimeout:       "0s",
+			changefeedbase.RegistryParamRetryMax:      "-1",
+			changefeedbase.RegistryParamRetryBackoff:  "soon",
+		} {
+			_, err := newConfluentSchemaRegistry("https://myhost:8081?" + url.Values{param: {value}}.Encode())
+			require.ErrorContains(t, err, param)
+		}
+	})
+	t.Run("self-signed registries can be used without verification", func(t *testing.T) {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srv.Close()
+		reg, err := newConfluentSchemaRegistry(srv.URL)
+		require.NoError(t, err)
+		reg.retryOpts.MaxRetries = 0
+		require.Error(t, reg.Ping(ctx))
+		reg, err = newConfluentSchemaRegistry(srv.URL + "?" + changefeedbase.RegistryParamSkipTLSVerify + "=true")
+		require.NoError(t, err)
+		require.NoError(t, reg.Ping(ctx))
+	})
+	t.Run("failed registrations are retried", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) <= 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			var req confluentSchemaVersionRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Schema != `"string"` {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(confluentSchemaVersionResponse{ID: 7})
+		}))
+		defer srv.Close()
+
+		reg, err := newConfluentSchemaRegistry(srv.URL + "?" + url.Values{
+			changefeedbase.RegistryParamRetryMax:     {"2"},
+			changefeedbase.RegistryParamRetryBackoff: {"1ms"},
+		}.Encode())
+		require.NoError(t, err)
+		_, err = reg.RegisterSchemaForSubject(ctx, "foo", `"string"`)
+		require.Error(t, err)
+		require.True(t, changefeedbase.IsRetryableError(err))
+
+		atomic.StoreInt32(&requests, 0)
+		reg, err = newConfluentSchemaRegistry(srv.URL + "?" + url.Values{
+			changefeedbase.RegistryParamRetryMax:     {"3"},
+			changefeedbase.RegistryParamRetryBackoff: {"1ms"},
+		}.Encode())
+		require.NoError(t, err)
+		id, err := reg.RegisterSchemaForSubject(ctx, "foo", `"string"`)
+		require.NoError(t, err)
+		require.EqualValues(t, 7, id)
+	})
+}
@@ -15,19 +15,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 )
 
-const TestingAllEventFilter = "testing"
-
-func init() {
-	schemaChangeEventFilters[TestingAllEventFilter] = tableEventFilter{
-		tableEventDropColumn:                  false,
-		tableEventAddColumnWithBackfill:       false,
-		tableEventAddColumnNoBackfill:         false,
-		tableEventUnknown:                     false,
-		tableEventPrimaryKeyChange:            false,
-		tableEventLocalityRegionalByRowChange: false,
-		tableEventAddHiddenColumn:             false,
-	}
-}
+const TestingAllEventFilter = AllTableEventsClass
 
 var ClassifyEvent = classifyTableEvent
 
@@ -74,9 +74,13 @@ type SchemaFeed interface {
 // of ts1, they care about write which occur at ts1.Next() and later but they
 // should scan the tables as of ts1. This is important so that writes which
 // change the table at ts1.Next() are emitted as an event.
+//
+// If tenantID is set, the targets are tables of that secondary tenant rather
+// than of the local tenant.
 func New(
 	ctx context.Context,
 	cfg *execinfra.ServerConfig,
+	tenantID roachpb.TenantID,
 	events changefeedbase.SchemaChangeEventClass,
 	targets changefeedbase.Targets,
 	initialHighwater hlc.Timestamp,
@@ -89,10 +93,16 @@ func New(
 		clock:      cfg.DB.KV().Clock(),
 		settings:   cfg.Settings,
 		targets:    targets,
-		leaseMgr:   cfg.LeaseManager.(*lease.Manager),
+		codec:      cfg.Codec,
 		metrics:    metrics,
 		tolerances: tolerances,
 	}
+	if tenantID.IsSet() {
+		m.codec = keys.MakeSQLCodec(tenantID)
+		m.tenantDescs = descs.NewBareBonesCollectionFactory(cfg.Settings, m.codec)
+	} else {
+		m.leaseMgr = cfg.LeaseManager.(*lease.Manager)
+	}
 	m.mu.previousTableVersion = make(map[descpb.ID]catalog.TableDescriptor)
 	m.mu.highWater = initialHighwater
 	m.mu.typeDeps = typeDependencyTracker{deps: make(map[descpb.ID][]descpb.ID)}
@@ -115,13 +125,18 @@ type schemaFeed struct {
 	clock      *hlc.Clock
 	settings   *cluster.Settings
 	targets    changefeedbase.Targets
+	codec      keys.SQLCodec
 	metrics    *Metrics
 	tolerances changefeedbase.CanHandle
 
 	// TODO(ajwerner): Should this live underneath the FilterFunc?
 	// Should there be another function to decide whether to update the
 	// lease manager?
-	leaseMgr *lease.Manager
+	//
+	// leaseMgr is nil when the targets are tables of a secondary tenant, whose
+	// descriptors are not leased. tenantDescs then reads them from storage.
+	leaseMgr    *lease.Manager
+	tenantDescs *descs.CollectionFactory
 
 	mu struct {
 		syncutil.Mutex
@@ -261,16 +276,15 @@ func (tf *schemaFeed) primeInitialTableDescs(ctx context.Context) error {
 	tf.mu.Unlock()
 	var initialDescs []catalog.Descriptor
 	initialTableDescsFn := func(
-		ctx context.Context, txn descs.Txn,
+		ctx context.Context, txn *kv.Txn, descriptors *descs.Collection,
 	) error {
-		descriptors := txn.Descriptors()
 		initialDescs = initialDescs[:0]
-		if err := txn.KV().SetFixedTimestamp(ctx, initialTableDescTs); err != nil {
+		if err := txn.SetFixedTimestamp(ctx, initialTableDescTs); err != nil {
 			return err
 		}
 		// Note that all targets are currently guaranteed to be tables.
 		return tf.targets.EachTableID(func(id descpb.ID) error {
-			tableDesc, err := descriptors.ByID(txn.KV()).WithoutNonPublic().Get().Table(ctx, id)
+			tableDesc, err := descriptors.ByID(txn).WithoutNonPublic().Get().Table(ctx, id)
 			if err != nil {
 				return err
 			}
@@ -279,7 +293,19 @@ func (tf *schemaFeed) primeInitialTableDescs(ctx context.Context) error {
 		})
 	}
 
-	if err := tf.db.DescsTxn(ctx, initialTableDescsFn); err != nil {
+	var err error
+	if tf.tenantDescs != nil {
+		err = tf.db.KV().Txn(ctx, func(ctx context.Context, txn *kv.Txn) error {
+			descriptors := tf.tenantDescs.NewCollection(ctx)
+			defer descriptors.ReleaseAll(ctx)
+			return initialTableDescsFn(ctx, txn, descriptors)
+		})
+	} else {
+		err = tf.db.DescsTxn(ctx, func(ctx context.Context, txn descs.Txn) error {
+			return initialTableDescsFn(ctx, txn.KV(), txn.Descriptors())
+		})
+	}
+	if err != nil {
 		return err
 	}
 
@@ -507,6 +533,9 @@ func (tf *schemaFeed) validateDescriptor(
 		}
 		// If a interesting type changed, then we just want to force the lease
 		// manager to acquire the freshest version of the type.
+		if tf.leaseMgr == nil {
+			return nil
+		}
 		return tf.leaseMgr.AcquireFreshestFromStore(ctx, desc.GetID())
 	case catalog.TableDescriptor:
 		if err := changefeedvalidators.ValidateTable(tf.targets, desc, tf.tolerances); err != nil {
@@ -526,8 +555,10 @@ func (tf *schemaFeed) validateDescriptor(
 			// allowed; without this explicit load, the lease manager might therefore
 			// return the previous version of the table, which is still technically
 			// allowed by the schema change system.
-			if err := tf.leaseMgr.AcquireFreshestFromStore(ctx, desc.GetID()); err != nil {
-				return err
+			if tf.leaseMgr != nil {
+				if err := tf.leaseMgr.AcquireFreshestFromStore(ctx, desc.GetID()); err != nil {
+					return err
+				}
 			}
 
 			// Purge the old version of the table from the type mapping.
@@ -537,7 +568,7 @@ func (tf *schemaFeed) validateDescriptor(
 				Before: lastVersion,
 				After:  desc,
 			}
-			shouldFilter, err := tf.filter.shouldFilter(ctx, e, tf.targets)
+			shouldFilter, err := tf.filter.shouldFilter(ctx, e, tf.targets, tf.tolerances.Truncate)
 			log.VEventf(ctx, 1, "validate shouldFilter %v %v", formatEvent(e), shouldFilter)
 			if err != nil {
 				return changefeedbase.WithTerminalError(err)
@@ -625,7 +656,7 @@ func (tf *schemaFeed) fetchDescriptorVersions(
 	if log.ExpensiveLogEnabled(ctx, 2) {
 		log.Infof(ctx, `fetching table descs (%s,%s]`, startTS, endTS)
 	}
-	codec := tf.leaseMgr.Codec()
+	codec := tf.codec
 	start := timeutil.Now()
 	span := roachpb.Span{Key: codec.TablePrefix(keys.DescriptorTableID)}
 	span.EndKey = span.Key.PrefixEnd()
@@ -68,6 +68,17 @@ func SetLocalityRegionalByRow(desc catalog.TableDescriptor) catalog.TableDescrip
 	return tabledesc.NewBuilder(desc.TableDesc()).BuildImmutableTable()
 }
 
+// SetOffline takes the table descriptor offline for the given reason, or
+// brings it back online if the reason is empty.
+func SetOffline(desc catalog.TableDescriptor, reason string) catalog.TableDescriptor {
+	desc.TableDesc().State = descpb.DescriptorState_PUBLIC
+	if reason != "" {
+		desc.TableDesc().State = descpb.DescriptorState_OFFLINE
+	}
+	desc.TableDesc().OfflineReason = reason
+	return tabledesc.NewBuilder(desc.TableDesc()).BuildImmutableTable()
+}
+
 // AddColumnDropBackfillMutation adds a mutation to desc to drop a column.
 // Yes, this does modify an immutable.
 func AddColumnDropBackfillMutation(desc catalog.TableDescriptor) catalog.TableDescriptor {
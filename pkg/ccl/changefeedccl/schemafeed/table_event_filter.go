@@ -33,11 +33,17 @@ const (
 	tableEventPrimaryKeyChange
 	tableEventLocalityRegionalByRowChange
 	tableEventAddHiddenColumn
+	tableEventOffline
 	numEventTypes int = iota
 )
 
 type tableEventTypeSet uint64
 
+// AllTableEventsClass is a schema change event class, used by testing knobs,
+// which lets every table event through, including those which change no
+// columns.
+const AllTableEventsClass changefeedbase.SchemaChangeEventClass = "all"
+
 var (
 	defaultTableEventFilter = tableEventFilter{
 		tableEventDropColumn:                  false,
@@ -59,9 +65,20 @@ var (
 		tableEventAddHiddenColumn:             true,
 	}
 
+	allTableEventFilter = tableEventFilter{
+		tableEventDropColumn:                  false,
+		tableEventAddColumnWithBackfill:       false,
+		tableEventAddColumnNoBackfill:         false,
+		tableEventUnknown:                     false,
+		tableEventPrimaryKeyChange:            false,
+		tableEventLocalityRegionalByRowChange: false,
+		tableEventAddHiddenColumn:             false,
+	}
+
 	schemaChangeEventFilters = map[changefeedbase.SchemaChangeEventClass]tableEventFilter{
 		changefeedbase.OptSchemaChangeEventClassDefault:      defaultTableEventFilter,
 		changefeedbase.OptSchemaChangeEventClassColumnChange: columnChangeTableEventFilter,
+		AllTableEventsClass: allTableEventFilter,
 	}
 )
 
@@ -112,6 +129,7 @@ func classifyTableEvent(e TableEvent) tableEventTypeSet {
 		{tableEventDropColumn, hasNewVisibleColumnDropBackfillMutation},
 		{tableEventTruncate, tableTruncated},
 		{tableEventLocalityRegionalByRowChange, regionalByRowChanged},
+		{tableEventOffline, offlineChanged},
 	} {
 		if c.predicate(e) {
 			et |= c.eventType.mask()
@@ -125,13 +143,29 @@ func classifyTableEvent(e TableEvent) tableEventTypeSet {
 type tableEventFilter map[tableEventType]bool
 
 func (filter tableEventFilter) shouldFilter(
-	ctx context.Context, e TableEvent, targets changefeedbase.Targets,
+	ctx context.Context, e TableEvent, targets changefeedbase.Targets, canHandleTruncate bool,
 ) (bool, error) {
 	et := classifyTableEvent(e)
 
-	// Truncation events are not ignored and return an error.
+	// Truncation events are not ignored and return an error, unless the
+	// changefeed handles them.
 	if et.Contains(tableEventTruncate) {
-		return false, errors.Errorf(`"%s" was truncated`, e.Before.GetName())
+		if canHandleTruncate {
+			return false, nil
+		}
+		return false, errors.WithHintf(
+			errors.Errorf(`"%s" was truncated (%s=%s)`, e.Before.GetName(),
+				changefeedbase.OptOnTruncate, changefeedbase.OptOnTruncateFail),
+			`set %s to %s or %s to continue changefeeds past the truncation of their tables`,
+			changefeedbase.OptOnTruncate, changefeedbase.OptOnTruncateRescan,
+			changefeedbase.OptOnTruncateEmitMarker)
+	}
+
+	// A table is only let through the schema feed while it is offline if the
+	// changefeed waits for it to come back online, which it must then know
+	// about.
+	if et.Contains(tableEventOffline) {
+		return false, nil
 	}
 
 	if et.empty() {
@@ -331,6 +365,12 @@ func primaryKeyChanged(e TableEvent) bool {
 		pkChangeMutationExists(e.Before)
 }
 
+// offlineChanged returns whether the table was taken offline, e.g. by an
+// IMPORT INTO, or came back online.
+func offlineChanged(e TableEvent) bool {
+	return e.Before.Offline() != e.After.Offline()
+}
+
 func regionalByRowChanged(e TableEvent) bool {
 	return e.Before.IsLocalityRegionalByRow() != e.After.IsLocalityRegionalByRow()
 }
@@ -420,6 +460,24 @@ func IsOnlyPrimaryIndexChange(e TableEvent) bool {
 	return classifyTableEvent(e) == tableEventPrimaryKeyChange.mask()
 }
 
+// IsTruncate returns true if the event corresponds to the truncation of the
+// table, which replaces its primary index with a new, empty, one.
+func IsTruncate(e TableEvent) bool {
+	return classifyTableEvent(e).Contains(tableEventTruncate)
+}
+
+// IsOffline returns true if the event corresponds to the table being taken
+// offline.
+func IsOffline(e TableEvent) bool {
+	return classifyTableEvent(e).Contains(tableEventOffline) && e.After.Offline()
+}
+
+// IsBackOnline returns true if the event corresponds to the table coming back
+// online after having been offline.
+func IsBackOnline(e TableEvent) bool {
+	return classifyTableEvent(e).Contains(tableEventOffline) && !e.After.Offline()
+}
+
 // IsRegionalByRowChange returns true if the event corresponds to a
 // change in the table's locality to or from RegionalByRow.
 func IsRegionalByRowChange(e TableEvent) bool {
@@ -18,6 +18,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/schemafeed"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/testutils/datapathutils"
@@ -119,7 +120,7 @@ func TestDataDriven(t *testing.T) {
 				cfg := &ts.SQLServer().(*sql.Server).GetExecutorConfig().DistSQLSrv.ServerConfig
 				now := ts.Clock().Now()
 				targets := parseTargets(t, d.Input)
-				f := schemafeed.New(ctx, cfg, schemafeed.TestingAllEventFilter, targets, now, nil, changefeedbase.CanHandle{
+				f := schemafeed.New(ctx, cfg, roachpb.TenantID{}, schemafeed.TestingAllEventFilter, targets, now, nil, changefeedbase.CanHandle{
 					MultipleColumnFamilies: true,
 					VirtualColumns:         true,
 				})
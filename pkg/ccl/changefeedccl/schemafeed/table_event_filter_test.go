@@ -257,18 +257,91 @@ func TestTableEventFilterErrorsWithIncompletePolicy(t *testing.T) {
 	}
 	changefeedTargets := CreateChangefeedTargets(42)
 
-	_, err := incompleteFilter.shouldFilter(context.Background(), dropColEvent, changefeedTargets)
+	_, err := incompleteFilter.shouldFilter(
+		context.Background(), dropColEvent, changefeedTargets, false, /* canHandleTruncate */
+	)
 	require.Error(t, err)
 
 	unknownEvent := TableEvent{
 		Before: mkTableDesc(42, 1, ts(2), 2, 1),
 		After:  mkTableDesc(42, 1, ts(2), 2, 1),
 	}
-	_, err = incompleteFilter.shouldFilter(context.Background(), unknownEvent, changefeedTargets)
+	_, err = incompleteFilter.shouldFilter(
+		context.Background(), unknownEvent, changefeedTargets, false, /* canHandleTruncate */
+	)
 	require.Error(t, err)
 
 }
 
+func TestTableEventFilterTruncate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ts := func(seconds int) hlc.Timestamp {
+		return hlc.Timestamp{WallTime: (time.Duration(seconds) * time.Second).Nanoseconds()}
+	}
+	mkTableDesc := schematestutils.MakeTableDesc
+
+	// TRUNCATE replaces the primary index without a primary key swap.
+	truncateEvent := TableEvent{
+		Before: mkTableDesc(42, 1, ts(2), 2, 1),
+		After:  mkTableDesc(42, 2, ts(3), 2, 2),
+	}
+	require.True(t, IsTruncate(truncateEvent))
+	changefeedTargets := CreateChangefeedTargets(42)
+
+	_, err := defaultTableEventFilter.shouldFilter(
+		context.Background(), truncateEvent, changefeedTargets, false, /* canHandleTruncate */
+	)
+	require.EqualError(t, err, `"foo" was truncated (on_truncate=fail)`)
+
+	// Changefeeds which handle truncations are always sent them.
+	for _, filter := range schemaChangeEventFilters {
+		shouldFilter, err := filter.shouldFilter(
+			context.Background(), truncateEvent, changefeedTargets, true, /* canHandleTruncate */
+		)
+		require.NoError(t, err)
+		require.False(t, shouldFilter)
+	}
+}
+
+func TestTableEventFilterOffline(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ts := func(seconds int) hlc.Timestamp {
+		return hlc.Timestamp{WallTime: (time.Duration(seconds) * time.Second).Nanoseconds()}
+	}
+	var (
+		mkTableDesc = schematestutils.MakeTableDesc
+		setOffline  = schematestutils.SetOffline
+	)
+
+	offlineEvent := TableEvent{
+		Before: mkTableDesc(42, 1, ts(2), 2, 1),
+		After:  setOffline(mkTableDesc(42, 2, ts(3), 2, 1), "importing"),
+	}
+	require.True(t, IsOffline(offlineEvent))
+	require.False(t, IsBackOnline(offlineEvent))
+	onlineEvent := TableEvent{
+		Before: setOffline(mkTableDesc(42, 2, ts(3), 2, 1), "importing"),
+		After:  mkTableDesc(42, 3, ts(4), 2, 1),
+	}
+	require.False(t, IsOffline(onlineEvent))
+	require.True(t, IsBackOnline(onlineEvent))
+
+	// Changefeeds which wait for offline tables, which are the only ones the
+	// schema feed lets offline tables through to, are always sent them.
+	changefeedTargets := CreateChangefeedTargets(42)
+	for _, e := range []TableEvent{offlineEvent, onlineEvent} {
+		for _, filter := range schemaChangeEventFilters {
+			shouldFilter, err := filter.shouldFilter(
+				context.Background(), e, changefeedTargets, false, /* canHandleTruncate */
+			)
+			require.NoError(t, err)
+			require.False(t, shouldFilter)
+		}
+	}
+}
+
 func TestTableEventFilter(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -392,7 +465,9 @@ func TestTableEventFilter(t *testing.T) {
 		},
 	} {
 		t.Run(c.name, func(t *testing.T) {
-			shouldFilter, err := c.p.shouldFilter(context.Background(), c.e, CreateChangefeedTargets(42))
+			shouldFilter, err := c.p.shouldFilter(
+				context.Background(), c.e, CreateChangefeedTargets(42), false, /* canHandleTruncate */
+			)
 			require.NoError(t, err)
 			require.Equalf(t, c.exp, shouldFilter, "event %v", c.e)
 		})
@@ -10,6 +10,7 @@ package changefeedccl
 
 import (
 	"context"
+	"crypto/rand"
 	"net/url"
 	"strings"
 	"time"
@@ -49,6 +50,9 @@ const (
 	sinkTypePubsub
 	sinkTypeCloudstorage
 	sinkTypeSQL
+	sinkTypeCache
+	sinkTypeStream
+	sinkTypeFile
 )
 
 // externalResource is the interface common to both EventSink and
@@ -100,6 +104,130 @@ type ResolvedTimestampSink interface {
 	EmitResolvedTimestamp(ctx context.Context, encoder Encoder, resolved hlc.Timestamp) error
 }
 
+// TargetResolvedTimestampSink is implemented by sinks which can emit resolved
+// timestamps to the topics of some of the targets of a changefeed.
+type TargetResolvedTimestampSink interface {
+	// EmitResolvedTimestampForTargets is like EmitResolvedTimestamp, but only
+	// emits to the topics of the targets for which include returns true.
+	EmitResolvedTimestampForTargets(
+		ctx context.Context,
+		encoder Encoder,
+		resolved hlc.Timestamp,
+		include func(changefeedbase.Target) bool,
+	) error
+}
+
+// canEmitResolvedTimestampForTargets returns whether the sink, and every sink
+// it wraps, implements TargetResolvedTimestampSink.
+func canEmitResolvedTimestampForTargets(s externalResource) bool {
+	switch s := s.(type) {
+	case *errorWrapperSink:
+		return canEmitResolvedTimestampForTargets(s.wrapped)
+	case *batchEnvelopeSink:
+		return canEmitResolvedTimestampForTargets(s.wrapped)
+	case *latencySink:
+		return canEmitResolvedTimestampForTargets(s.wrapped)
+	case *emitTimeSink:
+		return canEmitResolvedTimestampForTargets(s.wrapped)
+	case *coalesceSink:
+		return canEmitResolvedTimestampForTargets(s.wrapped)
+	case *fanOutSink:
+		for _, c := range s.sinks {
+			if !canEmitResolvedTimestampForTargets(c.sink) {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := s.(TargetResolvedTimestampSink)
+	return ok
+}
+
+// TopicCreatingSink is implemented by sinks which create the topics they
+// emit to, so that the changefeed can record which topics it created.
+type TopicCreatingSink interface {
+	// DrainCreatedTopics returns the topics created by the sink since it was
+	// last called. Topics which already existed are not returned.
+	DrainCreatedTopics() []string
+}
+
+// TopicDeletingSink is implemented by sinks which can delete the topics of a
+// changefeed, once it has completed.
+type TopicDeletingSink interface {
+	// DeleteTopics deletes the given topics. Topics which don't exist are
+	// ignored.
+	DeleteTopics(ctx context.Context, topics []string) error
+}
+
+// unwrapSink returns the sink wrapped by s, if s is one of the sinks which
+// wrap the sinks of any scheme, or s itself.
+func unwrapSink(s externalResource) externalResource {
+	for {
+		switch w := s.(type) {
+		case *errorWrapperSink:
+			s = w.wrapped
+		case *batchEnvelopeSink:
+			s = w.wrapped
+		case *latencySink:
+			s = w.wrapped
+		case *emitTimeSink:
+			s = w.wrapped
+		case *coalesceSink:
+			s = w.wrapped
+		case *safeSink:
+			s = w.wrapped
+		default:
+			return s
+		}
+	}
+}
+
+// asTopicCreatingSink returns the sink, or the sink it wraps, as a
+// TopicCreatingSink, if it is one.
+func asTopicCreatingSink(s externalResource) (TopicCreatingSink, bool) {
+	c, ok := unwrapSink(s).(TopicCreatingSink)
+	return c, ok
+}
+
+// asTopicDeletingSink returns the sink, or the sink it wraps, as a
+// TopicDeletingSink, if it is one.
+func asTopicDeletingSink(s externalResource) (TopicDeletingSink, bool) {
+	d, ok := unwrapSink(s).(TopicDeletingSink)
+	return d, ok
+}
+
+// BufferingSink is implemented by sinks which buffer the messages emitted to
+// them, or send them asynchronously, so that the changefeed can report the
+// backlog of messages it has yet to deliver.
+type BufferingSink interface {
+	// BufferedBytes returns the size of the messages emitted to the sink which
+	// have yet to be delivered.
+	BufferedBytes() int64
+}
+
+// asBufferingSink returns the sink, or the sink it wraps, as a BufferingSink,
+// if it is one.
+func asBufferingSink(s externalResource) (BufferingSink, bool) {
+	b, ok := unwrapSink(s).(BufferingSink)
+	return b, ok
+}
+
+// SchemaDescribingSink is implemented by sinks which describe the columns of
+// each table version to their consumers.
+type SchemaDescribingSink interface {
+	// DescribeSchema is called with the primary key and value columns of each
+	// version of the table of a topic before the first row of that version is
+	// emitted to the sink.
+	DescribeSchema(topic TopicDescriptor, keyCols, valueCols []cdcevent.ResultColumn)
+}
+
+// asSchemaDescribingSink returns the sink, or the sink it wraps, as a
+// SchemaDescribingSink, if it is one.
+func asSchemaDescribingSink(s externalResource) (SchemaDescribingSink, bool) {
+	d, ok := unwrapSink(s).(SchemaDescribingSink)
+	return d, ok
+}
+
 // SinkWithTopics extends the Sink interface to include a method that returns
 // the topics that a changefeed will emit to.
 type SinkWithTopics interface {
@@ -155,6 +283,17 @@ func getSink(
 	jobID jobspb.JobID,
 	m metricsRecorder,
 ) (Sink, error) {
+	if len(feedCfg.AdditionalSinkURIs) > 0 {
+		// Each sink is created, and wrapped, as though it were the only one.
+		f, err := makeFanOutSink(feedCfg, func(childCfg jobspb.ChangefeedDetails) (Sink, error) {
+			return getSink(ctx, serverCfg, childCfg, timestampOracle, user, jobID, m)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
 	u, err := url.Parse(feedCfg.SinkURI)
 	if err != nil {
 		return nil, err
@@ -182,15 +321,15 @@ func getSink(
 	}
 
 	newSink := func() (Sink, error) {
-		if feedCfg.SinkURI == "" {
-			return &bufferSink{metrics: m}, nil
-		}
-
 		encodingOpts, err := opts.GetEncodingOptions()
 		if err != nil {
 			return nil, err
 		}
 
+		if feedCfg.SinkURI == "" {
+			return makeBufferSink(encodingOpts, m)
+		}
+
 		switch {
 		case u.Scheme == changefeedbase.SinkSchemeNull:
 			nullIsAccounted := false
@@ -200,7 +339,7 @@ func getSink(
 			return makeNullSink(sinkURL{URL: u}, metricsBuilder(nullIsAccounted))
 		case u.Scheme == changefeedbase.SinkSchemeKafka:
 			return validateOptionsAndMakeSink(changefeedbase.KafkaValidOptions, func() (Sink, error) {
-				return makeKafkaSink(ctx, sinkURL{URL: u}, AllTargets(feedCfg), opts.GetKafkaConfigJSON(), serverCfg.Settings, metricsBuilder)
+				return makeKafkaSink(ctx, sinkURL{URL: u}, AllTargets(feedCfg), encodingOpts, opts.GetKafkaConfigJSON(), serverCfg.Settings, metricsBuilder)
 			})
 		case isWebhookSink(u):
 			webhookOpts, err := opts.GetWebhookSinkOptions()
@@ -209,11 +348,16 @@ func getSink(
 			}
 			return validateOptionsAndMakeSink(changefeedbase.WebhookValidOptions, func() (Sink, error) {
 				return makeWebhookSink(ctx, sinkURL{URL: u}, encodingOpts, webhookOpts,
-					defaultWorkerCount(), timeutil.DefaultTimeSource{}, metricsBuilder)
+					defaultWorkerCount(), timeutil.DefaultTimeSource{}, &serverCfg.Settings.SV, metricsBuilder)
 			})
 		case isPubsubSink(u):
 			// TODO: add metrics to pubsubsink
-			return MakePubsubSink(ctx, u, encodingOpts, AllTargets(feedCfg), opts.IsSet(changefeedbase.OptUnordered))
+			skipCredentials := false
+			if knobs, ok := serverCfg.TestingKnobs.Changefeed.(*TestingKnobs); ok {
+				skipCredentials = knobs.PubsubClientSkipCredentialsCheck
+			}
+			return MakePubsubSink(ctx, u, encodingOpts, AllTargets(feedCfg), opts.IsSet(changefeedbase.OptUnordered),
+				opts.GetPubsubConfigJSON(), skipCredentials)
 		case isCloudStorageSink(u):
 			return validateOptionsAndMakeSink(changefeedbase.CloudStorageValidOptions, func() (Sink, error) {
 				// Placeholder id for canary sink
@@ -223,12 +367,30 @@ func getSink(
 				}
 				return makeCloudStorageSink(
 					ctx, sinkURL{URL: u}, nodeID, serverCfg.Settings, encodingOpts,
-					timestampOracle, serverCfg.ExternalStorageFromURI, user, metricsBuilder,
+					timestampOracle, serverCfg.ExternalStorageFromURI, user, jobID, metricsBuilder,
 				)
 			})
+		case isCacheSink(u):
+			return validateOptionsAndMakeSink(changefeedbase.CacheValidOptions, func() (Sink, error) {
+				return makeCacheSink(sinkURL{URL: u}, encodingOpts, metricsBuilder)
+			})
+		case u.Scheme == changefeedbase.SinkSchemeStream:
+			return validateOptionsAndMakeSink(changefeedbase.StreamValidOptions, func() (Sink, error) {
+				return makeStreamSink(sinkURL{URL: u}, jobID, AllTargets(feedCfg), encodingOpts, metricsBuilder)
+			})
+		case u.Scheme == changefeedbase.SinkSchemeSidecar:
+			return validateOptionsAndMakeSink(changefeedbase.StreamValidOptions, func() (Sink, error) {
+				return makeSidecarSink(sinkURL{URL: u}, &serverCfg.Settings.SV, jobID, AllTargets(feedCfg),
+					encodingOpts, metricsBuilder)
+			})
+		case u.Scheme == changefeedbase.SinkSchemeFile:
+			return validateOptionsAndMakeSink(changefeedbase.FileValidOptions, func() (Sink, error) {
+				return makeFileSink(sinkURL{URL: u}, serverCfg.Settings.ExternalIODir, jobID, AllTargets(feedCfg),
+					encodingOpts, metricsBuilder)
+			})
 		case u.Scheme == changefeedbase.SinkSchemeExperimentalSQL:
 			return validateOptionsAndMakeSink(changefeedbase.SQLValidOptions, func() (Sink, error) {
-				return makeSQLSink(sinkURL{URL: u}, sqlSinkTableName, AllTargets(feedCfg), metricsBuilder)
+				return makeSQLSink(sinkURL{URL: u}, sqlSinkTableName, AllTargets(feedCfg), encodingOpts, metricsBuilder)
 			})
 		case u.Scheme == changefeedbase.SinkSchemeExternalConnection:
 			return validateOptionsAndMakeSink(changefeedbase.ExternalConnectionValidOptions, func() (Sink, error) {
@@ -237,6 +399,9 @@ func getSink(
 					serverCfg, feedCfg, timestampOracle, jobID, m,
 				)
 			})
+		case u.Scheme == changefeedbase.SinkSchemeFTPS:
+			return nil, errors.WithHintf(errors.Errorf(`unsupported sink: %s`, u.Scheme),
+				`FTPS is not supported; use an %s:// sink instead`, changefeedbase.SinkSchemeCloudStorageSFTP)
 		case u.Scheme == "":
 			return nil, errors.Errorf(`no scheme found for sink URL %q`, feedCfg.SinkURI)
 		default:
@@ -248,10 +413,49 @@ func getSink(
 	if err != nil {
 		return nil, err
 	}
+	if serverCfg.JobRegistry != nil {
+		if metrics, ok := serverCfg.JobRegistry.MetricsStruct().Changefeed.(*Metrics); ok {
+			maybeSetClientPool(sink, metrics.sinkClients, &serverCfg.Settings.SV)
+		}
+	}
+
+	// External connections call getSink recursively and wrap the sink then.
+	if u.Scheme != changefeedbase.SinkSchemeExternalConnection {
+		if opts.IsSet(changefeedbase.OptLatencyTimestamps) {
+			// The emit times of messages are stamped as they are written to the
+			// sink itself, rather than to the sinks which buffer them in front
+			// of it.
+			sink = maybeWrapEmitTimeSink(sink)
+		}
+		batchSize, err := opts.GetBatchEnvelopeSize()
+		if err != nil {
+			return nil, err
+		}
+		if batchSize > 0 {
+			switch sink.getConcreteType() {
+			case sinkTypeKafka, sinkTypePubsub:
+				sink = makeBatchEnvelopeSink(sink, batchSize)
+			default:
+				return nil, errors.Errorf(`%s is only supported by kafka and pubsub sinks`,
+					changefeedbase.OptBatchEnvelopeSize)
+			}
+		}
+		coalesceWindow, err := opts.GetCoalesceWindow()
+		if err != nil {
+			return nil, err
+		}
+		if coalesceWindow > 0 {
+			sink = makeCoalesceSink(sink, coalesceWindow, timeutil.DefaultTimeSource{})
+		}
+	}
 
-	if knobs, ok := serverCfg.TestingKnobs.Changefeed.(*TestingKnobs); ok && knobs.WrapSink != nil {
+	if knobs, ok := serverCfg.TestingKnobs.Changefeed.(*TestingKnobs); ok &&
+		u.Scheme != changefeedbase.SinkSchemeExternalConnection {
 		// External connections call getSink recursively and wrap the sink then.
-		if u.Scheme != changefeedbase.SinkSchemeExternalConnection {
+		if knobs.SinkWriteLatency != nil {
+			sink = makeLatencySink(sink, knobs.SinkWriteLatency)
+		}
+		if knobs.WrapSink != nil {
 			sink = knobs.WrapSink(sink, jobID)
 		}
 	}
@@ -274,6 +478,20 @@ func validateSinkOptions(opts map[string]string, sinkSpecificOpts map[string]str
 	return nil
 }
 
+// incompatibleEnvelopeError returns the error of a sink which can't emit
+// messages in the envelope. Users of envelope=row, which has no room for the
+// metadata sinks such as webhook and cloud storage add to each message, are
+// pointed at envelope=bare, which nests the metadata under a single key.
+func incompatibleEnvelopeError(envelope changefeedbase.EnvelopeType) error {
+	err := errors.Errorf(`this sink is incompatible with %s=%s`, changefeedbase.OptEnvelope, envelope)
+	if envelope == changefeedbase.OptEnvelopeRow {
+		err = errors.WithHintf(err, `use %s=%s to emit rows without a wrapper; the metadata of each `+
+			`message is nested under the key of the %s option`,
+			changefeedbase.OptEnvelope, changefeedbase.OptEnvelopeBare, changefeedbase.OptBareMetadataKey)
+	}
+	return err
+}
+
 // sinkURL is a helper struct which for "consuming" URL query
 // parameters from the underlying URL.
 type sinkURL struct {
@@ -374,6 +592,23 @@ func (s errorWrapperSink) EmitResolvedTimestamp(
 	return nil
 }
 
+// EmitResolvedTimestampForTargets implements TargetResolvedTimestampSink.
+func (s errorWrapperSink) EmitResolvedTimestampForTargets(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	include func(changefeedbase.Target) bool,
+) error {
+	sink, ok := s.wrapped.(TargetResolvedTimestampSink)
+	if !ok {
+		return errors.AssertionFailedf(`sink does not support per table resolved timestamps`)
+	}
+	if err := sink.EmitResolvedTimestampForTargets(ctx, encoder, resolved, include); err != nil {
+		return changefeedbase.MarkRetryableError(err)
+	}
+	return nil
+}
+
 // Flush implements Sink interface.
 func (s errorWrapperSink) Flush(ctx context.Context) error {
 	if err := s.wrapped.(EventSink).Flush(ctx); err != nil {
@@ -434,6 +669,25 @@ type bufferSink struct {
 	scratch bufalloc.ByteAllocator
 	closed  bool
 	metrics metricsRecorder
+
+	// schemaRegistry, if set, records the schemas of avro messages, which are
+	// emitted with their schema inlined since sinkless changefeeds have no
+	// schema registry. avroSync is the sync marker of those messages.
+	schemaRegistry *sinkSchemaRegistry
+	avroSync       [avroOCFSyncSize]byte
+}
+
+func makeBufferSink(
+	encodingOpts changefeedbase.EncodingOptions, m metricsRecorder,
+) (*bufferSink, error) {
+	s := &bufferSink{metrics: m}
+	if encodingOpts.Format == changefeedbase.OptFormatAvro && encodingOpts.SchemaRegistryURI == `` {
+		s.schemaRegistry = newSinkSchemaRegistry()
+		if _, err := rand.Read(s.avroSync[:]); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 func (s *bufferSink) getConcreteType() sinkType {
@@ -455,6 +709,19 @@ func (s *bufferSink) EmitRow(
 		return errors.New(`cannot EmitRow on a closed sink`)
 	}
 
+	if s.schemaRegistry != nil {
+		var err error
+		if key, err = inlineAvroSchema(s.schemaRegistry, s.avroSync, key); err != nil {
+			return err
+		}
+		// The value of a key_only message is empty.
+		if len(value) > 0 {
+			if value, err = inlineAvroSchema(s.schemaRegistry, s.avroSync, value); err != nil {
+				return err
+			}
+		}
+	}
+
 	s.buf.Push(rowenc.EncDatumRow{
 		{Datum: tree.DNull}, // resolved span
 		{Datum: s.getTopicDatum(topic)},
@@ -478,6 +745,11 @@ func (s *bufferSink) EmitResolvedTimestamp(
 	if err != nil {
 		return err
 	}
+	if s.schemaRegistry != nil {
+		if payload, err = inlineAvroSchema(s.schemaRegistry, s.avroSync, payload); err != nil {
+			return err
+		}
+	}
 	s.scratch, payload = s.scratch.Copy(payload, 0 /* extraCap */)
 	s.buf.Push(rowenc.EncDatumRow{
 		{Datum: tree.DNull}, // resolved span
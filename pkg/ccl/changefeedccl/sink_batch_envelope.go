@@ -0,0 +1,198 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"strconv"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/errors"
+)
+
+// batchEnvelopeBuckets is the number of batches which may be accumulated per
+// topic. Rows are assigned to a bucket by hashing their key, and every batch
+// of a bucket is emitted with the same key, so that all the rows for a given
+// key are delivered to the same partition (or ordering key) in order.
+const batchEnvelopeBuckets = 64
+
+// batchEnvelopeSink wraps a sink, packing up to batchSize rows into each
+// message emitted to it. It is used for the batch_envelope_size option, which
+// reduces per-message overhead when rows are very small.
+//
+// Messages have the form
+//
+//	{"payload": [{"key": ..., "value": ...}, ...], "count": N,
+//	 "span": {"min_updated": ..., "max_updated": ...}}
+//
+// Partial batches are emitted when the sink is flushed. Because the frontier
+// only advances once Flush returns, it never advances past a row whose batch
+// has not been acknowledged by the sink.
+type batchEnvelopeSink struct {
+	wrapped   Sink
+	batchSize int
+	batches   map[batchEnvelopeKey]*batchEnvelope
+}
+
+type batchEnvelopeKey struct {
+	topic  TopicIdentifier
+	bucket uint32
+}
+
+type batchEnvelope struct {
+	topic                  TopicDescriptor
+	rows                   []batchEnvelopeRow
+	minUpdated, maxUpdated hlc.Timestamp
+	maxMVCC                hlc.Timestamp
+	alloc                  kvevent.Alloc
+}
+
+type batchEnvelopeRow struct {
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type batchEnvelopeSpan struct {
+	MinUpdated string `json:"min_updated"`
+	MaxUpdated string `json:"max_updated"`
+}
+
+type batchEnvelopeMessage struct {
+	Payload []batchEnvelopeRow `json:"payload"`
+	Count   int                `json:"count"`
+	Span    batchEnvelopeSpan  `json:"span"`
+}
+
+var _ Sink = (*batchEnvelopeSink)(nil)
+
+func makeBatchEnvelopeSink(wrapped Sink, batchSize int) *batchEnvelopeSink {
+	return &batchEnvelopeSink{
+		wrapped:   wrapped,
+		batchSize: batchSize,
+		batches:   make(map[batchEnvelopeKey]*batchEnvelope),
+	}
+}
+
+func (s *batchEnvelopeSink) getConcreteType() sinkType {
+	return s.wrapped.getConcreteType()
+}
+
+// Dial implements the Sink interface.
+func (s *batchEnvelopeSink) Dial() error {
+	return s.wrapped.Dial()
+}
+
+// EmitRow implements the Sink interface.
+func (s *batchEnvelopeSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	k := batchEnvelopeKey{
+		topic:  topic.GetTopicIdentifier(),
+		bucket: crc32.ChecksumIEEE(key) % batchEnvelopeBuckets,
+	}
+	b, ok := s.batches[k]
+	if !ok {
+		b = &batchEnvelope{topic: topic, minUpdated: updated}
+		s.batches[k] = b
+	}
+	// Copy the key and value since the caller may reuse the buffers.
+	b.rows = append(b.rows, batchEnvelopeRow{
+		Key:   append(json.RawMessage(nil), key...),
+		Value: append(json.RawMessage(nil), value...),
+	})
+	if updated.Less(b.minUpdated) {
+		b.minUpdated = updated
+	}
+	b.maxUpdated.Forward(updated)
+	b.maxMVCC.Forward(mvcc)
+	b.alloc.Merge(&alloc)
+
+	if len(b.rows) < s.batchSize {
+		return nil
+	}
+	delete(s.batches, k)
+	return s.emitBatch(ctx, k, b)
+}
+
+func (s *batchEnvelopeSink) emitBatch(
+	ctx context.Context, k batchEnvelopeKey, b *batchEnvelope,
+) error {
+	value, err := json.Marshal(batchEnvelopeMessage{
+		Payload: b.rows,
+		Count:   len(b.rows),
+		Span: batchEnvelopeSpan{
+			MinUpdated: timestampToString(b.minUpdated),
+			MaxUpdated: timestampToString(b.maxUpdated),
+		},
+	})
+	if err != nil {
+		b.alloc.Release(ctx)
+		return err
+	}
+	key := []byte(`[` + strconv.FormatUint(uint64(k.bucket), 10) + `]`)
+	return s.wrapped.EmitRow(ctx, b.topic, key, value, b.maxUpdated, b.maxMVCC, b.alloc)
+}
+
+// EmitResolvedTimestamp implements the Sink interface.
+func (s *batchEnvelopeSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	return s.wrapped.EmitResolvedTimestamp(ctx, encoder, resolved)
+}
+
+// EmitResolvedTimestampForTargets implements TargetResolvedTimestampSink.
+func (s *batchEnvelopeSink) EmitResolvedTimestampForTargets(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	include func(changefeedbase.Target) bool,
+) error {
+	sink, ok := s.wrapped.(TargetResolvedTimestampSink)
+	if !ok {
+		return errors.AssertionFailedf(`sink does not support per table resolved timestamps`)
+	}
+	return sink.EmitResolvedTimestampForTargets(ctx, encoder, resolved, include)
+}
+
+// Flush implements the Sink interface. Any partial batches are emitted
+// before flushing the wrapped sink.
+func (s *batchEnvelopeSink) Flush(ctx context.Context) error {
+	for k, b := range s.batches {
+		delete(s.batches, k)
+		if err := s.emitBatch(ctx, k, b); err != nil {
+			return err
+		}
+	}
+	return s.wrapped.Flush(ctx)
+}
+
+// Close implements the Sink interface.
+func (s *batchEnvelopeSink) Close() error {
+	for k, b := range s.batches {
+		delete(s.batches, k)
+		b.alloc.Release(context.Background())
+	}
+	return s.wrapped.Close()
+}
+
+// Topics implements the SinkWithTopics interface.
+func (s *batchEnvelopeSink) Topics() []string {
+	if withTopics, ok := s.wrapped.(SinkWithTopics); ok {
+		return withTopics.Topics()
+	}
+	return nil
+}
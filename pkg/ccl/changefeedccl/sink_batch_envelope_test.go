@@ -0,0 +1,106 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/stretchr/testify/require"
+)
+
+type batchRecordingSink struct {
+	testSink
+	emitted []batchEnvelopeMessage
+	updated []hlc.Timestamp
+	flushes int
+}
+
+var _ Sink = (*batchRecordingSink)(nil)
+
+func (s *batchRecordingSink) Dial() error {
+	return nil
+}
+
+func (s *batchRecordingSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	var m batchEnvelopeMessage
+	if err := json.Unmarshal(value, &m); err != nil {
+		return err
+	}
+	s.emitted = append(s.emitted, m)
+	s.updated = append(s.updated, updated)
+	alloc.Release(ctx)
+	return nil
+}
+
+func (s *batchRecordingSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	return nil
+}
+
+func (s *batchRecordingSink) Flush(ctx context.Context) error {
+	s.flushes++
+	return nil
+}
+
+func (s *batchRecordingSink) Close() error {
+	return nil
+}
+
+func TestBatchEnvelopeSink(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	p := &testAllocPool{}
+	wrapped := &batchRecordingSink{}
+	sink := makeBatchEnvelopeSink(wrapped, 3)
+	topic := makeTopic(`foo`)
+
+	// All rows share a key, and so a bucket.
+	key := []byte(`[1]`)
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, sink.EmitRow(ctx, topic, key, []byte(fmt.Sprintf(`{"after": {"a": %d}}`, i)),
+			hlc.Timestamp{WallTime: int64(i)}, hlc.Timestamp{WallTime: int64(i)}, p.alloc()))
+	}
+
+	// The first batch is emitted once it is full.
+	require.Len(t, wrapped.emitted, 1)
+	require.Equal(t, 3, wrapped.emitted[0].Count)
+	require.Len(t, wrapped.emitted[0].Payload, 3)
+	require.JSONEq(t, `[1]`, string(wrapped.emitted[0].Payload[0].Key))
+	require.JSONEq(t, `{"after": {"a": 1}}`, string(wrapped.emitted[0].Payload[0].Value))
+	require.Equal(t, timestampToString(hlc.Timestamp{WallTime: 1}), wrapped.emitted[0].Span.MinUpdated)
+	require.Equal(t, timestampToString(hlc.Timestamp{WallTime: 3}), wrapped.emitted[0].Span.MaxUpdated)
+	require.Equal(t, hlc.Timestamp{WallTime: 3}, wrapped.updated[0])
+	require.EqualValues(t, 1, p.used())
+
+	// Flushing emits the partial batch before flushing the wrapped sink.
+	require.NoError(t, sink.Flush(ctx))
+	require.Len(t, wrapped.emitted, 2)
+	require.Equal(t, 1, wrapped.emitted[1].Count)
+	require.JSONEq(t, `{"after": {"a": 4}}`, string(wrapped.emitted[1].Payload[0].Value))
+	require.Equal(t, 1, wrapped.flushes)
+	require.EqualValues(t, 0, p.used())
+
+	require.NoError(t, sink.Close())
+}
@@ -0,0 +1,522 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// cacheSinkTimeout bounds dialing a cache server and each round of
+	// writing commands to it and reading its replies.
+	cacheSinkTimeout = 10 * time.Second
+	// cacheSinkMaxPending is the number of commands which may be sent to the
+	// cache servers before the sink waits for their replies.
+	cacheSinkMaxPending = 1024
+	// memcachedMaxKeyLength is the longest key memcached accepts.
+	memcachedMaxKeyLength = 250
+)
+
+func isCacheSink(u *url.URL) bool {
+	switch u.Scheme {
+	case changefeedbase.SinkSchemeMemcached, changefeedbase.SinkSchemeRedis:
+		return true
+	default:
+		return false
+	}
+}
+
+// cacheSink invalidates the entries of a memcached or redis cache which are
+// derived from the rows of a changefeed, so that cache invalidation doesn't
+// require a consumer service reading from another sink.
+//
+// The cache key of a row is derived from the cache_key template of the sink
+// URI, in which each {column} placeholder is replaced with the value of the
+// column, e.g. cache_key=user:{id}. By default the entries for the row before
+// and after each change are deleted; with cache_op=set, the entry for the row
+// after the change is instead set to the JSON encoding of the row.
+//
+// Keys are spread across the servers listed in the sink URI by hash. Commands
+// are pipelined, and the sink waits for the servers' replies when it is
+// flushed. The password of redis servers is given by cache_password.
+type cacheSink struct {
+	addrs    []string
+	password string
+	protocol cacheProtocol
+
+	keyTemplate cacheKeyTemplate
+	op          string
+	ttl         time.Duration
+
+	conns   []*cacheConn
+	pending int
+	hasher  hash.Hash32
+
+	metrics metricsRecorder
+}
+
+var _ Sink = (*cacheSink)(nil)
+
+type cacheConn struct {
+	net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	pending int
+}
+
+func makeCacheSink(
+	u sinkURL, encodingOpts changefeedbase.EncodingOptions, mb metricsRecorderBuilder,
+) (Sink, error) {
+	if encodingOpts.Format != changefeedbase.OptFormatJSON {
+		return nil, errors.Errorf(`this sink is incompatible with %s=%s`,
+			changefeedbase.OptFormat, encodingOpts.Format)
+	}
+	if encodingOpts.Envelope != changefeedbase.OptEnvelopeWrapped {
+		return nil, errors.Errorf(`this sink is incompatible with %s=%s`,
+			changefeedbase.OptEnvelope, encodingOpts.Envelope)
+	}
+	if !encodingOpts.Diff {
+		// Without the previous version of a row, the cache key of a deleted
+		// row can't be derived.
+		return nil, errors.Errorf(`this sink requires the %s option`, changefeedbase.OptDiff)
+	}
+
+	s := &cacheSink{
+		hasher:  fnv.New32a(),
+		metrics: mb(requiresResourceAccounting),
+	}
+	if u.Host == `` {
+		return nil, errors.Errorf(`must specify at least one cache server`)
+	}
+	s.addrs = strings.Split(u.Host, `,`)
+
+	// The password is taken from a parameter rather than the user info of the
+	// URI, so that it's redacted along with the other credentials of sinks.
+	s.password = u.consumeParam(changefeedbase.SinkParamCachePassword)
+	switch u.Scheme {
+	case changefeedbase.SinkSchemeMemcached:
+		if u.User != nil || s.password != `` {
+			return nil, errors.Errorf(`memcached sink does not support authentication`)
+		}
+		s.protocol = memcachedProtocol{}
+	case changefeedbase.SinkSchemeRedis:
+		if u.User != nil {
+			return nil, errors.Errorf(`redis sink takes its password from the %s parameter`,
+				changefeedbase.SinkParamCachePassword)
+		}
+		s.protocol = redisProtocol{}
+	}
+
+	var err error
+	keyTemplate := u.consumeParam(changefeedbase.SinkParamCacheKey)
+	if keyTemplate == `` {
+		return nil, errors.Errorf(`must specify %s`, changefeedbase.SinkParamCacheKey)
+	}
+	if s.keyTemplate, err = parseCacheKeyTemplate(keyTemplate); err != nil {
+		return nil, err
+	}
+
+	switch s.op = u.consumeParam(changefeedbase.SinkParamCacheOp); s.op {
+	case ``:
+		s.op = changefeedbase.SinkCacheOpDelete
+	case changefeedbase.SinkCacheOpDelete, changefeedbase.SinkCacheOpSet:
+	default:
+		return nil, errors.Errorf(`unknown %s %q, expected %q or %q`,
+			changefeedbase.SinkParamCacheOp, s.op,
+			changefeedbase.SinkCacheOpDelete, changefeedbase.SinkCacheOpSet)
+	}
+
+	if ttl := u.consumeParam(changefeedbase.SinkParamCacheTTL); ttl != `` {
+		if s.op != changefeedbase.SinkCacheOpSet {
+			return nil, errors.Errorf(`%s requires %s=%s`, changefeedbase.SinkParamCacheTTL,
+				changefeedbase.SinkParamCacheOp, changefeedbase.SinkCacheOpSet)
+		}
+		if s.ttl, err = time.ParseDuration(ttl); err != nil {
+			return nil, errors.Wrapf(err, `invalid %s`, changefeedbase.SinkParamCacheTTL)
+		}
+		if s.ttl < time.Second || s.ttl%time.Second != 0 {
+			return nil, errors.Errorf(`%s must be a whole number of seconds`,
+				changefeedbase.SinkParamCacheTTL)
+		}
+	}
+
+	if unknownParams := u.remainingQueryParams(); len(unknownParams) > 0 {
+		return nil, errors.Errorf(
+			`unknown %s sink query parameters: %s`, u.Scheme, strings.Join(unknownParams, ", "))
+	}
+	return s, nil
+}
+
+func (s *cacheSink) getConcreteType() sinkType {
+	return sinkTypeCache
+}
+
+// Dial implements the Sink interface.
+func (s *cacheSink) Dial() error {
+	for _, addr := range s.addrs {
+		conn, err := net.DialTimeout(`tcp`, addr, cacheSinkTimeout)
+		if err != nil {
+			_ = s.Close()
+			return err
+		}
+		c := &cacheConn{Conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+		s.conns = append(s.conns, c)
+		if s.password != `` {
+			if err := s.protocol.auth(c, s.password); err != nil {
+				_ = s.Close()
+				return errors.Wrapf(err, `authenticating to %s`, addr)
+			}
+		}
+	}
+	return nil
+}
+
+// EmitRow implements the Sink interface.
+func (s *cacheSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	defer alloc.Release(ctx)
+	defer s.metrics.recordOneMessage()(mvcc, len(key)+len(value), sinkDoesNotCompress)
+
+	var msg struct {
+		After  json.RawMessage `json:"after"`
+		Before json.RawMessage `json:"before"`
+	}
+	if err := json.Unmarshal(value, &msg); err != nil {
+		return err
+	}
+	var afterKey, beforeKey string
+	var err error
+	if !isJSONNull(msg.After) {
+		if afterKey, err = s.keyTemplate.key(msg.After); err != nil {
+			return err
+		}
+	}
+	if !isJSONNull(msg.Before) {
+		if beforeKey, err = s.keyTemplate.key(msg.Before); err != nil {
+			return err
+		}
+	}
+
+	if afterKey != `` {
+		if s.op == changefeedbase.SinkCacheOpSet {
+			err = s.emit(ctx, afterKey, func(w *bufio.Writer) error {
+				return s.protocol.writeSet(w, afterKey, msg.After, s.ttl)
+			})
+		} else {
+			err = s.emit(ctx, afterKey, func(w *bufio.Writer) error {
+				return s.protocol.writeDelete(w, afterKey)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if beforeKey != `` && beforeKey != afterKey {
+		return s.emit(ctx, beforeKey, func(w *bufio.Writer) error {
+			return s.protocol.writeDelete(w, beforeKey)
+		})
+	}
+	return nil
+}
+
+// emit writes a command for the given key to the server the key hashes to.
+func (s *cacheSink) emit(ctx context.Context, key string, write func(*bufio.Writer) error) error {
+	if err := s.protocol.validateKey(key); err != nil {
+		return err
+	}
+	s.hasher.Reset()
+	_, _ = s.hasher.Write([]byte(key))
+	c := s.conns[s.hasher.Sum32()%uint32(len(s.conns))]
+	if err := c.SetWriteDeadline(timeutil.Now().Add(cacheSinkTimeout)); err != nil {
+		return err
+	}
+	if err := write(c.w); err != nil {
+		return err
+	}
+	c.pending++
+	s.pending++
+	if s.pending >= cacheSinkMaxPending {
+		return s.Flush(ctx)
+	}
+	return nil
+}
+
+// EmitResolvedTimestamp implements the Sink interface. Resolved timestamps
+// have no meaning to a cache, and are not emitted.
+func (s *cacheSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	defer s.metrics.recordResolvedCallback()()
+	return nil
+}
+
+// Flush implements the Sink interface.
+func (s *cacheSink) Flush(ctx context.Context) error {
+	defer s.metrics.recordFlushRequestCallback()()
+
+	for _, c := range s.conns {
+		if c.pending == 0 {
+			continue
+		}
+		if err := c.SetDeadline(timeutil.Now().Add(cacheSinkTimeout)); err != nil {
+			return err
+		}
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		for ; c.pending > 0; c.pending-- {
+			if err := s.protocol.readReply(c.r); err != nil {
+				return errors.Wrapf(err, `%s`, c.RemoteAddr())
+			}
+		}
+	}
+	s.pending = 0
+	return nil
+}
+
+// Close implements the Sink interface.
+func (s *cacheSink) Close() error {
+	var err error
+	for _, c := range s.conns {
+		err = errors.CombineErrors(err, c.Close())
+	}
+	s.conns = nil
+	return err
+}
+
+func isJSONNull(j json.RawMessage) bool {
+	return len(j) == 0 || string(j) == `null`
+}
+
+// cacheKeyTemplate is a parsed cache_key. Each part is either a literal or,
+// if it is a placeholder, the name of a column.
+type cacheKeyTemplate []cacheKeyPart
+
+type cacheKeyPart struct {
+	s           string
+	placeholder bool
+}
+
+func parseCacheKeyTemplate(template string) (cacheKeyTemplate, error) {
+	var t cacheKeyTemplate
+	var hasPlaceholder bool
+	for rest := template; rest != ``; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t = append(t, cacheKeyPart{s: rest})
+			break
+		}
+		if open > 0 {
+			t = append(t, cacheKeyPart{s: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, errors.Errorf(`unterminated placeholder in %s %q`,
+				changefeedbase.SinkParamCacheKey, template)
+		}
+		column := rest[open+1 : open+end]
+		if column == `` {
+			return nil, errors.Errorf(`empty placeholder in %s %q`,
+				changefeedbase.SinkParamCacheKey, template)
+		}
+		t = append(t, cacheKeyPart{s: column, placeholder: true})
+		hasPlaceholder = true
+		rest = rest[open+end+1:]
+	}
+	if !hasPlaceholder {
+		return nil, errors.Errorf(`%s %q must reference at least one column, e.g. {id}`,
+			changefeedbase.SinkParamCacheKey, template)
+	}
+	return t, nil
+}
+
+// key returns the cache key of the JSON encoded row.
+func (t cacheKeyTemplate) key(row json.RawMessage) (string, error) {
+	var columns map[string]json.RawMessage
+	if err := json.Unmarshal(row, &columns); err != nil {
+		return ``, err
+	}
+	var b strings.Builder
+	for _, p := range t {
+		if !p.placeholder {
+			b.WriteString(p.s)
+			continue
+		}
+		v, ok := columns[p.s]
+		if !ok {
+			return ``, errors.Errorf(`column %q of %s not found`, p.s, changefeedbase.SinkParamCacheKey)
+		}
+		var str string
+		if err := json.Unmarshal(v, &str); err == nil {
+			b.WriteString(str)
+		} else {
+			// Numbers, booleans and the like are used as encoded.
+			b.Write(v)
+		}
+	}
+	return b.String(), nil
+}
+
+// cacheProtocol writes commands to, and reads replies from, a cache server.
+type cacheProtocol interface {
+	validateKey(key string) error
+	auth(c *cacheConn, password string) error
+	writeDelete(w *bufio.Writer, key string) error
+	writeSet(w *bufio.Writer, key string, value []byte, ttl time.Duration) error
+	readReply(r *bufio.Reader) error
+}
+
+// memcachedProtocol is the memcached text protocol.
+type memcachedProtocol struct{}
+
+func (memcachedProtocol) validateKey(key string) error {
+	if len(key) > memcachedMaxKeyLength {
+		return errors.Errorf(`memcached key %q is longer than %d bytes`, key, memcachedMaxKeyLength)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return errors.Errorf(`memcached key %q contains whitespace or control characters`, key)
+		}
+	}
+	return nil
+}
+
+func (memcachedProtocol) auth(*cacheConn, string) error {
+	return errors.AssertionFailedf(`memcached sink does not support authentication`)
+}
+
+func (memcachedProtocol) writeDelete(w *bufio.Writer, key string) error {
+	_, err := fmt.Fprintf(w, "delete %s\r\n", key)
+	return err
+}
+
+func (memcachedProtocol) writeSet(
+	w *bufio.Writer, key string, value []byte, ttl time.Duration,
+) error {
+	if _, err := fmt.Fprintf(w, "set %s 0 %d %d\r\n", key, int64(ttl/time.Second), len(value)); err != nil {
+		return err
+	}
+	if _, err := w.Write(value); err != nil {
+		return err
+	}
+	_, err := w.WriteString("\r\n")
+	return err
+}
+
+func (memcachedProtocol) readReply(r *bufio.Reader) error {
+	line, err := readCacheLine(r)
+	if err != nil {
+		return err
+	}
+	switch line {
+	case `STORED`, `DELETED`, `NOT_FOUND`:
+		return nil
+	default:
+		return errors.Newf(`memcached: %s`, line)
+	}
+}
+
+// redisProtocol is the redis serialization protocol (RESP).
+type redisProtocol struct{}
+
+func (redisProtocol) validateKey(string) error {
+	return nil
+}
+
+func (p redisProtocol) auth(c *cacheConn, password string) error {
+	if err := c.SetDeadline(timeutil.Now().Add(cacheSinkTimeout)); err != nil {
+		return err
+	}
+	if err := writeRedisCommand(c.w, []byte(`AUTH`), []byte(password)); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	return p.readReply(c.r)
+}
+
+func (redisProtocol) writeDelete(w *bufio.Writer, key string) error {
+	return writeRedisCommand(w, []byte(`DEL`), []byte(key))
+}
+
+func (redisProtocol) writeSet(w *bufio.Writer, key string, value []byte, ttl time.Duration) error {
+	if ttl == 0 {
+		return writeRedisCommand(w, []byte(`SET`), []byte(key), value)
+	}
+	return writeRedisCommand(w, []byte(`SET`), []byte(key), value,
+		[]byte(`EX`), []byte(strconv.FormatInt(int64(ttl/time.Second), 10)))
+}
+
+func (redisProtocol) readReply(r *bufio.Reader) error {
+	line, err := readCacheLine(r)
+	if err != nil {
+		return err
+	}
+	if line == `` {
+		return errors.New(`redis: empty reply`)
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return errors.Newf(`redis: %s`, line[1:])
+	default:
+		return errors.Newf(`redis: unexpected reply %q`, line)
+	}
+}
+
+// writeRedisCommand writes a command as an array of bulk strings.
+func writeRedisCommand(w *bufio.Writer, args ...[]byte) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, a := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n", len(a)); err != nil {
+			return err
+		}
+		if _, err := w.Write(a); err != nil {
+			return err
+		}
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCacheLine reads a line terminated by \r\n.
+func readCacheLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return ``, err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCacheServer records the commands it receives, replying to each with
+// the reply of the protocol.
+type fakeCacheServer struct {
+	ln    net.Listener
+	redis bool
+	mu    struct {
+		syncutil.Mutex
+		commands []string
+	}
+}
+
+func startFakeCacheServer(t *testing.T, redis bool) *fakeCacheServer {
+	ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	require.NoError(t, err)
+	s := &fakeCacheServer{ln: ln, redis: redis}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeCacheServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		cmd, reply, err := s.readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.mu.commands = append(s.mu.commands, cmd)
+		s.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeCacheServer) readCommand(r *bufio.Reader) (cmd, reply string, _ error) {
+	line, err := readCacheLine(r)
+	if err != nil {
+		return ``, ``, err
+	}
+	if !s.redis {
+		if !strings.HasPrefix(line, `set `) {
+			return line, "DELETED\r\n", nil
+		}
+		data, err := readCacheLine(r)
+		if err != nil {
+			return ``, ``, err
+		}
+		return line + ` ` + data, "STORED\r\n", nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(line, `*`))
+	if err != nil {
+		return ``, ``, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := readCacheLine(r); err != nil {
+			return ``, ``, err
+		}
+		if args[i], err = readCacheLine(r); err != nil {
+			return ``, ``, err
+		}
+	}
+	if args[0] == `DEL` {
+		return strings.Join(args, ` `), ":1\r\n", nil
+	}
+	return strings.Join(args, ` `), "+OK\r\n", nil
+}
+
+func (s *fakeCacheServer) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.mu.commands...)
+}
+
+func TestCacheSink(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	encodingOpts := changefeedbase.EncodingOptions{
+		Format:   changefeedbase.OptFormatJSON,
+		Envelope: changefeedbase.OptEnvelopeWrapped,
+		Diff:     true,
+	}
+
+	emit := func(t *testing.T, sink Sink, value string) {
+		require.NoError(t, sink.EmitRow(ctx, makeTopic(`foo`), []byte(`[1]`), []byte(value),
+			hlc.Timestamp{}, hlc.Timestamp{}, zeroAlloc))
+	}
+	emitChanges := func(t *testing.T, sink Sink) {
+		emit(t, sink, `{"after":{"id":1,"name":"a"},"before":null}`)
+		emit(t, sink, `{"after":{"id":1,"name":"b"},"before":{"id":1,"name":"a"}}`)
+		emit(t, sink, `{"after":{"id":2,"name":"b"},"before":{"id":1,"name":"b"}}`)
+		emit(t, sink, `{"after":null,"before":{"id":2,"name":"b"}}`)
+		require.NoError(t, sink.Flush(ctx))
+	}
+
+	for _, tc := range []struct {
+		scheme string
+		params string
+		expect []string
+	}{
+		{
+			scheme: changefeedbase.SinkSchemeMemcached,
+			params: `cache_key=user:{id}`,
+			expect: []string{
+				`delete user:1`, `delete user:1`, `delete user:2`, `delete user:1`, `delete user:2`,
+			},
+		},
+		{
+			scheme: changefeedbase.SinkSchemeMemcached,
+			params: `cache_key=user:{id}&cache_op=set&cache_ttl=1m`,
+			expect: []string{
+				`set user:1 0 60 19 {"id":1,"name":"a"}`,
+				`set user:1 0 60 19 {"id":1,"name":"b"}`,
+				`set user:2 0 60 19 {"id":2,"name":"b"}`,
+				`delete user:1`,
+				`delete user:2`,
+			},
+		},
+		{
+			scheme: changefeedbase.SinkSchemeRedis,
+			params: `cache_key={name}/{id}`,
+			expect: []string{
+				`DEL a/1`, `DEL b/1`, `DEL a/1`, `DEL b/2`, `DEL b/1`, `DEL b/2`,
+			},
+		},
+		{
+			scheme: changefeedbase.SinkSchemeRedis,
+			params: `cache_key=user:{id}&cache_password=secret`,
+			expect: []string{
+				`AUTH secret`,
+				`DEL user:1`, `DEL user:1`, `DEL user:2`, `DEL user:1`, `DEL user:2`,
+			},
+		},
+		{
+			scheme: changefeedbase.SinkSchemeRedis,
+			params: `cache_key=user:{id}&cache_op=set`,
+			expect: []string{
+				`SET user:1 {"id":1,"name":"a"}`,
+				`SET user:1 {"id":1,"name":"b"}`,
+				`SET user:2 {"id":2,"name":"b"}`,
+				`DEL user:1`,
+				`DEL user:2`,
+			},
+		},
+	} {
+		t.Run(tc.scheme+`?`+tc.params, func(t *testing.T) {
+			srv := startFakeCacheServer(t, tc.scheme == changefeedbase.SinkSchemeRedis)
+			defer srv.ln.Close()
+
+			u, err := url.Parse(fmt.Sprintf(`%s://%s?%s`, tc.scheme, srv.ln.Addr(), tc.params))
+			require.NoError(t, err)
+			sink, err := makeCacheSink(sinkURL{URL: u}, encodingOpts, nilMetricsRecorderBuilder)
+			require.NoError(t, err)
+			require.NoError(t, sink.Dial())
+			defer func() { require.NoError(t, sink.Close()) }()
+
+			emitChanges(t, sink)
+			require.Equal(t, tc.expect, srv.commands())
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			uri  string
+			opts changefeedbase.EncodingOptions
+			err  string
+		}{
+			{uri: `memcached://a?cache_key=user:{id}`, opts: changefeedbase.EncodingOptions{
+				Format: changefeedbase.OptFormatJSON, Envelope: changefeedbase.OptEnvelopeWrapped,
+			}, err: `this sink requires the diff option`},
+			{uri: `memcached://a?cache_key=user:{id}`, opts: changefeedbase.EncodingOptions{
+				Format: changefeedbase.OptFormatAvro, Envelope: changefeedbase.OptEnvelopeWrapped, Diff: true,
+			}, err: `this sink is incompatible with format=avro`},
+			{uri: `memcached://a`, err: `must specify cache_key`},
+			{uri: `memcached://a?cache_key=user`, err: `must reference at least one column`},
+			{uri: `memcached://a?cache_key=user:{id`, err: `unterminated placeholder`},
+			{uri: `memcached://a?cache_key=user:{}`, err: `empty placeholder`},
+			{uri: `memcached://a?cache_key={id}&cache_op=upsert`, err: `unknown cache_op "upsert"`},
+			{uri: `memcached://a?cache_key={id}&cache_ttl=1m`, err: `cache_ttl requires cache_op=set`},
+			{uri: `memcached://a?cache_key={id}&cache_op=set&cache_ttl=1.5s`, err: `whole number of seconds`},
+			{uri: `memcached://user:pass@a?cache_key={id}`, err: `does not support authentication`},
+			{uri: `memcached://a?cache_key={id}&cache_password=pass`, err: `does not support authentication`},
+			{uri: `redis://:pass@a?cache_key={id}`, err: `takes its password from the cache_password parameter`},
+			{uri: `redis://a?cache_key={id}&foo=bar`, err: `unknown redis sink query parameters: foo`},
+		} {
+			opts := tc.opts
+			if opts.Format == `` {
+				opts = encodingOpts
+			}
+			u, err := url.Parse(tc.uri)
+			require.NoError(t, err)
+			_, err = makeCacheSink(sinkURL{URL: u}, opts, nilMetricsRecorderBuilder)
+			require.Regexp(t, tc.err, err, tc.uri)
+		}
+	})
+
+	t.Run("redaction", func(t *testing.T) {
+		sanitized, err := sanitizeSinkURI(`redis://a?cache_key=user:{id}&cache_password=secret`)
+		require.NoError(t, err)
+		require.Equal(t, `redis://a?cache_key=user%3A%7Bid%7D&cache_password=redacted`, sanitized)
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// Every sink dials clients of its own, so a node running hundreds of
+// changefeeds into the same kafka cluster holds hundreds of connections to
+// each of its brokers. With changefeed.sink_client_pool.enabled, the kafka,
+// webhook and pubsub sinks of the changefeeds running on a node instead share
+// their clients with the other sinks of the node which would dial identical
+// clients, i.e. which are configured with the same sink URI, and for kafka,
+// the same kafka_sink_config. A shared client is closed once the last sink
+// using it is closed. changefeed.sink_client_pool.max_clients limits the
+// number of clients the pool holds, and so the number of connections the
+// changefeeds of a node open to their sinks.
+
+// sinkClientPool holds the clients shared by the sinks of the changefeeds
+// running on a node, by key.
+type sinkClientPool struct {
+	clients *metric.Gauge
+
+	mu struct {
+		syncutil.Mutex
+		clients map[string]*pooledSinkClient
+	}
+}
+
+// pooledSinkClient is a client of a sinkClientPool.
+type pooledSinkClient struct {
+	// ready is closed once client is dialed, or failed to dial with err.
+	ready  chan struct{}
+	client io.Closer
+	err    error
+	// refs is the number of sinks which acquired the client and have yet
+	// to release it.
+	refs int
+}
+
+func newSinkClientPool(clients *metric.Gauge) *sinkClientPool {
+	p := &sinkClientPool{clients: clients}
+	p.mu.clients = make(map[string]*pooledSinkClient)
+	return p
+}
+
+// pooledClientSink is implemented by sinks which can share their clients
+// through a sinkClientPool.
+type pooledClientSink interface {
+	setClientPool(p *sinkClientPool, sv *settings.Values)
+}
+
+// maybeSetClientPool sets the client pool of the sink, if it can share its
+// clients and the pool is enabled.
+func maybeSetClientPool(s Sink, p *sinkClientPool, sv *settings.Values) {
+	if p == nil || !changefeedbase.SinkClientPoolEnabled.Get(sv) {
+		return
+	}
+	if s, ok := s.(pooledClientSink); ok {
+		s.setClientPool(p, sv)
+	}
+}
+
+// sinkClientKey returns the key of the clients dialed from the given
+// configuration. The configuration, which may hold credentials, is hashed so
+// that the pool doesn't hold on to it.
+func sinkClientKey(config ...string) string {
+	h := sha256.New()
+	for _, c := range config {
+		_, _ = h.Write([]byte(c))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// acquire returns the client of the pool with the given key, which dial
+// dials if the pool doesn't hold it yet. The returned function releases the
+// client, which is closed once every sink which acquired it released it.
+func (p *sinkClientPool) acquire(
+	ctx context.Context, sv *settings.Values, key string, dial func() (io.Closer, error),
+) (io.Closer, func() error, error) {
+	p.mu.Lock()
+	c, ok := p.mu.clients[key]
+	if !ok {
+		if limit := changefeedbase.SinkClientPoolMaxClients.Get(sv); limit > 0 &&
+			int64(len(p.mu.clients)) >= limit {
+			p.mu.Unlock()
+			return nil, nil, pgerror.Newf(pgcode.ConfigurationLimitExceeded,
+				"sink client pool of this node holds %d clients, the limit of %s",
+				limit, changefeedbase.SinkClientPoolMaxClients.Key())
+		}
+		c = &pooledSinkClient{ready: make(chan struct{})}
+		p.mu.clients[key] = c
+		p.clients.Inc(1)
+	}
+	c.refs++
+	p.mu.Unlock()
+
+	var once sync.Once
+	release := func() (err error) {
+		once.Do(func() { err = p.release(key, c) })
+		return err
+	}
+	if !ok {
+		c.client, c.err = dial()
+		if c.err != nil {
+			p.mu.Lock()
+			p.removeLocked(key, c)
+			p.mu.Unlock()
+		}
+		close(c.ready)
+	} else {
+		select {
+		case <-c.ready:
+		case <-ctx.Done():
+			_ = release()
+			return nil, nil, ctx.Err()
+		}
+	}
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	return c.client, release, nil
+}
+
+// release releases a client acquired from the pool, closing it if no other
+// sink holds it.
+func (p *sinkClientPool) release(key string, c *pooledSinkClient) error {
+	p.mu.Lock()
+	c.refs--
+	if c.refs > 0 || p.mu.clients[key] != c {
+		p.mu.Unlock()
+		return nil
+	}
+	p.removeLocked(key, c)
+	p.mu.Unlock()
+	return c.client.Close()
+}
+
+func (p *sinkClientPool) removeLocked(key string, c *pooledSinkClient) {
+	if p.mu.clients[key] == c {
+		delete(p.mu.clients, key)
+		p.clients.Dec(1)
+	}
+}
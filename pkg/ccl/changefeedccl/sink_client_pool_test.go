@@ -0,0 +1,139 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type testPooledClient struct {
+	closed int
+}
+
+func (c *testPooledClient) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestSinkClientPool(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	clients := metric.NewGauge(metric.Metadata{})
+	p := newSinkClientPool(clients)
+
+	dials := 0
+	dial := func() (io.Closer, error) {
+		dials++
+		return &testPooledClient{}, nil
+	}
+
+	// Sinks with the same key share a client, which is closed once they all
+	// released it.
+	c1, release1, err := p.acquire(ctx, &st.SV, `a`, dial)
+	require.NoError(t, err)
+	c2, release2, err := p.acquire(ctx, &st.SV, `a`, dial)
+	require.NoError(t, err)
+	require.Same(t, c1, c2)
+	require.Equal(t, 1, dials)
+	require.Equal(t, int64(1), clients.Value())
+
+	require.NoError(t, release1())
+	require.NoError(t, release1())
+	require.Equal(t, 0, c1.(*testPooledClient).closed)
+	require.NoError(t, release2())
+	require.Equal(t, 1, c1.(*testPooledClient).closed)
+	require.Equal(t, int64(0), clients.Value())
+
+	// A client which failed to dial isn't pooled.
+	_, _, err = p.acquire(ctx, &st.SV, `b`, func() (io.Closer, error) {
+		return nil, errors.New(`boom`)
+	})
+	require.EqualError(t, err, `boom`)
+	require.Equal(t, int64(0), clients.Value())
+	_, releaseB, err := p.acquire(ctx, &st.SV, `b`, dial)
+	require.NoError(t, err)
+	require.Equal(t, 2, dials)
+
+	// Beyond the limit, only the clients of the pool can be acquired.
+	changefeedbase.SinkClientPoolMaxClients.Override(ctx, &st.SV, 1)
+	_, _, err = p.acquire(ctx, &st.SV, `c`, dial)
+	require.Equal(t, pgcode.ConfigurationLimitExceeded, pgerror.GetPGCode(err))
+	_, releaseB2, err := p.acquire(ctx, &st.SV, `b`, dial)
+	require.NoError(t, err)
+	require.NoError(t, releaseB())
+	require.NoError(t, releaseB2())
+	_, releaseC, err := p.acquire(ctx, &st.SV, `c`, dial)
+	require.NoError(t, err)
+	require.NoError(t, releaseC())
+	require.Equal(t, 3, dials)
+}
+
+func TestKafkaSinkPooledClient(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	changefeedbase.SinkClientPoolEnabled.Override(ctx, &st.SV, true)
+	clients := metric.NewGauge(metric.Metadata{})
+	p := newSinkClientPool(clients)
+
+	dials := 0
+	dialSink := func(uri string) Sink {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		s, err := makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(`t`),
+			changefeedbase.EncodingOptions{}, ``, nil, nilMetricsRecorderBuilder)
+		require.NoError(t, err)
+		s.(*kafkaSink).knobs = kafkaSinkKnobs{
+			OverrideClientInit: func(config *sarama.Config) (kafkaClient, error) {
+				dials++
+				return &fakeKafkaClient{config: config}, nil
+			},
+			OverrideAsyncProducerFromClient: func(client kafkaClient) (sarama.AsyncProducer, error) {
+				return newAsyncProducerMock(1), nil
+			},
+		}
+		maybeSetClientPool(s, p, &st.SV)
+		require.NoError(t, s.Dial())
+		return s
+	}
+
+	// Sinks with the same URI share their client, which is closed along with
+	// the last of them.
+	s1 := dialSink(`kafka://broker:9092?topic_prefix=a`)
+	s2 := dialSink(`kafka://broker:9092?topic_prefix=a`)
+	s3 := dialSink(`kafka://broker:9092?topic_prefix=b`)
+	require.Equal(t, 2, dials)
+	require.Equal(t, int64(2), clients.Value())
+	require.Same(t, s1.(*kafkaSink).client, s2.(*kafkaSink).client)
+
+	require.NoError(t, s1.Close())
+	require.Equal(t, int64(2), clients.Value())
+	require.NoError(t, s2.Close())
+	require.NoError(t, s3.Close())
+	require.Equal(t, int64(0), clients.Value())
+}
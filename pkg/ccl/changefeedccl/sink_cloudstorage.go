@@ -25,6 +25,8 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
 	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/cloud/databricks"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/security/username"
 	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
@@ -34,6 +36,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/errors"
 	"github.com/google/btree"
@@ -46,7 +49,8 @@ func isCloudStorageSink(u *url.URL) bool {
 	switch u.Scheme {
 	case changefeedbase.SinkSchemeCloudStorageS3, changefeedbase.SinkSchemeCloudStorageGCS,
 		changefeedbase.SinkSchemeCloudStorageNodelocal, changefeedbase.SinkSchemeCloudStorageHTTP,
-		changefeedbase.SinkSchemeCloudStorageHTTPS, changefeedbase.SinkSchemeCloudStorageAzure:
+		changefeedbase.SinkSchemeCloudStorageHTTPS, changefeedbase.SinkSchemeCloudStorageAzure,
+		changefeedbase.SinkSchemeCloudStorageSFTP, changefeedbase.SinkSchemeCloudStorageDatabricks:
 		return true
 	default:
 		return false
@@ -73,6 +77,11 @@ type cloudStorageSinkFile struct {
 	alloc        kvevent.Alloc
 	oldestMVCC   hlc.Timestamp
 	parquetCodec *parquetFileWriter
+
+	// avroSchemaID and avroSync are set for files containing avro records,
+	// which are written as avro object container files.
+	avroSchemaID int32
+	avroSync     [avroOCFSyncSize]byte
 }
 
 var _ io.Writer = &cloudStorageSinkFile{}
@@ -113,6 +122,13 @@ func (f *cloudStorageSinkFile) Write(p []byte) (int, error) {
 // from the same schema version of that table, and so all have the same schema.
 // 4. All files are partitioned into folders by the date part of the filename.
 //
+// The file_name_template sink parameter replaces the naming convention
+// described below. Templates are restricted so that the ordering guarantees
+// still hold among the files of each topic, and they add one more guarantee:
+// 5. The `{sequence}` of the files a sink writes for a topic starts at zero and
+// increases by one with each file, so that a gap means that a file is missing.
+// See fileNameTemplate.
+//
 // Two methods of the cloudStorageSink on each data emitting processor are
 // called. EmitRow is called with each row change and Flush is called before
 // sending partial progress information to the coordinator. This happens with no
@@ -201,7 +217,19 @@ func (f *cloudStorageSinkFile) Write(p []byte) (int, error) {
 // deleted, included in hive queries, etc). A typical user of cloudStorageSink
 // would periodically do exactly this.
 //
-// Still TODO is writing out data schemas, Avro support, bounding memory usage.
+// When `format=avro`, data files are avro object container files and the
+// schema of every record is additionally written to
+// `_schemas/<topic>/<schema_timestamp>-<schema_digest>.avsc`, so that the output
+// can be decoded without access to a schema registry.
+//
+// With the retention sink parameter, the sink deletes the files it wrote once
+// they are older than the retention. See sink_cloudstorage_retention.go.
+//
+// When the sink writes to a Databricks volume whose URI sets
+// DATABRICKS_WAREHOUSE_ID, a view named after each topic, which reads its data
+// files, is registered in the catalog and schema of the volume.
+//
+// Still TODO is bounding memory usage.
 //
 // Now what follows is a proof of why the above is correct even in the presence
 // of multiple job restarts. We begin by establishing some terminology and by
@@ -292,6 +320,12 @@ type cloudStorageSink struct {
 
 	compression compressionAlgo
 
+	// schemaRegistry is set when emitting avro, in which case the schemas of
+	// emitted records are written next to the data files. See
+	// sink_cloudstorage_avro.go.
+	schemaRegistry *sinkSchemaRegistry
+	writtenSchemas map[cloudStorageSchemaFileKey]struct{}
+
 	es cloud.ExternalStorage
 
 	// These are fields to track information needed to output files based on the naming
@@ -309,6 +343,38 @@ type cloudStorageSink struct {
 	prevFilename      string
 	metrics           metricsRecorder
 
+	// fileNameTemplate, if set by the file_name_template sink parameter, names
+	// data files in place of the convention described above, in which case the
+	// names of files are only ordered among those of the same topic. See
+	// sink_cloudstorage_filename.go.
+	fileNameTemplate   *fileNameTemplate
+	topicSequences     map[string]int64
+	prevTopicFilenames map[string]string
+
+	// tableRegistrar is set if the sink writes to a Databricks volume with a
+	// SQL warehouse, in which case a table is registered over the data files
+	// of each topic. registeredTables holds the topics whose table is
+	// registered, or being registered. See sink_cloudstorage_databricks.go.
+	tableRegistrar   *databricks.TableRegistrar
+	tableFormat      string
+	registeredTables struct {
+		syncutil.Mutex
+		topics map[string]struct{}
+	}
+
+	// retention, if set by the retention sink parameter, is the age past
+	// which the files of the changefeed are deleted, which they last started
+	// to be as of lastRetentionSweep. retentionSessionPrefix, which begins the
+	// sessions of the sinks of the changefeed, tells its files apart from
+	// those of other changefeeds. retentionSweeping is set while a sweep runs,
+	// and the partitions which ended before retentionSweptThrough have been
+	// swept. See sink_cloudstorage_retention.go.
+	retention              time.Duration
+	retentionSessionPrefix string
+	lastRetentionSweep     time.Time
+	retentionSweeping      int32
+	retentionSweptThrough  time.Time
+
 	asyncFlushActive bool
 	flushGroup       ctxgroup.Group
 	asyncFlushCh     chan flushRequest // channel for submitting flush requests.
@@ -358,6 +424,7 @@ func makeCloudStorageSink(
 	timestampOracle timestampLowerBoundOracle,
 	makeExternalStorageFromURI cloud.ExternalStorageFromURIFactory,
 	user username.SQLUsername,
+	jobID jobspb.JobID,
 	mb metricsRecorderBuilder,
 ) (Sink, error) {
 	var targetMaxFileSize int64 = 16 << 20 // 16MB
@@ -367,6 +434,14 @@ func makeCloudStorageSink(
 			return nil, pgerror.Wrapf(err, pgcode.Syntax, `parsing %s`, fileSizeParam)
 		}
 	}
+	var template *fileNameTemplate
+	if templateParam := u.consumeParam(changefeedbase.SinkParamFileNameTemplate); templateParam != `` {
+		t, err := parseFileNameTemplate(templateParam)
+		if err != nil {
+			return nil, err
+		}
+		template = &t
+	}
 	u.Scheme = strings.TrimPrefix(u.Scheme, `experimental-`)
 
 	sinkID := atomic.AddInt64(&cloudStorageSinkIDAtomic, 1)
@@ -378,7 +453,8 @@ func makeCloudStorageSink(
 	// Using + rather than . here because some consumers may be relying on there being exactly
 	// one '.' in the filepath, and '+' shares with '-' the useful property of being
 	// lexicographically earlier than '.'.
-	tn, err := MakeTopicNamer(changefeedbase.Targets{}, WithJoinByte('+'))
+	tn, err := MakeTopicNamer(changefeedbase.Targets{},
+		append(familyTopicNameOptions(encodingOpts), WithJoinByte('+'))...)
 	if err != nil {
 		return nil, err
 	}
@@ -400,6 +476,11 @@ func makeCloudStorageSink(
 		asyncFlushCh:     make(chan flushRequest, flushQueueDepth),
 		asyncFlushTermCh: make(chan struct{}),
 	}
+	if template != nil {
+		s.fileNameTemplate = template
+		s.topicSequences = make(map[string]int64)
+		s.prevTopicFilenames = make(map[string]string)
+	}
 	s.flushGroup.GoCtx(s.asyncFlusher)
 
 	if partitionFormat := u.consumeParam(changefeedbase.SinkParamPartitionFormat); partitionFormat != "" {
@@ -411,6 +492,19 @@ func makeCloudStorageSink(
 		s.partitionFormat = dateFormat
 	}
 
+	if retentionParam := u.consumeParam(changefeedbase.SinkParamRetention); retentionParam != `` {
+		if s.retention, err = parseCloudStorageRetention(retentionParam); err != nil {
+			return nil, err
+		}
+		if s.fileNameTemplate != nil && !s.fileNameTemplate.sessionPrecedesTopic() {
+			return nil, errors.Errorf(`%s requires {%s} to precede {%s} in %s`,
+				changefeedbase.SinkParamRetention, fileNameTokenSession, fileNameTokenTopic,
+				changefeedbase.SinkParamFileNameTemplate)
+		}
+		s.retentionSessionPrefix = retentionSessionPrefix(jobID)
+		s.jobSessionID = s.retentionSessionPrefix + s.jobSessionID
+	}
+
 	if s.timestampOracle != nil {
 		s.setDataFileTimestamp()
 	}
@@ -429,6 +523,19 @@ func makeCloudStorageSink(
 	case changefeedbase.OptFormatParquet:
 		s.ext = `.parquet`
 		s.rowDelimiter = nil
+	case changefeedbase.OptFormatAvro:
+		if encodingOpts.Diff {
+			return nil, errors.Errorf(`this sink is incompatible with %s=%s and %s`,
+				changefeedbase.OptFormat, encodingOpts.Format, changefeedbase.OptDiff)
+		}
+		if encodingOpts.DeleteBeforeImage {
+			return nil, errors.Errorf(`this sink is incompatible with %s=%s and %s`,
+				changefeedbase.OptFormat, encodingOpts.Format, changefeedbase.OptDeleteBeforeImage)
+		}
+		s.ext = `.avro`
+		s.rowDelimiter = nil
+		s.schemaRegistry = newSinkSchemaRegistry()
+		s.writtenSchemas = make(map[cloudStorageSchemaFileKey]struct{})
 	default:
 		return nil, errors.Errorf(`this sink is incompatible with %s=%s`,
 			changefeedbase.OptFormat, encodingOpts.Format)
@@ -437,8 +544,7 @@ func makeCloudStorageSink(
 	switch encodingOpts.Envelope {
 	case changefeedbase.OptEnvelopeWrapped, changefeedbase.OptEnvelopeBare:
 	default:
-		return nil, errors.Errorf(`this sink is incompatible with %s=%s`,
-			changefeedbase.OptEnvelope, encodingOpts.Envelope)
+		return nil, incompatibleEnvelopeError(encodingOpts.Envelope)
 	}
 
 	if encodingOpts.Envelope != changefeedbase.OptEnvelopeBare {
@@ -466,6 +572,11 @@ func makeCloudStorageSink(
 	} else {
 		s.metrics = (*sliMetrics)(nil)
 	}
+	if s.es != nil {
+		if err := s.maybeMakeTableRegistrar(encodingOpts.Format); err != nil {
+			return nil, err
+		}
+	}
 
 	if encodingOpts.Format == changefeedbase.OptFormatParquet {
 		parquetSinkWithEncoder, err := makeParquetCloudStorageSink(s)
@@ -529,6 +640,11 @@ func (s *cloudStorageSink) EmitRow(
 	}
 	file.alloc.Merge(&alloc)
 
+	if s.schemaRegistry != nil {
+		if value, err = s.encodeAvroRow(ctx, topic, file, value); err != nil {
+			return err
+		}
+	}
 	if _, err := file.Write(value); err != nil {
 		return err
 	}
@@ -568,6 +684,12 @@ func (s *cloudStorageSink) EmitResolvedTimestamp(
 		return errors.Wrapf(err, "while emitting resolved timestamp")
 	}
 
+	if s.schemaRegistry != nil {
+		if err := s.emitAvroResolvedSchema(ctx, resolved, payload); err != nil {
+			return err
+		}
+	}
+
 	// Don't need to copy payload because we never buffer it anywhere.
 
 	part := resolved.GoTime().Format(s.partitionFormat)
@@ -575,7 +697,11 @@ func (s *cloudStorageSink) EmitResolvedTimestamp(
 	if log.V(1) {
 		log.Infof(ctx, "writing file %s %s", filename, resolved.AsOfSystemTime())
 	}
-	return cloud.WriteFile(ctx, s.es, filepath.Join(part, filename), bytes.NewReader(payload))
+	if err := cloud.WriteFile(ctx, s.es, filepath.Join(part, filename), bytes.NewReader(payload)); err != nil {
+		return err
+	}
+	s.maybeDeleteExpiredFiles(resolved)
+	return nil
 }
 
 // flushTopicVersions flushes all open files for the provided topic up to and
@@ -635,6 +761,20 @@ func (s *cloudStorageSink) Flush(ctx context.Context) error {
 	return s.waitAsyncFlush(ctx)
 }
 
+// BufferedBytes implements the BufferingSink interface. Messages are buffered
+// in the files of the sink until they are flushed.
+func (s *cloudStorageSink) BufferedBytes() int64 {
+	if s.files == nil {
+		return 0
+	}
+	var buffered int64
+	s.files.Ascend(func(i btree.Item) (wantMore bool) {
+		buffered += int64(i.(*cloudStorageSinkFile).rawSize)
+		return true
+	})
+	return buffered
+}
+
 func (s *cloudStorageSink) setDataFileTimestamp() {
 	// Record the least resolved timestamp being tracked in the frontier as of this point,
 	// to use for naming files until the next `Flush()`. See comment on cloudStorageSink
@@ -703,17 +843,43 @@ func (s *cloudStorageSink) flushFile(ctx context.Context, file *cloudStorageSink
 	// Note that we use `-` here to delimit the filename because we want
 	// `%d.RESOLVED` files to lexicographically succeed data files that have the
 	// same timestamp. This works because ascii `-` < ascii '.'.
-	filename := fmt.Sprintf(`%s-%s-%d-%d-%08x-%s-%x%s`, s.dataFileTs,
-		s.jobSessionID, s.srcID, s.sinkID, fileID, file.topic, file.schemaID, s.ext)
-	if s.prevFilename != "" && filename < s.prevFilename {
-		return errors.AssertionFailedf("error: detected a filename %s that lexically "+
-			"precedes a file emitted before: %s", filename, s.prevFilename)
+	var filename string
+	if s.fileNameTemplate != nil {
+		// The sequence number of a file only increases with the files of its
+		// topic, so that a gap in the sequence means a missing file.
+		sequence := s.topicSequences[file.topic]
+		s.topicSequences[file.topic]++
+		filename = s.fileNameTemplate.name(fileNameValues{
+			timestamp: s.dataFileTs,
+			topic:     file.topic,
+			node:      s.srcID.String(),
+			session:   s.jobSessionID,
+			sink:      s.sinkID,
+			schemaID:  file.schemaID,
+			sequence:  sequence,
+		}) + s.ext
+		if prev := s.prevTopicFilenames[file.topic]; prev != "" && filename <= prev {
+			return errors.AssertionFailedf("error: detected a filename %s that lexically "+
+				"precedes a file emitted before for the same topic: %s", filename, prev)
+		}
+		s.prevTopicFilenames[file.topic] = filename
+	} else {
+		filename = fmt.Sprintf(`%s-%s-%d-%d-%08x-%s-%x%s`, s.dataFileTs,
+			s.jobSessionID, s.srcID, s.sinkID, fileID, file.topic, file.schemaID, s.ext)
+		if s.prevFilename != "" && filename < s.prevFilename {
+			return errors.AssertionFailedf("error: detected a filename %s that lexically "+
+				"precedes a file emitted before: %s", filename, s.prevFilename)
+		}
+		s.prevFilename = filename
 	}
-	s.prevFilename = filename
 	dest := filepath.Join(s.dataFilePartition, filename)
 
 	if !asyncFlushEnabled {
-		return file.flushToStorage(ctx, s.es, dest, s.metrics)
+		if err := file.flushToStorage(ctx, s.es, dest, s.metrics); err != nil {
+			return err
+		}
+		s.maybeRegisterTable(file.topic)
+		return nil
 	}
 
 	// Try to submit flush request, but produce warning message
@@ -771,6 +937,7 @@ func (s *cloudStorageSink) asyncFlusher(ctx context.Context) error {
 				s.asyncFlushErr = err
 				return err
 			}
+			s.maybeRegisterTable(req.file.topic)
 		}
 	}
 }
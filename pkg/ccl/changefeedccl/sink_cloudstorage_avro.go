@@ -0,0 +1,288 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/errors"
+)
+
+// cloudStorageSchemaDir is the directory, relative to the root of the sink,
+// which holds the schemas of the avro records emitted to a cloud storage sink.
+// It is prefixed with '_' so that it sorts after the date partitioned data
+// directories and does not interfere with consumers iterating over files in
+// lexicographic order.
+const cloudStorageSchemaDir = `_schemas`
+
+// avroOCFMagic is the header of an avro object container file.
+// See https://avro.apache.org/docs/1.11.1/specification/#object-container-files
+var avroOCFMagic = []byte{'O', 'b', 'j', 1}
+
+const avroOCFSyncSize = 16
+
+// sinkSchemaRegistry is a schemaRegistry used when emitting avro to a
+// cloud storage sink, or to a sinkless changefeed. Rather than registering
+// schemas with a Confluent schema registry, schemas are recorded by the sink
+// itself so that consumers can decode messages without access to a live
+// registry: cloud storage sinks write schema files, and sinkless changefeeds
+// inline the schema into each message.
+//
+// Schema IDs are assigned in the order schemas are registered, so they're
+// only meaningful to the sink which owns the registry and never collide. The
+// schema files written by cloud storage sinks are instead named after a
+// digest of the schema, so that every aggregator names the same schema alike.
+type sinkSchemaRegistry struct {
+	mu struct {
+		syncutil.Mutex
+		schemas map[int32]string
+		ids     map[string]int32
+	}
+}
+
+var _ schemaRegistry = (*sinkSchemaRegistry)(nil)
+
+func newSinkSchemaRegistry() *sinkSchemaRegistry {
+	r := &sinkSchemaRegistry{}
+	r.mu.schemas = make(map[int32]string)
+	r.mu.ids = make(map[string]int32)
+	return r
+}
+
+// Ping implements the schemaRegistry interface.
+func (r *sinkSchemaRegistry) Ping(context.Context) error {
+	return nil
+}
+
+// RegisterSchemaForSubject implements the schemaRegistry interface.
+func (r *sinkSchemaRegistry) RegisterSchemaForSubject(
+	_ context.Context, _ string, schema string,
+) (int32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, ok := r.mu.ids[schema]; ok {
+		return id, nil
+	}
+	id := int32(len(r.mu.schemas) + 1)
+	r.mu.schemas[id] = schema
+	r.mu.ids[schema] = id
+	return id, nil
+}
+
+func (r *sinkSchemaRegistry) lookup(id int32) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	schema, ok := r.mu.schemas[id]
+	return schema, ok
+}
+
+// schemaRegistryForSink returns the schemaRegistry that encoders should use
+// for the given sink, or nil if the sink does not record schemas itself.
+func schemaRegistryForSink(s externalResource) schemaRegistry {
+	switch s := unwrapSink(s).(type) {
+	case *cloudStorageSink:
+		if s.schemaRegistry != nil {
+			return s.schemaRegistry
+		}
+	case *bufferSink:
+		if s.schemaRegistry != nil {
+			return s.schemaRegistry
+		}
+	case *safeSink:
+		return schemaRegistryForSink(s.wrapped)
+	}
+	return nil
+}
+
+// schemaRegistryForSinkURI returns the schemaRegistry that encoders should use
+// when they are created without a sink to emit to, during validation.
+func schemaRegistryForSinkURI(sinkURI string) schemaRegistry {
+	if sinkURI == `` {
+		return newSinkSchemaRegistry()
+	}
+	u, err := url.Parse(sinkURI)
+	if err != nil {
+		return nil
+	}
+	if scheme, ok := changefeedbase.NoLongerExperimental[u.Scheme]; ok {
+		u.Scheme = scheme
+	}
+	if isCloudStorageSink(u) {
+		return newSinkSchemaRegistry()
+	}
+	return nil
+}
+
+// schemaTimestamp returns the timestamp of the schema change which produced
+// the version of the topic being emitted, if known.
+func schemaTimestamp(topic TopicDescriptor) hlc.Timestamp {
+	switch t := topic.(type) {
+	case *tableDescriptorTopic:
+		return t.SchemaTS
+	case *columnFamilyTopic:
+		return t.SchemaTS
+	default:
+		return hlc.Timestamp{}
+	}
+}
+
+// decodeConfluentAvroHeader splits a confluent wire format message into the
+// schema ID and the binary avro datum.
+func decodeConfluentAvroHeader(msg []byte) (int32, []byte, error) {
+	if len(msg) < 5 || msg[0] != changefeedbase.ConfluentAvroWireFormatMagic {
+		return 0, nil, errors.AssertionFailedf("expected confluent avro wire format message")
+	}
+	return int32(binary.BigEndian.Uint32(msg[1:5])), msg[5:], nil
+}
+
+// writeSchemaFile records the schema with the given ID for the given topic,
+// unless that has already been done by this sink. Schema files are named
+// `_schemas/<topic>/<schema_timestamp>-<schema_digest>.avsc`, so that listing
+// the directory of a topic yields its schemas in the order they were
+// introduced. The digest is the hex encoded SHA-256 of the schema, which, as
+// opposed to its ID, is the same in every aggregator.
+func (s *cloudStorageSink) writeSchemaFile(
+	ctx context.Context, topic string, schemaTS hlc.Timestamp, id int32, schema string,
+) error {
+	key := cloudStorageSchemaFileKey{topic: topic, id: id}
+	if _, ok := s.writtenSchemas[key]; ok {
+		return nil
+	}
+	digest := sha256.Sum256([]byte(schema))
+	filename := fmt.Sprintf(`%s-%s.avsc`, cloudStorageFormatTime(schemaTS), hex.EncodeToString(digest[:]))
+	dest := filepath.Join(cloudStorageSchemaDir, topic, filename)
+	if log.V(1) {
+		log.Infof(ctx, "writing schema file %s", dest)
+	}
+	if err := cloud.WriteFile(ctx, s.es, dest, bytes.NewReader([]byte(schema))); err != nil {
+		return err
+	}
+	s.writtenSchemas[key] = struct{}{}
+	return nil
+}
+
+type cloudStorageSchemaFileKey struct {
+	topic string
+	id    int32
+}
+
+// encodeAvroRow converts a confluent wire format message into an avro object
+// container file block containing that single record, writing the container
+// file header first if this is the first record in the file.
+//
+// Object container files are used rather than delimiting records because the
+// binary avro encoding offers no safe delimiter, and because they make each
+// file self-describing.
+func (s *cloudStorageSink) encodeAvroRow(
+	ctx context.Context, topic TopicDescriptor, file *cloudStorageSinkFile, value []byte,
+) ([]byte, error) {
+	id, datum, err := decodeConfluentAvroHeader(value)
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := s.schemaRegistry.lookup(id)
+	if !ok {
+		return nil, errors.AssertionFailedf("unknown avro schema id %d", id)
+	}
+
+	if file.numMessages == 0 {
+		if err := s.writeSchemaFile(ctx, file.topic, schemaTimestamp(topic), id, schema); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(file.avroSync[:]); err != nil {
+			return nil, err
+		}
+		file.avroSchemaID = id
+		if _, err := file.Write(avroOCFHeader(schema, file.avroSync)); err != nil {
+			return nil, err
+		}
+	} else if id != file.avroSchemaID {
+		return nil, errors.AssertionFailedf(
+			"avro schema id %d does not match schema id %d of file for topic %s",
+			id, file.avroSchemaID, file.topic)
+	}
+
+	return avroOCFBlock(datum, file.avroSync), nil
+}
+
+// avroOCFBlock returns an avro object container file block containing the
+// given binary avro datum.
+func avroOCFBlock(datum []byte, sync [avroOCFSyncSize]byte) []byte {
+	block := make([]byte, 0, len(datum)+2*binary.MaxVarintLen64+avroOCFSyncSize)
+	block = binary.AppendVarint(block, 1 /* object count */)
+	block = binary.AppendVarint(block, int64(len(datum)))
+	block = append(block, datum...)
+	return append(block, sync[:]...)
+}
+
+// emitAvroResolvedSchema records the schema of an encoded resolved timestamp
+// message so that the RESOLVED files can be decoded offline. The encoder of
+// the changeFrontier registers its schemas with the registry of its sink,
+// like those of the aggregators.
+func (s *cloudStorageSink) emitAvroResolvedSchema(
+	ctx context.Context, resolved hlc.Timestamp, payload []byte,
+) error {
+	id, _, err := decodeConfluentAvroHeader(payload)
+	if err != nil {
+		return err
+	}
+	schema, ok := s.schemaRegistry.lookup(id)
+	if !ok {
+		return errors.AssertionFailedf("unknown avro schema id %d", id)
+	}
+	return s.writeSchemaFile(ctx, `RESOLVED`, resolved, id, schema)
+}
+
+// inlineAvroSchema converts a confluent wire format message into an avro
+// object container file holding just that record, so that the message carries
+// its own schema. It's used by sinkless changefeeds, whose consumers have no
+// schema registry to look the schema up in.
+func inlineAvroSchema(
+	reg *sinkSchemaRegistry, sync [avroOCFSyncSize]byte, msg []byte,
+) ([]byte, error) {
+	id, datum, err := decodeConfluentAvroHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := reg.lookup(id)
+	if !ok {
+		return nil, errors.AssertionFailedf("unknown avro schema id %d", id)
+	}
+	return append(avroOCFHeader(schema, sync), avroOCFBlock(datum, sync)...), nil
+}
+
+// avroOCFHeader returns the header of an avro object container file using the
+// given schema and sync marker.
+func avroOCFHeader(schema string, sync [avroOCFSyncSize]byte) []byte {
+	appendBytes := func(buf []byte, b []byte) []byte {
+		buf = binary.AppendVarint(buf, int64(len(b)))
+		return append(buf, b...)
+	}
+	var buf []byte
+	buf = append(buf, avroOCFMagic...)
+	// File metadata is an avro map with a single block of one entry.
+	buf = binary.AppendVarint(buf, 1)
+	buf = appendBytes(buf, []byte(`avro.schema`))
+	buf = appendBytes(buf, []byte(schema))
+	buf = binary.AppendVarint(buf, 0 /* end of map */)
+	return append(buf, sync[:]...)
+}
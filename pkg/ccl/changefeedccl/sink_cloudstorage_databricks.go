@@ -0,0 +1,90 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/cloud/databricks"
+	"github.com/cockroachdb/cockroach/pkg/util/contextutil"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+// maybeMakeTableRegistrar sets up the registration of a table over the data
+// files of each topic if the sink writes to a Databricks volume with a SQL
+// warehouse, so that the output of the changefeed is discoverable in Unity
+// Catalog rather than only as files in the volume.
+func (s *cloudStorageSink) maybeMakeTableRegistrar(format changefeedbase.FormatType) error {
+	registrar, ok, err := databricks.MakeTableRegistrar(s.es)
+	if err != nil || !ok {
+		return err
+	}
+	s.tableRegistrar = registrar
+	// The formats of the sink are named as in the read_files function of
+	// Databricks SQL.
+	s.tableFormat = string(format)
+	s.registeredTables.topics = make(map[string]struct{})
+	return nil
+}
+
+// databricksTableRegistrationTimeout bounds the registration of the table of
+// a topic, which waits for the SQL warehouse to run the statement, and may
+// have to wait for it to start.
+const databricksTableRegistrationTimeout = 2 * time.Minute
+
+// maybeRegisterTable starts registering the table of the topic, unless this
+// sink has already done so, once a data file of the topic has been written, as
+// Databricks needs a file to infer the schema of the table from. Tables are
+// registered with CREATE ... IF NOT EXISTS, so the sinks of every node and
+// every session of the changefeed can attempt it. The registration runs
+// asynchronously, within databricksTableRegistrationTimeout, so that it never
+// holds up the flush of data files. A failure to register the table doesn't
+// fail the changefeed: it is logged, and the registration is retried with the
+// next data file of the topic.
+func (s *cloudStorageSink) maybeRegisterTable(topic string) {
+	if s.tableRegistrar == nil {
+		return
+	}
+	s.registeredTables.Lock()
+	defer s.registeredTables.Unlock()
+	if _, ok := s.registeredTables.topics[topic]; ok {
+		return
+	}
+	s.registeredTables.topics[topic] = struct{}{}
+	glob := s.dataFileGlob(topic)
+	s.flushGroup.GoCtx(func(ctx context.Context) error {
+		if err := contextutil.RunWithTimeout(ctx, "register databricks table",
+			databricksTableRegistrationTimeout, func(ctx context.Context) error {
+				return s.tableRegistrar.RegisterTable(ctx, topic, s.tableFormat, glob)
+			}); err != nil {
+			log.Warningf(ctx, "could not register databricks table for topic %s: %v", topic, err)
+			s.registeredTables.Lock()
+			defer s.registeredTables.Unlock()
+			delete(s.registeredTables.topics, topic)
+		}
+		return nil
+	})
+}
+
+// dataFileGlob returns a glob matching the names of the data files of the
+// topic, and none of the schema or resolved timestamp files.
+func (s *cloudStorageSink) dataFileGlob(topic string) string {
+	if s.fileNameTemplate != nil {
+		return s.fileNameTemplate.glob(topic) + s.ext
+	}
+	return `*-` + escapeGlob(topic) + `-*` + s.ext
+}
+
+// escapeGlob escapes the characters of s which are special in globs.
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `{`, `\{`).Replace(s)
+}
@@ -0,0 +1,242 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/errors"
+)
+
+// The tokens of a file_name_template, each of which is replaced by a
+// component of the name of a data file:
+//
+// `{timestamp}` is the timestamp of the file, described on cloudStorageSink.
+// `{topic}` is the topic of the rows in the file.
+// `{node}` is the ID of the SQL instance which wrote the file.
+// `{session}` identifies the sink which wrote the file: each changeAggregator
+// session has its own sink.
+// `{sink}` is the ID of the sink among those running on the node.
+// `{schema}` identifies the schema version of the rows in the file.
+// `{sequence}` is the sequence number of the file among those written by the
+// sink for its topic, which starts at zero and increases by one with each file,
+// so that loaders can detect a missing file. It is zero padded so that it
+// sorts lexically.
+const (
+	fileNameTokenTimestamp = `timestamp`
+	fileNameTokenTopic     = `topic`
+	fileNameTokenNode      = `node`
+	fileNameTokenSession   = `session`
+	fileNameTokenSink      = `sink`
+	fileNameTokenSchema    = `schema`
+	fileNameTokenSequence  = `sequence`
+)
+
+var fileNameTokens = map[string]struct{}{
+	fileNameTokenTimestamp: {},
+	fileNameTokenTopic:     {},
+	fileNameTokenNode:      {},
+	fileNameTokenSession:   {},
+	fileNameTokenSink:      {},
+	fileNameTokenSchema:    {},
+	fileNameTokenSequence:  {},
+}
+
+// fileNameTemplate is a parsed file_name_template, which names the data files
+// of the cloud storage sink in place of the default naming convention.
+//
+// The template must name files so that the guarantees described on
+// cloudStorageSink still hold, which parseFileNameTemplate enforces:
+//   - It must begin with `{timestamp}-`, so that data files sort before the
+//     resolved timestamp files with the same timestamp, which are named
+//     `<timestamp>.RESOLVED`, since ascii `-` < ascii `.`.
+//   - It must include `{session}`, so that the sinks of other nodes and of
+//     other sessions of the changefeed can't overwrite the file, as well as
+//     `{topic}` and `{sequence}`, which make the names of the files of a sink
+//     unique.
+//   - `{schema}`, which isn't monotonic, may only follow `{sequence}`, so that
+//     the names of the files a sink writes for a topic are strictly
+//     increasing.
+//   - It can't include `/` or `.`, since the file is already placed in the
+//     partition of its timestamp, and consumers may rely on the extension
+//     being the only `.` in the name.
+type fileNameTemplate struct {
+	// parts alternates between literal text, at even indexes, and tokens, at
+	// odd indexes.
+	parts []string
+}
+
+// fileNameValues are the values of the tokens of a fileNameTemplate for one
+// data file.
+type fileNameValues struct {
+	timestamp string
+	topic     string
+	node      string
+	session   string
+	sink      int64
+	schemaID  int64
+	sequence  int64
+}
+
+func parseFileNameTemplate(template string) (fileNameTemplate, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return errors.Errorf(`invalid %s '%s': %s`, changefeedbase.SinkParamFileNameTemplate,
+			template, fmt.Sprintf(format, args...))
+	}
+	if strings.ContainsAny(template, `/.`) {
+		return fileNameTemplate{}, invalid(`must not contain '/' or '.'`)
+	}
+
+	var t fileNameTemplate
+	seen := make(map[string]int)
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return fileNameTemplate{}, invalid(`unmatched '}'`)
+			}
+			t.parts = append(t.parts, rest)
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return fileNameTemplate{}, invalid(`unmatched '{'`)
+		}
+		end += start
+		literal, token := rest[:start], rest[start+1:end]
+		if strings.IndexByte(literal, '}') >= 0 {
+			return fileNameTemplate{}, invalid(`unmatched '}'`)
+		}
+		if _, ok := fileNameTokens[token]; !ok {
+			return fileNameTemplate{}, invalid(`unknown token {%s}`, token)
+		}
+		if _, ok := seen[token]; !ok {
+			seen[token] = len(t.parts) + 1
+		}
+		t.parts = append(t.parts, literal, token)
+		rest = rest[end+1:]
+	}
+
+	if !strings.HasPrefix(template, `{`+fileNameTokenTimestamp+`}-`) {
+		return fileNameTemplate{}, invalid(`must begin with {%s}-`, fileNameTokenTimestamp)
+	}
+	for _, required := range []string{fileNameTokenSession, fileNameTokenTopic, fileNameTokenSequence} {
+		if _, ok := seen[required]; !ok {
+			return fileNameTemplate{}, invalid(`must contain {%s}`, required)
+		}
+	}
+	if i, ok := seen[fileNameTokenSchema]; ok && i < seen[fileNameTokenSequence] {
+		return fileNameTemplate{}, invalid(`{%s} must follow {%s}`,
+			fileNameTokenSchema, fileNameTokenSequence)
+	}
+	return t, nil
+}
+
+// name returns the name of a data file, without its extension.
+func (t fileNameTemplate) name(v fileNameValues) string {
+	var b strings.Builder
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+			continue
+		}
+		switch part {
+		case fileNameTokenTimestamp:
+			b.WriteString(v.timestamp)
+		case fileNameTokenTopic:
+			b.WriteString(v.topic)
+		case fileNameTokenNode:
+			b.WriteString(v.node)
+		case fileNameTokenSession:
+			b.WriteString(v.session)
+		case fileNameTokenSink:
+			b.WriteString(strconv.FormatInt(v.sink, 10))
+		case fileNameTokenSchema:
+			b.WriteString(strconv.FormatInt(v.schemaID, 16))
+		case fileNameTokenSequence:
+			fmt.Fprintf(&b, `%010d`, v.sequence)
+		}
+	}
+	return b.String()
+}
+
+// glob returns a glob matching the names, without their extension, of the
+// data files of the topic.
+func (t fileNameTemplate) glob(topic string) string {
+	var b strings.Builder
+	for i, part := range t.parts {
+		switch {
+		case i%2 == 0:
+			b.WriteString(escapeGlob(part))
+		case part == fileNameTokenTopic:
+			b.WriteString(escapeGlob(topic))
+		default:
+			b.WriteString(`*`)
+		}
+	}
+	return b.String()
+}
+
+// sessionPrecedesTopic returns whether the {session} of the template precedes
+// its {topic}, so that session can find it in the names of files.
+func (t fileNameTemplate) sessionPrecedesTopic() bool {
+	for i := 1; i < len(t.parts); i += 2 {
+		switch t.parts[i] {
+		case fileNameTokenSession:
+			return true
+		case fileNameTokenTopic:
+			return false
+		}
+	}
+	return false
+}
+
+// session returns the {session} of the name of a data file named by the
+// template, or false if the name doesn't match the template up to it. It must
+// only be used with a template whose {session} precedes its {topic}, since the
+// topic may contain any text, including that of the template.
+func (t fileNameTemplate) session(name string) (string, bool) {
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			if !strings.HasPrefix(name, part) {
+				return ``, false
+			}
+			name = name[len(part):]
+			continue
+		}
+		var n int
+		switch part {
+		case fileNameTokenTimestamp:
+			if len(name) < cloudStorageFormattedTimeLen {
+				return ``, false
+			}
+			n = cloudStorageFormattedTimeLen
+		case fileNameTokenNode, fileNameTokenSink, fileNameTokenSequence:
+			n = strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+		case fileNameTokenSchema, fileNameTokenSession:
+			n = strings.IndexFunc(name, func(r rune) bool {
+				return (r < '0' || r > '9') && (r < 'a' || r > 'f')
+			})
+		default:
+			return ``, false
+		}
+		if n < 0 {
+			n = len(name)
+		}
+		if part == fileNameTokenSession {
+			return name[:n], true
+		}
+		name = name[n:]
+	}
+	return ``, false
+}
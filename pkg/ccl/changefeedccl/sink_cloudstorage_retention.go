@@ -0,0 +1,268 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+)
+
+// With the retention sink parameter, e.g. retention=720h, the cloud storage
+// sink deletes the files its changefeed wrote once they are older than the
+// retention, so that users don't need lifecycle policies of their own matching
+// the paths of the changefeed. The age of a file is that of the timestamp its
+// name begins with, as both data files, including those named by a
+// file_name_template, and resolved timestamp files do, relative to the
+// resolved timestamp of the changefeed.
+//
+// Files are deleted by the sink of the changeFrontier, in the background, at
+// most once every cloudStorageRetentionInterval of resolved time, which is why
+// the sink parameter requires the resolved option. Only the date partitions
+// which began before the cutoff are listed, rather than the whole bucket, and
+// the partitions which ended before the cutoff of a previous sweep aren't
+// listed again. Under partition_format=flat, every sweep lists every file.
+//
+// The files of other changefeeds writing to the same path are never deleted.
+// Under the retention sink parameter, the session of the data files of a
+// changefeed, in their names, begins with the job ID of the changefeed, by
+// which they are told apart. Resolved timestamp files don't name their
+// changefeed, so they are only deleted from partitions which hold no data
+// files of other changefeeds. The files under the _schemas directory are kept,
+// since they may be needed to decode the remaining files, and so are files
+// whose names don't begin with a timestamp, which the sink didn't write.
+//
+// Files are only deleted: the external storage interface has no way to move
+// existing files to another storage class, which is left to the lifecycle
+// policies of the bucket.
+
+// cloudStorageRetentionInterval is the interval, in resolved time, at which
+// the sink deletes the files which outlived the retention.
+const cloudStorageRetentionInterval = 10 * time.Minute
+
+// cloudStorageFormattedTimeLen is the length of the timestamps formatted by
+// cloudStorageFormatTime.
+const cloudStorageFormattedTimeLen = len(`YYYYMMDDHHMMSSNNNNNNNNNLLLLLLLLLL`)
+
+// parseCloudStorageRetention parses the value of the retention sink parameter.
+func parseCloudStorageRetention(param string) (time.Duration, error) {
+	retention, err := time.ParseDuration(param)
+	if err != nil {
+		return 0, pgerror.Wrapf(err, pgcode.Syntax, `parsing %s`, changefeedbase.SinkParamRetention)
+	}
+	if retention <= 0 {
+		return 0, pgerror.Newf(pgcode.InvalidParameterValue,
+			`%s must be positive, got %s`, changefeedbase.SinkParamRetention, param)
+	}
+	return retention, nil
+}
+
+// validateCloudStorageRetention checks that a changefeed whose sink URI sets
+// the retention of its output emits resolved timestamps, as which the output
+// is deleted.
+func validateCloudStorageRetention(sinkURI string, opts changefeedbase.StatementOptions) error {
+	u, err := url.Parse(sinkURI)
+	if err != nil || u.Query().Get(changefeedbase.SinkParamRetention) == `` {
+		return nil
+	}
+	if !opts.IsSet(changefeedbase.OptResolvedTimestamps) {
+		return errors.Errorf(`%s requires the %s option`,
+			changefeedbase.SinkParamRetention, changefeedbase.OptResolvedTimestamps)
+	}
+	return nil
+}
+
+// parseCloudStorageFileTime returns the time of the timestamp which the name
+// of a file written by the sink begins with, per cloudStorageFormatTime, or
+// false if the name doesn't begin with one.
+func parseCloudStorageFileTime(name string) (time.Time, bool) {
+	if len(name) < cloudStorageFormattedTimeLen {
+		return time.Time{}, false
+	}
+	const f = `20060102150405`
+	t, err := time.Parse(f, name[:len(f)])
+	if err != nil {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.Atoi(name[len(f) : len(f)+9])
+	if err != nil {
+		return time.Time{}, false
+	}
+	if _, err := strconv.Atoi(name[len(f)+9 : cloudStorageFormattedTimeLen]); err != nil {
+		return time.Time{}, false
+	}
+	return t.Add(time.Duration(nanos)), true
+}
+
+// retentionSessionPrefix returns the prefix of the sessions of the sinks of
+// the job under the retention sink parameter.
+func retentionSessionPrefix(jobID jobspb.JobID) string {
+	return fmt.Sprintf(`%016x`, uint64(jobID))
+}
+
+// fileSession returns the session of the sink which wrote the data file with
+// the given name, or the empty string if it isn't named like the data files of
+// the sink. The session follows the timestamp of the file under the default
+// naming convention, and is the {session} of the file_name_template otherwise.
+func (s *cloudStorageSink) fileSession(name string) string {
+	if s.fileNameTemplate != nil {
+		session, _ := s.fileNameTemplate.session(name)
+		return session
+	}
+	rest := name[cloudStorageFormattedTimeLen:]
+	if !strings.HasPrefix(rest, `-`) {
+		return ``
+	}
+	session, _, _ := strings.Cut(rest[1:], `-`)
+	return session
+}
+
+// maybeDeleteExpiredFiles starts deleting the files of the changefeed of the
+// sink which are older than its retention as of resolved, if it has one, it
+// didn't do so in the last cloudStorageRetentionInterval, and it isn't still
+// doing so. Errors are logged rather than returned, so that a sweep which
+// fails is retried by the next one.
+func (s *cloudStorageSink) maybeDeleteExpiredFiles(resolved hlc.Timestamp) {
+	now := resolved.GoTime()
+	if s.retention == 0 || now.Sub(s.lastRetentionSweep) < cloudStorageRetentionInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&s.retentionSweeping, 0, 1) {
+		return
+	}
+	s.lastRetentionSweep = now
+	cutoff := now.Add(-s.retention)
+	s.flushGroup.GoCtx(func(ctx context.Context) error {
+		defer atomic.StoreInt32(&s.retentionSweeping, 0)
+		if err := s.deleteExpiredFiles(ctx, cutoff); err != nil {
+			log.Warningf(ctx, `deleting files older than %s: %v`, cutoff, err)
+		}
+		return nil
+	})
+}
+
+// deleteExpiredFiles deletes the files of the changefeed of the sink which
+// are older than the cutoff, from the date partitions which began before it.
+func (s *cloudStorageSink) deleteExpiredFiles(ctx context.Context, cutoff time.Time) error {
+	partitions, err := s.expiredPartitions(ctx, cutoff)
+	if err != nil {
+		return errors.Wrap(err, `listing partitions for retention`)
+	}
+	var deleted int
+	for _, part := range partitions {
+		n, err := s.deleteExpiredPartitionFiles(ctx, part.prefix, cutoff)
+		deleted += n
+		if err != nil {
+			return err
+		}
+		if part.end.Before(cutoff) && s.retentionSweptThrough.Before(part.end) {
+			s.retentionSweptThrough = part.end
+		}
+	}
+	if deleted > 0 {
+		log.Infof(ctx, `deleted %d files older than %s`, deleted, cutoff)
+	}
+	return nil
+}
+
+// retentionPartition is a date partition of the files of the sink, which
+// holds the files of times up to end.
+type retentionPartition struct {
+	prefix string
+	end    time.Time
+}
+
+// expiredPartitions returns the date partitions of the sink which began before
+// the cutoff, except those which ended before a previous sweep's cutoff. Under
+// partition_format=flat, it returns the root of the sink.
+func (s *cloudStorageSink) expiredPartitions(
+	ctx context.Context, cutoff time.Time,
+) ([]retentionPartition, error) {
+	if s.partitionFormat == partitionDateFormats[`flat`] {
+		return []retentionPartition{{prefix: ``, end: cutoff}}, nil
+	}
+	// Both the daily and the hourly partitions begin with the date.
+	const dateFormat = `2006-01-02`
+	var partitions []retentionPartition
+	if err := s.es.List(ctx, ``, `/`, func(name string) error {
+		prefix := strings.Trim(name, `/`)
+		day, err := time.Parse(dateFormat, prefix)
+		if err != nil {
+			// The _schemas directory, or a directory the sink didn't write.
+			return nil //nolint:returnerrcheck
+		}
+		end := day.Add(24 * time.Hour)
+		if !day.Before(cutoff) || !s.retentionSweptThrough.Before(end) {
+			return nil
+		}
+		partitions = append(partitions, retentionPartition{prefix: prefix + `/`, end: end})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].prefix < partitions[j].prefix })
+	return partitions, nil
+}
+
+// deleteExpiredPartitionFiles deletes the files of the changefeed of the sink
+// in the partition which are older than the cutoff, and returns how many it
+// deleted.
+func (s *cloudStorageSink) deleteExpiredPartitionFiles(
+	ctx context.Context, prefix string, cutoff time.Time,
+) (int, error) {
+	var expired, expiredResolved []string
+	var otherChangefeeds bool
+	if err := s.es.List(ctx, prefix, ``, func(name string) error {
+		name = path.Join(prefix, strings.TrimPrefix(name, `/`))
+		if strings.HasPrefix(name, cloudStorageSchemaDir+`/`) {
+			return nil
+		}
+		base := path.Base(name)
+		t, ok := parseCloudStorageFileTime(base)
+		if !ok {
+			return nil
+		}
+		switch {
+		case strings.HasSuffix(base, `.RESOLVED`):
+			if t.Before(cutoff) {
+				expiredResolved = append(expiredResolved, name)
+			}
+		case !strings.HasPrefix(s.fileSession(base), s.retentionSessionPrefix):
+			otherChangefeeds = true
+		case t.Before(cutoff):
+			expired = append(expired, name)
+		}
+		return nil
+	}); err != nil {
+		return 0, errors.Wrapf(err, `listing files of partition %q for retention`, prefix)
+	}
+	if !otherChangefeeds {
+		expired = append(expired, expiredResolved...)
+	}
+	for i, name := range expired {
+		if err := s.es.Delete(ctx, name); err != nil {
+			return i, errors.Wrapf(err, `deleting file %s past retention`, name)
+		}
+	}
+	return len(expired), nil
+}
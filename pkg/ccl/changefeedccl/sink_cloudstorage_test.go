@@ -12,6 +12,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"math"
@@ -21,6 +24,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -42,6 +46,8 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/span"
+	"github.com/cockroachdb/errors"
+	"github.com/linkedin/goavro/v2"
 	"github.com/stretchr/testify/require"
 )
 
@@ -212,7 +218,7 @@ func TestCloudStorageSink(t *testing.T) {
 
 		s, err := makeCloudStorageSink(
 			ctx, sinkURI(t, unlimitedFileSize), 1, settings,
-			opts, timestampOracle, externalStorageFromURI, user, nil,
+			opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s.Close()) }()
@@ -264,7 +270,7 @@ func TestCloudStorageSink(t *testing.T) {
 				timestampOracle := &changeAggregatorLowerBoundOracle{sf: sf}
 				s, err := makeCloudStorageSink(
 					ctx, sinkURI(t, unlimitedFileSize), 1, settings,
-					opts, timestampOracle, externalStorageFromURI, user, nil,
+					opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 				)
 				require.NoError(t, err)
 				defer func() { require.NoError(t, s.Close()) }()
@@ -341,13 +347,13 @@ func TestCloudStorageSink(t *testing.T) {
 		timestampOracle := &changeAggregatorLowerBoundOracle{sf: sf}
 		s1, err := makeCloudStorageSink(
 			ctx, sinkURI(t, unlimitedFileSize), 1,
-			settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+			settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s1.Close()) }()
 		s2, err := makeCloudStorageSink(
 			ctx, sinkURI(t, unlimitedFileSize), 2,
-			settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+			settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		defer func() { require.NoError(t, s2.Close()) }()
 		require.NoError(t, err)
@@ -377,13 +383,13 @@ func TestCloudStorageSink(t *testing.T) {
 		// this is unavoidable.
 		s1R, err := makeCloudStorageSink(
 			ctx, sinkURI(t, unbuffered), 1,
-			settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+			settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s1R.Close()) }()
 		s2R, err := makeCloudStorageSink(
 			ctx, sinkURI(t, unbuffered), 2,
-			settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+			settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s2R.Close()) }()
@@ -425,7 +431,7 @@ func TestCloudStorageSink(t *testing.T) {
 		timestampOracle := &changeAggregatorLowerBoundOracle{sf: sf}
 		s1, err := makeCloudStorageSink(
 			ctx, sinkURI(t, unlimitedFileSize), 1,
-			settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+			settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s1.Close()) }()
@@ -433,7 +439,7 @@ func TestCloudStorageSink(t *testing.T) {
 		s1.(*cloudStorageSink).jobSessionID = "a" // Force deterministic job session ID.
 		s2, err := makeCloudStorageSink(
 			ctx, sinkURI(t, unlimitedFileSize), 1,
-			settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+			settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s2.Close()) }()
@@ -472,7 +478,7 @@ func TestCloudStorageSink(t *testing.T) {
 		const targetMaxFileSize = 6
 		s, err := makeCloudStorageSink(
 			ctx, sinkURI(t, targetMaxFileSize), 1,
-			settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+			settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s.Close()) }()
@@ -613,7 +619,7 @@ func TestCloudStorageSink(t *testing.T) {
 					t.Logf("format=%s sinkgWithParam: %s", tc.format, sinkURIWithParam.String())
 					s, err := makeCloudStorageSink(
 						ctx, sinkURIWithParam, 1,
-						settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+						settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 					)
 
 					require.NoError(t, err)
@@ -638,6 +644,70 @@ func TestCloudStorageSink(t *testing.T) {
 		}
 	})
 
+	testWithAndWithoutAsyncFlushing(t, `file-name-template`, func(t *testing.T) {
+		t1, t2 := makeTopic(`t1`), makeTopic(`t2`)
+		testSpan := roachpb.Span{Key: []byte("a"), EndKey: []byte("b")}
+		sf, err := span.MakeFrontier(testSpan)
+		require.NoError(t, err)
+		timestampOracle := &changeAggregatorLowerBoundOracle{sf: sf}
+
+		sinkURIWithParam := sinkURI(t, unlimitedFileSize)
+		sinkURIWithParam.addParam(changefeedbase.SinkParamPartitionFormat, `flat`)
+		sinkURIWithParam.addParam(changefeedbase.SinkParamFileNameTemplate,
+			`{timestamp}-{topic}-{session}-{node}-{sink}-{sequence}-{schema}`)
+		s, err := makeCloudStorageSink(
+			ctx, sinkURIWithParam, 1, settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
+		)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, s.Close()) }()
+		s.(*cloudStorageSink).sinkID = 7 // Force a deterministic sinkID.
+		s.(*cloudStorageSink).jobSessionID = `sess`
+
+		require.NoError(t, s.EmitRow(ctx, t1, noKey, []byte(`v1`), ts(1), ts(1), zeroAlloc))
+		require.NoError(t, s.EmitRow(ctx, t2, noKey, []byte(`v2`), ts(1), ts(1), zeroAlloc))
+		require.NoError(t, s.Flush(ctx))
+		require.NoError(t, s.EmitRow(ctx, t1, noKey, []byte(`v3`), ts(2), ts(2), zeroAlloc))
+		require.NoError(t, s.Flush(ctx))
+
+		// The sequence numbers of each topic are consecutive.
+		dataFileTs := s.(*cloudStorageSink).dataFileTs
+		entries, err := os.ReadDir(filepath.Join(externalIODir, testDir(t)))
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		require.Equal(t, []string{
+			dataFileTs + `-t1-sess-1-7-0000000000-0.ndjson`,
+			dataFileTs + `-t1-sess-1-7-0000000001-0.ndjson`,
+			dataFileTs + `-t2-sess-1-7-0000000000-0.ndjson`,
+		}, names)
+		require.Equal(t, []string{"v1\n", "v3\n", "v2\n"}, slurpDir(t))
+
+		// Tables registered over the files of a topic only read its data files.
+		require.Equal(t, `*-t1-*-*-*-*-*.ndjson`, s.(*cloudStorageSink).dataFileGlob(`t1`))
+
+		for template, expectedErr := range map[string]string{
+			`{topic}-{timestamp}-{session}-{sequence}`:          `must begin with {timestamp}-`,
+			`{timestamp}-{topic}-{sequence}`:                    `must contain {session}`,
+			`{timestamp}-{topic}-{session}`:                     `must contain {sequence}`,
+			`{timestamp}-{session}-{sequence}`:                  `must contain {topic}`,
+			`{timestamp}-{topic}-{session}-{schema}-{sequence}`: `{schema} must follow {sequence}`,
+			`{timestamp}-{topic}-{session}-{sequence}-{table}`:  `unknown token {table}`,
+			`{timestamp}-{topic}-{session}-{sequence`:           `unmatched '{'`,
+			`{timestamp}-{topic}-{session}-{sequence}}`:         `unmatched '}'`,
+			`{timestamp}-{topic}-{session}-{sequence}.json`:     `must not contain '/' or '.'`,
+		} {
+			sinkURIWithParam := sinkURI(t, unlimitedFileSize)
+			sinkURIWithParam.addParam(changefeedbase.SinkParamFileNameTemplate, template)
+			_, err := makeCloudStorageSink(
+				ctx, sinkURIWithParam, 1, settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
+			)
+			require.EqualError(t, err, fmt.Sprintf(`invalid file_name_template '%s': %s`,
+				template, expectedErr))
+		}
+	})
+
 	testWithAndWithoutAsyncFlushing(t, `file-ordering`, func(t *testing.T) {
 		t1 := makeTopic(`t1`)
 		testSpan := roachpb.Span{Key: []byte("a"), EndKey: []byte("b")}
@@ -646,7 +716,7 @@ func TestCloudStorageSink(t *testing.T) {
 		timestampOracle := &changeAggregatorLowerBoundOracle{sf: sf}
 		s, err := makeCloudStorageSink(
 			ctx, sinkURI(t, unlimitedFileSize), 1,
-			settings, opts, timestampOracle, externalStorageFromURI, user, nil,
+			settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
 		)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s.Close()) }()
@@ -706,7 +776,7 @@ func TestCloudStorageSink(t *testing.T) {
 		var targetMaxFileSize int64 = 10
 		s, err := makeCloudStorageSink(
 			ctx, sinkURI(t, targetMaxFileSize), 1, settings,
-			opts, timestampOracle, externalStorageFromURI, user, nil)
+			opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil)
 		require.NoError(t, err)
 		defer func() { require.NoError(t, s.Close()) }()
 
@@ -747,4 +817,164 @@ func TestCloudStorageSink(t *testing.T) {
 			"w1\n",
 		}, slurpDir(t))
 	})
+	testWithAndWithoutAsyncFlushing(t, `avro`, func(t *testing.T) {
+		t1 := makeTopic(`t1`)
+		t1.SchemaTS = ts(3)
+		testSpan := roachpb.Span{Key: []byte("a"), EndKey: []byte("b")}
+		sf, err := span.MakeFrontier(testSpan)
+		require.NoError(t, err)
+		timestampOracle := &changeAggregatorLowerBoundOracle{sf: sf}
+		avroOpts := opts
+		avroOpts.Format = changefeedbase.OptFormatAvro
+		avroOpts.KeyInValue = false
+		s, err := makeCloudStorageSink(
+			ctx, sinkURI(t, unlimitedFileSize), 1, settings,
+			avroOpts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
+		)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, s.Close()) }()
+
+		const schema = `{"type":"record","name":"t1","fields":[{"name":"a","type":"long"}]}`
+		codec, err := goavro.NewCodec(schema)
+		require.NoError(t, err)
+		reg := schemaRegistryForSink(s)
+		require.NotNil(t, reg)
+		id, err := reg.RegisterSchemaForSubject(ctx, `t1-value`, schema)
+		require.NoError(t, err)
+
+		encode := func(a int64) []byte {
+			header := []byte{changefeedbase.ConfluentAvroWireFormatMagic, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(header[1:5], uint32(id))
+			buf, err := codec.BinaryFromNative(header, map[string]interface{}{`a`: a})
+			require.NoError(t, err)
+			return buf
+		}
+		require.NoError(t, s.EmitRow(ctx, t1, noKey, encode(1), ts(4), ts(4), zeroAlloc))
+		require.NoError(t, s.EmitRow(ctx, t1, noKey, encode(2), ts(4), ts(4), zeroAlloc))
+		require.NoError(t, s.Flush(ctx))
+
+		files := slurpDir(t)
+		require.Len(t, files, 2)
+		// The data file sorts before the schema file.
+		ocf, err := goavro.NewOCFReader(strings.NewReader(files[0]))
+		require.NoError(t, err)
+		var rows []interface{}
+		for ocf.Scan() {
+			row, err := ocf.Read()
+			require.NoError(t, err)
+			rows = append(rows, row)
+		}
+		require.NoError(t, ocf.Err())
+		require.Equal(t, []interface{}{
+			map[string]interface{}{`a`: int64(1)},
+			map[string]interface{}{`a`: int64(2)},
+		}, rows)
+
+		digest := sha256.Sum256([]byte(schema))
+		schemaFile, err := os.ReadFile(filepath.Join(externalIODir, testDir(t), cloudStorageSchemaDir,
+			`t1`, fmt.Sprintf(`%s-%s.avsc`, cloudStorageFormatTime(ts(3)), hex.EncodeToString(digest[:]))))
+		require.NoError(t, err)
+		require.Equal(t, schema, string(schemaFile))
+	})
+	testWithAndWithoutAsyncFlushing(t, `retention`, func(t *testing.T) {
+		t1 := makeTopic(`t1`)
+		testSpan := roachpb.Span{Key: []byte("a"), EndKey: []byte("b")}
+		sf, err := span.MakeFrontier(testSpan)
+		require.NoError(t, err)
+		timestampOracle := &changeAggregatorLowerBoundOracle{sf: sf}
+
+		for param, expectedErr := range map[string]string{
+			`abc`: `parsing retention: time: invalid duration "abc"`,
+			`0s`:  `retention must be positive, got 0s`,
+		} {
+			sinkURIWithParam := sinkURI(t, unlimitedFileSize)
+			sinkURIWithParam.addParam(changefeedbase.SinkParamRetention, param)
+			_, err := makeCloudStorageSink(
+				ctx, sinkURIWithParam, 1, settings, opts, timestampOracle, externalStorageFromURI, user, 0 /* jobID */, nil,
+			)
+			require.EqualError(t, err, expectedErr)
+		}
+
+		// The session of files is found by its position in their names, which
+		// it can't be if the topic, which may hold any text, precedes it.
+		sinkURIWithParam := sinkURI(t, unlimitedFileSize)
+		sinkURIWithParam.addParam(changefeedbase.SinkParamRetention, `1h`)
+		sinkURIWithParam.addParam(changefeedbase.SinkParamFileNameTemplate,
+			`{timestamp}-{topic}-{session}-{sequence}`)
+		_, err = makeCloudStorageSink(
+			ctx, sinkURIWithParam, 1, settings, opts, timestampOracle, externalStorageFromURI, user, 7 /* jobID */, nil,
+		)
+		require.EqualError(t, err, `retention requires {session} to precede {topic} in file_name_template`)
+		template, err := parseFileNameTemplate(`{timestamp}-{node}-{session}-{topic}-{sequence}`)
+		require.NoError(t, err)
+		session, ok := template.session(cloudStorageFormatTime(ts(1)) + `-1-` +
+			retentionSessionPrefix(8) + `abc-` + retentionSessionPrefix(7) + `-0000000000.ndjson`)
+		require.True(t, ok)
+		require.Equal(t, retentionSessionPrefix(8)+`abc`, session)
+
+		sinkURIWithParam = sinkURI(t, unlimitedFileSize)
+		sinkURIWithParam.addParam(changefeedbase.SinkParamRetention, `1h`)
+		s, err := makeCloudStorageSink(
+			ctx, sinkURIWithParam, 1, settings, opts, timestampOracle, externalStorageFromURI, user, 7 /* jobID */, nil,
+		)
+		require.NoError(t, err)
+		cs := s.(*cloudStorageSink)
+		waitForSweep := func() {
+			testutils.SucceedsSoon(t, func() error {
+				if atomic.LoadInt32(&cs.retentionSweeping) != 0 {
+					return errors.New(`retention sweep still running`)
+				}
+				return nil
+			})
+		}
+
+		// Schema files, files the sink didn't write and the files of other
+		// changefeeds are never deleted, and neither are the resolved timestamp
+		// files of the partitions holding files of other changefeeds. That
+		// includes the files of other changefeeds whose topic holds the session
+		// prefix of the changefeed.
+		day := int64(24 * time.Hour)
+		schemaFile := filepath.Join(cloudStorageSchemaDir, `t1`, cloudStorageFormatTime(ts(0))+`-1.avsc`)
+		otherFile := `1970-01-02/` + cloudStorageFormatTime(ts(day+1)) + `-` +
+			retentionSessionPrefix(8) + `abc-1-2-00000000-t1-1.ndjson`
+		otherResolved := `1970-01-02/` + cloudStorageFormatTime(ts(day+1)) + `.RESOLVED`
+		collidingFile := `1970-01-02/` + cloudStorageFormatTime(ts(day+2)) + `-` +
+			retentionSessionPrefix(8) + `abc-1-2-00000000-` + retentionSessionPrefix(7) + `-1.ndjson`
+		for _, name := range []string{schemaFile, `README`, otherFile, otherResolved, collidingFile} {
+			require.NoError(t, cloud.WriteFile(ctx, cs.es, name, bytes.NewReader(nil)))
+		}
+
+		require.NoError(t, s.EmitRow(ctx, t1, noKey, []byte(`v1`), ts(1), ts(1), zeroAlloc))
+		require.NoError(t, s.Flush(ctx))
+		require.NoError(t, s.EmitResolvedTimestamp(ctx, e, ts(1)))
+		waitForSweep()
+
+		forwardFrontier(sf, testSpan, 3*day)
+		require.NoError(t, s.Flush(ctx))
+		dataFileTs := cs.dataFileTs
+		require.NoError(t, s.EmitRow(ctx, t1, noKey, []byte(`v2`), ts(3*day), ts(3*day), zeroAlloc))
+		require.NoError(t, s.Flush(ctx))
+		require.NoError(t, s.EmitResolvedTimestamp(ctx, e, ts(3*day)))
+		// Closing the sink waits for the sweep started by the resolved timestamp.
+		require.NoError(t, s.Close())
+
+		// The files of the changefeed older than an hour as of the resolved
+		// timestamp are gone.
+		var names []string
+		absRoot := filepath.Join(externalIODir, testDir(t))
+		require.NoError(t, filepath.Walk(absRoot, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			name, err := filepath.Rel(absRoot, path)
+			names = append(names, name)
+			return err
+		}))
+		require.Len(t, names, 7)
+		require.Equal(t, []string{otherFile, otherResolved, collidingFile}, names[:3])
+		require.True(t, strings.HasPrefix(names[3], `1970-01-04/`+dataFileTs+`-`+retentionSessionPrefix(7)), names[3])
+		require.Equal(t, []string{
+			`1970-01-04/` + cloudStorageFormatTime(ts(3*day)) + `.RESOLVED`, `README`, schemaFile,
+		}, names[4:])
+	})
 }
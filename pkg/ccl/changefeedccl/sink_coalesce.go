@@ -0,0 +1,180 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+// coalesceSink wraps a sink, collapsing the messages emitted to it for the
+// same key of the same topic within a window of time into the latest of
+// them. It is used for the coalesce_window option, which reduces the number
+// of messages emitted for hot rows, such as counters.
+//
+// A row is held back for the window from its first update, any later update
+// within the window replacing its message. Messages are emitted in the order
+// their rows were first updated, so that the messages for a given key are
+// delivered in order. Held back messages are emitted when later messages are
+// emitted to the sink, or, at the latest, when the sink is flushed. Because
+// the frontier only advances once Flush returns, it never advances past an
+// update whose message has not been acknowledged by the sink.
+type coalesceSink struct {
+	wrapped    Sink
+	window     time.Duration
+	timeSource timeutil.TimeSource
+
+	mu struct {
+		syncutil.Mutex
+		rows map[coalesceKey]*coalescedRow
+		// pending holds the rows in the order of their first update.
+		pending []*coalescedRow
+	}
+}
+
+type coalesceKey struct {
+	topic TopicIdentifier
+	key   string
+}
+
+type coalescedRow struct {
+	topic         TopicDescriptor
+	key, value    []byte
+	updated, mvcc hlc.Timestamp
+	alloc         kvevent.Alloc
+	// since is when the row was first updated, which its message is held
+	// back for the window from.
+	since time.Time
+}
+
+var _ Sink = (*coalesceSink)(nil)
+
+func makeCoalesceSink(
+	wrapped Sink, window time.Duration, timeSource timeutil.TimeSource,
+) *coalesceSink {
+	s := &coalesceSink{wrapped: wrapped, window: window, timeSource: timeSource}
+	s.mu.rows = make(map[coalesceKey]*coalescedRow)
+	return s
+}
+
+func (s *coalesceSink) getConcreteType() sinkType {
+	return s.wrapped.getConcreteType()
+}
+
+// Dial implements the Sink interface.
+func (s *coalesceSink) Dial() error {
+	return s.wrapped.Dial()
+}
+
+// EmitRow implements the Sink interface.
+func (s *coalesceSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeSource.Now()
+	k := coalesceKey{topic: topic.GetTopicIdentifier(), key: string(key)}
+	r, ok := s.mu.rows[k]
+	if !ok {
+		r = &coalescedRow{topic: topic, key: append([]byte(nil), key...), since: now}
+		s.mu.rows[k] = r
+		s.mu.pending = append(s.mu.pending, r)
+	}
+	// Copy the value since the caller may reuse the buffer.
+	r.value = append(r.value[:0], value...)
+	r.updated, r.mvcc = updated, mvcc
+	r.alloc.Merge(&alloc)
+
+	return s.emitPendingLocked(ctx, func(r *coalescedRow) bool {
+		return now.Sub(r.since) >= s.window
+	})
+}
+
+// emitPendingLocked emits the messages of the pending rows, in order, until
+// it reaches one for which emit returns false.
+func (s *coalesceSink) emitPendingLocked(
+	ctx context.Context, emit func(r *coalescedRow) bool,
+) error {
+	for len(s.mu.pending) > 0 && emit(s.mu.pending[0]) {
+		r := s.mu.pending[0]
+		s.mu.pending[0] = nil
+		s.mu.pending = s.mu.pending[1:]
+		delete(s.mu.rows, coalesceKey{topic: r.topic.GetTopicIdentifier(), key: string(r.key)})
+		if err := s.wrapped.EmitRow(ctx, r.topic, r.key, r.value, r.updated, r.mvcc, r.alloc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmitResolvedTimestamp implements the Sink interface.
+func (s *coalesceSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	return s.wrapped.EmitResolvedTimestamp(ctx, encoder, resolved)
+}
+
+// EmitResolvedTimestampForTargets implements TargetResolvedTimestampSink.
+func (s *coalesceSink) EmitResolvedTimestampForTargets(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	include func(changefeedbase.Target) bool,
+) error {
+	sink, ok := s.wrapped.(TargetResolvedTimestampSink)
+	if !ok {
+		return errors.AssertionFailedf(`sink does not support per table resolved timestamps`)
+	}
+	return sink.EmitResolvedTimestampForTargets(ctx, encoder, resolved, include)
+}
+
+// Flush implements the Sink interface. The messages of all the pending rows
+// are emitted before flushing the wrapped sink.
+func (s *coalesceSink) Flush(ctx context.Context) error {
+	if err := func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.emitPendingLocked(ctx, func(*coalescedRow) bool { return true })
+	}(); err != nil {
+		return err
+	}
+	return s.wrapped.Flush(ctx)
+}
+
+// Close implements the Sink interface.
+func (s *coalesceSink) Close() error {
+	s.mu.Lock()
+	for _, r := range s.mu.pending {
+		r.alloc.Release(context.Background())
+	}
+	s.mu.pending = nil
+	s.mu.rows = make(map[coalesceKey]*coalescedRow)
+	s.mu.Unlock()
+	return s.wrapped.Close()
+}
+
+// Topics implements the SinkWithTopics interface.
+func (s *coalesceSink) Topics() []string {
+	if withTopics, ok := s.wrapped.(SinkWithTopics); ok {
+		return withTopics.Topics()
+	}
+	return nil
+}
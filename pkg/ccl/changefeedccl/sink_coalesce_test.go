@@ -0,0 +1,114 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/stretchr/testify/require"
+)
+
+type coalesceRecordingSink struct {
+	testSink
+	emitted []string
+	flushes int
+}
+
+var _ Sink = (*coalesceRecordingSink)(nil)
+
+func (s *coalesceRecordingSink) Dial() error {
+	return nil
+}
+
+func (s *coalesceRecordingSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	s.emitted = append(s.emitted, fmt.Sprintf(`%s->%s@%d`, key, value, updated.WallTime))
+	alloc.Release(ctx)
+	return nil
+}
+
+func (s *coalesceRecordingSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	return nil
+}
+
+func (s *coalesceRecordingSink) Flush(ctx context.Context) error {
+	s.flushes++
+	return nil
+}
+
+func (s *coalesceRecordingSink) Close() error {
+	return nil
+}
+
+func TestCoalesceSink(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	p := &testAllocPool{}
+	wrapped := &coalesceRecordingSink{}
+	ts := timeutil.NewManualTime(timeutil.Unix(0, 0))
+	sink := makeCoalesceSink(wrapped, 500*time.Millisecond, ts)
+	topic := makeTopic(`foo`)
+
+	emit := func(key, value string, updated int64) {
+		require.NoError(t, sink.EmitRow(ctx, topic, []byte(key), []byte(value),
+			hlc.Timestamp{WallTime: updated}, hlc.Timestamp{WallTime: updated}, p.alloc()))
+	}
+
+	// Updates within the window are held back, later updates to a key
+	// replacing its message.
+	emit(`[1]`, `{"a": 1}`, 1)
+	emit(`[2]`, `{"a": 1}`, 2)
+	ts.Advance(100 * time.Millisecond)
+	emit(`[1]`, `{"a": 2}`, 3)
+	emit(`[1]`, `{"a": 3}`, 4)
+	require.Empty(t, wrapped.emitted)
+	require.EqualValues(t, 4, p.used())
+
+	// Once the window of the first updated rows elapses, their latest
+	// messages are emitted in the order the rows were first updated.
+	ts.Advance(400 * time.Millisecond)
+	emit(`[3]`, `{"a": 1}`, 5)
+	require.Equal(t, []string{
+		`[1]->{"a": 3}@4`,
+		`[2]->{"a": 1}@2`,
+	}, wrapped.emitted)
+	require.EqualValues(t, 1, p.used())
+
+	// Flushing emits the held back messages before flushing the wrapped sink.
+	require.NoError(t, sink.Flush(ctx))
+	require.Equal(t, []string{
+		`[1]->{"a": 3}@4`,
+		`[2]->{"a": 1}@2`,
+		`[3]->{"a": 1}@5`,
+	}, wrapped.emitted)
+	require.Equal(t, 1, wrapped.flushes)
+	require.EqualValues(t, 0, p.used())
+
+	// Held back messages are released when the sink is closed.
+	emit(`[1]`, `{"a": 4}`, 6)
+	require.NoError(t, sink.Close())
+	require.EqualValues(t, 0, p.used())
+}
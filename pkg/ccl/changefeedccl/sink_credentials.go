@@ -0,0 +1,153 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// sinkCredentialsPollInterval bounds how often a sink reloads the external
+// connection holding its URI for rotated credentials.
+var sinkCredentialsPollInterval = settings.RegisterDurationSetting(
+	settings.TenantWritable,
+	"changefeed.sink_credentials.poll_interval",
+	"minimum interval at which kafka and webhook sinks whose URI is held by an external "+
+		"connection reload it when they reconnect, so that rotated credentials are picked "+
+		"up without restarting the changefeed; 0 disables reloading",
+	time.Minute,
+	settings.NonNegativeDuration,
+)
+
+// sinkCredentials are the credentials in the URI of a sink.
+type sinkCredentials struct {
+	// saslUser and saslPassword authenticate kafka sinks.
+	saslUser     string
+	saslPassword string
+	// authHeader is the Authorization header of the requests of webhook
+	// sinks.
+	authHeader string
+}
+
+// sinkCredentialsFromURI returns the credentials in the given sink URI.
+func sinkCredentialsFromURI(uri string) (sinkCredentials, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return sinkCredentials{}, err
+	}
+	q := u.Query()
+	return sinkCredentials{
+		saslUser:     q.Get(changefeedbase.SinkParamSASLUser),
+		saslPassword: q.Get(changefeedbase.SinkParamSASLPassword),
+		authHeader:   q.Get(changefeedbase.SinkParamWebhookAuthHeader),
+	}, nil
+}
+
+// credentialsReloader reloads the credentials of a sink from the external
+// connection holding its URI, so that credentials rotated by recreating the
+// external connection are picked up by a running sink the next time it
+// reconnects, rather than once the changefeed is paused and resumed.
+type credentialsReloader struct {
+	// load returns the current URI of the external connection.
+	load    func(ctx context.Context) (string, error)
+	sv      *settings.Values
+	metrics metricsRecorder
+
+	mu struct {
+		syncutil.Mutex
+		creds    sinkCredentials
+		loadedAt time.Time
+	}
+}
+
+func newCredentialsReloader(
+	load func(ctx context.Context) (string, error),
+	sv *settings.Values,
+	metrics metricsRecorder,
+	creds sinkCredentials,
+) *credentialsReloader {
+	r := &credentialsReloader{load: load, sv: sv, metrics: metrics}
+	r.mu.creds = creds
+	r.mu.loadedAt = timeutil.Now()
+	return r
+}
+
+// credentials returns the current credentials of the sink, reloading them if
+// they were last loaded longer than the poll interval ago. If reloading fails,
+// e.g. while the external connection is being recreated, the previous
+// credentials are returned.
+func (r *credentialsReloader) credentials(ctx context.Context) sinkCredentials {
+	r.mu.Lock()
+	prev := r.mu.creds
+	interval := sinkCredentialsPollInterval.Get(r.sv)
+	if interval == 0 || timeutil.Since(r.mu.loadedAt) < interval {
+		r.mu.Unlock()
+		return prev
+	}
+	// Other callers keep using the current credentials while they are
+	// loaded, which happens without holding the lock since it reads the
+	// database.
+	r.mu.loadedAt = timeutil.Now()
+	r.mu.Unlock()
+
+	uri, err := r.load(ctx)
+	if err != nil {
+		log.Warningf(ctx, "could not reload sink credentials: %v", err)
+		return prev
+	}
+	creds, err := sinkCredentialsFromURI(uri)
+	if err != nil {
+		log.Warningf(ctx, "could not reload sink credentials: %v", err)
+		return prev
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if creds != r.mu.creds {
+		log.Infof(ctx, "reloaded rotated sink credentials")
+		r.mu.creds = creds
+		if r.metrics != nil {
+			r.metrics.recordCredentialReload()
+		}
+	}
+	return r.mu.creds
+}
+
+// credentialsReloadingSink is implemented by sinks which pick up rotated
+// credentials when they reconnect.
+type credentialsReloadingSink interface {
+	setCredentialsReloader(r *credentialsReloader)
+}
+
+// maybeSetCredentialsReloader sets the credentials reloader of the sink, or
+// of the sink it wraps, if it picks up rotated credentials. It returns whether
+// it did.
+func maybeSetCredentialsReloader(s externalResource, r *credentialsReloader) bool {
+	switch s := s.(type) {
+	case *errorWrapperSink:
+		return maybeSetCredentialsReloader(s.wrapped, r)
+	case *batchEnvelopeSink:
+		return maybeSetCredentialsReloader(s.wrapped, r)
+	case *coalesceSink:
+		return maybeSetCredentialsReloader(s.wrapped, r)
+	case *emitTimeSink:
+		return maybeSetCredentialsReloader(s.wrapped, r)
+	case credentialsReloadingSink:
+		s.setCredentialsReloader(r)
+		return true
+	}
+	return false
+}
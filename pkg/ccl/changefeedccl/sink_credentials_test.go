@@ -0,0 +1,167 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdctest"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsReloader(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	agg := newAggregateMetrics(time.Minute)
+	sli, err := agg.getOrCreateScope(defaultSLIScope)
+	require.NoError(t, err)
+
+	uri := `kafka://broker:9092?sasl_enabled=true&sasl_user=a&sasl_password=old`
+	var loadErr error
+	load := func(context.Context) (string, error) { return uri, loadErr }
+	creds, err := sinkCredentialsFromURI(uri)
+	require.NoError(t, err)
+	require.Equal(t, sinkCredentials{saslUser: `a`, saslPassword: `old`}, creds)
+	r := newCredentialsReloader(load, &st.SV, sli, creds)
+
+	// Credentials are only reloaded once the poll interval elapses.
+	uri = `kafka://broker:9092?sasl_enabled=true&sasl_user=a&sasl_password=new`
+	require.Equal(t, `old`, r.credentials(ctx).saslPassword)
+
+	sinkCredentialsPollInterval.Override(ctx, &st.SV, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	require.Equal(t, `new`, r.credentials(ctx).saslPassword)
+	require.EqualValues(t, 1, sli.CredentialReloads.Value())
+
+	// Reloads which fail keep the previous credentials, e.g. while the
+	// external connection is recreated.
+	loadErr = errors.New(`external connection "foo" does not exist`)
+	time.Sleep(time.Millisecond)
+	require.Equal(t, `new`, r.credentials(ctx).saslPassword)
+	loadErr = nil
+
+	// Reloads of unchanged credentials aren't counted.
+	time.Sleep(time.Millisecond)
+	require.Equal(t, `new`, r.credentials(ctx).saslPassword)
+	require.EqualValues(t, 1, sli.CredentialReloads.Value())
+
+	t.Run("kafka", func(t *testing.T) {
+		sink := &kafkaSink{ctx: ctx}
+		require.True(t, maybeSetCredentialsReloader(makeBatchEnvelopeSink(sink, 10), r))
+		require.Equal(t, r, sink.credentials)
+
+		config := sarama.NewConfig()
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = `a`
+		config.Net.SASL.Password = `old`
+		reloaded := sink.withReloadedCredentials(config)
+		require.Equal(t, `new`, reloaded.Net.SASL.Password)
+		require.Equal(t, `old`, config.Net.SASL.Password)
+	})
+
+	t.Run("webhook", func(t *testing.T) {
+		cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+		require.NoError(t, err)
+		sinkDest, err := cdctest.StartMockWebhookSink(cert)
+		require.NoError(t, err)
+		defer sinkDest.Close()
+
+		sinkURI := func(authHeader string) string {
+			u, err := url.Parse(sinkDest.URL())
+			require.NoError(t, err)
+			params := u.Query()
+			params.Set(changefeedbase.SinkParamCACert, certEncoded)
+			params.Set(changefeedbase.SinkParamWebhookAuthHeader, authHeader)
+			u.RawQuery = params.Encode()
+			return fmt.Sprintf("webhook-%s", u.String())
+		}
+		uri = sinkURI(`Bearer old`)
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+
+		opts := getGenericWebhookSinkOptions()
+		encodingOpts, err := opts.GetEncodingOptions()
+		require.NoError(t, err)
+		sinkOpts, err := opts.GetWebhookSinkOptions()
+		require.NoError(t, err)
+		sinkSrc, err := makeWebhookSink(ctx, sinkURL{URL: u}, encodingOpts, sinkOpts, 1,
+			timeutil.DefaultTimeSource{}, &st.SV, nilMetricsRecorderBuilder)
+		require.NoError(t, err)
+		require.NoError(t, sinkSrc.Dial())
+		defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+		sinkCredentialsPollInterval.Override(ctx, &st.SV, time.Hour)
+		creds, err := sinkCredentialsFromURI(uri)
+		require.NoError(t, err)
+		require.True(t, maybeSetCredentialsReloader(sinkSrc, newCredentialsReloader(load, &st.SV, sli, creds)))
+
+		emit := func() {
+			require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte(`[1]`), []byte(`{"after":{"a":1}}`), zeroTS, zeroTS, zeroAlloc))
+			require.NoError(t, sinkSrc.Flush(ctx))
+		}
+		emit()
+		require.Equal(t, `Bearer old`, sinkDest.LatestHeader().Get(authorizationHeader))
+
+		// The rotated header is used by the requests after it's reloaded.
+		uri = sinkURI(`Bearer new`)
+		sinkCredentialsPollInterval.Override(ctx, &st.SV, time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		emit()
+		require.Equal(t, `Bearer new`, sinkDest.LatestHeader().Get(authorizationHeader))
+		require.EqualValues(t, 2, sli.CredentialReloads.Value())
+	})
+
+	t.Run("webhook auth header option", func(t *testing.T) {
+		u, err := url.Parse(`webhook-https://example.com?auth_header=Bearer+a`)
+		require.NoError(t, err)
+		opts := getGenericWebhookSinkOptions(struct {
+			key   string
+			value string
+		}{changefeedbase.OptWebhookAuthHeader, `Bearer b`})
+		encodingOpts, err := opts.GetEncodingOptions()
+		require.NoError(t, err)
+		sinkOpts, err := opts.GetWebhookSinkOptions()
+		require.NoError(t, err)
+		_, err = makeWebhookSink(ctx, sinkURL{URL: u}, encodingOpts, sinkOpts, 1,
+			timeutil.DefaultTimeSource{}, &st.SV, nilMetricsRecorderBuilder)
+		require.EqualError(t, err,
+			`webhook_auth_header and the auth_header sink parameter cannot both be specified`)
+	})
+}
+
+func TestChangefeedJobDescriptionRedactsAuthHeader(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	const sinkURI = `webhook-https://sink.example.com?auth_header=Bearer+secret`
+	stmt, err := parser.ParseOne(`CREATE CHANGEFEED FOR foo INTO '` + sinkURI + `'`)
+	require.NoError(t, err)
+	description, err := changefeedJobDescription(context.Background(),
+		stmt.AST.(*tree.CreateChangefeed), sinkURI, nil, /* additionalSinkURIs */
+		changefeedbase.MakeStatementOptions(nil))
+	require.NoError(t, err)
+	require.NotContains(t, description, `secret`)
+	require.Contains(t, description, `auth_header=redacted`)
+}
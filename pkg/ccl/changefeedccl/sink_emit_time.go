@@ -0,0 +1,108 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+// emitTimeStampingSink is implemented by sinks which buffer the messages
+// emitted to them before writing them, and so stamp the emit times of the
+// latency fields of messages themselves, when they write them.
+type emitTimeStampingSink interface {
+	stampsEmitTimes()
+}
+
+// emitTimeSink wraps a sink, stamping the emit times of the latency fields of
+// the messages emitted to it under the latency_timestamps option as they are
+// written to it. See stampEmitTime.
+type emitTimeSink struct {
+	wrapped Sink
+}
+
+var _ Sink = (*emitTimeSink)(nil)
+
+// maybeWrapEmitTimeSink wraps the sink in an emitTimeSink, unless it stamps
+// the emit times of messages itself.
+func maybeWrapEmitTimeSink(wrapped Sink) Sink {
+	if _, ok := wrapped.(emitTimeStampingSink); ok {
+		return wrapped
+	}
+	return &emitTimeSink{wrapped: wrapped}
+}
+
+func (s *emitTimeSink) getConcreteType() sinkType {
+	return s.wrapped.getConcreteType()
+}
+
+// Dial implements the Sink interface.
+func (s *emitTimeSink) Dial() error {
+	return s.wrapped.Dial()
+}
+
+// EmitRow implements the Sink interface.
+func (s *emitTimeSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	now := timeutil.Now()
+	stampEmitTime(value, now)
+	if event := binaryCloudEventFromContext(ctx); event != nil {
+		stampEmitTime(event.data, now)
+	}
+	return s.wrapped.EmitRow(ctx, topic, key, value, updated, mvcc, alloc)
+}
+
+// EmitResolvedTimestamp implements the Sink interface.
+func (s *emitTimeSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	return s.wrapped.EmitResolvedTimestamp(ctx, encoder, resolved)
+}
+
+// EmitResolvedTimestampForTargets implements TargetResolvedTimestampSink.
+func (s *emitTimeSink) EmitResolvedTimestampForTargets(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	include func(changefeedbase.Target) bool,
+) error {
+	sink, ok := s.wrapped.(TargetResolvedTimestampSink)
+	if !ok {
+		return errors.AssertionFailedf(`sink does not support per table resolved timestamps`)
+	}
+	return sink.EmitResolvedTimestampForTargets(ctx, encoder, resolved, include)
+}
+
+// Flush implements the Sink interface.
+func (s *emitTimeSink) Flush(ctx context.Context) error {
+	return s.wrapped.Flush(ctx)
+}
+
+// Close implements the Sink interface.
+func (s *emitTimeSink) Close() error {
+	return s.wrapped.Close()
+}
+
+// Topics implements the SinkWithTopics interface.
+func (s *emitTimeSink) Topics() []string {
+	if withTopics, ok := s.wrapped.(SinkWithTopics); ok {
+		return withTopics.Topics()
+	}
+	return nil
+}
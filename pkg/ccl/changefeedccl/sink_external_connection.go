@@ -40,27 +40,51 @@ func makeExternalConnectionSink(
 	}
 
 	externalConnectionName := u.Host
+	load := func(ctx context.Context) (string, error) {
+		return loadExternalConnectionSinkURI(ctx, db, externalConnectionName)
+	}
+
+	sinkURI, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Replace the external connection URI in the `feedCfg` with the URI of the
+	// underlying resource.
+	feedCfg.SinkURI = sinkURI
+	sink, err := getSink(ctx, serverCfg, feedCfg, timestampOracle, user, jobID, m)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sink picks up credentials rotated in the external connection when
+	// it reconnects.
+	creds, err := sinkCredentialsFromURI(sinkURI)
+	if err != nil {
+		return nil, err
+	}
+	maybeSetCredentialsReloader(sink,
+		newCredentialsReloader(load, &serverCfg.Settings.SV, m, creds))
+	return sink, nil
+}
 
+// loadExternalConnectionSinkURI returns the URI of the resource represented by
+// the named external connection.
+func loadExternalConnectionSinkURI(ctx context.Context, db isql.DB, name string) (string, error) {
 	// Retrieve the external connection object from the system table.
 	var ec externalconn.ExternalConnection
 	if err := db.Txn(ctx, func(ctx context.Context, txn isql.Txn) error {
 		var err error
-		ec, err = externalconn.LoadExternalConnection(ctx, externalConnectionName, txn)
+		ec, err = externalconn.LoadExternalConnection(ctx, name, txn)
 		return err
 	}); err != nil {
-		return nil, errors.Wrap(err, "failed to load external connection object")
+		return "", errors.Wrap(err, "failed to load external connection object")
 	}
 
-	// Construct a Sink handle for the underlying resource represented by the
-	// external connection object.
 	switch d := ec.ConnectionProto().Details.(type) {
 	case *connectionpb.ConnectionDetails_SimpleURI:
-		// Replace the external connection URI in the `feedCfg` with the URI of the
-		// underlying resource.
-		feedCfg.SinkURI = d.SimpleURI.URI
-		return getSink(ctx, serverCfg, feedCfg, timestampOracle, user, jobID, m)
+		return d.SimpleURI.URI, nil
 	default:
-		return nil, errors.Newf("cannot connect to %T; unsupported resource for a Sink connection", d)
+		return "", errors.Newf("cannot connect to %T; unsupported resource for a Sink connection", d)
 	}
 }
 
@@ -0,0 +1,428 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"net/url"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/errors"
+)
+
+// fanOutSink emits every message to each of the sinks of a changefeed created
+// with INTO (sink, sink, ...), so that a single set of rangefeeds can feed
+// several destinations.
+//
+// By default, an error from any sink fails the changefeed. Sinks after the
+// first may instead specify failure_policy=isolate, in which case the
+// changefeed stops emitting to a sink which fails and carries on with the
+// rest. Isolated sinks are reported to the changeFrontier, which stops
+// advancing their high-water in the job progress.
+//
+// The memory of a message is held until each sink it was emitted to has
+// released it.
+type fanOutSink struct {
+	sinks []fanOutChild
+	// mayIsolate is true if any of the sinks may be isolated.
+	mayIsolate bool
+
+	mu struct {
+		syncutil.Mutex
+		// isolated records the error which caused each isolated sink to be
+		// isolated.
+		isolated map[int32]error
+		// shared are the allocations of the messages emitted while a sink
+		// may be isolated which some sink has yet to release. When a sink is
+		// isolated, its shares are released on its behalf.
+		shared map[*kvevent.SharedAlloc]struct{}
+	}
+}
+
+type fanOutChild struct {
+	// sink is nil if the sink was isolated before the flow started.
+	sink    Sink
+	isolate bool
+}
+
+var _ Sink = (*fanOutSink)(nil)
+
+// makeFanOutSink returns a sink emitting to the sinks of the given changefeed,
+// each of which is created with makeSink. Sinks which were isolated by a
+// previous run of the changefeed have an empty URI, and are not created.
+func makeFanOutSink(
+	feedCfg jobspb.ChangefeedDetails, makeSink func(jobspb.ChangefeedDetails) (Sink, error),
+) (_ *fanOutSink, err error) {
+	f := &fanOutSink{}
+	f.mu.isolated = make(map[int32]error)
+	f.mu.shared = make(map[*kvevent.SharedAlloc]struct{})
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+		}
+	}()
+
+	sinkURIs := append([]string{feedCfg.SinkURI}, feedCfg.AdditionalSinkURIs...)
+	for i, sinkURI := range sinkURIs {
+		if sinkURI == `` {
+			f.sinks = append(f.sinks, fanOutChild{isolate: true})
+			f.mu.isolated[int32(i)] = errors.New(`isolated by a previous run of the changefeed`)
+			continue
+		}
+		childURI, isolate, err := parseFanOutSinkURI(sinkURI)
+		if err != nil {
+			return nil, err
+		}
+		childCfg := feedCfg
+		childCfg.SinkURI = childURI
+		childCfg.AdditionalSinkURIs = nil
+		sink, err := makeSink(childCfg)
+		if err != nil {
+			return nil, err
+		}
+		f.sinks = append(f.sinks, fanOutChild{sink: sink, isolate: isolate})
+		f.mayIsolate = f.mayIsolate || isolate
+	}
+	return f, nil
+}
+
+// parseFanOutSinkURI returns the sink URI with the failure_policy parameter
+// removed, along with whether the sink should be isolated if it fails.
+func parseFanOutSinkURI(sinkURI string) (_ string, isolate bool, _ error) {
+	u, err := url.Parse(sinkURI)
+	if err != nil {
+		return "", false, err
+	}
+	q := u.Query()
+	if _, ok := q[changefeedbase.SinkParamFailurePolicy]; !ok {
+		return sinkURI, false, nil
+	}
+	switch policy := q.Get(changefeedbase.SinkParamFailurePolicy); policy {
+	case changefeedbase.SinkFailurePolicyFail:
+	case changefeedbase.SinkFailurePolicyIsolate:
+		isolate = true
+	default:
+		return "", false, errors.Errorf(`unknown %s %q, expected %q or %q`,
+			changefeedbase.SinkParamFailurePolicy, policy,
+			changefeedbase.SinkFailurePolicyFail, changefeedbase.SinkFailurePolicyIsolate)
+	}
+	q.Del(changefeedbase.SinkParamFailurePolicy)
+	u.RawQuery = q.Encode()
+	return u.String(), isolate, nil
+}
+
+// expandKafkaMirrors replaces each kafka sink URI with mirror parameters by
+// the URIs of the clusters it produces to: the URI without the mirror
+// parameters, followed by a URI for each mirror cluster, which differs only
+// by its bootstrap brokers and failure_policy. The clusters are then emitted
+// to as separate sinks, each with its own producer and acks.
+//
+// The failure_policy of the mirrors is given by a single mirror_failure_policy
+// parameter, or by one for each mirror parameter, in the same order.
+func expandKafkaMirrors(sinkURIs []string) ([]string, error) {
+	var expanded []string
+	for _, sinkURI := range sinkURIs {
+		u, err := url.Parse(sinkURI)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		mirrors := q[changefeedbase.SinkParamMirror]
+		policies := q[changefeedbase.SinkParamMirrorFailurePolicy]
+		if u.Scheme != changefeedbase.SinkSchemeKafka || (len(mirrors) == 0 && len(policies) == 0) {
+			expanded = append(expanded, sinkURI)
+			continue
+		}
+		if len(mirrors) == 0 {
+			return nil, errors.Errorf(`%s requires %s`,
+				changefeedbase.SinkParamMirrorFailurePolicy, changefeedbase.SinkParamMirror)
+		}
+		if len(policies) > 1 && len(policies) != len(mirrors) {
+			return nil, errors.Errorf(`expected a single %s, or one for each of the %d %s parameters, got %d`,
+				changefeedbase.SinkParamMirrorFailurePolicy, len(mirrors), changefeedbase.SinkParamMirror,
+				len(policies))
+		}
+		q.Del(changefeedbase.SinkParamMirror)
+		q.Del(changefeedbase.SinkParamMirrorFailurePolicy)
+		u.RawQuery = q.Encode()
+		expanded = append(expanded, u.String())
+
+		for i, brokers := range mirrors {
+			if brokers == `` {
+				return nil, errors.Errorf(`%s must not be empty`, changefeedbase.SinkParamMirror)
+			}
+			mirrorQuery, err := url.ParseQuery(u.RawQuery)
+			if err != nil {
+				return nil, err
+			}
+			if len(policies) == 1 {
+				mirrorQuery.Set(changefeedbase.SinkParamFailurePolicy, policies[0])
+			} else if len(policies) > 1 {
+				mirrorQuery.Set(changefeedbase.SinkParamFailurePolicy, policies[i])
+			}
+			mirror := *u
+			mirror.Host = brokers
+			mirror.RawQuery = mirrorQuery.Encode()
+			expanded = append(expanded, mirror.String())
+		}
+	}
+	return expanded, nil
+}
+
+// validateFanOutSinkURIs checks the failure_policy of each sink of a
+// changefeed. The first sink can't be isolated, since the changefeed's
+// resolved timestamps and high-water track it.
+func validateFanOutSinkURIs(sinkURI string, additionalSinkURIs []string) error {
+	for i, u := range append([]string{sinkURI}, additionalSinkURIs...) {
+		withoutPolicy, isolate, err := parseFanOutSinkURI(u)
+		if err != nil {
+			return err
+		}
+		if len(additionalSinkURIs) == 0 {
+			if withoutPolicy != u {
+				return errors.Errorf(`%s is only supported when emitting to multiple sinks`,
+					changefeedbase.SinkParamFailurePolicy)
+			}
+			return nil
+		}
+		if i == 0 && isolate {
+			return errors.WithHint(
+				errors.Errorf(`%s=%s is not supported for the first sink`,
+					changefeedbase.SinkParamFailurePolicy, changefeedbase.SinkFailurePolicyIsolate),
+				`the first sink determines the changefeed's progress; list it after a sink which must not be isolated`)
+		}
+	}
+	return nil
+}
+
+// withoutIsolatedSinks returns the details to use when planning a changefeed,
+// in which the URIs of sinks isolated by a previous run are empty. Isolated
+// sinks remain isolated for the life of the changefeed, since they have
+// missed changes that the rest of the sinks received.
+func withoutIsolatedSinks(
+	details jobspb.ChangefeedDetails, progress jobspb.Progress,
+) jobspb.ChangefeedDetails {
+	cf := progress.GetChangefeed()
+	if cf == nil || len(details.AdditionalSinkURIs) == 0 {
+		return details
+	}
+	sinkURIs := append([]string(nil), details.AdditionalSinkURIs...)
+	for i, sp := range cf.Sinks {
+		if sp.Isolated && i > 0 && i <= len(sinkURIs) {
+			sinkURIs[i-1] = ``
+		}
+	}
+	details.AdditionalSinkURIs = sinkURIs
+	return details
+}
+
+func (f *fanOutSink) getConcreteType() sinkType {
+	return f.sinks[0].sink.getConcreteType()
+}
+
+// isIsolated returns true if the i-th sink is no longer emitted to.
+func (f *fanOutSink) isIsolated(i int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.mu.isolated[int32(i)]
+	return ok
+}
+
+// forEach calls fn with each sink which has not been isolated. If fn returns
+// an error for a sink which may be isolated, the sink is isolated and the
+// error is not returned.
+func (f *fanOutSink) forEach(ctx context.Context, fn func(i int, s Sink) error) error {
+	for i, c := range f.sinks {
+		if f.isIsolated(i) {
+			continue
+		}
+		if err := fn(i, c.sink); err != nil {
+			if !c.isolate {
+				return err
+			}
+			f.isolateSink(ctx, i, err)
+		}
+	}
+	return nil
+}
+
+func (f *fanOutSink) isolateSink(ctx context.Context, i int, err error) {
+	log.Warningf(ctx, "changefeed isolating sink %d after error: %v", i, err)
+	f.mu.Lock()
+	f.mu.isolated[int32(i)] = err
+	shared := make([]*kvevent.SharedAlloc, 0, len(f.mu.shared))
+	for s := range f.mu.shared {
+		shared = append(shared, s)
+	}
+	f.mu.Unlock()
+	if closeErr := f.sinks[i].sink.Close(); closeErr != nil {
+		log.Warningf(ctx, "error closing isolated sink %d: %v", i, closeErr)
+	}
+	// The isolated sink won't acknowledge the messages it was emitted, so
+	// their memory is released once the rest of the sinks have.
+	for _, s := range shared {
+		s.Release(ctx, i)
+	}
+}
+
+// forgetShared stops tracking an allocation which every sink has released.
+func (f *fanOutSink) forgetShared(s *kvevent.SharedAlloc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.mu.shared, s)
+}
+
+// IsolatedSinks returns the indexes of the sinks which have been isolated.
+func (f *fanOutSink) IsolatedSinks() []int32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	isolated := make([]int32, 0, len(f.mu.isolated))
+	for i := range f.mu.isolated {
+		isolated = append(isolated, i)
+	}
+	sort.Slice(isolated, func(i, j int) bool { return isolated[i] < isolated[j] })
+	return isolated
+}
+
+// isolationError returns the error which caused the first isolated sink to be
+// isolated, if any.
+func (f *fanOutSink) isolationError() error {
+	isolated := f.IsolatedSinks()
+	if len(isolated) == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return errors.Wrapf(f.mu.isolated[isolated[0]], `sink %d`, isolated[0])
+}
+
+// Dial implements the Sink interface.
+func (f *fanOutSink) Dial() error {
+	ctx := context.Background()
+	return f.forEach(ctx, func(_ int, s Sink) error {
+		return s.Dial()
+	})
+}
+
+// EmitRow implements the Sink interface. Each sink is emitted a share of the
+// allocation, which is released once every sink has released its share.
+func (f *fanOutSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	var shared *kvevent.SharedAlloc
+	if f.mayIsolate {
+		shared = kvevent.Share(alloc, len(f.sinks), f.forgetShared)
+		if shared != nil {
+			f.mu.Lock()
+			f.mu.shared[shared] = struct{}{}
+			f.mu.Unlock()
+		}
+	} else {
+		shared = kvevent.Share(alloc, len(f.sinks), nil /* onReleased */)
+	}
+	if err := f.forEach(ctx, func(i int, s Sink) error {
+		return s.EmitRow(ctx, topic, key, value, updated, mvcc, shared.Alloc(i))
+	}); err != nil {
+		return err
+	}
+	// Sinks which have been isolated, including those isolated by this
+	// message, were not emitted it.
+	for i := range f.sinks {
+		if f.isIsolated(i) {
+			shared.Release(ctx, i)
+		}
+	}
+	return nil
+}
+
+// EmitResolvedTimestamp implements the Sink interface.
+func (f *fanOutSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	return f.forEach(ctx, func(_ int, s Sink) error {
+		return s.EmitResolvedTimestamp(ctx, encoder, resolved)
+	})
+}
+
+// EmitResolvedTimestampForTargets implements TargetResolvedTimestampSink.
+func (f *fanOutSink) EmitResolvedTimestampForTargets(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	include func(changefeedbase.Target) bool,
+) error {
+	return f.forEach(ctx, func(_ int, s Sink) error {
+		sink, ok := s.(TargetResolvedTimestampSink)
+		if !ok {
+			return errors.AssertionFailedf(`sink does not support per table resolved timestamps`)
+		}
+		return sink.EmitResolvedTimestampForTargets(ctx, encoder, resolved, include)
+	})
+}
+
+// Flush implements the Sink interface.
+func (f *fanOutSink) Flush(ctx context.Context) error {
+	return f.forEach(ctx, func(_ int, s Sink) error {
+		return s.Flush(ctx)
+	})
+}
+
+// Close implements the Sink interface.
+func (f *fanOutSink) Close() error {
+	var err error
+	for i, c := range f.sinks {
+		if c.sink == nil || f.isIsolated(i) {
+			// Isolated sinks were closed when they were isolated.
+			continue
+		}
+		err = errors.CombineErrors(err, c.sink.Close())
+	}
+	return err
+}
+
+// BufferedBytes implements the BufferingSink interface, summing the backlogs
+// of the sinks which buffer the messages emitted to them.
+func (f *fanOutSink) BufferedBytes() int64 {
+	var buffered int64
+	for _, c := range f.sinks {
+		if b, ok := asBufferingSink(c.sink); ok {
+			buffered += b.BufferedBytes()
+		}
+	}
+	return buffered
+}
+
+// Topics implements the SinkWithTopics interface.
+func (f *fanOutSink) Topics() []string {
+	var topics []string
+	seen := make(map[string]struct{})
+	for _, c := range f.sinks {
+		withTopics, ok := c.sink.(SinkWithTopics)
+		if !ok {
+			continue
+		}
+		for _, t := range withTopics.Topics() {
+			if _, ok := seen[t]; !ok {
+				seen[t] = struct{}{}
+				topics = append(topics, t)
+			}
+		}
+	}
+	return topics
+}
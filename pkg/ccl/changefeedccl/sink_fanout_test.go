@@ -0,0 +1,307 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type fanOutRecordingSink struct {
+	testSink
+	uri      string
+	rows     int
+	resolved int
+	err      error
+	closed   bool
+	// held are the allocations of the rows emitted while hold is set, which
+	// are released by Flush.
+	hold bool
+	held []kvevent.Alloc
+}
+
+var _ Sink = (*fanOutRecordingSink)(nil)
+
+func (s *fanOutRecordingSink) Dial() error {
+	return nil
+}
+
+func (s *fanOutRecordingSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	if s.hold {
+		s.held = append(s.held, alloc)
+	} else {
+		alloc.Release(ctx)
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.rows++
+	return nil
+}
+
+func (s *fanOutRecordingSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.resolved++
+	return nil
+}
+
+func (s *fanOutRecordingSink) Flush(ctx context.Context) error {
+	if s.err != nil {
+		return s.err
+	}
+	for i := range s.held {
+		s.held[i].Release(ctx)
+	}
+	s.held = nil
+	return nil
+}
+
+func (s *fanOutRecordingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestFanOutSink(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	makeSinks := func(feedCfg jobspb.ChangefeedDetails) (*fanOutSink, []*fanOutRecordingSink) {
+		var sinks []*fanOutRecordingSink
+		f, err := makeFanOutSink(feedCfg, func(childCfg jobspb.ChangefeedDetails) (Sink, error) {
+			require.Empty(t, childCfg.AdditionalSinkURIs)
+			s := &fanOutRecordingSink{uri: childCfg.SinkURI}
+			sinks = append(sinks, s)
+			return s, nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, f.Dial())
+		return f, sinks
+	}
+
+	t.Run("emits to every sink", func(t *testing.T) {
+		p := &testAllocPool{}
+		f, sinks := makeSinks(jobspb.ChangefeedDetails{
+			SinkURI:            `kafka://a?failure_policy=fail`,
+			AdditionalSinkURIs: []string{`gs://b?AUTH=implicit&failure_policy=isolate`},
+		})
+		require.Equal(t, `kafka://a`, sinks[0].uri)
+		require.Equal(t, `gs://b?AUTH=implicit`, sinks[1].uri)
+
+		require.NoError(t, f.EmitRow(ctx, makeTopic(`foo`), []byte(`[1]`), []byte(`{}`),
+			hlc.Timestamp{}, hlc.Timestamp{}, p.alloc()))
+		require.NoError(t, f.EmitResolvedTimestamp(ctx, nil, hlc.Timestamp{WallTime: 1}))
+		require.NoError(t, f.Flush(ctx))
+		for _, s := range sinks {
+			require.Equal(t, 1, s.rows)
+			require.Equal(t, 1, s.resolved)
+		}
+		require.EqualValues(t, 0, p.used())
+		require.Empty(t, f.IsolatedSinks())
+
+		require.NoError(t, f.Close())
+		require.True(t, sinks[0].closed)
+		require.True(t, sinks[1].closed)
+	})
+
+	t.Run("isolates failing sinks", func(t *testing.T) {
+		f, sinks := makeSinks(jobspb.ChangefeedDetails{
+			SinkURI:            `kafka://a`,
+			AdditionalSinkURIs: []string{`gs://b?failure_policy=isolate`, `webhook-https://c`},
+		})
+		sinks[1].err = errors.New(`boom`)
+		require.NoError(t, f.EmitRow(ctx, makeTopic(`foo`), []byte(`[1]`), []byte(`{}`),
+			hlc.Timestamp{}, hlc.Timestamp{}, zeroAlloc))
+		require.Equal(t, []int32{1}, f.IsolatedSinks())
+		require.True(t, sinks[1].closed)
+		require.Regexp(t, `sink 1: boom`, f.isolationError())
+
+		// The isolated sink is no longer emitted to.
+		sinks[1].err = nil
+		require.NoError(t, f.EmitRow(ctx, makeTopic(`foo`), []byte(`[2]`), []byte(`{}`),
+			hlc.Timestamp{}, hlc.Timestamp{}, zeroAlloc))
+		require.Equal(t, []int{2, 0, 2}, []int{sinks[0].rows, sinks[1].rows, sinks[2].rows})
+
+		// Sinks which can't be isolated fail the changefeed.
+		sinks[2].err = errors.New(`bust`)
+		require.Regexp(t, `bust`, f.Flush(ctx))
+		require.NoError(t, f.Close())
+	})
+
+	t.Run("releases memory once every sink has", func(t *testing.T) {
+		p := &testAllocPool{}
+		f, sinks := makeSinks(jobspb.ChangefeedDetails{
+			SinkURI:            `kafka://a`,
+			AdditionalSinkURIs: []string{`gs://b?failure_policy=isolate`, `webhook-https://c`},
+		})
+		sinks[1].hold = true
+		sinks[2].hold = true
+		require.NoError(t, f.EmitRow(ctx, makeTopic(`foo`), []byte(`[1]`), []byte(`{}`),
+			hlc.Timestamp{}, hlc.Timestamp{}, p.alloc()))
+		require.EqualValues(t, 1, p.used())
+		require.NoError(t, sinks[2].Flush(ctx))
+		require.EqualValues(t, 1, p.used())
+
+		// The shares of an isolated sink are released when it is isolated.
+		sinks[1].err = errors.New(`boom`)
+		require.NoError(t, f.Flush(ctx))
+		require.Equal(t, []int32{1}, f.IsolatedSinks())
+		require.EqualValues(t, 0, p.used())
+
+		require.NoError(t, f.EmitRow(ctx, makeTopic(`foo`), []byte(`[2]`), []byte(`{}`),
+			hlc.Timestamp{}, hlc.Timestamp{}, p.alloc()))
+		require.EqualValues(t, 1, p.used())
+		require.NoError(t, f.Flush(ctx))
+		require.EqualValues(t, 0, p.used())
+		require.NoError(t, f.Close())
+	})
+
+	t.Run("skips sinks isolated by a previous run", func(t *testing.T) {
+		details := withoutIsolatedSinks(jobspb.ChangefeedDetails{
+			SinkURI:            `kafka://a`,
+			AdditionalSinkURIs: []string{`gs://b?failure_policy=isolate`},
+		}, jobspb.Progress{
+			Details: &jobspb.Progress_Changefeed{Changefeed: &jobspb.ChangefeedProgress{
+				Sinks: []jobspb.ChangefeedProgress_SinkProgress{{}, {Isolated: true}},
+			}},
+		})
+		f, sinks := makeSinks(details)
+		require.Len(t, sinks, 1)
+		require.Equal(t, []int32{1}, f.IsolatedSinks())
+		require.NoError(t, f.EmitResolvedTimestamp(ctx, nil, hlc.Timestamp{WallTime: 1}))
+		require.Equal(t, 1, sinks[0].resolved)
+		require.NoError(t, f.Close())
+	})
+}
+
+func TestValidateFanOutSinkURIs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	for _, tc := range []struct {
+		sinkURI    string
+		additional []string
+		err        string
+	}{
+		{sinkURI: `kafka://a`},
+		{sinkURI: `kafka://a`, additional: []string{`gs://b?failure_policy=isolate`}},
+		{sinkURI: `kafka://a?failure_policy=fail`, additional: []string{`gs://b`}},
+		{
+			sinkURI: `kafka://a?failure_policy=fail`,
+			err:     `failure_policy is only supported when emitting to multiple sinks`,
+		},
+		{
+			sinkURI:    `kafka://a?failure_policy=isolate`,
+			additional: []string{`gs://b`},
+			err:        `failure_policy=isolate is not supported for the first sink`,
+		},
+		{
+			sinkURI:    `kafka://a`,
+			additional: []string{`gs://b?failure_policy=ignore`},
+			err:        `unknown failure_policy "ignore"`,
+		},
+	} {
+		err := validateFanOutSinkURIs(tc.sinkURI, tc.additional)
+		if tc.err == `` {
+			require.NoError(t, err)
+		} else {
+			require.Regexp(t, tc.err, err)
+		}
+	}
+}
+
+func TestExpandKafkaMirrors(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	for _, tc := range []struct {
+		sinkURIs []string
+		expected []string
+		err      string
+	}{
+		{
+			sinkURIs: []string{`kafka://a:9092?topic_prefix=p`, `gs://b`},
+			expected: []string{`kafka://a:9092?topic_prefix=p`, `gs://b`},
+		},
+		{
+			sinkURIs: []string{`kafka://a:9092?mirror=b:9092,c:9092&topic_prefix=p`},
+			expected: []string{`kafka://a:9092?topic_prefix=p`, `kafka://b:9092,c:9092?topic_prefix=p`},
+		},
+		{
+			sinkURIs: []string{`kafka://a:9092?mirror=b:9092&mirror=c:9092&mirror_failure_policy=isolate`},
+			expected: []string{
+				`kafka://a:9092`,
+				`kafka://b:9092?failure_policy=isolate`,
+				`kafka://c:9092?failure_policy=isolate`,
+			},
+		},
+		{
+			sinkURIs: []string{`kafka://a:9092?mirror=b:9092&mirror_failure_policy=isolate` +
+				`&mirror=c:9092&mirror_failure_policy=fail`},
+			expected: []string{
+				`kafka://a:9092`,
+				`kafka://b:9092?failure_policy=isolate`,
+				`kafka://c:9092?failure_policy=fail`,
+			},
+		},
+		{
+			sinkURIs: []string{`gs://b`, `kafka://a:9092?failure_policy=isolate&mirror=b:9092`},
+			expected: []string{
+				`gs://b`,
+				`kafka://a:9092?failure_policy=isolate`,
+				`kafka://b:9092?failure_policy=isolate`,
+			},
+		},
+		{
+			// Only kafka sinks mirror; other sinks reject the parameter when
+			// they're created.
+			sinkURIs: []string{`webhook-https://a?mirror=b`},
+			expected: []string{`webhook-https://a?mirror=b`},
+		},
+		{
+			sinkURIs: []string{`kafka://a:9092?mirror_failure_policy=isolate`},
+			err:      `mirror_failure_policy requires mirror`,
+		},
+		{
+			sinkURIs: []string{`kafka://a:9092?mirror=b:9092&mirror=c:9092&mirror=d:9092` +
+				`&mirror_failure_policy=isolate&mirror_failure_policy=fail`},
+			err: `expected a single mirror_failure_policy, or one for each of the 3 mirror parameters, got 2`,
+		},
+		{
+			sinkURIs: []string{`kafka://a:9092?mirror=`},
+			err:      `mirror must not be empty`,
+		},
+	} {
+		expanded, err := expandKafkaMirrors(tc.sinkURIs)
+		if tc.err == `` {
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, expanded)
+		} else {
+			require.Regexp(t, tc.err, err)
+		}
+	}
+}
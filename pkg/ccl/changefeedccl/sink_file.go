@@ -0,0 +1,390 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdclib"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// defaultFileSinkSegmentSize is the size at which the file sink starts a
+	// new segment, unless the segment_size parameter is given.
+	defaultFileSinkSegmentSize = 64 << 20
+	// defaultFileSinkRetention and defaultFileSinkMaxBufferSize bound the
+	// segments a file sink keeps, unless the retention and max_buffer_size
+	// parameters are given, so that a sink whose segments are never
+	// forwarded doesn't fill the disk of its node.
+	defaultFileSinkRetention     = 7 * 24 * time.Hour
+	defaultFileSinkMaxBufferSize = 10 << 30
+)
+
+// fileSink writes the rows and resolved timestamps of a changefeed to segment
+// files in a directory on the local disk of each node, for environments in
+// which the downstream system is only reachable intermittently. The segments
+// are read by the cockroach debug changefeed-replay command, which forwards
+// their rows once the downstream system is reachable again.
+//
+// Segments hold the frames of the stream protocol of the cdclib package, and
+// each sink writes its own segments, as though each were a connection of a
+// stream sink. Flushing the sink syncs the current segment to disk, so the
+// changefeed doesn't checkpoint past rows which could be lost if the node
+// crashed. Once a segment reaches the segment size, the sink starts a new one
+// and deletes the segments of its job which are older than the retention, or
+// which exceed the maximum buffer size, oldest first; rows which have not been
+// forwarded by then are lost, so the retention should cover the longest time
+// for which the downstream system may be unreachable. Both are bounded by
+// default, and are only disabled by setting them to 0. The segments of other
+// changefeeds writing to the same directory are never deleted.
+type fileSink struct {
+	dir           string
+	segmentSize   int64
+	retention     time.Duration
+	maxBufferSize int64
+	hello         cdclib.Hello
+
+	topicNamer *TopicNamer
+	// schemas is the table version of each topic most recently written to
+	// the current segment, so that each segment is self-contained.
+	schemas map[TopicIdentifier]descpb.DescriptorVersion
+	streamSchemas
+
+	seg *segmentFile
+	// segments is the number of segments the sink has started for its split.
+	segments int
+
+	metrics metricsRecorder
+}
+
+var _ Sink = (*fileSink)(nil)
+var _ SchemaDescribingSink = (*fileSink)(nil)
+
+// segmentFile is the segment which a file sink is writing.
+type segmentFile struct {
+	name string
+	f    *os.File
+	w    *bufio.Writer
+	// size is the number of bytes written to the file, excluding those
+	// buffered by w.
+	size int64
+}
+
+// Write implements the io.Writer interface, for w.
+func (s *segmentFile) Write(p []byte) (int, error) {
+	n, err := s.f.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// sync writes the buffered frames of the segment to its file and syncs it.
+func (s *segmentFile) sync() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func makeFileSink(
+	u sinkURL,
+	externalIODir string,
+	jobID jobspb.JobID,
+	targets changefeedbase.Targets,
+	encodingOpts changefeedbase.EncodingOptions,
+	mb metricsRecorderBuilder,
+) (Sink, error) {
+	if u.Host != `` || u.User != nil {
+		return nil, errors.Errorf(`file sink URIs must be of the form %s:///path`,
+			changefeedbase.SinkSchemeFile)
+	}
+	if externalIODir == `` {
+		return nil, errors.Errorf(`the file sink requires the external IO directory, which is disabled`)
+	}
+	// The path is relative to the external IO directory, and is cleaned as a
+	// rooted path so that it can't refer to directories outside of it.
+	dir := filepath.Join(externalIODir, filepath.FromSlash(path.Clean(`/`+u.Path)))
+
+	s := &fileSink{
+		dir:           dir,
+		segmentSize:   defaultFileSinkSegmentSize,
+		retention:     defaultFileSinkRetention,
+		maxBufferSize: defaultFileSinkMaxBufferSize,
+		schemas:       make(map[TopicIdentifier]descpb.DescriptorVersion),
+		metrics:       mb(noResourceAccounting),
+	}
+	if v := u.consumeParam(changefeedbase.SinkParamSegmentSize); v != `` {
+		var err error
+		if s.segmentSize, err = humanizeutil.ParseBytes(v); err != nil || s.segmentSize <= 0 {
+			return nil, errors.Errorf(`invalid %s: %q`, changefeedbase.SinkParamSegmentSize, v)
+		}
+	}
+	if v := u.consumeParam(changefeedbase.SinkParamRetention); v != `` {
+		var err error
+		if s.retention, err = time.ParseDuration(v); err != nil || s.retention < 0 {
+			return nil, errors.Errorf(`invalid %s: %q`, changefeedbase.SinkParamRetention, v)
+		}
+	}
+	if v := u.consumeParam(changefeedbase.SinkParamMaxBufferSize); v != `` {
+		var err error
+		if s.maxBufferSize, err = humanizeutil.ParseBytes(v); err != nil || s.maxBufferSize < 0 {
+			return nil, errors.Errorf(`invalid %s: %q`, changefeedbase.SinkParamMaxBufferSize, v)
+		}
+	}
+	if s.maxBufferSize > 0 && s.maxBufferSize < s.segmentSize {
+		return nil, errors.Errorf(`%s must be at least %s`,
+			changefeedbase.SinkParamMaxBufferSize, changefeedbase.SinkParamSegmentSize)
+	}
+	if unknownParams := u.remainingQueryParams(); len(unknownParams) > 0 {
+		return nil, errors.Errorf(
+			`unknown file sink query parameters: %s`, strings.Join(unknownParams, ", "))
+	}
+
+	var err error
+	if s.topicNamer, err = MakeTopicNamer(targets, familyTopicNameOptions(encodingOpts)...); err != nil {
+		return nil, err
+	}
+	s.hello = cdclib.Hello{
+		Version: cdclib.ProtocolVersion,
+		Split: cdclib.Split{
+			JobID:  int64(jobID),
+			Topics: s.topicNamer.DisplayNamesSlice(),
+		},
+		Format:   string(encodingOpts.Format),
+		Envelope: string(encodingOpts.Envelope),
+	}
+	return s, nil
+}
+
+func (s *fileSink) getConcreteType() sinkType {
+	return sinkTypeFile
+}
+
+// Dial implements the Sink interface.
+func (s *fileSink) Dial() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return errors.Wrapf(err, `creating directory of file sink`)
+	}
+	// Every sink writes a new split, even if it is redialed.
+	s.hello.Split.ID = uuid.MakeV4().String()
+	s.segments = 0
+	return s.openSegment()
+}
+
+// openSegment starts a new segment, beginning with the hello frame of the
+// split of the sink.
+func (s *fileSink) openSegment() error {
+	s.segments++
+	name := cdclib.SegmentName(timeutil.Now(), s.hello.Split.JobID, s.hello.Split.ID, s.segments)
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, `creating segment %s`, name)
+	}
+	seg := &segmentFile{name: name, f: f}
+	seg.w = bufio.NewWriter(seg)
+	if err := cdclib.WriteMessage(seg.w, s.hello); err != nil {
+		_ = f.Close()
+		return err
+	}
+	// The directory is synced so that the segment isn't lost if the node
+	// crashes once its frames are synced.
+	if err := syncDir(s.dir); err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.seg = seg
+	for id := range s.schemas {
+		delete(s.schemas, id)
+	}
+	return nil
+}
+
+// closeSegment syncs and closes the current segment.
+func (s *fileSink) closeSegment() error {
+	if s.seg == nil {
+		return nil
+	}
+	err := s.seg.sync()
+	err = errors.CombineErrors(err, s.seg.f.Close())
+	s.seg = nil
+	return err
+}
+
+// maybeRotate starts a new segment if the current one has reached the
+// segment size, and then deletes the segments which are beyond the retention
+// of the sink.
+func (s *fileSink) maybeRotate(ctx context.Context) error {
+	if s.seg.size+int64(s.seg.w.Buffered()) < s.segmentSize {
+		return nil
+	}
+	if err := s.closeSegment(); err != nil {
+		return err
+	}
+	if err := s.openSegment(); err != nil {
+		return err
+	}
+	return s.deleteExpiredSegments(ctx)
+}
+
+// deleteExpiredSegments deletes the segments of the job of the sink which are
+// older than the retention, and then the oldest of them until they are no
+// larger than the maximum buffer size. The current segment, and the segments
+// of other jobs in the directory, are never deleted.
+func (s *fileSink) deleteExpiredSegments(ctx context.Context) error {
+	if s.retention == 0 && s.maxBufferSize == 0 {
+		return nil
+	}
+	names, err := cdclib.ListSegments(s.dir)
+	if err != nil {
+		return err
+	}
+	type segment struct {
+		name string
+		size int64
+	}
+	var segments []segment
+	var total int64
+	now := timeutil.Now()
+	for _, name := range names {
+		if jobID, ok := cdclib.SegmentJobID(name); !ok || jobID != s.hello.Split.JobID || name == s.seg.name {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(s.dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Deleted by the sink of another processor.
+				continue
+			}
+			return err
+		}
+		if s.retention > 0 && now.Sub(info.ModTime()) > s.retention {
+			if err := s.deleteSegment(ctx, name); err != nil {
+				return err
+			}
+			continue
+		}
+		segments = append(segments, segment{name: name, size: info.Size()})
+		total += info.Size()
+	}
+	if s.maxBufferSize == 0 {
+		return nil
+	}
+	// Segments are listed oldest first.
+	for _, seg := range segments {
+		if total <= s.maxBufferSize {
+			break
+		}
+		if err := s.deleteSegment(ctx, seg.name); err != nil {
+			return err
+		}
+		total -= seg.size
+	}
+	return nil
+}
+
+func (s *fileSink) deleteSegment(ctx context.Context, name string) error {
+	log.Infof(ctx, "deleting changefeed segment %s past the retention of file sink", name)
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Topics gives the names of all topics that have been initialized
+// and will receive resolved timestamps.
+func (s *fileSink) Topics() []string {
+	return s.topicNamer.DisplayNamesSlice()
+}
+
+// EmitRow implements the Sink interface.
+func (s *fileSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	defer alloc.Release(ctx)
+	defer s.metrics.recordOneMessage()(mvcc, len(key)+len(value), sinkDoesNotCompress)
+
+	name, err := s.topicNamer.Name(topic)
+	if err != nil {
+		return err
+	}
+	id := topic.GetTopicIdentifier()
+	if version, ok := s.schemas[id]; !ok || version != topic.GetVersion() {
+		if err := cdclib.WriteMessage(s.seg.w, cdclib.Schema{
+			Topic:    name,
+			TableID:  uint32(id.TableID),
+			FamilyID: uint32(id.FamilyID),
+			Version:  uint32(topic.GetVersion()),
+			Columns:  s.columnsOf(topic),
+		}); err != nil {
+			return err
+		}
+		s.schemas[id] = topic.GetVersion()
+	}
+	if err := cdclib.WriteMessage(s.seg.w, cdclib.Row{
+		Topic:   name,
+		Key:     key,
+		Value:   value,
+		Updated: streamTimestamp(updated),
+		MVCC:    streamTimestamp(mvcc),
+	}); err != nil {
+		return err
+	}
+	return s.maybeRotate(ctx)
+}
+
+// EmitResolvedTimestamp implements the Sink interface. The resolved timestamp
+// is written as a watermark, and isn't encoded.
+func (s *fileSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	defer s.metrics.recordResolvedCallback()()
+	if err := cdclib.WriteMessage(s.seg.w, cdclib.Watermark{Resolved: streamTimestamp(resolved)}); err != nil {
+		return err
+	}
+	return s.seg.sync()
+}
+
+// Flush implements the Sink interface.
+func (s *fileSink) Flush(ctx context.Context) error {
+	defer s.metrics.recordFlushRequestCallback()()
+	return s.seg.sync()
+}
+
+// Close implements the Sink interface.
+func (s *fileSink) Close() error {
+	return s.closeSegment()
+}
+
+// syncDir syncs a directory, so that the files created in it are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errors.CombineErrors(d.Sync(), d.Close())
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdclib"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	externalIODir := t.TempDir()
+	encodingOpts := changefeedbase.EncodingOptions{
+		Format:   changefeedbase.OptFormatJSON,
+		Envelope: changefeedbase.OptEnvelopeWrapped,
+	}
+	makeSink := func(uri string) (Sink, error) {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		return makeFileSink(sinkURL{URL: u}, externalIODir, 7, makeChangefeedTargets(`foo`),
+			encodingOpts, nilMetricsRecorderBuilder)
+	}
+
+	// readSegments reads the frames of the segments in dir, as the replay
+	// command does.
+	readSegments := func(dir string) (segments int, frames []string) {
+		names, err := cdclib.ListSegments(dir)
+		require.NoError(t, err)
+		for _, name := range names {
+			f, err := os.Open(filepath.Join(dir, name))
+			require.NoError(t, err)
+			require.NoError(t, cdclib.ReadSegment(f, func(hello cdclib.Hello, m cdclib.Message) error {
+				require.EqualValues(t, 7, hello.Split.JobID)
+				switch m := m.(type) {
+				case cdclib.Schema:
+					frames = append(frames, fmt.Sprintf(`schema %s@%d`, m.Topic, m.Version))
+				case cdclib.Row:
+					frames = append(frames, fmt.Sprintf(`row %s %s->%s @%s`, m.Topic, m.Key, m.Value, m.Updated))
+				case cdclib.Watermark:
+					frames = append(frames, fmt.Sprintf(`watermark %s`, m.Resolved))
+				}
+				return nil
+			}))
+			require.NoError(t, f.Close())
+		}
+		return len(names), frames
+	}
+
+	foo := topic(`foo`)
+	foo.Version = 1
+	ts := func(wall int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wall} }
+
+	t.Run("emit", func(t *testing.T) {
+		// The path can't escape the external IO directory.
+		sink, err := makeSink(`file:///../../feed`)
+		require.NoError(t, err)
+		require.NoError(t, sink.Dial())
+		dir := filepath.Join(externalIODir, `feed`)
+
+		require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[1]`), []byte(`{"a":1}`), ts(1), ts(1), zeroAlloc))
+		require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[2]`), []byte(`{"a":2}`), ts(2), ts(2), zeroAlloc))
+		// Rows which are flushed are read from the segment while it's being
+		// written.
+		require.NoError(t, sink.Flush(ctx))
+		_, frames := readSegments(dir)
+		require.Len(t, frames, 3)
+		require.NoError(t, sink.EmitResolvedTimestamp(ctx, nil, ts(3)))
+		require.NoError(t, sink.Close())
+
+		segments, frames := readSegments(dir)
+		require.Equal(t, 1, segments)
+		require.Equal(t, []string{
+			`schema foo@1`,
+			`row foo [1]->{"a":1} @1.0000000000`,
+			`row foo [2]->{"a":2} @2.0000000000`,
+			`watermark 3.0000000000`,
+		}, frames)
+	})
+
+	t.Run("rotation and retention", func(t *testing.T) {
+		sink, err := makeSink(`file:///rotated?segment_size=1B&max_buffer_size=1KiB`)
+		require.NoError(t, err)
+		require.NoError(t, sink.Dial())
+		dir := filepath.Join(externalIODir, `rotated`)
+
+		// Each segment holds a single row, and the schema of its topic.
+		for i := 1; i <= 3; i++ {
+			require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[1]`), []byte(`{"a":1}`), ts(int64(i)), ts(int64(i)), zeroAlloc))
+		}
+		require.NoError(t, sink.Flush(ctx))
+		segments, frames := readSegments(dir)
+		require.Equal(t, 4, segments)
+		require.Equal(t, []string{
+			`schema foo@1`, `row foo [1]->{"a":1} @1.0000000000`,
+			`schema foo@1`, `row foo [1]->{"a":1} @2.0000000000`,
+			`schema foo@1`, `row foo [1]->{"a":1} @3.0000000000`,
+		}, frames)
+
+		// The oldest segments are deleted once they exceed the retention,
+		// while those of other jobs are kept.
+		fs := sink.(*fileSink)
+		fs.maxBufferSize = 0
+		fs.retention = time.Hour
+		names, err := cdclib.ListSegments(dir)
+		require.NoError(t, err)
+		other := cdclib.SegmentName(time.Now(), 8, `split`, 1)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, other), nil, 0644))
+		old := time.Now().Add(-2 * time.Hour)
+		for _, name := range []string{names[0], other} {
+			require.NoError(t, os.Chtimes(filepath.Join(dir, name), old, old))
+		}
+		require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[1]`), []byte(`{"a":1}`), ts(4), ts(4), zeroAlloc))
+		require.NoError(t, sink.Close())
+		require.NoError(t, os.Remove(filepath.Join(dir, other)))
+		segments, frames = readSegments(dir)
+		require.Equal(t, 4, segments)
+		require.Equal(t, `row foo [1]->{"a":1} @2.0000000000`, frames[1])
+	})
+
+	t.Run("bounded by default", func(t *testing.T) {
+		sink, err := makeSink(`file:///bounded`)
+		require.NoError(t, err)
+		fs := sink.(*fileSink)
+		require.Equal(t, defaultFileSinkRetention, fs.retention)
+		require.EqualValues(t, defaultFileSinkMaxBufferSize, fs.maxBufferSize)
+
+		// Setting them to 0 disables them.
+		sink, err = makeSink(`file:///bounded?retention=0s&max_buffer_size=0`)
+		require.NoError(t, err)
+		fs = sink.(*fileSink)
+		require.Zero(t, fs.retention)
+		require.Zero(t, fs.maxBufferSize)
+
+		jobID, ok := cdclib.SegmentJobID(cdclib.SegmentName(time.Now(), 7, `split`, 1))
+		require.True(t, ok)
+		require.EqualValues(t, 7, jobID)
+	})
+
+	t.Run("truncated segment", func(t *testing.T) {
+		sink, err := makeSink(`file:///truncated`)
+		require.NoError(t, err)
+		require.NoError(t, sink.Dial())
+		dir := filepath.Join(externalIODir, `truncated`)
+		require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[1]`), []byte(`{"a":1}`), ts(1), ts(1), zeroAlloc))
+		require.NoError(t, sink.Close())
+
+		// A segment which was being written when its node crashed is read up
+		// to its last complete frame.
+		names, err := cdclib.ListSegments(dir)
+		require.NoError(t, err)
+		f, err := os.OpenFile(filepath.Join(dir, names[0]), os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = f.Write([]byte{byte(cdclib.FrameRow), 0, 0, 1, 0, '{'})
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		_, frames := readSegments(dir)
+		require.Equal(t, []string{`schema foo@1`, `row foo [1]->{"a":1} @1.0000000000`}, frames)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			uri string
+			err string
+		}{
+			{uri: `file://host/feed`, err: `must be of the form file:///path`},
+			{uri: `file:///feed?segment_size=big`, err: `invalid segment_size`},
+			{uri: `file:///feed?retention=-1h`, err: `invalid retention`},
+			{uri: `file:///feed?max_buffer_size=1KiB`, err: `max_buffer_size must be at least segment_size`},
+			{uri: `file:///feed?segment_size=20GiB`, err: `max_buffer_size must be at least segment_size`},
+			{uri: `file:///feed?foo=bar`, err: `unknown file sink query parameters: foo`},
+		} {
+			_, err := makeSink(tc.uri)
+			require.Regexp(t, tc.err, err, tc.uri)
+		}
+
+		u, err := url.Parse(`file:///feed`)
+		require.NoError(t, err)
+		_, err = makeFileSink(sinkURL{URL: u}, ``, 7, makeChangefeedTargets(`foo`), encodingOpts,
+			nilMetricsRecorderBuilder)
+		require.Regexp(t, `requires the external IO directory`, err)
+	})
+}
@@ -12,9 +12,13 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"math"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -23,6 +27,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
@@ -31,8 +36,10 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/logtags"
+	"github.com/rcrowley/go-metrics"
 )
 
 // maybeLocker is a wrapper around a Locker that allows for successive Unlocks
@@ -60,6 +67,7 @@ type kafkaSinkKnobs struct {
 	OverrideClientInit              func(config *sarama.Config) (kafkaClient, error)
 	OverrideAsyncProducerFromClient func(kafkaClient) (sarama.AsyncProducer, error)
 	OverrideSyncProducerFromClient  func(kafkaClient) (sarama.SyncProducer, error)
+	OverrideClusterAdminFromClient  func(kafkaClient) (sarama.ClusterAdmin, error)
 }
 
 var _ sarama.StdLogger = (*kafkaLogAdapter)(nil)
@@ -96,6 +104,9 @@ type kafkaClient interface {
 	// available metadata for those topics. If no topics are provided, it will refresh
 	// metadata for all topics.
 	RefreshMetadata(topics ...string) error
+	// Leader returns the broker object that is the leader of the current
+	// topic/partition, as determined by querying the cluster metadata.
+	Leader(topic string, partitionID int32) (*sarama.Broker, error)
 	// Config returns the sarama config used on the client
 	Config() *sarama.Config
 	// Close closes kafka connection.
@@ -112,13 +123,70 @@ type kafkaSink struct {
 	producer       sarama.AsyncProducer
 	topics         *TopicNamer
 
+	// topicDetail, if set, is used to create the topics this sink emits to
+	// which do not exist yet. createdTopics are the topics which are known
+	// to exist.
+	topicDetail   *sarama.TopicDetail
+	admin         sarama.ClusterAdmin
+	createdTopics map[string]struct{}
+	// newTopics are the topics this sink created, rather than found to
+	// exist, which have yet to be returned by DrainCreatedTopics.
+	newTopics struct {
+		syncutil.Mutex
+		topics []string
+	}
+
+	// topicCompression maps topics to the codec compressing their messages,
+	// if it differs from the one of kafkaCfg.
+	topicCompression map[string]compressionCodec
+
+	// resolvedPartition, if not negative, is the only partition of each topic
+	// to which resolved timestamps are emitted. resolvedTopic, if set, is the
+	// control topic to which they are emitted instead of the topics of rows.
+	resolvedPartition int32
+	resolvedTopic     string
+
+	// preflightCheck is set if the sink checks that it can write to all of
+	// its topics when dialed.
+	preflightCheck bool
+
+	// transactional is set if the producer of the sink is transactional, in
+	// which case the messages emitted between flushes are produced in a
+	// transaction which is committed when the sink is flushed.
+	transactional bool
+
 	lastMetadataRefresh time.Time
 
+	// cloudEventsBinary is set if the events of the cloudevents envelope are
+	// sent in binary mode, with their attributes in the record headers.
+	cloudEventsBinary bool
+
+	// traceContext is set if the records of rows carry the traceparent of the
+	// span which emitted them in a header.
+	traceContext bool
+
+	// credentials, if set, reloads the SASL credentials of the sink from the
+	// external connection holding its URI, which the clients it creates use.
+	credentials *credentialsReloader
+
+	// clientPool, if set, is the pool through which the sink shares its
+	// client with the other sinks with the same clientKey. releaseClient
+	// releases the client the sink acquired from it.
+	clientPool    *sinkClientPool
+	sv            *settings.Values
+	clientKey     string
+	releaseClient func() error
+
 	stopWorkerCh chan struct{}
 	worker       sync.WaitGroup
 	scratch      bufalloc.ByteAllocator
 	metrics      metricsRecorder
 
+	// brokerHosts caches the address of the broker leading each partition for
+	// which messages were acknowledged. It is only accessed by the worker
+	// goroutine.
+	brokerHosts map[kafkaTopicPartition]string
+
 	knobs kafkaSinkKnobs
 
 	stats kafkaStats
@@ -129,6 +197,7 @@ type kafkaSink struct {
 		inflight int64
 		flushErr error
 		flushCh  chan struct{}
+		throttle kafkaThrottle
 	}
 
 	disableInternalRetry bool
@@ -183,9 +252,51 @@ type saramaConfig struct {
 
 	Compression compressionCodec `json:",omitempty"`
 
+	// TopicCompression overrides Compression for the topics it maps to a
+	// codec.
+	TopicCompression map[string]compressionCodec `json:",omitempty"`
+
 	RequiredAcks string `json:",omitempty"`
 
+	// Idempotent enables the idempotent producer, with which the broker
+	// discards the duplicates of messages the producer retries, and which
+	// keeps retries from reordering the messages of a partition. It requires
+	// RequiredAcks to be ALL, which it defaults to.
+	Idempotent bool `json:",omitempty"`
+
+	// Transactional enables the transactional producer, which implies
+	// Idempotent. The messages emitted by the sink between flushes are
+	// committed in a single transaction, so that consumers reading committed
+	// messages never see those of the transactions aborted when the
+	// changefeed restarts before flushing them.
+	Transactional bool `json:",omitempty"`
+
 	Version string `json:",omitempty"`
+
+	// Partitioner chooses the partition of keyed messages which aren't pinned
+	// by Partitions. By default, keys are hashed with FNV-1a; murmur2 and
+	// crc32 hash keys like the Java client and librdkafka's consistent
+	// partitioner do, and manual requires every keyed message to be pinned.
+	Partitioner string `json:",omitempty"`
+
+	// Partitions pins the messages of topics, or of keys of topics, to
+	// partitions.
+	Partitions []kafkaPartitionMapping `json:",omitempty"`
+}
+
+const (
+	kafkaPartitionerMurmur2 = `murmur2`
+	kafkaPartitionerCRC32   = `crc32`
+	kafkaPartitionerManual  = `manual`
+)
+
+// kafkaPartitionMapping pins the messages of a topic to a partition. If Key
+// is set, only messages with that key, as encoded by the changefeed (e.g.
+// [1] for the JSON encoding of a key), are pinned.
+type kafkaPartitionMapping struct {
+	Topic     string
+	Key       string `json:",omitempty"`
+	Partition int32
 }
 
 func (c saramaConfig) Validate() error {
@@ -197,6 +308,44 @@ func (c saramaConfig) Validate() error {
 	if (c.Flush.Bytes > 0 || c.Flush.Messages > 1) && c.Flush.Frequency == 0 {
 		return errors.New("Flush.Frequency must be > 0 when Flush.Bytes > 0 or Flush.Messages > 1")
 	}
+	switch c.Partitioner {
+	case ``, kafkaPartitionerMurmur2, kafkaPartitionerCRC32:
+	case kafkaPartitionerManual:
+		if len(c.Partitions) == 0 {
+			return errors.Newf("Partitioner %s requires Partitions", kafkaPartitionerManual)
+		}
+	default:
+		return errors.Newf(`unknown Partitioner %q, must be one of %q, %q, or %q`, c.Partitioner,
+			kafkaPartitionerMurmur2, kafkaPartitionerCRC32, kafkaPartitionerManual)
+	}
+	if (c.Idempotent || c.Transactional) && c.RequiredAcks != `` {
+		if acks, err := parseRequiredAcks(c.RequiredAcks); err == nil && acks != sarama.WaitForAll {
+			return errors.Newf(`Idempotent requires RequiredAcks to be ALL, got %s`, c.RequiredAcks)
+		}
+	}
+	if c.Transactional && len(c.TopicCompression) > 0 {
+		// The topics of other codecs are emitted by producers of their own,
+		// whose messages would not be in the transactions of the sink.
+		return errors.New("Transactional cannot be used with TopicCompression")
+	}
+	for topic := range c.TopicCompression {
+		if topic == `` {
+			return errors.New("TopicCompression must not map an empty topic")
+		}
+	}
+	pinned := make(map[[2]string]struct{}, len(c.Partitions))
+	for _, m := range c.Partitions {
+		if m.Topic == `` {
+			return errors.New("Partitions must specify a Topic")
+		}
+		if m.Partition < 0 {
+			return errors.Newf("Partitions must specify a non-negative Partition, got %d", m.Partition)
+		}
+		if _, ok := pinned[[2]string{m.Topic, m.Key}]; ok {
+			return errors.Newf("Partitions pins topic %q key %q more than once", m.Topic, m.Key)
+		}
+		pinned[[2]string{m.Topic, m.Key}] = struct{}{}
+	}
 	return nil
 }
 
@@ -239,16 +388,59 @@ func defaultSaramaConfig() *saramaConfig {
 }
 
 // Dial implements the Sink interface.
-func (s *kafkaSink) Dial() error {
-	client, err := s.newClient(s.kafkaCfg)
+func (s *kafkaSink) Dial() (retErr error) {
+	client, err := s.dialClient()
 	if err != nil {
-		return err
+		return markKafkaErrorClass(err)
+	}
+	defer func() {
+		// s.client is only nil in tests.
+		if retErr != nil && client != nil {
+			_ = s.closeClient(client)
+		}
+	}()
+
+	// The admin shares the connections of the client, which closes them. Test
+	// clients only have one if the test provides it.
+	if _, ok := client.(sarama.Client); ok || s.knobs.OverrideClusterAdminFromClient != nil {
+		admin, err := s.newClusterAdmin(client)
+		if err != nil {
+			return err
+		}
+		s.admin = admin
+		if err := s.limitMessageBytes(); err != nil {
+			return err
+		}
+	}
+	if s.topicDetail != nil {
+		s.createdTopics = make(map[string]struct{})
+	}
+	if s.preflightCheck {
+		if s.admin == nil {
+			return errors.AssertionFailedf(`kafka sink has no cluster admin`)
+		}
+		if err := s.preflightCheckTopics(); err != nil {
+			return err
+		}
 	}
 
-	producer, err := s.newAsyncProducer(client)
+	// The producer of a sink sharing its client with other sinks is built
+	// from the configuration of the sink rather than from that of the sink
+	// which dialed the client, so that it follows the producer settings and
+	// message size limit of the sink.
+	producerClient := client
+	if c, ok := client.(sarama.Client); ok && s.releaseClient != nil {
+		producerClient = &producerConfigClient{Client: c, config: s.kafkaCfg}
+	}
+	producer, err := s.newAsyncProducer(producerClient)
 	if err != nil {
 		return err
 	}
+	if len(s.topicCompression) > 0 {
+		if producer, err = s.newTopicCompressionProducer(producer); err != nil {
+			return err
+		}
+	}
 
 	s.client = client
 	s.producer = producer
@@ -260,7 +452,167 @@ func (s *kafkaSink) Dial() error {
 	return nil
 }
 
+// newTopicCompressionProducer returns a producer which produces the messages
+// of the topics of s.topicCompression with producers of their codec, and the
+// other messages with defaultProducer.
+func (s *kafkaSink) newTopicCompressionProducer(
+	defaultProducer sarama.AsyncProducer,
+) (_ sarama.AsyncProducer, retErr error) {
+	topicCodecs := make(map[string]sarama.CompressionCodec, len(s.topicCompression))
+	byCodec := make(map[sarama.CompressionCodec]sarama.AsyncProducer)
+	var clients []kafkaClient
+	defer func() {
+		if retErr != nil {
+			_ = defaultProducer.Close()
+			for _, producer := range byCodec {
+				_ = producer.Close()
+			}
+			for _, client := range clients {
+				if client != nil {
+					_ = client.Close()
+				}
+			}
+		}
+	}()
+
+	for topic, topicCodec := range s.topicCompression {
+		codec := sarama.CompressionCodec(topicCodec)
+		if codec == s.kafkaCfg.Producer.Compression {
+			continue
+		}
+		topicCodecs[topic] = codec
+		if _, ok := byCodec[codec]; ok {
+			continue
+		}
+		config := *s.kafkaCfg
+		config.Producer.Compression = codec
+		client, err := s.newClient(&config)
+		if err != nil {
+			return nil, markKafkaErrorClass(err)
+		}
+		clients = append(clients, client)
+		producer, err := s.newAsyncProducer(client)
+		if err != nil {
+			return nil, err
+		}
+		byCodec[codec] = producer
+	}
+	return newTopicCompressionProducer(defaultProducer, topicCodecs, byCodec, clients), nil
+}
+
+// limitMessageBytes lowers the size of the batches produced by the sink to the
+// max.message.bytes of its topics, if they accept smaller batches than the
+// sink would produce, so that batches are split before the brokers reject them
+// with MESSAGE_TOO_LARGE. It returns an error if the batching configuration of
+// the sink exceeds that size.
+func (s *kafkaSink) limitMessageBytes() error {
+	maxBytes, err := s.fetchMaxMessageBytes()
+	if err != nil {
+		// The sink may not be authorized to describe configs, in which case it
+		// falls back on the brokers rejecting batches which are too large.
+		log.Warningf(s.ctx, "could not determine the max.message.bytes of kafka topics: %v", err)
+		return nil
+	}
+	if flushBytes := s.kafkaCfg.Producer.Flush.Bytes; flushBytes > maxBytes {
+		return errors.Errorf(`%s sets Flush.Bytes to %d, but the kafka topics accept batches `+
+			`of at most %d bytes as configured by max.message.bytes`,
+			changefeedbase.OptKafkaSinkConfig, flushBytes, maxBytes)
+	}
+	if maxBytes < s.kafkaCfg.Producer.MaxMessageBytes {
+		s.kafkaCfg.Producer.MaxMessageBytes = maxBytes
+	}
+	return nil
+}
+
+const (
+	kafkaTopicMaxMessageBytes  = `max.message.bytes`
+	kafkaBrokerMessageMaxBytes = `message.max.bytes`
+)
+
+// fetchMaxMessageBytes returns the smallest max.message.bytes of the topics of
+// the sink. Topics which cannot be described, e.g. because they are yet to be
+// created, use the message.max.bytes of the brokers instead.
+func (s *kafkaSink) fetchMaxMessageBytes() (int, error) {
+	var maxBytes, brokerMaxBytes int
+	for _, topic := range s.topics.DisplayNamesSlice() {
+		topicMaxBytes, err := s.describeIntConfig(sarama.ConfigResource{
+			Type:        sarama.TopicResource,
+			Name:        topic,
+			ConfigNames: []string{kafkaTopicMaxMessageBytes},
+		})
+		if err != nil {
+			if brokerMaxBytes == 0 {
+				_, controllerID, err := s.admin.DescribeCluster()
+				if err != nil {
+					return 0, err
+				}
+				brokerMaxBytes, err = s.describeIntConfig(sarama.ConfigResource{
+					Type:        sarama.BrokerResource,
+					Name:        strconv.Itoa(int(controllerID)),
+					ConfigNames: []string{kafkaBrokerMessageMaxBytes},
+				})
+				if err != nil {
+					return 0, err
+				}
+			}
+			topicMaxBytes = brokerMaxBytes
+		}
+		if maxBytes == 0 || topicMaxBytes < maxBytes {
+			maxBytes = topicMaxBytes
+		}
+	}
+	if maxBytes == 0 {
+		return 0, errors.New(`no topics to describe`)
+	}
+	return maxBytes, nil
+}
+
+// describeIntConfig returns the value of the only, integer, config of resource.
+func (s *kafkaSink) describeIntConfig(resource sarama.ConfigResource) (int, error) {
+	entries, err := s.admin.DescribeConfig(resource)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.Name != resource.ConfigNames[0] {
+			continue
+		}
+		v, err := strconv.Atoi(entry.Value)
+		if err != nil || v <= 0 {
+			return 0, errors.Errorf(`invalid %s of %s: %q`, entry.Name, resource.Name, entry.Value)
+		}
+		return v, nil
+	}
+	return 0, errors.Errorf(`%s of %s not found`, resource.ConfigNames[0], resource.Name)
+}
+
+// setCredentialsReloader implements the credentialsReloadingSink interface.
+func (s *kafkaSink) setCredentialsReloader(r *credentialsReloader) {
+	s.credentials = r
+}
+
+// withReloadedCredentials returns the given config with the current SASL
+// credentials of the sink. Clients authenticate every connection to a broker
+// with the credentials of their config, so rotated credentials are picked up
+// by the clients the sink creates once they're reloaded, e.g. to retry
+// messages internally.
+func (s *kafkaSink) withReloadedCredentials(config *sarama.Config) *sarama.Config {
+	if s.credentials == nil || !config.Net.SASL.Enable {
+		return config
+	}
+	creds := s.credentials.credentials(s.ctx)
+	if creds.saslUser == `` || creds.saslPassword == `` {
+		return config
+	}
+	reloaded := *config
+	reloaded.Net.SASL.User = creds.saslUser
+	reloaded.Net.SASL.Password = creds.saslPassword
+	return &reloaded
+}
+
 func (s *kafkaSink) newClient(config *sarama.Config) (kafkaClient, error) {
+	config = s.withReloadedCredentials(config)
+
 	// Initialize client and producer
 	if s.knobs.OverrideClientInit != nil {
 		client, err := s.knobs.OverrideClientInit(config)
@@ -275,6 +627,94 @@ func (s *kafkaSink) newClient(config *sarama.Config) (kafkaClient, error) {
 	return client, err
 }
 
+// setClientPool implements the pooledClientSink interface.
+func (s *kafkaSink) setClientPool(p *sinkClientPool, sv *settings.Values) {
+	s.clientPool, s.sv = p, sv
+}
+
+// pooledKafkaClient is a kafka client shared by sinks through a
+// sinkClientPool. The brokers throttle the produce requests of all the sinks
+// sharing the client alike, so it passes the throttle times of the brokers on
+// to all of them.
+type pooledKafkaClient struct {
+	kafkaClient
+
+	mu struct {
+		syncutil.Mutex
+		onThrottle map[*kafkaSink]func(time.Duration)
+	}
+}
+
+// producerConfigClient overrides the configuration of a client with that of
+// the sink which builds a producer from it.
+type producerConfigClient struct {
+	sarama.Client
+	config *sarama.Config
+}
+
+// Config implements the sarama.Client interface.
+func (c *producerConfigClient) Config() *sarama.Config {
+	return c.config
+}
+
+func (c *pooledKafkaClient) recordThrottle(throttleTime time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, onThrottle := range c.mu.onThrottle {
+		onThrottle(throttleTime)
+	}
+}
+
+// dialClient returns a new client for the sink, or the client it shares with
+// the other sinks of its client pool. Sinks which reload their credentials
+// don't share their clients, whose credentials may differ.
+func (s *kafkaSink) dialClient() (kafkaClient, error) {
+	if s.clientPool == nil || s.credentials != nil {
+		return s.newClient(s.kafkaCfg)
+	}
+	c, release, err := s.clientPool.acquire(s.ctx, s.sv, s.clientKey, func() (io.Closer, error) {
+		pooled := &pooledKafkaClient{}
+		pooled.mu.onThrottle = make(map[*kafkaSink]func(time.Duration))
+		// The throttle times of the brokers are passed on to the sinks which
+		// share the client rather than to this sink only.
+		config := *s.kafkaCfg
+		if r, ok := config.MetricRegistry.(*kafkaThrottleRegistry); ok {
+			config.MetricRegistry = newKafkaThrottleRegistry(r.Registry, pooled.recordThrottle)
+		}
+		client, err := s.newClient(&config)
+		if err != nil {
+			return nil, err
+		}
+		pooled.kafkaClient = client
+		return pooled, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	pooled := c.(*pooledKafkaClient)
+	pooled.mu.Lock()
+	pooled.mu.onThrottle[s] = s.recordThrottle
+	pooled.mu.Unlock()
+	s.releaseClient = func() error {
+		pooled.mu.Lock()
+		delete(pooled.mu.onThrottle, s)
+		pooled.mu.Unlock()
+		return release()
+	}
+	return pooled.kafkaClient, nil
+}
+
+// closeClient closes the client of the sink, or releases it if it's shared
+// with the other sinks of its client pool.
+func (s *kafkaSink) closeClient(client kafkaClient) error {
+	if s.releaseClient != nil {
+		release := s.releaseClient
+		s.releaseClient = nil
+		return release()
+	}
+	return client.Close()
+}
+
 func (s *kafkaSink) newAsyncProducer(client kafkaClient) (sarama.AsyncProducer, error) {
 	var producer sarama.AsyncProducer
 	var err error
@@ -305,8 +745,61 @@ func (s *kafkaSink) newSyncProducer(client kafkaClient) (sarama.SyncProducer, er
 	return producer, nil
 }
 
+func (s *kafkaSink) newClusterAdmin(client kafkaClient) (sarama.ClusterAdmin, error) {
+	var admin sarama.ClusterAdmin
+	var err error
+	if s.knobs.OverrideClusterAdminFromClient != nil {
+		admin, err = s.knobs.OverrideClusterAdminFromClient(client)
+	} else {
+		admin, err = sarama.NewClusterAdminFromClient(client.(sarama.Client))
+	}
+	if err != nil {
+		return nil, pgerror.Wrapf(err, pgcode.CannotConnectNow,
+			`connecting to kafka: %s`, s.bootstrapAddrs)
+	}
+	return admin, nil
+}
+
+// maybeCreateTopic creates the topic if topic auto-creation is enabled and the
+// topic is not yet known to exist. A topic which already exists is left as is,
+// even if its settings differ from the configured ones.
+func (s *kafkaSink) maybeCreateTopic(topic string) error {
+	if s.topicDetail == nil {
+		return nil
+	}
+	if _, ok := s.createdTopics[topic]; ok {
+		return nil
+	}
+	err := s.admin.CreateTopic(topic, s.topicDetail, false /* validateOnly */)
+	if err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return errors.Wrapf(err, `creating kafka topic %s`, topic)
+	}
+	if err == nil {
+		s.newTopics.Lock()
+		s.newTopics.topics = append(s.newTopics.topics, topic)
+		s.newTopics.Unlock()
+		// Let the producer learn about the new topic's partitions right away.
+		if s.client != nil {
+			if err := s.client.RefreshMetadata(topic); err != nil {
+				return err
+			}
+		}
+	}
+	s.createdTopics[topic] = struct{}{}
+	return nil
+}
+
 // Close implements the Sink interface.
 func (s *kafkaSink) Close() error {
+	if s.inTxn() {
+		// Abort the open transaction rather than let it time out, since
+		// consumers reading committed messages can't read past it until it
+		// ends. The worker must still be running to acknowledge the messages
+		// inflight, which the transaction waits for.
+		if err := s.producer.AbortTxn(); err != nil {
+			log.Warningf(s.ctx, "aborting kafka transaction: %v", err)
+		}
+	}
 	if s.stopWorkerCh != nil {
 		close(s.stopWorkerCh)
 		s.worker.Wait()
@@ -318,8 +811,8 @@ func (s *kafkaSink) Close() error {
 		_ = s.producer.Close()
 	}
 	// s.client is only nil in tests.
-	if s.client != nil {
-		return s.client.Close()
+	if s.client != nil || s.releaseClient != nil {
+		return s.closeClient(s.client)
 	}
 	return nil
 }
@@ -328,6 +821,7 @@ type messageMetadata struct {
 	alloc         kvevent.Alloc
 	updateMetrics recordOneMessageCallback
 	mvcc          hlc.Timestamp
+	emitTime      time.Time
 }
 
 // EmitRow implements the Sink interface.
@@ -342,12 +836,30 @@ func (s *kafkaSink) EmitRow(
 	if err != nil {
 		return err
 	}
+	if err := s.maybeCreateTopic(topic); err != nil {
+		return err
+	}
 
 	msg := &sarama.ProducerMessage{
-		Topic:    topic,
-		Key:      sarama.ByteEncoder(key),
-		Value:    sarama.ByteEncoder(value),
-		Metadata: messageMetadata{alloc: alloc, mvcc: mvcc, updateMetrics: s.metrics.recordOneMessage()},
+		Topic: topic,
+		Key:   sarama.ByteEncoder(key),
+		Value: sarama.ByteEncoder(value),
+		Metadata: messageMetadata{
+			alloc:         alloc,
+			mvcc:          mvcc,
+			updateMetrics: s.metrics.recordOneMessage(),
+			emitTime:      timeutil.Now(),
+		},
+	}
+	if err := s.maybeSetCloudEventHeaders(msg, value, binaryCloudEventFromContext(ctx)); err != nil {
+		return err
+	}
+	if s.traceContext {
+		if tp := traceParent(ctx); tp != `` {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{
+				Key: []byte(traceParentHeader), Value: []byte(tp),
+			})
+		}
 	}
 	s.stats.startMessage(int64(msg.Key.Length() + msg.Value.Length()))
 	return s.emitMessage(ctx, msg)
@@ -356,6 +868,62 @@ func (s *kafkaSink) EmitRow(
 // EmitResolvedTimestamp implements the Sink interface.
 func (s *kafkaSink) EmitResolvedTimestamp(
 	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	return s.emitResolvedTimestamp(ctx, encoder, resolved, s.topics.Each)
+}
+
+// DrainCreatedTopics implements TopicCreatingSink.
+func (s *kafkaSink) DrainCreatedTopics() []string {
+	s.newTopics.Lock()
+	defer s.newTopics.Unlock()
+	topics := s.newTopics.topics
+	s.newTopics.topics = nil
+	return topics
+}
+
+// BufferedBytes implements the BufferingSink interface. Messages are buffered
+// from when they are handed to the producer until the brokers acknowledge
+// them.
+func (s *kafkaSink) BufferedBytes() int64 {
+	return atomic.LoadInt64(&s.stats.outstandingBytes)
+}
+
+// DeleteTopics implements TopicDeletingSink.
+func (s *kafkaSink) DeleteTopics(ctx context.Context, topics []string) error {
+	if s.admin == nil {
+		return errors.AssertionFailedf(`kafka sink has no cluster admin`)
+	}
+	for _, topic := range topics {
+		if err := s.admin.DeleteTopic(topic); err != nil {
+			if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+				continue
+			}
+			return errors.Wrapf(err, `deleting kafka topic %s`, topic)
+		}
+		log.Infof(ctx, `deleted kafka topic %s`, topic)
+	}
+	return nil
+}
+
+// EmitResolvedTimestampForTargets implements TargetResolvedTimestampSink.
+func (s *kafkaSink) EmitResolvedTimestampForTargets(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	include func(changefeedbase.Target) bool,
+) error {
+	return s.emitResolvedTimestamp(ctx, encoder, resolved, func(fn func(string) error) error {
+		return s.topics.EachForTargets(include, fn)
+	})
+}
+
+// emitResolvedTimestamp emits the resolved timestamp to every partition of
+// the topics iterated over by eachTopic.
+func (s *kafkaSink) emitResolvedTimestamp(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	eachTopic func(func(string) error) error,
 ) error {
 	defer s.metrics.recordResolvedCallback()()
 
@@ -368,19 +936,43 @@ func (s *kafkaSink) EmitResolvedTimestamp(
 	// actively working on stability. At the same time, revisit this tuning.
 	const metadataRefreshMinDuration = time.Minute
 	if timeutil.Since(s.lastMetadataRefresh) > metadataRefreshMinDuration {
-		if err := s.client.RefreshMetadata(s.topics.DisplayNamesSlice()...); err != nil {
+		topics := s.topics.DisplayNamesSlice()
+		if s.resolvedTopic != `` {
+			topics = append(topics, s.resolvedTopic)
+		}
+		if err := s.client.RefreshMetadata(topics...); err != nil {
 			return err
 		}
 		s.lastMetadataRefresh = timeutil.Now()
 	}
 
-	return s.topics.Each(func(topic string) error {
+	if err := eachTopic(func(topic string) error {
+		if err := s.maybeCreateTopic(topic); err != nil {
+			return err
+		}
 		payload, err := encoder.EncodeResolvedTimestamp(ctx, topic, resolved)
 		if err != nil {
 			return err
 		}
 		s.scratch, payload = s.scratch.Copy(payload, 0 /* extraCap */)
 
+		if s.resolvedTopic != `` {
+			// The resolved timestamps of each topic are keyed by the topic, so
+			// that a compacted control topic retains the latest one of each.
+			if err := s.maybeCreateTopic(s.resolvedTopic); err != nil {
+				return err
+			}
+			msg := &sarama.ProducerMessage{
+				Topic: s.resolvedTopic,
+				Key:   sarama.StringEncoder(topic),
+				Value: sarama.ByteEncoder(payload),
+			}
+			if err := s.maybeSetCloudEventHeaders(msg, payload, nil /* event */); err != nil {
+				return err
+			}
+			return s.emitMessage(ctx, msg)
+		}
+
 		// sarama caches this, which is why we have to periodically refresh the
 		// metadata above. Staleness here does not impact correctness. Some new
 		// partitions will miss this resolved timestamp, but they'll eventually
@@ -389,6 +981,17 @@ func (s *kafkaSink) EmitResolvedTimestamp(
 		if err != nil {
 			return err
 		}
+		if s.resolvedPartition >= 0 {
+			found := false
+			for _, partition := range partitions {
+				found = found || partition == s.resolvedPartition
+			}
+			if !found {
+				return errors.Errorf(`topic %s has no partition %d, to which %s emits resolved timestamps`,
+					topic, s.resolvedPartition, changefeedbase.SinkParamResolvedPartition)
+			}
+			partitions = []int32{s.resolvedPartition}
+		}
 		for _, partition := range partitions {
 			msg := &sarama.ProducerMessage{
 				Topic:     topic,
@@ -396,18 +999,39 @@ func (s *kafkaSink) EmitResolvedTimestamp(
 				Key:       nil,
 				Value:     sarama.ByteEncoder(payload),
 			}
+			if err := s.maybeSetCloudEventHeaders(msg, payload, nil /* event */); err != nil {
+				return err
+			}
 			if err := s.emitMessage(ctx, msg); err != nil {
 				return err
 			}
 		}
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	if s.transactional {
+		// The sink emitting resolved timestamps isn't flushed, so they are
+		// committed as they're emitted.
+		return s.Flush(ctx)
+	}
+	return nil
 }
 
-// Flush implements the Sink interface.
+// Flush implements the Sink interface. The transaction of a transactional
+// sink is committed once its messages are acknowledged.
 func (s *kafkaSink) Flush(ctx context.Context) error {
 	defer s.metrics.recordFlushRequestCallback()()
 
+	if err := s.waitInflight(ctx); err != nil {
+		return err
+	}
+	return s.maybeCommitTxn()
+}
+
+// waitInflight waits for the inflight messages to be acknowledged, returning
+// the first error producing any of them since it was last called.
+func (s *kafkaSink) waitInflight(ctx context.Context) error {
 	flushCh := make(chan struct{}, 1)
 
 	s.mu.Lock()
@@ -440,21 +1064,229 @@ func (s *kafkaSink) Flush(ctx context.Context) error {
 }
 
 func (s *kafkaSink) startInflightMessage(ctx context.Context) error {
+	for {
+		delay, ackCh, err := s.tryStartInflightMessage(ctx)
+		if err != nil || (delay == 0 && ackCh == nil) {
+			return err
+		}
+
+		// The brokers are throttling us, wait until we may emit again.
+		var timer timeutil.Timer
+		if delay > 0 {
+			timer.Reset(delay)
+		}
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+			timer.Read = true
+		case <-ackCh:
+		}
+		timer.Stop()
+	}
+}
+
+// tryStartInflightMessage starts an inflight message unless the sink is
+// throttled, in which case it returns how long to wait, or a channel to wait
+// on, before trying again.
+func (s *kafkaSink) tryStartInflightMessage(
+	ctx context.Context,
+) (time.Duration, <-chan struct{}, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.mu.flushErr != nil {
-		return s.mu.flushErr
+		return 0, nil, s.mu.flushErr
+	}
+
+	now := timeutil.Now()
+	if throttleTime := s.mu.throttle.apply(now, s.mu.inflight); throttleTime > 0 {
+		log.VInfof(ctx, 1, "kafka brokers throttled produce requests for %s, limiting to %d inflight messages",
+			throttleTime, s.mu.throttle.limit)
+	}
+	if delay, ackCh := s.mu.throttle.wait(now, s.mu.inflight); delay > 0 || ackCh != nil {
+		return delay, ackCh, nil
 	}
 
 	s.mu.inflight++
 	if log.V(2) {
 		log.Infof(ctx, "emitting %d inflight records to kafka", s.mu.inflight)
 	}
+	return 0, nil, nil
+}
+
+// recordThrottle records that a broker throttled a produce request for the
+// specified time due to a quota being exceeded. It is called by sarama on the
+// goroutines of the brokers.
+func (s *kafkaSink) recordThrottle(throttleTime time.Duration) {
+	s.metrics.recordKafkaThrottle(throttleTime)
+	s.mu.throttle.record(throttleTime)
+}
+
+// kafkaThrottle adapts the number of messages the kafka sink keeps inflight
+// to the throttling of produce requests by the brokers, which happens when a
+// client exceeds a quota of the kafka cluster. Rather than piling up requests
+// which will only be throttled further, and eventually time out, the sink
+// delays messages by the throttle time the brokers asked for, halves the limit
+// on inflight messages every time it is throttled, and raises the limit by one
+// for every message acknowledged until it is lifted.
+type kafkaThrottle struct {
+	// pendingNanos is the throttle time reported by the brokers since the
+	// throttling was last applied. It's accessed atomically, as brokers report
+	// throttling without holding the mutex of the sink. The other fields are
+	// protected by that mutex.
+	pendingNanos int64
+
+	// limit, if non-zero, is the maximum number of inflight messages.
+	limit int64
+	// unthrottledInflight is the number of inflight messages when the brokers
+	// began throttling. The limit is lifted once it grows back to it.
+	unthrottledInflight int64
+	// until is the time until which no messages should be emitted.
+	until time.Time
+	// ackCh, if set, is closed when a message is acknowledged.
+	ackCh chan struct{}
+}
+
+// record records throttling reported by a broker.
+func (t *kafkaThrottle) record(throttleTime time.Duration) {
+	atomic.AddInt64(&t.pendingNanos, throttleTime.Nanoseconds())
+}
+
+// apply applies the throttling recorded since it was last called, given the
+// number of inflight messages, and returns the recorded throttle time.
+func (t *kafkaThrottle) apply(now time.Time, inflight int64) time.Duration {
+	throttleTime := time.Duration(atomic.SwapInt64(&t.pendingNanos, 0))
+	if throttleTime == 0 {
+		return 0
+	}
+	if t.limit == 0 {
+		t.limit = inflight
+		t.unthrottledInflight = inflight
+	}
+	if t.limit /= 2; t.limit < 1 {
+		t.limit = 1
+	}
+	if until := now.Add(throttleTime); until.After(t.until) {
+		t.until = until
+	}
+	return throttleTime
+}
+
+// wait returns, given the number of inflight messages, how long to wait before
+// emitting another message or, if the limit of inflight messages is reached, a
+// channel which is closed when a message is acknowledged.
+func (t *kafkaThrottle) wait(now time.Time, inflight int64) (time.Duration, <-chan struct{}) {
+	if now.Before(t.until) {
+		return t.until.Sub(now), nil
+	}
+	if t.limit > 0 && inflight >= t.limit {
+		if t.ackCh == nil {
+			t.ackCh = make(chan struct{})
+		}
+		return 0, t.ackCh
+	}
+	return 0, nil
+}
+
+// acknowledged is called when an inflight message is acknowledged, with
+// whether it was successfully emitted.
+func (t *kafkaThrottle) acknowledged(success bool) {
+	if t.ackCh != nil {
+		close(t.ackCh)
+		t.ackCh = nil
+	}
+	if t.limit > 0 && success {
+		if t.limit++; t.limit >= t.unthrottledInflight {
+			t.limit = 0
+		}
+	}
+}
+
+// kafkaThrottleTimeMetricPrefix is the prefix of the names of the histograms
+// of the time for which brokers throttled produce requests which sarama keeps
+// in the metric registry of its config, one per broker.
+const kafkaThrottleTimeMetricPrefix = `throttle-time-in-ms`
+
+// kafkaThrottleRegistry is a sarama metric registry which intercepts the
+// histograms of the throttle time reported by the brokers, to let the sink
+// react to throttling.
+type kafkaThrottleRegistry struct {
+	metrics.Registry
+	throttleTime metrics.Histogram
+}
+
+func newKafkaThrottleRegistry(
+	registry metrics.Registry, onThrottle func(time.Duration),
+) *kafkaThrottleRegistry {
+	if registry == nil {
+		registry = metrics.NewRegistry()
+	}
+	return &kafkaThrottleRegistry{
+		Registry:     registry,
+		throttleTime: kafkaThrottleHistogram{Histogram: metrics.NilHistogram{}, onThrottle: onThrottle},
+	}
+}
+
+// GetOrRegister implements the metrics.Registry interface.
+func (r *kafkaThrottleRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	if strings.HasPrefix(name, kafkaThrottleTimeMetricPrefix) {
+		return r.throttleTime
+	}
+	return r.Registry.GetOrRegister(name, i)
+}
+
+// kafkaThrottleHistogram is a metrics.Histogram which passes the throttle
+// times in milliseconds it's updated with to onThrottle.
+type kafkaThrottleHistogram struct {
+	metrics.Histogram
+	onThrottle func(time.Duration)
+}
+
+// Update implements the metrics.Histogram interface.
+func (h kafkaThrottleHistogram) Update(throttleTimeMs int64) {
+	if throttleTimeMs > 0 {
+		h.onThrottle(time.Duration(throttleTimeMs) * time.Millisecond)
+	}
+}
+
+// maybeSetCloudEventHeaders sends the value of a message, an event encoded in
+// structured mode, in binary mode if the sink sends events in binary mode. The
+// event in binary mode is the given one, if any, and is otherwise converted
+// from the value. The attributes of the event are added to the headers of the
+// message prefixed by ce_, and its content type as the content-type header.
+func (s *kafkaSink) maybeSetCloudEventHeaders(
+	msg *sarama.ProducerMessage, value []byte, event *binaryCloudEvent,
+) error {
+	if !s.cloudEventsBinary {
+		return nil
+	}
+	if event == nil {
+		converted, err := makeBinaryCloudEvent(value)
+		if err != nil {
+			return err
+		}
+		event = &converted
+	}
+	for _, a := range event.attributes {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{
+			Key: []byte(`ce_` + a.name), Value: []byte(a.value),
+		})
+	}
+	msg.Headers = append(msg.Headers, sarama.RecordHeader{
+		Key: []byte(`content-type`), Value: []byte(event.contentType),
+	})
+	msg.Value = sarama.ByteEncoder(event.data)
 	return nil
 }
 
 func (s *kafkaSink) emitMessage(ctx context.Context, msg *sarama.ProducerMessage) error {
+	if s.transactional && !s.inTxn() {
+		if err := s.producer.BeginTxn(); err != nil {
+			return errors.Wrap(err, `beginning kafka transaction`)
+		}
+	}
 	if err := s.startInflightMessage(ctx); err != nil {
 		return err
 	}
@@ -468,6 +1300,31 @@ func (s *kafkaSink) emitMessage(ctx context.Context, msg *sarama.ProducerMessage
 	return nil
 }
 
+// inTxn returns whether the producer of a transactional sink is in a
+// transaction, into which the messages emitted until the next flush are
+// produced.
+func (s *kafkaSink) inTxn() bool {
+	return s.transactional && s.producer != nil &&
+		s.producer.TxnStatus()&sarama.ProducerTxnFlagInTransaction != 0
+}
+
+// maybeCommitTxn commits the transaction of a transactional sink, if it's in
+// one. The transaction is aborted if it fails to commit with an abortable
+// error, in which case the changefeed emits its messages again once it
+// restarts.
+func (s *kafkaSink) maybeCommitTxn() error {
+	if !s.inTxn() {
+		return nil
+	}
+	if err := s.producer.CommitTxn(); err != nil {
+		if s.producer.TxnStatus()&sarama.ProducerTxnFlagAbortableError != 0 {
+			err = errors.CombineErrors(err, s.producer.AbortTxn())
+		}
+		return errors.Wrap(err, `committing kafka transaction`)
+	}
+	return nil
+}
+
 // isInternallyRetryable returns true if the sink should attempt to re-emit the
 // messages with a non-batching config first rather than surfacing the error to
 // the overarching feed.
@@ -542,11 +1399,18 @@ func (s *kafkaSink) workerLoop() {
 			}
 		}
 
+		// Resolve the broker which acknowledged the message before taking the
+		// lock, as doing so may require a metadata request. An error may mean
+		// that the leadership of the partition moved, so its leader is looked
+		// up again.
+		host := s.resolveBrokerHost(ackMsg, ackError != nil /* refresh */)
+
 		// If we're in a retry we already had the lock.
 		if !isRetrying() {
 			muLocker.Lock()
 		}
 		s.mu.inflight--
+		s.mu.throttle.acknowledged(ackError == nil)
 
 		if !isRetrying() && s.mu.flushErr == nil && s.isInternalRetryable(ackError) {
 			startInternalRetry(ackError)
@@ -557,14 +1421,14 @@ func (s *kafkaSink) workerLoop() {
 		if isRetrying() && isValidMessage {
 			retryBuf = append(retryBuf, ackMsg)
 		} else {
-			s.finishProducerMessage(ackMsg, ackError)
+			s.finishProducerMessage(ackMsg, host, ackError)
 		}
 
 		// Once inflight messages to retry are done buffering, find a new client
 		// that successfully resends and continue on with it.
 		if isRetrying() && s.mu.inflight == 0 {
 			if err := s.handleBufferedRetries(retryBuf, retryErr); err != nil {
-				s.mu.flushErr = err
+				s.mu.flushErr = markKafkaErrorClass(err)
 			}
 			endInternalRetry()
 		}
@@ -584,19 +1448,91 @@ func (s *kafkaSink) workerLoop() {
 	}
 }
 
-func (s *kafkaSink) finishProducerMessage(ackMsg *sarama.ProducerMessage, ackError error) {
+// finishProducerMessage records the acknowledgement of a message by the
+// broker at the given host and releases its resources.
+func (s *kafkaSink) finishProducerMessage(
+	ackMsg *sarama.ProducerMessage, host string, ackError error,
+) {
 	s.mu.AssertHeld()
 	if m, ok := ackMsg.Metadata.(messageMetadata); ok {
+		sz := ackMsg.Key.Length() + ackMsg.Value.Length()
 		if ackError == nil {
-			sz := ackMsg.Key.Length() + ackMsg.Value.Length()
 			s.stats.finishMessage(int64(sz))
 			m.updateMetrics(m.mvcc, sz, sinkDoesNotCompress)
 		}
+		s.metrics.recordSinkHostIO(host, m.emitTime, 1 /* numMessages */, sz, ackError)
 		m.alloc.Release(s.ctx)
 	}
 	if s.mu.flushErr == nil && ackError != nil {
-		s.mu.flushErr = ackError
+		s.mu.flushErr = markKafkaErrorClass(ackError)
+	}
+}
+
+// markKafkaErrorClass marks the errors of kafka clients and brokers with their
+// changefeedbase.ErrorClass.
+func markKafkaErrorClass(err error) error {
+	if errors.IsAny(err, sarama.ErrOutOfBrokers, sarama.ErrNotConnected) {
+		return changefeedbase.MarkErrorClass(err, changefeedbase.ErrorClassNetwork)
+	}
+	var kError sarama.KError
+	if !errors.As(err, &kError) {
+		return err
+	}
+	switch kError {
+	case sarama.ErrSASLAuthenticationFailed, sarama.ErrTopicAuthorizationFailed,
+		sarama.ErrClusterAuthorizationFailed:
+		return changefeedbase.MarkErrorClass(err, changefeedbase.ErrorClassAuth)
+	case sarama.ErrMessageSizeTooLarge, sarama.ErrThrottlingQuotaExceeded:
+		return changefeedbase.MarkErrorClass(err, changefeedbase.ErrorClassQuota)
+	case sarama.ErrBrokerNotAvailable, sarama.ErrLeaderNotAvailable,
+		sarama.ErrNotLeaderForPartition, sarama.ErrRequestTimedOut, sarama.ErrNetworkException:
+		return changefeedbase.MarkErrorClass(err, changefeedbase.ErrorClassNetwork)
+	}
+	return err
+}
+
+// kafkaTopicPartition identifies a partition of a topic.
+type kafkaTopicPartition struct {
+	topic     string
+	partition int32
+}
+
+// resolveBrokerHost returns the address of the broker leading the partition
+// to which the message was produced. The leader is looked up in the metadata
+// of the client if it isn't cached yet or if refresh is set, which may block
+// on the brokers, so it must not be called with s.mu held. If the leader is
+// not known, the bootstrap addresses are returned instead.
+func (s *kafkaSink) resolveBrokerHost(msg *sarama.ProducerMessage, refresh bool) string {
+	if msg == nil {
+		return s.bootstrapAddrs
+	}
+	tp := kafkaTopicPartition{topic: msg.Topic, partition: msg.Partition}
+	if host, ok := s.brokerHosts[tp]; ok && !refresh {
+		return host
+	}
+	delete(s.brokerHosts, tp)
+	// s.client is only nil in tests.
+	if s.client != nil {
+		if b, err := s.client.Leader(msg.Topic, msg.Partition); err == nil && b != nil {
+			if s.brokerHosts == nil {
+				s.brokerHosts = make(map[kafkaTopicPartition]string)
+			}
+			s.brokerHosts[tp] = b.Addr()
+			return b.Addr()
+		}
+	}
+	return s.bootstrapAddrs
+}
+
+// cachedBrokerHost is like resolveBrokerHost, but only consults the cached
+// leaders, so that it may be called with s.mu held.
+func (s *kafkaSink) cachedBrokerHost(msg *sarama.ProducerMessage) string {
+	if msg != nil {
+		if host, ok := s.brokerHosts[kafkaTopicPartition{topic: msg.Topic, partition: msg.Partition}]; ok {
+			return host
+		}
 	}
+	return s.bootstrapAddrs
 }
 
 func (s *kafkaSink) handleBufferedRetries(msgs []*sarama.ProducerMessage, retryErr error) error {
@@ -607,7 +1543,7 @@ func (s *kafkaSink) handleBufferedRetries(msgs []*sarama.ProducerMessage, retryE
 	// Ensure memory for messages are always cleaned up
 	defer func() {
 		for _, msg := range msgs {
-			s.finishProducerMessage(msg, lastSendErr)
+			s.finishProducerMessage(msg, s.cachedBrokerHost(msg), lastSendErr)
 		}
 	}()
 
@@ -702,15 +1638,42 @@ func (s *kafkaSink) Topics() []string {
 }
 
 type changefeedPartitioner struct {
-	hash sarama.Partitioner
+	topic string
+	// pinned maps keys to the partition they're pinned to. The empty key pins
+	// every other message of the topic.
+	pinned map[string]int32
+	// Exactly one of hash and hashKey is set, unless the partitioner is
+	// manual.
+	hash    sarama.Partitioner
+	hashKey func(key []byte, numPartitions int32) int32
 }
 
 var _ sarama.Partitioner = &changefeedPartitioner{}
-var _ sarama.PartitionerConstructor = newChangefeedPartitioner
 
-func newChangefeedPartitioner(topic string) sarama.Partitioner {
-	return &changefeedPartitioner{
-		hash: sarama.NewHashPartitioner(topic),
+// newChangefeedPartitioner returns a sarama.PartitionerConstructor which
+// partitions messages as configured by c.
+func newChangefeedPartitioner(c *saramaConfig) sarama.PartitionerConstructor {
+	return func(topic string) sarama.Partitioner {
+		p := &changefeedPartitioner{topic: topic}
+		switch c.Partitioner {
+		case kafkaPartitionerMurmur2:
+			p.hashKey = murmur2Partition
+		case kafkaPartitionerCRC32:
+			p.hashKey = crc32Partition
+		case kafkaPartitionerManual:
+		default:
+			p.hash = sarama.NewHashPartitioner(topic)
+		}
+		for _, m := range c.Partitions {
+			if m.Topic != topic {
+				continue
+			}
+			if p.pinned == nil {
+				p.pinned = make(map[string]int32)
+			}
+			p.pinned[m.Key] = m.Partition
+		}
+		return p
 	}
 }
 
@@ -721,7 +1684,76 @@ func (p *changefeedPartitioner) Partition(
 	if message.Key == nil {
 		return message.Partition, nil
 	}
-	return p.hash.Partition(message, numPartitions)
+	if p.pinned == nil && p.hash != nil {
+		return p.hash.Partition(message, numPartitions)
+	}
+	key, err := message.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+	partition, ok := p.pinned[string(key)]
+	if !ok {
+		partition, ok = p.pinned[``]
+	}
+	switch {
+	case ok:
+		if partition >= numPartitions {
+			return -1, errors.Errorf(`topic %s has %d partitions, but %s pins messages to partition %d`,
+				p.topic, numPartitions, changefeedbase.OptKafkaSinkConfig, partition)
+		}
+		return partition, nil
+	case p.hashKey != nil:
+		return p.hashKey(key, numPartitions), nil
+	case p.hash != nil:
+		return p.hash.Partition(message, numPartitions)
+	default:
+		return -1, errors.Errorf(`message with key %s of topic %s is not pinned to a partition by %s`,
+			key, p.topic, changefeedbase.OptKafkaSinkConfig)
+	}
+}
+
+// murmur2Partition partitions keys like the default partitioner of the Java
+// client.
+func murmur2Partition(key []byte, numPartitions int32) int32 {
+	return int32(murmur2(key)&0x7fffffff) % numPartitions
+}
+
+// crc32Partition partitions keys like librdkafka's consistent partitioner.
+func crc32Partition(key []byte, numPartitions int32) int32 {
+	return int32(crc32.ChecksumIEEE(key) % uint32(numPartitions))
+}
+
+// murmur2 is the variant of MurmurHash2 used by the Java client to hash keys.
+func murmur2(data []byte) uint32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	h := seed ^ uint32(len(data))
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
 }
 
 type jsonDuration time.Duration
@@ -766,9 +1798,52 @@ func (c *saramaConfig) Apply(kafka *sarama.Config) error {
 		kafka.Producer.RequiredAcks = parsedAcks
 	}
 	kafka.Producer.Compression = sarama.CompressionCodec(c.Compression)
+	if c.usesCodec(sarama.CompressionZSTD) {
+		// Brokers accept zstd compressed batches as of Kafka 2.1, which sarama
+		// requires the version of the config to be at least.
+		if c.Version == "" && !kafka.Version.IsAtLeast(sarama.V2_1_0_0) {
+			kafka.Version = sarama.V2_1_0_0
+		} else if !kafka.Version.IsAtLeast(sarama.V2_1_0_0) {
+			return errors.Errorf(`ZSTD compression requires kafka version 2.1.0 or later, but Version is %s`,
+				kafka.Version)
+		}
+	}
+	if c.Idempotent || c.Transactional {
+		// Sarama only keeps the sequence numbers of the messages of a
+		// partition in order with a single request in flight per broker.
+		kafka.Producer.Idempotent = true
+		kafka.Producer.RequiredAcks = sarama.WaitForAll
+		kafka.Net.MaxOpenRequests = 1
+		if c.Version == "" && !kafka.Version.IsAtLeast(sarama.V0_11_0_0) {
+			kafka.Version = sarama.V0_11_0_0
+		} else if !kafka.Version.IsAtLeast(sarama.V0_11_0_0) {
+			return errors.Errorf(`Idempotent requires kafka version 0.11.0 or later, but Version is %s`,
+				kafka.Version)
+		}
+	}
+	if c.Transactional {
+		// Producers sharing a transactional ID fence each other off, so each
+		// sink has its own.
+		kafka.Producer.Transaction.ID = fmt.Sprintf(`crdb-changefeed-%s`, uuid.MakeV4())
+	}
+	kafka.Producer.Partitioner = newChangefeedPartitioner(c)
 	return nil
 }
 
+// usesCodec returns whether the messages of any topic are compressed with
+// codec.
+func (c *saramaConfig) usesCodec(codec sarama.CompressionCodec) bool {
+	if sarama.CompressionCodec(c.Compression) == codec {
+		return true
+	}
+	for _, topicCodec := range c.TopicCompression {
+		if sarama.CompressionCodec(topicCodec) == codec {
+			return true
+		}
+	}
+	return false
+}
+
 func parseRequiredAcks(a string) (sarama.RequiredAcks, error) {
 	switch a {
 	case "0", "NONE":
@@ -795,7 +1870,7 @@ func getSaramaConfig(
 
 func buildKafkaConfig(
 	u sinkURL, jsonStr changefeedbase.SinkSpecificJSONConfig,
-) (*sarama.Config, error) {
+) (*sarama.Config, *saramaConfig, error) {
 	dialConfig := struct {
 		tlsEnabled    bool
 		tlsSkipVerify bool
@@ -810,39 +1885,39 @@ func buildKafkaConfig(
 	}{}
 
 	if _, err := u.consumeBool(changefeedbase.SinkParamTLSEnabled, &dialConfig.tlsEnabled); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if _, err := u.consumeBool(changefeedbase.SinkParamSkipTLSVerify, &dialConfig.tlsSkipVerify); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := u.decodeBase64(changefeedbase.SinkParamCACert, &dialConfig.caCert); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := u.decodeBase64(changefeedbase.SinkParamClientCert, &dialConfig.clientCert); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := u.decodeBase64(changefeedbase.SinkParamClientKey, &dialConfig.clientKey); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if _, err := u.consumeBool(changefeedbase.SinkParamSASLEnabled, &dialConfig.saslEnabled); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if wasSet, err := u.consumeBool(changefeedbase.SinkParamSASLHandshake, &dialConfig.saslHandshake); !wasSet && err == nil {
 		dialConfig.saslHandshake = true
 	} else {
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if !dialConfig.saslEnabled {
-			return nil, errors.Errorf(`%s must be enabled to configure SASL handshake behavior`, changefeedbase.SinkParamSASLEnabled)
+			return nil, nil, errors.Errorf(`%s must be enabled to configure SASL handshake behavior`, changefeedbase.SinkParamSASLEnabled)
 		}
 	}
 
 	dialConfig.saslMechanism = u.consumeParam(changefeedbase.SinkParamSASLMechanism)
 	if dialConfig.saslMechanism != `` && !dialConfig.saslEnabled {
-		return nil, errors.Errorf(`%s must be enabled to configure SASL mechanism`, changefeedbase.SinkParamSASLEnabled)
+		return nil, nil, errors.Errorf(`%s must be enabled to configure SASL mechanism`, changefeedbase.SinkParamSASLEnabled)
 	}
 	if dialConfig.saslMechanism == `` {
 		dialConfig.saslMechanism = sarama.SASLTypePlaintext
@@ -850,7 +1925,7 @@ func buildKafkaConfig(
 	switch dialConfig.saslMechanism {
 	case sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512, sarama.SASLTypePlaintext:
 	default:
-		return nil, errors.Errorf(`param %s must be one of %s, %s, or %s`,
+		return nil, nil, errors.Errorf(`param %s must be one of %s, %s, or %s`,
 			changefeedbase.SinkParamSASLMechanism,
 			sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512, sarama.SASLTypePlaintext)
 	}
@@ -859,24 +1934,23 @@ func buildKafkaConfig(
 	dialConfig.saslPassword = u.consumeParam(changefeedbase.SinkParamSASLPassword)
 	if dialConfig.saslEnabled {
 		if dialConfig.saslUser == `` {
-			return nil, errors.Errorf(`%s must be provided when SASL is enabled`, changefeedbase.SinkParamSASLUser)
+			return nil, nil, errors.Errorf(`%s must be provided when SASL is enabled`, changefeedbase.SinkParamSASLUser)
 		}
 		if dialConfig.saslPassword == `` {
-			return nil, errors.Errorf(`%s must be provided when SASL is enabled`, changefeedbase.SinkParamSASLPassword)
+			return nil, nil, errors.Errorf(`%s must be provided when SASL is enabled`, changefeedbase.SinkParamSASLPassword)
 		}
 	} else {
 		if dialConfig.saslUser != `` {
-			return nil, errors.Errorf(`%s must be enabled if a SASL user is provided`, changefeedbase.SinkParamSASLEnabled)
+			return nil, nil, errors.Errorf(`%s must be enabled if a SASL user is provided`, changefeedbase.SinkParamSASLEnabled)
 		}
 		if dialConfig.saslPassword != `` {
-			return nil, errors.Errorf(`%s must be enabled if a SASL password is provided`, changefeedbase.SinkParamSASLEnabled)
+			return nil, nil, errors.Errorf(`%s must be enabled if a SASL password is provided`, changefeedbase.SinkParamSASLEnabled)
 		}
 	}
 
 	config := sarama.NewConfig()
 	config.ClientID = `CockroachDB`
 	config.Producer.Return.Successes = true
-	config.Producer.Partitioner = newChangefeedPartitioner
 
 	if dialConfig.tlsEnabled {
 		config.Net.TLS.Enable = true
@@ -891,24 +1965,24 @@ func buildKafkaConfig(
 		}
 
 		if dialConfig.clientCert != nil && dialConfig.clientKey == nil {
-			return nil, errors.Errorf(`%s requires %s to be set`, changefeedbase.SinkParamClientCert, changefeedbase.SinkParamClientKey)
+			return nil, nil, errors.Errorf(`%s requires %s to be set`, changefeedbase.SinkParamClientCert, changefeedbase.SinkParamClientKey)
 		} else if dialConfig.clientKey != nil && dialConfig.clientCert == nil {
-			return nil, errors.Errorf(`%s requires %s to be set`, changefeedbase.SinkParamClientKey, changefeedbase.SinkParamClientCert)
+			return nil, nil, errors.Errorf(`%s requires %s to be set`, changefeedbase.SinkParamClientKey, changefeedbase.SinkParamClientCert)
 		}
 
 		if dialConfig.clientCert != nil && dialConfig.clientKey != nil {
 			cert, err := tls.X509KeyPair(dialConfig.clientCert, dialConfig.clientKey)
 			if err != nil {
-				return nil, errors.Wrap(err, `invalid client certificate data provided`)
+				return nil, nil, errors.Wrap(err, `invalid client certificate data provided`)
 			}
 			config.Net.TLS.Config.Certificates = []tls.Certificate{cert}
 		}
 	} else {
 		if dialConfig.caCert != nil {
-			return nil, errors.Errorf(`%s requires %s=true`, changefeedbase.SinkParamCACert, changefeedbase.SinkParamTLSEnabled)
+			return nil, nil, errors.Errorf(`%s requires %s=true`, changefeedbase.SinkParamCACert, changefeedbase.SinkParamTLSEnabled)
 		}
 		if dialConfig.clientCert != nil {
-			return nil, errors.Errorf(`%s requires %s=true`, changefeedbase.SinkParamClientCert, changefeedbase.SinkParamTLSEnabled)
+			return nil, nil, errors.Errorf(`%s requires %s=true`, changefeedbase.SinkParamClientCert, changefeedbase.SinkParamTLSEnabled)
 		}
 	}
 
@@ -929,42 +2003,128 @@ func buildKafkaConfig(
 	// Apply statement level overrides.
 	saramaCfg, err := getSaramaConfig(jsonStr)
 	if err != nil {
-		return nil, errors.Wrapf(err,
+		return nil, nil, errors.Wrapf(err,
 			"failed to parse sarama config; check %s option", changefeedbase.OptKafkaSinkConfig)
 	}
 
 	if err := saramaCfg.Validate(); err != nil {
-		return nil, errors.Wrap(err, "invalid sarama configuration")
+		return nil, nil, errors.Wrap(err, "invalid sarama configuration")
 	}
 
 	if err := saramaCfg.Apply(config); err != nil {
-		return nil, errors.Wrap(err, "failed to apply kafka client configuration")
+		return nil, nil, errors.Wrap(err, "failed to apply kafka client configuration")
 	}
-	return config, nil
+	return config, saramaCfg, nil
+}
+
+// buildKafkaTopicDetail returns the settings of the topics created by the sink,
+// or nil if the sink does not create topics. Unset settings use the defaults
+// of the broker.
+func buildKafkaTopicDetail(u sinkURL) (*sarama.TopicDetail, error) {
+	var autoCreate bool
+	if _, err := u.consumeBool(changefeedbase.SinkParamAutoCreateTopics, &autoCreate); err != nil {
+		return nil, err
+	}
+	partitions := u.consumeParam(changefeedbase.SinkParamTopicPartitions)
+	replicationFactor := u.consumeParam(changefeedbase.SinkParamTopicReplicationFactor)
+	cleanupPolicy := u.consumeParam(changefeedbase.SinkParamTopicCleanupPolicy)
+	if !autoCreate {
+		for _, p := range []struct{ param, v string }{
+			{changefeedbase.SinkParamTopicPartitions, partitions},
+			{changefeedbase.SinkParamTopicReplicationFactor, replicationFactor},
+			{changefeedbase.SinkParamTopicCleanupPolicy, cleanupPolicy},
+		} {
+			if p.v != `` {
+				return nil, errors.Errorf(`param %s requires %s=true`,
+					p.param, changefeedbase.SinkParamAutoCreateTopics)
+			}
+		}
+		return nil, nil
+	}
+
+	detail := &sarama.TopicDetail{NumPartitions: -1, ReplicationFactor: -1}
+	if partitions != `` {
+		n, err := strconv.ParseInt(partitions, 10, 32)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf(`param %s must be a positive integer: %q`,
+				changefeedbase.SinkParamTopicPartitions, partitions)
+		}
+		detail.NumPartitions = int32(n)
+	}
+	if replicationFactor != `` {
+		n, err := strconv.ParseInt(replicationFactor, 10, 16)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf(`param %s must be a positive integer: %q`,
+				changefeedbase.SinkParamTopicReplicationFactor, replicationFactor)
+		}
+		detail.ReplicationFactor = int16(n)
+	}
+	if cleanupPolicy != `` {
+		for _, policy := range strings.Split(cleanupPolicy, `,`) {
+			if policy != `compact` && policy != `delete` {
+				return nil, errors.Errorf(`param %s must be compact, delete or compact,delete: %q`,
+					changefeedbase.SinkParamTopicCleanupPolicy, cleanupPolicy)
+			}
+		}
+		detail.ConfigEntries = map[string]*string{`cleanup.policy`: &cleanupPolicy}
+	}
+	return detail, nil
 }
 
 func makeKafkaSink(
 	ctx context.Context,
 	u sinkURL,
 	targets changefeedbase.Targets,
+	encodingOpts changefeedbase.EncodingOptions,
 	jsonStr changefeedbase.SinkSpecificJSONConfig,
 	settings *cluster.Settings,
 	mb metricsRecorderBuilder,
 ) (Sink, error) {
+	// Sinks share their clients with the sinks dialing identical clients,
+	// i.e. with the same URI and kafka_sink_config, before its parameters are
+	// consumed.
+	clientKey := sinkClientKey(changefeedbase.SinkSchemeKafka, u.String(), string(jsonStr))
+
 	kafkaTopicPrefix := u.consumeParam(changefeedbase.SinkParamTopicPrefix)
 	kafkaTopicName := u.consumeParam(changefeedbase.SinkParamTopicName)
 	if schemaTopic := u.consumeParam(changefeedbase.SinkParamSchemaTopic); schemaTopic != `` {
 		return nil, errors.Errorf(`%s is not yet supported`, changefeedbase.SinkParamSchemaTopic)
 	}
 
-	config, err := buildKafkaConfig(u, jsonStr)
+	config, saramaCfg, err := buildKafkaConfig(u, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	topicDetail, err := buildKafkaTopicDetail(u)
 	if err != nil {
 		return nil, err
 	}
 
+	resolvedPartition := int32(-1)
+	if v := u.consumeParam(changefeedbase.SinkParamResolvedPartition); v != `` {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf(`param %s must be a non-negative integer: %q`,
+				changefeedbase.SinkParamResolvedPartition, v)
+		}
+		resolvedPartition = int32(n)
+	}
+	resolvedTopic := u.consumeParam(changefeedbase.SinkParamResolvedTopic)
+	if resolvedTopic != `` && resolvedPartition >= 0 {
+		return nil, errors.Errorf(`param %s cannot be used with %s, whose messages are partitioned by key`,
+			changefeedbase.SinkParamResolvedPartition, changefeedbase.SinkParamResolvedTopic)
+	}
+
+	var preflightCheck bool
+	if _, err := u.consumeBool(changefeedbase.SinkParamPreflightCheck, &preflightCheck); err != nil {
+		return nil, err
+	}
+
 	topics, err := MakeTopicNamer(
 		targets,
-		WithPrefix(kafkaTopicPrefix), WithSingleName(kafkaTopicName), WithSanitizeFn(SQLNameToKafkaName))
+		append(familyTopicNameOptions(encodingOpts),
+			WithPrefix(kafkaTopicPrefix), WithSingleName(kafkaTopicName), WithSanitizeFn(SQLNameToKafkaName))...)
 
 	if err != nil {
 		return nil, err
@@ -978,7 +2138,30 @@ func makeKafkaSink(
 		bootstrapAddrs:       u.Host,
 		metrics:              mb(requiresResourceAccounting),
 		topics:               topics,
+		topicDetail:          topicDetail,
+		topicCompression:     saramaCfg.TopicCompression,
+		resolvedPartition:    resolvedPartition,
+		resolvedTopic:        resolvedTopic,
+		preflightCheck:       preflightCheck,
+		transactional:        config.Producer.Transaction.ID != ``,
+		clientKey:            clientKey,
 		disableInternalRetry: !internalRetryEnabled,
+		cloudEventsBinary:    encodingOpts.CloudEventsMode == changefeedbase.OptCloudEventsModeBinary,
+		traceContext:         encodingOpts.TraceContext,
+	}
+
+	// Let the sink react to brokers throttling produce requests.
+	config.MetricRegistry = newKafkaThrottleRegistry(config.MetricRegistry, sink.recordThrottle)
+
+	// Record headers were introduced in Kafka 0.11.
+	if sink.cloudEventsBinary && !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, errors.Errorf(`%s=%s requires kafka version 0.11 or later, but %s sets version %s`,
+			changefeedbase.OptCloudEventsMode, changefeedbase.OptCloudEventsModeBinary,
+			changefeedbase.OptKafkaSinkConfig, config.Version)
+	}
+	if sink.traceContext && !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, errors.Errorf(`%s requires kafka version 0.11 or later, but %s sets version %s`,
+			changefeedbase.OptTraceContext, changefeedbase.OptKafkaSinkConfig, config.Version)
 	}
 
 	if unknownParams := u.remainingQueryParams(); len(unknownParams) > 0 {
@@ -0,0 +1,179 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// sarama compresses every batch of a producer with the codec of its config,
+// so the messages of topics configured with their own codec through the
+// TopicCompression field of kafka_sink_config are produced by a producer, and
+// client, of their own for each codec, e.g. with
+//
+//	kafka_sink_config='{"Compression": "LZ4", "TopicCompression": {"orders": "ZSTD"}}'
+//
+// messages to the orders topic are compressed with zstd and the others with
+// lz4.
+
+// topicCompressionProducer is a sarama.AsyncProducer which routes the
+// messages of some topics to the producers compressing them with the codec of
+// those topics, and every other message to a default producer. The successes
+// and errors of all the producers are merged.
+type topicCompressionProducer struct {
+	// AsyncProducer is the default producer. Transactional sinks can't
+	// compress topics with codecs of their own, so transactions are left to
+	// it.
+	sarama.AsyncProducer
+	// byTopic maps topics to the producer of their codec.
+	byTopic map[string]sarama.AsyncProducer
+	// producers and clients are the producers of the codecs of topics, and
+	// their clients, which are closed along with this producer.
+	producers []sarama.AsyncProducer
+	clients   []kafkaClient
+
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+var _ sarama.AsyncProducer = (*topicCompressionProducer)(nil)
+
+// newTopicCompressionProducer returns a producer routing the messages of
+// topics to the producers of their codec in byCodec, and other messages to
+// defaultProducer. The producers of byCodec, and their clients, are closed
+// along with it.
+func newTopicCompressionProducer(
+	defaultProducer sarama.AsyncProducer,
+	topicCodecs map[string]sarama.CompressionCodec,
+	byCodec map[sarama.CompressionCodec]sarama.AsyncProducer,
+	clients []kafkaClient,
+) *topicCompressionProducer {
+	p := &topicCompressionProducer{
+		AsyncProducer: defaultProducer,
+		byTopic:       make(map[string]sarama.AsyncProducer, len(topicCodecs)),
+		clients:       clients,
+		input:         make(chan *sarama.ProducerMessage),
+		successes:     make(chan *sarama.ProducerMessage),
+		errors:        make(chan *sarama.ProducerError),
+		done:          make(chan struct{}),
+	}
+	for topic, codec := range topicCodecs {
+		if producer, ok := byCodec[codec]; ok {
+			p.byTopic[topic] = producer
+		}
+	}
+	for _, producer := range byCodec {
+		p.producers = append(p.producers, producer)
+	}
+
+	p.wg.Add(2 + len(p.producers))
+	go p.route()
+	go p.forward(defaultProducer)
+	for _, producer := range p.producers {
+		go p.forward(producer)
+	}
+	return p
+}
+
+// route sends the messages to the producer of their topic.
+func (p *topicCompressionProducer) route() {
+	defer p.wg.Done()
+	for {
+		select {
+		case m := <-p.input:
+			producer, ok := p.byTopic[m.Topic]
+			if !ok {
+				producer = p.AsyncProducer
+			}
+			select {
+			case producer.Input() <- m:
+			case <-p.done:
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// forward merges the successes and errors of producer into those of p.
+func (p *topicCompressionProducer) forward(producer sarama.AsyncProducer) {
+	defer p.wg.Done()
+	for {
+		select {
+		case m := <-producer.Successes():
+			select {
+			case p.successes <- m:
+			case <-p.done:
+				return
+			}
+		case err := <-producer.Errors():
+			select {
+			case p.errors <- err:
+			case <-p.done:
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Input implements the sarama.AsyncProducer interface.
+func (p *topicCompressionProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+// Successes implements the sarama.AsyncProducer interface.
+func (p *topicCompressionProducer) Successes() <-chan *sarama.ProducerMessage {
+	return p.successes
+}
+
+// Errors implements the sarama.AsyncProducer interface.
+func (p *topicCompressionProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+// AsyncClose implements the sarama.AsyncProducer interface.
+func (p *topicCompressionProducer) AsyncClose() {
+	go func() { _ = p.Close() }()
+}
+
+// Close implements the sarama.AsyncProducer interface. The messages which
+// were not yet routed to a producer are dropped, and the acknowledgements
+// which were not yet read are discarded.
+func (p *topicCompressionProducer) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.done)
+		p.wg.Wait()
+		err = p.AsyncProducer.Close()
+		for _, producer := range p.producers {
+			if closeErr := producer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		for _, client := range p.clients {
+			if client == nil {
+				continue
+			}
+			if closeErr := client.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+)
+
+// A kafka sink learns that it can't write to a topic when the first message
+// to it is produced, which for the topic of a rarely updated table may be long
+// after the changefeed was created. With preflight_check=true, the sink
+// instead checks, through the admin API of the cluster, that every topic it
+// emits to exists, creating it if auto_create_topics=true, and that the
+// ACLs of the SASL user of the sink allow writing to it whenever the sink is
+// dialed, i.e. when the changefeed is created or resumed. It fails with a
+// report of the permissions of every topic if any topic can't be written to.
+//
+// Only the outcomes reported by the brokers fail the check. The ACLs listed
+// for a topic are only matched against the principal of the sink, which
+// misses principals the brokers authorize regardless of ACLs, e.g. super
+// users, prefixed or wildcard resource patterns, and host restrictions, so
+// the ACLs which appear to deny writing are reported as warnings. The ACLs
+// are only checked for SASL users, as the principal of other clients depends
+// on the configuration of the brokers, and a user which can't list ACLs only
+// has the existence of topics checked.
+
+// kafkaTopicPermission is the outcome of the preflight check of a topic.
+type kafkaTopicPermission struct {
+	topic string
+	// problem, if set, is why the sink can't write to the topic.
+	problem string
+	// note, if set, qualifies a topic the sink can write to.
+	note string
+	// warning, if set, is why the ACLs of the topic appear not to allow the
+	// sink to write to it.
+	warning string
+}
+
+func (p kafkaTopicPermission) String() string {
+	switch {
+	case p.problem != ``:
+		return fmt.Sprintf(`%s: %s`, p.topic, p.problem)
+	case p.warning != ``:
+		return fmt.Sprintf(`%s: warning: %s`, p.topic, p.warning)
+	case p.note != ``:
+		return fmt.Sprintf(`%s: ok (%s)`, p.topic, p.note)
+	default:
+		return fmt.Sprintf(`%s: ok`, p.topic)
+	}
+}
+
+// preflightCheckTopics checks that the sink can write to all of its topics,
+// returning an error with the permissions of every topic if it can't.
+func (s *kafkaSink) preflightCheckTopics() error {
+	var topics []string
+	if err := s.topics.Each(func(topic string) error {
+		topics = append(topics, topic)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if s.resolvedTopic != `` {
+		topics = append(topics, s.resolvedTopic)
+	}
+
+	report, err := s.checkTopicPermissions(topics)
+	if err != nil {
+		return err
+	}
+	lines := make([]string, 0, len(report))
+	var denied []string
+	warned := false
+	for _, p := range report {
+		lines = append(lines, p.String())
+		if p.problem != `` {
+			denied = append(denied, p.topic)
+		}
+		warned = warned || p.warning != ``
+	}
+	if len(denied) == 0 {
+		if warned {
+			log.Warningf(s.ctx, `kafka sink preflight check passed with warnings: %s`, strings.Join(lines, `; `))
+		} else {
+			log.Infof(s.ctx, `kafka sink preflight check passed: %s`, strings.Join(lines, `; `))
+		}
+		return nil
+	}
+	return errors.WithDetail(
+		pgerror.Newf(pgcode.InsufficientPrivilege,
+			`kafka sink cannot write to %d of %d topics (%s=true): %s`,
+			len(denied), len(report), changefeedbase.SinkParamPreflightCheck, strings.Join(denied, `, `)),
+		strings.Join(lines, "\n"))
+}
+
+// checkTopicPermissions returns the permissions of the sink on topics, in
+// order. Missing topics are created if the sink creates topics.
+func (s *kafkaSink) checkTopicPermissions(topics []string) ([]kafkaTopicPermission, error) {
+	metadata, err := s.admin.DescribeTopics(topics)
+	if err != nil {
+		return nil, pgerror.Wrapf(err, pgcode.CannotConnectNow,
+			`describing kafka topics %s`, strings.Join(topics, `, `))
+	}
+	topicErrs := make(map[string]sarama.KError, len(metadata))
+	for _, m := range metadata {
+		topicErrs[m.Name] = m.Err
+	}
+
+	var principal string
+	if s.kafkaCfg.Net.SASL.Enable && s.kafkaCfg.Net.SASL.User != `` {
+		principal = `User:` + s.kafkaCfg.Net.SASL.User
+	}
+
+	report := make([]kafkaTopicPermission, 0, len(topics))
+	for _, topic := range topics {
+		p := kafkaTopicPermission{topic: topic}
+		topicErr, ok := topicErrs[topic]
+		switch {
+		case !ok:
+			p.problem = `topic not described by the brokers`
+		case topicErr == sarama.ErrTopicAuthorizationFailed:
+			p.problem = `not authorized to access topic`
+		case topicErr == sarama.ErrUnknownTopicOrPartition:
+			if s.topicDetail == nil {
+				p.problem = fmt.Sprintf(`topic does not exist and %s is not set`,
+					changefeedbase.SinkParamAutoCreateTopics)
+			} else if err := s.maybeCreateTopic(topic); err != nil {
+				p.problem = err.Error()
+			} else {
+				p.note = `created`
+			}
+		case topicErr != sarama.ErrNoError:
+			p.problem = topicErr.Error()
+		}
+		if p.problem == `` && principal != `` {
+			s.checkTopicACLs(&p, principal)
+		}
+		report = append(report, p)
+	}
+	return report, nil
+}
+
+// checkTopicACLs records a warning on p if the ACLs of the topic appear not to
+// allow principal to write to it. ACLs which deny writing take precedence
+// over those allowing it, and writing appears denied if no ACL allows it.
+func (s *kafkaSink) checkTopicACLs(p *kafkaTopicPermission, principal string) {
+	topic := p.topic
+	acls, err := s.admin.ListAcls(sarama.AclFilter{
+		ResourceType:              sarama.AclResourceTopic,
+		ResourceName:              &topic,
+		ResourcePatternTypeFilter: sarama.AclPatternMatch,
+		Operation:                 sarama.AclOperationAny,
+		PermissionType:            sarama.AclPermissionAny,
+	})
+	if err != nil {
+		note := fmt.Sprintf(`ACLs not checked: %v`, err)
+		if errors.Is(err, sarama.ErrSecurityDisabled) {
+			note = `no authorizer`
+		}
+		if p.note != `` {
+			note = p.note + `, ` + note
+		}
+		p.note = note
+		return
+	}
+
+	allowed, denied := false, false
+	for _, resource := range acls {
+		for _, acl := range resource.Acls {
+			if acl.Principal != principal && acl.Principal != `User:*` {
+				continue
+			}
+			if acl.Operation != sarama.AclOperationWrite && acl.Operation != sarama.AclOperationAll {
+				continue
+			}
+			switch acl.PermissionType {
+			case sarama.AclPermissionAllow:
+				allowed = true
+			case sarama.AclPermissionDeny:
+				denied = true
+			}
+		}
+	}
+	switch {
+	case denied:
+		p.warning = fmt.Sprintf(`an ACL appears to deny %s writing to topic`, principal)
+	case !allowed:
+		p.warning = fmt.Sprintf(`no ACL appears to allow %s to write to topic`, principal)
+	}
+}
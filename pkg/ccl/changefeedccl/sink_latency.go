@@ -0,0 +1,125 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+// latencySink wraps a sink, waiting before each write to it for the latency
+// returned by the SinkWriteLatency testing knob. It lets tests exercise a
+// changefeed against a slow sink, such as a kafka cluster under load, with
+// any sink.
+type latencySink struct {
+	wrapped Sink
+	latency func() time.Duration
+}
+
+var _ Sink = (*latencySink)(nil)
+
+func makeLatencySink(wrapped Sink, latency func() time.Duration) *latencySink {
+	return &latencySink{wrapped: wrapped, latency: latency}
+}
+
+// wait waits for the injected latency, or until the context is canceled.
+func (s *latencySink) wait(ctx context.Context) error {
+	d := s.latency()
+	if d <= 0 {
+		return nil
+	}
+	timer := timeutil.NewTimer()
+	defer timer.Stop()
+	timer.Reset(d)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		timer.Read = true
+		return nil
+	}
+}
+
+func (s *latencySink) getConcreteType() sinkType {
+	return s.wrapped.getConcreteType()
+}
+
+// Dial implements the Sink interface.
+func (s *latencySink) Dial() error {
+	return s.wrapped.Dial()
+}
+
+// EmitRow implements the Sink interface.
+func (s *latencySink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	if err := s.wait(ctx); err != nil {
+		alloc.Release(ctx)
+		return err
+	}
+	return s.wrapped.EmitRow(ctx, topic, key, value, updated, mvcc, alloc)
+}
+
+// EmitResolvedTimestamp implements the Sink interface.
+func (s *latencySink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.wrapped.EmitResolvedTimestamp(ctx, encoder, resolved)
+}
+
+// EmitResolvedTimestampForTargets implements TargetResolvedTimestampSink.
+func (s *latencySink) EmitResolvedTimestampForTargets(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	include func(changefeedbase.Target) bool,
+) error {
+	sink, ok := s.wrapped.(TargetResolvedTimestampSink)
+	if !ok {
+		return errors.AssertionFailedf(`sink does not support per table resolved timestamps`)
+	}
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return sink.EmitResolvedTimestampForTargets(ctx, encoder, resolved, include)
+}
+
+// Flush implements the Sink interface.
+func (s *latencySink) Flush(ctx context.Context) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.wrapped.Flush(ctx)
+}
+
+// Close implements the Sink interface.
+func (s *latencySink) Close() error {
+	return s.wrapped.Close()
+}
+
+// Topics implements the SinkWithTopics interface.
+func (s *latencySink) Topics() []string {
+	if withTopics, ok := s.wrapped.(SinkWithTopics); ok {
+		return withTopics.Topics()
+	}
+	return nil
+}
@@ -12,20 +12,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"hash/crc32"
+	"io"
+	"net/http"
 	"net/url"
+	"time"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
 	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/ctxgroup"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/logtags"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/impersonate"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -38,9 +44,6 @@ const gcpScope = "https://www.googleapis.com/auth/pubsub"
 const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
 const globalGCPEndpoint = "pubsub.googleapis.com:443"
 
-// TODO: make numOfWorkers configurable
-const numOfWorkers = 128
-
 // isPubsubSInk returns true if url contains scheme with valid pubsub sink
 func isPubsubSink(u *url.URL) bool {
 	return u.Scheme == GcpScheme
@@ -50,38 +53,138 @@ type pubsubClient interface {
 	init() error
 	closeTopics()
 	flushTopics()
-	sendMessage(content []byte, topic string, key string) error
+	publish(
+		ctx context.Context, content []byte, topic string, key string, attributes map[string]string,
+	) (pubsubPublishResult, error)
 	sendMessageToAllTopics(content []byte) error
 	connectivityErrorLocked() error
 }
 
+// pubsubPublishResult is the result of publishing a message, which is ready
+// once Pub/Sub has acknowledged the message or publishing it failed. It's
+// implemented by *pubsub.PublishResult.
+type pubsubPublishResult interface {
+	Get(ctx context.Context) (serverID string, err error)
+}
+
 type jsonPayload struct {
 	Key   json.RawMessage `json:"key"`
 	Value json.RawMessage `json:"value"`
 	Topic string          `json:"topic"`
 }
 
-// payload struct is sent to the sink
-type payload struct {
-	Key   []byte
-	Value []byte
-	Topic string
+// pendingPubsubMessage is a message published by the sink which Pub/Sub has
+// yet to acknowledge.
+type pendingPubsubMessage struct {
+	result pubsubPublishResult
+	size   int
+	alloc  kvevent.Alloc
+}
+
+// pubsubAckBufferSize is the number of published messages the sink buffers for
+// ackLoop before EmitRow blocks. The flow control limits of the sink bound the
+// messages inflight more tightly by default.
+const pubsubAckBufferSize = 1024
+
+// Defaults of pubsub_sink_config. Messages are batched with the defaults of
+// the client library, pubsub.DefaultPublishSettings.
+const (
+	defaultPubsubMaxOutstandingMessages = 1000
+	defaultPubsubMaxOutstandingBytes    = 64 << 20 // 64 MiB
+)
+
+// pubsubSinkConfig is the JSON configuration of the pubsub_sink_config option:
+//
+//	{
+//	  "Flush": {
+//	    "Messages":  ...,
+//	    "Bytes":     ...,
+//	    "Frequency": ...,
+//	  },
+//	  "FlowControl": {
+//	    "Messages": ...,
+//	    "Bytes":    ...,
+//	  }
+//	}
+//
+// Flush configures the batching of the messages of each topic: a batch is
+// published once it holds Messages messages or Bytes bytes, or Frequency
+// after its first message. FlowControl limits the messages, and bytes of
+// messages, which Pub/Sub has yet to acknowledge; EmitRow blocks once either
+// limit is reached, so that a slow Pub/Sub applies backpressure to the
+// changefeed instead of the sink buffering without bound.
+type pubsubSinkConfig struct {
+	Flush       batchConfig             `json:",omitempty"`
+	FlowControl pubsubFlowControlConfig `json:",omitempty"`
+}
+
+type pubsubFlowControlConfig struct {
+	Bytes, Messages int `json:",omitempty"`
+}
+
+func getPubsubSinkConfig(jsonStr changefeedbase.SinkSpecificJSONConfig) (pubsubSinkConfig, error) {
+	cfg := pubsubSinkConfig{
+		FlowControl: pubsubFlowControlConfig{
+			Messages: defaultPubsubMaxOutstandingMessages,
+			Bytes:    defaultPubsubMaxOutstandingBytes,
+		},
+	}
+	if jsonStr != `` {
+		if err := json.Unmarshal([]byte(jsonStr), &cfg); err != nil {
+			return cfg, errors.Wrapf(err, "error unmarshalling json")
+		}
+	}
+	if cfg.Flush.Messages < 0 || cfg.Flush.Bytes < 0 || cfg.Flush.Frequency < 0 ||
+		cfg.FlowControl.Messages < 0 || cfg.FlowControl.Bytes < 0 {
+		return cfg, errors.Errorf("invalid option value %s, all config values must be non-negative",
+			changefeedbase.OptPubsubSinkConfig)
+	}
+	if cfg.FlowControl.Messages == 0 || cfg.FlowControl.Bytes == 0 {
+		return cfg, errors.Errorf("invalid option value %s, flow control limits must be positive",
+			changefeedbase.OptPubsubSinkConfig)
+	}
+	return cfg, nil
 }
 
-// pubsubMessage is sent to worker channels for workers to consume
-type pubsubMessage struct {
-	alloc   kvevent.Alloc
-	message payload
-	isFlush bool
+// publishSettings returns the settings of the topics of the sink.
+func (c pubsubSinkConfig) publishSettings() pubsub.PublishSettings {
+	settings := pubsub.DefaultPublishSettings
+	if c.Flush.Messages > 0 {
+		settings.CountThreshold = c.Flush.Messages
+	}
+	if c.Flush.Bytes > 0 {
+		settings.ByteThreshold = c.Flush.Bytes
+	}
+	if c.Flush.Frequency > 0 {
+		settings.DelayThreshold = time.Duration(c.Flush.Frequency)
+	}
+	// The client fails messages with ErrOverflow once it buffers this many
+	// bytes, which the flow control of the sink has to prevent.
+	if settings.BufferedByteLimit < c.FlowControl.Bytes {
+		settings.BufferedByteLimit = c.FlowControl.Bytes
+	}
+	return settings
 }
 
 type gcpPubsubClient struct {
-	client     *pubsub.Client
-	ctx        context.Context
-	projectID  string
-	endpoint   string
-	topicNamer *TopicNamer
-	url        sinkURL
+	client          *pubsub.Client
+	ctx             context.Context
+	projectID       string
+	endpoint        string
+	topicNamer      *TopicNamer
+	url             sinkURL
+	proxyURL        *url.URL
+	publishSettings pubsub.PublishSettings
+	// skipCredentials, set by a testing knob, dials the client without
+	// credentials or an endpoint, such as for the Pub/Sub emulator.
+	skipCredentials bool
+
+	// clientPool, if set, is the pool through which the client is shared
+	// with the other sinks with the same URI. releaseClient releases the
+	// client acquired from it.
+	clientPool    *sinkClientPool
+	sv            *settings.Values
+	releaseClient func() error
 
 	mu struct {
 		syncutil.Mutex
@@ -91,25 +194,40 @@ type gcpPubsubClient struct {
 	}
 }
 
+// pubsubSink publishes messages asynchronously, with the batching and flow
+// control of the Pub/Sub client library. A Flush waits for Pub/Sub to
+// acknowledge every message emitted before it, so that the changefeed only
+// checkpoints the progress of acknowledged messages.
 type pubsubSink struct {
-	numWorkers int
-
-	workerCtx   context.Context
-	workerGroup ctxgroup.Group
-
-	exitWorkers func()               // Signaled to shut down all workers.
-	eventsChans []chan pubsubMessage //channel where messages are consumed and sent out
-
-	// flushDone channel signaled when flushing completes.
-	flushDone chan struct{}
-
-	// errChan is written to indicate an error while sending message.
-	errChan chan error
-
-	client     pubsubClient
-	topicNamer *TopicNamer
+	client      pubsubClient
+	topicNamer  *TopicNamer
+	format      changefeedbase.FormatType
+	flowControl pubsubFlowControlConfig
+	// traceContext is set if messages carry the traceparent of the span which
+	// emitted them as an attribute.
+	traceContext bool
+
+	// ackCtx is canceled when the sink is closed, which stops ackLoop.
+	ackCtx   context.Context
+	stopAcks func()
+	ackGroup ctxgroup.Group
+	// ackCh passes the messages published by EmitRow to ackLoop, which waits
+	// for Pub/Sub to acknowledge them and releases their allocations.
+	ackCh chan pendingPubsubMessage
 
-	format changefeedbase.FormatType
+	mu struct {
+		syncutil.Mutex
+		// inflight and inflightBytes are the number, and size, of the published
+		// messages which are yet to be acknowledged.
+		inflight      int
+		inflightBytes int
+		// publishErr is the first error publishing a message, which fails every
+		// later EmitRow and Flush.
+		publishErr error
+		// ackedCh, if set, is closed once the next message is acknowledged, or
+		// publishing it failed.
+		ackedCh chan struct{}
+	}
 }
 
 func (p *pubsubSink) getConcreteType() sinkType {
@@ -188,6 +306,8 @@ func MakePubsubSink(
 	encodingOpts changefeedbase.EncodingOptions,
 	targets changefeedbase.Targets,
 	unordered bool,
+	jsonConfig changefeedbase.SinkSpecificJSONConfig,
+	skipCredentials bool,
 ) (Sink, error) {
 
 	pubsubURL := sinkURL{URL: u, q: u.Query()}
@@ -207,16 +327,21 @@ func MakePubsubSink(
 	switch encodingOpts.Envelope {
 	case changefeedbase.OptEnvelopeWrapped, changefeedbase.OptEnvelopeBare:
 	default:
-		return nil, errors.Errorf(`this sink is incompatible with %s=%s`,
-			changefeedbase.OptEnvelope, encodingOpts.Envelope)
+		return nil, incompatibleEnvelopeError(encodingOpts.Envelope)
+	}
+
+	cfg, err := getPubsubSinkConfig(jsonConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	p := &pubsubSink{
-		workerCtx:   ctx,
-		numWorkers:  numOfWorkers,
-		exitWorkers: cancel,
-		format:      formatType,
+		ackCtx:       ctx,
+		stopAcks:     cancel,
+		format:       formatType,
+		flowControl:  cfg.FlowControl,
+		traceContext: encodingOpts.TraceContext,
 	}
 
 	// creates custom pubsub object based on scheme
@@ -240,16 +365,25 @@ func MakePubsubSink(
 		} else {
 			endpoint = gcpEndpointForRegion(region)
 		}
-		tn, err := MakeTopicNamer(targets, WithSingleName(pubsubTopicName))
+		proxyURL, err := parseProxyURL(changefeedbase.SinkParamProxyURL,
+			pubsubURL.consumeParam(changefeedbase.SinkParamProxyURL))
+		if err != nil {
+			return nil, err
+		}
+		tn, err := MakeTopicNamer(targets,
+			append(familyTopicNameOptions(encodingOpts), WithSingleName(pubsubTopicName))...)
 		if err != nil {
 			return nil, err
 		}
 		g := &gcpPubsubClient{
-			topicNamer: tn,
-			ctx:        ctx,
-			projectID:  projectID,
-			endpoint:   endpoint,
-			url:        pubsubURL,
+			topicNamer:      tn,
+			ctx:             ctx,
+			projectID:       projectID,
+			endpoint:        endpoint,
+			url:             pubsubURL,
+			proxyURL:        proxyURL,
+			publishSettings: cfg.publishSettings(),
+			skipCredentials: skipCredentials,
 		}
 		p.client = g
 		p.topicNamer = tn
@@ -259,12 +393,28 @@ func MakePubsubSink(
 	}
 }
 
+// setClientPool implements the pooledClientSink interface.
+func (p *pubsubSink) setClientPool(pool *sinkClientPool, sv *settings.Values) {
+	if g, ok := p.client.(*gcpPubsubClient); ok {
+		g.clientPool, g.sv = pool, sv
+	}
+}
+
 func (p *pubsubSink) Dial() error {
-	p.setupWorkers()
+	p.startAckLoop()
 	return p.client.init()
 }
 
-// EmitRow pushes a message to event channel where it is consumed by workers
+// startAckLoop starts the goroutine waiting for the acknowledgement of
+// published messages.
+func (p *pubsubSink) startAckLoop() {
+	p.ackCh = make(chan pendingPubsubMessage, pubsubAckBufferSize)
+	p.ackGroup = ctxgroup.WithContext(p.ackCtx)
+	p.ackGroup.GoCtx(p.ackLoop)
+}
+
+// EmitRow publishes a message. It blocks while the flow control limits of the
+// sink are exceeded.
 func (p *pubsubSink) EmitRow(
 	ctx context.Context,
 	topic TopicDescriptor,
@@ -277,28 +427,127 @@ func (p *pubsubSink) EmitRow(
 	if err != nil {
 		return err
 	}
-	m := pubsubMessage{
-		alloc: alloc, isFlush: false, message: payload{
+
+	var content []byte
+	switch p.format {
+	case changefeedbase.OptFormatJSON:
+		content, err = json.Marshal(jsonPayload{
 			Key:   key,
 			Value: value,
 			Topic: topicName,
-		}}
+		})
+		if err != nil {
+			return err
+		}
+	case changefeedbase.OptFormatCSV:
+		content = value
+	}
 
-	// calculate index by hashing key
-	i := p.workerIndex(key)
+	if err := p.acquire(ctx, len(content)); err != nil {
+		return err
+	}
+	var attributes map[string]string
+	if p.traceContext {
+		if tp := traceParent(ctx); tp != `` {
+			attributes = map[string]string{traceParentHeader: tp}
+		}
+	}
+	// Messages with the same ordering key are delivered in the order they're
+	// published.
+	result, err := p.client.publish(ctx, content, topicName, string(key), attributes)
+	if err != nil {
+		alloc.Release(ctx)
+		p.acknowledged(len(content), nil)
+		return err
+	}
+	m := pendingPubsubMessage{result: result, size: len(content), alloc: alloc}
 	select {
-	// check the sink context in case workers have been terminated
-	case <-p.workerCtx.Done():
-		// check again for error in case it triggered since last check
-		// will return more verbose error instead of "context canceled"
-		return errors.CombineErrors(p.workerCtx.Err(), p.sinkErrorLocked())
 	case <-ctx.Done():
+		alloc.Release(ctx)
+		p.acknowledged(m.size, nil)
 		return ctx.Err()
-	case err := <-p.errChan:
-		return err
-	case p.eventsChans[i] <- m:
+	case p.ackCh <- m:
+		return nil
+	}
+}
+
+// acquire blocks until a message of the given size is within the flow control
+// limits of the sink, and accounts for it as inflight. A message larger than
+// the byte limit is let through once no other messages are inflight.
+func (p *pubsubSink) acquire(ctx context.Context, size int) error {
+	for {
+		p.mu.Lock()
+		if p.mu.publishErr != nil {
+			defer p.mu.Unlock()
+			return p.mu.publishErr
+		}
+		if p.mu.inflight == 0 || (p.mu.inflight < p.flowControl.Messages &&
+			p.mu.inflightBytes+size <= p.flowControl.Bytes) {
+			p.mu.inflight++
+			p.mu.inflightBytes += size
+			p.mu.Unlock()
+			return nil
+		}
+		ackedCh := p.ackedChLocked()
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.ackCtx.Done():
+			return p.ackCtx.Err()
+		case <-ackedCh:
+		}
+	}
+}
+
+// ackLoop waits for the acknowledgement of each published message, in the
+// order the messages were published.
+func (p *pubsubSink) ackLoop(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m := <-p.ackCh:
+			_, err := m.result.Get(ctx)
+			m.alloc.Release(ctx)
+			p.acknowledged(m.size, err)
+		}
+	}
+}
+
+// acknowledged records that a message of the given size is no longer inflight,
+// because Pub/Sub acknowledged it or because publishing it failed with the
+// given error.
+func (p *pubsubSink) acknowledged(size int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mu.inflight--
+	p.mu.inflightBytes -= size
+	if err != nil && p.mu.publishErr == nil {
+		p.mu.publishErr = err
+	}
+	if p.mu.ackedCh != nil {
+		close(p.mu.ackedCh)
+		p.mu.ackedCh = nil
 	}
-	return nil
+}
+
+// BufferedBytes implements the BufferingSink interface. Messages are buffered
+// from when they are published until Pub/Sub acknowledges them.
+func (p *pubsubSink) BufferedBytes() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return int64(p.mu.inflightBytes)
+}
+
+// ackedChLocked returns a channel which is closed once the next message is
+// acknowledged.
+func (p *pubsubSink) ackedChLocked() chan struct{} {
+	if p.mu.ackedCh == nil {
+		p.mu.ackedCh = make(chan struct{})
+	}
+	return p.mu.ackedCh
 }
 
 // EmitResolvedTimestamp sends resolved timestamp message
@@ -313,7 +562,7 @@ func (p *pubsubSink) EmitResolvedTimestamp(
 	return p.client.sendMessageToAllTopics(payload)
 }
 
-// Flush blocks until all messages in the event channels are sent
+// Flush blocks until Pub/Sub has acknowledged every message emitted before it.
 func (p *pubsubSink) Flush(ctx context.Context) error {
 	if err := p.flush(ctx); err != nil {
 		return errors.CombineErrors(p.client.connectivityErrorLocked(), err)
@@ -322,45 +571,35 @@ func (p *pubsubSink) Flush(ctx context.Context) error {
 }
 
 func (p *pubsubSink) flush(ctx context.Context) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-p.errChan:
-		return err
-	default:
-		err := p.flushWorkers()
-		if err != nil {
-			return err
+	// Publish the batches of the topics without waiting for their delay
+	// threshold.
+	p.client.flushTopics()
+
+	for {
+		p.mu.Lock()
+		if p.mu.inflight == 0 || p.mu.publishErr != nil {
+			defer p.mu.Unlock()
+			return p.mu.publishErr
 		}
-	}
+		ackedCh := p.ackedChLocked()
+		p.mu.Unlock()
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-p.errChan:
-		return err
-	case <-p.flushDone:
-		return p.sinkErrorLocked()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.ackCtx.Done():
+			return p.ackCtx.Err()
+		case <-ackedCh:
+		}
 	}
-
 }
 
-// Close closes all the channels and shutdowns the topic
+// Close stops the topics, which publishes their remaining messages, and
+// stops waiting for acknowledgements.
 func (p *pubsubSink) Close() error {
 	p.client.closeTopics()
-	p.exitWorkers()
-	_ = p.workerGroup.Wait()
-	if p.errChan != nil {
-		close(p.errChan)
-	}
-	if p.flushDone != nil {
-		close(p.flushDone)
-	}
-	for i := 0; i < p.numWorkers; i++ {
-		if p.eventsChans[i] != nil {
-			close(p.eventsChans[i])
-		}
-	}
+	p.stopAcks()
+	_ = p.ackGroup.Wait()
 	return nil
 }
 
@@ -397,143 +636,80 @@ func (p *gcpPubsubClient) getTopicClient(name string) (*pubsub.Topic, error) {
 	return topic, nil
 }
 
-// setupWorkers sets up the channels used by the sink and starts a goroutine for every worker
-func (p *pubsubSink) setupWorkers() {
-	// setup events channels to send to workers and the worker group
-	p.eventsChans = make([]chan pubsubMessage, p.numWorkers)
-	p.workerGroup = ctxgroup.WithContext(p.workerCtx)
-
-	// an error channel with buffer for the first error.
-	p.errChan = make(chan error, 1)
-
-	// flushDone notified when flush completes.
-	p.flushDone = make(chan struct{}, 1)
-
-	for i := 0; i < p.numWorkers; i++ {
-		//initialize worker goroutine and channel for worker
-		p.eventsChans[i] = make(chan pubsubMessage)
-		j := i
-		p.workerGroup.GoCtx(func(ctx context.Context) error {
-			p.workerLoop(j)
-			return nil
-		})
-	}
-}
-
-// workerLoop consumes any message sent to the channel corresponding to the worker index
-func (p *pubsubSink) workerLoop(workerIndex int) {
-	for {
-		select {
-		case <-p.workerCtx.Done():
-			return
-		case msg := <-p.eventsChans[workerIndex]:
-			if msg.isFlush {
-				// Signals a flush request, makes sure that the messages in eventsChans are finished sending
-				continue
-			}
-
-			var content []byte
-			var err error
-			switch p.format {
-			case changefeedbase.OptFormatJSON:
-				content, err = json.Marshal(jsonPayload{
-					Key:   msg.message.Key,
-					Value: msg.message.Value,
-					Topic: msg.message.Topic,
-				})
-				if err != nil {
-					p.exitWorkersWithError(err)
-				}
-			case changefeedbase.OptFormatCSV:
-				content = msg.message.Value
-			}
-
-			err = p.client.sendMessage(content, msg.message.Topic, string(msg.message.Key))
-			if err != nil {
-				p.exitWorkersWithError(err)
-			}
-			msg.alloc.Release(p.workerCtx)
+// init opens a gcp client, or acquires the one it shares with the other
+// sinks of its client pool.
+func (p *gcpPubsubClient) init() error {
+	if p.clientPool == nil {
+		client, err := p.dial(p.ctx)
+		if err != nil {
+			return err
 		}
+		p.client = client
+		p.mu.topics = make(map[string]*pubsub.Topic)
+		return nil
 	}
-}
 
-// exitWorkersWithError sends an error to the sink error channel
-func (p *pubsubSink) exitWorkersWithError(err error) {
-	// errChan has buffer size 1, first error will be saved to the buffer and
-	// subsequent errors will be ignored
-	select {
-	case p.errChan <- err:
-		p.exitWorkers()
-	default:
+	// The region and proxy of the sink were consumed from its URI, which
+	// still holds its credentials.
+	var proxy string
+	if p.proxyURL != nil {
+		proxy = p.proxyURL.String()
 	}
-}
-
-// sinkError checks if there is an error in the error channel
-func (p *pubsubSink) sinkErrorLocked() error {
-	select {
-	case err := <-p.errChan:
+	key := sinkClientKey(GcpScheme, p.projectID, p.endpoint, proxy, p.url.URL.String())
+	c, release, err := p.clientPool.acquire(p.ctx, p.sv, key,
+		func() (io.Closer, error) {
+			// The client outlives the sink which dialed it, so it's dialed with a
+			// context which isn't canceled along with the sink.
+			client, err := p.dial(logtags.WithTags(context.Background(), logtags.FromContext(p.ctx)))
+			if err != nil {
+				return nil, err
+			}
+			return client, nil
+		})
+	if err != nil {
 		return err
-	default:
 	}
+	p.client, p.releaseClient = c.(*pubsub.Client), release
+	p.mu.topics = make(map[string]*pubsub.Topic)
 	return nil
 }
 
-// workerIndex hashes key to return a worker index
-func (p *pubsubSink) workerIndex(key []byte) uint32 {
-	return crc32.ChecksumIEEE(key) % uint32(p.numWorkers)
-}
-
-// flushWorkers sends a flush message to every worker channel and then signals sink that flush is done
-func (p *pubsubSink) flushWorkers() error {
-	for i := 0; i < p.numWorkers; i++ {
-		//flush message will be blocked until all the messages in the channel are processed
-		select {
-		case <-p.workerCtx.Done():
-			return p.workerCtx.Err()
-		case p.eventsChans[i] <- pubsubMessage{isFlush: true}:
+// dial opens a gcp client.
+func (p *gcpPubsubClient) dial(ctx context.Context) (*pubsub.Client, error) {
+	// When the emulator is in use, the client library configures itself to
+	// connect to it without authentication. Passing credentials or an
+	// endpoint would override that configuration, so tests against the
+	// emulator skip them.
+	var opts []option.ClientOption
+	if !p.skipCredentials {
+		credsCtx := ctx
+		if p.proxyURL != nil {
+			// Both the gRPC connections publishing messages and the HTTP requests
+			// fetching access tokens for the credentials go through the proxy.
+			dial, err := proxyDialFunc(p.proxyURL)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, option.WithGRPCDialOption(grpc.WithContextDialer(dial)))
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			setTransportProxy(transport, p.proxyURL)
+			credsCtx = context.WithValue(credsCtx, oauth2.HTTPClient, &http.Client{Transport: transport})
 		}
+		creds, err := getGCPCredentials(credsCtx, p.url)
+		if err != nil {
+			return nil, err
+		}
+		// Sending messages to the same region ensures they are received in order
+		// even when multiple publishers are used.
+		// region can be changed from query parameter to config option
+		opts = append(opts, creds, option.WithEndpoint(p.endpoint))
 	}
 
-	// flush messages within topic
-	p.client.flushTopics()
-
-	select {
-	// signals sink that flush is complete
-	case <-p.workerCtx.Done():
-		return p.workerCtx.Err()
-	case p.flushDone <- struct{}{}:
-		return nil
-	}
-}
-
-// init opens a gcp client
-func (p *gcpPubsubClient) init() error {
-	var client *pubsub.Client
-	var err error
-
-	creds, err := getGCPCredentials(p.ctx, p.url)
-	if err != nil {
-		return err
-	}
-	// Sending messages to the same region ensures they are received in order
-	// even when multiple publishers are used.
-	// region can be changed from query parameter to config option
-
-	client, err = pubsub.NewClient(
-		p.ctx,
-		p.projectID,
-		creds,
-		option.WithEndpoint(p.endpoint),
-	)
-
+	client, err := pubsub.NewClient(ctx, p.projectID, opts...)
 	if err != nil {
-		return errors.Wrap(err, "opening client")
+		return nil, errors.Wrap(err, "opening client")
 	}
-	p.client = client
-	p.mu.topics = make(map[string]*pubsub.Topic)
-
-	return nil
-
+	return client, nil
 }
 
 // openTopic optimistically creates the topic
@@ -554,6 +730,7 @@ func (p *gcpPubsubClient) openTopic(topicName string) (*pubsub.Topic, error) {
 		}
 	}
 	t.EnableMessageOrdering = true
+	t.PublishSettings = p.publishSettings
 	return t, nil
 }
 
@@ -562,41 +739,66 @@ func (p *gcpPubsubClient) closeTopics() {
 		t.Stop()
 		return nil
 	})
+	// A shared client is released along with its topics, and closed once no
+	// sink uses it.
+	if p.releaseClient != nil {
+		_ = p.releaseClient()
+	}
 }
 
-// sendMessage sends a message to the topic
-func (p *gcpPubsubClient) sendMessage(m []byte, topic string, key string) error {
+// publish publishes a message to the topic, which the topic batches with the
+// other messages published to it.
+func (p *gcpPubsubClient) publish(
+	ctx context.Context, m []byte, topic string, key string, attributes map[string]string,
+) (pubsubPublishResult, error) {
 	t, err := p.getTopicClient(topic)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	res := t.Publish(p.ctx, &pubsub.Message{
-		Data:        m,
-		OrderingKey: key,
-	})
-
-	// The Get method blocks until a server-generated ID or
-	// an error is returned for the published message.
-	_, err = res.Get(p.ctx)
+	return recordingPublishResult{
+		PublishResult: t.Publish(ctx, &pubsub.Message{
+			Data:        m,
+			OrderingKey: key,
+			Attributes:  attributes,
+		}),
+		client: p,
+	}, nil
+}
+
+// recordingPublishResult records the errors publishing messages for
+// connectivityErrorLocked.
+type recordingPublishResult struct {
+	*pubsub.PublishResult
+	client *gcpPubsubClient
+}
+
+// Get implements the pubsubPublishResult interface.
+func (r recordingPublishResult) Get(ctx context.Context) (string, error) {
+	id, err := r.PublishResult.Get(ctx)
 	if err != nil {
-		p.recordPublishErrorLocked(err)
-		return err
+		r.client.recordPublishErrorLocked(err)
 	}
-
-	return nil
+	return id, err
 }
 
+// sendMessageToAllTopics publishes a message to every topic, and waits for
+// Pub/Sub to acknowledge all of them.
 func (p *gcpPubsubClient) sendMessageToAllTopics(m []byte) error {
-	return p.forEachTopic(func(_ string, t *pubsub.Topic) error {
-		res := t.Publish(p.ctx, &pubsub.Message{
+	var results []*pubsub.PublishResult
+	if err := p.forEachTopic(func(_ string, t *pubsub.Topic) error {
+		results = append(results, t.Publish(p.ctx, &pubsub.Message{
 			Data: m,
-		})
-		_, err := res.Get(p.ctx)
-		if err != nil {
+		}))
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, res := range results {
+		if _, err := res.Get(p.ctx); err != nil {
 			return errors.Wrap(err, "emitting resolved timestamp")
 		}
-		return nil
-	})
+	}
+	return nil
 }
 
 func (p *gcpPubsubClient) flushTopics() {
@@ -0,0 +1,163 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubsubSinkConfigParsing(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	t.Run("defaults returned if not option set", func(t *testing.T) {
+		cfg, err := getPubsubSinkConfig(``)
+		require.NoError(t, err)
+		require.Equal(t, pubsubSinkConfig{
+			FlowControl: pubsubFlowControlConfig{
+				Messages: defaultPubsubMaxOutstandingMessages,
+				Bytes:    defaultPubsubMaxOutstandingBytes,
+			},
+		}, cfg)
+	})
+	t.Run("options overlay defaults", func(t *testing.T) {
+		cfg, err := getPubsubSinkConfig(
+			`{"Flush": {"Messages": 500, "Frequency": "50ms"}, "FlowControl": {"Messages": 10}}`)
+		require.NoError(t, err)
+		require.Equal(t, pubsubSinkConfig{
+			Flush: batchConfig{Messages: 500, Frequency: jsonDuration(50 * time.Millisecond)},
+			FlowControl: pubsubFlowControlConfig{
+				Messages: 10,
+				Bytes:    defaultPubsubMaxOutstandingBytes,
+			},
+		}, cfg)
+
+		settings := cfg.publishSettings()
+		require.Equal(t, 500, settings.CountThreshold)
+		require.Equal(t, 50*time.Millisecond, settings.DelayThreshold)
+	})
+	t.Run("errors on invalid configuration", func(t *testing.T) {
+		for _, opts := range []changefeedbase.SinkSpecificJSONConfig{
+			`{"Flush": {"Messages": -1}}`,
+			`{"Flush": {"Frequency": "-1s"}}`,
+			`{"FlowControl": {"Bytes": -1}}`,
+			`{"FlowControl": {"Messages": 0}}`,
+		} {
+			_, err := getPubsubSinkConfig(opts)
+			require.Regexp(t, changefeedbase.OptPubsubSinkConfig, err)
+		}
+		_, err := getPubsubSinkConfig(`{"Flush": {"Messages": "10"}}`)
+		require.Regexp(t, `error unmarshalling json`, err)
+	})
+}
+
+// manualPubsubResult is a pubsubPublishResult which is acknowledged, or
+// failed, by sending to ch.
+type manualPubsubResult struct {
+	ch chan error
+}
+
+func (r manualPubsubResult) Get(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case err := <-r.ch:
+		return "", err
+	}
+}
+
+// manualPubsubClient is a fakePubsubClient whose messages are acknowledged
+// by the test.
+type manualPubsubClient struct {
+	fakePubsubClient
+	published chan manualPubsubResult
+}
+
+func (c *manualPubsubClient) publish(
+	_ context.Context, _ []byte, _ string, _ string, _ map[string]string,
+) (pubsubPublishResult, error) {
+	r := manualPubsubResult{ch: make(chan error, 1)}
+	c.published <- r
+	return r, nil
+}
+
+func TestPubsubSinkFlowControl(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	tn, err := MakeTopicNamer(makeChangefeedTargets("t"))
+	require.NoError(t, err)
+	client := &manualPubsubClient{published: make(chan manualPubsubResult, 10)}
+	ackCtx, stopAcks := context.WithCancel(ctx)
+	sink := &pubsubSink{
+		client:      client,
+		topicNamer:  tn,
+		format:      changefeedbase.OptFormatJSON,
+		flowControl: pubsubFlowControlConfig{Messages: 2, Bytes: 1 << 20},
+		ackCtx:      ackCtx,
+		stopAcks:    stopAcks,
+	}
+	sink.startAckLoop()
+	defer func() { require.NoError(t, sink.Close()) }()
+
+	// No inflight
+	require.NoError(t, sink.Flush(ctx))
+
+	var pool testAllocPool
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sink.EmitRow(
+			ctx, topic(`t`), []byte(`1`), []byte(`{}`), zeroTS, zeroTS, pool.alloc()))
+	}
+	r1, r2 := <-client.published, <-client.published
+
+	// The third message exceeds the limit of inflight messages until one of
+	// them is acknowledged, and flushes wait for all of them.
+	emitted := make(chan error, 1)
+	go func() {
+		emitted <- sink.EmitRow(
+			ctx, topic(`t`), []byte(`3`), []byte(`{}`), zeroTS, zeroTS, pool.alloc())
+	}()
+	select {
+	case err := <-emitted:
+		t.Fatalf("expected EmitRow to block, returned %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	require.True(t, errors.Is(sink.Flush(timeoutCtx), context.DeadlineExceeded))
+
+	r1.ch <- nil
+	require.NoError(t, <-emitted)
+	r3 := <-client.published
+
+	// A failed message fails the flush, and every later row.
+	r2.ch <- errors.New("r2")
+	r3.ch <- nil
+	require.Regexp(t, "r2", sink.Flush(ctx))
+	require.Regexp(t, "r2", sink.EmitRow(
+		ctx, topic(`t`), []byte(`4`), []byte(`{}`), zeroTS, zeroTS, zeroAlloc))
+
+	// At the end, all of the resources has been released
+	testutils.SucceedsSoon(t, func() error {
+		if used := pool.used(); used != 0 {
+			return errors.Newf("%d allocations not released", used)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/errors"
+)
+
+// makeSidecarSink returns a sink which emits to a sidecar: a process running
+// alongside each node which receives the rows of changefeeds over a unix
+// socket, using the stream protocol of the cdclib package, and delivers them
+// to a destination which changefeeds don't support themselves.
+//
+// Sidecars are registered by name with the changefeed.sidecar_sinks cluster
+// setting, so that a sidecar://name sink URI can't be used to connect to
+// arbitrary sockets on the nodes of the cluster. As with the stream sink,
+// flushes wait for the sidecar to acknowledge the preceding rows, so the
+// changefeed doesn't checkpoint past rows the sidecar hasn't handled.
+func makeSidecarSink(
+	u sinkURL,
+	sv *settings.Values,
+	jobID jobspb.JobID,
+	targets changefeedbase.Targets,
+	encodingOpts changefeedbase.EncodingOptions,
+	mb metricsRecorderBuilder,
+) (Sink, error) {
+	name := u.Host
+	if name == `` {
+		return nil, errors.Errorf(`must specify the name of the sidecar`)
+	}
+	if u.User != nil || u.Path != `` {
+		return nil, errors.Errorf(`sidecar sink URIs must be of the form %s://name`,
+			changefeedbase.SinkSchemeSidecar)
+	}
+	if unknownParams := u.remainingQueryParams(); len(unknownParams) > 0 {
+		return nil, errors.Errorf(
+			`unknown sidecar sink query parameters: %s`, strings.Join(unknownParams, ", "))
+	}
+
+	sidecars, err := changefeedbase.ParseSidecarSinks(changefeedbase.SidecarSinks.Get(sv))
+	if err != nil {
+		return nil, err
+	}
+	path, ok := sidecars[name]
+	if !ok {
+		return nil, errors.WithHintf(errors.Errorf(`unknown sidecar %s`, name),
+			`sidecars must be registered with the %s cluster setting`, changefeedbase.SidecarSinks.Key())
+	}
+
+	s := &streamSink{
+		network: `unix`,
+		addr:    path,
+		metrics: mb(requiresResourceAccounting),
+	}
+	if err := s.init(jobID, targets, encodingOpts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -11,6 +11,7 @@ package changefeedccl
 import (
 	"context"
 	gosql "database/sql"
+	"encoding/json"
 	"fmt"
 	"hash"
 	"hash/fnv"
@@ -35,6 +36,21 @@ const (
 	)`
 	sqlSinkEmitStmt = `INSERT INTO "%s" (topic, partition, message_id, key, value, resolved)`
 	sqlSinkEmitCols = 6
+	// In history mode, every change is appended to the table, with its MVCC
+	// timestamp and operation, and the rows before and after it. Changes which
+	// are emitted again, e.g. after the changefeed restarts, overwrite the row
+	// they were first emitted as.
+	sqlSinkHistoryCreateTableStmt = `CREATE TABLE IF NOT EXISTS "%s" (
+		topic STRING,
+		key STRING,
+		mvcc_timestamp DECIMAL,
+		op STRING,
+		before JSONB,
+		after JSONB,
+		PRIMARY KEY (topic, key, mvcc_timestamp)
+	)`
+	sqlSinkHistoryEmitStmt = `UPSERT INTO "%s" (topic, key, mvcc_timestamp, op, before, after)`
+	sqlSinkHistoryEmitCols = 6
 	// Some amount of batching to mirror a bit how kafkaSink works.
 	sqlSinkRowBatchSize = 3
 	// While sqlSink is only used for testing, hardcode the number of
@@ -50,6 +66,15 @@ const (
 // table gets 3 partitions. Similar to kafkaSink, the order between two emits is
 // only preserved if they are emitted to by the same node and to the same
 // partition.
+//
+// With history=true, the sink instead maintains an audit log of the changes
+// to the targets of the changefeed in the table, named by table_name, which
+// holds a row for every change, keyed by its topic, key and MVCC timestamp,
+// along with its operation (insert, update, upsert or delete) and the rows
+// before and after it. Changes are inserts or updates rather than upserts if
+// the changefeed emits the previous rows with the diff option. A resolved
+// timestamp is stored as a row of each topic with an empty key and the
+// resolved operation, below which the log of the topic is complete.
 type sqlSink struct {
 	db *gosql.DB
 
@@ -58,6 +83,11 @@ type sqlSink struct {
 	topicNamer *TopicNamer
 	hasher     hash.Hash32
 
+	// history is set if the sink appends every change to the table, and
+	// diff if the changes carry the rows before them.
+	history bool
+	diff    bool
+
 	rowBuf  []interface{}
 	scratch bufalloc.ByteAllocator
 
@@ -73,7 +103,11 @@ func (s *sqlSink) getConcreteType() sinkType {
 const sqlSinkTableName = `sqlsink`
 
 func makeSQLSink(
-	u sinkURL, tableName string, targets changefeedbase.Targets, mb metricsRecorderBuilder,
+	u sinkURL,
+	tableName string,
+	targets changefeedbase.Targets,
+	encodingOpts changefeedbase.EncodingOptions,
+	mb metricsRecorderBuilder,
 ) (Sink, error) {
 	// Swap the changefeed prefix for the sql connection one that sqlSink
 	// expects.
@@ -83,11 +117,30 @@ func makeSQLSink(
 		return nil, errors.Errorf(`must specify database`)
 	}
 
-	topicNamer, err := MakeTopicNamer(targets)
+	topicNamer, err := MakeTopicNamer(targets, familyTopicNameOptions(encodingOpts)...)
 	if err != nil {
 		return nil, err
 	}
 
+	var history bool
+	if _, err := u.consumeBool(changefeedbase.SinkParamSQLHistory, &history); err != nil {
+		return nil, err
+	}
+	if name := u.consumeParam(changefeedbase.SinkParamSQLTableName); name != `` {
+		tableName = name
+	}
+	if history {
+		if encodingOpts.Format != changefeedbase.OptFormatJSON {
+			return nil, errors.Errorf(`%s=true requires %s=%s`,
+				changefeedbase.SinkParamSQLHistory, changefeedbase.OptFormat, changefeedbase.OptFormatJSON)
+		}
+		if encodingOpts.Envelope != changefeedbase.OptEnvelopeWrapped {
+			return nil, errors.Errorf(`%s=true requires %s=%s`,
+				changefeedbase.SinkParamSQLHistory, changefeedbase.OptEnvelope, changefeedbase.OptEnvelopeWrapped)
+		}
+	}
+
+	// The parameters of the sink are left out of the connection URI.
 	uri := u.String()
 	u.consumeParam(`sslcert`)
 	u.consumeParam(`sslkey`)
@@ -104,6 +157,8 @@ func makeSQLSink(
 		tableName:  tableName,
 		topicNamer: topicNamer,
 		hasher:     fnv.New32a(),
+		history:    history,
+		diff:       encodingOpts.Diff,
 		metrics:    mb(noResourceAccounting),
 	}, nil
 }
@@ -113,7 +168,11 @@ func (s *sqlSink) Dial() error {
 	if err != nil {
 		return err
 	}
-	if _, err := db.Exec(fmt.Sprintf(sqlSinkCreateTableStmt, s.tableName)); err != nil {
+	createTableStmt := sqlSinkCreateTableStmt
+	if s.history {
+		createTableStmt = sqlSinkHistoryCreateTableStmt
+	}
+	if _, err := db.Exec(fmt.Sprintf(createTableStmt, s.tableName)); err != nil {
 		db.Close()
 		return err
 	}
@@ -136,6 +195,9 @@ func (s *sqlSink) EmitRow(
 	if err != nil {
 		return err
 	}
+	if s.history {
+		return s.emitChange(ctx, topic, key, value, mvcc)
+	}
 
 	// Hashing logic copied from sarama.HashPartitioner.
 	s.hasher.Reset()
@@ -157,6 +219,13 @@ func (s *sqlSink) EmitResolvedTimestamp(
 ) error {
 	defer s.metrics.recordResolvedCallback()()
 
+	if s.history {
+		return s.topicNamer.Each(func(topic string) error {
+			return s.appendRow(ctx, sqlSinkHistoryEmitCols,
+				topic, ``, sqlSinkTimestamp(resolved), `resolved`, nil, nil)
+		})
+	}
+
 	var noKey, noValue []byte
 	return s.topicNamer.Each(func(topic string) error {
 		payload, err := encoder.EncodeResolvedTimestamp(ctx, topic, resolved)
@@ -186,8 +255,57 @@ func (s *sqlSink) emit(
 	// (two messages are only guaranteed to keep their order if emitted from the
 	// same producer to the same partition).
 	messageID := builtins.GenerateUniqueInt(builtins.ProcessUniqueID(partition))
-	s.rowBuf = append(s.rowBuf, topic, partition, messageID, key, value, resolved)
-	if len(s.rowBuf)/sqlSinkEmitCols >= sqlSinkRowBatchSize {
+	return s.appendRow(ctx, sqlSinkEmitCols, topic, partition, messageID, key, value, resolved)
+}
+
+// emitChange appends a change, with its operation and the rows before and
+// after it, to the table of a sink in history mode.
+func (s *sqlSink) emitChange(
+	ctx context.Context, topic string, key, value []byte, mvcc hlc.Timestamp,
+) error {
+	var msg struct {
+		After  json.RawMessage `json:"after"`
+		Before json.RawMessage `json:"before"`
+	}
+	if err := json.Unmarshal(value, &msg); err != nil {
+		return errors.Wrap(err, `decoding change`)
+	}
+	isNull := func(row json.RawMessage) bool {
+		return len(row) == 0 || string(row) == `null`
+	}
+	var op string
+	switch {
+	case isNull(msg.After):
+		op = `delete`
+	case !isNull(msg.Before):
+		op = `update`
+	case s.diff:
+		op = `insert`
+	default:
+		op = `upsert`
+	}
+	var before, after interface{}
+	if !isNull(msg.Before) {
+		before = string(msg.Before)
+	}
+	if !isNull(msg.After) {
+		after = string(msg.After)
+	}
+	return s.appendRow(ctx, sqlSinkHistoryEmitCols,
+		topic, string(key), sqlSinkTimestamp(mvcc), op, before, after)
+}
+
+// sqlSinkTimestamp returns ts as a decimal, without the marker of synthetic
+// timestamps AsOfSystemTime adds.
+func sqlSinkTimestamp(ts hlc.Timestamp) string {
+	return hlc.Timestamp{WallTime: ts.WallTime, Logical: ts.Logical}.AsOfSystemTime()
+}
+
+// appendRow buffers a row of the table, which has numCols columns, flushing
+// the buffered rows once there are enough of them.
+func (s *sqlSink) appendRow(ctx context.Context, numCols int, row ...interface{}) error {
+	s.rowBuf = append(s.rowBuf, row...)
+	if len(s.rowBuf)/numCols >= sqlSinkRowBatchSize {
 		return s.Flush(ctx)
 	}
 	return nil
@@ -201,12 +319,16 @@ func (s *sqlSink) Flush(ctx context.Context) error {
 		return nil
 	}
 
+	emitStmt, numCols := sqlSinkEmitStmt, sqlSinkEmitCols
+	if s.history {
+		emitStmt, numCols = sqlSinkHistoryEmitStmt, sqlSinkHistoryEmitCols
+	}
 	var stmt strings.Builder
-	fmt.Fprintf(&stmt, sqlSinkEmitStmt, s.tableName)
+	fmt.Fprintf(&stmt, emitStmt, s.tableName)
 	for i := 0; i < len(s.rowBuf); i++ {
 		if i == 0 {
 			stmt.WriteString(` VALUES (`)
-		} else if i%sqlSinkEmitCols == 0 {
+		} else if i%numCols == 0 {
 			stmt.WriteString(`),(`)
 		} else {
 			stmt.WriteString(`,`)
@@ -0,0 +1,375 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdclib"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// streamSinkTimeout bounds dialing the adapter and writing frames to it.
+	streamSinkTimeout = 10 * time.Second
+	// streamSinkAckTimeout bounds waiting for the adapter to acknowledge a
+	// flush, which may require it to checkpoint its own state.
+	streamSinkAckTimeout = time.Minute
+)
+
+// streamSink sends the rows and resolved timestamps of a changefeed to the
+// source adapter of a streaming engine, such as Apache Flink or Kafka
+// Connect, using the stream protocol of the cdclib package.
+//
+// Each sink opens a single connection, which the adapter sees as a split of
+// the changefeed. Flushing the sink waits for the adapter to acknowledge the
+// frames sent on it, so that the changefeed doesn't checkpoint past rows the
+// adapter hasn't handled.
+type streamSink struct {
+	// network and addr are the address of the adapter, which is dialed over
+	// tcp, or over unix for sidecar sinks.
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	hello     cdclib.Hello
+
+	topicNamer *TopicNamer
+	// schemas is the table version of each topic most recently announced to
+	// the adapter.
+	schemas map[TopicIdentifier]descpb.DescriptorVersion
+	streamSchemas
+
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	seq  uint64
+
+	metrics metricsRecorder
+}
+
+var _ Sink = (*streamSink)(nil)
+var _ SchemaDescribingSink = (*streamSink)(nil)
+
+// streamSchemas holds the columns of the most recent version of the table of
+// each topic described by the changefeed, which the sinks writing the frames of
+// the stream protocol announce along with the version.
+type streamSchemas struct {
+	mu struct {
+		syncutil.Mutex
+		columns map[TopicIdentifier]streamColumns
+	}
+}
+
+// streamColumns are the columns of a table version.
+type streamColumns struct {
+	version descpb.DescriptorVersion
+	columns []cdclib.Column
+}
+
+func makeStreamSink(
+	u sinkURL,
+	jobID jobspb.JobID,
+	targets changefeedbase.Targets,
+	encodingOpts changefeedbase.EncodingOptions,
+	mb metricsRecorderBuilder,
+) (Sink, error) {
+	if u.Host == `` {
+		return nil, errors.Errorf(`must specify the address of the stream adapter`)
+	}
+	if u.User != nil {
+		return nil, errors.Errorf(`stream sink does not support authentication`)
+	}
+
+	var tlsEnabled, tlsSkipVerify bool
+	var caCert, clientCert, clientKey []byte
+	if _, err := u.consumeBool(changefeedbase.SinkParamTLSEnabled, &tlsEnabled); err != nil {
+		return nil, err
+	}
+	if _, err := u.consumeBool(changefeedbase.SinkParamSkipTLSVerify, &tlsSkipVerify); err != nil {
+		return nil, err
+	}
+	if err := u.decodeBase64(changefeedbase.SinkParamCACert, &caCert); err != nil {
+		return nil, err
+	}
+	if err := u.decodeBase64(changefeedbase.SinkParamClientCert, &clientCert); err != nil {
+		return nil, err
+	}
+	if err := u.decodeBase64(changefeedbase.SinkParamClientKey, &clientKey); err != nil {
+		return nil, err
+	}
+
+	s := &streamSink{
+		network: `tcp`,
+		addr:    u.Host,
+		metrics: mb(requiresResourceAccounting),
+	}
+
+	if tlsEnabled {
+		s.tlsConfig = &tls.Config{
+			InsecureSkipVerify: tlsSkipVerify,
+		}
+		if caCert != nil {
+			caCertPool := x509.NewCertPool()
+			if !caCertPool.AppendCertsFromPEM(caCert) {
+				return nil, errors.Errorf(`invalid %s`, changefeedbase.SinkParamCACert)
+			}
+			s.tlsConfig.RootCAs = caCertPool
+		}
+		if (clientCert == nil) != (clientKey == nil) {
+			return nil, errors.Errorf(`%s and %s must be provided together`,
+				changefeedbase.SinkParamClientCert, changefeedbase.SinkParamClientKey)
+		}
+		if clientCert != nil {
+			cert, err := tls.X509KeyPair(clientCert, clientKey)
+			if err != nil {
+				return nil, errors.Wrap(err, `invalid client certificate data provided`)
+			}
+			s.tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	} else {
+		if caCert != nil {
+			return nil, errors.Errorf(`%s requires %s=true`,
+				changefeedbase.SinkParamCACert, changefeedbase.SinkParamTLSEnabled)
+		}
+		if clientCert != nil {
+			return nil, errors.Errorf(`%s requires %s=true`,
+				changefeedbase.SinkParamClientCert, changefeedbase.SinkParamTLSEnabled)
+		}
+	}
+
+	if unknownParams := u.remainingQueryParams(); len(unknownParams) > 0 {
+		return nil, errors.Errorf(
+			`unknown stream sink query parameters: %s`, strings.Join(unknownParams, ", "))
+	}
+
+	if err := s.init(jobID, targets, encodingOpts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// init sets up the topics of the sink and the split it assigns to the
+// adapter.
+func (s *streamSink) init(
+	jobID jobspb.JobID, targets changefeedbase.Targets, encodingOpts changefeedbase.EncodingOptions,
+) error {
+	var err error
+	if s.topicNamer, err = MakeTopicNamer(targets, familyTopicNameOptions(encodingOpts)...); err != nil {
+		return err
+	}
+	s.schemas = make(map[TopicIdentifier]descpb.DescriptorVersion)
+	s.hello = cdclib.Hello{
+		Version: cdclib.ProtocolVersion,
+		Split: cdclib.Split{
+			JobID:  int64(jobID),
+			Topics: s.topicNamer.DisplayNamesSlice(),
+		},
+		Format:   string(encodingOpts.Format),
+		Envelope: string(encodingOpts.Envelope),
+	}
+	return nil
+}
+
+func (s *streamSink) getConcreteType() sinkType {
+	return sinkTypeStream
+}
+
+// Dial implements the Sink interface.
+func (s *streamSink) Dial() error {
+	dialer := &net.Dialer{Timeout: streamSinkTimeout}
+	var conn net.Conn
+	var err error
+	if s.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, s.network, s.addr, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(s.network, s.addr)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+	s.w = bufio.NewWriter(conn)
+
+	// Every connection is a new split, even if the sink is redialed.
+	s.hello.Split.ID = uuid.MakeV4().String()
+	for id := range s.schemas {
+		delete(s.schemas, id)
+	}
+	if err := s.write(s.hello); err != nil {
+		_ = s.Close()
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		_ = s.Close()
+		return errors.Wrapf(err, `assigning split to %s`, s.addr)
+	}
+	return nil
+}
+
+// Topics gives the names of all topics that have been initialized
+// and will receive resolved timestamps.
+func (s *streamSink) Topics() []string {
+	return s.topicNamer.DisplayNamesSlice()
+}
+
+// DescribeSchema implements the SchemaDescribingSink interface.
+func (s *streamSchemas) DescribeSchema(
+	topic TopicDescriptor, keyCols, valueCols []cdcevent.ResultColumn,
+) {
+	columns := make([]cdclib.Column, 0, len(keyCols)+len(valueCols))
+	isKey := make(map[string]struct{}, len(keyCols))
+	for _, col := range keyCols {
+		isKey[col.Name] = struct{}{}
+		columns = append(columns, cdclib.Column{Name: col.Name, Type: col.Typ.SQLString(), PrimaryKey: true})
+	}
+	for _, col := range valueCols {
+		if _, ok := isKey[col.Name]; !ok {
+			columns = append(columns, cdclib.Column{Name: col.Name, Type: col.Typ.SQLString()})
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mu.columns == nil {
+		s.mu.columns = make(map[TopicIdentifier]streamColumns)
+	}
+	s.mu.columns[topic.GetTopicIdentifier()] = streamColumns{version: topic.GetVersion(), columns: columns}
+}
+
+// columnsOf returns the columns of the table version of the topic, if the
+// changefeed has described them.
+func (s *streamSchemas) columnsOf(topic TopicDescriptor) []cdclib.Column {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.mu.columns[topic.GetTopicIdentifier()]; ok && c.version == topic.GetVersion() {
+		return c.columns
+	}
+	return nil
+}
+
+// EmitRow implements the Sink interface.
+func (s *streamSink) EmitRow(
+	ctx context.Context,
+	topic TopicDescriptor,
+	key, value []byte,
+	updated, mvcc hlc.Timestamp,
+	alloc kvevent.Alloc,
+) error {
+	defer alloc.Release(ctx)
+	defer s.metrics.recordOneMessage()(mvcc, len(key)+len(value), sinkDoesNotCompress)
+
+	name, err := s.topicNamer.Name(topic)
+	if err != nil {
+		return err
+	}
+	id := topic.GetTopicIdentifier()
+	if version, ok := s.schemas[id]; !ok || version != topic.GetVersion() {
+		if err := s.write(cdclib.Schema{
+			Topic:    name,
+			TableID:  uint32(id.TableID),
+			FamilyID: uint32(id.FamilyID),
+			Version:  uint32(topic.GetVersion()),
+			Columns:  s.columnsOf(topic),
+		}); err != nil {
+			return err
+		}
+		s.schemas[id] = topic.GetVersion()
+	}
+	return s.write(cdclib.Row{
+		Topic:   name,
+		Key:     key,
+		Value:   value,
+		Updated: streamTimestamp(updated),
+		MVCC:    streamTimestamp(mvcc),
+	})
+}
+
+// EmitResolvedTimestamp implements the Sink interface. The resolved timestamp
+// is sent as a watermark, and isn't encoded.
+func (s *streamSink) EmitResolvedTimestamp(
+	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
+) error {
+	defer s.metrics.recordResolvedCallback()()
+	if err := s.write(cdclib.Watermark{Resolved: streamTimestamp(resolved)}); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// Flush implements the Sink interface.
+func (s *streamSink) Flush(ctx context.Context) error {
+	defer s.metrics.recordFlushRequestCallback()()
+	return s.flush()
+}
+
+// flush sends a flush frame and waits for the adapter to acknowledge it.
+func (s *streamSink) flush() error {
+	s.seq++
+	if err := s.write(cdclib.Flush{Seq: s.seq}); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if err := s.conn.SetReadDeadline(timeutil.Now().Add(streamSinkAckTimeout)); err != nil {
+		return err
+	}
+	for {
+		msg, err := cdclib.ReadMessage(s.r)
+		if err != nil {
+			return errors.Wrapf(err, `waiting for %s to acknowledge flush`, s.addr)
+		}
+		ack, ok := msg.(cdclib.Ack)
+		if !ok || ack.Seq != s.seq {
+			continue
+		}
+		if ack.Error != `` {
+			return errors.Newf(`%s failed to acknowledge flush: %s`, s.addr, ack.Error)
+		}
+		return nil
+	}
+}
+
+// write buffers a frame to be sent to the adapter.
+func (s *streamSink) write(m cdclib.Message) error {
+	if err := s.conn.SetWriteDeadline(timeutil.Now().Add(streamSinkTimeout)); err != nil {
+		return err
+	}
+	return cdclib.WriteMessage(s.w, m)
+}
+
+// Close implements the Sink interface.
+func (s *streamSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func streamTimestamp(ts hlc.Timestamp) cdclib.Timestamp {
+	return cdclib.Timestamp{WallTime: ts.WallTime, Logical: ts.Logical}
+}
@@ -0,0 +1,268 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdclib"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/colinfo"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingStreamHandler records the messages received by a cdclib.Source.
+type recordingStreamHandler struct {
+	mu struct {
+		syncutil.Mutex
+		splits         []cdclib.Hello
+		messages       []string
+		failCheckpoint bool
+	}
+}
+
+func (h *recordingStreamHandler) record(format string, args ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mu.messages = append(h.mu.messages, fmt.Sprintf(format, args...))
+}
+
+func (h *recordingStreamHandler) AssignSplit(_ context.Context, hello cdclib.Hello) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mu.splits = append(h.mu.splits, hello)
+	return nil
+}
+
+func (h *recordingStreamHandler) Schema(_ context.Context, _ cdclib.Split, s cdclib.Schema) error {
+	if len(s.Columns) == 0 {
+		h.record(`schema %s@%d`, s.Topic, s.Version)
+		return nil
+	}
+	cols := make([]string, len(s.Columns))
+	for i, col := range s.Columns {
+		cols[i] = col.Name + ` ` + col.Type
+		if col.PrimaryKey {
+			cols[i] += ` PRIMARY KEY`
+		}
+	}
+	h.record(`schema %s@%d (%s)`, s.Topic, s.Version, strings.Join(cols, `, `))
+	return nil
+}
+
+func (h *recordingStreamHandler) Row(_ context.Context, _ cdclib.Split, r cdclib.Row) error {
+	h.record(`row %s %s->%s @%s`, r.Topic, r.Key, r.Value, r.Updated)
+	return nil
+}
+
+func (h *recordingStreamHandler) Watermark(
+	_ context.Context, _ cdclib.Split, w cdclib.Watermark,
+) error {
+	h.record(`watermark %s`, w.Resolved)
+	return nil
+}
+
+func (h *recordingStreamHandler) Checkpoint(context.Context, cdclib.Split) error {
+	h.record(`checkpoint`)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.mu.failCheckpoint {
+		return errors.New(`disk full`)
+	}
+	return nil
+}
+
+func (h *recordingStreamHandler) ReleaseSplit(cdclib.Split, error) {}
+
+func (h *recordingStreamHandler) messages() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.mu.messages...)
+}
+
+func TestStreamSink(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	require.NoError(t, err)
+	h := &recordingStreamHandler{}
+	served := make(chan error, 1)
+	go func() { served <- cdclib.NewSource(ln, h).Serve(ctx) }()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	encodingOpts := changefeedbase.EncodingOptions{
+		Format:   changefeedbase.OptFormatJSON,
+		Envelope: changefeedbase.OptEnvelopeWrapped,
+	}
+	u, err := url.Parse(fmt.Sprintf(`stream://%s`, ln.Addr()))
+	require.NoError(t, err)
+	sink, err := makeStreamSink(sinkURL{URL: u}, 7, makeChangefeedTargets(`foo`), encodingOpts,
+		nilMetricsRecorderBuilder)
+	require.NoError(t, err)
+	require.NoError(t, sink.Dial())
+	defer func() { require.NoError(t, sink.Close()) }()
+
+	foo := topic(`foo`)
+	foo.Version = 1
+	ts := func(wall int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wall} }
+	require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[1]`), []byte(`{"a":1}`), ts(1), ts(1), zeroAlloc))
+	require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[2]`), []byte(`{"a":2}`), ts(2), ts(2), zeroAlloc))
+	require.NoError(t, sink.Flush(ctx))
+	require.NoError(t, sink.EmitResolvedTimestamp(ctx, nil, ts(3)))
+
+	// A new version of the table is announced before its rows, along with its
+	// columns once the changefeed has described them.
+	foo.Version++
+	a := cdcevent.ResultColumn{ResultColumn: colinfo.ResultColumn{Name: `a`, Typ: types.Int}}
+	b := cdcevent.ResultColumn{ResultColumn: colinfo.ResultColumn{Name: `b`, Typ: types.String}}
+	sink.(SchemaDescribingSink).DescribeSchema(foo, []cdcevent.ResultColumn{a}, []cdcevent.ResultColumn{a, b})
+	require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[1]`), []byte(`{"a":3}`), ts(4), ts(4), zeroAlloc))
+	require.NoError(t, sink.Flush(ctx))
+
+	require.Equal(t, []string{
+		`schema foo@1`,
+		`row foo [1]->{"a":1} @1.0000000000`,
+		`row foo [2]->{"a":2} @2.0000000000`,
+		`checkpoint`,
+		`watermark 3.0000000000`,
+		`checkpoint`,
+		`schema foo@2 (a INT8 PRIMARY KEY, b STRING)`,
+		`row foo [1]->{"a":3} @4.0000000000`,
+		`checkpoint`,
+	}, h.messages())
+
+	h.mu.Lock()
+	require.Len(t, h.mu.splits, 1)
+	hello := h.mu.splits[0]
+	h.mu.failCheckpoint = true
+	h.mu.Unlock()
+	require.Equal(t, cdclib.ProtocolVersion, hello.Version)
+	require.Equal(t, int64(7), hello.Split.JobID)
+	require.Equal(t, []string{`foo`}, hello.Split.Topics)
+	require.NotEmpty(t, hello.Split.ID)
+	require.Equal(t, `json`, hello.Format)
+
+	// Flushes fail if the adapter fails to checkpoint.
+	require.Regexp(t, `failed to acknowledge flush: disk full`, sink.Flush(ctx))
+
+	t.Run("errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			uri string
+			err string
+		}{
+			{uri: `stream://`, err: `must specify the address`},
+			{uri: `stream://user:pass@a`, err: `does not support authentication`},
+			{uri: `stream://a?ca_cert=Zm9v`, err: `ca_cert requires tls_enabled=true`},
+			{uri: `stream://a?tls_enabled=true&ca_cert=Zm9v`, err: `invalid ca_cert`},
+			{uri: `stream://a?tls_enabled=true&client_cert=Zm9v`, err: `must be provided together`},
+			{uri: `stream://a?foo=bar`, err: `unknown stream sink query parameters: foo`},
+		} {
+			u, err := url.Parse(tc.uri)
+			require.NoError(t, err)
+			_, err = makeStreamSink(sinkURL{URL: u}, 0, makeChangefeedTargets(`foo`), encodingOpts,
+				nilMetricsRecorderBuilder)
+			require.Regexp(t, tc.err, err, tc.uri)
+		}
+	})
+}
+
+func TestSidecarSink(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	path := filepath.Join(t.TempDir(), `sidecar.sock`)
+	ln, err := net.Listen(`unix`, path)
+	require.NoError(t, err)
+	h := &recordingStreamHandler{}
+	served := make(chan error, 1)
+	go func() { served <- cdclib.NewSource(ln, h).Serve(ctx) }()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	st := cluster.MakeTestingClusterSettings()
+	changefeedbase.SidecarSinks.Override(ctx, &st.SV, `archive=`+path)
+	encodingOpts := changefeedbase.EncodingOptions{
+		Format:   changefeedbase.OptFormatJSON,
+		Envelope: changefeedbase.OptEnvelopeWrapped,
+	}
+	makeSink := func(uri string) (Sink, error) {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		return makeSidecarSink(sinkURL{URL: u}, &st.SV, 7, makeChangefeedTargets(`foo`), encodingOpts,
+			nilMetricsRecorderBuilder)
+	}
+
+	sink, err := makeSink(`sidecar://archive`)
+	require.NoError(t, err)
+	require.NoError(t, sink.Dial())
+	defer func() { require.NoError(t, sink.Close()) }()
+
+	foo := topic(`foo`)
+	foo.Version = 1
+	ts := hlc.Timestamp{WallTime: 1}
+	require.NoError(t, sink.EmitRow(ctx, foo, []byte(`[1]`), []byte(`{"a":1}`), ts, ts, zeroAlloc))
+	require.NoError(t, sink.Flush(ctx))
+	require.Equal(t, []string{
+		`schema foo@1`,
+		`row foo [1]->{"a":1} @1.0000000000`,
+		`checkpoint`,
+	}, h.messages())
+
+	for _, tc := range []struct {
+		uri string
+		err string
+	}{
+		{uri: `sidecar://`, err: `must specify the name of the sidecar`},
+		{uri: `sidecar://archive/path`, err: `must be of the form sidecar://name`},
+		{uri: `sidecar://archive?foo=bar`, err: `unknown sidecar sink query parameters: foo`},
+		{uri: `sidecar://other`, err: `unknown sidecar other`},
+	} {
+		_, err := makeSink(tc.uri)
+		require.Regexp(t, tc.err, err, tc.uri)
+	}
+
+	for _, tc := range []struct {
+		setting string
+		err     string
+	}{
+		{setting: `a=/a.sock, b=/b.sock`},
+		{setting: `a`, err: `expected name=path`},
+		{setting: `a=a.sock`, err: `must be an absolute path`},
+		{setting: `a=/a.sock,a=/b.sock`, err: `registered more than once`},
+	} {
+		_, err := changefeedbase.ParseSidecarSinks(tc.setting)
+		if tc.err == `` {
+			require.NoError(t, err)
+		} else {
+			require.Regexp(t, tc.err, err, tc.setting)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -26,6 +27,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/security/username"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/tabledesc"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -34,6 +38,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/randutil"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/errors"
+	"github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/require"
 )
 
@@ -46,6 +51,10 @@ type asyncProducerMock struct {
 	mu          struct {
 		syncutil.Mutex
 		outstanding []*sarama.ProducerMessage
+		// txnStatus is the status of the transaction of the producer, and
+		// endedTxns the outcomes of the transactions it ended.
+		txnStatus sarama.ProducerTxnStatusFlag
+		endedTxns []string
 	}
 }
 
@@ -71,11 +80,33 @@ func (p *asyncProducerMock) Close() error {
 	close(p.errorsCh)
 	return nil
 }
-func (p *asyncProducerMock) IsTransactional() bool                   { panic(`unimplemented`) }
-func (p *asyncProducerMock) BeginTxn() error                         { panic(`unimplemented`) }
-func (p *asyncProducerMock) CommitTxn() error                        { panic(`unimplemented`) }
-func (p *asyncProducerMock) AbortTxn() error                         { panic(`unimplemented`) }
-func (p *asyncProducerMock) TxnStatus() sarama.ProducerTxnStatusFlag { panic(`unimplemented`) }
+func (p *asyncProducerMock) IsTransactional() bool { panic(`unimplemented`) }
+func (p *asyncProducerMock) BeginTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.mu.txnStatus&sarama.ProducerTxnFlagInTransaction != 0 {
+		return errors.New(`transaction already begun`)
+	}
+	p.mu.txnStatus = sarama.ProducerTxnFlagInTransaction
+	return nil
+}
+func (p *asyncProducerMock) CommitTxn() error { return p.endTxn(`committed`) }
+func (p *asyncProducerMock) AbortTxn() error  { return p.endTxn(`aborted`) }
+func (p *asyncProducerMock) endTxn(outcome string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.mu.txnStatus&sarama.ProducerTxnFlagInTransaction == 0 {
+		return errors.New(`no transaction begun`)
+	}
+	p.mu.txnStatus = sarama.ProducerTxnFlagReady
+	p.mu.endedTxns = append(p.mu.endedTxns, outcome)
+	return nil
+}
+func (p *asyncProducerMock) TxnStatus() sarama.ProducerTxnStatusFlag {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mu.txnStatus
+}
 func (p *asyncProducerMock) AddOffsetsToTxn(
 	_ map[string][]*sarama.PartitionOffsetMetadata, _ string,
 ) error {
@@ -203,6 +234,13 @@ func (p *asyncProducerMock) acknowledge(n int, ch chan *sarama.ProducerMessage)
 	}
 }
 
+// endedTxns returns the outcomes of the transactions the producer ended.
+func (p *asyncProducerMock) endedTxns() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.mu.endedTxns...)
+}
+
 // outstanding returns the number of un-acknowledged messages.
 func (p *asyncProducerMock) outstanding() int {
 	p.mu.Lock()
@@ -361,6 +399,109 @@ func TestKafkaSink(t *testing.T) {
 	require.EqualValues(t, 0, pool.used())
 }
 
+func TestKafkaSinkTransactions(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	p := newAsyncProducerMock(unbuffered)
+	sink, cleanup := makeTestKafkaSink(
+		t, noTopicPrefix, defaultTopicName, p, "t")
+	sink.transactional = true
+	stopConsume := p.consumeAndSucceed()
+
+	// Flushing a sink which emitted nothing doesn't begin a transaction.
+	require.NoError(t, sink.Flush(ctx))
+	require.Zero(t, p.TxnStatus())
+
+	// The messages emitted between flushes are produced in a transaction
+	// which is committed by the flush.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.EmitRow(
+			ctx, topic(`t`), []byte(strconv.Itoa(i)), nil, zeroTS, zeroTS, zeroAlloc))
+		require.NotZero(t, p.TxnStatus()&sarama.ProducerTxnFlagInTransaction)
+	}
+	require.NoError(t, sink.Flush(ctx))
+	require.Zero(t, p.TxnStatus()&sarama.ProducerTxnFlagInTransaction)
+	require.Equal(t, []string{`committed`}, p.endedTxns())
+
+	// The transaction open when the sink is closed, which it is when the
+	// changefeed restarts, is aborted.
+	require.NoError(t, sink.EmitRow(
+		ctx, topic(`t`), []byte(`3`), nil, zeroTS, zeroTS, zeroAlloc))
+	stopConsume()
+	cleanup()
+	require.Equal(t, []string{`committed`, `aborted`}, p.endedTxns())
+}
+
+func TestKafkaSinkThrottling(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	t.Run("registry", func(t *testing.T) {
+		var throttled []time.Duration
+		r := newKafkaThrottleRegistry(nil, func(d time.Duration) {
+			throttled = append(throttled, d)
+		})
+		// Sarama registers a throttle time histogram per broker.
+		h := metrics.GetOrRegisterHistogram(
+			kafkaThrottleTimeMetricPrefix+"-for-broker-1", r, metrics.NewUniformSample(10))
+		h.Update(0)
+		h.Update(250)
+		require.Equal(t, []time.Duration{250 * time.Millisecond}, throttled)
+
+		// Other metrics are registered as usual.
+		metrics.GetOrRegisterCounter("request-rate", r).Inc(1)
+		require.EqualValues(t, 1, r.Get("request-rate").(metrics.Counter).Count())
+	})
+
+	t.Run("sink", func(t *testing.T) {
+		ctx := context.Background()
+		p := newAsyncProducerMock(unbuffered)
+		sink, cleanup := makeTestKafkaSink(t, noTopicPrefix, defaultTopicName, p, "t")
+		defer cleanup()
+		stopConsume := p.consume()
+		defer stopConsume()
+
+		for i := 0; i < 4; i++ {
+			require.NoError(t, sink.EmitRow(
+				ctx, topic(`t`), []byte(strconv.Itoa(i)), nil, zeroTS, zeroTS, zeroAlloc))
+		}
+
+		// Once throttled, the limit of inflight messages is halved, so the next
+		// message waits for inflight messages to be acknowledged.
+		sink.recordThrottle(time.Millisecond)
+		emitted := make(chan error, 1)
+		go func() {
+			emitted <- sink.EmitRow(ctx, topic(`t`), []byte(`4`), nil, zeroTS, zeroTS, zeroAlloc)
+		}()
+		select {
+		case err := <-emitted:
+			t.Fatalf("expected throttled message to wait, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		sink.mu.Lock()
+		require.EqualValues(t, 2, sink.mu.throttle.limit)
+		sink.mu.Unlock()
+
+		testutils.SucceedsSoon(t, func() error {
+			if n := p.outstanding(); n != 4 {
+				return errors.Newf("expected 4 outstanding messages, got %d", n)
+			}
+			return nil
+		})
+		p.acknowledge(4, p.successesCh)
+		require.NoError(t, <-emitted)
+		p.acknowledge(1, p.successesCh)
+		require.NoError(t, sink.Flush(ctx))
+
+		// The limit is lifted as messages are acknowledged.
+		sink.mu.Lock()
+		require.EqualValues(t, 0, sink.mu.throttle.limit)
+		sink.mu.Unlock()
+	})
+}
+
 func TestKafkaSinkEscaping(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -379,6 +520,63 @@ func TestKafkaSinkEscaping(t *testing.T) {
 	require.Equal(t, sarama.ByteEncoder(`v☃`), m.Value)
 }
 
+func TestKafkaSinkCloudEventsBinary(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	p := newAsyncProducerMock(1)
+	sink, cleanup := makeTestKafkaSink(t, noTopicPrefix, defaultTopicName, p, `t`)
+	defer cleanup()
+	sink.cloudEventsBinary = true
+
+	const event = `{"data":{"after":{"a":1}},"datacontenttype":"application/json","id":"2.0000000000/[1]",` +
+		`"source":"/cockroachdb/changefeed/t","specversion":"1.0","subject":"[1]",` +
+		`"time":"1970-01-01T00:00:00.000000002Z","type":"com.cockroachlabs.changefeed.row.upsert"}`
+	require.NoError(t, sink.EmitRow(ctx, topic(`t`), []byte(`[1]`), []byte(event), zeroTS, zeroTS, zeroAlloc))
+	m := <-p.inputCh
+	require.Equal(t, sarama.ByteEncoder(`[1]`), m.Key)
+	require.Equal(t, sarama.ByteEncoder(`{"after":{"a":1}}`), m.Value)
+	header := func(k, v string) sarama.RecordHeader {
+		return sarama.RecordHeader{Key: []byte(k), Value: []byte(v)}
+	}
+	require.Equal(t, []sarama.RecordHeader{
+		header(`ce_id`, `2.0000000000/[1]`),
+		header(`ce_source`, `/cockroachdb/changefeed/t`),
+		header(`ce_specversion`, `1.0`),
+		header(`ce_subject`, `[1]`),
+		header(`ce_time`, `1970-01-01T00:00:00.000000002Z`),
+		header(`ce_type`, `com.cockroachlabs.changefeed.row.upsert`),
+		header(`content-type`, `application/json`),
+	}, m.Headers)
+
+	// The event in binary mode carried by the context of a row is sent as is,
+	// rather than converted from the value.
+	eventCtx := withBinaryCloudEvent(ctx, &binaryCloudEvent{
+		attributes:  []cloudEventAttribute{{name: `id`, value: `3.0000000000/[2]`}},
+		contentType: `application/json`,
+		data:        []byte(`{"after":{"a":2}}`),
+	})
+	require.NoError(t, sink.EmitRow(eventCtx, topic(`t`), []byte(`[2]`), []byte(`unparsed`), zeroTS, zeroTS, zeroAlloc))
+	m = <-p.inputCh
+	require.Equal(t, sarama.ByteEncoder(`{"after":{"a":2}}`), m.Value)
+	require.Equal(t, []sarama.RecordHeader{
+		header(`ce_id`, `3.0000000000/[2]`),
+		header(`content-type`, `application/json`),
+	}, m.Headers)
+
+	// Record headers require Kafka 0.11.
+	u, err := url.Parse(`kafka://localhost:9092`)
+	require.NoError(t, err)
+	_, err = makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(`t`),
+		changefeedbase.EncodingOptions{
+			Format:          changefeedbase.OptFormatJSON,
+			Envelope:        changefeedbase.OptEnvelopeCloudEvents,
+			CloudEventsMode: changefeedbase.OptCloudEventsModeBinary,
+		}, `{"Version": "0.10.2.0"}`, nil /* settings */, nilMetricsRecorderBuilder)
+	require.Regexp(t, `cloudevents_mode=binary requires kafka version 0.11 or later`, err)
+}
+
 func TestKafkaTopicNameProvided(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -414,6 +612,508 @@ func TestKafkaTopicNameWithPrefix(t *testing.T) {
 	require.Equal(t, `prefix-_u2603_`, m.Topic)
 }
 
+// kafkaClusterAdminMock records the topics created through it.
+type kafkaClusterAdminMock struct {
+	sarama.ClusterAdmin
+	topics map[string]sarama.TopicDetail
+	// messageMaxBytes is the message.max.bytes of the brokers, which topics
+	// use unless they set their own max.message.bytes.
+	messageMaxBytes string
+	// unauthorized are the topics which can't be described, and acls the
+	// ACLs of topics.
+	unauthorized map[string]struct{}
+	acls         map[string][]*sarama.Acl
+}
+
+func (a *kafkaClusterAdminMock) DescribeTopics(topics []string) ([]*sarama.TopicMetadata, error) {
+	var metadata []*sarama.TopicMetadata
+	for _, topic := range topics {
+		m := &sarama.TopicMetadata{Name: topic}
+		if _, ok := a.unauthorized[topic]; ok {
+			m.Err = sarama.ErrTopicAuthorizationFailed
+		} else if _, ok := a.topics[topic]; !ok {
+			m.Err = sarama.ErrUnknownTopicOrPartition
+		}
+		metadata = append(metadata, m)
+	}
+	return metadata, nil
+}
+
+func (a *kafkaClusterAdminMock) ListAcls(filter sarama.AclFilter) ([]sarama.ResourceAcls, error) {
+	if a.acls == nil {
+		return nil, sarama.ErrSecurityDisabled
+	}
+	acls, ok := a.acls[*filter.ResourceName]
+	if !ok {
+		return nil, nil
+	}
+	return []sarama.ResourceAcls{{
+		Resource: sarama.Resource{ResourceType: sarama.AclResourceTopic, ResourceName: *filter.ResourceName},
+		Acls:     acls,
+	}}, nil
+}
+
+func (a *kafkaClusterAdminMock) DescribeCluster() ([]*sarama.Broker, int32, error) {
+	return nil, 1, nil
+}
+
+func (a *kafkaClusterAdminMock) DescribeConfig(
+	resource sarama.ConfigResource,
+) ([]sarama.ConfigEntry, error) {
+	value := a.messageMaxBytes
+	if resource.Type == sarama.TopicResource {
+		detail, ok := a.topics[resource.Name]
+		if !ok {
+			return nil, sarama.ErrUnknownTopicOrPartition
+		}
+		if v, ok := detail.ConfigEntries[`max.message.bytes`]; ok {
+			value = *v
+		}
+	}
+	if value == `` {
+		return nil, nil
+	}
+	return []sarama.ConfigEntry{{Name: resource.ConfigNames[0], Value: value}}, nil
+}
+
+func (a *kafkaClusterAdminMock) CreateTopic(
+	topic string, detail *sarama.TopicDetail, validateOnly bool,
+) error {
+	if _, ok := a.topics[topic]; ok {
+		return &sarama.TopicError{Err: sarama.ErrTopicAlreadyExists}
+	}
+	a.topics[topic] = *detail
+	return nil
+}
+
+func (a *kafkaClusterAdminMock) DeleteTopic(topic string) error {
+	if _, ok := a.topics[topic]; !ok {
+		return &sarama.TopicError{Err: sarama.ErrUnknownTopicOrPartition}
+	}
+	delete(a.topics, topic)
+	return nil
+}
+
+func TestKafkaSinkDeleteTopics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	u, err := url.Parse(`kafka://localhost:9092?auto_create_topics=true`)
+	require.NoError(t, err)
+	s, err := makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(`t1`, `t2`),
+		changefeedbase.EncodingOptions{}, ``, nil, nilMetricsRecorderBuilder)
+	require.NoError(t, err)
+	sink := s.(*kafkaSink)
+
+	admin := &kafkaClusterAdminMock{topics: map[string]sarama.TopicDetail{
+		`t1`: {}, `t3`: {},
+	}}
+	sink.knobs = kafkaSinkKnobs{
+		OverrideAsyncProducerFromClient: func(client kafkaClient) (sarama.AsyncProducer, error) {
+			return newAsyncProducerMock(1), nil
+		},
+		OverrideClientInit: func(config *sarama.Config) (kafkaClient, error) {
+			return nil, nil
+		},
+		OverrideClusterAdminFromClient: func(client kafkaClient) (sarama.ClusterAdmin, error) {
+			return admin, nil
+		},
+	}
+	require.NoError(t, sink.Dial())
+	defer func() { require.NoError(t, sink.Close()) }()
+
+	// Only the topics the sink created, rather than found to exist, are
+	// reported as created, once.
+	wrapped := makeBatchEnvelopeSink(sink, 10)
+	creator, ok := asTopicCreatingSink(wrapped)
+	require.True(t, ok)
+	require.NoError(t, sink.maybeCreateTopic(`t1`))
+	require.NoError(t, sink.maybeCreateTopic(`t2`))
+	require.Equal(t, []string{`t2`}, creator.DrainCreatedTopics())
+	require.Empty(t, creator.DrainCreatedTopics())
+
+	// Only the given topics are deleted, and those which don't exist are
+	// ignored.
+	deleter, ok := asTopicDeletingSink(wrapped)
+	require.True(t, ok)
+	require.NoError(t, deleter.DeleteTopics(ctx, []string{`t2`}))
+	require.Equal(t, map[string]sarama.TopicDetail{`t1`: {}, `t3`: {}}, admin.topics)
+	require.NoError(t, deleter.DeleteTopics(ctx, []string{`t2`}))
+}
+
+func TestKafkaSinkAutoCreateTopics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	u, err := url.Parse(`kafka://localhost:9092?auto_create_topics=true&topic_partitions=6` +
+		`&topic_replication_factor=3&topic_cleanup_policy=compact`)
+	require.NoError(t, err)
+	s, err := makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(`t1`),
+		changefeedbase.EncodingOptions{}, ``, nil, nilMetricsRecorderBuilder)
+	require.NoError(t, err)
+	sink := s.(*kafkaSink)
+
+	p := newAsyncProducerMock(10)
+	admin := &kafkaClusterAdminMock{topics: map[string]sarama.TopicDetail{
+		`t2`: {NumPartitions: 1, ReplicationFactor: 1},
+	}}
+	sink.knobs = kafkaSinkKnobs{
+		OverrideAsyncProducerFromClient: func(client kafkaClient) (sarama.AsyncProducer, error) {
+			return p, nil
+		},
+		OverrideClientInit: func(config *sarama.Config) (kafkaClient, error) {
+			return nil, nil
+		},
+		OverrideClusterAdminFromClient: func(client kafkaClient) (sarama.ClusterAdmin, error) {
+			return admin, nil
+		},
+	}
+	require.NoError(t, sink.Dial())
+	defer func() { require.NoError(t, sink.Close()) }()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sink.EmitRow(ctx, topic(`t1`), []byte(`k`), []byte(`v`), zeroTS, zeroTS, zeroAlloc))
+		m := <-p.inputCh
+		require.Equal(t, `t1`, m.Topic)
+	}
+	// An existing topic is left as is.
+	require.NoError(t, sink.maybeCreateTopic(`t2`))
+	compact := `compact`
+	require.Equal(t, map[string]sarama.TopicDetail{
+		`t1`: {NumPartitions: 6, ReplicationFactor: 3, ConfigEntries: map[string]*string{`cleanup.policy`: &compact}},
+		`t2`: {NumPartitions: 1, ReplicationFactor: 1},
+	}, admin.topics)
+
+	for _, tc := range []struct {
+		params string
+		err    string
+	}{
+		{`topic_partitions=6`, `param topic_partitions requires auto_create_topics=true`},
+		{`auto_create_topics=true&topic_partitions=0`, `param topic_partitions must be a positive integer`},
+		{`auto_create_topics=true&topic_replication_factor=100000`,
+			`param topic_replication_factor must be a positive integer`},
+		{`auto_create_topics=true&topic_cleanup_policy=forever`,
+			`param topic_cleanup_policy must be compact, delete or compact,delete`},
+	} {
+		u, err := url.Parse(`kafka://localhost:9092?` + tc.params)
+		require.NoError(t, err)
+		_, err = makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(`t1`),
+			changefeedbase.EncodingOptions{}, ``, nil, nilMetricsRecorderBuilder)
+		require.Regexp(t, tc.err, err, tc.params)
+	}
+}
+
+func TestKafkaSinkPreflightCheck(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	dial := func(params string, admin *kafkaClusterAdminMock, targets ...string) error {
+		u, err := url.Parse(`kafka://localhost:9092?preflight_check=true` + params)
+		require.NoError(t, err)
+		s, err := makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(targets...),
+			changefeedbase.EncodingOptions{}, ``, nil, nilMetricsRecorderBuilder)
+		require.NoError(t, err)
+		sink := s.(*kafkaSink)
+		sink.knobs = kafkaSinkKnobs{
+			OverrideAsyncProducerFromClient: func(client kafkaClient) (sarama.AsyncProducer, error) {
+				return newAsyncProducerMock(1), nil
+			},
+			OverrideClientInit: func(config *sarama.Config) (kafkaClient, error) {
+				return nil, nil
+			},
+			OverrideClusterAdminFromClient: func(client kafkaClient) (sarama.ClusterAdmin, error) {
+				return admin, nil
+			},
+		}
+		if err := sink.Dial(); err != nil {
+			return err
+		}
+		return sink.Close()
+	}
+
+	// Every topic which can't be written to is reported.
+	admin := &kafkaClusterAdminMock{
+		topics:       map[string]sarama.TopicDetail{`t1`: {}, `t3`: {}, `t4`: {}},
+		unauthorized: map[string]struct{}{`t3`: {}},
+		acls: map[string][]*sarama.Acl{
+			`t1`: {{Principal: `User:u`, Host: `*`,
+				Operation: sarama.AclOperationWrite, PermissionType: sarama.AclPermissionAllow}},
+			`t4`: {{Principal: `User:*`, Host: `*`,
+				Operation: sarama.AclOperationAll, PermissionType: sarama.AclPermissionAllow},
+				{Principal: `User:u`, Host: `*`,
+					Operation: sarama.AclOperationWrite, PermissionType: sarama.AclPermissionDeny}},
+		},
+	}
+	err := dial(`&sasl_enabled=true&sasl_user=u&sasl_password=p`, admin, `t1`, `t2`, `t3`, `t4`)
+	require.Equal(t, pgcode.InsufficientPrivilege, pgerror.GetPGCode(err))
+	require.EqualError(t, err,
+		`kafka sink cannot write to 2 of 4 topics (preflight_check=true): t2, t3`)
+	require.Equal(t, []string{strings.Join([]string{
+		`t1: ok`,
+		`t2: topic does not exist and auto_create_topics is not set`,
+		`t3: not authorized to access topic`,
+		`t4: warning: an ACL appears to deny User:u writing to topic`,
+	}, "\n")}, errors.GetAllDetails(err))
+
+	// ACLs which appear to deny writing only warn, since the brokers may
+	// authorize the principal regardless.
+	require.NoError(t, dial(`&sasl_enabled=true&sasl_user=u&sasl_password=p`, admin, `t1`, `t4`))
+
+	// Missing topics are created if the sink creates topics, and the ACLs
+	// aren't checked without an authorizer.
+	admin.acls = nil
+	require.NoError(t, dial(`&sasl_enabled=true&sasl_user=u&sasl_password=p&auto_create_topics=true`,
+		admin, `t1`, `t2`))
+	require.Contains(t, admin.topics, `t2`)
+}
+
+func TestKafkaSinkResolvedTimestampDestination(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	emitResolved := func(params string) ([]string, error) {
+		u, err := url.Parse(`kafka://localhost:9092?` + params)
+		require.NoError(t, err)
+		s, err := makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(`t1`, `t2`),
+			changefeedbase.EncodingOptions{}, ``, nil, nilMetricsRecorderBuilder)
+		if err != nil {
+			return nil, err
+		}
+		sink := s.(*kafkaSink)
+		p := newAsyncProducerMock(10)
+		sink.knobs = kafkaSinkKnobs{
+			OverrideAsyncProducerFromClient: func(client kafkaClient) (sarama.AsyncProducer, error) {
+				return p, nil
+			},
+			OverrideClientInit: func(config *sarama.Config) (kafkaClient, error) {
+				return &fakeKafkaClient{config: config, numPartitions: 3}, nil
+			},
+		}
+		require.NoError(t, sink.Dial())
+		defer func() { require.NoError(t, sink.Close()) }()
+
+		var e testEncoder
+		if err := sink.EmitResolvedTimestamp(ctx, e, hlc.Timestamp{WallTime: 1}); err != nil {
+			return nil, err
+		}
+		var messages []string
+		for len(p.inputCh) > 0 {
+			m := <-p.inputCh
+			var key []byte
+			if m.Key != nil {
+				key, err = m.Key.Encode()
+				require.NoError(t, err)
+			}
+			messages = append(messages, fmt.Sprintf(`%s:%d:%s`, m.Topic, m.Partition, key))
+		}
+		return messages, nil
+	}
+
+	messages, err := emitResolved(``)
+	require.NoError(t, err)
+	require.Equal(t, []string{`t1:0:`, `t1:1:`, `t1:2:`, `t2:0:`, `t2:1:`, `t2:2:`}, messages)
+
+	messages, err = emitResolved(`resolved_partition=2`)
+	require.NoError(t, err)
+	require.Equal(t, []string{`t1:2:`, `t2:2:`}, messages)
+
+	// Messages to the control topic are keyed by the topic they resolve, and
+	// partitioned by key.
+	messages, err = emitResolved(`resolved_topic=control`)
+	require.NoError(t, err)
+	require.Equal(t, []string{`control:0:t1`, `control:0:t2`}, messages)
+
+	for _, tc := range []struct {
+		params string
+		err    string
+	}{
+		{`resolved_partition=3`, `topic t1 has no partition 3, to which resolved_partition emits resolved timestamps`},
+		{`resolved_partition=-1`, `param resolved_partition must be a non-negative integer`},
+		{`resolved_partition=1&resolved_topic=control`, `param resolved_partition cannot be used with resolved_topic`},
+	} {
+		_, err := emitResolved(tc.params)
+		require.Error(t, err, tc.params)
+		require.Contains(t, err.Error(), tc.err, tc.params)
+	}
+}
+
+func TestKafkaSinkMaxMessageBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	maxBytes := `1000`
+	admin := &kafkaClusterAdminMock{
+		topics: map[string]sarama.TopicDetail{
+			`t1`: {ConfigEntries: map[string]*string{`max.message.bytes`: &maxBytes}},
+			`t2`: {},
+		},
+		messageMaxBytes: `5000`,
+	}
+	dial := func(jsonStr changefeedbase.SinkSpecificJSONConfig, targets ...string) (*kafkaSink, error) {
+		u, err := url.Parse(`kafka://localhost:9092`)
+		require.NoError(t, err)
+		s, err := makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(targets...),
+			changefeedbase.EncodingOptions{}, jsonStr, nil, nilMetricsRecorderBuilder)
+		require.NoError(t, err)
+		sink := s.(*kafkaSink)
+		sink.knobs = kafkaSinkKnobs{
+			OverrideAsyncProducerFromClient: func(client kafkaClient) (sarama.AsyncProducer, error) {
+				return newAsyncProducerMock(1), nil
+			},
+			OverrideClientInit: func(config *sarama.Config) (kafkaClient, error) {
+				return nil, nil
+			},
+			OverrideClusterAdminFromClient: func(client kafkaClient) (sarama.ClusterAdmin, error) {
+				return admin, nil
+			},
+		}
+		if err := sink.Dial(); err != nil {
+			return nil, err
+		}
+		t.Cleanup(func() { require.NoError(t, sink.Close()) })
+		return sink, nil
+	}
+
+	// Batches are limited to the smallest max.message.bytes of the topics.
+	sink, err := dial(``, `t1`, `t2`)
+	require.NoError(t, err)
+	require.Equal(t, 1000, sink.kafkaCfg.Producer.MaxMessageBytes)
+
+	// Topics which do not exist yet use the message.max.bytes of the brokers.
+	sink, err = dial(``, `t2`, `t3`)
+	require.NoError(t, err)
+	require.Equal(t, 5000, sink.kafkaCfg.Producer.MaxMessageBytes)
+
+	// Batching configurations exceeding the limit are rejected.
+	_, err = dial(`{"Flush": {"Bytes": 2000, "Frequency": "1s"}}`, `t1`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(),
+		`sets Flush.Bytes to 2000, but the kafka topics accept batches of at most 1000 bytes`)
+	sink, err = dial(`{"Flush": {"Bytes": 2000, "Frequency": "1s"}}`, `t2`)
+	require.NoError(t, err)
+	require.Equal(t, 5000, sink.kafkaCfg.Producer.MaxMessageBytes)
+
+	// The limit is left as is if it cannot be determined.
+	admin.messageMaxBytes = ``
+	sink, err = dial(``, `t3`)
+	require.NoError(t, err)
+	require.Equal(t, int(sarama.MaxRequestSize-1), sink.kafkaCfg.Producer.MaxMessageBytes)
+}
+
+// leaderCountingKafkaClient is a fakeKafkaClient whose partitions are led by
+// the broker at leader, and which counts the lookups of their leaders.
+type leaderCountingKafkaClient struct {
+	fakeKafkaClient
+	leader  string
+	lookups int
+}
+
+func (c *leaderCountingKafkaClient) Leader(
+	topic string, partitionID int32,
+) (*sarama.Broker, error) {
+	c.lookups++
+	if c.leader == "" {
+		return nil, sarama.ErrLeaderNotAvailable
+	}
+	return sarama.NewBroker(c.leader), nil
+}
+
+func TestKafkaSinkBrokerHosts(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	client := &leaderCountingKafkaClient{leader: "broker1:9092"}
+	s := &kafkaSink{bootstrapAddrs: "bootstrap:9092", client: client}
+	msg := func(topic string, partition int32) *sarama.ProducerMessage {
+		return &sarama.ProducerMessage{Topic: topic, Partition: partition}
+	}
+
+	// The leader of each partition is looked up once, then cached.
+	require.Equal(t, "broker1:9092", s.resolveBrokerHost(msg("t", 0), false /* refresh */))
+	require.Equal(t, "broker1:9092", s.resolveBrokerHost(msg("t", 0), false /* refresh */))
+	require.Equal(t, 1, client.lookups)
+	require.Equal(t, "broker1:9092", s.resolveBrokerHost(msg("t", 1), false /* refresh */))
+	require.Equal(t, "broker1:9092", s.resolveBrokerHost(msg("u", 0), false /* refresh */))
+	require.Equal(t, 3, client.lookups)
+
+	// A refresh looks the leader up again, picking up a change of leadership.
+	client.leader = "broker2:9092"
+	require.Equal(t, "broker1:9092", s.resolveBrokerHost(msg("t", 0), false /* refresh */))
+	require.Equal(t, "broker2:9092", s.resolveBrokerHost(msg("t", 0), true /* refresh */))
+	require.Equal(t, "broker2:9092", s.cachedBrokerHost(msg("t", 0)))
+	require.Equal(t, 4, client.lookups)
+
+	// If the leader is unknown, the bootstrap addresses are used and nothing
+	// is cached.
+	client.leader = ""
+	require.Equal(t, "bootstrap:9092", s.resolveBrokerHost(msg("t", 0), true /* refresh */))
+	require.Equal(t, "bootstrap:9092", s.cachedBrokerHost(msg("t", 0)))
+	require.Equal(t, "bootstrap:9092", s.resolveBrokerHost(msg("t", 0), false /* refresh */))
+	require.Equal(t, 6, client.lookups)
+
+	// The cache never looks up leaders itself.
+	require.Equal(t, "bootstrap:9092", s.cachedBrokerHost(msg("v", 0)))
+	require.Equal(t, 6, client.lookups)
+}
+
+func TestKafkaSinkTopicCompression(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	u, err := url.Parse(`kafka://localhost:9092`)
+	require.NoError(t, err)
+	s, err := makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(`t1`, `t2`, `t3`),
+		changefeedbase.EncodingOptions{},
+		`{"Compression": "LZ4", "TopicCompression": {"t1": "ZSTD", "t2": "LZ4", "t3": "ZSTD"}}`,
+		nil, nilMetricsRecorderBuilder)
+	require.NoError(t, err)
+	sink := s.(*kafkaSink)
+	require.Equal(t, sarama.V2_1_0_0, sink.kafkaCfg.Version)
+
+	producers := make(map[sarama.CompressionCodec]*asyncProducerMock)
+	sink.knobs = kafkaSinkKnobs{
+		OverrideAsyncProducerFromClient: func(client kafkaClient) (sarama.AsyncProducer, error) {
+			p := newAsyncProducerMock(10)
+			producers[client.Config().Producer.Compression] = p
+			return p, nil
+		},
+		OverrideClientInit: func(config *sarama.Config) (kafkaClient, error) {
+			return &fakeKafkaClient{config: config}, nil
+		},
+	}
+	require.NoError(t, sink.Dial())
+	defer func() { require.NoError(t, sink.Close()) }()
+	require.Len(t, producers, 2)
+
+	// Messages are produced by the producer of the codec of their topic.
+	for _, tc := range []struct {
+		topic string
+		codec sarama.CompressionCodec
+	}{
+		{`t1`, sarama.CompressionZSTD},
+		{`t2`, sarama.CompressionLZ4},
+		{`t3`, sarama.CompressionZSTD},
+	} {
+		require.NoError(t, sink.EmitRow(ctx, topic(tc.topic), []byte(`k`), []byte(`v`), zeroTS, zeroTS, zeroAlloc))
+		m := <-producers[tc.codec].inputCh
+		require.Equal(t, tc.topic, m.Topic)
+		producers[tc.codec].successesCh <- m
+	}
+	// The acknowledgements of every producer reach the sink.
+	require.NoError(t, sink.Flush(ctx))
+
+	_, err = makeKafkaSink(ctx, sinkURL{URL: u}, makeChangefeedTargets(`t1`),
+		changefeedbase.EncodingOptions{}, `{"Version": "2.0.0", "TopicCompression": {"t1": "ZSTD"}}`,
+		nil, nilMetricsRecorderBuilder)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `ZSTD compression requires kafka version 2.1.0 or later`)
+}
+
 // goos: darwin
 // goarch: amd64
 // pkg: github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl
@@ -490,7 +1190,7 @@ func TestSQLSink(t *testing.T) {
 	targets.Add(barTopic.GetTargetSpecification())
 
 	const testTableName = `sink`
-	sink, err := makeSQLSink(sinkURL{URL: &pgURL}, testTableName, targets, nilMetricsRecorderBuilder)
+	sink, err := makeSQLSink(sinkURL{URL: &pgURL}, testTableName, targets, changefeedbase.EncodingOptions{}, nilMetricsRecorderBuilder)
 	require.NoError(t, err)
 	require.NoError(t, sink.(*sqlSink).Dial())
 	defer func() { require.NoError(t, sink.Close()) }()
@@ -584,6 +1284,65 @@ func TestSQLSink(t *testing.T) {
 	)
 }
 
+func TestSQLSinkHistory(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	s, sqlDBRaw, _ := serverutils.StartServer(t, base.TestServerArgs{UseDatabase: "d"})
+	defer s.Stopper().Stop(ctx)
+	sqlDB := sqlutils.MakeSQLRunner(sqlDBRaw)
+	sqlDB.Exec(t, `CREATE DATABASE d`)
+
+	pgURL, cleanup := sqlutils.PGUrl(t, s.ServingSQLAddr(), t.Name(), url.User(username.RootUser))
+	defer cleanup()
+	pgURL.Path = `d`
+	q := pgURL.Query()
+	q.Set(changefeedbase.SinkParamSQLHistory, `true`)
+	q.Set(changefeedbase.SinkParamSQLTableName, `audit`)
+	pgURL.RawQuery = q.Encode()
+
+	// History mode only understands wrapped JSON changes.
+	_, err := makeSQLSink(sinkURL{URL: &pgURL}, `sink`, makeChangefeedTargets(`foo`),
+		changefeedbase.EncodingOptions{Format: changefeedbase.OptFormatAvro}, nilMetricsRecorderBuilder)
+	require.Error(t, err)
+
+	opts := changefeedbase.EncodingOptions{
+		Format:   changefeedbase.OptFormatJSON,
+		Envelope: changefeedbase.OptEnvelopeWrapped,
+		Diff:     true,
+	}
+	sink, err := makeSQLSink(sinkURL{URL: &pgURL}, `sink`, makeChangefeedTargets(`foo`),
+		opts, nilMetricsRecorderBuilder)
+	require.NoError(t, err)
+	require.NoError(t, sink.(*sqlSink).Dial())
+	defer func() { require.NoError(t, sink.Close()) }()
+
+	ts := func(wallTime int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wallTime} }
+	fooTopic := topic(`foo`)
+	require.NoError(t, sink.EmitRow(ctx, fooTopic, []byte(`[1]`),
+		[]byte(`{"after": {"a": 1, "b": "x"}, "before": null}`), ts(1), ts(1), zeroAlloc))
+	require.NoError(t, sink.EmitRow(ctx, fooTopic, []byte(`[1]`),
+		[]byte(`{"after": {"a": 1, "b": "y"}, "before": {"a": 1, "b": "x"}}`), ts(2), ts(2), zeroAlloc))
+	require.NoError(t, sink.EmitRow(ctx, fooTopic, []byte(`[1]`),
+		[]byte(`{"after": null, "before": {"a": 1, "b": "y"}}`), ts(3), ts(3), zeroAlloc))
+	// A change emitted again overwrites the row it was first emitted as.
+	require.NoError(t, sink.EmitRow(ctx, fooTopic, []byte(`[1]`),
+		[]byte(`{"after": {"a": 1, "b": "y"}, "before": {"a": 1, "b": "x"}}`), ts(2), ts(2), zeroAlloc))
+	require.NoError(t, sink.EmitResolvedTimestamp(ctx, nil, ts(3)))
+	require.NoError(t, sink.Flush(ctx))
+
+	sqlDB.CheckQueryResults(t,
+		`SELECT topic, key, mvcc_timestamp, op, before, after FROM audit ORDER BY PRIMARY KEY audit`,
+		[][]string{
+			{`foo`, ``, `3.0000000000`, `resolved`, `NULL`, `NULL`},
+			{`foo`, `[1]`, `1.0000000000`, `insert`, `NULL`, `{"a": 1, "b": "x"}`},
+			{`foo`, `[1]`, `2.0000000000`, `update`, `{"a": 1, "b": "x"}`, `{"a": 1, "b": "y"}`},
+			{`foo`, `[1]`, `3.0000000000`, `delete`, `{"a": 1, "b": "y"}`, `NULL`},
+		},
+	)
+}
+
 func TestSaramaConfigOptionParsing(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -708,6 +1467,55 @@ func TestSaramaConfigOptionParsing(t *testing.T) {
 		require.Error(t, err)
 
 	})
+	t.Run("apply configures the idempotent producer", func(t *testing.T) {
+		opts := changefeedbase.SinkSpecificJSONConfig(`{"Idempotent": true}`)
+
+		cfg, err := getSaramaConfig(opts)
+		require.NoError(t, err)
+		require.NoError(t, cfg.Validate())
+
+		saramaCfg := sarama.NewConfig()
+		require.NoError(t, cfg.Apply(saramaCfg))
+		require.True(t, saramaCfg.Producer.Idempotent)
+		require.Equal(t, sarama.WaitForAll, saramaCfg.Producer.RequiredAcks)
+		require.Equal(t, 1, saramaCfg.Net.MaxOpenRequests)
+		require.True(t, saramaCfg.Version.IsAtLeast(sarama.V0_11_0_0))
+		require.NoError(t, saramaCfg.Validate())
+
+		opts = changefeedbase.SinkSpecificJSONConfig(`{"Idempotent": true, "RequiredAcks": "ONE"}`)
+		cfg, err = getSaramaConfig(opts)
+		require.NoError(t, err)
+		require.Regexp(t, `Idempotent requires RequiredAcks to be ALL`, cfg.Validate())
+
+		opts = changefeedbase.SinkSpecificJSONConfig(`{"Idempotent": true, "Version": "0.10.2.0"}`)
+		cfg, err = getSaramaConfig(opts)
+		require.NoError(t, err)
+		require.Regexp(t, `Idempotent requires kafka version 0.11.0 or later`, cfg.Apply(sarama.NewConfig()))
+	})
+	t.Run("apply configures the transactional producer", func(t *testing.T) {
+		opts := changefeedbase.SinkSpecificJSONConfig(`{"Transactional": true}`)
+
+		cfg, err := getSaramaConfig(opts)
+		require.NoError(t, err)
+		require.NoError(t, cfg.Validate())
+
+		saramaCfg := sarama.NewConfig()
+		require.NoError(t, cfg.Apply(saramaCfg))
+		require.True(t, saramaCfg.Producer.Idempotent)
+		require.Regexp(t, `^crdb-changefeed-`, saramaCfg.Producer.Transaction.ID)
+		require.NoError(t, saramaCfg.Validate())
+
+		// Each sink's producer has a transactional ID of its own.
+		otherCfg := sarama.NewConfig()
+		require.NoError(t, cfg.Apply(otherCfg))
+		require.NotEqual(t, saramaCfg.Producer.Transaction.ID, otherCfg.Producer.Transaction.ID)
+
+		opts = changefeedbase.SinkSpecificJSONConfig(
+			`{"Transactional": true, "TopicCompression": {"t": "GZIP"}}`)
+		cfg, err = getSaramaConfig(opts)
+		require.NoError(t, err)
+		require.Regexp(t, `Transactional cannot be used with TopicCompression`, cfg.Validate())
+	})
 	t.Run("compression options validation", func(t *testing.T) {
 		for option := range saramaCompressionCodecOptions {
 			opts := changefeedbase.SinkSpecificJSONConfig(fmt.Sprintf(`{"Compression": "%s"}`, option))
@@ -723,6 +1531,80 @@ func TestSaramaConfigOptionParsing(t *testing.T) {
 		_, err := getSaramaConfig(opts)
 		require.Error(t, err)
 	})
+	t.Run("partitioner validation", func(t *testing.T) {
+		for _, tc := range []struct {
+			opts        changefeedbase.SinkSpecificJSONConfig
+			expectedErr string
+		}{
+			{`{"Partitioner": "murmur2"}`, ``},
+			{`{"Partitioner": "crc32", "Partitions": [{"Topic": "foo", "Partition": 1}]}`, ``},
+			{`{"Partitioner": "random"}`, `unknown Partitioner "random"`},
+			{`{"Partitioner": "manual"}`, `Partitioner manual requires Partitions`},
+			{`{"Partitions": [{"Partition": 1}]}`, `Partitions must specify a Topic`},
+			{`{"Partitions": [{"Topic": "foo", "Partition": -1}]}`, `non-negative Partition`},
+			{`{"Partitions": [{"Topic": "foo", "Key": "[1]", "Partition": 1}, ` +
+				`{"Topic": "foo", "Key": "[1]", "Partition": 2}]}`, `more than once`},
+		} {
+			cfg, err := getSaramaConfig(tc.opts)
+			require.NoError(t, err)
+			if tc.expectedErr == `` {
+				require.NoError(t, cfg.Validate(), tc.opts)
+			} else {
+				require.Regexp(t, tc.expectedErr, cfg.Validate(), tc.opts)
+			}
+		}
+	})
+}
+
+func TestKafkaPartitioner(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	// Test vectors from the Java client.
+	for key, expected := range map[string]int32{
+		`21`:                         -973932308,
+		`foobar`:                     -790332482,
+		`a-little-bit-long-string`:   -985981536,
+		`a-little-bit-longer-string`: -1486304829,
+		`abc`:                        479470107,
+	} {
+		require.Equal(t, expected, int32(murmur2([]byte(key))), key)
+	}
+
+	partition := func(t *testing.T, jsonStr changefeedbase.SinkSpecificJSONConfig, topic, key string) (int32, error) {
+		cfg, err := getSaramaConfig(jsonStr)
+		require.NoError(t, err)
+		require.NoError(t, cfg.Validate())
+		saramaCfg := &sarama.Config{}
+		require.NoError(t, cfg.Apply(saramaCfg))
+		msg := &sarama.ProducerMessage{Topic: topic, Key: sarama.ByteEncoder(key)}
+		return saramaCfg.Producer.Partitioner(topic).Partition(msg, 6)
+	}
+
+	t.Run("hash", func(t *testing.T) {
+		p, err := partition(t, `{"Partitioner": "murmur2"}`, `foo`, `[1]`)
+		require.NoError(t, err)
+		require.Equal(t, int32(1), p)
+		p, err = partition(t, `{"Partitioner": "crc32"}`, `foo`, `[1]`)
+		require.NoError(t, err)
+		require.Equal(t, int32(0), p)
+	})
+
+	t.Run("pinned", func(t *testing.T) {
+		const cfg = `{"Partitioner": "manual", "Partitions": [` +
+			`{"Topic": "foo", "Key": "[1]", "Partition": 3}, {"Topic": "foo", "Partition": 4}, ` +
+			`{"Topic": "bar", "Key": "[1]", "Partition": 7}]}`
+		p, err := partition(t, cfg, `foo`, `[1]`)
+		require.NoError(t, err)
+		require.Equal(t, int32(3), p)
+		p, err = partition(t, cfg, `foo`, `[2]`)
+		require.NoError(t, err)
+		require.Equal(t, int32(4), p)
+		_, err = partition(t, cfg, `bar`, `[1]`)
+		require.Regexp(t, `topic bar has 6 partitions, but kafka_sink_config pins messages to partition 7`, err)
+		_, err = partition(t, cfg, `bar`, `[2]`)
+		require.Regexp(t, `message with key \[2\] of topic bar is not pinned to a partition`, err)
+	})
 }
 
 func TestKafkaSinkTracksMemory(t *testing.T) {
@@ -11,8 +11,11 @@ package changefeedccl
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"hash/crc32"
@@ -23,14 +26,17 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvevent"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/ctxgroup"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/httputil"
 	"github.com/cockroachdb/cockroach/pkg/util/retry"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/system"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/errors"
@@ -40,6 +46,22 @@ const (
 	applicationTypeJSON = `application/json`
 	applicationTypeCSV  = `text/csv`
 	authorizationHeader = `Authorization`
+
+	contentEncodingHeader = `Content-Encoding`
+	// acceptEncodingHeader, in a response, advertises the content codings
+	// the receiver accepts in requests, as described by RFC 7694.
+	acceptEncodingHeader = `Accept-Encoding`
+
+	// webhookCheckpointHeader is set on the requests which ask a receiver to
+	// confirm checkpoint tokens.
+	webhookCheckpointHeader = `X-Changefeed-Checkpoint`
+	// idempotencyKeyHeader is set on the requests which emit rows and
+	// resolved timestamps to the idempotency key of the batch they send. See
+	// withIdempotencyKey.
+	idempotencyKeyHeader = `Idempotency-Key`
+	// defaultWebhookCheckpointTimeout bounds how long a flush waits for the
+	// receiver to confirm its checkpoint tokens.
+	defaultWebhookCheckpointTimeout = 5 * time.Minute
 )
 
 func isWebhookSink(u *url.URL) bool {
@@ -59,12 +81,42 @@ type webhookSink struct {
 	batchCfg    batchConfig
 	ts          timeutil.TimeSource
 	format      changefeedbase.FormatType
+	// cloudEventsMode is set if messages are events of the cloudevents
+	// envelope.
+	cloudEventsMode changefeedbase.CloudEventsMode
+	// traceContext is set if requests carry the traceparent of the span which
+	// emitted their rows.
+	traceContext bool
 
 	// Webhook destination.
 	url        sinkURL
 	authHeader string
 	client     *httputil.Client
 
+	// authHeaderFromOption is set if authHeader is given by the
+	// webhook_auth_header option rather than by the URI of the sink.
+	authHeaderFromOption bool
+	// credentials, if set, reloads the authorization header of the sink from
+	// the external connection holding its URI.
+	credentials *credentialsReloader
+
+	// clientPool, if set, is the pool through which the sink shares its
+	// client with the other sinks with the same clientKey. releaseClient
+	// releases the client the sink acquired from it.
+	clientPool    *sinkClientPool
+	clientKey     string
+	releaseClient func() error
+
+	// compression, if enabled, is the algorithm request bodies are compressed
+	// with, as configured by compressionCfg.
+	compression    compressionAlgo
+	compressionCfg compressionConfig
+	// receiverAcceptsCompression is set while the receiver, when compression
+	// is negotiated, accepts request bodies compressed with compression.
+	receiverAcceptsCompression syncutil.AtomicBool
+	chunkedCfg                 chunkedConfig
+	sv                         *settings.Values
+
 	// messages are written onto batch channel
 	// which batches matches based on batching configuration.
 	batchChan chan webhookMessage
@@ -82,6 +134,18 @@ type webhookSink struct {
 	exitWorkers func() // Signaled to shut down all workers.
 	eventsChans []chan []messagePayload
 	metrics     metricsRecorder
+
+	// bufferedBytes is the size of the values of the messages emitted to the
+	// sink which have yet to be sent.
+	bufferedBytes atomic.Int64
+
+	checkpointCfg checkpointConfig
+	// checkpointMu holds the checkpoint tokens returned by the receiver for
+	// batches it hasn't yet confirmed to be durable.
+	checkpointMu struct {
+		syncutil.Mutex
+		tokens []string
+	}
 }
 
 func (s *webhookSink) getConcreteType() sinkType {
@@ -129,6 +193,90 @@ func encodePayloadJSONWebhook(messages []messagePayload) (encodedPayload, error)
 	return result, err
 }
 
+// encodePayloadCloudEventsWebhook encodes a batch of events in structured mode
+// as a JSON array, which is sent with cloudEventsBatchContentType.
+func encodePayloadCloudEventsWebhook(messages []messagePayload) (encodedPayload, error) {
+	result := encodedPayload{
+		emitTime: timeutil.Now(),
+	}
+
+	payload := make([]json.RawMessage, len(messages))
+	for i, m := range messages {
+		result.alloc.Merge(&m.alloc)
+		payload[i] = m.val
+		if m.emitTime.Before(result.emitTime) {
+			result.emitTime = m.emitTime
+		}
+		if result.mvcc.IsEmpty() || m.mvcc.Less(result.mvcc) {
+			result.mvcc = m.mvcc
+		}
+	}
+
+	j, err := json.Marshal(payload)
+	if err != nil {
+		return encodedPayload{}, err
+	}
+	result.data = j
+	return result, nil
+}
+
+// cloudEventHeader returns the headers of the request sending an event in
+// binary mode.
+func cloudEventHeader(event *binaryCloudEvent) http.Header {
+	header := make(http.Header, len(event.attributes)+1)
+	for _, a := range event.attributes {
+		header.Set(`ce-`+a.name, a.value)
+	}
+	header.Set("Content-Type", event.contentType)
+	return header
+}
+
+// withTraceParent returns the header of a request sending the given messages,
+// with their traceparent. A request carries a single traceparent, so the
+// messages of a request must share it; see splitByTraceParent.
+func withTraceParent(header http.Header, msgs []messagePayload) http.Header {
+	if len(msgs) == 0 || msgs[0].traceParent == `` {
+		return header
+	}
+	if header == nil {
+		header = make(http.Header, 1)
+	}
+	header.Set(traceParentHeader, msgs[0].traceParent)
+	return header
+}
+
+// withIdempotencyKey returns the header of a request sending the given
+// messages, with the idempotency key of the batch. The key is derived from the
+// keys, values and MVCC timestamps of the messages, so every attempt to send a
+// batch carries the same key, and a receiver can use it to discard a batch it
+// already received when the request is retried, e.g. after a timeout.
+//
+// Since the key is derived from the contents of the batch, it is stable
+// across restarts of the changefeed job only as far as batches are: the rows
+// emitted again from the last checkpoint after a restart are batched anew,
+// and a batch which differs from the one sent before the restart in any row
+// has a different key, even if it repeats rows which were received. Receivers
+// which need to dedupe rows across restarts should do so by their key and
+// updated timestamp.
+func withIdempotencyKey(header http.Header, msgs []messagePayload) http.Header {
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	for _, m := range msgs {
+		// The lengths delimit the keys and values of the messages.
+		_, _ = h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(m.key)))])
+		_, _ = h.Write(m.key)
+		_, _ = h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(m.val)))])
+		_, _ = h.Write(m.val)
+		_, _ = h.Write(buf[:binary.PutVarint(buf[:], m.mvcc.WallTime)])
+		_, _ = h.Write(buf[:binary.PutVarint(buf[:], int64(m.mvcc.Logical))])
+	}
+	if header == nil {
+		header = make(http.Header, 1)
+	}
+	header.Set(idempotencyKeyHeader, hex.EncodeToString(h.Sum(nil)[:16]))
+	return header
+}
+
 func encodePayloadCSVWebhook(messages []messagePayload) (encodedPayload, error) {
 	result := encodedPayload{
 		emitTime: timeutil.Now(),
@@ -150,6 +298,34 @@ func encodePayloadCSVWebhook(messages []messagePayload) (encodedPayload, error)
 	return result, nil
 }
 
+// encodePayloadMsgpackWebhook encodes a batch of messages as a MessagePack
+// map with the same keys as the JSON payload of encodePayloadJSONWebhook.
+func encodePayloadMsgpackWebhook(messages []messagePayload) (encodedPayload, error) {
+	result := encodedPayload{
+		emitTime: timeutil.Now(),
+	}
+
+	// Keys are written in ascending order, as in every map in format=msgpack.
+	data := appendMsgpackMapHeader(nil, 2)
+	data = appendMsgpackString(data, `length`)
+	data = appendMsgpackInt(data, int64(len(messages)))
+	data = appendMsgpackString(data, `payload`)
+	data = appendMsgpackArrayHeader(data, len(messages))
+	for _, m := range messages {
+		result.alloc.Merge(&m.alloc)
+		data = append(data, m.val...)
+		if m.emitTime.Before(result.emitTime) {
+			result.emitTime = m.emitTime
+		}
+		if result.mvcc.IsEmpty() || m.mvcc.Less(result.mvcc) {
+			result.mvcc = m.mvcc
+		}
+	}
+
+	result.data = data
+	return result, nil
+}
+
 type messagePayload struct {
 	// Payload message fields.
 	key      []byte
@@ -157,6 +333,13 @@ type messagePayload struct {
 	alloc    kvevent.Alloc
 	emitTime time.Time
 	mvcc     hlc.Timestamp
+	// traceParent is the traceparent of the span which emitted the message,
+	// if the sink has the trace_context option.
+	traceParent string
+	// cloudEvent is the message in binary mode, if the sink sends events in
+	// binary mode and it was carried by the context the message was emitted
+	// in.
+	cloudEvent *binaryCloudEvent
 }
 
 // webhookMessage contains either messagePayload or a flush request.
@@ -232,42 +415,130 @@ type retryConfig struct {
 //		 "Retry": {
 //		   "Max":     ...,
 //		   "Backoff": ...,
+//	  },
+//		 "Checkpoint": {
+//		   "Enabled": ...,
+//		   "Timeout": ...,
+//	  },
+//		 "Compression": {
+//		   "Negotiate": ...,
+//	  },
+//		 "Chunked": {
+//		   "Threshold": ...,
 //	  }
 //	}
 type webhookSinkConfig struct {
-	Flush batchConfig `json:",omitempty"`
-	Retry retryConfig `json:",omitempty"`
+	Flush       batchConfig       `json:",omitempty"`
+	Retry       retryConfig       `json:",omitempty"`
+	Checkpoint  checkpointConfig  `json:",omitempty"`
+	Compression compressionConfig `json:",omitempty"`
+	Chunked     chunkedConfig     `json:",omitempty"`
+}
+
+// checkpointConfig configures the acknowledgement of batches by the receiver,
+// which extends the at-least-once delivery of the sink to the receiver's own
+// processing of the batches rather than just their receipt.
+//
+// When enabled, the receiver may respond to a batch with a JSON object with a
+// checkpoint_token field, such as {"checkpoint_token": "42"}, to indicate that
+// it has received the batch but not yet durably processed it. Tokens may be
+// strings or numbers; a successful response with any other body means that
+// the batch has already been processed. Before a flush
+// completes, and so before the changefeed advances its persisted frontier,
+// the sink sends the receiver a request with the X-Changefeed-Checkpoint
+// header and a body such as {"checkpoint_tokens": ["41", "42"]}. The receiver
+// responds with 200 once the batches of all of the tokens, and all batches
+// before them, have been durably processed, or with 202 if they have not yet
+// been, in which case the sink asks again until the timeout elapses.
+type checkpointConfig struct {
+	Enabled bool         `json:",omitempty"`
+	Timeout jsonDuration `json:",omitempty"`
+}
+
+// compressionConfig configures the compression of request bodies with the
+// algorithm of the compression option, which sets the Content-Encoding of
+// the requests.
+//
+// By default, every request body is compressed. When Negotiate is set, bodies
+// are only compressed once the receiver has advertised that it accepts the
+// algorithm with an Accept-Encoding header in a response, as described by
+// RFC 7694, such as "Accept-Encoding: gzip". If the receiver responds to a
+// compressed request with 415 Unsupported Media Type, the request is retried
+// uncompressed, and bodies are sent uncompressed until the receiver again
+// advertises the algorithm.
+type compressionConfig struct {
+	Negotiate bool `json:",omitempty"`
+}
+
+// chunkedConfig configures streaming large request bodies with chunked
+// transfer encoding. Bodies of at least Threshold bytes, before compression,
+// are compressed as they are sent rather than before the request is made, and
+// are sent without a Content-Length. A zero Threshold disables chunked
+// transfer encoding.
+type chunkedConfig struct {
+	Threshold int `json:",omitempty"`
+}
+
+// webhookCheckpointResponse is the response of a receiver to a batch.
+type webhookCheckpointResponse struct {
+	Token json.RawMessage `json:"checkpoint_token"`
+}
+
+// token returns the checkpoint token of the response, which may be a string or
+// a number, or "" if it has none.
+func (r webhookCheckpointResponse) token() string {
+	var s string
+	if err := json.Unmarshal(r.Token, &s); err == nil {
+		return s
+	}
+	var n json.Number
+	if err := json.Unmarshal(r.Token, &n); err == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// webhookCheckpointRequest asks a receiver to confirm checkpoint tokens.
+type webhookCheckpointRequest struct {
+	Tokens []string `json:"checkpoint_tokens"`
 }
 
 func (s *webhookSink) getWebhookSinkConfig(
 	jsonStr changefeedbase.SinkSpecificJSONConfig,
-) (batchCfg batchConfig, retryCfg retry.Options, err error) {
+) (cfg webhookSinkConfig, retryCfg retry.Options, err error) {
 	retryCfg = defaultRetryConfig()
 
-	var cfg webhookSinkConfig
 	cfg.Retry.Max = jsonMaxRetries(retryCfg.MaxRetries)
 	cfg.Retry.Backoff = jsonDuration(retryCfg.InitialBackoff)
 	if jsonStr != `` {
 		// set retry defaults to be overridden if included in JSON
 		if err = json.Unmarshal([]byte(jsonStr), &cfg); err != nil {
-			return batchCfg, retryCfg, errors.Wrapf(err, "error unmarshalling json")
+			return cfg, retryCfg, errors.Wrapf(err, "error unmarshalling json")
 		}
 	}
 
 	// don't support negative values
 	if cfg.Flush.Messages < 0 || cfg.Flush.Bytes < 0 || cfg.Flush.Frequency < 0 ||
-		cfg.Retry.Max < 0 || cfg.Retry.Backoff < 0 {
-		return batchCfg, retryCfg, errors.Errorf("invalid option value %s, all config values must be non-negative", changefeedbase.OptWebhookSinkConfig)
+		cfg.Retry.Max < 0 || cfg.Retry.Backoff < 0 || cfg.Checkpoint.Timeout < 0 ||
+		cfg.Chunked.Threshold < 0 {
+		return cfg, retryCfg, errors.Errorf("invalid option value %s, all config values must be non-negative", changefeedbase.OptWebhookSinkConfig)
 	}
 
 	// errors if other batch values are set, but frequency is not
 	if (cfg.Flush.Messages > 0 || cfg.Flush.Bytes > 0) && cfg.Flush.Frequency == 0 {
-		return batchCfg, retryCfg, errors.Errorf("invalid option value %s, flush frequency is not set, messages may never be sent", changefeedbase.OptWebhookSinkConfig)
+		return cfg, retryCfg, errors.Errorf("invalid option value %s, flush frequency is not set, messages may never be sent", changefeedbase.OptWebhookSinkConfig)
+	}
+
+	if cfg.Checkpoint.Timeout > 0 && !cfg.Checkpoint.Enabled {
+		return cfg, retryCfg, errors.Errorf("invalid option value %s, checkpoint timeout is set, but checkpoints are not enabled", changefeedbase.OptWebhookSinkConfig)
+	}
+	if cfg.Checkpoint.Enabled && cfg.Checkpoint.Timeout == 0 {
+		cfg.Checkpoint.Timeout = jsonDuration(defaultWebhookCheckpointTimeout)
 	}
 
 	retryCfg.MaxRetries = int(cfg.Retry.Max)
 	retryCfg.InitialBackoff = time.Duration(cfg.Retry.Backoff)
-	return cfg.Flush, retryCfg, nil
+	return cfg, retryCfg, nil
 }
 
 func makeWebhookSink(
@@ -277,6 +548,7 @@ func makeWebhookSink(
 	opts changefeedbase.WebhookSinkOptions,
 	parallelism int,
 	source timeutil.TimeSource,
+	sv *settings.Values,
 	mb metricsRecorderBuilder,
 ) (Sink, error) {
 	if u.Scheme != changefeedbase.SinkSchemeWebhookHTTPS {
@@ -287,16 +559,26 @@ func makeWebhookSink(
 	switch encodingOpts.Format {
 	case changefeedbase.OptFormatJSON:
 	case changefeedbase.OptFormatCSV:
+	case changefeedbase.OptFormatMsgpack:
 	default:
 		return nil, errors.Errorf(`this sink is incompatible with %s=%s`,
 			changefeedbase.OptFormat, encodingOpts.Format)
 	}
 
 	switch encodingOpts.Envelope {
-	case changefeedbase.OptEnvelopeWrapped, changefeedbase.OptEnvelopeBare:
+	case changefeedbase.OptEnvelopeWrapped, changefeedbase.OptEnvelopeBare,
+		changefeedbase.OptEnvelopeCloudEvents:
 	default:
-		return nil, errors.Errorf(`this sink is incompatible with %s=%s`,
-			changefeedbase.OptEnvelope, encodingOpts.Envelope)
+		return nil, incompatibleEnvelopeError(encodingOpts.Envelope)
+	}
+
+	authHeader := opts.AuthHeader
+	if h := u.consumeParam(changefeedbase.SinkParamWebhookAuthHeader); h != "" {
+		if authHeader != "" {
+			return nil, errors.Errorf(`%s and the %s sink parameter cannot both be specified`,
+				changefeedbase.OptWebhookAuthHeader, changefeedbase.SinkParamWebhookAuthHeader)
+		}
+		authHeader = h
 	}
 
 	encodingOpts.TopicInValue = true
@@ -314,19 +596,44 @@ func makeWebhookSink(
 
 	sink := &webhookSink{
 		workerCtx:   ctx,
-		authHeader:  opts.AuthHeader,
+		authHeader:  authHeader,
 		exitWorkers: cancel,
 		parallelism: parallelism,
 		ts:          source,
 		metrics:     mb(requiresResourceAccounting),
 		format:      encodingOpts.Format,
+		sv:          sv,
+
+		cloudEventsMode:      encodingOpts.CloudEventsMode,
+		traceContext:         encodingOpts.TraceContext,
+		authHeaderFromOption: opts.AuthHeader != "",
 	}
 
-	var err error
-	sink.batchCfg, sink.retryCfg, err = sink.getWebhookSinkConfig(opts.JSONConfig)
+	cfg, retryCfg, err := sink.getWebhookSinkConfig(opts.JSONConfig)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error processing option %s", changefeedbase.OptWebhookSinkConfig)
 	}
+	sink.batchCfg, sink.retryCfg, sink.checkpointCfg = cfg.Flush, retryCfg, cfg.Checkpoint
+	sink.compressionCfg, sink.chunkedCfg = cfg.Compression, cfg.Chunked
+
+	if codec := encodingOpts.Compression; codec != "" {
+		sink.compression, _, err = compressionFromString(codec)
+		if err != nil {
+			return nil, err
+		}
+	} else if sink.compressionCfg.Negotiate {
+		return nil, errors.Errorf("invalid option value %s, compression negotiation is set, but %s is not",
+			changefeedbase.OptWebhookSinkConfig, changefeedbase.OptCompression)
+	}
+
+	// The client only depends on the destination of the sink, the parameters
+	// which makeWebhookClient consumes, and the timeout, so that sinks which
+	// only differ by their authorization header share it.
+	q := u.Query()
+	sink.clientKey = sinkClientKey(u.Scheme, u.Host, connTimeout.String(),
+		q.Get(changefeedbase.SinkParamSkipTLSVerify), q.Get(changefeedbase.SinkParamCACert),
+		q.Get(changefeedbase.SinkParamClientCert), q.Get(changefeedbase.SinkParamClientKey),
+		q.Get(changefeedbase.SinkParamProxyURL))
 
 	// TODO(yevgeniy): Establish HTTP connection in Dial().
 	sink.client, err = makeWebhookClient(u, connTimeout)
@@ -344,6 +651,7 @@ func makeWebhookSink(
 	params.Del(changefeedbase.SinkParamCACert)
 	params.Del(changefeedbase.SinkParamClientCert)
 	params.Del(changefeedbase.SinkParamClientKey)
+	params.Del(changefeedbase.SinkParamProxyURL)
 	sinkURLParsed.RawQuery = params.Encode()
 	sink.url = sinkURL{URL: sinkURLParsed}
 
@@ -365,6 +673,7 @@ func makeWebhookClient(u sinkURL, timeout time.Duration) (*httputil.Client, erro
 		caCert        []byte
 		clientCert    []byte
 		clientKey     []byte
+		proxyURL      *url.URL
 	}{}
 
 	transport := client.Transport.(*http.Transport)
@@ -381,6 +690,12 @@ func makeWebhookClient(u sinkURL, timeout time.Duration) (*httputil.Client, erro
 	if err := u.decodeBase64(changefeedbase.SinkParamClientKey, &dialConfig.clientKey); err != nil {
 		return nil, err
 	}
+	proxyURL, err := parseProxyURL(changefeedbase.SinkParamProxyURL,
+		u.consumeParam(changefeedbase.SinkParamProxyURL))
+	if err != nil {
+		return nil, err
+	}
+	dialConfig.proxyURL = proxyURL
 
 	transport.TLSClientConfig = &tls.Config{
 		InsecureSkipVerify: dialConfig.tlsSkipVerify,
@@ -414,6 +729,10 @@ func makeWebhookClient(u sinkURL, timeout time.Duration) (*httputil.Client, erro
 		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
 	}
 
+	if dialConfig.proxyURL != nil {
+		setTransportProxy(transport, dialConfig.proxyURL)
+	}
+
 	return client, nil
 }
 
@@ -434,10 +753,36 @@ func defaultWorkerCount() int {
 }
 
 func (s *webhookSink) Dial() error {
+	if s.clientPool != nil {
+		c, release, err := s.clientPool.acquire(s.workerCtx, s.sv, s.clientKey, func() (io.Closer, error) {
+			return webhookClientCloser{s.client}, nil
+		})
+		if err != nil {
+			return err
+		}
+		s.client, s.releaseClient = c.(webhookClientCloser).Client, release
+	}
 	s.setupWorkers()
 	return nil
 }
 
+// setClientPool implements the pooledClientSink interface.
+func (s *webhookSink) setClientPool(p *sinkClientPool, _ *settings.Values) {
+	s.clientPool = p
+}
+
+// webhookClientCloser closes the idle connections of a webhook client shared
+// through a sinkClientPool once no sink uses it.
+type webhookClientCloser struct {
+	*httputil.Client
+}
+
+// Close implements the io.Closer interface.
+func (c webhookClientCloser) Close() error {
+	c.CloseIdleConnections()
+	return nil
+}
+
 func (s *webhookSink) setupWorkers() {
 	// setup events channels to send to workers and the worker group
 	s.eventsChans = make([]chan []messagePayload, s.parallelism)
@@ -590,69 +935,401 @@ func (s *webhookSink) workerLoop(workerIndex int) {
 				continue
 			}
 
-			var encoded encodedPayload
-			var err error
-			switch s.format {
-			case changefeedbase.OptFormatJSON:
-				encoded, err = encodePayloadJSONWebhook(msgs)
-			case changefeedbase.OptFormatCSV:
-				encoded, err = encodePayloadCSVWebhook(msgs)
+			if s.cloudEventsMode == changefeedbase.OptCloudEventsModeBinary {
+				if err := s.sendBinaryCloudEvents(msgs); err != nil {
+					s.exitWorkersWithError(err)
+					return
+				}
+				continue
 			}
-			if err != nil {
-				s.exitWorkersWithError(err)
-				return
+
+			for _, run := range splitByTraceParent(msgs) {
+				if err := s.sendBatch(run); err != nil {
+					s.exitWorkersWithError(err)
+					return
+				}
 			}
-			if err := s.sendMessageWithRetries(s.workerCtx, encoded.data); err != nil {
-				s.exitWorkersWithError(err)
-				return
+		}
+	}
+}
+
+// splitByTraceParent splits a batch of messages into runs of consecutive
+// messages with the same traceparent, each of which is sent in its own
+// request, so that the downstream processing of every message is stitched
+// into its own trace. Only the messages of sampled traces have a traceparent,
+// so this rarely splits batches.
+func splitByTraceParent(msgs []messagePayload) [][]messagePayload {
+	var batches [][]messagePayload
+	start := 0
+	for i := 1; i <= len(msgs); i++ {
+		if i == len(msgs) || msgs[i].traceParent != msgs[start].traceParent {
+			batches = append(batches, msgs[start:i])
+			start = i
+		}
+	}
+	return batches
+}
+
+// stampsEmitTimes implements the emitTimeStampingSink interface. Messages are
+// stamped as the requests which send them are made.
+func (s *webhookSink) stampsEmitTimes() {}
+
+// sendBatch sends a batch of messages in a single request.
+func (s *webhookSink) sendBatch(msgs []messagePayload) error {
+	now := timeutil.Now()
+	for _, m := range msgs {
+		stampEmitTime(m.val, now)
+	}
+	var encoded encodedPayload
+	var header http.Header
+	var err error
+	switch {
+	case s.cloudEventsMode == changefeedbase.OptCloudEventsModeStructured:
+		encoded, err = encodePayloadCloudEventsWebhook(msgs)
+		header = http.Header{"Content-Type": []string{cloudEventsBatchContentType}}
+	case s.format == changefeedbase.OptFormatJSON:
+		encoded, err = encodePayloadJSONWebhook(msgs)
+	case s.format == changefeedbase.OptFormatCSV:
+		encoded, err = encodePayloadCSVWebhook(msgs)
+	case s.format == changefeedbase.OptFormatMsgpack:
+		encoded, err = encodePayloadMsgpackWebhook(msgs)
+	}
+	if err != nil {
+		return err
+	}
+	header = withTraceParent(header, msgs)
+	header = withIdempotencyKey(header, msgs)
+	compressedBytes, err := s.sendMessageWithRetries(s.workerCtx, encoded.data, len(msgs), header)
+	if err != nil {
+		return err
+	}
+	encoded.alloc.Release(s.workerCtx)
+	for _, m := range msgs {
+		s.bufferedBytes.Add(-int64(len(m.val)))
+	}
+	s.metrics.recordEmittedBatch(
+		encoded.emitTime, len(msgs), encoded.mvcc, len(encoded.data), compressedBytes)
+	return nil
+}
+
+// sendBinaryCloudEvents sends each of a batch of events in binary mode. The
+// attributes of an event are sent as headers, so each is sent in its own
+// request.
+func (s *webhookSink) sendBinaryCloudEvents(msgs []messagePayload) error {
+	for _, m := range msgs {
+		now := timeutil.Now()
+		stampEmitTime(m.val, now)
+		event := m.cloudEvent
+		if event == nil {
+			converted, err := makeBinaryCloudEvent(m.val)
+			if err != nil {
+				return err
 			}
-			encoded.alloc.Release(s.workerCtx)
-			s.metrics.recordEmittedBatch(
-				encoded.emitTime, len(msgs), encoded.mvcc, len(encoded.data), sinkDoesNotCompress)
+			event = &converted
+		} else {
+			stampEmitTime(event.data, now)
+		}
+		header := withTraceParent(cloudEventHeader(event), []messagePayload{m})
+		header = withIdempotencyKey(header, []messagePayload{m})
+		compressedBytes, err := s.sendMessageWithRetries(s.workerCtx, event.data, 1 /* numMessages */, header)
+		if err != nil {
+			return err
 		}
+		m.alloc.Release(s.workerCtx)
+		s.bufferedBytes.Add(-int64(len(m.val)))
+		s.metrics.recordEmittedBatch(m.emitTime, 1, m.mvcc, len(event.data), compressedBytes)
 	}
+	return nil
 }
 
-func (s *webhookSink) sendMessageWithRetries(ctx context.Context, reqBody []byte) error {
+// sendMessageWithRetries sends a request with the given body, which carries
+// numMessages messages. The headers, if any, override the default headers of
+// the format of the sink. It returns
+// the size of the body as it was sent if it was compressed, and
+// sinkDoesNotCompress otherwise.
+func (s *webhookSink) sendMessageWithRetries(
+	ctx context.Context, reqBody []byte, numMessages int, header http.Header,
+) (compressedBytes int, _ error) {
 	requestFunc := func() error {
-		return s.sendMessage(ctx, reqBody)
+		start := timeutil.Now()
+		sentBytes, compressed, err := s.sendMessage(ctx, reqBody, header)
+		s.metrics.recordSinkHostIO(s.url.Host, start, numMessages, sentBytes, err)
+		compressedBytes = sinkDoesNotCompress
+		if compressed {
+			compressedBytes = sentBytes
+		}
+		return err
 	}
-	return retry.WithMaxAttempts(ctx, s.retryCfg, s.retryCfg.MaxRetries+1, requestFunc)
+	err := retry.WithMaxAttempts(ctx, s.retryCfg, s.retryCfg.MaxRetries+1, requestFunc)
+	return compressedBytes, err
 }
 
-func (s *webhookSink) sendMessage(ctx context.Context, reqBody []byte) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url.String(), bytes.NewReader(reqBody))
+// shouldCompress returns whether the next request body should be compressed.
+func (s *webhookSink) shouldCompress() bool {
+	if !s.compression.enabled() {
+		return false
+	}
+	return !s.compressionCfg.Negotiate || s.receiverAcceptsCompression.Get()
+}
+
+// writeBody writes reqBody to w, compressing it if compress is set.
+func (s *webhookSink) writeBody(w io.Writer, reqBody []byte, compress bool) error {
+	if !compress {
+		_, err := w.Write(reqBody)
+		return err
+	}
+	codec, err := newCompressionCodec(s.compression, s.sv, w)
 	if err != nil {
 		return err
 	}
+	if _, err := codec.Write(reqBody); err != nil {
+		return err
+	}
+	return codec.Close()
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// sendMessage sends a request with the given body, and returns the number of
+// bytes of the body as sent and whether it was compressed.
+func (s *webhookSink) sendMessage(
+	ctx context.Context, reqBody []byte, header http.Header,
+) (sentBytes int, compressed bool, _ error) {
+	compressed = s.shouldCompress()
+	sentBytes = len(reqBody)
+	chunked := s.chunkedCfg.Threshold > 0 && len(reqBody) >= s.chunkedCfg.Threshold
+	var body io.Reader = bytes.NewReader(reqBody)
+	switch {
+	case chunked:
+		// The body is written to the pipe, and so compressed, as the transport
+		// reads it. Since its length isn't known up front, it's sent with
+		// chunked transfer encoding.
+		pr, pw := io.Pipe()
+		counter := &countingWriter{w: pw}
+		bodyWritten := make(chan struct{})
+		go func() {
+			defer close(bodyWritten)
+			_ = pw.CloseWithError(s.writeBody(counter, reqBody, compressed))
+		}()
+		defer func() {
+			_ = pr.Close()
+			<-bodyWritten
+			sentBytes = counter.n
+		}()
+		body = pr
+	case compressed:
+		var buf bytes.Buffer
+		if err := s.writeBody(&buf, reqBody, compressed); err != nil {
+			return sentBytes, compressed, err
+		}
+		sentBytes = buf.Len()
+		body = &buf
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url.String(), body)
+	if err != nil {
+		return sentBytes, compressed, err
+	}
+	if chunked {
+		req.ContentLength = -1
+	}
+	if compressed {
+		req.Header.Set(contentEncodingHeader, string(s.compression))
+	}
 	switch s.format {
 	case changefeedbase.OptFormatJSON:
 		req.Header.Set("Content-Type", applicationTypeJSON)
 	case changefeedbase.OptFormatCSV:
 		req.Header.Set("Content-Type", applicationTypeCSV)
+	case changefeedbase.OptFormatMsgpack:
+		req.Header.Set("Content-Type", applicationTypeMsgpack)
+	}
+	for k, v := range header {
+		req.Header[k] = v
 	}
 
-	if s.authHeader != "" {
-		req.Header.Set(authorizationHeader, s.authHeader)
+	if authHeader := s.currentAuthHeader(ctx); authHeader != "" {
+		req.Header.Set(authorizationHeader, authHeader)
 	}
 
 	var res *http.Response
 	res, err = s.client.Do(req)
 	if err != nil {
-		return err
+		return sentBytes, compressed, err
 	}
 	defer res.Body.Close()
 
+	if s.compressionCfg.Negotiate {
+		s.negotiateCompression(res, compressed)
+	}
 	if !(res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices) {
 		resBody, err := io.ReadAll(res.Body)
 		if err != nil {
-			return errors.Wrapf(err, "failed to read body for HTTP response with status: %d", res.StatusCode)
+			return sentBytes, compressed, errors.Wrapf(err, "failed to read body for HTTP response with status: %d", res.StatusCode)
+		}
+		return sentBytes, compressed, markHTTPErrorClass(
+			fmt.Errorf("%s: %s", res.Status, string(resBody)), res.StatusCode)
+	}
+	if s.checkpointCfg.Enabled {
+		return sentBytes, compressed, s.recordCheckpointToken(res.Body)
+	}
+	return sentBytes, compressed, nil
+}
+
+// markHTTPErrorClass marks the error of a request to which the server
+// responded with the given status code with its changefeedbase.ErrorClass.
+func markHTTPErrorClass(err error, statusCode int) error {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusProxyAuthRequired:
+		return changefeedbase.MarkErrorClass(err, changefeedbase.ErrorClassAuth)
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return changefeedbase.MarkErrorClass(err, changefeedbase.ErrorClassQuota)
+	case http.StatusRequestTimeout, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return changefeedbase.MarkErrorClass(err, changefeedbase.ErrorClassNetwork)
+	}
+	return err
+}
+
+// negotiateCompression records whether the receiver accepts request bodies
+// compressed with the compression algorithm of the sink, as advertised by its
+// response to a request, which was compressed if compressed is set.
+func (s *webhookSink) negotiateCompression(res *http.Response, compressed bool) {
+	if compressed && res.StatusCode == http.StatusUnsupportedMediaType {
+		s.receiverAcceptsCompression.Set(false)
+		return
+	}
+	if accepted := res.Header.Values(acceptEncodingHeader); len(accepted) > 0 {
+		s.receiverAcceptsCompression.Set(acceptsEncoding(accepted, string(s.compression)))
+	}
+}
+
+// acceptsEncoding returns whether the values of an Accept-Encoding header
+// accept the specified content coding, which they don't if it's listed with a
+// zero quality value.
+func acceptsEncoding(accepted []string, coding string) bool {
+	for _, v := range accepted {
+		for _, c := range strings.Split(v, ",") {
+			c, params, _ := strings.Cut(c, ";")
+			if !strings.EqualFold(strings.TrimSpace(c), coding) {
+				continue
+			}
+			params = strings.ReplaceAll(params, " ", "")
+			if strings.HasPrefix(params, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+				if err == nil && q == 0 {
+					return false
+				}
+			}
+			return true
 		}
-		return fmt.Errorf("%s: %s", res.Status, string(resBody))
 	}
+	return false
+}
+
+// recordCheckpointToken records the checkpoint token, if any, in the response
+// of the receiver to a batch. The batch was successfully delivered, so a
+// response which doesn't carry a token, such as a body which isn't a JSON
+// object, means that the receiver has already durably processed it.
+func (s *webhookSink) recordCheckpointToken(body io.Reader) error {
+	resBody, err := io.ReadAll(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read body for HTTP response")
+	}
+	var res webhookCheckpointResponse
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return nil //nolint:returnerrcheck
+	}
+	token := res.token()
+	if token == "" {
+		return nil
+	}
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	s.checkpointMu.tokens = append(s.checkpointMu.tokens, token)
 	return nil
 }
 
+// confirmCheckpoint waits for the receiver to confirm that the batches of all
+// of the checkpoint tokens it has returned have been durably processed.
+func (s *webhookSink) confirmCheckpoint(ctx context.Context) error {
+	s.checkpointMu.Lock()
+	tokens := s.checkpointMu.tokens
+	s.checkpointMu.Unlock()
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	reqBody, err := json.Marshal(webhookCheckpointRequest{Tokens: tokens})
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(s.checkpointCfg.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	opts := retry.Options{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+	for r := retry.StartWithCtx(ctx, opts); r.Next(); {
+		confirmed, err := s.sendCheckpointRequest(ctx, reqBody)
+		if err != nil {
+			return err
+		}
+		if confirmed {
+			s.checkpointMu.Lock()
+			defer s.checkpointMu.Unlock()
+			s.checkpointMu.tokens = s.checkpointMu.tokens[len(tokens):]
+			return nil
+		}
+	}
+	return errors.Wrapf(ctx.Err(), "webhook receiver did not confirm checkpoint within %s", timeout)
+}
+
+// sendCheckpointRequest asks the receiver to confirm checkpoint tokens, and
+// returns whether it did.
+func (s *webhookSink) sendCheckpointRequest(ctx context.Context, reqBody []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url.String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", applicationTypeJSON)
+	req.Header.Set(webhookCheckpointHeader, "true")
+	if authHeader := s.currentAuthHeader(ctx); authHeader != "" {
+		req.Header.Set(authorizationHeader, authHeader)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusAccepted:
+		return false, nil
+	default:
+		resBody, err := io.ReadAll(res.Body)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to read body for HTTP response with status: %d", res.StatusCode)
+		}
+		return false, errors.Newf("confirming checkpoint: %s: %s", res.Status, string(resBody))
+	}
+}
+
 // workerIndex assigns rows each to a worker goroutine based on the hash of its
 // primary key. This is to ensure that each message with the same key gets
 // deterministically assigned to the same worker. Since we have a channel per
@@ -703,17 +1380,64 @@ func (s *webhookSink) EmitRow(
 		return err
 	case s.batchChan <- webhookMessage{
 		payload: messagePayload{
-			key:      key,
-			val:      value,
-			alloc:    alloc,
-			emitTime: timeutil.Now(),
-			mvcc:     mvcc,
+			key:         key,
+			val:         value,
+			alloc:       alloc,
+			emitTime:    timeutil.Now(),
+			mvcc:        mvcc,
+			traceParent: s.traceParent(ctx),
+			cloudEvent:  s.binaryCloudEvent(ctx),
 		}}:
 		s.metrics.recordMessageSize(int64(len(key) + len(value)))
+		s.bufferedBytes.Add(int64(len(value)))
 	}
 	return nil
 }
 
+// BufferedBytes implements the BufferingSink interface. Messages are buffered
+// from when they are emitted until the requests which send them succeed.
+func (s *webhookSink) BufferedBytes() int64 {
+	return s.bufferedBytes.Load()
+}
+
+// setCredentialsReloader implements the credentialsReloadingSink interface.
+// Authorization headers given by the webhook_auth_header option are not
+// reloaded.
+func (s *webhookSink) setCredentialsReloader(r *credentialsReloader) {
+	if s.authHeaderFromOption {
+		return
+	}
+	s.credentials = r
+}
+
+// currentAuthHeader returns the authorization header of the next request,
+// which is reloaded, once the poll interval elapses, if it's held by an
+// external connection.
+func (s *webhookSink) currentAuthHeader(ctx context.Context) string {
+	if s.credentials != nil {
+		return s.credentials.credentials(ctx).authHeader
+	}
+	return s.authHeader
+}
+
+// traceParent returns the traceparent of the span of the given context if the
+// sink has the trace_context option, and "" otherwise.
+func (s *webhookSink) traceParent(ctx context.Context) string {
+	if !s.traceContext {
+		return ``
+	}
+	return traceParent(ctx)
+}
+
+// binaryCloudEvent returns the event in binary mode carried by the given
+// context if the sink sends events in binary mode, and nil otherwise.
+func (s *webhookSink) binaryCloudEvent(ctx context.Context) *binaryCloudEvent {
+	if s.cloudEventsMode != changefeedbase.OptCloudEventsModeBinary {
+		return nil
+	}
+	return binaryCloudEventFromContext(ctx)
+}
+
 func (s *webhookSink) EmitResolvedTimestamp(
 	ctx context.Context, encoder Encoder, resolved hlc.Timestamp,
 ) error {
@@ -723,6 +1447,18 @@ func (s *webhookSink) EmitResolvedTimestamp(
 	if err != nil {
 		return err
 	}
+	var header http.Header
+	switch s.cloudEventsMode {
+	case changefeedbase.OptCloudEventsModeStructured:
+		header = http.Header{"Content-Type": []string{cloudEventsContentType}}
+	case changefeedbase.OptCloudEventsModeBinary:
+		event, err := makeBinaryCloudEvent(payload)
+		if err != nil {
+			return err
+		}
+		header, payload = cloudEventHeader(&event), event.data
+	}
+	header = withIdempotencyKey(header, []messagePayload{{val: payload}})
 
 	select {
 	// check the webhook sink context in case workers have been terminated
@@ -737,7 +1473,7 @@ func (s *webhookSink) EmitResolvedTimestamp(
 	// do worker logic directly here instead (there's no point using workers for
 	// resolved timestamps since there are no keys and everything must be
 	// in order)
-	if err := s.sendMessageWithRetries(ctx, payload); err != nil {
+	if _, err := s.sendMessageWithRetries(ctx, payload, 1 /* numMessages */, header); err != nil {
 		s.exitWorkersWithError(err)
 		return err
 	}
@@ -764,8 +1500,15 @@ func (s *webhookSink) Flush(ctx context.Context) error {
 	case err := <-s.errChan:
 		return err
 	case <-s.flushDone:
-		return s.sinkError()
+		if err := s.sinkError(); err != nil {
+			return err
+		}
 	}
+
+	if s.checkpointCfg.Enabled {
+		return s.confirmCheckpoint(ctx)
+	}
+	return nil
 }
 
 func (s *webhookSink) Close() error {
@@ -777,6 +1520,9 @@ func (s *webhookSink) Close() error {
 	for _, eventsChan := range s.eventsChans {
 		close(eventsChan)
 	}
+	if s.releaseClient != nil {
+		return s.releaseClient()
+	}
 	s.client.CloseIdleConnections()
 	return nil
 }
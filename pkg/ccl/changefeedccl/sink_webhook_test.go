@@ -12,19 +12,24 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdctest"
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing/tracingpb"
 	"github.com/cockroachdb/errors"
 	"github.com/stretchr/testify/require"
 )
@@ -83,7 +88,8 @@ func setupWebhookSinkWithDetails(
 	if err != nil {
 		return nil, err
 	}
-	sinkSrc, err := makeWebhookSink(ctx, sinkURL{URL: u}, encodingOpts, sinkOpts, parallelism, source, nilMetricsRecorderBuilder)
+	sinkSrc, err := makeWebhookSink(ctx, sinkURL{URL: u}, encodingOpts, sinkOpts, parallelism, source,
+		&cluster.MakeTestingClusterSettings().SV, nilMetricsRecorderBuilder)
 	if err != nil {
 		return nil, err
 	}
@@ -333,6 +339,51 @@ func TestWebhookSinkWithAuthOptions(t *testing.T) {
 	}
 }
 
+func TestWebhookSinkWithProxy(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+	require.NoError(t, err)
+	sinkDest, err := cdctest.StartMockWebhookSink(cert)
+	require.NoError(t, err)
+	defer sinkDest.Close()
+	proxy := startConnectProxy(t, `proxy-user`, `proxy-pwd`)
+
+	sinkDestHost, err := url.Parse(sinkDest.URL())
+	require.NoError(t, err)
+	params := sinkDestHost.Query()
+	params.Set(changefeedbase.SinkParamCACert, certEncoded)
+	params.Set(changefeedbase.SinkParamProxyURL, proxy.proxyURL(`proxy-user`, `proxy-pwd`))
+	sinkDestHost.RawQuery = params.Encode()
+
+	details := jobspb.ChangefeedDetails{
+		SinkURI: fmt.Sprintf("webhook-%s", sinkDestHost.String()),
+		Opts:    getGenericWebhookSinkOptions().AsMap(),
+	}
+	sinkSrc, err := setupWebhookSinkWithDetails(context.Background(), details, 1, timeutil.DefaultTimeSource{})
+	require.NoError(t, err)
+	testSendAndReceiveRows(t, sinkSrc, sinkDest)
+	require.NoError(t, sinkSrc.Close())
+	require.Less(t, int32(0), atomic.LoadInt32(&proxy.requests))
+
+	// The proxy rejects the sink if it does not authenticate.
+	params.Set(changefeedbase.SinkParamProxyURL, proxy.URL)
+	sinkDestHost.RawQuery = params.Encode()
+	details.SinkURI = fmt.Sprintf("webhook-%s", sinkDestHost.String())
+	sinkSrcNoAuth, err := setupWebhookSinkWithDetails(context.Background(), details, 1, timeutil.DefaultTimeSource{})
+	require.NoError(t, err)
+	require.NoError(t, sinkSrcNoAuth.EmitRow(context.Background(), nil, []byte("[1001]"), []byte("{\"after\":{\"col1\":\"val1\",\"rowid\":1000},\"key\":[1001],\"topic:\":\"foo\"}"), zeroTS, zeroTS, zeroAlloc))
+	require.Regexp(t, `Proxy Authentication Required`, sinkSrcNoAuth.Flush(context.Background()))
+	require.NoError(t, sinkSrcNoAuth.Close())
+
+	// Invalid proxy URLs are rejected when the sink is created.
+	params.Set(changefeedbase.SinkParamProxyURL, `ftp://proxy:21`)
+	sinkDestHost.RawQuery = params.Encode()
+	details.SinkURI = fmt.Sprintf("webhook-%s", sinkDestHost.String())
+	_, err = setupWebhookSinkWithDetails(context.Background(), details, 1, timeutil.DefaultTimeSource{})
+	require.Regexp(t, `param proxy_url has unsupported scheme "ftp"`, err)
+}
+
 func TestWebhookSinkConfig(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -689,3 +740,524 @@ func TestWebhookSinkShutsDownOnError(t *testing.T) {
 		webhookSinkTestfn(i)
 	}
 }
+
+func TestWebhookSinkHostMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+	require.NoError(t, err)
+	sinkDest, err := cdctest.StartMockWebhookSink(cert)
+	require.NoError(t, err)
+	defer sinkDest.Close()
+
+	// Fail the first request, which will be retried.
+	sinkDest.SetStatusCodes([]int{http.StatusInternalServerError, http.StatusOK})
+
+	sinkDestHost, err := url.Parse(sinkDest.URL())
+	require.NoError(t, err)
+	params := sinkDestHost.Query()
+	params.Set(changefeedbase.SinkParamCACert, certEncoded)
+	sinkDestHost.RawQuery = params.Encode()
+	u, err := url.Parse(fmt.Sprintf("webhook-%s", sinkDestHost.String()))
+	require.NoError(t, err)
+
+	opts := getGenericWebhookSinkOptions()
+	encodingOpts, err := opts.GetEncodingOptions()
+	require.NoError(t, err)
+	sinkOpts, err := opts.GetWebhookSinkOptions()
+	require.NoError(t, err)
+
+	agg := newAggregateMetrics(time.Minute)
+	sli, err := agg.getOrCreateScope(defaultSLIScope)
+	require.NoError(t, err)
+	mb := func(_ bool) metricsRecorder { return sli }
+
+	sinkSrc, err := makeWebhookSink(ctx, sinkURL{URL: u}, encodingOpts, sinkOpts, 1,
+		timeutil.DefaultTimeSource{}, &cluster.MakeTestingClusterSettings().SV, mb)
+	require.NoError(t, err)
+	require.NoError(t, sinkSrc.Dial())
+	defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+	require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte("[1001]"), []byte("{\"after\":{\"col1\":\"val1\",\"rowid\":1000},\"key\":[1001],\"topic:\":\"foo\"}"), zeroTS, zeroTS, zeroAlloc))
+	require.NoError(t, sinkSrc.Flush(ctx))
+
+	hm := agg.getOrCreateSinkHost(sinkDestHost.Host)
+	require.EqualValues(t, 1, hm.Errors.Value())
+	require.EqualValues(t, 1, hm.EmittedMessages.Value())
+	require.Less(t, int64(0), hm.EmittedBytes.Value())
+}
+
+func TestWebhookSinkCheckpoints(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	makeSink := func(t *testing.T, sinkDest *cdctest.MockWebhookSink, certEncoded string, config string) Sink {
+		opts := getGenericWebhookSinkOptions(struct {
+			key   string
+			value string
+		}{
+			key:   changefeedbase.OptWebhookSinkConfig,
+			value: config,
+		})
+		sinkDestHost, err := url.Parse(sinkDest.URL())
+		require.NoError(t, err)
+		params := sinkDestHost.Query()
+		params.Set(changefeedbase.SinkParamCACert, certEncoded)
+		sinkDestHost.RawQuery = params.Encode()
+
+		details := jobspb.ChangefeedDetails{
+			SinkURI: fmt.Sprintf("webhook-%s", sinkDestHost.String()),
+			Opts:    opts.AsMap(),
+		}
+		sinkSrc, err := setupWebhookSinkWithDetails(ctx, details, 1 /* parallelism */, timeutil.DefaultTimeSource{})
+		require.NoError(t, err)
+		return sinkSrc
+	}
+
+	t.Run("flush waits for confirmation", func(t *testing.T) {
+		cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+		require.NoError(t, err)
+		sinkDest, err := cdctest.StartMockWebhookSink(cert)
+		require.NoError(t, err)
+		defer sinkDest.Close()
+		// The receiver isn't done processing the batches the first two times
+		// it is asked.
+		sinkDest.EnableCheckpoints(2)
+
+		sinkSrc := makeSink(t, sinkDest, certEncoded,
+			`{"Retry":{"Backoff": "5ms"}, "Checkpoint":{"Enabled": true}}`)
+		defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+		require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte("[1001]"), []byte("{\"after\":{\"col1\":\"val1\",\"rowid\":1000},\"key\":[1001],\"topic:\":\"foo\"}"), zeroTS, zeroTS, zeroAlloc))
+		require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte("[1002]"), []byte("{\"after\":{\"col1\":\"val1\",\"rowid\":1001},\"key\":[1002],\"topic:\":\"foo\"}"), zeroTS, zeroTS, zeroAlloc))
+		require.NoError(t, sinkSrc.Flush(ctx))
+		require.Equal(t, []string{"1", "2"}, sinkDest.ConfirmedCheckpointTokens())
+
+		// Confirmed tokens aren't confirmed again.
+		require.NoError(t, sinkSrc.Flush(ctx))
+		require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte("[1003]"), []byte("{\"after\":{\"col1\":\"val1\",\"rowid\":1002},\"key\":[1003],\"topic:\":\"foo\"}"), zeroTS, zeroTS, zeroAlloc))
+		require.NoError(t, sinkSrc.Flush(ctx))
+		require.Equal(t, []string{"1", "2", "3"}, sinkDest.ConfirmedCheckpointTokens())
+	})
+
+	t.Run("flush fails without confirmation", func(t *testing.T) {
+		cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+		require.NoError(t, err)
+		sinkDest, err := cdctest.StartMockWebhookSink(cert)
+		require.NoError(t, err)
+		defer sinkDest.Close()
+		sinkDest.EnableCheckpoints(math.MaxInt32)
+
+		sinkSrc := makeSink(t, sinkDest, certEncoded,
+			`{"Retry":{"Backoff": "5ms"}, "Checkpoint":{"Enabled": true, "Timeout": "200ms"}}`)
+		defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+		require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte("[1001]"), []byte("{\"after\":{\"col1\":\"val1\",\"rowid\":1000},\"key\":[1001],\"topic:\":\"foo\"}"), zeroTS, zeroTS, zeroAlloc))
+		require.Regexp(t, `webhook receiver did not confirm checkpoint within 200ms`, sinkSrc.Flush(ctx))
+		require.Empty(t, sinkDest.ConfirmedCheckpointTokens())
+	})
+
+	t.Run("responses without tokens", func(t *testing.T) {
+		cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+		require.NoError(t, err)
+		sinkDest, err := cdctest.StartMockWebhookSink(cert)
+		require.NoError(t, err)
+		defer sinkDest.Close()
+
+		sinkSrc := makeSink(t, sinkDest, certEncoded,
+			`{"Retry":{"Backoff": "5ms"}, "Checkpoint":{"Enabled": true, "Timeout": "200ms"}}`)
+		defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+		// Batches to which the receiver responds without a checkpoint token
+		// have been processed, whatever else the body of the response holds.
+		for _, body := range []string{`OK`, `{"status": "ok"}`, `[1]`, `{"checkpoint_token": null}`} {
+			sinkDest.SetResponseBody(body)
+			require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte("[1001]"), []byte("{\"after\":{\"col1\":\"val1\",\"rowid\":1000},\"key\":[1001],\"topic:\":\"foo\"}"), zeroTS, zeroTS, zeroAlloc))
+			require.NoError(t, sinkSrc.Flush(ctx), body)
+		}
+		require.Empty(t, sinkDest.ConfirmedCheckpointTokens())
+
+		// Tokens may be numbers.
+		sinkDest.SetResponseBody(`{"checkpoint_token": 42}`)
+		require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte("[1001]"), []byte("{\"after\":{\"col1\":\"val1\",\"rowid\":1000},\"key\":[1001],\"topic:\":\"foo\"}"), zeroTS, zeroTS, zeroAlloc))
+		require.NoError(t, sinkSrc.Flush(ctx))
+		require.Equal(t, []string{"42"}, sinkDest.ConfirmedCheckpointTokens())
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		sink := &webhookSink{}
+		_, _, err := sink.getWebhookSinkConfig(`{"Checkpoint":{"Timeout": "1s"}}`)
+		require.Regexp(t, `checkpoint timeout is set, but checkpoints are not enabled`, err)
+		_, _, err = sink.getWebhookSinkConfig(`{"Checkpoint":{"Enabled": true, "Timeout": "-1s"}}`)
+		require.Regexp(t, `all config values must be non-negative`, err)
+		cfg, _, err := sink.getWebhookSinkConfig(`{"Checkpoint":{"Enabled": true}}`)
+		require.NoError(t, err)
+		require.Equal(t, jsonDuration(defaultWebhookCheckpointTimeout), cfg.Checkpoint.Timeout)
+	})
+}
+
+func TestWebhookSinkCompression(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	const row = `{"after":{"col1":"val1","rowid":1000},"key":[1001],"topic:":"foo"}`
+	const payload = `{"payload":[` + row + `],"length":1}`
+
+	makeSink := func(
+		t *testing.T, sinkDest *cdctest.MockWebhookSink, certEncoded string, compression string, config string,
+	) (Sink, error) {
+		overrides := []struct{ key, value string }{{key: changefeedbase.OptWebhookSinkConfig, value: config}}
+		if compression != `` {
+			overrides = append(overrides, struct{ key, value string }{key: changefeedbase.OptCompression, value: compression})
+		}
+		opts := getGenericWebhookSinkOptions(overrides...)
+		sinkDestHost, err := url.Parse(sinkDest.URL())
+		require.NoError(t, err)
+		params := sinkDestHost.Query()
+		params.Set(changefeedbase.SinkParamCACert, certEncoded)
+		sinkDestHost.RawQuery = params.Encode()
+
+		details := jobspb.ChangefeedDetails{
+			SinkURI: fmt.Sprintf("webhook-%s", sinkDestHost.String()),
+			Opts:    opts.AsMap(),
+		}
+		return setupWebhookSinkWithDetails(ctx, details, 1 /* parallelism */, timeutil.DefaultTimeSource{})
+	}
+	emitAndFlush := func(t *testing.T, sinkSrc Sink) {
+		require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte("[1001]"), []byte(row), zeroTS, zeroTS, zeroAlloc))
+		require.NoError(t, sinkSrc.Flush(ctx))
+	}
+
+	t.Run("forced", func(t *testing.T) {
+		cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+		require.NoError(t, err)
+		sinkDest, err := cdctest.StartMockWebhookSink(cert)
+		require.NoError(t, err)
+		defer sinkDest.Close()
+
+		sinkSrc, err := makeSink(t, sinkDest, certEncoded, `gzip`, `{"Retry":{"Backoff": "5ms"}}`)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+		emitAndFlush(t, sinkSrc)
+		require.Equal(t, payload, sinkDest.Latest())
+		require.Equal(t, `gzip`, sinkDest.LatestHeader().Get(`Content-Encoding`))
+		require.False(t, sinkDest.LatestChunked())
+	})
+
+	t.Run("chunked", func(t *testing.T) {
+		cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+		require.NoError(t, err)
+		sinkDest, err := cdctest.StartMockWebhookSink(cert)
+		require.NoError(t, err)
+		defer sinkDest.Close()
+
+		sinkSrc, err := makeSink(t, sinkDest, certEncoded, `zstd`,
+			`{"Retry":{"Backoff": "5ms"}, "Chunked":{"Threshold": 10}}`)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+		emitAndFlush(t, sinkSrc)
+		require.Equal(t, payload, sinkDest.Latest())
+		require.Equal(t, `zstd`, sinkDest.LatestHeader().Get(`Content-Encoding`))
+		require.True(t, sinkDest.LatestChunked())
+	})
+
+	t.Run("negotiated", func(t *testing.T) {
+		cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+		require.NoError(t, err)
+		sinkDest, err := cdctest.StartMockWebhookSink(cert)
+		require.NoError(t, err)
+		defer sinkDest.Close()
+		sinkDest.AcceptEncodings(`gzip`)
+
+		sinkSrc, err := makeSink(t, sinkDest, certEncoded, `gzip`,
+			`{"Retry":{"Backoff": "5ms"}, "Compression":{"Negotiate": true}}`)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+		// Bodies are only compressed once the receiver advertised gzip.
+		emitAndFlush(t, sinkSrc)
+		require.Equal(t, payload, sinkDest.Latest())
+		require.Empty(t, sinkDest.LatestHeader().Get(`Content-Encoding`))
+		emitAndFlush(t, sinkSrc)
+		require.Equal(t, payload, sinkDest.Latest())
+		require.Equal(t, `gzip`, sinkDest.LatestHeader().Get(`Content-Encoding`))
+
+		// A compressed body which the receiver rejects is sent again
+		// uncompressed.
+		sinkDest.AcceptEncodings()
+		emitAndFlush(t, sinkSrc)
+		require.Equal(t, payload, sinkDest.Latest())
+		require.Empty(t, sinkDest.LatestHeader().Get(`Content-Encoding`))
+	})
+
+	t.Run("negotiation requires compression", func(t *testing.T) {
+		cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+		require.NoError(t, err)
+		sinkDest, err := cdctest.StartMockWebhookSink(cert)
+		require.NoError(t, err)
+		defer sinkDest.Close()
+
+		_, err = makeSink(t, sinkDest, certEncoded, ``, `{"Compression":{"Negotiate": true}}`)
+		require.Regexp(t, `compression negotiation is set, but compression is not`, err)
+	})
+
+	t.Run("accept encoding", func(t *testing.T) {
+		for _, tc := range []struct {
+			accepted []string
+			expected bool
+		}{
+			{accepted: []string{`gzip`}, expected: true},
+			{accepted: []string{`br, GZIP;q=0.5`}, expected: true},
+			{accepted: []string{`br`, `gzip`}, expected: true},
+			{accepted: []string{`gzip;q=0`}, expected: false},
+			{accepted: []string{`zstd, br`}, expected: false},
+			{accepted: []string{`identity`}, expected: false},
+		} {
+			require.Equal(t, tc.expected, acceptsEncoding(tc.accepted, `gzip`), tc.accepted)
+		}
+	})
+}
+
+func TestWebhookSinkCloudEvents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	const event = `{"data":{"after":{"a":1},"key":[1],"topic":"foo"},"datacontenttype":"application/json",` +
+		`"id":"2.0000000000/[1]","source":"/cockroachdb/changefeed/foo","specversion":"1.0",` +
+		`"subject":"[1]","time":"1970-01-01T00:00:00.000000002Z","type":"com.cockroachlabs.changefeed.row.upsert"}`
+
+	for _, mode := range []changefeedbase.CloudEventsMode{
+		changefeedbase.OptCloudEventsModeStructured,
+		changefeedbase.OptCloudEventsModeBinary,
+	} {
+		t.Run(string(mode), func(t *testing.T) {
+			cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+			require.NoError(t, err)
+			sinkDest, err := cdctest.StartMockWebhookSink(cert)
+			require.NoError(t, err)
+			defer sinkDest.Close()
+
+			opts := getGenericWebhookSinkOptions(
+				struct {
+					key   string
+					value string
+				}{changefeedbase.OptEnvelope, string(changefeedbase.OptEnvelopeCloudEvents)},
+				struct {
+					key   string
+					value string
+				}{changefeedbase.OptCloudEventsMode, string(mode)},
+			)
+			sinkDestHost, err := url.Parse(sinkDest.URL())
+			require.NoError(t, err)
+			params := sinkDestHost.Query()
+			params.Set(changefeedbase.SinkParamCACert, certEncoded)
+			sinkDestHost.RawQuery = params.Encode()
+			details := jobspb.ChangefeedDetails{
+				SinkURI: fmt.Sprintf("webhook-%s", sinkDestHost.String()),
+				Opts:    opts.AsMap(),
+			}
+			sinkSrc, err := setupWebhookSinkWithDetails(ctx, details, 1 /* parallelism */, timeutil.DefaultTimeSource{})
+			require.NoError(t, err)
+			defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+			var pool testAllocPool
+			require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte(`[1]`), []byte(event), zeroTS, zeroTS, pool.alloc()))
+			require.NoError(t, sinkSrc.Flush(ctx))
+			require.EqualValues(t, 0, pool.used())
+
+			encodingOpts, err := opts.GetEncodingOptions()
+			require.NoError(t, err)
+			enc, err := makeJSONEncoder(encodingOpts)
+			require.NoError(t, err)
+			resolved, err := enc.EncodeResolvedTimestamp(ctx, ``, hlc.Timestamp{WallTime: 2})
+			require.NoError(t, err)
+
+			if mode == changefeedbase.OptCloudEventsModeStructured {
+				// Events are sent in batches.
+				require.Equal(t, `[`+event+`]`, sinkDest.Latest())
+				require.Equal(t, `application/cloudevents-batch+json`, sinkDest.LatestHeader().Get(`Content-Type`))
+
+				require.NoError(t, sinkSrc.EmitResolvedTimestamp(ctx, enc, hlc.Timestamp{WallTime: 2}))
+				require.Equal(t, string(resolved), sinkDest.Latest())
+				require.Equal(t, `application/cloudevents+json`, sinkDest.LatestHeader().Get(`Content-Type`))
+				return
+			}
+
+			// The attributes of events are sent as headers.
+			require.Equal(t, `{"after":{"a":1},"key":[1],"topic":"foo"}`, sinkDest.Latest())
+			header := sinkDest.LatestHeader()
+			require.Equal(t, `application/json`, header.Get(`Content-Type`))
+			require.Equal(t, `1.0`, header.Get(`ce-specversion`))
+			require.Equal(t, `2.0000000000/[1]`, header.Get(`ce-id`))
+			require.Equal(t, `/cockroachdb/changefeed/foo`, header.Get(`ce-source`))
+			require.Equal(t, `[1]`, header.Get(`ce-subject`))
+			require.Equal(t, `1970-01-01T00:00:00.000000002Z`, header.Get(`ce-time`))
+			require.Equal(t, `com.cockroachlabs.changefeed.row.upsert`, header.Get(`ce-type`))
+
+			// The event in binary mode carried by the context of a row is sent
+			// as is, rather than converted from the value.
+			eventCtx := withBinaryCloudEvent(ctx, &binaryCloudEvent{
+				attributes:  []cloudEventAttribute{{name: `id`, value: `3.0000000000/[2]`}},
+				contentType: `application/json`,
+				data:        []byte(`{"after":{"a":2}}`),
+			})
+			require.NoError(t, sinkSrc.EmitRow(eventCtx, nil, []byte(`[2]`), []byte(`unparsed`), zeroTS, zeroTS, pool.alloc()))
+			require.NoError(t, sinkSrc.Flush(ctx))
+			require.Equal(t, `{"after":{"a":2}}`, sinkDest.Latest())
+			require.Equal(t, `3.0000000000/[2]`, sinkDest.LatestHeader().Get(`ce-id`))
+
+			require.NoError(t, sinkSrc.EmitResolvedTimestamp(ctx, enc, hlc.Timestamp{WallTime: 2}))
+			require.Equal(t, `{"resolved":"2.0000000000"}`, sinkDest.Latest())
+			require.Equal(t, `com.cockroachlabs.changefeed.resolved`, sinkDest.LatestHeader().Get(`ce-type`))
+		})
+	}
+
+	t.Run("incompatible format", func(t *testing.T) {
+		opts := getGenericWebhookSinkOptions(
+			struct {
+				key   string
+				value string
+			}{changefeedbase.OptEnvelope, string(changefeedbase.OptEnvelopeCloudEvents)},
+			struct {
+				key   string
+				value string
+			}{changefeedbase.OptFormat, string(changefeedbase.OptFormatCSV)},
+		)
+		_, err := opts.GetEncodingOptions()
+		require.EqualError(t, err, `envelope=cloudevents is only usable with format=json`)
+	})
+}
+
+func TestWebhookSinkTraceContext(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+	require.NoError(t, err)
+	sinkDest, err := cdctest.StartMockWebhookSink(cert)
+	require.NoError(t, err)
+	defer sinkDest.Close()
+
+	opts := getGenericWebhookSinkOptions(
+		struct{ key, value string }{changefeedbase.OptTraceContext, ``},
+		struct{ key, value string }{changefeedbase.OptWebhookSinkConfig,
+			`{"Retry":{"Backoff": "5ms"},"Flush":{"Messages": 3, "Frequency": "1h"}}`},
+	)
+	sinkDestHost, err := url.Parse(sinkDest.URL())
+	require.NoError(t, err)
+	params := sinkDestHost.Query()
+	params.Set(changefeedbase.SinkParamCACert, certEncoded)
+	sinkDestHost.RawQuery = params.Encode()
+	details := jobspb.ChangefeedDetails{
+		SinkURI: fmt.Sprintf("webhook-%s", sinkDestHost.String()),
+		Opts:    opts.AsMap(),
+	}
+	sinkSrc, err := setupWebhookSinkWithDetails(ctx, details, 1 /* parallelism */, timeutil.DefaultTimeSource{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, sinkSrc.Close()) }()
+
+	// Rows emitted outside of a sampled trace get no span of their own.
+	tr := tracing.NewTracer()
+	unsampledCtx, unsampled := tr.StartSpanCtx(ctx, `unsampled`, tracing.WithForceRealSpan())
+	defer unsampled.Finish()
+	for _, c := range []context.Context{ctx, unsampledCtx} {
+		rowCtx, sp := startEmitRowSpan(c, tr)
+		require.Nil(t, sp)
+		require.Equal(t, c, rowCtx)
+	}
+
+	// Rows emitted within a sampled trace do, and their messages carry its
+	// traceparent.
+	sampledCtx, sampled := tr.StartSpanCtx(ctx, `sampled`, tracing.WithRecording(tracingpb.RecordingStructured))
+	defer sampled.Finish()
+	spanCtx, sp := startEmitRowSpan(sampledCtx, tr)
+	require.NotNil(t, sp)
+	defer sp.Finish()
+	traceparent := traceParent(spanCtx)
+	require.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-0[01]$`, traceparent)
+	require.Equal(t, fmt.Sprintf(`00-%032x-%016x-00`, uint64(sp.TraceID()), uint64(sp.SpanID())), traceparent)
+
+	// A batch is split so that every request carries the traceparent of all
+	// of its messages.
+	var pool testAllocPool
+	require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte(`[1]`), []byte(`{"after":{"a":1}}`), zeroTS, zeroTS, pool.alloc()))
+	require.NoError(t, sinkSrc.EmitRow(ctx, nil, []byte(`[2]`), []byte(`{"after":{"a":2}}`), zeroTS, zeroTS, pool.alloc()))
+	require.NoError(t, sinkSrc.EmitRow(spanCtx, nil, []byte(`[3]`), []byte(`{"after":{"a":3}}`), zeroTS, zeroTS, pool.alloc()))
+	require.NoError(t, sinkSrc.Flush(ctx))
+	require.Equal(t, 2, sinkDest.GetNumCalls())
+	require.Equal(t, traceparent, sinkDest.LatestHeader().Get(traceParentHeader))
+	require.Equal(t, `{"payload":[{"after":{"a":1}},{"after":{"a":2}}],"length":2}`, sinkDest.Pop())
+	require.Equal(t, `{"payload":[{"after":{"a":3}}],"length":1}`, sinkDest.Pop())
+	require.EqualValues(t, 0, pool.used())
+}
+
+func TestWebhookSinkIdempotencyKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	cert, certEncoded, err := cdctest.NewCACertBase64Encoded()
+	require.NoError(t, err)
+	sinkDest, err := cdctest.StartMockWebhookSink(cert)
+	require.NoError(t, err)
+	defer sinkDest.Close()
+
+	sinkDestHost, err := url.Parse(sinkDest.URL())
+	require.NoError(t, err)
+	params := sinkDestHost.Query()
+	params.Set(changefeedbase.SinkParamCACert, certEncoded)
+	sinkDestHost.RawQuery = params.Encode()
+	details := jobspb.ChangefeedDetails{
+		SinkURI: fmt.Sprintf("webhook-%s", sinkDestHost.String()),
+		Opts:    getGenericWebhookSinkOptions().AsMap(),
+	}
+	makeSink := func() Sink {
+		sinkSrc, err := setupWebhookSinkWithDetails(ctx, details, 1 /* parallelism */, timeutil.DefaultTimeSource{})
+		require.NoError(t, err)
+		return sinkSrc
+	}
+	key := func(msgs ...messagePayload) string {
+		return withIdempotencyKey(nil, msgs).Get(idempotencyKeyHeader)
+	}
+	ts := hlc.Timestamp{WallTime: 1}
+	row := messagePayload{key: []byte(`[1]`), val: []byte(`{"after":{"a":1}}`), mvcc: ts}
+
+	// The key is derived from the contents of the batch, so the retry of a
+	// failed request carries the same key.
+	sinkDest.SetStatusCodes([]int{http.StatusInternalServerError, http.StatusOK})
+	sinkSrc := makeSink()
+	require.NoError(t, sinkSrc.EmitRow(ctx, nil, row.key, row.val, ts, ts, zeroAlloc))
+	require.NoError(t, sinkSrc.Flush(ctx))
+	require.Regexp(t, `^[0-9a-f]{32}$`, sinkDest.LatestHeader().Get(idempotencyKeyHeader))
+	require.Equal(t, key(row), sinkDest.LatestHeader().Get(idempotencyKeyHeader))
+	require.NoError(t, sinkSrc.Close())
+
+	// A batch of the same rows sent after a restart has the same key, and a
+	// batch which differs in any row has another.
+	sinkDest.SetStatusCodes([]int{http.StatusOK})
+	sinkSrc = makeSink()
+	defer func() { require.NoError(t, sinkSrc.Close()) }()
+	require.NoError(t, sinkSrc.EmitRow(ctx, nil, row.key, row.val, ts, ts, zeroAlloc))
+	require.NoError(t, sinkSrc.Flush(ctx))
+	require.Equal(t, key(row), sinkDest.LatestHeader().Get(idempotencyKeyHeader))
+
+	later := hlc.Timestamp{WallTime: 2}
+	require.NoError(t, sinkSrc.EmitRow(ctx, nil, row.key, row.val, later, later, zeroAlloc))
+	require.NoError(t, sinkSrc.Flush(ctx))
+	require.NotEqual(t, key(row), sinkDest.LatestHeader().Get(idempotencyKeyHeader))
+
+	// The keys and values of the messages are delimited.
+	require.NotEqual(t,
+		key(messagePayload{key: []byte(`[1]`), val: []byte(`x`)}),
+		key(messagePayload{key: []byte(`[1]x`)}))
+
+	// Resolved timestamps carry a key too.
+	enc, err := makeJSONEncoder(changefeedbase.EncodingOptions{Format: changefeedbase.OptFormatJSON})
+	require.NoError(t, err)
+	resolved, err := enc.EncodeResolvedTimestamp(ctx, ``, later)
+	require.NoError(t, err)
+	require.NoError(t, sinkSrc.EmitResolvedTimestamp(ctx, enc, later))
+	require.Equal(t, key(messagePayload{val: resolved}), sinkDest.LatestHeader().Get(idempotencyKeyHeader))
+}
@@ -0,0 +1,391 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvclient/kvcoord"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sqlinstance"
+	"github.com/cockroachdb/errors"
+)
+
+// spanAssignmentStrategy is a strategy by which the spans watched by a
+// changefeed are assigned to its aggregators.
+type spanAssignmentStrategy int64
+
+const (
+	// spanAssignmentLeaseholderAffinity assigns each span to the aggregator on
+	// the node of its leaseholder, as partitioned by DistSQL.
+	spanAssignmentLeaseholderAffinity spanAssignmentStrategy = iota
+	// spanAssignmentLocalityBucketed balances the number of ranges across all
+	// the instances in the region of their leaseholders, including instances
+	// which hold no leases.
+	spanAssignmentLocalityBucketed
+	// spanAssignmentBalancedByBytes balances the bytes of the ranges across
+	// the aggregators.
+	spanAssignmentBalancedByBytes
+	// spanAssignmentWriteRate balances the estimated write rate of the ranges
+	// across the aggregators, so that hot tables don't overload one of them.
+	spanAssignmentWriteRate
+)
+
+var spanAssignmentStrategySetting = settings.RegisterEnumSetting(
+	settings.TenantWritable,
+	"changefeed.span_assignment.strategy",
+	"the strategy by which the spans watched by a changefeed are assigned to its aggregators: "+
+		"leaseholder_affinity places each span on the node of its leaseholder, locality_bucketed "+
+		"balances the number of ranges across the nodes of each region, and balanced_by_bytes and "+
+		"write_rate balance the size and estimated write rate of the ranges across the nodes "+
+		"holding their leases",
+	"leaseholder_affinity",
+	map[int64]string{
+		int64(spanAssignmentLeaseholderAffinity): "leaseholder_affinity",
+		int64(spanAssignmentLocalityBucketed):    "locality_bucketed",
+		int64(spanAssignmentBalancedByBytes):     "balanced_by_bytes",
+		int64(spanAssignmentWriteRate):           "write_rate",
+	},
+)
+
+// rangeLoad is the load of a range on the aggregator watching it.
+type rangeLoad struct {
+	// bytes is the total size of the range.
+	bytes int64
+	// writeRate is the estimated write rate of the range, which is the maximum
+	// rate of requests served by its leaseholder. It's negative if the
+	// leaseholder hasn't recorded its rate of requests yet.
+	writeRate float64
+}
+
+// rangeLoadEstimator estimates the load of ranges.
+type rangeLoadEstimator interface {
+	getRangeLoads(ctx context.Context, ranges []roachpb.Span) ([]rangeLoad, error)
+}
+
+type statsLoadEstimator struct {
+	fetcher eval.RangeStatsFetcher
+}
+
+func (e statsLoadEstimator) getRangeLoads(
+	ctx context.Context, ranges []roachpb.Span,
+) ([]rangeLoad, error) {
+	keys := make([]roachpb.Key, len(ranges))
+	for i, r := range ranges {
+		keys[i] = r.Key
+	}
+	stats, err := e.fetcher.RangeStats(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	loads := make([]rangeLoad, len(stats))
+	for i, s := range stats {
+		loads[i] = rangeLoad{bytes: s.MVCCStats.Total(), writeRate: s.MaxQueriesPerSecond}
+	}
+	return loads, nil
+}
+
+// knobLoadEstimator estimates the load of ranges with the
+// EstimateRangeLoad testing knob.
+type knobLoadEstimator func(rangeSpan roachpb.Span) rangeLoad
+
+func (fn knobLoadEstimator) getRangeLoads(
+	_ context.Context, ranges []roachpb.Span,
+) ([]rangeLoad, error) {
+	loads := make([]rangeLoad, len(ranges))
+	for i, r := range ranges {
+		loads[i] = fn(r)
+	}
+	return loads, nil
+}
+
+// assignSpans reassigns the spans partitioned by their leaseholders to the
+// aggregators of a changefeed, according to the
+// changefeed.span_assignment.strategy setting.
+func assignSpans(
+	ctx context.Context,
+	execCtx sql.JobExecContext,
+	dsp *sql.DistSQLPlanner,
+	distSender *kvcoord.DistSender,
+	p []sql.SpanPartition,
+) ([]sql.SpanPartition, error) {
+	cfg := execCtx.ExecCfg()
+	strategy := spanAssignmentStrategy(spanAssignmentStrategySetting.Get(&cfg.Settings.SV))
+	knobs, _ := cfg.DistSQLSrv.TestingKnobs.Changefeed.(*TestingKnobs)
+	if knobs != nil && knobs.SpanAssignmentStrategy != nil {
+		strategy = spanAssignmentStrategy(*knobs.SpanAssignmentStrategy)
+	}
+
+	var estimator rangeLoadEstimator = statsLoadEstimator{fetcher: cfg.RangeStatsFetcher}
+	if knobs != nil && knobs.EstimateRangeLoad != nil {
+		estimator = knobLoadEstimator(knobs.EstimateRangeLoad)
+	}
+
+	var err error
+	sensitivity := rebalanceThreshold.Get(&cfg.Settings.SV)
+	resolver := &distResolver{DistSender: distSender}
+	switch strategy {
+	case spanAssignmentLeaseholderAffinity:
+	case spanAssignmentLocalityBucketed:
+		var instances []sqlinstance.InstanceInfo
+		if instances, err = dsp.GetAllInstancesByLocality(ctx, roachpb.Locality{}); err != nil {
+			return nil, err
+		}
+		p, err = assignSpansByLocality(ctx, resolver, sensitivity, p, instances)
+	case spanAssignmentBalancedByBytes:
+		p, err = assignSpansByLoad(ctx, resolver, estimator, sensitivity, p, func(l rangeLoad) float64 {
+			return float64(l.bytes)
+		})
+	case spanAssignmentWriteRate:
+		p, err = assignSpansByLoad(ctx, resolver, estimator, sensitivity, p, func(l rangeLoad) float64 {
+			return l.writeRate
+		})
+	default:
+		return nil, errors.AssertionFailedf("unknown span assignment strategy %d", strategy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if knobs != nil && knobs.OnSpanAssignment != nil {
+		knobs.OnSpanAssignment(p)
+	}
+	return p, nil
+}
+
+// weightedRange is a range with the load it puts on its aggregator.
+type weightedRange struct {
+	span   roachpb.Span
+	weight float64
+}
+
+// weightedPartition is the set of ranges assigned to an instance.
+type weightedPartition struct {
+	instanceID base.SQLInstanceID
+	ranges     []weightedRange
+	load       float64
+}
+
+func (p *weightedPartition) add(r weightedRange) {
+	p.ranges = append(p.ranges, r)
+	p.load += r.weight
+}
+
+// explodeSpanPartitions resolves the ranges of each span partition, giving
+// each range a weight of 1.
+func explodeSpanPartitions(
+	ctx context.Context, r rangeResolver, p []sql.SpanPartition,
+) ([]weightedPartition, error) {
+	wp := make([]weightedPartition, len(p))
+	for i := range p {
+		ranges, err := r.getRangesForSpans(ctx, p[i].Spans)
+		if err != nil {
+			return nil, err
+		}
+		wp[i].instanceID = p[i].SQLInstanceID
+		for _, rs := range ranges {
+			wp[i].add(weightedRange{span: rs, weight: 1})
+		}
+	}
+	return wp, nil
+}
+
+// collapseWeightedPartitions converts the weighted partitions back into span
+// partitions, merging adjacent ranges, dropping empty partitions and sorting
+// them by instance ID.
+func collapseWeightedPartitions(wp []weightedPartition) []sql.SpanPartition {
+	p := make([]sql.SpanPartition, 0, len(wp))
+	for i := range wp {
+		if len(wp[i].ranges) == 0 {
+			continue
+		}
+		var g roachpb.SpanGroup
+		for _, r := range wp[i].ranges {
+			g.Add(r.span)
+		}
+		p = append(p, sql.SpanPartition{SQLInstanceID: wp[i].instanceID, Spans: g.Slice()})
+	}
+	sort.Slice(p, func(i, j int) bool {
+		return p[i].SQLInstanceID < p[j].SQLInstanceID
+	})
+	return p
+}
+
+// assignSpansByLoad balances the load of the ranges of the given partitions,
+// as weighed by weightFn, across the instances holding their leases. Ranges
+// whose load is unknown are weighed as the average range.
+func assignSpansByLoad(
+	ctx context.Context,
+	r rangeResolver,
+	estimator rangeLoadEstimator,
+	sensitivity float64,
+	p []sql.SpanPartition,
+	weightFn func(rangeLoad) float64,
+) ([]sql.SpanPartition, error) {
+	if len(p) <= 1 {
+		return p, nil
+	}
+	wp, err := explodeSpanPartitions(ctx, r, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var known, total float64
+	for i := range wp {
+		spans := make([]roachpb.Span, len(wp[i].ranges))
+		for j, rng := range wp[i].ranges {
+			spans[j] = rng.span
+		}
+		loads, err := estimator.getRangeLoads(ctx, spans)
+		if err != nil {
+			return nil, err
+		}
+		wp[i].load = 0
+		for j := range wp[i].ranges {
+			w := weightFn(loads[j])
+			wp[i].ranges[j].weight = w
+			if w >= 0 {
+				known++
+				total += w
+				wp[i].load += w
+			}
+		}
+	}
+	if known > 0 {
+		average := total / known
+		for i := range wp {
+			for j := range wp[i].ranges {
+				if wp[i].ranges[j].weight < 0 {
+					wp[i].ranges[j].weight = average
+					wp[i].load += average
+				}
+			}
+		}
+	} else {
+		// Without any estimates, balance the number of ranges.
+		for i := range wp {
+			for j := range wp[i].ranges {
+				wp[i].ranges[j].weight = 1
+			}
+			wp[i].load = float64(len(wp[i].ranges))
+		}
+	}
+
+	balanceWeightedPartitions(wp, sensitivity)
+	return collapseWeightedPartitions(wp), nil
+}
+
+// assignSpansByLocality balances the number of ranges of the given
+// partitions across all the given instances in the region of the instance
+// they're assigned to. Partitions assigned to instances of no region are
+// balanced across all such instances.
+func assignSpansByLocality(
+	ctx context.Context,
+	r rangeResolver,
+	sensitivity float64,
+	p []sql.SpanPartition,
+	instances []sqlinstance.InstanceInfo,
+) ([]sql.SpanPartition, error) {
+	wp, err := explodeSpanPartitions(ctx, r, p)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := make(map[base.SQLInstanceID]string, len(instances))
+	buckets := make(map[string][]weightedPartition)
+	for _, instance := range instances {
+		region, _ := instance.Locality.Find("region")
+		regions[instance.InstanceID] = region
+		buckets[region] = append(buckets[region], weightedPartition{instanceID: instance.InstanceID})
+	}
+	for _, part := range wp {
+		region := regions[part.instanceID]
+		bucket := buckets[region]
+		found := false
+		for i := range bucket {
+			if bucket[i].instanceID == part.instanceID {
+				bucket[i].ranges = append(bucket[i].ranges, part.ranges...)
+				bucket[i].load += part.load
+				found = true
+			}
+		}
+		if !found {
+			// The instance is no longer listed, e.g. because it's shutting down;
+			// keep its ranges with it, as DistSQL deemed it healthy.
+			buckets[region] = append(bucket, part)
+		}
+	}
+
+	var balanced []weightedPartition
+	for _, bucket := range buckets {
+		balanceWeightedPartitions(bucket, sensitivity)
+		balanced = append(balanced, bucket...)
+	}
+	return collapseWeightedPartitions(balanced), nil
+}
+
+// balanceWeightedPartitions moves ranges from the partition with the highest
+// load to the partition with the lowest load while the highest load exceeds
+// the average by more than the given fraction. Each move picks the range
+// which best evens out the two partitions, and strictly reduces the spread
+// of the loads, so that a range too heavy to move stays where it is while the
+// other ranges of its partition move away from it.
+func balanceWeightedPartitions(p []weightedPartition, sensitivity float64) {
+	if len(p) <= 1 {
+		return
+	}
+	var total float64
+	numRanges := 0
+	for i := range p {
+		total += p[i].load
+		numRanges += len(p[i].ranges)
+	}
+	target := (1 + sensitivity) * total / float64(len(p))
+
+	for moves := 0; moves < numRanges; moves++ {
+		from, to := 0, 0
+		for i := range p {
+			if p[i].load > p[from].load {
+				from = i
+			}
+			if p[i].load < p[to].load {
+				to = i
+			}
+		}
+		if p[from].load <= target {
+			return
+		}
+
+		// The ideal range to move evens out the loads of the two partitions.
+		gap := p[from].load - p[to].load
+		best := -1
+		for i, r := range p[from].ranges {
+			if r.weight <= 0 || r.weight >= gap {
+				continue
+			}
+			if best < 0 || math.Abs(gap/2-r.weight) < math.Abs(gap/2-p[from].ranges[best].weight) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return
+		}
+
+		r := p[from].ranges[best]
+		p[from].ranges = append(p[from].ranges[:best], p[from].ranges[best+1:]...)
+		p[from].load -= r.weight
+		p[to].add(r)
+	}
+}
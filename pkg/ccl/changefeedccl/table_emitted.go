@@ -0,0 +1,265 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/span"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// tableEmittedCounts accumulates the messages and bytes a changeAggregator
+// emits for each table, which are reported to the changeFrontier, and
+// records them in the per-table metrics of the changefeed's scope. It is
+// shared by the event consumers of the aggregator.
+//
+// The per-table metrics are labeled by the database- and schema-qualified
+// name of each table as of the statement time, so that tables of the same
+// name in different databases are told apart.
+//
+// Changefeeds emit messages at least once, so after a restart the messages
+// of each span emitted above the timestamp the span resumes from, that of the
+// last checkpoint, are emitted again. The greatest MVCC timestamp emitted for
+// each watched span is reported along with the counts, and those above the
+// checkpoint are persisted with it. Messages whose MVCC timestamp is at or
+// below the one persisted for their span before the aggregator started are
+// counted as duplicates. Since those timestamps are only persisted when the
+// changefeed checkpoints, duplicates of messages emitted after the last
+// checkpoint before a restart aren't counted.
+type tableEmittedCounts struct {
+	metrics *sliMetrics
+	// prevEmitted are the spans which messages were emitted for before the
+	// aggregator started, sorted by key.
+	prevEmitted []jobspb.ChangefeedProgress_EmittedSpan
+	// watches are the spans watched by the aggregator, sorted by key.
+	watches []roachpb.Span
+	// tables are the targets of the changefeed, which hold the names the
+	// per-table metrics are labeled by.
+	tables jobspb.ChangefeedTargets
+
+	mu struct {
+		syncutil.Mutex
+		counts map[descpb.ID]*jobspb.ChangefeedProgress_TableEmitted
+		// maxEmitted is the greatest MVCC timestamp emitted for each of the
+		// watches.
+		maxEmitted []hlc.Timestamp
+		// metrics caches the per-table metrics of each table.
+		metrics map[descpb.ID]*tableMetrics
+	}
+}
+
+func newTableEmittedCounts(
+	metrics *sliMetrics,
+	watches []roachpb.Span,
+	prev []jobspb.ChangefeedProgress_EmittedSpan,
+	tables jobspb.ChangefeedTargets,
+) *tableEmittedCounts {
+	t := &tableEmittedCounts{
+		metrics:     metrics,
+		prevEmitted: append([]jobspb.ChangefeedProgress_EmittedSpan(nil), prev...),
+		watches:     append([]roachpb.Span(nil), watches...),
+		tables:      tables,
+	}
+	sort.Slice(t.prevEmitted, func(i, j int) bool {
+		return t.prevEmitted[i].Span.Key.Compare(t.prevEmitted[j].Span.Key) < 0
+	})
+	sort.Slice(t.watches, func(i, j int) bool { return t.watches[i].Key.Compare(t.watches[j].Key) < 0 })
+	t.mu.counts = make(map[descpb.ID]*jobspb.ChangefeedProgress_TableEmitted)
+	t.mu.maxEmitted = make([]hlc.Timestamp, len(t.watches))
+	t.mu.metrics = make(map[descpb.ID]*tableMetrics)
+	return t
+}
+
+// duplicate returns whether a message for the key with the specified MVCC
+// timestamp had already been emitted before the aggregator started.
+func (t *tableEmittedCounts) duplicate(key roachpb.Key, mvcc hlc.Timestamp) bool {
+	i := sort.Search(len(t.prevEmitted), func(i int) bool {
+		return key.Compare(t.prevEmitted[i].Span.EndKey) < 0
+	})
+	return i < len(t.prevEmitted) && t.prevEmitted[i].Span.ContainsKey(key) &&
+		mvcc.LessEq(t.prevEmitted[i].MaxEmittedMVCC)
+}
+
+// watchIndex returns the index of the watch containing the key, or -1.
+func (t *tableEmittedCounts) watchIndex(key roachpb.Key) int {
+	i := sort.Search(len(t.watches), func(i int) bool {
+		return key.Compare(t.watches[i].EndKey) < 0
+	})
+	if i < len(t.watches) && t.watches[i].ContainsKey(key) {
+		return i
+	}
+	return -1
+}
+
+// tableMetricsLocked returns the per-table metrics of the table described by
+// meta. Changefeeds created before the qualified name of their tables was
+// recorded label them by their unqualified name.
+func (t *tableEmittedCounts) tableMetricsLocked(meta cdcevent.Metadata) *tableMetrics {
+	if tm, ok := t.mu.metrics[meta.TableID]; ok {
+		return tm
+	}
+	label := t.tables[meta.TableID].QualifiedName
+	if label == `` {
+		label = meta.TableName
+	}
+	tm := t.metrics.getTableMetrics(label)
+	t.mu.metrics[meta.TableID] = tm
+	return tm
+}
+
+// record records a message of the specified size and MVCC timestamp emitted
+// for the key of the table described by meta. A nil tableEmittedCounts
+// records nothing.
+func (t *tableEmittedCounts) record(
+	meta cdcevent.Metadata, key roachpb.Key, mvcc hlc.Timestamp, bytes int,
+) {
+	if t == nil {
+		return
+	}
+	duplicate := t.duplicate(key, mvcc)
+	watch := t.watchIndex(key)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics.recordTableEmitted(t.tableMetricsLocked(meta), bytes, duplicate)
+	c, ok := t.mu.counts[meta.TableID]
+	if !ok {
+		c = &jobspb.ChangefeedProgress_TableEmitted{TableID: meta.TableID}
+		t.mu.counts[meta.TableID] = c
+	}
+	c.TableName = meta.TableName
+	c.EmittedMessages++
+	c.EmittedBytes += int64(bytes)
+	if duplicate {
+		c.DuplicateMessages++
+	}
+	if watch >= 0 {
+		t.mu.maxEmitted[watch].Forward(mvcc)
+	}
+}
+
+// drain returns the counts recorded since drain was last called, sorted by
+// table ID.
+func (t *tableEmittedCounts) drain() []jobspb.ChangefeedProgress_TableEmitted {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.mu.counts) == 0 {
+		return nil
+	}
+	counts := make([]jobspb.ChangefeedProgress_TableEmitted, 0, len(t.mu.counts))
+	for id, c := range t.mu.counts {
+		counts = append(counts, *c)
+		delete(t.mu.counts, id)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].TableID < counts[j].TableID })
+	return counts
+}
+
+// drainEmittedSpans returns the greatest MVCC timestamp emitted for each of
+// the watched spans which messages were emitted for since drainEmittedSpans
+// was last called.
+func (t *tableEmittedCounts) drainEmittedSpans() []jobspb.ChangefeedProgress_EmittedSpan {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var emitted []jobspb.ChangefeedProgress_EmittedSpan
+	for i, maxEmitted := range t.mu.maxEmitted {
+		if maxEmitted.IsEmpty() {
+			continue
+		}
+		emitted = append(emitted, jobspb.ChangefeedProgress_EmittedSpan{
+			Span:           t.watches[i],
+			MaxEmittedMVCC: maxEmitted,
+		})
+		t.mu.maxEmitted[i] = hlc.Timestamp{}
+	}
+	return emitted
+}
+
+// addTableEmitted returns a new slice, sorted by table ID, holding the sum of
+// the counts in a and b. The latest name of each table, that in b, is kept.
+func addTableEmitted(
+	a, b []jobspb.ChangefeedProgress_TableEmitted,
+) []jobspb.ChangefeedProgress_TableEmitted {
+	sum := make([]jobspb.ChangefeedProgress_TableEmitted, 0, len(a)+len(b))
+	idx := make(map[descpb.ID]int, len(a)+len(b))
+	for _, counts := range [][]jobspb.ChangefeedProgress_TableEmitted{a, b} {
+		for _, c := range counts {
+			i, ok := idx[c.TableID]
+			if !ok {
+				idx[c.TableID] = len(sum)
+				sum = append(sum, c)
+				continue
+			}
+			sum[i].TableName = c.TableName
+			sum[i].EmittedMessages += c.EmittedMessages
+			sum[i].EmittedBytes += c.EmittedBytes
+			sum[i].DuplicateMessages += c.DuplicateMessages
+		}
+	}
+	sort.Slice(sum, func(i, j int) bool { return sum[i].TableID < sum[j].TableID })
+	return sum
+}
+
+// emittedSpansOverlapping returns the emitted spans, sorted by key, which
+// overlap any of the spans, which must not overlap each other.
+func emittedSpansOverlapping(
+	emitted []jobspb.ChangefeedProgress_EmittedSpan, spans []roachpb.Span,
+) []jobspb.ChangefeedProgress_EmittedSpan {
+	sorted := append([]roachpb.Span(nil), spans...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key.Compare(sorted[j].Key) < 0 })
+	var overlapping []jobspb.ChangefeedProgress_EmittedSpan
+	var j int
+	for _, e := range emitted {
+		for j < len(sorted) && sorted[j].EndKey.Compare(e.Span.Key) <= 0 {
+			j++
+		}
+		if j < len(sorted) && sorted[j].Overlaps(e.Span) {
+			overlapping = append(overlapping, e)
+		}
+	}
+	return overlapping
+}
+
+// emittedSpansProgress returns the entries of emitted, which tracks the
+// greatest MVCC timestamp emitted for each span, above the timestamp the
+// changefeed resumes the span from if it restarts from the high-water and
+// checkpoint. Only the messages of those spans can be emitted again.
+func emittedSpansProgress(
+	emitted *span.Frontier, highWater hlc.Timestamp, checkpoint jobspb.ChangefeedProgress_Checkpoint,
+) []jobspb.ChangefeedProgress_EmittedSpan {
+	var checkpointed roachpb.SpanGroup
+	checkpointed.Add(checkpoint.Spans...)
+	var progress []jobspb.ChangefeedProgress_EmittedSpan
+	emitted.Entries(func(sp roachpb.Span, maxEmitted hlc.Timestamp) span.OpResult {
+		resumeFrom := highWater
+		if checkpointed.Encloses(sp) {
+			resumeFrom.Forward(checkpoint.Timestamp)
+		}
+		if resumeFrom.Less(maxEmitted) {
+			progress = append(progress, jobspb.ChangefeedProgress_EmittedSpan{
+				Span:           sp,
+				MaxEmittedMVCC: maxEmitted,
+			})
+		}
+		return span.ContinueMatch
+	})
+	return progress
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/span"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableEmittedCounts(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	agg := newAggregateMetrics(time.Minute)
+	sli, err := agg.getOrCreateScope(`tables`)
+	require.NoError(t, err)
+
+	ts := func(wt int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wt} }
+	sp := func(start, end string) roachpb.Span {
+		return roachpb.Span{Key: roachpb.Key(start), EndKey: roachpb.Key(end)}
+	}
+
+	// Messages for the keys of [c, d) at or below the greatest timestamp
+	// emitted for it before the restart are duplicates, while those of the
+	// other span of bar, which lagged behind, are not.
+	counts := newTableEmittedCounts(sli,
+		[]roachpb.Span{sp(`e`, `g`), sp(`a`, `c`), sp(`c`, `e`)},
+		[]jobspb.ChangefeedProgress_EmittedSpan{{Span: sp(`c`, `d`), MaxEmittedMVCC: ts(3)}},
+		nil /* tables */)
+	foo := cdcevent.Metadata{TableID: 104, TableName: `foo`}
+	bar := cdcevent.Metadata{TableID: 105, TableName: `bar`}
+	counts.record(bar, roachpb.Key(`c`), ts(3), 10)
+	counts.record(foo, roachpb.Key(`a`), ts(2), 20)
+	counts.record(bar, roachpb.Key(`e`), ts(2), 30)
+
+	drained := counts.drain()
+	require.Equal(t, []jobspb.ChangefeedProgress_TableEmitted{
+		{TableID: 104, TableName: `foo`, EmittedMessages: 1, EmittedBytes: 20},
+		{TableID: 105, TableName: `bar`, EmittedMessages: 2, EmittedBytes: 40, DuplicateMessages: 1},
+	}, drained)
+	require.Nil(t, counts.drain())
+	require.Equal(t, []jobspb.ChangefeedProgress_EmittedSpan{
+		{Span: sp(`a`, `c`), MaxEmittedMVCC: ts(2)},
+		{Span: sp(`c`, `e`), MaxEmittedMVCC: ts(3)},
+		{Span: sp(`e`, `g`), MaxEmittedMVCC: ts(2)},
+	}, counts.drainEmittedSpans())
+	require.Nil(t, counts.drainEmittedSpans())
+
+	tm := agg.getOrCreateTable(`tables`, `bar`)
+	require.EqualValues(t, 2, tm.EmittedMessages.Value())
+	require.EqualValues(t, 40, tm.EmittedBytes.Value())
+	require.EqualValues(t, 1, tm.DuplicateMessages.Value())
+	require.EqualValues(t, 1, sli.DuplicateMessages.Value())
+
+	// Counts are summed by table, keeping the latest table name.
+	renamed := cdcevent.Metadata{TableID: 104, TableName: `baz`}
+	counts.record(renamed, roachpb.Key(`b`), ts(1), 5)
+	require.Equal(t, []jobspb.ChangefeedProgress_TableEmitted{
+		{TableID: 104, TableName: `baz`, EmittedMessages: 2, EmittedBytes: 25},
+		{TableID: 105, TableName: `bar`, EmittedMessages: 2, EmittedBytes: 40, DuplicateMessages: 1},
+	}, addTableEmitted(drained, counts.drain()))
+
+	// Tables are labeled by their qualified name, so that tables of the same
+	// name in different databases are counted apart.
+	qualified := newTableEmittedCounts(sli, nil /* watches */, nil /* prev */, jobspb.ChangefeedTargets{
+		106: {StatementTimeName: `bar`, QualifiedName: `d1.public.bar`},
+		107: {StatementTimeName: `bar`, QualifiedName: `d2.public.bar`},
+	})
+	qualified.record(cdcevent.Metadata{TableID: 106, TableName: `bar`}, roachpb.Key(`a`), ts(1), 7)
+	qualified.record(cdcevent.Metadata{TableID: 107, TableName: `bar`}, roachpb.Key(`b`), ts(1), 9)
+	require.EqualValues(t, 7, agg.getOrCreateTable(`tables`, `d1.public.bar`).EmittedBytes.Value())
+	require.EqualValues(t, 9, agg.getOrCreateTable(`tables`, `d2.public.bar`).EmittedBytes.Value())
+	require.EqualValues(t, 40, tm.EmittedBytes.Value())
+
+	// A nil tableEmittedCounts records nothing.
+	(*tableEmittedCounts)(nil).record(foo, roachpb.Key(`a`), ts(1), 1)
+	require.Nil(t, (*tableEmittedCounts)(nil).drain())
+}
+
+func TestEmittedSpansProgress(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ts := func(wt int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wt} }
+	sp := func(start, end string) roachpb.Span {
+		return roachpb.Span{Key: roachpb.Key(start), EndKey: roachpb.Key(end)}
+	}
+
+	emitted, err := span.MakeFrontier(sp(`a`, `z`))
+	require.NoError(t, err)
+	for _, e := range []jobspb.ChangefeedProgress_EmittedSpan{
+		{Span: sp(`a`, `c`), MaxEmittedMVCC: ts(2)},
+		{Span: sp(`c`, `e`), MaxEmittedMVCC: ts(5)},
+		{Span: sp(`e`, `g`), MaxEmittedMVCC: ts(7)},
+		{Span: sp(`c`, `e`), MaxEmittedMVCC: ts(4)},
+	} {
+		_, err := emitted.Forward(e.Span, e.MaxEmittedMVCC)
+		require.NoError(t, err)
+	}
+
+	// Only the spans emitted above the timestamp they resume from are kept:
+	// the high-water, or the checkpoint timestamp for checkpointed spans.
+	progress := emittedSpansProgress(emitted, ts(3), jobspb.ChangefeedProgress_Checkpoint{
+		Spans:     []roachpb.Span{sp(`e`, `g`)},
+		Timestamp: ts(7),
+	})
+	require.Equal(t, []jobspb.ChangefeedProgress_EmittedSpan{
+		{Span: sp(`c`, `e`), MaxEmittedMVCC: ts(5)},
+	}, progress)
+
+	// Aggregators are only given the spans overlapping their watches.
+	require.Equal(t, progress, emittedSpansOverlapping(progress, []roachpb.Span{sp(`x`, `y`), sp(`d`, `f`)}))
+	require.Nil(t, emittedSpansOverlapping(progress, []roachpb.Span{sp(`a`, `c`), sp(`e`, `g`)}))
+}
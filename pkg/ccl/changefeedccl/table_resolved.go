@@ -0,0 +1,109 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/span"
+	"github.com/cockroachdb/errors"
+)
+
+// tableResolved returns the resolved timestamp of each table watched by the
+// frontier, the minimum resolved timestamp of the table's spans, sorted by
+// table ID. Tables are named after the statement time name of their target in
+// targets.
+func (f *schemaChangeFrontier) tableResolved(
+	codec keys.SQLCodec, targets map[descpb.ID]changefeedbase.Target,
+) []jobspb.ChangefeedProgress_TableResolved {
+	byID := make(map[descpb.ID]hlc.Timestamp)
+	f.Entries(func(s roachpb.Span, ts hlc.Timestamp) span.OpResult {
+		_, id, err := codec.DecodeTablePrefix(s.Key)
+		if err != nil {
+			return span.ContinueMatch
+		}
+		if prev, ok := byID[descpb.ID(id)]; !ok || ts.Less(prev) {
+			byID[descpb.ID(id)] = ts
+		}
+		return span.ContinueMatch
+	})
+
+	resolved := make([]jobspb.ChangefeedProgress_TableResolved, 0, len(byID))
+	for id, ts := range byID {
+		resolved = append(resolved, jobspb.ChangefeedProgress_TableResolved{
+			TableID:   id,
+			TableName: string(targets[id].StatementTimeName),
+			Resolved:  ts,
+		})
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].TableID < resolved[j].TableID })
+	return resolved
+}
+
+// tableResolvedFreq returns the minimum duration between the resolved
+// timestamps emitted to the topics of the table under the resolved_per_table
+// option: that of the interval naming the table, if the intervals are given
+// per table, or freqEmitResolved otherwise. It returns false if the table
+// isn't sent resolved timestamps.
+func (cf *changeFrontier) tableResolvedFreq(id descpb.ID) (time.Duration, bool) {
+	if cf.resolvedTables == nil {
+		return cf.freqEmitResolved, cf.freqEmitResolved != emitNoResolved
+	}
+	target, ok := cf.tableTargets[id]
+	if !ok {
+		return 0, false
+	}
+	for _, t := range cf.resolvedTables {
+		if t.matches(target) {
+			return t.freq, true
+		}
+	}
+	return 0, false
+}
+
+// maybeEmitPerTableResolved emits to the topics of each table its own
+// resolved timestamp as of the last checkpoint, under the resolved_per_table
+// option, so that a table whose spans lag holds back only the resolved
+// timestamps of its own topics. A table is sent one once its resolved
+// timestamp has advanced by its interval since the last one it was sent.
+func (cf *changeFrontier) maybeEmitPerTableResolved() error {
+	sink, ok := cf.sink.(TargetResolvedTimestampSink)
+	if !ok {
+		return errors.AssertionFailedf(`sink does not support per table resolved timestamps`)
+	}
+	boundaryReached := cf.frontier.schemaChangeBoundaryReached()
+	for _, t := range cf.tableResolved {
+		id, resolved := t.TableID, t.Resolved
+		last := cf.tableLastEmitted[id]
+		if resolved.IsEmpty() || resolved.LessEq(last) {
+			continue
+		}
+		freq, ok := cf.tableResolvedFreq(id)
+		if !ok || (!boundaryReached && resolved.GoTime().Sub(last.GoTime()) < freq) {
+			continue
+		}
+		include := func(target changefeedbase.Target) bool { return target.TableID == id }
+		if err := sink.EmitResolvedTimestampForTargets(cf.Ctx(), cf.encoder, resolved, include); err != nil {
+			return err
+		}
+		if log.V(2) {
+			log.Infof(cf.Ctx(), `resolved %s for table %s`, resolved, t.TableName)
+		}
+		cf.tableLastEmitted[id] = resolved
+	}
+	return nil
+}
@@ -184,6 +184,20 @@ func (r *telemetryMetricsRecorder) recordSizeBasedFlush() {
 	r.inner.recordSizeBasedFlush()
 }
 
+func (r *telemetryMetricsRecorder) recordSinkHostIO(
+	host string, startTime time.Time, numMessages int, bytes int, err error,
+) {
+	r.inner.recordSinkHostIO(host, startTime, numMessages, bytes, err)
+}
+
+func (r *telemetryMetricsRecorder) recordKafkaThrottle(throttleTime time.Duration) {
+	r.inner.recordKafkaThrottle(throttleTime)
+}
+
+func (r *telemetryMetricsRecorder) recordCredentialReload() {
+	r.inner.recordCredentialReload()
+}
+
 // ContinuousTelemetryInterval determines the interval at which each node emits telemetry events
 // during the lifespan of each enterprise changefeed.
 var ContinuousTelemetryInterval = settings.RegisterDurationSetting(
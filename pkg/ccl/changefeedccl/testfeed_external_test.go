@@ -0,0 +1,537 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/Shopify/sarama"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdctest"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
+	"github.com/cockroachdb/cockroach/pkg/util/contextutil"
+	"github.com/cockroachdb/cockroach/pkg/util/ctxgroup"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The external feed factories run changefeeds against real sinks rather
+// than in-memory fakes, which exercises the sink implementations and client
+// libraries end-to-end. The external kafka feed emits to a broker it starts
+// in a Docker container (see startKafkaContainer), and is skipped if Docker
+// is unavailable, unless a broker is given by the environment. The external
+// pubsub feed is only used when its environment variable is set. For
+// example, to run against local containers:
+//
+//	docker run -d -p 9092:9092 -e KAFKA_AUTO_CREATE_TOPICS_ENABLE=true ...
+//	docker run -d -p 8085:8085 gcr.io/google.com/cloudsdktool/cloud-sdk:emulators \
+//	  gcloud beta emulators pubsub start --host-port=0.0.0.0:8085
+//
+//	COCKROACH_CHANGEFEED_TEST_KAFKA_BROKERS=localhost:9092 \
+//	PUBSUB_EMULATOR_HOST=localhost:8085 \
+//	./dev test pkg/ccl/changefeedccl -f 'TestChangefeedExternal(Sinks|KafkaDelivery)'
+const (
+	// externalKafkaBrokersEnv is the environment variable holding the address
+	// of a Kafka broker which allows automatic topic creation.
+	externalKafkaBrokersEnv = "COCKROACH_CHANGEFEED_TEST_KAFKA_BROKERS"
+
+	// pubsubEmulatorHostEnv is the environment variable read by the Pub/Sub
+	// client library to connect to the Pub/Sub emulator instead of GCP.
+	pubsubEmulatorHostEnv = "PUBSUB_EMULATOR_HOST"
+
+	// externalPubsubProjectID is the project used with the Pub/Sub emulator,
+	// which accepts any project ID.
+	externalPubsubProjectID = "cdc-test"
+)
+
+// externalFeedPollInterval is how often external feeds check for new topics
+// or partitions to consume.
+const externalFeedPollInterval = 100 * time.Millisecond
+
+// uniqueExternalFeedName returns a name which does not collide with those of
+// earlier feeds, since the external sink may outlive any single test.
+func uniqueExternalFeedName(base string) string {
+	return fmt.Sprintf("%s_%d", base, timeutil.Now().UnixNano())
+}
+
+type externalKafkaFeedFactory struct {
+	enterpriseFeedFactory
+	brokers string
+}
+
+var _ cdctest.ExternalSinkFeedFactory = (*externalKafkaFeedFactory)(nil)
+
+// makeExternalKafkaFeedFactory returns an ExternalSinkFeedFactory
+// implementation emitting to the Kafka broker at the specified address.
+func makeExternalKafkaFeedFactory(
+	srvOrCluster interface{}, db *gosql.DB, brokers string,
+) cdctest.TestFeedFactory {
+	s, injectables := getInjectables(srvOrCluster)
+	return &externalKafkaFeedFactory{
+		brokers: brokers,
+		enterpriseFeedFactory: enterpriseFeedFactory{
+			s:  s,
+			db: db,
+			di: newDepInjector(injectables...),
+		},
+	}
+}
+
+// SinkURI implements cdctest.ExternalSinkFeedFactory
+func (k *externalKafkaFeedFactory) SinkURI() string {
+	return fmt.Sprintf("%s://%s", changefeedbase.SinkSchemeKafka, k.brokers)
+}
+
+// Feed implements cdctest.TestFeedFactory
+func (k *externalKafkaFeedFactory) Feed(
+	create string, args ...interface{},
+) (cdctest.TestFeed, error) {
+	parsed, err := parser.ParseOne(create)
+	if err != nil {
+		return nil, err
+	}
+	createStmt := parsed.AST.(*tree.CreateChangefeed)
+
+	// Topics are prefixed so that this feed only consumes its own messages,
+	// even if the broker is shared with other tests.
+	topicPrefix := uniqueExternalFeedName("cdc") + "_"
+	uri := url.URL{
+		Scheme:   changefeedbase.SinkSchemeKafka,
+		Host:     k.brokers,
+		RawQuery: url.Values{changefeedbase.SinkParamTopicPrefix: {topicPrefix}}.Encode(),
+	}
+	if err := setURI(createStmt, uri.String(), false, &args); err != nil {
+		return nil, err
+	}
+
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+	// Only consume committed messages, so that those of the transactions
+	// aborted by transactional sinks are never returned.
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+	client, err := sarama.NewClient(strings.Split(k.brokers, ","), config)
+	if err != nil {
+		return nil, errors.Wrap(err, "connecting to kafka")
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, errors.CombineErrors(errors.Wrap(err, "creating kafka consumer"), client.Close())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &externalKafkaFeed{
+		jobFeed:        newJobFeed(k.jobsTableConn(), func(s Sink) Sink { return s }),
+		seenTrackerMap: make(map[string]struct{}),
+		topicPrefix:    topicPrefix,
+		client:         client,
+		consumer:       consumer,
+		source:         make(chan *sarama.ConsumerMessage, 1024),
+		cancel:         cancel,
+		g:              ctxgroup.WithContext(ctx),
+	}
+	c.g.GoCtx(c.consumeTopics)
+
+	if err := k.startFeedJob(c.jobFeed, createStmt.String(), args...); err != nil {
+		return nil, errors.CombineErrors(err, c.Close())
+	}
+	return c, nil
+}
+
+// Server implements TestFeedFactory
+func (k *externalKafkaFeedFactory) Server() serverutils.TestTenantInterface {
+	return k.s
+}
+
+type externalKafkaFeed struct {
+	*jobFeed
+	seenTrackerMap
+
+	topicPrefix string
+	client      sarama.Client
+	consumer    sarama.Consumer
+	source      chan *sarama.ConsumerMessage
+
+	cancel func()
+	g      ctxgroup.Group
+
+	mu struct {
+		syncutil.Mutex
+		// consumed tracks the partitions being consumed, per topic.
+		consumed map[string]map[int32]struct{}
+	}
+}
+
+var _ cdctest.TestFeed = (*externalKafkaFeed)(nil)
+
+// consumeTopics polls the broker for topics created by this feed, starting
+// to consume each new partition from the oldest offset.
+func (k *externalKafkaFeed) consumeTopics(ctx context.Context) error {
+	ticker := time.NewTicker(externalFeedPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := k.client.RefreshMetadata(); err != nil {
+			return err
+		}
+		topics, err := k.client.Topics()
+		if err != nil {
+			return err
+		}
+		for _, topic := range topics {
+			if !strings.HasPrefix(topic, k.topicPrefix) {
+				continue
+			}
+			partitions, err := k.client.Partitions(topic)
+			if err != nil {
+				return err
+			}
+			for _, partition := range partitions {
+				if !k.markConsumed(topic, partition) {
+					continue
+				}
+				pc, err := k.consumer.ConsumePartition(topic, partition, sarama.OffsetOldest)
+				if err != nil {
+					return err
+				}
+				k.g.GoCtx(func(ctx context.Context) error {
+					defer pc.AsyncClose()
+					for {
+						select {
+						case <-ctx.Done():
+							return nil
+						case err := <-pc.Errors():
+							return err
+						case msg := <-pc.Messages():
+							select {
+							case <-ctx.Done():
+								return nil
+							case k.source <- msg:
+							}
+						}
+					}
+				})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// markConsumed records that the partition is being consumed, returning
+// false if it already was.
+func (k *externalKafkaFeed) markConsumed(topic string, partition int32) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.mu.consumed == nil {
+		k.mu.consumed = make(map[string]map[int32]struct{})
+	}
+	if k.mu.consumed[topic] == nil {
+		k.mu.consumed[topic] = make(map[int32]struct{})
+	}
+	if _, ok := k.mu.consumed[topic][partition]; ok {
+		return false
+	}
+	k.mu.consumed[topic][partition] = struct{}{}
+	return true
+}
+
+// Partitions implements TestFeed
+func (k *externalKafkaFeed) Partitions() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	seen := make(map[int32]struct{})
+	for _, partitions := range k.mu.consumed {
+		for p := range partitions {
+			seen[p] = struct{}{}
+		}
+	}
+	var partitions []string
+	for p := range seen {
+		partitions = append(partitions, strconv.Itoa(int(p)))
+	}
+	sort.Strings(partitions)
+	return partitions
+}
+
+// Next implements TestFeed
+func (k *externalKafkaFeed) Next() (*cdctest.TestFeedMessage, error) {
+	for {
+		fm, err := k.nextWithDuplicates()
+		if err != nil {
+			return nil, err
+		}
+		if fm.Resolved != nil {
+			return fm, nil
+		}
+		if isNew := k.markSeen(fm); isNew {
+			return fm, nil
+		}
+	}
+}
+
+// nextWithDuplicates returns the next message consumed from the broker,
+// including the duplicates of messages which were already returned, which
+// Next skips.
+func (k *externalKafkaFeed) nextWithDuplicates() (*cdctest.TestFeedMessage, error) {
+	var msg *sarama.ConsumerMessage
+	if err := contextutil.RunWithTimeout(
+		context.Background(), timeoutOp("externalkafka.Next", k.jobID), timeout(),
+		func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-k.shutdown:
+				return k.terminalJobError()
+			case msg = <-k.source:
+				return nil
+			}
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	fm := &cdctest.TestFeedMessage{
+		Topic:     strings.TrimPrefix(msg.Topic, k.topicPrefix),
+		Partition: strconv.Itoa(int(msg.Partition)),
+	}
+	if msg.Key == nil {
+		// It's a resolved timestamp
+		fm.Resolved = msg.Value
+		return fm, nil
+	}
+	// It's a regular message
+	fm.Key, fm.Value = msg.Key, msg.Value
+	return fm, nil
+}
+
+// Close implements TestFeed interface.
+func (k *externalKafkaFeed) Close() error {
+	err := k.jobFeed.Close()
+	k.cancel()
+	err = errors.CombineErrors(err, k.g.Wait())
+	err = errors.CombineErrors(err, k.consumer.Close())
+	return errors.CombineErrors(err, k.client.Close())
+}
+
+type externalPubsubFeedFactory struct {
+	enterpriseFeedFactory
+}
+
+var _ cdctest.ExternalSinkFeedFactory = (*externalPubsubFeedFactory)(nil)
+
+// makeExternalPubsubFeedFactory returns an ExternalSinkFeedFactory
+// implementation emitting to the Pub/Sub emulator named by the
+// PUBSUB_EMULATOR_HOST environment variable.
+func makeExternalPubsubFeedFactory(
+	srvOrCluster interface{}, db *gosql.DB,
+) cdctest.TestFeedFactory {
+	s, injectables := getInjectables(srvOrCluster)
+	return &externalPubsubFeedFactory{
+		enterpriseFeedFactory: enterpriseFeedFactory{
+			s:  s,
+			db: db,
+			di: newDepInjector(injectables...),
+		},
+	}
+}
+
+// SinkURI implements cdctest.ExternalSinkFeedFactory
+func (p *externalPubsubFeedFactory) SinkURI() string {
+	return fmt.Sprintf("%s://%s?region=%s", GcpScheme, externalPubsubProjectID, "emulator")
+}
+
+// Feed implements cdctest.TestFeedFactory
+func (p *externalPubsubFeedFactory) Feed(
+	create string, args ...interface{},
+) (cdctest.TestFeed, error) {
+	parsed, err := parser.ParseOne(create)
+	if err != nil {
+		return nil, err
+	}
+	createStmt := parsed.AST.(*tree.CreateChangefeed)
+	if createStmt.Select != nil {
+		return nil, errors.New("external pubsub feeds do not support changefeed expressions")
+	}
+	if err := setURI(createStmt, p.SinkURI(), false, &args); err != nil {
+		return nil, err
+	}
+
+	// Messages published before a subscription exists are not delivered to
+	// it, so the topics and subscriptions must be created before the
+	// changefeed starts. Topics are named after the target tables; options
+	// which change topic names, such as topic_name, are not supported.
+	var topics []string
+	for _, target := range createStmt.Targets {
+		pattern, err := target.TableName.NormalizeTablePattern()
+		if err != nil {
+			return nil, err
+		}
+		tn, ok := pattern.(*tree.TableName)
+		if !ok {
+			return nil, errors.Errorf("unexpected changefeed target %s", tree.AsString(pattern))
+		}
+		topics = append(topics, tn.Table())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := pubsub.NewClient(ctx, externalPubsubProjectID)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "connecting to pubsub emulator")
+	}
+	c := &externalPubsubFeed{
+		jobFeed:        newJobFeed(p.jobsTableConn(), func(s Sink) Sink { return s }),
+		seenTrackerMap: make(map[string]struct{}),
+		client:         client,
+		source:         make(chan []byte, 1024),
+		cancel:         cancel,
+		g:              ctxgroup.WithContext(ctx),
+	}
+	for _, topic := range topics {
+		sub, err := c.subscribe(ctx, topic)
+		if err != nil {
+			return nil, errors.CombineErrors(err, c.Close())
+		}
+		c.g.GoCtx(func(ctx context.Context) error {
+			return sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+				m.Ack()
+				select {
+				case <-ctx.Done():
+				case c.source <- m.Data:
+				}
+			})
+		})
+	}
+
+	if err := p.startFeedJob(c.jobFeed, createStmt.String(), args...); err != nil {
+		return nil, errors.CombineErrors(err, c.Close())
+	}
+	return c, nil
+}
+
+// Server implements TestFeedFactory
+func (p *externalPubsubFeedFactory) Server() serverutils.TestTenantInterface {
+	return p.s
+}
+
+type externalPubsubFeed struct {
+	*jobFeed
+	seenTrackerMap
+
+	client *pubsub.Client
+	source chan []byte
+
+	cancel func()
+	g      ctxgroup.Group
+}
+
+var _ cdctest.TestFeed = (*externalPubsubFeed)(nil)
+
+// subscribe creates the topic, if it does not already exist, along with a
+// new ordered subscription to it.
+func (p *externalPubsubFeed) subscribe(
+	ctx context.Context, topicName string,
+) (*pubsub.Subscription, error) {
+	topic, err := p.client.CreateTopic(ctx, topicName)
+	if status.Code(err) == codes.AlreadyExists {
+		topic, err = p.client.Topic(topicName), nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating topic %s", topicName)
+	}
+	subName := uniqueExternalFeedName(topicName)
+	sub, err := p.client.CreateSubscription(ctx, subName, pubsub.SubscriptionConfig{
+		Topic:                 topic,
+		EnableMessageOrdering: true,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating subscription %s", subName)
+	}
+	return sub, nil
+}
+
+// Partitions implements TestFeed
+func (p *externalPubsubFeed) Partitions() []string {
+	return []string{``}
+}
+
+// Next implements TestFeed
+func (p *externalPubsubFeed) Next() (*cdctest.TestFeedMessage, error) {
+	for {
+		var data []byte
+		if err := contextutil.RunWithTimeout(
+			context.Background(), timeoutOp("externalpubsub.Next", p.jobID), timeout(),
+			func(ctx context.Context) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-p.shutdown:
+					return p.terminalJobError()
+				case data = <-p.source:
+					return nil
+				}
+			},
+		); err != nil {
+			return nil, err
+		}
+
+		details, err := p.Details()
+		if err != nil {
+			return nil, err
+		}
+		m := &cdctest.TestFeedMessage{}
+		switch v := changefeedbase.FormatType(details.Opts[changefeedbase.OptFormat]); v {
+		case ``, changefeedbase.OptFormatJSON:
+			resolved, err := isResolvedTimestamp(data)
+			if err != nil {
+				return nil, err
+			}
+			if resolved {
+				m.Resolved = data
+				return m, nil
+			}
+			m.Value, m.Key, m.Topic, err = extractJSONMessagePubsub(data)
+			if err != nil {
+				return nil, err
+			}
+			if isNew := p.markSeen(m); !isNew {
+				continue
+			}
+		case changefeedbase.OptFormatCSV:
+			m.Value = data
+		default:
+			return nil, errors.Errorf(`unknown %s: %s`, changefeedbase.OptFormat, v)
+		}
+		return m, nil
+	}
+}
+
+// Close implements TestFeed
+func (p *externalPubsubFeed) Close() error {
+	err := p.jobFeed.Close()
+	p.cancel()
+	err = errors.CombineErrors(err, p.g.Wait())
+	return errors.CombineErrors(err, p.client.Close())
+}
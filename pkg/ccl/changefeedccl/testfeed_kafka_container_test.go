@@ -0,0 +1,132 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/testutils/skip"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/require"
+)
+
+// kafkaContainerImage is the image of the broker started by
+// startKafkaContainer, which runs a single node in KRaft mode.
+const kafkaContainerImage = "apache/kafka:3.7.0"
+
+// kafkaContainerStartTimeout bounds how long startKafkaContainer waits for
+// the broker to accept connections.
+const kafkaContainerStartTimeout = 2 * time.Minute
+
+// startKafkaContainer starts a Kafka broker in a Docker container for the
+// external kafka feed to emit to when externalKafkaBrokersEnv isn't set, and
+// returns its address along with a function which removes the container. The
+// broker allows automatic topic creation and transactions. The test is
+// skipped if Docker isn't available.
+func startKafkaContainer(t *testing.T) (brokers string, cleanup func()) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		skip.IgnoreLintf(t, "docker is unavailable: %v", err)
+	}
+	cli.NegotiateAPIVersion(ctx)
+	if _, err := cli.Ping(ctx); err != nil {
+		_ = cli.Close()
+		skip.IgnoreLintf(t, "docker is unavailable: %v", err)
+	}
+
+	if _, _, err := cli.ImageInspectWithRaw(ctx, kafkaContainerImage); err != nil {
+		log.Infof(ctx, "pulling %s", kafkaContainerImage)
+		rc, err := cli.ImagePull(ctx, kafkaContainerImage, types.ImagePullOptions{})
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+
+	// The broker advertises the address on the host at which its listener is
+	// published, which clients connect to.
+	hostPort, err := freeTCPPort()
+	require.NoError(t, err)
+	brokers = net.JoinHostPort("localhost", strconv.Itoa(hostPort))
+	const kafkaPort = nat.Port("9092/tcp")
+	resp, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image: kafkaContainerImage,
+			Env: []string{
+				"KAFKA_NODE_ID=1",
+				"KAFKA_PROCESS_ROLES=broker,controller",
+				"KAFKA_LISTENERS=PLAINTEXT://:9092,CONTROLLER://:9093",
+				"KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://" + brokers,
+				"KAFKA_CONTROLLER_LISTENER_NAMES=CONTROLLER",
+				"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP=CONTROLLER:PLAINTEXT,PLAINTEXT:PLAINTEXT",
+				"KAFKA_CONTROLLER_QUORUM_VOTERS=1@localhost:9093",
+				"KAFKA_AUTO_CREATE_TOPICS_ENABLE=true",
+				// The internal topics of consumer offsets and transactions are
+				// replicated to the only broker.
+				"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR=1",
+				"KAFKA_TRANSACTION_STATE_LOG_REPLICATION_FACTOR=1",
+				"KAFKA_TRANSACTION_STATE_LOG_MIN_ISR=1",
+			},
+			ExposedPorts: nat.PortSet{kafkaPort: struct{}{}},
+		},
+		&container.HostConfig{
+			PortBindings: nat.PortMap{
+				kafkaPort: {{HostIP: "127.0.0.1", HostPort: strconv.Itoa(hostPort)}},
+			},
+		},
+		nil, nil, fmt.Sprintf("cdc-kafka-%d", hostPort),
+	)
+	require.NoError(t, err)
+	cleanup = func() {
+		if err := cli.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			t.Logf("removing kafka container %s: %v", resp.ID, err)
+		}
+		_ = cli.Close()
+	}
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	if err := testutils.SucceedsWithinError(func() error {
+		c, err := sarama.NewClient([]string{brokers}, sarama.NewConfig())
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}, kafkaContainerStartTimeout); err != nil {
+		cleanup()
+		t.Fatalf("kafka broker in container %s did not start: %v", resp.ID, err)
+	}
+	return brokers, cleanup
+}
+
+// freeTCPPort returns a port on the loopback interface which no listener is
+// bound to.
+func freeTCPPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -1617,16 +1617,27 @@ func (tg *teeGroup) wait() error {
 
 type fakeKafkaClient struct {
 	config *sarama.Config
+	// numPartitions is the number of partitions of every topic, which have a
+	// single partition if it is zero.
+	numPartitions int32
 }
 
 func (c *fakeKafkaClient) Partitions(topic string) ([]int32, error) {
-	return []int32{0}, nil
+	partitions := []int32{0}
+	for p := int32(1); p < c.numPartitions; p++ {
+		partitions = append(partitions, p)
+	}
+	return partitions, nil
 }
 
 func (c *fakeKafkaClient) RefreshMetadata(topics ...string) error {
 	return nil
 }
 
+func (c *fakeKafkaClient) Leader(topic string, partitionID int32) (*sarama.Broker, error) {
+	return nil, sarama.ErrLeaderNotAvailable
+}
+
 func (c *fakeKafkaClient) Close() error {
 	return nil
 }
@@ -1677,7 +1688,7 @@ var _ Sink = (*fakeKafkaSink)(nil)
 func (s *fakeKafkaSink) Dial() error {
 	kafka := s.Sink.(*kafkaSink)
 	kafka.knobs.OverrideClientInit = func(config *sarama.Config) (kafkaClient, error) {
-		client := &fakeKafkaClient{config}
+		client := &fakeKafkaClient{config: config}
 		return client, nil
 	}
 
@@ -1734,6 +1745,18 @@ func (s *fakeKafkaSink) Topics() []string {
 	return nil
 }
 
+// EmitResolvedTimestampForTargets implements the TargetResolvedTimestampSink
+// interface.
+func (s *fakeKafkaSink) EmitResolvedTimestampForTargets(
+	ctx context.Context,
+	encoder Encoder,
+	resolved hlc.Timestamp,
+	include func(changefeedbase.Target) bool,
+) error {
+	return s.Sink.(TargetResolvedTimestampSink).EmitResolvedTimestampForTargets(
+		ctx, encoder, resolved, include)
+}
+
 type kafkaFeedFactory struct {
 	enterpriseFeedFactory
 	knobs *sinkKnobs
@@ -2228,11 +2251,23 @@ func (p *fakePubsubClient) init() error {
 func (p *fakePubsubClient) closeTopics() {
 }
 
-// sendMessage sends a message to the topic
-func (p *fakePubsubClient) sendMessage(m []byte, _ string, _ string) error {
+// publish sends a message to the topic, which is acknowledged immediately.
+func (p *fakePubsubClient) publish(
+	_ context.Context, m []byte, _ string, _ string, _ map[string]string,
+) (pubsubPublishResult, error) {
 	message := mockPubsubMessage{data: string(m)}
 	p.buffer.push(message)
-	return nil
+	return fakePubsubPublishResult{}, nil
+}
+
+// fakePubsubPublishResult is the result of a message published by the
+// fakePubsubClient, or by a test with err set to fail the publish.
+type fakePubsubPublishResult struct {
+	err error
+}
+
+func (r fakePubsubPublishResult) Get(context.Context) (string, error) {
+	return "", r.err
 }
 
 func (p *fakePubsubClient) sendMessageToAllTopics(m []byte) error {
@@ -2255,7 +2290,7 @@ var _ Sink = (*fakePubsubSink)(nil)
 func (p *fakePubsubSink) Dial() error {
 	s := p.Sink.(*pubsubSink)
 	s.client = p.client
-	s.setupWorkers()
+	s.startAckLoop()
 	return nil
 }
 
@@ -0,0 +1,118 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/tabledesc"
+	"github.com/cockroachdb/cockroach/pkg/util/bufalloc"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+// The functions in this file expose the encoders and sinks of changefeeds to
+// the benchmarks of the cdcbench package. They aren't meant for use outside
+// of tests and benchmarks.
+
+// TestingEncoder encodes rows as the changefeed it was made for would.
+type TestingEncoder struct {
+	encoder Encoder
+	scratch bufalloc.ByteAllocator
+}
+
+// TestingMakeEncoder returns the encoder of a changefeed with the given
+// encoding options on the given targets. Avro is encoded with an in-memory
+// schema registry unless one was configured.
+func TestingMakeEncoder(
+	opts changefeedbase.EncodingOptions, targets changefeedbase.Targets,
+) (*TestingEncoder, error) {
+	var reg schemaRegistry
+	if opts.Format == changefeedbase.OptFormatAvro && opts.SchemaRegistryURI == `` {
+		reg = newSinkSchemaRegistry()
+	}
+	encoder, err := getEncoder(opts, targets, reg)
+	if err != nil {
+		return nil, err
+	}
+	if encoder == nil {
+		return nil, errors.Errorf(`format %s is encoded by its sink`, opts.Format)
+	}
+	return &TestingEncoder{encoder: encoder}, nil
+}
+
+// EncodeRow encodes the key and value of a row updated at the given
+// timestamp, copying the key as the event consumer does. The value is only
+// valid until the next call to EncodeRow.
+func (e *TestingEncoder) EncodeRow(
+	ctx context.Context, topic string, updatedRow, prevRow cdcevent.Row, updated hlc.Timestamp,
+) (key, value []byte, _ error) {
+	encodedKey, err := e.encoder.EncodeKey(ctx, updatedRow)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.scratch, key = e.scratch.Copy(encodedKey, 0 /* extraCap */)
+	evCtx := eventContext{updated: updated, mvcc: updated, topic: topic}
+	value, err = e.encoder.EncodeValue(ctx, evCtx, updatedRow, prevRow)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+// TestingMakeTopic returns the topic of a table with the given name, as
+// passed to sinks.
+func TestingMakeTopic(name string, id descpb.ID) TopicDescriptor {
+	tableDesc := tabledesc.NewBuilder(&descpb.TableDescriptor{Name: name, ID: id}).BuildImmutableTable()
+	return &tableDescriptorTopic{
+		Metadata: cdcevent.Metadata{
+			TableID:   tableDesc.GetID(),
+			TableName: tableDesc.GetName(),
+			Version:   tableDesc.GetVersion(),
+		},
+		spec: changefeedbase.Target{
+			Type:              jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY,
+			TableID:           tableDesc.GetID(),
+			StatementTimeName: changefeedbase.StatementTimeName(name),
+		},
+	}
+}
+
+// TestingMakeWebhookSink returns the webhook sink of a changefeed into the
+// given URI with the given options, which include the batching configuration
+// of the sink.
+func TestingMakeWebhookSink(
+	ctx context.Context, sinkURI string, opts map[string]string, sv *settings.Values,
+) (Sink, error) {
+	u, err := url.Parse(sinkURI)
+	if err != nil {
+		return nil, err
+	}
+	if !isWebhookSink(u) {
+		return nil, errors.Errorf(`%s is not a webhook sink URI`, sinkURI)
+	}
+	statementOpts := changefeedbase.MakeStatementOptions(opts)
+	encodingOpts, err := statementOpts.GetEncodingOptions()
+	if err != nil {
+		return nil, err
+	}
+	webhookOpts, err := statementOpts.GetWebhookSinkOptions()
+	if err != nil {
+		return nil, err
+	}
+	return makeWebhookSink(ctx, sinkURL{URL: u}, encodingOpts, webhookOpts,
+		defaultWorkerCount(), timeutil.DefaultTimeSource{}, sv, nilMetricsRecorderBuilder)
+}
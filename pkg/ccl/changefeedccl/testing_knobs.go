@@ -10,9 +10,11 @@ package changefeedccl
 
 import (
 	"context"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/kvfeed"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfrapb"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -48,6 +50,41 @@ type TestingKnobs struct {
 	ShouldReplan func(ctx context.Context, oldPlan, newPlan *sql.PhysicalPlan) bool
 	// RaiseRetryableError is a knob used to possibly return an error.
 	RaiseRetryableError func() error
+	// SpanAssignmentStrategy, if set, overrides the
+	// changefeed.span_assignment.strategy setting.
+	SpanAssignmentStrategy *spanAssignmentStrategy
+	// EstimateRangeLoad, if set, estimates the load of each range for the
+	// span assignment strategies instead of its range stats.
+	EstimateRangeLoad func(rangeSpan roachpb.Span) rangeLoad
+	// OnSpanAssignment is called with the span partitions of the aggregators
+	// of a changefeed once they have been assigned.
+	OnSpanAssignment func(partitions []sql.SpanPartition)
+
+	// The following knobs inject the faults which roachtests provoke with
+	// chaos, so that changefeeds can be tested against them hermetically.
+	// Rangefeed events are dropped with FeedKnobs.ShouldDropValue.
+	//
+	// SinkWriteLatency, if set, returns the latency injected before each write
+	// to the sink of a changefeed: emitting a row or a resolved timestamp, and
+	// flushing.
+	SinkWriteLatency func() time.Duration
+	// StallFrontier, if set, is called with each resolved span received by
+	// the changeFrontier, which drops the span, rather than forwarding its
+	// frontier, while it returns true.
+	StallFrontier func(resolved jobspb.ResolvedSpan) bool
+	// ForceSchemaChangeBackfills lets every new version of the descriptors of
+	// the targets through the schema feed, so that changefeeds backfill after
+	// any schema change under schema_change_policy=backfill, including those
+	// which change no columns.
+	ForceSchemaChangeBackfills bool
+	// ThroughputUpdateFrequency, if set, overrides the length of the windows
+	// over which the changeFrontier measures the rates at which the
+	// changefeed emits.
+	ThroughputUpdateFrequency time.Duration
+	// PubsubClientSkipCredentialsCheck dials gcpubsub sinks without
+	// credentials, so that they connect to the Pub/Sub emulator named by the
+	// PUBSUB_EMULATOR_HOST environment variable.
+	PubsubClientSkipCredentialsCheck bool
 
 	// This is currently used to test negative timestamp in cursor i.e of the form
 	// "-3us". Check TestChangefeedCursor for more info. This function needs to be in the
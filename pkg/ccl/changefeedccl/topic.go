@@ -9,6 +9,7 @@
 package changefeedccl
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
@@ -46,10 +47,12 @@ type TopicIdentifier struct {
 // TopicNamer generates and caches the strings used as topic keys by sinks,
 // using target specifications, options, and sink-specific string manipulation.
 type TopicNamer struct {
-	join       byte
-	prefix     string
-	singleName string
-	sanitize   func(string) string
+	join          byte
+	prefix        string
+	singleName    string
+	familyFormat  string
+	mergeFamilies bool
+	sanitize      func(string) string
 
 	// DisplayNames are initialized once from specs and may contain placeholder strings.
 	DisplayNames map[changefeedbase.Target]string
@@ -100,6 +103,43 @@ func WithSingleName(s string) TopicNameOption {
 	return optSingleName(s)
 }
 
+type optFamilyFormat string
+
+func (o optFamilyFormat) set(tn *TopicNamer) {
+	tn.familyFormat = string(o)
+}
+
+// WithFamilyFormat overrides the default `{table}.{family}` naming of
+// column family topics. The join byte is not used when a format is set.
+func WithFamilyFormat(format string) TopicNameOption {
+	return optFamilyFormat(format)
+}
+
+type optMergeFamilies struct{}
+
+func (o optMergeFamilies) set(tn *TopicNamer) {
+	tn.mergeFamilies = true
+}
+
+// WithMergedFamilies causes all column families of a table to be named
+// after the table alone.
+func WithMergedFamilies() TopicNameOption {
+	return optMergeFamilies{}
+}
+
+// familyTopicNameOptions returns the TopicNameOptions which control the
+// naming of column family topics.
+func familyTopicNameOptions(opts changefeedbase.EncodingOptions) []TopicNameOption {
+	var tnOpts []TopicNameOption
+	if opts.FamilyTopicFormat != `` {
+		tnOpts = append(tnOpts, WithFamilyFormat(opts.FamilyTopicFormat))
+	}
+	if opts.MergeColumnFamilies {
+		tnOpts = append(tnOpts, WithMergedFamilies())
+	}
+	return tnOpts
+}
+
 type optSanitize func(string) string
 
 func (o optSanitize) set(tn *TopicNamer) {
@@ -113,7 +153,8 @@ func WithSanitizeFn(fn func(string) string) TopicNameOption {
 
 // MakeTopicNamer creates a TopicNamer.
 // specs are used to populate DisplayNames and the values iterated over in Each.
-// Add options using WithJoinByte, WithPrefix, WithSingleName, and/or WithSanitizeFn.
+// Add options using WithJoinByte, WithPrefix, WithSingleName, WithFamilyFormat,
+// WithMergedFamilies, and/or WithSanitizeFn.
 func MakeTopicNamer(targets changefeedbase.Targets, opts ...TopicNameOption) (*TopicNamer, error) {
 	tn := &TopicNamer{
 		join:         '.',
@@ -154,7 +195,14 @@ func (tn *TopicNamer) DisplayNamesSlice() []string {
 	if len(tn.sliceCache) > 0 {
 		return tn.sliceCache
 	}
+	// Merged column families share the topic of their table, so several
+	// targets may have the same display name.
+	seen := make(map[string]struct{}, len(tn.DisplayNames))
 	for _, n := range tn.DisplayNames {
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
 		tn.sliceCache = append(tn.sliceCache, n)
 		if tn.singleName != "" {
 			return tn.sliceCache
@@ -165,9 +213,31 @@ func (tn *TopicNamer) DisplayNamesSlice() []string {
 
 // Each is a convenience method that iterates a function over DisplayNamesSlice.
 func (tn *TopicNamer) Each(fn func(string) error) error {
-	for _, name := range tn.DisplayNames {
-		err := fn(name)
-		if tn.singleName != "" || err != nil {
+	for _, name := range tn.DisplayNamesSlice() {
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EachForTargets is like Each, but only iterates over the topics of the
+// targets for which include returns true.
+func (tn *TopicNamer) EachForTargets(
+	include func(changefeedbase.Target) bool, fn func(string) error,
+) error {
+	var names []string
+	seen := make(map[string]struct{})
+	for t, n := range tn.DisplayNames {
+		if _, ok := seen[n]; ok || !include(t) {
+			continue
+		}
+		seen[n] = struct{}{}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn(name); err != nil {
 			return err
 		}
 	}
@@ -178,18 +248,32 @@ func (tn *TopicNamer) Each(fn func(string) error) error {
 // and should use placeholders if necessary. Only necessary in the
 // EACH_FAMILY case as in the COLUMN_FAMILY case we know the name from
 // the spec.
+//
+// A target whose topic was renamed with ALTER CHANGEFEED ... SET TARGET ...
+// TOPIC uses its TopicName in place of its StatementTimeName.
 func (tn *TopicNamer) makeName(s changefeedbase.Target, td TopicDescriptor) (string, error) {
+	targetName := s.StatementTimeName
+	if s.TopicName != "" {
+		targetName = changefeedbase.StatementTimeName(s.TopicName)
+	}
 	switch s.Type {
-	case jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY:
-		return tn.nameFromComponents(s.StatementTimeName), nil
+	case jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY,
+		jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX:
+		return tn.nameFromComponents(targetName), nil
 	case jobspb.ChangefeedTargetSpecification_COLUMN_FAMILY:
-		return tn.nameFromComponents(s.StatementTimeName, s.FamilyName), nil
+		return tn.familyName(targetName, s.FamilyName), nil
 	case jobspb.ChangefeedTargetSpecification_EACH_FAMILY:
 		if td == nil {
-			return tn.nameFromComponents(s.StatementTimeName, familyPlaceholder), nil
+			return tn.familyName(targetName, familyPlaceholder), nil
 		}
 		name, components := td.GetNameComponents()
-		return tn.nameFromComponents(name, components...), nil
+		if s.TopicName != "" {
+			name = targetName
+		}
+		if len(components) != 1 {
+			return tn.nameFromComponents(name, components...), nil
+		}
+		return tn.familyName(name, components[0]), nil
 	default:
 		return "", errors.AssertionFailedf("unrecognized type %s", s.Type)
 	}
@@ -199,6 +283,22 @@ func (tn *TopicNamer) makeDisplayName(s changefeedbase.Target) (string, error) {
 	return tn.makeName(s, nil /* no topic descriptor yet, use placeholders if needed */)
 }
 
+// familyName names the topic of a single column family of a table,
+// respecting WithFamilyFormat and WithMergedFamilies.
+func (tn *TopicNamer) familyName(name changefeedbase.StatementTimeName, family string) string {
+	if tn.mergeFamilies {
+		return tn.nameFromComponents(name)
+	}
+	if tn.familyFormat == "" || tn.singleName != "" {
+		return tn.nameFromComponents(name, family)
+	}
+	formatted := strings.NewReplacer(
+		changefeedbase.FamilyTopicFormatTable, string(name),
+		changefeedbase.FamilyTopicFormatFamily, family,
+	).Replace(tn.familyFormat)
+	return tn.nameFromComponents(changefeedbase.StatementTimeName(formatted))
+}
+
 func (tn *TopicNamer) nameFromComponents(
 	name changefeedbase.StatementTimeName, components ...string,
 ) string {
@@ -317,7 +417,8 @@ func makeTopicDescriptorFromSpec(
 	s changefeedbase.Target, src cdcevent.Metadata,
 ) (TopicDescriptor, error) {
 	switch s.Type {
-	case jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY:
+	case jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY,
+		jobspb.ChangefeedTargetSpecification_SECONDARY_INDEX:
 		return &tableDescriptorTopic{
 			Metadata: src,
 			spec:     s,
@@ -0,0 +1,59 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing/tracingpb"
+)
+
+// traceParentHeader is the header, or attribute, in which messages carry the
+// W3C traceparent of the span which emitted them under the trace_context
+// option (https://www.w3.org/TR/trace-context/#traceparent-header).
+const traceParentHeader = `traceparent`
+
+// emitRowSpanName is the name of the span in which a row is emitted under the
+// trace_context option.
+const emitRowSpanName = `changefeed.emit_row`
+
+// startEmitRowSpan starts the span in which a row is emitted to the sink, if
+// the row is emitted within a sampled trace: one which is being recorded, or
+// exported to an external collector. Otherwise, starting a real span for every
+// row would be too expensive, so the row is emitted without a span of its own,
+// and its message without a traceparent.
+func startEmitRowSpan(ctx context.Context, tr *tracing.Tracer) (context.Context, *tracing.Span) {
+	parent := tracing.SpanFromContext(ctx)
+	if parent == nil || parent.IsNoop() ||
+		(parent.RecordingType() == tracingpb.RecordingOff && !tr.HasExternalSink()) {
+		return ctx, nil
+	}
+	return tr.StartSpanCtx(ctx, emitRowSpanName, tracing.WithParent(parent))
+}
+
+// traceParent returns the W3C traceparent of the span of the given context,
+// or "" if it has none. The IDs of the span are those of its OpenTelemetry
+// span, which is exported and so sampled, if it has one. Otherwise they are
+// the IDs of the span within cockroach, zero-padded, and it is not sampled.
+func traceParent(ctx context.Context) string {
+	sp := tracing.SpanFromContext(ctx)
+	if sp == nil || sp.IsNoop() {
+		return ``
+	}
+	info := sp.Meta().ToProto()
+	if info.Otel != nil {
+		return fmt.Sprintf(`00-%x-%x-01`, info.Otel.TraceID, info.Otel.SpanID)
+	}
+	if info.TraceID == 0 || info.ParentSpanID == 0 {
+		return ``
+	}
+	return fmt.Sprintf(`00-%032x-%016x-00`, uint64(info.TraceID), uint64(info.ParentSpanID))
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package changefeedccl
+
+import "github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+
+// The operations of rows recorded under the mark_ttl_deletes option. The
+// transactions of the row-level TTL job are marked as such, and the mark is
+// recorded with each of their writes and carried by the rangefeed values of
+// those writes, so a delete is designated a TTL delete if and only if it was
+// issued by the TTL job. Rows which expired but were deleted by a statement
+// before the TTL job got to them are plain deletes.
+const (
+	rowOpInsert    = `insert`
+	rowOpUpdate    = `update`
+	rowOpUpsert    = `upsert`
+	rowOpDelete    = `delete`
+	rowOpTTLDelete = `ttl_delete`
+)
+
+// rowOp returns the operation of the change of a row, which is an insert or
+// an update if the previous row of every change is known, and otherwise an
+// upsert. rowLevelTTL is set if the change was written by the TTL job.
+func rowOp(updated, prev cdcevent.Row, rowLevelTTL bool, withDiff bool) string {
+	switch {
+	case updated.IsDeleted() && rowLevelTTL:
+		return rowOpTTLDelete
+	case updated.IsDeleted():
+		return rowOpDelete
+	case !withDiff:
+		return rowOpUpsert
+	case prev.IsInitialized() && !prev.IsDeleted():
+		return rowOpUpdate
+	default:
+		return rowOpInsert
+	}
+}
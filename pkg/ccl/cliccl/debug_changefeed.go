@@ -0,0 +1,176 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package cliccl
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdclib"
+	"github.com/cockroachdb/cockroach/pkg/cli"
+	"github.com/cockroachdb/cockroach/pkg/cli/clierrorplus"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/cobra"
+)
+
+var changefeedReplayOpts struct {
+	after string
+	jobID int64
+}
+
+func init() {
+	changefeedReplayCmd := &cobra.Command{
+		Use:   "changefeed-replay <directory>...",
+		Short: "print the rows buffered by a changefeed with a file sink",
+		Long: `
+Prints the rows and resolved timestamp written by a changefeed with a
+file:///path sink to the segment files in each 'directory', so that they may
+be forwarded to the downstream system once it is reachable. A directory is the
+path of the sink within the external IO directory of a node, or a copy of it.
+
+Each node buffers the rows it emits, while resolved timestamps are only
+written by one of them, once the rows at or below them were written by every
+node. The directories of every node must therefore be given together: the
+rows of all of them are printed first, and then the greatest resolved
+timestamp written by any of them, which the rows printed before it are
+complete up to.
+
+Each row is printed as a line of JSON with its topic, key, value and updated
+timestamp, and the resolved timestamp as a line with only a resolved field.
+Keys and values are printed as JSON for changefeeds with format=json, and as
+base64 encoded strings otherwise. Rows are delivered at least once, so rows
+may be printed more than once.
+
+Specifying --after skips the rows updated at or before the given timestamp,
+such as the last resolved timestamp which was forwarded. If the directories
+hold the segments of more than one changefeed, --job selects the changefeed
+whose rows are printed.
+`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: clierrorplus.MaybeDecorateError(runChangefeedReplay),
+	}
+	cli.DebugCmd.AddCommand(changefeedReplayCmd)
+
+	f := changefeedReplayCmd.Flags()
+	f.StringVar(&changefeedReplayOpts.after, "after", "",
+		"skip rows updated at or before this timestamp, given as a decimal")
+	f.Int64Var(&changefeedReplayOpts.jobID, "job", 0,
+		"the ID of the changefeed job whose rows are printed")
+}
+
+// replayedRow is a row printed by the changefeed-replay command.
+type replayedRow struct {
+	Topic   string      `json:"topic"`
+	Key     interface{} `json:"key"`
+	Value   interface{} `json:"value"`
+	Updated string      `json:"updated"`
+}
+
+// replayedResolved is a resolved timestamp printed by the changefeed-replay
+// command.
+type replayedResolved struct {
+	Resolved string `json:"resolved"`
+}
+
+func runChangefeedReplay(cmd *cobra.Command, args []string) error {
+	var after cdclib.Timestamp
+	if changefeedReplayOpts.after != "" {
+		ts, err := hlc.ParseHLC(changefeedReplayOpts.after)
+		if err != nil {
+			return errors.Wrap(err, "invalid --after timestamp")
+		}
+		after = cdclib.Timestamp{WallTime: ts.WallTime, Logical: ts.Logical}
+	}
+
+	var paths []string
+	jobID := changefeedReplayOpts.jobID
+	for _, dir := range args {
+		names, err := cdclib.ListSegments(dir)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			segmentJobID, ok := cdclib.SegmentJobID(name)
+			if !ok {
+				continue
+			}
+			if jobID == 0 {
+				jobID = segmentJobID
+			} else if segmentJobID != jobID {
+				if changefeedReplayOpts.jobID == 0 {
+					return errors.Errorf(
+						"found the segments of jobs %d and %d; specify one with --job", jobID, segmentJobID)
+				}
+				continue
+			}
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+
+	w := bufio.NewWriter(cmd.OutOrStdout())
+	enc := json.NewEncoder(w)
+	var resolved cdclib.Timestamp
+	for _, path := range paths {
+		if err := replaySegment(path, after, enc, &resolved); err != nil {
+			return errors.Wrapf(err, "replaying segment %s", path)
+		}
+	}
+	if !resolved.IsEmpty() {
+		if err := enc.Encode(replayedResolved{Resolved: resolved.String()}); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// replaySegment prints the rows of the segment file at path, and forwards
+// resolved to the greatest resolved timestamp written to it.
+func replaySegment(
+	path string, after cdclib.Timestamp, enc *json.Encoder, resolved *cdclib.Timestamp,
+) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return cdclib.ReadSegment(f, func(hello cdclib.Hello, m cdclib.Message) error {
+		switch m := m.(type) {
+		case cdclib.Row:
+			if !after.IsEmpty() && !after.Less(m.Updated) {
+				return nil
+			}
+			return enc.Encode(replayedRow{
+				Topic:   m.Topic,
+				Key:     replayedBytes(hello, m.Key),
+				Value:   replayedBytes(hello, m.Value),
+				Updated: m.Updated.String(),
+			})
+		case cdclib.Watermark:
+			if resolved.Less(m.Resolved) {
+				*resolved = m.Resolved
+			}
+		}
+		return nil
+	})
+}
+
+// replayedBytes returns the key or value of a row as JSON if the changefeed
+// encoded it as JSON, or else as bytes, which are printed in base64.
+func replayedBytes(hello cdclib.Hello, b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	if hello.Format == "json" && json.Valid(b) {
+		return json.RawMessage(b)
+	}
+	return b
+}
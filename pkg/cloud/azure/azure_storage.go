@@ -70,10 +70,17 @@ var maxConcurrentUploadBuffers = settings.RegisterIntSetting(
 // EITHER:
 // 1. AZURE_ACCOUNT_KEY (legacy storage-key access), OR
 // 2. All three of AZURE_CLIENT_ID, AZURE_CLIENT_SECRET, AZURE_TENANT_ID (RBAC
-// access).
+// access), OR
+// 3. AZURE_SAS_TOKEN (a shared access signature, scoped and expiring as its
+// issuer sees fit).
 // Alternatively, a user may
-// 3. Use implicit authentication with a managed identity derived from the
-// environment on an Azure cluster host.
+// 4. Use implicit authentication with a managed identity derived from the
+// environment on an Azure cluster host. If AZURE_CLIENT_ID is also provided,
+// the user-assigned managed identity with that client ID is used.
+//
+// Independently of the authentication method, AZURE_BLOB_ENDPOINT may be used
+// to override the blob service endpoint, e.g. to point at the Azurite
+// emulator during testing.
 const (
 	// AzureAccountNameParam is the query parameter for account_name in an azure URI.
 	// Specifically, this is one half of a "bucket" identifier. The other half is the
@@ -99,6 +106,17 @@ const (
 	// _not_ to any CRDB tenant.
 	AzureTenantIDParam = "AZURE_TENANT_ID"
 
+	// Shared access signature identifiers:
+
+	// AzureSASTokenParam is the query parameter for a shared access signature
+	// token in an azure URI. Since the token is itself a query string, it must
+	// be url encoded.
+	AzureSASTokenParam = "AZURE_SAS_TOKEN"
+
+	// AzureBlobEndpointParam is the query parameter used to override the blob
+	// service endpoint in an azure URI, e.g. http://127.0.0.1:10000/account.
+	AzureBlobEndpointParam = "AZURE_BLOB_ENDPOINT"
+
 	scheme = "azure-blob"
 
 	deprecatedScheme                   = "azure"
@@ -112,6 +130,9 @@ func azureAuthMethod(uri *url.URL, consumeURI *cloud.ConsumeURL) (cloudpb.AzureA
 		if uri.Query().Get(AzureAccountKeyParam) != "" {
 			return cloudpb.AzureAuth_LEGACY, nil
 		}
+		if uri.Query().Get(AzureSASTokenParam) != "" {
+			return cloudpb.AzureAuth_SAS, nil
+		}
 		return cloudpb.AzureAuth_EXPLICIT, nil
 	case cloud.AuthParamImplicit:
 		return cloudpb.AzureAuth_IMPLICIT, nil
@@ -141,6 +162,8 @@ func parseAzureURL(
 		ClientID:     azureURL.ConsumeParam(AzureClientIDParam),
 		ClientSecret: azureURL.ConsumeParam(AzureClientSecretParam),
 		TenantID:     azureURL.ConsumeParam(AzureTenantIDParam),
+		SASToken:     strings.TrimPrefix(azureURL.ConsumeParam(AzureSASTokenParam), "?"),
+		Endpoint:     azureURL.ConsumeParam(AzureBlobEndpointParam),
 		Auth:         auth,
 	}
 
@@ -154,36 +177,44 @@ func parseAzureURL(
 		return conf, errors.Errorf("azure uri missing %q parameter", AzureAccountNameParam)
 	}
 
-	const explicitErrMsg = "explicit azure uri requires exactly one authentication method: %q OR all three of %q, %q, and %q"
+	const explicitErrMsg = "explicit azure uri requires exactly one authentication method: %q OR %q OR all three of %q, %q, and %q"
+	explicitErr := func() error {
+		// If the URI params are misconfigured we can't be certain which auth
+		// method was intended, so print a broader error message.
+		return errors.Errorf(explicitErrMsg, AzureAccountKeyParam, AzureSASTokenParam,
+			AzureTenantIDParam, AzureClientIDParam, AzureClientSecretParam)
+	}
+	hasKeyCred := conf.AzureConfig.AccountKey != ""
+	hasSASCred := conf.AzureConfig.SASToken != ""
+	hasARoleCred := conf.AzureConfig.TenantID != "" || conf.AzureConfig.ClientID != "" || conf.AzureConfig.ClientSecret != ""
 	// Validate the authentication parameters are set correctly.
 	switch conf.AzureConfig.Auth {
 	case cloudpb.AzureAuth_LEGACY:
-		hasKeyCred := conf.AzureConfig.AccountKey != ""
-		hasARoleCred := conf.AzureConfig.TenantID != "" || conf.AzureConfig.ClientID != "" || conf.AzureConfig.ClientSecret != ""
-		if !hasKeyCred || hasARoleCred {
-			// If the URI params are misconfigured we can't be certain Legacy Auth
-			// was intended, so print a broader error message.
-			return conf, errors.Errorf(explicitErrMsg, AzureAccountKeyParam, AzureTenantIDParam, AzureClientIDParam, AzureClientSecretParam)
+		if !hasKeyCred || hasSASCred || hasARoleCred {
+			return conf, explicitErr()
+		}
+	case cloudpb.AzureAuth_SAS:
+		if !hasSASCred || hasKeyCred || hasARoleCred {
+			return conf, explicitErr()
 		}
 	case cloudpb.AzureAuth_EXPLICIT:
-		hasKeyCred := conf.AzureConfig.AccountKey != ""
 		hasAllRoleCreds := conf.AzureConfig.TenantID != "" && conf.AzureConfig.ClientID != "" && conf.AzureConfig.ClientSecret != ""
-		if hasKeyCred || !hasAllRoleCreds {
-			// If the URI params are misconfigured we can't be certain Explicit Auth
-			// was intended, so print a broader error message.
-			return conf, errors.Errorf(explicitErrMsg, AzureAccountKeyParam, AzureTenantIDParam, AzureClientIDParam, AzureClientSecretParam)
+		if hasKeyCred || hasSASCred || !hasAllRoleCreds {
+			return conf, explicitErr()
 		}
 	case cloudpb.AzureAuth_IMPLICIT:
+		// NB: AZURE_CLIENT_ID is permitted and selects a user-assigned managed
+		// identity.
 		unsupportedParams := make([]string, 0)
 		if conf.AzureConfig.AccountKey != "" {
 			unsupportedParams = append(unsupportedParams, AzureAccountKeyParam)
 		}
+		if conf.AzureConfig.SASToken != "" {
+			unsupportedParams = append(unsupportedParams, AzureSASTokenParam)
+		}
 		if conf.AzureConfig.TenantID != "" {
 			unsupportedParams = append(unsupportedParams, AzureTenantIDParam)
 		}
-		if conf.AzureConfig.ClientID != "" {
-			unsupportedParams = append(unsupportedParams, AzureClientIDParam)
-		}
 		if conf.AzureConfig.ClientSecret != "" {
 			unsupportedParams = append(unsupportedParams, AzureClientSecretParam)
 		}
@@ -226,6 +257,12 @@ func makeAzureStorage(
 	if err != nil {
 		return nil, errors.Wrap(err, "azure: account name is not valid")
 	}
+	if conf.Endpoint != "" {
+		u, err = url.Parse(conf.Endpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "azure: blob endpoint is not valid")
+		}
+	}
 
 	var azClient *service.Client
 	switch conf.Auth {
@@ -238,6 +275,15 @@ func makeAzureStorage(
 		if err != nil {
 			return nil, err
 		}
+	case cloudpb.AzureAuth_SAS:
+		// A SAS token is carried in the query string of every request, so no
+		// credential is required.
+		sasURL := *u
+		sasURL.RawQuery = conf.SASToken
+		azClient, err = service.NewClientWithNoCredential(sasURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
 	case cloudpb.AzureAuth_EXPLICIT:
 		credential, err := azidentity.NewClientSecretCredential(conf.TenantID, conf.ClientID, conf.ClientSecret, nil)
 		if err != nil {
@@ -252,12 +298,23 @@ func makeAzureStorage(
 			return nil, errors.New(
 				"implicit credentials disallowed for azure due to --external-io-implicit-credentials flag")
 		}
-		// The Default credential supports env vars and managed identity magic.
-		// We rely on the former for testing and the latter in prod.
-		// https://learn.microsoft.com/en-us/dotnet/api/azure.identity.defaultazurecredential
-		credential, err := azidentity.NewDefaultAzureCredential(nil)
-		if err != nil {
-			return nil, errors.Wrap(err, "azure default credential")
+		var credential azcore.TokenCredential
+		if conf.ClientID != "" {
+			// A client ID selects a specific user-assigned managed identity.
+			credential, err = azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
+				ID: azidentity.ClientID(conf.ClientID),
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "azure managed identity credential")
+			}
+		} else {
+			// The Default credential supports env vars and managed identity magic.
+			// We rely on the former for testing and the latter in prod.
+			// https://learn.microsoft.com/en-us/dotnet/api/azure.identity.defaultazurecredential
+			credential, err = azidentity.NewDefaultAzureCredential(nil)
+			if err != nil {
+				return nil, errors.Wrap(err, "azure default credential")
+			}
 		}
 		azClient, err = service.NewClient(u.String(), credential, nil)
 		if err != nil {
@@ -412,5 +469,5 @@ func (s *azureStorage) Close() error {
 
 func init() {
 	cloud.RegisterExternalStorageProvider(cloudpb.ExternalStorageProvider_azure,
-		parseAzureURL, makeAzureStorage, cloud.RedactedParams(AzureAccountKeyParam), scheme, deprecatedScheme, deprecatedExternalConnectionScheme)
+		parseAzureURL, makeAzureStorage, cloud.RedactedParams(AzureAccountKeyParam, AzureSASTokenParam), scheme, deprecatedScheme, deprecatedExternalConnectionScheme)
 }
@@ -229,6 +229,57 @@ func TestParseAzureURL(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("Parses SAS token auth param", func(t *testing.T) {
+		u, err := url.Parse("azure://container/path?AZURE_ACCOUNT_NAME=account&AZURE_SAS_TOKEN=" +
+			url.QueryEscape("?sv=2021-06-08&ss=b&sig=abc"))
+		require.NoError(t, err)
+
+		sut, err := parseAzureURL(cloud.ExternalStorageURIContext{}, u)
+		require.NoError(t, err)
+
+		require.Equal(t, cloudpb.AzureAuth_SAS, sut.AzureConfig.Auth)
+		require.Equal(t, "sv=2021-06-08&ss=b&sig=abc", sut.AzureConfig.SASToken)
+	})
+
+	t.Run("Rejects combined SAS token and ACCOUNT_KEY", func(t *testing.T) {
+		u, err := url.Parse("azure://container/path?AZURE_ACCOUNT_NAME=account&AZURE_ACCOUNT_KEY=key&AZURE_SAS_TOKEN=sig%3Dabc")
+		require.NoError(t, err)
+
+		_, err = parseAzureURL(cloud.ExternalStorageURIContext{}, u)
+		require.Error(t, err)
+	})
+
+	t.Run("Parses implicit auth with user-assigned managed identity", func(t *testing.T) {
+		u, err := url.Parse("azure://container/path?AZURE_ACCOUNT_NAME=account&AUTH=implicit&AZURE_CLIENT_ID=client")
+		require.NoError(t, err)
+
+		sut, err := parseAzureURL(cloud.ExternalStorageURIContext{}, u)
+		require.NoError(t, err)
+
+		require.Equal(t, cloudpb.AzureAuth_IMPLICIT, sut.AzureConfig.Auth)
+		require.Equal(t, "client", sut.AzureConfig.ClientID)
+	})
+
+	t.Run("Rejects implicit auth with client secret", func(t *testing.T) {
+		u, err := url.Parse("azure://container/path?AZURE_ACCOUNT_NAME=account&AUTH=implicit&AZURE_CLIENT_ID=client&AZURE_CLIENT_SECRET=secret")
+		require.NoError(t, err)
+
+		_, err = parseAzureURL(cloud.ExternalStorageURIContext{}, u)
+		require.Error(t, err)
+	})
+
+	t.Run("Parses AZURE_BLOB_ENDPOINT", func(t *testing.T) {
+		u, err := url.Parse("azure://container/path?AZURE_ACCOUNT_NAME=account&AZURE_ACCOUNT_KEY=key&AZURE_BLOB_ENDPOINT=" +
+			url.QueryEscape("http://127.0.0.1:10000/account"))
+		require.NoError(t, err)
+
+		sut, err := parseAzureURL(cloud.ExternalStorageURIContext{}, u)
+		require.NoError(t, err)
+
+		require.Equal(t, "http://127.0.0.1:10000/account", sut.AzureConfig.Endpoint)
+		require.False(t, sut.AccessIsWithExplicitAuth())
+	})
+
 	t.Run("Can Override AZURE_ENVIRONMENT", func(t *testing.T) {
 		u, err := url.Parse("azure-storage://container/path?AZURE_ACCOUNT_NAME=account&AZURE_ACCOUNT_KEY=key&AZURE_ENVIRONMENT=AzureUSGovernmentCloud")
 		require.NoError(t, err)
@@ -264,3 +315,20 @@ func TestMakeAzureStorageURLFromEnvironment(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeAzureStorageWithEndpointAndSAS(t *testing.T) {
+	sut, err := makeAzureStorage(context.Background(), cloud.ExternalStorageContext{}, cloudpb.ExternalStorage{
+		AzureConfig: &cloudpb.ExternalStorage_Azure{
+			Container:   "container",
+			Prefix:      "path",
+			AccountName: "account",
+			Environment: azure.PublicCloud.Name,
+			Endpoint:    "http://127.0.0.1:10000/account",
+			SASToken:    "sv=2021-06-08&sig=abc",
+			Auth:        cloudpb.AzureAuth_SAS,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "http://127.0.0.1:10000/account/container?sv=2021-06-08&sig=abc",
+		sut.(*azureStorage).container.URL())
+}
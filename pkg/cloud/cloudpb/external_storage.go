@@ -41,7 +41,13 @@ func (m *ExternalStorage) AccessIsWithExplicitAuth() bool {
 	case ExternalStorageProvider_gs:
 		return m.GoogleCloudConfig.Auth == ExternalStorageAuthSpecified
 	case ExternalStorageProvider_azure:
-		return m.AzureConfig.Auth == AzureAuth_LEGACY || m.AzureConfig.Auth == AzureAuth_EXPLICIT
+		// As with s3, a custom endpoint could be a network resource only
+		// accessible via this node's network context.
+		if m.AzureConfig.Endpoint != "" {
+			return false
+		}
+		return m.AzureConfig.Auth == AzureAuth_LEGACY || m.AzureConfig.Auth == AzureAuth_EXPLICIT ||
+			m.AzureConfig.Auth == AzureAuth_SAS
 	case ExternalStorageProvider_userfile:
 		// userfile always checks the user performing the action has grants on the
 		// table used.
@@ -52,6 +58,12 @@ func (m *ExternalStorage) AccessIsWithExplicitAuth() bool {
 		// Arbitrary network endpoints may be accessible only via the node and thus
 		// make use of its implicit access to them.
 		return false
+	case ExternalStorageProvider_sftp:
+		// As with http, the server may be reachable only from the node's network.
+		return false
+	case ExternalStorageProvider_databricks:
+		// The workspace is always accessed with the token in the URI.
+		return true
 	case ExternalStorageProvider_nodelocal:
 		// The node's local filesystem is obviously accessed implicitly as the node.
 		return false
@@ -0,0 +1,429 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package databricks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/cloud/cloudpb"
+	"github.com/cockroachdb/cockroach/pkg/server/telemetry"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/util/contextutil"
+	"github.com/cockroachdb/cockroach/pkg/util/ioctx"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/cockroachdb/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A databricks URI has the form
+//
+//	databricks://<workspace-host>/Volumes/<catalog>/<schema>/<volume>/<path>?DATABRICKS_TOKEN=...
+//
+// Files are stored in the Unity Catalog volume through the Files API of the
+// workspace. If DATABRICKS_WAREHOUSE_ID is set, changefeeds writing to the
+// volume additionally register a table for each of their topics, in the
+// catalog and schema of the volume, using the SQL warehouse with that ID.
+const (
+	// TokenParam is the query parameter for the personal access token, or
+	// OAuth access token, used to authenticate to the workspace.
+	TokenParam = "DATABRICKS_TOKEN"
+	// WarehouseIDParam is the query parameter for the ID of the SQL warehouse
+	// used to register tables over the files written to the volume.
+	WarehouseIDParam = "DATABRICKS_WAREHOUSE_ID"
+
+	scheme = "databricks"
+
+	volumesDir = "/Volumes"
+)
+
+func parseDatabricksURL(
+	_ cloud.ExternalStorageURIContext, uri *url.URL,
+) (cloudpb.ExternalStorage, error) {
+	databricksURL := cloud.ConsumeURL{URL: uri}
+	conf := cloudpb.ExternalStorage{}
+	conf.Provider = cloudpb.ExternalStorageProvider_databricks
+	conf.DatabricksConfig = &cloudpb.ExternalStorage_Databricks{
+		Host:        uri.Host,
+		Prefix:      path.Clean("/" + uri.Path),
+		Token:       databricksURL.ConsumeParam(TokenParam),
+		WarehouseID: databricksURL.ConsumeParam(WarehouseIDParam),
+	}
+
+	// Validate that all the passed in parameters are supported.
+	if unknownParams := databricksURL.RemainingQueryParams(); len(unknownParams) > 0 {
+		return cloudpb.ExternalStorage{}, errors.Errorf(
+			`unknown databricks query parameters: %s`, strings.Join(unknownParams, ", "))
+	}
+
+	if conf.DatabricksConfig.Host == "" {
+		return conf, errors.New("databricks uri missing workspace host")
+	}
+	if conf.DatabricksConfig.Token == "" {
+		return conf, errors.Errorf("databricks uri missing %q parameter", TokenParam)
+	}
+	if _, err := parseVolume(conf.DatabricksConfig.Prefix); err != nil {
+		return conf, err
+	}
+	return conf, nil
+}
+
+// volume identifies a Unity Catalog volume.
+type volume struct {
+	catalog, schema, name string
+}
+
+// parseVolume returns the volume which holds the given path, which must be of
+// the form /Volumes/<catalog>/<schema>/<volume>/...
+func parseVolume(p string) (volume, error) {
+	parts := strings.Split(strings.TrimPrefix(p, volumesDir+"/"), "/")
+	if !strings.HasPrefix(p, volumesDir+"/") || len(parts) < 3 ||
+		parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return volume{}, errors.Errorf(
+			"databricks uri path %q must be within a volume, "+
+				"i.e. of the form /Volumes/<catalog>/<schema>/<volume>/...", p)
+	}
+	return volume{catalog: parts[0], schema: parts[1], name: parts[2]}, nil
+}
+
+type databricksStorage struct {
+	conf     *cloudpb.ExternalStorage_Databricks
+	ioConf   base.ExternalIODirConfig
+	client   *http.Client
+	settings *cluster.Settings
+	// base is the URL of the workspace.
+	base   *url.URL
+	prefix string
+}
+
+var _ cloud.ExternalStorage = &databricksStorage{}
+
+func makeDatabricksStorage(
+	_ context.Context, args cloud.ExternalStorageContext, dest cloudpb.ExternalStorage,
+) (cloud.ExternalStorage, error) {
+	telemetry.Count("external-io.databricks")
+	conf := dest.DatabricksConfig
+	if conf == nil {
+		return nil, errors.Errorf("databricks upload requested but info missing")
+	}
+	return newDatabricksStorage(conf, args.IOConf, args.Settings)
+}
+
+func newDatabricksStorage(
+	conf *cloudpb.ExternalStorage_Databricks,
+	ioConf base.ExternalIODirConfig,
+	settings *cluster.Settings,
+) (*databricksStorage, error) {
+	client, err := cloud.MakeHTTPClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	return &databricksStorage{
+		conf:     conf,
+		ioConf:   ioConf,
+		client:   client,
+		settings: settings,
+		base:     &url.URL{Scheme: "https", Host: conf.Host},
+		prefix:   conf.Prefix,
+	}, nil
+}
+
+func (s *databricksStorage) Conf() cloudpb.ExternalStorage {
+	return cloudpb.ExternalStorage{
+		Provider:         cloudpb.ExternalStorageProvider_databricks,
+		DatabricksConfig: s.conf,
+	}
+}
+
+func (s *databricksStorage) ExternalIOConf() base.ExternalIODirConfig {
+	return s.ioConf
+}
+
+func (s *databricksStorage) RequiresExternalIOAccounting() bool { return true }
+
+func (s *databricksStorage) Settings() *cluster.Settings {
+	return s.settings
+}
+
+// Writer uploads the file through the Files API, which creates its parent
+// directories if they do not exist, and only makes the file visible once it
+// has been uploaded in full.
+func (s *databricksStorage) Writer(ctx context.Context, basename string) (io.WriteCloser, error) {
+	ctx, sp := tracing.ChildSpan(ctx, "databricks.Writer")
+	name := path.Join(s.prefix, basename)
+	sp.SetTag("path", attribute.StringValue(name))
+	return cloud.BackgroundPipe(ctx, func(ctx context.Context, r io.Reader) error {
+		defer sp.Finish()
+		resp, err := s.req(ctx, http.MethodPut, filesEndpoint(name),
+			url.Values{"overwrite": []string{"true"}}, r, nil)
+		if err != nil {
+			return errors.Wrap(err, "uploading databricks file")
+		}
+		return resp.Body.Close()
+	}), nil
+}
+
+// ReadFile is shorthand for ReadFileAt with offset 0.
+func (s *databricksStorage) ReadFile(
+	ctx context.Context, basename string,
+) (ioctx.ReadCloserCtx, error) {
+	reader, _, err := s.ReadFileAt(ctx, basename, 0)
+	return reader, err
+}
+
+func (s *databricksStorage) ReadFileAt(
+	ctx context.Context, basename string, offset int64,
+) (ioctx.ReadCloserCtx, int64, error) {
+	ctx, sp := tracing.ChildSpan(ctx, "databricks.ReadFileAt")
+	defer sp.Finish()
+	name := path.Join(s.prefix, basename)
+	sp.SetTag("path", attribute.StringValue(name))
+
+	var headers map[string]string
+	if offset > 0 {
+		headers = map[string]string{"Range": fmt.Sprintf("bytes=%d-", offset)}
+	}
+	resp, err := s.req(ctx, http.MethodGet, filesEndpoint(name), nil, nil, headers)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := resp.ContentLength
+	if offset > 0 {
+		if size, err = cloud.CheckHTTPContentRangeHeader(
+			resp.Header.Get("Content-Range"), offset); err != nil {
+			_ = resp.Body.Close()
+			return nil, 0, err
+		}
+	}
+	return ioctx.ReadCloserAdapter(resp.Body), size, nil
+}
+
+// directoryEntry is an entry of the response of the list directory contents
+// endpoint of the Files API.
+type directoryEntry struct {
+	Path        string `json:"path"`
+	IsDirectory bool   `json:"is_directory"`
+}
+
+func (s *databricksStorage) List(
+	ctx context.Context, prefix, delim string, fn cloud.ListingFn,
+) error {
+	ctx, sp := tracing.ChildSpan(ctx, "databricks.List")
+	defer sp.Finish()
+
+	dest := cloud.JoinPathPreservingTrailingSlash(s.prefix, prefix)
+	sp.SetTag("path", attribute.StringValue(dest))
+
+	var res []string
+	collect := func(name string) {
+		if strings.HasPrefix(name, dest) {
+			res = append(res, name)
+		}
+	}
+	err := s.walk(ctx, strings.TrimSuffix(dest, "/"), collect)
+	// As with nodelocal, a prefix which is not a directory lists the files of
+	// its parent directory that it prefixes.
+	if errors.Is(err, cloud.ErrFileDoesNotExist) && !strings.HasSuffix(dest, "/") {
+		res = nil
+		err = s.walk(ctx, path.Dir(dest), collect)
+	}
+	if err != nil {
+		if errors.Is(err, cloud.ErrFileDoesNotExist) {
+			return nil
+		}
+		return errors.Wrap(err, "unable to list files in databricks volume")
+	}
+
+	// Sort results so that we can group as we go.
+	sort.Strings(res)
+	var prevPrefix string
+	for _, f := range res {
+		f = strings.TrimPrefix(f, dest)
+		if delim != "" {
+			if i := strings.Index(f, delim); i >= 0 {
+				f = f[:i+len(delim)]
+			}
+			if f == prevPrefix {
+				continue
+			}
+			prevPrefix = f
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls fn with the path of every file under dir.
+func (s *databricksStorage) walk(ctx context.Context, dir string, fn func(string)) error {
+	var pageToken string
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var params url.Values
+		if pageToken != "" {
+			params = url.Values{"page_token": []string{pageToken}}
+		}
+		var page struct {
+			Contents      []directoryEntry `json:"contents"`
+			NextPageToken string           `json:"next_page_token"`
+		}
+		if err := s.getJSON(ctx, directoriesEndpoint(dir), params, &page); err != nil {
+			return err
+		}
+		for _, e := range page.Contents {
+			if e.IsDirectory {
+				if err := s.walk(ctx, e.Path, fn); err != nil {
+					return err
+				}
+				continue
+			}
+			fn(e.Path)
+		}
+		if page.NextPageToken == "" {
+			return nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (s *databricksStorage) Delete(ctx context.Context, basename string) error {
+	return contextutil.RunWithTimeout(ctx, fmt.Sprintf("DELETE %s", basename),
+		cloud.Timeout.Get(&s.settings.SV), func(ctx context.Context) error {
+			resp, err := s.req(ctx, http.MethodDelete,
+				filesEndpoint(path.Join(s.prefix, basename)), nil, nil, nil)
+			if err != nil {
+				return errors.Wrap(err, "delete file")
+			}
+			return resp.Body.Close()
+		})
+}
+
+func (s *databricksStorage) Size(ctx context.Context, basename string) (int64, error) {
+	var resp *http.Response
+	if err := contextutil.RunWithTimeout(ctx, fmt.Sprintf("HEAD %s", basename),
+		cloud.Timeout.Get(&s.settings.SV), func(ctx context.Context) error {
+			var err error
+			resp, err = s.req(ctx, http.MethodHead,
+				filesEndpoint(path.Join(s.prefix, basename)), nil, nil, nil)
+			return err
+		}); err != nil {
+		return 0, errors.Wrap(err, "get file properties")
+	}
+	_ = resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return 0, errors.Errorf("bad ContentLength: %d", resp.ContentLength)
+	}
+	return resp.ContentLength, nil
+}
+
+// Close is part of the cloud.ExternalStorage interface.
+func (s *databricksStorage) Close() error {
+	return nil
+}
+
+// filesEndpoint returns the path of the endpoint of the Files API for the file
+// with the given path.
+func filesEndpoint(name string) string {
+	return "/api/2.0/fs/files" + name
+}
+
+// directoriesEndpoint returns the path of the endpoint of the Files API for
+// the directory with the given path.
+func directoriesEndpoint(dir string) string {
+	return "/api/2.0/fs/directories" + dir
+}
+
+// apiError is the body of the error responses of the Databricks REST API.
+type apiError struct {
+	ErrorCode string `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// getJSON decodes the JSON response to a GET request of the endpoint into
+// res.
+func (s *databricksStorage) getJSON(
+	ctx context.Context, endpoint string, params url.Values, res interface{},
+) error {
+	resp, err := s.req(ctx, http.MethodGet, endpoint, params, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(res), "decoding response of %s", endpoint)
+}
+
+// req sends a request to the endpoint of the REST API of the workspace. The
+// body of the response must be closed by the caller if no error is returned.
+func (s *databricksStorage) req(
+	ctx context.Context,
+	method, endpoint string,
+	params url.Values,
+	body io.Reader,
+	headers map[string]string,
+) (*http.Response, error) {
+	dest := *s.base
+	dest.Path = endpoint
+	dest.RawQuery = params.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, dest.String(), body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error constructing request %s %q", method, endpoint)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.conf.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	for key, val := range headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", method, endpoint)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	respBody, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	var apiErr apiError
+	if json.Unmarshal(respBody, &apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = string(respBody)
+	}
+	err = errors.Errorf("error response from databricks: %s %s: %s %s",
+		method, endpoint, resp.Status, apiErr.Message)
+	if resp.StatusCode == http.StatusNotFound {
+		// nolint:errwrap
+		err = errors.Wrapf(
+			errors.Wrap(cloud.ErrFileDoesNotExist, "databricks file does not exist"),
+			"%v",
+			err.Error(),
+		)
+	}
+	return nil, err
+}
+
+func init() {
+	cloud.RegisterExternalStorageProvider(cloudpb.ExternalStorageProvider_databricks,
+		parseDatabricksURL, makeDatabricksStorage, cloud.RedactedParams(TokenParam), scheme)
+}
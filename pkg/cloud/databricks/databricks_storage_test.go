@@ -0,0 +1,205 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package databricks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/util/ioctx"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/stretchr/testify/require"
+)
+
+// mockWorkspace serves the subset of the Files API and of the statement
+// execution API used by the storage.
+type mockWorkspace struct {
+	mu struct {
+		syncutil.Mutex
+		files      map[string][]byte
+		statements []string
+	}
+}
+
+func (w *mockWorkspace) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	writeError := func(status int, code string) {
+		rw.WriteHeader(status)
+		_ = json.NewEncoder(rw).Encode(apiError{ErrorCode: code, Message: code})
+	}
+	switch p := r.URL.Path; {
+	case strings.HasPrefix(p, filesEndpoint("")):
+		name := strings.TrimPrefix(p, filesEndpoint(""))
+		switch r.Method {
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			w.mu.files[name] = b
+		case http.MethodGet, http.MethodHead:
+			b, ok := w.mu.files[name]
+			if !ok {
+				writeError(http.StatusNotFound, "NOT_FOUND")
+				return
+			}
+			http.ServeContent(rw, r, name, time.Time{}, strings.NewReader(string(b)))
+		case http.MethodDelete:
+			delete(w.mu.files, name)
+		}
+	case strings.HasPrefix(p, directoriesEndpoint("")):
+		dir := strings.TrimPrefix(p, directoriesEndpoint(""))
+		var contents []directoryEntry
+		seen := make(map[string]bool)
+		for name := range w.mu.files {
+			if !strings.HasPrefix(name, dir+"/") {
+				continue
+			}
+			child := dir + "/" + strings.SplitN(strings.TrimPrefix(name, dir+"/"), "/", 2)[0]
+			if !seen[child] {
+				seen[child] = true
+				contents = append(contents, directoryEntry{Path: child, IsDirectory: child != name})
+			}
+		}
+		if len(contents) == 0 {
+			writeError(http.StatusNotFound, "NOT_FOUND")
+			return
+		}
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{"contents": contents})
+	case p == statementsEndpoint:
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.mu.statements = append(w.mu.statements, req["statement"])
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"statement_id": "1", "status": map[string]string{"state": "RUNNING"},
+		})
+	case p == path.Join(statementsEndpoint, "1"):
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"statement_id": "1", "status": map[string]string{"state": "SUCCEEDED"},
+		})
+	default:
+		writeError(http.StatusNotFound, "ENDPOINT_NOT_FOUND")
+	}
+}
+
+func TestDatabricksStorage(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	workspace := &mockWorkspace{}
+	workspace.mu.files = make(map[string][]byte)
+	srv := httptest.NewServer(workspace)
+	defer srv.Close()
+	srvURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	uri := `databricks://workspace.cloud.databricks.com/Volumes/main/cdc/landing/feed` +
+		`?DATABRICKS_TOKEN=secret&DATABRICKS_WAREHOUSE_ID=abc`
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	conf, err := parseDatabricksURL(cloud.ExternalStorageURIContext{}, u)
+	require.NoError(t, err)
+	require.Equal(t, `/Volumes/main/cdc/landing/feed`, conf.DatabricksConfig.Prefix)
+
+	settings := cluster.MakeTestingClusterSettings()
+	s, err := makeDatabricksStorage(ctx, cloud.ExternalStorageContext{
+		IOConf:   base.ExternalIODirConfig{},
+		Settings: settings,
+	}, conf)
+	require.NoError(t, err)
+	storage := s.(*databricksStorage)
+	storage.base = srvURL
+	defer func() { require.NoError(t, s.Close()) }()
+
+	for _, name := range []string{`2023-01-01/a.ndjson`, `2023-01-01/b.ndjson`, `2023-01-02/c.ndjson`} {
+		require.NoError(t, cloud.WriteFile(ctx, s, name, strings.NewReader(`{"a":1}`)))
+	}
+	require.Contains(t, workspace.mu.files, `/Volumes/main/cdc/landing/feed/2023-01-01/a.ndjson`)
+
+	r, size, err := s.ReadFileAt(ctx, `2023-01-01/a.ndjson`, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 7, size)
+	b, err := ioctx.ReadAll(ctx, r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close(ctx))
+	require.Equal(t, `a":1}`, string(b))
+
+	size, err = s.Size(ctx, `2023-01-02/c.ndjson`)
+	require.NoError(t, err)
+	require.EqualValues(t, 7, size)
+
+	_, err = s.ReadFile(ctx, `missing`)
+	require.ErrorIs(t, err, cloud.ErrFileDoesNotExist)
+
+	list := func(prefix, delim string) []string {
+		var res []string
+		require.NoError(t, s.List(ctx, prefix, delim, func(f string) error {
+			res = append(res, f)
+			return nil
+		}))
+		sort.Strings(res)
+		return res
+	}
+	require.Equal(t, []string{`/2023-01-01/a.ndjson`, `/2023-01-01/b.ndjson`, `/2023-01-02/c.ndjson`},
+		list(``, ``))
+	require.Equal(t, []string{`a.ndjson`, `b.ndjson`}, list(`2023-01-01/`, ``))
+	require.Equal(t, []string{`-01/`, `-02/`}, list(`2023-01`, `/`))
+	require.Empty(t, list(`2024`, ``))
+
+	require.NoError(t, s.Delete(ctx, `2023-01-02/c.ndjson`))
+	require.NotContains(t, workspace.mu.files, `/Volumes/main/cdc/landing/feed/2023-01-02/c.ndjson`)
+
+	t.Run("register table", func(t *testing.T) {
+		registrar, ok, err := MakeTableRegistrar(s)
+		require.NoError(t, err)
+		require.True(t, ok)
+		registrar.storage.base = srvURL
+		require.NoError(t, registrar.RegisterTable(ctx, `foo`, `json`, `*-foo-*.ndjson`))
+		require.Equal(t, []string{"CREATE VIEW IF NOT EXISTS `main`.`cdc`.`foo` AS SELECT * " +
+			"FROM read_files('/Volumes/main/cdc/landing/feed', format => 'json', " +
+			"recursiveFileLookup => true, pathGlobFilter => '*-foo-*.ndjson')"},
+			workspace.mu.statements)
+	})
+
+	t.Run("invalid uris", func(t *testing.T) {
+		for _, tc := range []struct {
+			uri string
+			err string
+		}{
+			{`databricks:///Volumes/a/b/c?DATABRICKS_TOKEN=t`, `missing workspace host`},
+			{`databricks://host/Volumes/a/b/c`, `missing "DATABRICKS_TOKEN" parameter`},
+			{`databricks://host/Volumes/a/b?DATABRICKS_TOKEN=t`, `must be within a volume`},
+			{`databricks://host/dbfs/a?DATABRICKS_TOKEN=t`, `must be within a volume`},
+			{`databricks://host/Volumes/a/b/c?DATABRICKS_TOKEN=t&foo=bar`,
+				`unknown databricks query parameters: foo`},
+		} {
+			u, err := url.Parse(tc.uri)
+			require.NoError(t, err)
+			_, err = parseDatabricksURL(cloud.ExternalStorageURIContext{}, u)
+			require.ErrorContains(t, err, tc.err, tc.uri)
+		}
+	})
+}
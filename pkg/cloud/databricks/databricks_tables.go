@@ -0,0 +1,140 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package databricks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/cloud/cloudpb"
+	"github.com/cockroachdb/cockroach/pkg/util/retry"
+	"github.com/cockroachdb/errors"
+)
+
+const statementsEndpoint = "/api/2.0/sql/statements"
+
+// TableRegistrar registers tables in Unity Catalog over the files written to
+// a volume, so that they are discoverable in the catalog rather than only as
+// raw files.
+type TableRegistrar struct {
+	storage *databricksStorage
+	volume  volume
+}
+
+// MakeTableRegistrar returns a TableRegistrar for the volume of the given
+// storage, or false if the storage is not a databricks storage with a SQL
+// warehouse with which to register tables.
+func MakeTableRegistrar(es cloud.ExternalStorage) (*TableRegistrar, bool, error) {
+	conf := es.Conf()
+	if conf.Provider != cloudpb.ExternalStorageProvider_databricks ||
+		conf.DatabricksConfig.WarehouseID == "" {
+		return nil, false, nil
+	}
+	s, err := newDatabricksStorage(conf.DatabricksConfig, es.ExternalIOConf(), es.Settings())
+	if err != nil {
+		return nil, false, err
+	}
+	v, err := parseVolume(conf.DatabricksConfig.Prefix)
+	if err != nil {
+		return nil, false, err
+	}
+	return &TableRegistrar{storage: s, volume: v}, true, nil
+}
+
+// RegisterTable creates, unless it exists, a view with the given name in the
+// catalog and schema of the volume, which reads the files under the path of
+// the storage whose names match glob. The files are read with the read_files
+// table-valued function, in the given format, e.g. json or parquet.
+//
+// A view over read_files is used, rather than an external table, because Unity
+// Catalog does not allow tables to be located within volumes.
+func (r *TableRegistrar) RegisterTable(ctx context.Context, name, format, glob string) error {
+	stmt := fmt.Sprintf(
+		`CREATE VIEW IF NOT EXISTS %s.%s.%s AS SELECT * FROM read_files(%s, `+
+			`format => %s, recursiveFileLookup => true, pathGlobFilter => %s)`,
+		quoteIdent(r.volume.catalog), quoteIdent(r.volume.schema), quoteIdent(name),
+		quoteString(r.storage.prefix), quoteString(format), quoteString(glob))
+	return r.storage.executeStatement(ctx, stmt)
+}
+
+// statementResponse is the response of the statement execution API.
+type statementResponse struct {
+	StatementID string `json:"statement_id"`
+	Status      struct {
+		State string    `json:"state"`
+		Error *apiError `json:"error"`
+	} `json:"status"`
+}
+
+// executeStatement runs the SQL statement on the warehouse of the storage,
+// waiting for it to complete.
+func (s *databricksStorage) executeStatement(ctx context.Context, stmt string) error {
+	body, err := json.Marshal(map[string]string{
+		"warehouse_id":    s.conf.WarehouseID,
+		"statement":       stmt,
+		"wait_timeout":    "30s",
+		"on_wait_timeout": "CONTINUE",
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := s.req(ctx, http.MethodPost, statementsEndpoint, nil, bytes.NewReader(body),
+		map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return errors.Wrap(err, "executing databricks statement")
+	}
+	var res statementResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	_ = resp.Body.Close()
+	if err != nil {
+		return errors.Wrap(err, "decoding databricks statement response")
+	}
+
+	// Statements which are still running once the wait timeout elapses are
+	// polled until they complete.
+	for r := retry.StartWithCtx(ctx, retry.Options{
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+	}); r.Next(); {
+		switch res.Status.State {
+		case "SUCCEEDED":
+			return nil
+		case "PENDING", "RUNNING":
+		default:
+			msg := res.Status.State
+			if res.Status.Error != nil {
+				msg = fmt.Sprintf("%s: %s", res.Status.Error.ErrorCode, res.Status.Error.Message)
+			}
+			return errors.Errorf("databricks statement %s failed: %s", res.StatementID, msg)
+		}
+		if err := s.getJSON(ctx, path.Join(statementsEndpoint, res.StatementID), nil, &res); err != nil {
+			return errors.Wrap(err, "polling databricks statement")
+		}
+	}
+	return ctx.Err()
+}
+
+// quoteIdent quotes an identifier of Databricks SQL.
+func quoteIdent(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// quoteString quotes a string literal of Databricks SQL.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -24,7 +24,7 @@ func (d *ConnectionDetails) Type() ConnectionType {
 		ConnectionProvider_webhookhttp, ConnectionProvider_webhookhttps, ConnectionProvider_gcpubsub:
 		// Changefeed sink providers are TypeStorage for now because they overlap with backup storage providers.
 		return TypeStorage
-	case ConnectionProvider_sql:
+	case ConnectionProvider_sql, ConnectionProvider_confluent_schema_registry:
 		return TypeForeignData
 	default:
 		panic(errors.AssertionFailedf("ConnectionDetails.Type called on a details with an unknown type: %s", d.Provider.String()))
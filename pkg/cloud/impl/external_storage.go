@@ -19,10 +19,12 @@ import (
 	// Import all the cloud provider packages to register them.
 	_ "github.com/cockroachdb/cockroach/pkg/cloud/amazon"
 	_ "github.com/cockroachdb/cockroach/pkg/cloud/azure"
+	_ "github.com/cockroachdb/cockroach/pkg/cloud/databricks"
 	_ "github.com/cockroachdb/cockroach/pkg/cloud/externalconn"
 	_ "github.com/cockroachdb/cockroach/pkg/cloud/gcp"
 	_ "github.com/cockroachdb/cockroach/pkg/cloud/httpsink"
 	_ "github.com/cockroachdb/cockroach/pkg/cloud/nodelocal"
 	_ "github.com/cockroachdb/cockroach/pkg/cloud/nullsink"
+	_ "github.com/cockroachdb/cockroach/pkg/cloud/sftp"
 	_ "github.com/cockroachdb/cockroach/pkg/cloud/userfile"
 )
@@ -0,0 +1,465 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package sftp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// This file implements the subset of version 3 of the SSH File Transfer
+// Protocol (draft-ietf-secsh-filexfer-02), which is the version spoken by
+// OpenSSH and most other servers, that is needed by the sftp ExternalStorage.
+// Requests are issued one at a time.
+
+const sftpProtocolVersion = 3
+
+// Packet types.
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+	fxpExtended = 200
+)
+
+// Status codes.
+const (
+	fxOK         = 0
+	fxEOF        = 1
+	fxNoSuchFile = 2
+)
+
+// Flags of SSH_FXP_OPEN.
+const (
+	fxfRead  = 0x01
+	fxfWrite = 0x02
+	fxfCreat = 0x08
+	fxfTrunc = 0x10
+)
+
+// Flags of file attributes.
+const (
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+)
+
+// posixRenameExtension is the OpenSSH extension which renames over an
+// existing file, which a plain SSH_FXP_RENAME is not allowed to do.
+const posixRenameExtension = "posix-rename@openssh.com"
+
+// maxDataLength bounds the data of read and write requests. Servers are
+// required to accept packets of at least 34000 bytes.
+const maxDataLength = 32 << 10
+
+// maxPacketLength bounds the responses accepted from the server, matching the
+// limit of OpenSSH.
+const maxPacketLength = 256 << 10
+
+// statusError is an SSH_FXP_STATUS response other than SSH_FX_OK.
+type statusError struct {
+	code uint32
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("sftp: %s (status %d)", e.msg, e.code)
+}
+
+func isStatus(err error, code uint32) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code == code
+}
+
+// fileAttrs are the attributes of a file reported by the server.
+type fileAttrs struct {
+	size  uint64
+	perms uint32
+}
+
+func (a fileAttrs) isDir() bool {
+	const typeMask, typeDir = 0170000, 0040000
+	return a.perms&typeMask == typeDir
+}
+
+// sftpClient is a client of the SFTP subsystem of an SSH connection.
+type sftpClient struct {
+	conn    *ssh.Client
+	session *ssh.Session
+	w       io.WriteCloser
+	r       io.Reader
+
+	// extensions are the extensions advertised by the server.
+	extensions map[string]string
+
+	mu struct {
+		syncutil.Mutex
+		nextID uint32
+	}
+}
+
+func newSFTPClient(conn *ssh.Client) (*sftpClient, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	c := &sftpClient{conn: conn, session: session}
+	if c.w, err = session.StdinPipe(); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	if c.r, err = session.StdoutPipe(); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		_ = session.Close()
+		return nil, errors.Wrap(err, "requesting sftp subsystem")
+	}
+	if err := c.init(); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *sftpClient) init() error {
+	var b sftpBuf
+	b.putUint32(sftpProtocolVersion)
+	if err := c.writePacket(fxpInit, b); err != nil {
+		return err
+	}
+	typ, resp, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if typ != fxpVersion {
+		return errors.Errorf("sftp: unexpected packet type %d in response to init", typ)
+	}
+	if version := resp.getUint32(); version != sftpProtocolVersion {
+		return errors.Errorf("sftp: unsupported protocol version %d", version)
+	}
+	c.extensions = make(map[string]string)
+	for len(resp.b) > 0 && resp.err == nil {
+		name := resp.getString()
+		c.extensions[name] = resp.getString()
+	}
+	return resp.err
+}
+
+// Close closes the SFTP session and the underlying SSH connection.
+func (c *sftpClient) Close() error {
+	_ = c.session.Close()
+	return c.conn.Close()
+}
+
+func (c *sftpClient) writePacket(typ byte, payload sftpBuf) error {
+	hdr := make([]byte, 5, 5+len(payload.b))
+	binary.BigEndian.PutUint32(hdr, uint32(1+len(payload.b)))
+	hdr[4] = typ
+	_, err := c.w.Write(append(hdr, payload.b...))
+	return err
+}
+
+func (c *sftpClient) readPacket() (byte, *sftpBuf, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(hdr[:4])
+	if length < 1 || length > maxPacketLength {
+		return 0, nil, errors.Errorf("sftp: invalid packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], &sftpBuf{b: payload}, nil
+}
+
+// request sends a request of the given type, whose payload is built by fn
+// after the request ID, and returns the type and payload of the response
+// following the request ID.
+func (c *sftpClient) request(typ byte, fn func(b *sftpBuf)) (byte, *sftpBuf, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mu.nextID++
+	id := c.mu.nextID
+
+	var b sftpBuf
+	b.putUint32(id)
+	fn(&b)
+	if err := c.writePacket(typ, b); err != nil {
+		return 0, nil, err
+	}
+	respTyp, resp, err := c.readPacket()
+	if err != nil {
+		return 0, nil, err
+	}
+	if respID := resp.getUint32(); resp.err == nil && respID != id {
+		return 0, nil, errors.Errorf("sftp: response to request %d while expecting %d", respID, id)
+	}
+	if respTyp == fxpStatus {
+		code, msg := resp.getUint32(), resp.getString()
+		if resp.err != nil {
+			return 0, nil, resp.err
+		}
+		if code != fxOK {
+			return 0, nil, &statusError{code: code, msg: msg}
+		}
+	}
+	return respTyp, resp, resp.err
+}
+
+// expect returns a function which checks that the response to a request is
+// of the expected type.
+func expect(want byte) func(byte, *sftpBuf, error) (*sftpBuf, error) {
+	return func(typ byte, resp *sftpBuf, err error) (*sftpBuf, error) {
+		if err != nil {
+			return nil, err
+		}
+		if typ != want {
+			return nil, errors.Errorf("sftp: unexpected packet type %d, expected %d", typ, want)
+		}
+		return resp, nil
+	}
+}
+
+func (c *sftpClient) expectStatus(typ byte, fn func(b *sftpBuf)) error {
+	_, err := expect(fxpStatus)(c.request(typ, fn))
+	return err
+}
+
+func (c *sftpClient) open(path string, flags uint32) (string, error) {
+	resp, err := expect(fxpHandle)(c.request(fxpOpen, func(b *sftpBuf) {
+		b.putString(path)
+		b.putUint32(flags)
+		b.putUint32(0) // No attributes.
+	}))
+	if err != nil {
+		return "", err
+	}
+	return resp.getString(), resp.err
+}
+
+func (c *sftpClient) close(handle string) error {
+	return c.expectStatus(fxpClose, func(b *sftpBuf) { b.putString(handle) })
+}
+
+func (c *sftpClient) write(handle string, offset uint64, data []byte) error {
+	return c.expectStatus(fxpWrite, func(b *sftpBuf) {
+		b.putString(handle)
+		b.putUint64(offset)
+		b.putString(string(data))
+	})
+}
+
+// read reads at most len(p) bytes at offset, returning io.EOF at the end of
+// the file.
+func (c *sftpClient) read(handle string, offset uint64, p []byte) (int, error) {
+	n := len(p)
+	if n > maxDataLength {
+		n = maxDataLength
+	}
+	resp, err := expect(fxpData)(c.request(fxpRead, func(b *sftpBuf) {
+		b.putString(handle)
+		b.putUint64(offset)
+		b.putUint32(uint32(n))
+	}))
+	if isStatus(err, fxEOF) {
+		return 0, io.EOF
+	}
+	if err != nil {
+		return 0, err
+	}
+	data := resp.getString()
+	return copy(p, data), resp.err
+}
+
+func (c *sftpClient) stat(path string) (fileAttrs, error) {
+	resp, err := expect(fxpAttrs)(c.request(fxpStat, func(b *sftpBuf) { b.putString(path) }))
+	if err != nil {
+		return fileAttrs{}, err
+	}
+	attrs := resp.attrs()
+	return attrs, resp.err
+}
+
+func (c *sftpClient) remove(path string) error {
+	return c.expectStatus(fxpRemove, func(b *sftpBuf) { b.putString(path) })
+}
+
+func (c *sftpClient) mkdir(path string) error {
+	return c.expectStatus(fxpMkdir, func(b *sftpBuf) {
+		b.putString(path)
+		b.putUint32(0) // No attributes.
+	})
+}
+
+// rename renames oldpath to newpath, replacing newpath if it exists.
+func (c *sftpClient) rename(oldpath, newpath string) error {
+	if _, ok := c.extensions[posixRenameExtension]; ok {
+		return c.expectStatus(fxpExtended, func(b *sftpBuf) {
+			b.putString(posixRenameExtension)
+			b.putString(oldpath)
+			b.putString(newpath)
+		})
+	}
+	// Without the extension, servers refuse to rename over an existing file.
+	if err := c.remove(newpath); err != nil && !isStatus(err, fxNoSuchFile) {
+		return err
+	}
+	return c.expectStatus(fxpRename, func(b *sftpBuf) {
+		b.putString(oldpath)
+		b.putString(newpath)
+	})
+}
+
+// dirEntry is an entry of a directory listing.
+type dirEntry struct {
+	name  string
+	attrs fileAttrs
+}
+
+// readDir returns the entries of the directory at path, other than "." and
+// "..".
+func (c *sftpClient) readDir(path string) ([]dirEntry, error) {
+	resp, err := expect(fxpHandle)(c.request(fxpOpendir, func(b *sftpBuf) { b.putString(path) }))
+	if err != nil {
+		return nil, err
+	}
+	handle := resp.getString()
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	defer func() { _ = c.close(handle) }()
+
+	var entries []dirEntry
+	for {
+		resp, err := expect(fxpName)(c.request(fxpReaddir, func(b *sftpBuf) { b.putString(handle) }))
+		if isStatus(err, fxEOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for n := resp.getUint32(); n > 0 && resp.err == nil; n-- {
+			name := resp.getString()
+			_ = resp.getString() // The long name, as ls -l would print it.
+			attrs := resp.attrs()
+			if name != "." && name != ".." {
+				entries = append(entries, dirEntry{name: name, attrs: attrs})
+			}
+		}
+		if resp.err != nil {
+			return nil, resp.err
+		}
+	}
+}
+
+// sftpBuf encodes and decodes the fields of SFTP packets. Decoding errors are
+// sticky and reported by err.
+type sftpBuf struct {
+	b   []byte
+	err error
+}
+
+var errShortPacket = errors.New("sftp: packet too short")
+
+func (b *sftpBuf) putUint32(v uint32) {
+	b.b = binary.BigEndian.AppendUint32(b.b, v)
+}
+
+func (b *sftpBuf) putUint64(v uint64) {
+	b.b = binary.BigEndian.AppendUint64(b.b, v)
+}
+
+func (b *sftpBuf) putString(s string) {
+	b.putUint32(uint32(len(s)))
+	b.b = append(b.b, s...)
+}
+
+func (b *sftpBuf) next(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if len(b.b) < n {
+		b.err = errShortPacket
+		return nil
+	}
+	v := b.b[:n]
+	b.b = b.b[n:]
+	return v
+}
+
+func (b *sftpBuf) getUint32() uint32 {
+	if v := b.next(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (b *sftpBuf) getUint64() uint64 {
+	if v := b.next(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (b *sftpBuf) getString() string {
+	n := b.getUint32()
+	return string(b.next(int(n)))
+}
+
+func (b *sftpBuf) attrs() fileAttrs {
+	var a fileAttrs
+	flags := b.getUint32()
+	if flags&attrSize != 0 {
+		a.size = b.getUint64()
+	}
+	if flags&attrUIDGID != 0 {
+		b.next(8)
+	}
+	if flags&attrPermissions != 0 {
+		a.perms = b.getUint32()
+	}
+	if flags&attrACModTime != 0 {
+		b.next(8)
+	}
+	if flags&attrExtended != 0 {
+		for n := b.getUint32(); n > 0 && b.err == nil; n-- {
+			b.getString()
+			b.getString()
+		}
+	}
+	return a
+}
@@ -0,0 +1,454 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package sftp
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/cloud/cloudpb"
+	"github.com/cockroachdb/cockroach/pkg/server/telemetry"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/util/ioctx"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/cockroachdb/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/ssh"
+)
+
+// An sftp URI has the form
+//
+//	sftp://user@host:port/path?SSH_PRIVATE_KEY=...&SSH_HOST_KEY=...
+//
+// The path is absolute, unless it is empty or starts with /~/, in which case it
+// is relative to the home directory of the user. Only public key authentication
+// is supported, and the key of the server must be known in advance. FTPS, which
+// is FTP over TLS rather than a flavor of SFTP, is not supported.
+const (
+	// SSHPrivateKeyParam is the query parameter for the base64 encoded PEM
+	// private key used to authenticate as the user of an sftp URI.
+	SSHPrivateKeyParam = "SSH_PRIVATE_KEY"
+	// SSHHostKeyParam is the query parameter for the public key, in
+	// authorized_keys format (e.g. as printed by ssh-keyscan), that the server
+	// of an sftp URI must present.
+	SSHHostKeyParam = "SSH_HOST_KEY"
+
+	scheme      = "sftp"
+	defaultPort = "22"
+)
+
+func parseSFTPURL(
+	_ cloud.ExternalStorageURIContext, uri *url.URL,
+) (cloudpb.ExternalStorage, error) {
+	sftpURL := cloud.ConsumeURL{URL: uri}
+	conf := cloudpb.ExternalStorage{}
+	conf.Provider = cloudpb.ExternalStorageProvider_sftp
+	conf.SFTPConfig = &cloudpb.ExternalStorage_SFTP{
+		Host:    uri.Host,
+		Prefix:  uri.Path,
+		HostKey: sftpURL.ConsumeParam(SSHHostKeyParam),
+	}
+	encodedKey := sftpURL.ConsumeParam(SSHPrivateKeyParam)
+
+	// Validate that all the passed in parameters are supported.
+	if unknownParams := sftpURL.RemainingQueryParams(); len(unknownParams) > 0 {
+		return cloudpb.ExternalStorage{}, errors.Errorf(
+			`unknown sftp query parameters: %s`, strings.Join(unknownParams, ", "))
+	}
+
+	if uri.User != nil {
+		conf.SFTPConfig.User = uri.User.Username()
+		if _, ok := uri.User.Password(); ok {
+			return conf, errors.Errorf(
+				"sftp uri does not support passwords, use the %q parameter", SSHPrivateKeyParam)
+		}
+	}
+	if conf.SFTPConfig.User == "" {
+		return conf, errors.New("sftp uri missing user")
+	}
+	if uri.Hostname() == "" {
+		return conf, errors.New("sftp uri missing host")
+	}
+	if uri.Port() == "" {
+		conf.SFTPConfig.Host = net.JoinHostPort(uri.Hostname(), defaultPort)
+	}
+
+	if encodedKey == "" {
+		return conf, errors.Errorf("sftp uri missing %q parameter", SSHPrivateKeyParam)
+	}
+	privateKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return conf, errors.Wrapf(err, "decoding value of %s", SSHPrivateKeyParam)
+	}
+	conf.SFTPConfig.PrivateKey = string(privateKey)
+	if _, err := ssh.ParsePrivateKey(privateKey); err != nil {
+		return conf, errors.Wrapf(err, "parsing value of %s", SSHPrivateKeyParam)
+	}
+	if conf.SFTPConfig.HostKey == "" {
+		return conf, errors.Errorf("sftp uri missing %q parameter", SSHHostKeyParam)
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(conf.SFTPConfig.HostKey)); err != nil {
+		return conf, errors.Wrapf(err, "parsing value of %s", SSHHostKeyParam)
+	}
+	return conf, nil
+}
+
+// sftpPath returns the path on the server of the prefix of an sftp URI.
+func sftpPath(prefix string) string {
+	if prefix == "" {
+		return "."
+	}
+	if prefix == "/~" || strings.HasPrefix(prefix, "/~/") {
+		return path.Clean(strings.TrimPrefix(strings.TrimPrefix(prefix, "/~"), "/"))
+	}
+	return path.Clean("/" + prefix)
+}
+
+type sftpStorage struct {
+	conf     *cloudpb.ExternalStorage_SFTP
+	ioConf   base.ExternalIODirConfig
+	client   *sftpClient
+	prefix   string
+	settings *cluster.Settings
+}
+
+var _ cloud.ExternalStorage = &sftpStorage{}
+
+func makeSFTPStorage(
+	ctx context.Context, args cloud.ExternalStorageContext, dest cloudpb.ExternalStorage,
+) (cloud.ExternalStorage, error) {
+	telemetry.Count("external-io.sftp")
+	conf := dest.SFTPConfig
+	if conf == nil {
+		return nil, errors.Errorf("sftp upload requested but info missing")
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(conf.PrivateKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "sftp private key")
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(conf.HostKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "sftp host key")
+	}
+	conn, err := dialSSH(ctx, conf.Host, &ssh.ClientConfig{
+		User:            conf.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         cloud.Timeout.Get(&args.Settings.SV),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "connecting to sftp server %s", conf.Host)
+	}
+	client, err := newSFTPClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "starting sftp session with %s", conf.Host)
+	}
+	return &sftpStorage{
+		conf:     conf,
+		ioConf:   args.IOConf,
+		client:   client,
+		prefix:   sftpPath(conf.Prefix),
+		settings: args.Settings,
+	}, nil
+}
+
+// dialSSH is ssh.Dial, but gives up on both connecting and the handshake
+// once ctx is done.
+func dialSSH(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	d := net.Dialer{Timeout: config.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// The handshake does not take a context, so it is interrupted by closing
+	// the connection.
+	handshakeDone := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			interrupted <- true
+		case <-handshakeDone:
+			interrupted <- false
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	close(handshakeDone)
+	if <-interrupted {
+		if err == nil {
+			_ = c.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func (s *sftpStorage) Conf() cloudpb.ExternalStorage {
+	return cloudpb.ExternalStorage{
+		Provider:   cloudpb.ExternalStorageProvider_sftp,
+		SFTPConfig: s.conf,
+	}
+}
+
+func (s *sftpStorage) ExternalIOConf() base.ExternalIODirConfig {
+	return s.ioConf
+}
+
+func (s *sftpStorage) RequiresExternalIOAccounting() bool { return true }
+
+func (s *sftpStorage) Settings() *cluster.Settings {
+	return s.settings
+}
+
+// tempName returns the name under which the file with the given name is
+// written until it is complete.
+func tempName(name string) string {
+	return path.Join(path.Dir(name), "."+path.Base(name)+".tmp")
+}
+
+// Writer writes the file under a temporary name, and only renames it to
+// basename once it has been written in full, so that the consumers polling
+// the directory never pick up a partial file.
+func (s *sftpStorage) Writer(ctx context.Context, basename string) (io.WriteCloser, error) {
+	ctx, sp := tracing.ChildSpan(ctx, "sftp.Writer")
+	name := path.Join(s.prefix, basename)
+	sp.SetTag("path", attribute.StringValue(name))
+	if err := s.mkdirAll(path.Dir(name)); err != nil {
+		sp.Finish()
+		return nil, errors.Wrap(err, "creating sftp directory")
+	}
+	tmp := tempName(name)
+	handle, err := s.client.open(tmp, fxfWrite|fxfCreat|fxfTrunc)
+	if err != nil {
+		sp.Finish()
+		return nil, errors.Wrap(err, "creating sftp file")
+	}
+	return cloud.BackgroundPipe(ctx, func(ctx context.Context, r io.Reader) error {
+		defer sp.Finish()
+		err := s.upload(handle, r)
+		err = errors.CombineErrors(err, s.client.close(handle))
+		if err == nil {
+			err = s.client.rename(tmp, name)
+		}
+		if err != nil {
+			_ = s.client.remove(tmp)
+		}
+		return err
+	}), nil
+}
+
+func (s *sftpStorage) upload(handle string, r io.Reader) error {
+	buf := make([]byte, maxDataLength)
+	var offset uint64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := s.client.write(handle, offset, buf[:n]); err != nil {
+				return err
+			}
+			offset += uint64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mkdirAll creates dir and any of its parents which do not exist.
+func (s *sftpStorage) mkdirAll(dir string) error {
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	attrs, err := s.client.stat(dir)
+	if err == nil {
+		if !attrs.isDir() {
+			return errors.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if !isStatus(err, fxNoSuchFile) {
+		return err
+	}
+	if err := s.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+	if err := s.client.mkdir(dir); err != nil {
+		// Another writer may have created the directory in the meantime.
+		if attrs, statErr := s.client.stat(dir); statErr == nil && attrs.isDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadFile is shorthand for ReadFileAt with offset 0.
+func (s *sftpStorage) ReadFile(ctx context.Context, basename string) (ioctx.ReadCloserCtx, error) {
+	reader, _, err := s.ReadFileAt(ctx, basename, 0)
+	return reader, err
+}
+
+func (s *sftpStorage) ReadFileAt(
+	ctx context.Context, basename string, offset int64,
+) (ioctx.ReadCloserCtx, int64, error) {
+	ctx, sp := tracing.ChildSpan(ctx, "sftp.ReadFileAt")
+	defer sp.Finish()
+	name := path.Join(s.prefix, basename)
+	sp.SetTag("path", attribute.StringValue(name))
+
+	attrs, err := s.client.stat(name)
+	if err == nil {
+		var handle string
+		if handle, err = s.client.open(name, fxfRead); err == nil {
+			return &sftpReader{client: s.client, handle: handle, offset: uint64(offset)},
+				int64(attrs.size), nil
+		}
+	}
+	if isStatus(err, fxNoSuchFile) {
+		// nolint:errwrap
+		return nil, 0, errors.Wrapf(
+			errors.Wrap(cloud.ErrFileDoesNotExist, "sftp file does not exist"),
+			"%v",
+			err.Error(),
+		)
+	}
+	return nil, 0, errors.Wrap(err, "failed to open sftp file")
+}
+
+// sftpReader reads an open file sequentially.
+type sftpReader struct {
+	client *sftpClient
+	handle string
+	offset uint64
+}
+
+var _ ioctx.ReadCloserCtx = &sftpReader{}
+
+func (r *sftpReader) Read(_ context.Context, p []byte) (int, error) {
+	n, err := r.client.read(r.handle, r.offset, p)
+	r.offset += uint64(n)
+	return n, err
+}
+
+func (r *sftpReader) Close(context.Context) error {
+	return r.client.close(r.handle)
+}
+
+func (s *sftpStorage) List(ctx context.Context, prefix, delim string, fn cloud.ListingFn) error {
+	ctx, sp := tracing.ChildSpan(ctx, "sftp.List")
+	defer sp.Finish()
+
+	dest := cloud.JoinPathPreservingTrailingSlash(s.prefix, prefix)
+	sp.SetTag("path", attribute.StringValue(dest))
+
+	// As with nodelocal, a prefix which is not a directory lists the files of
+	// its parent directory that it prefixes.
+	dir := dest
+	if attrs, err := s.client.stat(dest); err != nil || !attrs.isDir() {
+		dir = path.Dir(dest)
+	}
+	// Files under the home directory are walked without a leading "./".
+	if dest == "." {
+		dest = ""
+	}
+	var res []string
+	if err := s.walk(ctx, dir, func(name string) {
+		if strings.HasPrefix(name, dest) {
+			res = append(res, name)
+		}
+	}); err != nil {
+		if isStatus(err, fxNoSuchFile) {
+			return nil
+		}
+		return errors.Wrap(err, "unable to list files in sftp directory")
+	}
+
+	// Sort results so that we can group as we go.
+	sort.Strings(res)
+	var prevPrefix string
+	for _, f := range res {
+		f = strings.TrimPrefix(f, dest)
+		if delim != "" {
+			if i := strings.Index(f, delim); i >= 0 {
+				f = f[:i+len(delim)]
+			}
+			if f == prevPrefix {
+				continue
+			}
+			prevPrefix = f
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls fn with the path of every file under dir.
+func (s *sftpStorage) walk(ctx context.Context, dir string, fn func(string)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := s.client.readDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := path.Join(dir, e.name)
+		if e.attrs.isDir() {
+			if err := s.walk(ctx, name, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		fn(name)
+	}
+	return nil
+}
+
+func (s *sftpStorage) Delete(ctx context.Context, basename string) error {
+	err := s.client.remove(path.Join(s.prefix, basename))
+	return errors.Wrap(err, "delete file")
+}
+
+func (s *sftpStorage) Size(ctx context.Context, basename string) (int64, error) {
+	attrs, err := s.client.stat(path.Join(s.prefix, basename))
+	if err != nil {
+		return 0, errors.Wrap(err, "get file properties")
+	}
+	return int64(attrs.size), nil
+}
+
+// Close is part of the cloud.ExternalStorage interface.
+func (s *sftpStorage) Close() error {
+	return s.client.Close()
+}
+
+func init() {
+	cloud.RegisterExternalStorageProvider(cloudpb.ExternalStorageProvider_sftp,
+		parseSFTPURL, makeSFTPStorage, cloud.RedactedParams(SSHPrivateKeyParam), scheme)
+}
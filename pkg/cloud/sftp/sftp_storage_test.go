@@ -0,0 +1,167 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package sftp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/cloud/cloudpb"
+	"github.com/cockroachdb/cockroach/pkg/cloud/cloudtestutils"
+	"github.com/cockroachdb/cockroach/pkg/security/username"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/testutils/skip"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// getSFTPURI returns the sftp URI of the server the tests run against, e.g.
+// sftp://user@localhost:2222/upload?SSH_PRIVATE_KEY=...&SSH_HOST_KEY=...
+func getSFTPURI(t *testing.T, path string) string {
+	uri := os.Getenv("SFTP_URI")
+	if uri == "" {
+		skip.IgnoreLint(t, "SFTP_URI env var must be set")
+	}
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + path
+	return u.String()
+}
+
+func TestSFTP(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testSettings := cluster.MakeTestingClusterSettings()
+	cloudtestutils.CheckExportStore(t, getSFTPURI(t, "backup-test"),
+		false, username.RootUserName(),
+		nil, /* db */
+		testSettings,
+	)
+	cloudtestutils.CheckListFiles(t, getSFTPURI(t, "listing-test"),
+		username.RootUserName(),
+		nil, /* db */
+		testSettings,
+	)
+}
+
+func TestAntagonisticSFTPRead(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	conf, err := cloud.ExternalStorageConfFromURI(
+		getSFTPURI(t, "antagonistic-read"), username.RootUserName())
+	require.NoError(t, err)
+
+	cloudtestutils.CheckAntagonisticRead(t, conf, cluster.MakeTestingClusterSettings())
+}
+
+func TestParseSFTPURL(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	hostKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+
+	query := url.Values{}
+	query.Set(SSHPrivateKeyParam, base64.StdEncoding.EncodeToString(privateKey))
+	query.Set(SSHHostKeyParam, hostKey)
+	parse := func(uri string) (cloudpb.ExternalStorage, error) {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return cloudpb.ExternalStorage{}, err
+		}
+		return parseSFTPURL(cloud.ExternalStorageURIContext{}, u)
+	}
+
+	t.Run("defaults port", func(t *testing.T) {
+		conf, err := parse(fmt.Sprintf("sftp://drop@example.com/upload?%s", query.Encode()))
+		require.NoError(t, err)
+		require.Equal(t, cloudpb.ExternalStorageProvider_sftp, conf.Provider)
+		require.Equal(t, cloudpb.ExternalStorage_SFTP{
+			Host:       "example.com:22",
+			Prefix:     "/upload",
+			User:       "drop",
+			PrivateKey: string(privateKey),
+			HostKey:    hostKey,
+		}, *conf.SFTPConfig)
+	})
+	t.Run("keeps port", func(t *testing.T) {
+		conf, err := parse(fmt.Sprintf("sftp://drop@example.com:2222/upload?%s", query.Encode()))
+		require.NoError(t, err)
+		require.Equal(t, "example.com:2222", conf.SFTPConfig.Host)
+	})
+	t.Run("errors", func(t *testing.T) {
+		withParams := func(key, value string) string {
+			q := url.Values{}
+			for k, v := range query {
+				q[k] = v
+			}
+			if value == "" {
+				q.Del(key)
+			} else {
+				q.Set(key, value)
+			}
+			return q.Encode()
+		}
+		for _, tc := range []struct {
+			uri string
+			err string
+		}{
+			{fmt.Sprintf("sftp://example.com/upload?%s", query.Encode()), "missing user"},
+			{fmt.Sprintf("sftp://drop:pw@example.com/upload?%s", query.Encode()), "does not support passwords"},
+			{fmt.Sprintf("sftp://drop@example.com/upload?%s&OTHER=1", query.Encode()), "unknown sftp query parameters: OTHER"},
+			{"sftp://drop@example.com/upload?" + withParams(SSHPrivateKeyParam, ""), "missing \"SSH_PRIVATE_KEY\""},
+			{"sftp://drop@example.com/upload?" + withParams(SSHPrivateKeyParam, "not-base64"), "decoding value of SSH_PRIVATE_KEY"},
+			{"sftp://drop@example.com/upload?" + withParams(SSHPrivateKeyParam, "a2V5"), "parsing value of SSH_PRIVATE_KEY"},
+			{"sftp://drop@example.com/upload?" + withParams(SSHHostKeyParam, ""), "missing \"SSH_HOST_KEY\""},
+			{"sftp://drop@example.com/upload?" + withParams(SSHHostKeyParam, "ssh-ed25519 AAAA"), "parsing value of SSH_HOST_KEY"},
+		} {
+			_, err := parse(tc.uri)
+			require.ErrorContains(t, err, tc.err, tc.uri)
+		}
+	})
+	t.Run("redacts private key", func(t *testing.T) {
+		uri := fmt.Sprintf("sftp://drop@example.com/upload?%s", query.Encode())
+		redacted, err := cloud.SanitizeExternalStorageURI(uri, nil /* extraParams */)
+		require.NoError(t, err)
+		require.NotContains(t, redacted, query.Get(SSHPrivateKeyParam))
+	})
+}
+
+func TestSFTPPath(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for prefix, expected := range map[string]string{
+		"":              ".",
+		"/":             "/",
+		"/upload/":      "/upload",
+		"/~":            ".",
+		"/~/":           ".",
+		"/~/upload/cdc": "upload/cdc",
+	} {
+		require.Equal(t, expected, sftpPath(prefix), prefix)
+	}
+}
@@ -455,6 +455,11 @@ const (
 	// set.
 	V23_1TenantCapabilities
 
+	// V23_1RowLevelTTLValueHeader is the version where the transactions of the
+	// row-level TTL job are marked as such, and the mark is recorded in the
+	// MVCCValueHeader of their writes and carried by rangefeed values.
+	V23_1RowLevelTTLValueHeader
+
 	// *************************************************
 	// Step (1): Add new versions here.
 	// Do not add new versions to a patch release.
@@ -788,6 +793,10 @@ var rawVersionsSingleton = keyedVersions{
 		Key:     V23_1TenantCapabilities,
 		Version: roachpb.Version{Major: 22, Minor: 2, Internal: 60},
 	},
+	{
+		Key:     V23_1RowLevelTTLValueHeader,
+		Version: roachpb.Version{Major: 22, Minor: 2, Internal: 62},
+	},
 
 	// *************************************************
 	// Step (2): Add new versions here.
@@ -381,8 +381,8 @@ var specs = []stmtSpec{
 	{
 		name:    "alter_changefeed",
 		stmt:    "alter_changefeed_stmt",
-		replace: map[string]string{"a_expr": "job_id", "alter_changefeed_cmds": "( 'ADD' target ( ( ',' target ) )* ( 'WITH' ( initial_scan | no_initial_scan ) )? | 'DROP' target ( ( ',' target ) )* | ( 'SET' | 'UNSET' ) option ( ( ',' option ) )* )+"},
-		unlink:  []string{"job_id", "target", "option", "initial_scan", "no_initial_scan"},
+		replace: map[string]string{"a_expr": "job_id", "alter_changefeed_cmds": "( 'ADD' target ( ( ',' target ) )* ( 'WITH' ( initial_scan | no_initial_scan ) )? | 'DROP' target ( ( ',' target ) )* | ( 'SET' | 'UNSET' ) option ( ( ',' option ) )* | 'SET' 'TARGET' target 'TOPIC' topic )+"},
+		unlink:  []string{"job_id", "target", "option", "initial_scan", "no_initial_scan", "topic"},
 	},
 	{
 		name:   "alter_column",
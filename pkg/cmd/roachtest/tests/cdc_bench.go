@@ -0,0 +1,97 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package tests
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcbench"
+	"github.com/cockroachdb/cockroach/pkg/cmd/roachtest/cluster"
+	"github.com/cockroachdb/cockroach/pkg/cmd/roachtest/registry"
+	"github.com/cockroachdb/cockroach/pkg/cmd/roachtest/spec"
+	"github.com/cockroachdb/cockroach/pkg/cmd/roachtest/test"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// cdcBenchRows is the number of rows scanned by the end to end scenarios of
+// the cdcbench package when they're run on a cluster.
+const cdcBenchRows = 10_000_000
+
+// cdcBenchInsertBatch is the number of rows inserted by each statement which
+// loads the table of the scenarios.
+const cdcBenchInsertBatch = 100_000
+
+// registerCDCBench registers a test for each end to end scenario of the
+// cdcbench package, which run the scenario against the null sink with more
+// rows and report the throughput of the changefeed to roachperf.
+func registerCDCBench(r registry.Registry) {
+	for _, scenario := range cdcbench.Scenarios {
+		scenario := scenario
+		scenario.Rows = cdcBenchRows
+		r.Add(registry.TestSpec{
+			Name:            "cdc/bench/" + scenario.Name(),
+			Owner:           registry.OwnerCDC,
+			Cluster:         r.MakeClusterSpec(4, spec.CPU(16)),
+			RequiresLicense: true,
+			Run: func(ctx context.Context, t test.Test, c cluster.Cluster) {
+				runCDCBench(ctx, t, c, scenario)
+			},
+		})
+	}
+}
+
+func runCDCBench(
+	ctx context.Context, t test.Test, c cluster.Cluster, scenario cdcbench.Scenario,
+) {
+	ct := newCDCTester(ctx, t, c)
+	defer ct.Close()
+	db := ct.DB()
+
+	t.Status("loading ", scenario.Rows, " rows")
+	if _, err := db.Exec(cdcbench.CreateTableStmt); err != nil {
+		t.Fatal(err)
+	}
+	for start := 0; start < scenario.Rows; start += cdcBenchInsertBatch {
+		end := start + cdcBenchInsertBatch
+		if end > scenario.Rows {
+			end = scenario.Rows
+		}
+		if _, err := db.Exec(cdcbench.InsertRowsStmt(start, end)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Status("running changefeed ", scenario.Name())
+	start := timeutil.Now()
+	var jobID int64
+	if err := db.QueryRow(scenario.ChangefeedStmt(), "null://").Scan(&jobID); err != nil {
+		t.Fatal(err)
+	}
+	var status string
+	if err := db.QueryRow(
+		`SELECT status FROM [SHOW JOB WHEN COMPLETE $1]`, jobID,
+	).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != "succeeded" {
+		t.Fatalf("changefeed %d finished with status %s", jobID, status)
+	}
+	dur := timeutil.Since(start)
+	rate := float64(scenario.Rows) / dur.Seconds()
+	t.L().Printf("results: changefeed emitted %d rows in %s, %.0f rows/s", scenario.Rows, dur, rate)
+
+	// Write the throughput into the stats.json file to be used by roachperf.
+	c.Run(ctx, c.Node(1), "mkdir", "-p", t.PerfArtifactsDir())
+	c.Run(ctx, c.Node(1), fmt.Sprintf(
+		`echo '{ "changefeed_row_rate": %f }' > %s/stats.json`, rate, t.PerfArtifactsDir(),
+	))
+}
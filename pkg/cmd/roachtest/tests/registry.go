@@ -27,6 +27,7 @@ func RegisterTests(r registry.Registry) {
 	registerBackupMixedVersion(r)
 	registerBackupNodeShutdown(r)
 	registerCDC(r)
+	registerCDCBench(r)
 	registerCDCMixedVersions(r)
 	registerCancel(r)
 	registerChangeReplicasMixedVersion(r)
@@ -82,6 +82,7 @@ DOCS_SRCS = [
     "//docs/generated/sql/bnf:begin_stmt.bnf",
     "//docs/generated/sql/bnf:begin_transaction.bnf",
     "//docs/generated/sql/bnf:cancel_all_jobs_stmt.bnf",
+    "//docs/generated/sql/bnf:cancel_changefeed_stmt.bnf",
     "//docs/generated/sql/bnf:cancel_job.bnf",
     "//docs/generated/sql/bnf:cancel_query.bnf",
     "//docs/generated/sql/bnf:cancel_session.bnf",
@@ -467,3 +467,112 @@ func TestJobControlByType(t *testing.T) {
 		}
 	}
 }
+
+func TestChangefeedJobControlWithFilter(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+	defer ResetConstructors()()
+
+	argsFn := func(args *base.TestServerArgs) {
+		// Prevent registry from changing job state while running this test.
+		interval := 24 * time.Hour
+		args.Knobs.JobsTestingKnobs = NewTestingKnobsWithIntervals(interval, interval, interval, interval)
+	}
+	th, cleanup := newTestHelperForTables(t, jobstest.UseSystemTables, argsFn)
+	defer cleanup()
+
+	registry := th.server.JobRegistry().(*Registry)
+	RegisterConstructor(jobspb.TypeChangefeed, func(job *Job, _ *cluster.Settings) Resumer {
+		return FakeResumer{
+			OnResume: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			},
+		}
+	}, UsesTenantCostControl)
+
+	exec := func(query string) (int, error) {
+		return th.cfg.DB.Executor().ExecEx(
+			context.Background(),
+			"test-filter",
+			nil,
+			sessiondata.RootUserSessionDataOverride,
+			query,
+		)
+	}
+
+	jobIDs := make(map[string]JobID)
+	makeChangefeed := func(key string, details jobspb.ChangefeedDetails) {
+		jobID := registry.MakeJobID()
+		_, err := registry.CreateAdoptableJobWithTxn(context.Background(), Record{
+			Description: "fake changefeed",
+			Username:    username.TestUserName(),
+			Details:     details,
+			Progress:    jobspb.ChangefeedProgress{},
+		}, jobID, nil /* txn */)
+		require.NoError(t, err)
+		th.sqlDB.Exec(t, "UPDATE system.jobs SET status=$1 WHERE id=$2", StatusRunning, jobID)
+		jobIDs[key] = jobID
+	}
+	// Make a running changefeed for every combination of sink and label.
+	for _, sinkURI := range []string{`kafka://broker`, `webhook-https://host`} {
+		for _, label := range []string{``, `nightly`} {
+			details := jobspb.ChangefeedDetails{SinkURI: sinkURI}
+			if label != `` {
+				details.Opts = map[string]string{`metrics_label`: label}
+			}
+			makeChangefeed(sinkURI+`/`+label, details)
+		}
+	}
+	// Changefeeds emitting to kafka through an external connection, and
+	// fanning out to kafka from a webhook sink, match the kafka scheme too.
+	th.sqlDB.Exec(t, `
+INSERT INTO system.external_connections (connection_name, connection_type, connection_details, owner)
+VALUES ('events', 'FOREIGNDATA', crdb_internal.json_to_pb(
+  'cockroach.cloud.externalconn.connectionpb.ConnectionDetails',
+  '{"provider": "kafka", "simpleUri": {"uri": "kafka://broker"}}'
+), 'root')`)
+	makeChangefeed(`external://events/`, jobspb.ChangefeedDetails{SinkURI: `external://events`})
+	makeChangefeed(`fan-out/`, jobspb.ChangefeedDetails{
+		SinkURI:            `webhook-https://host`,
+		AdditionalSinkURIs: []string{`kafka://broker`, `kafka://other-broker`},
+	})
+	requireStatus := func(key string, status Status) {
+		t.Helper()
+		th.sqlDB.CheckQueryResults(t,
+			fmt.Sprintf("SELECT status FROM system.jobs WHERE id = %d", jobIDs[key]),
+			[][]string{{string(status)}})
+	}
+
+	n, err := exec(`PAUSE ALL CHANGEFEED JOBS WHERE sink_scheme = 'external'`)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	n, err = exec(`PAUSE ALL CHANGEFEED JOBS WHERE sink_scheme = 'kafka'`)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	requireStatus(`kafka://broker/`, StatusPauseRequested)
+	requireStatus(`kafka://broker/nightly`, StatusPauseRequested)
+	requireStatus(`external://events/`, StatusPauseRequested)
+	requireStatus(`fan-out/`, StatusPauseRequested)
+	requireStatus(`webhook-https://host/`, StatusRunning)
+	requireStatus(`webhook-https://host/nightly`, StatusRunning)
+
+	n, err = exec(`PAUSE ALL CHANGEFEED JOBS WHERE metrics_label = 'nightly'`)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	requireStatus(`webhook-https://host/nightly`, StatusPauseRequested)
+	requireStatus(`webhook-https://host/`, StatusRunning)
+
+	th.sqlDB.Exec(t, "UPDATE system.jobs SET status=$1 WHERE status=$2", StatusPaused, StatusPauseRequested)
+	n, err = exec(`RESUME ALL CHANGEFEED JOBS WHERE sink_scheme = 'kafka' AND metrics_label IS NULL`)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	requireStatus(`kafka://broker/`, StatusRunning)
+	requireStatus(`external://events/`, StatusRunning)
+	requireStatus(`fan-out/`, StatusRunning)
+	requireStatus(`kafka://broker/nightly`, StatusPaused)
+
+	_, err = exec(`PAUSE ALL BACKUP JOBS WHERE sink_scheme = 'kafka'`)
+	require.ErrorContains(t, err, `PAUSE ALL BACKUP JOBS does not support a WHERE clause`)
+}
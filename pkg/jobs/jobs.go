@@ -118,6 +118,9 @@ type Record struct {
 	// MaximumPTSAge specifies the maximum age of PTS record held by a job.
 	// 0 means no limit.
 	MaximumPTSAge time.Duration
+	// ReleasePTSOnExpiration, if set, releases PTS records older than
+	// MaximumPTSAge instead of canceling the job.
+	ReleasePTSOnExpiration bool
 }
 
 // AppendDescription appends description to this records Description with a
@@ -25,6 +25,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 )
 
@@ -137,6 +138,29 @@ func manageJobsProtectedTimestamps(ctx context.Context, execCtx sql.JobExecConte
 				ptsExpired := errors.Newf(
 					"protected timestamp records %s as of %s (age %s) exceeds job configured limit of %s",
 					rec.ID, rec.Timestamp, timeutil.Since(rec.Timestamp.GoTime()), p.MaximumPTSAge)
+				if p.ReleasePTSOnExpiration {
+					// The job remains paused. It also forgets the record, so that
+					// it protects its data anew should it be resumed.
+					if err := execCfg.ProtectedTimestampProvider.WithTxn(txn).Release(
+						ctx, rec.ID.GetUUID(),
+					); err != nil {
+						return err
+					}
+					if err := j.WithTxn(txn).Update(ctx, func(
+						_ isql.Txn, md jobs.JobMetadata, ju *jobs.JobUpdater,
+					) error {
+						if cp := md.Progress.GetChangefeed(); cp != nil &&
+							cp.ProtectedTimestampRecord == rec.ID.GetUUID() {
+							cp.ProtectedTimestampRecord = uuid.Nil
+							ju.UpdateProgress(md.Progress)
+						}
+						return nil
+					}); err != nil {
+						return err
+					}
+					log.Warningf(ctx, "job %d released its protected timestamp due to %s", id, ptsExpired)
+					continue
+				}
 				if err := j.WithTxn(txn).CancelRequestedWithReason(ctx, ptsExpired); err != nil {
 					return err
 				}
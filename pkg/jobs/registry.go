@@ -344,6 +344,7 @@ func (r *Registry) makePayload(ctx context.Context, record *Record) (jobspb.Payl
 		CreationClusterVersion: r.settings.Version.ActiveVersion(ctx).Version,
 		CreationClusterID:      r.clusterID.Get(),
 		MaximumPTSAge:          record.MaximumPTSAge,
+		ReleasePTSOnExpiration: record.ReleasePTSOnExpiration,
 	}, nil
 }
 
@@ -1008,6 +1008,23 @@ func (tc *TxnCoordSender) SetDebugName(name string) {
 	tc.mu.txn.Name = name
 }
 
+// SetRowLevelTTL is part of the client.TxnSender interface.
+func (tc *TxnCoordSender) SetRowLevelTTL() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.mu.txn.RowLevelTTL {
+		return nil
+	}
+
+	if tc.mu.active {
+		return errors.AssertionFailedf(
+			"cannot mark a running transaction as a row-level TTL transaction")
+	}
+	tc.mu.txn.RowLevelTTL = true
+	return nil
+}
+
 // String is part of the client.TxnSender interface.
 func (tc *TxnCoordSender) String() string {
 	tc.mu.Lock()
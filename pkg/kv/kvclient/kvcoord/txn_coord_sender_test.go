@@ -99,6 +99,32 @@ func TestTxnCoordSenderBeginTransaction(t *testing.T) {
 	}
 }
 
+// TestTxnCoordSenderSetRowLevelTTL verifies that the row-level TTL mark can
+// be set before a transaction's first operation and is carried on its proto,
+// and that setting it on a running transaction returns an error.
+func TestTxnCoordSenderSetRowLevelTTL(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+	s := createTestDB(t)
+	defer s.Stop()
+	ctx := context.Background()
+
+	txn := kv.NewTxn(ctx, s.DB, 0 /* gatewayNodeID */)
+	require.NoError(t, txn.SetRowLevelTTL())
+	_, err := txn.Del(ctx, roachpb.Key("a"))
+	require.NoError(t, err)
+	require.True(t, txn.TestingCloneTxn().RowLevelTTL)
+	// Setting the mark again is a no-op.
+	require.NoError(t, txn.SetRowLevelTTL())
+	require.NoError(t, txn.Commit(ctx))
+
+	txn = kv.NewTxn(ctx, s.DB, 0 /* gatewayNodeID */)
+	require.NoError(t, txn.Put(ctx, roachpb.Key("b"), []byte("value")))
+	require.Error(t, txn.SetRowLevelTTL())
+	require.False(t, txn.TestingCloneTxn().RowLevelTTL)
+	require.NoError(t, txn.Rollback(ctx))
+}
+
 // TestTxnCoordSenderKeyRanges verifies that multiple requests to same or
 // overlapping key ranges causes the coordinator to keep track only of
 // the minimum number of ranges.
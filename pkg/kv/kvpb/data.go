@@ -69,6 +69,8 @@ func PrepareTransactionForRetry(
 		)
 		// Use the priority communicated back by the server.
 		txn.Priority = errTxnPri
+		// The new transaction still runs on behalf of the row-level TTL job.
+		txn.RowLevelTTL = pErr.GetTxn().RowLevelTTL
 	case *ReadWithinUncertaintyIntervalError:
 		txn.WriteTimestamp.Forward(tErr.RetryTimestamp())
 	case *TransactionPushError:
@@ -336,6 +336,7 @@ func (i *CatchUpIterator) CatchUpScan(
 						RawBytes:  val,
 						Timestamp: ts,
 					},
+					RowLevelTTL: mvccVal.RowLevelTTL,
 				})
 				reorderBuf = append(reorderBuf, event)
 				if i.OnEmit != nil {
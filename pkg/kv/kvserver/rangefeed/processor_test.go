@@ -442,6 +442,76 @@ func TestNilProcessor(t *testing.T) {
 	require.Panics(t, func() { p.Register(roachpb.RSpan{}, hlc.Timestamp{}, nil, false, nil, nil) })
 }
 
+// TestProcessorRowLevelTTL tests that the row-level TTL mark on a write or a
+// committed intent is carried through to the published RangeFeedValue.
+func TestProcessorRowLevelTTL(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	p, stopper := newTestProcessor(t, nil /* rtsIter */)
+	ctx := context.Background()
+	defer stopper.Stop(ctx)
+
+	rStream := newTestStream()
+	rErrC := make(chan *kvpb.Error, 1)
+	rOK, _ := p.Register(
+		roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("m")},
+		hlc.Timestamp{WallTime: 1},
+		nil,   /* catchUpIter */
+		false, /* withDiff */
+		rStream,
+		rErrC,
+	)
+	require.True(t, rOK)
+	p.syncEventAndRegistrations()
+	rStream.Events() // drain the initial checkpoint
+
+	ttlValue := func(key roachpb.Key, ts hlc.Timestamp) *kvpb.RangeFeedEvent {
+		return makeRangeFeedEvent(&kvpb.RangeFeedValue{
+			Key:         key,
+			Value:       roachpb.Value{Timestamp: ts},
+			RowLevelTTL: true,
+		})
+	}
+
+	// A non-transactional deletion.
+	p.ConsumeLogicalOps(ctx, makeLogicalOp(&enginepb.MVCCWriteValueOp{
+		Key:         roachpb.Key("b"),
+		Timestamp:   hlc.Timestamp{WallTime: 2},
+		RowLevelTTL: true,
+	}))
+	p.syncEventAndRegistrations()
+	require.Equal(t,
+		[]*kvpb.RangeFeedEvent{ttlValue(roachpb.Key("b"), hlc.Timestamp{WallTime: 2})},
+		rStream.Events(),
+	)
+
+	// A transactional deletion, published when its intent commits.
+	txn := uuid.MakeV4()
+	p.ConsumeLogicalOps(ctx, writeIntentOp(txn, hlc.Timestamp{WallTime: 3}))
+	p.ConsumeLogicalOps(ctx, makeLogicalOp(&enginepb.MVCCCommitIntentOp{
+		TxnID:       txn,
+		Key:         roachpb.Key("c"),
+		Timestamp:   hlc.Timestamp{WallTime: 3},
+		RowLevelTTL: true,
+	}))
+	p.syncEventAndRegistrations()
+	require.Equal(t,
+		[]*kvpb.RangeFeedEvent{ttlValue(roachpb.Key("c"), hlc.Timestamp{WallTime: 3})},
+		rStream.Events(),
+	)
+
+	// Writes without the mark are published without it.
+	p.ConsumeLogicalOps(ctx,
+		writeValueOpWithKV(roachpb.Key("d"), hlc.Timestamp{WallTime: 4}, []byte("val")))
+	p.syncEventAndRegistrations()
+	require.Equal(t,
+		[]*kvpb.RangeFeedEvent{rangeFeedValue(
+			roachpb.Key("d"),
+			roachpb.Value{RawBytes: []byte("val"), Timestamp: hlc.Timestamp{WallTime: 4}},
+		)},
+		rStream.Events(),
+	)
+}
+
 func TestProcessorSlowConsumer(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	p, stopper := newTestProcessor(t, nil /* rtsIter */)
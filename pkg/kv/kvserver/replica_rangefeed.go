@@ -582,11 +582,12 @@ func (r *Replica) handleLogicalOpLogRaftMuLocked(
 		var key []byte
 		var ts hlc.Timestamp
 		var valPtr *[]byte
+		var rowLevelTTLPtr *bool
 		switch t := op.GetValue().(type) {
 		case *enginepb.MVCCWriteValueOp:
-			key, ts, valPtr = t.Key, t.Timestamp, &t.Value
+			key, ts, valPtr, rowLevelTTLPtr = t.Key, t.Timestamp, &t.Value, &t.RowLevelTTL
 		case *enginepb.MVCCCommitIntentOp:
-			key, ts, valPtr = t.Key, t.Timestamp, &t.Value
+			key, ts, valPtr, rowLevelTTLPtr = t.Key, t.Timestamp, &t.Value, &t.RowLevelTTL
 		case *enginepb.MVCCWriteIntentOp,
 			*enginepb.MVCCUpdateIntentOp,
 			*enginepb.MVCCAbortIntentOp,
@@ -642,6 +643,7 @@ func (r *Replica) handleLogicalOpLogRaftMuLocked(
 			vhf(key, nil, ts, vh)
 		}
 		*valPtr = valRes.Value.RawBytes
+		*rowLevelTTLPtr = vh.RowLevelTTL
 	}
 
 	// Pass the ops to the rangefeed processor.
@@ -83,6 +83,12 @@ func (m *MockTransactionalSender) SetDebugName(name string) {
 	m.txn.Name = name
 }
 
+// SetRowLevelTTL is part of the TxnSender interface.
+func (m *MockTransactionalSender) SetRowLevelTTL() error {
+	m.txn.RowLevelTTL = true
+	return nil
+}
+
 // String is part of the TxnSender interface.
 func (m *MockTransactionalSender) String() string {
 	return m.txn.String()
@@ -120,6 +120,11 @@ type TxnSender interface {
 	// SetDebugName sets the txn's debug name.
 	SetDebugName(name string)
 
+	// SetRowLevelTTL marks the txn as deleting rows on behalf of the
+	// row-level TTL job. It returns an error if the txn has already performed
+	// any operations.
+	SetRowLevelTTL() error
+
 	// String returns a string representation of the txn.
 	String() string
 
@@ -335,6 +335,24 @@ func (txn *Txn) SetDebugName(name string) {
 	txn.mu.debugName = name
 }
 
+// SetRowLevelTTL marks the transaction as deleting expired rows on behalf of
+// the row-level TTL job. The mark is recorded with each of the transaction's
+// writes so that changefeeds can tell TTL deletes apart from user deletes. It
+// returns an error if the transaction has already performed any operations.
+//
+// The mark must only be set once the V23_1RowLevelTTLValueHeader cluster
+// version is active, so that every node understands it.
+func (txn *Txn) SetRowLevelTTL() error {
+	if txn.typ != RootTxn {
+		return errors.AssertionFailedf("SetRowLevelTTL() called on leaf txn")
+	}
+
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	return txn.mu.sender.SetRowLevelTTL()
+}
+
 // DebugName returns the debug name associated with the transaction.
 func (txn *Txn) DebugName() string {
 	txn.mu.Lock()
@@ -62,4 +62,7 @@ const (
 	// TODO(davidh): Revise this once tenant-scoped metrics are implemented in
 	// https://github.com/cockroachdb/cockroach/issues/96438
 	CanViewTSDBMetrics // can_view_tsdb_metrics
+	// CanBeChangefeedSource if set to true, allows changefeeds created by the
+	// system tenant to watch tables belonging to this tenant.
+	CanBeChangefeedSource // can_be_changefeed_source
 )
@@ -75,6 +75,13 @@ func ParseTenantCapabilityUpsert(
 			}
 			cap.CanViewTSDBMetrics = b
 		}
+		if arg.Key == "can_be_changefeed_source" {
+			b, err := strconv.ParseBool(arg.Vals[0])
+			if err != nil {
+				return nil, err
+			}
+			cap.CanBeChangefeedSource = b
+		}
 	}
 	update := tenantcapabilities.Update{
 		Entry: tenantcapabilities.Entry{
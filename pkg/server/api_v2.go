@@ -98,6 +98,10 @@ type apiV2Server struct {
 	mux              *mux.Router
 	sqlServer        *SQLServer
 	db               *kv.DB
+
+	// changefeedEventStreams is the number of changefeed event streams
+	// being served, accessed atomically.
+	changefeedEventStreams int64
 }
 
 var _ ApiV2System = &apiV2Server{}
@@ -205,6 +209,7 @@ func registerRoutes(
 		{"databases/{database_name:[\\w.]+}/tables/", a.databaseTables, true, regularRole, noOption, false},
 		{"databases/{database_name:[\\w.]+}/tables/{table_name:[\\w.]+}/", a.tableDetails, true, regularRole, noOption, false},
 		{"rules/", a.listRules, false, regularRole, noOption, false},
+		{"changefeeds/{job_id:[0-9]+}/events/", a.changefeedEvents, true, regularRole, noOption, true},
 
 		{"sql/", a.execSQL, true, regularRole, noOption, true},
 	}
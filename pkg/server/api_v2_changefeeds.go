@@ -0,0 +1,204 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/gorilla/mux"
+)
+
+// changefeedEventsLastEventIDHeader is the header with which clients of
+// Server-Sent Events resume from the id of the last event they received.
+const changefeedEventsLastEventIDHeader = "Last-Event-ID"
+
+// Each stream of changefeed events runs a changefeed on the node serving it,
+// so the number of streams a node serves at once is limited.
+var changefeedEventsMaxStreams = settings.RegisterIntSetting(
+	settings.TenantWritable,
+	"server.changefeed_events.max_concurrent_streams",
+	"maximum number of changefeed event streams served by a node at once",
+	16, // arbitrary
+	settings.NonNegativeInt,
+)
+
+// Event of a changefeed, sent as the data of a Server-Sent Event of type row.
+//
+// swagger:model changefeedEvent
+type changefeedEvent struct {
+	// Topic is the topic the message would be emitted to.
+	Topic string `json:"topic"`
+	// Key and Value are the key and value of the message, as encoded by the
+	// changefeed.
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// swagger:operation GET /changefeeds/{job_id}/events/ changefeedEvents
+//
+// # Stream changefeed events
+//
+// Streams the events of a changefeed as Server-Sent Events, so that consumers
+// can subscribe to it without a sink of their own. The changefeed's statement
+// is run as a sinkless changefeed, as the logged-in user, who must be able to
+// view the changefeed job and to read its targets. Only changefeeds with
+// format=json are supported.
+//
+// Messages are sent as events of type `row`, whose data is a changefeedEvent.
+// Resolved timestamps are sent as events of type `resolved`, whose id is the
+// resolved timestamp. Clients resume from the id of the last event they
+// received with the Last-Event-ID header, or the cursor parameter, after
+// which rows above the resolved timestamp may be sent again. Errors end the
+// stream with an event of type `error`.
+//
+// ---
+// parameters:
+//   - name: job_id
+//     type: integer
+//     in: path
+//     description: ID of the changefeed job.
+//     required: true
+//   - name: cursor
+//     type: string
+//     in: query
+//     description: Resolved timestamp to resume from. If unspecified, the
+//     events are streamed from the Last-Event-ID header, or else from the
+//     high-water of the changefeed.
+//     required: false
+//
+// produces:
+// - text/event-stream
+// security:
+// - api_session: []
+// responses:
+//
+//	"200":
+//	  description: Stream of changefeed events
+//	"404":
+//	  description: Changefeed job not found
+//	"503":
+//	  description: Too many changefeed event streams are being served
+func (a *apiV2Server) changefeedEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	username := userFromHTTPAuthInfoContext(ctx)
+	ctx = a.sqlServer.AnnotateCtx(ctx)
+
+	jobID, err := strconv.ParseInt(mux.Vars(r)["job_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	cursor := r.URL.Query().Get("cursor")
+	if cursor == "" {
+		cursor = r.Header.Get(changefeedEventsLastEventIDHeader)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiV2InternalError(ctx, fmt.Errorf("streaming is not supported by %T", w), w)
+		return
+	}
+	maxStreams := changefeedEventsMaxStreams.Get(&a.sqlServer.execCfg.Settings.SV)
+	if atomic.AddInt64(&a.changefeedEventStreams, 1) > maxStreams {
+		atomic.AddInt64(&a.changefeedEventStreams, -1)
+		http.Error(w, "too many changefeed event streams", http.StatusServiceUnavailable)
+		return
+	}
+	defer atomic.AddInt64(&a.changefeedEventStreams, -1)
+
+	override := sessiondata.InternalExecutorOverride{User: username}
+	row, err := a.sqlServer.internalExecutor.QueryRowEx(
+		ctx, "changefeed-events-job", nil /* txn */, override,
+		`SELECT 1 FROM [SHOW CHANGEFEED JOB $1]`, jobID,
+	)
+	if err != nil {
+		apiV2InternalError(ctx, err, w)
+		return
+	}
+	if row == nil {
+		http.Error(w, "changefeed job not found", http.StatusNotFound)
+		return
+	}
+
+	it, err := a.sqlServer.internalExecutor.QueryIteratorEx(
+		ctx, "changefeed-events", nil /* txn */, override,
+		`SELECT topic, key, value, resolved FROM crdb_internal.changefeed_events($1, $2)`,
+		jobID, cursor,
+	)
+	if err != nil {
+		apiV2InternalError(ctx, err, w)
+		return
+	}
+	defer func() { _ = it.Close() }()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for ok, err = it.Next(ctx); ok; ok, err = it.Next(ctx) {
+		row := it.Cur()
+		if row[3] != tree.DNull {
+			resolved := string(tree.MustBeDString(row[3]))
+			data, _ := json.Marshal(struct {
+				Resolved string `json:"resolved"`
+			}{resolved})
+			_, err = fmt.Fprintf(w, "id: %s\nevent: resolved\ndata: %s\n\n", resolved, data)
+		} else {
+			data, marshalErr := json.Marshal(changefeedEvent{
+				Topic: string(tree.MustBeDString(row[0])),
+				Key:   changefeedEventJSON(row[1]),
+				Value: changefeedEventJSON(row[2]),
+			})
+			if marshalErr != nil {
+				err = marshalErr
+				break
+			}
+			_, err = fmt.Fprintf(w, "event: row\ndata: %s\n\n", data)
+		}
+		if err != nil {
+			// The client went away.
+			return
+		}
+		flusher.Flush()
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Warningf(ctx, "streaming events of changefeed job %d: %v", jobID, err)
+		data, _ := json.Marshal(struct {
+			Error string `json:"error"`
+		}{err.Error()})
+		_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+}
+
+// changefeedEventJSON returns the key or value of a message of a changefeed
+// with format=json, which is null if the message has none.
+func changefeedEventJSON(d tree.Datum) json.RawMessage {
+	if d == tree.DNull {
+		return json.RawMessage(`null`)
+	}
+	s := string(tree.MustBeDString(d))
+	if s == "" || !json.Valid([]byte(s)) {
+		// Not JSON, which the message would be under format=json, so send it
+		// as a string.
+		b, _ := json.Marshal(s)
+		return b
+	}
+	return json.RawMessage(s)
+}
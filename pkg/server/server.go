@@ -1015,6 +1015,7 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 		db:                       db,
 		registry:                 registry,
 		recorder:                 recorder,
+		tenantNameContainer:      systemTenantNameContainer,
 		sessionRegistry:          sessionRegistry,
 		closedSessionCache:       closedSessionCache,
 		remoteFlowRunner:         remoteFlowRunner,
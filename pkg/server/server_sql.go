@@ -298,6 +298,9 @@ type sqlServerArgs struct {
 	// Recorder exposes metrics to the prometheus endpoint.
 	recorder *status.MetricsRecorder
 
+	// tenantNameContainer holds the name of the tenant served by this server.
+	tenantNameContainer *roachpb.TenantNameContainer
+
 	// Used for SHOW/CANCEL QUERIE(S)/SESSION(S).
 	sessionRegistry *sql.SessionRegistry
 
@@ -823,6 +826,7 @@ func newSQLServer(ctx context.Context, cfg sqlServerArgs) (*SQLServer, error) {
 			return clientsecopts.MakeURLForServer(ccopts, sparams, user)
 		},
 		LogicalClusterID: cfg.rpcContext.LogicalClusterID.Get,
+		TenantName:       cfg.tenantNameContainer.Get,
 		NodeID:           cfg.nodeIDContainer,
 	}
 
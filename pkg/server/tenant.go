@@ -1165,6 +1165,7 @@ func makeTenantSQLServerArgs(
 		db:                       db,
 		registry:                 registry,
 		recorder:                 recorder,
+		tenantNameContainer:      tenantNameContainer,
 		sessionRegistry:          sessionRegistry,
 		remoteFlowRunner:         remoteFlowRunner,
 		circularInternalExecutor: circularInternalExecutor,
@@ -158,6 +158,7 @@ func TryDelegate(
 		return d.delegateJobControl(ControlJobsDelegate{
 			Type:    t.Type,
 			Command: t.Command,
+			Where:   t.Where,
 		})
 
 	case *tree.ShowFullTableScans:
@@ -15,6 +15,8 @@ import (
 	"strings"
 
 	"github.com/cockroachdb/cockroach/pkg/jobs"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/errors"
 )
@@ -26,8 +28,60 @@ type ControlJobsDelegate struct {
 	// One and only one of these should be non-empty
 	Schedules *tree.Select
 	Type      string
+
+	// Where, if set, filters the jobs of Type. It is only supported for
+	// changefeed jobs, see changefeedJobFilterQuery.
+	Where *tree.Where
 }
 
+// changefeedJobFilterQuery applies a job command to the changefeed jobs
+// matching the filter of a WHERE clause, which can refer to these columns:
+//   - sink_scheme: the scheme of a sink URI of the changefeed, e.g. kafka. A
+//     changefeed has a row for each of its sinks, including those it fans out
+//     to, and matches if any of them does. The scheme of a sink given by an
+//     external connection is that of the URI of the connection.
+//   - metrics_label: the metrics_label option of the changefeed, if set.
+const changefeedJobFilterQuery = `%s JOBS (
+  SELECT DISTINCT id
+  FROM (
+        SELECT id,
+               split_part(
+                 COALESCE(
+                   (
+                    SELECT crdb_internal.pb_to_json(
+                             'cockroach.cloud.externalconn.connectionpb.ConnectionDetails',
+                             connection_details, false
+                           )->'simpleUri'->>'uri'
+                      FROM system.external_connections
+                     WHERE connection_name = substring(sink_uri, '^external://([^/?]+)')
+                   ),
+                   sink_uri
+                 ),
+                 ':', 1
+               ) AS sink_scheme,
+               metrics_label
+          FROM (
+                SELECT id,
+                       jsonb_array_elements_text(
+                         jsonb_build_array(changefeed->>'sink_uri') ||
+                         COALESCE(changefeed->'additional_sink_uris', '[]'::JSONB)
+                       ) AS sink_uri,
+                       changefeed->'opts'->>'metrics_label' AS metrics_label
+                  FROM (
+                        SELECT id,
+                               crdb_internal.pb_to_json(
+                                 'cockroach.sql.jobs.jobspb.Payload',
+                                 payload, false, true
+                               )->'changefeed' AS changefeed
+                          FROM system.jobs
+                         WHERE status IN (%s)
+                       )
+                 WHERE changefeed IS NOT NULL
+               )
+       ) AS changefeed_jobs
+  WHERE %s
+);`
+
 // protoNameForType maps job types to the matching protobuf names for Payload.details in jobs.proto
 // This is also used to enumerate the types of jobs that we actually handle
 var protobufNameForType = map[string]string{
@@ -80,6 +134,15 @@ AND jobs.status IN (%s) AND jobs.created_by_id IN (%s)`,
 		if _, ok := protobufNameForType[stmt.Type]; !ok {
 			return nil, errors.New("Unsupported job type")
 		}
+		if stmt.Where != nil {
+			if stmt.Type != "changefeed" {
+				return nil, pgerror.Newf(pgcode.FeatureNotSupported,
+					"%s ALL %s JOBS does not support a WHERE clause",
+					tree.JobCommandToStatement[stmt.Command], strings.ToUpper(stmt.Type))
+			}
+			return parse(fmt.Sprintf(changefeedJobFilterQuery,
+				tree.JobCommandToStatement[stmt.Command], filterClause, stmt.Where.Expr))
+		}
 		queryStrFormat := `%s JOBS (
   SELECT id
   FROM (
@@ -22,18 +22,60 @@ func (d *delegator) delegateShowChangefeedJobs(n *tree.ShowChangefeedJobs) (tree
 
 	// Note: changefeed_details may contain sensitive credentials in sink_uri. This information is redacted when marshaling
 	// to JSON in ChangefeedDetails.MarshalJSONPB.
+	//
+	// Both crdb_internal.system_jobs and crdb_internal.jobs are constrained on
+	// job_type, which is served by their virtual indexes, so that the payloads
+	// of jobs other than changefeeds are never decoded.
+	//
+	// pts_expiration_in is the time until the protected timestamp of a
+	// changefeed with gc_protect_expires_after set expires. The protected
+	// timestamp trails the changefeed's high-water mark, or its statement time
+	// before it has one. The warning column is set once less than a quarter of
+	// gc_protect_expires_after remains.
+	//
+	// error_class is the class of the last retryable error of a running
+	// changefeed (auth, network, quota, schema or internal), which is cleared
+	// once the changefeed checkpoints its progress again.
+	//
+	// emitted_rows_per_second, emitted_bytes_per_second and sink_backlog_bytes
+	// are recorded by a running changefeed: the rates at which it emitted over
+	// the last window over which they were measured, and the bytes emitted to
+	// its sinks which have yet to be delivered. A backlog which grows while
+	// the rates stay flat indicates that the sink is not keeping up with the
+	// changefeed.
+	//
+	// emitted_bytes is the number of bytes the changefeed has emitted over its
+	// lifetime, across restarts, as of its last checkpoint, which egress can
+	// be charged back by.
+	//
+	// duplicate_rows_per_second is the rate at which a running changefeed
+	// re-emitted rows it had already emitted before it last restarted, which
+	// its consumers have to deduplicate. A rate which stays above zero
+	// indicates that the changefeed keeps restarting.
 	const (
 		selectClause = `
 WITH payload AS (
   SELECT 
     id, 
+    payload_json->'changefeed' AS changefeed_details,
+    COALESCE((payload_json->>'maximumPtsAge')::INT8, 0) AS maximum_pts_age,
+    COALESCE((payload_json->>'releasePtsOnExpiration')::BOOL, false) AS release_pts_on_expiration,
     crdb_internal.pb_to_json(
-      'cockroach.sql.jobs.jobspb.Payload', 
-      payload, false, true
-    )->'changefeed' AS changefeed_details 
-  FROM 
-    crdb_internal.system_jobs
-  WHERE job_type = 'CHANGEFEED'
+      'cockroach.sql.jobs.jobspb.Progress',
+      progress, false, true
+    ) AS job_progress
+  FROM (
+    SELECT 
+      id, 
+      progress, 
+      crdb_internal.pb_to_json(
+        'cockroach.sql.jobs.jobspb.Payload', 
+        payload, false, true
+      ) AS payload_json
+    FROM 
+      crdb_internal.system_jobs
+    WHERE job_type = 'CHANGEFEED'
+  ) AS changefeed_jobs
 ) 
 SELECT 
   job_id, 
@@ -63,10 +105,72 @@ SELECT
       table_id = ANY (descriptor_ids)
   ) AS full_table_names, 
   changefeed_details->'opts'->>'topics' AS topics,
-  COALESCE(changefeed_details->'opts'->>'format','json') AS format 
+  COALESCE(changefeed_details->'opts'->>'format','json') AS format,
+  pts_expiration_in,
+  CASE
+    WHEN finished IS NOT NULL OR pts_expiration_in IS NULL THEN NULL
+    WHEN pts_expiration_in <= '0s'::INTERVAL THEN concat(
+      'protected timestamp has expired; the changefeed will ',
+      IF(release_pts_on_expiration, 'release it', 'be canceled')
+    )
+    WHEN pts_expiration_in < (maximum_pts_age // 4000) * '1 microsecond'::INTERVAL THEN concat(
+      'protected timestamp expires in ', pts_expiration_in::STRING,
+      ', after which the changefeed will ',
+      IF(release_pts_on_expiration, 'release it', 'be canceled')
+    )
+  END AS warning,
+  IF(finished IS NULL, job_progress->'changefeed'->>'retryableErrorClass', NULL) AS error_class,
+  IF(status = 'running', COALESCE(
+    (job_progress->'changefeed'->'throughput'->>'emittedMessagesPerSecond')::FLOAT8, 0
+  ), NULL) AS emitted_rows_per_second,
+  IF(status = 'running', COALESCE(
+    (job_progress->'changefeed'->'throughput'->>'emittedBytesPerSecond')::FLOAT8, 0
+  ), NULL) AS emitted_bytes_per_second,
+  IF(status = 'running', COALESCE(
+    (job_progress->'changefeed'->'throughput'->>'backlogBytes')::INT8, 0
+  ), NULL) AS sink_backlog_bytes,
+  IF(status = 'running', COALESCE(
+    (job_progress->'changefeed'->'throughput'->>'duplicateMessagesPerSecond')::FLOAT8, 0
+  ), NULL) AS duplicate_rows_per_second,
+  COALESCE((job_progress->'changefeed'->>'emittedBytes')::INT8, 0) AS emitted_bytes%s
 FROM 
   crdb_internal.jobs 
-  INNER JOIN payload ON id = job_id`
+  INNER JOIN payload ON id = job_id,
+  LATERAL (
+    SELECT 
+      CASE WHEN maximum_pts_age > 0 THEN
+        crdb_internal.approximate_timestamp(
+          COALESCE(
+            high_water_timestamp, 
+            (changefeed_details->'statement_time'->>'wall_time')::DECIMAL
+          )
+        ) + (maximum_pts_age // 1000) * '1 microsecond'::INTERVAL - now():::TIMESTAMP
+      END AS pts_expiration_in
+  ) AS pts
+WHERE job_type = 'CHANGEFEED'`
+	)
+
+	// With DETAILS, the status of each node running the changefeed, as last
+	// recorded in the job progress by the changefeed's frontier, is added.
+	// With CHECKPOINT, the changefeed's progress is added, serialized for use
+	// with the restore_checkpoint option of CREATE CHANGEFEED.
+	const (
+		detailsColumns = `,
+  COALESCE(job_progress->'changefeed'->'nodeStatus', '[]') AS node_status,
+  COALESCE(job_progress->'changefeed'->'emittedByTable', '[]') AS emitted_by_table,
+  COALESCE(job_progress->'changefeed'->'resolvedByTable', '[]') AS resolved_by_table`
+		checkpointColumns = `,
+  encode(
+    crdb_internal.json_to_pb(
+      'cockroach.sql.jobs.jobspb.ChangefeedCheckpointExport',
+      json_build_object(
+        'statementTime', changefeed_details->'statement_time',
+        'highWater', job_progress->'highWater',
+        'checkpoint', job_progress->'changefeed'->'checkpoint',
+        'generation', changefeed_details->'generation'
+      )
+    ), 'base64'
+  ) AS checkpoint`
 	)
 
 	var whereClause, orderbyClause string
@@ -75,16 +179,25 @@ FROM
 		// - first all the running jobs sorted in order of start time,
 		// - then all completed jobs sorted in order of completion time.
 		whereClause =
-			`WHERE (finished IS NULL OR finished > now() - '12h':::interval)`
+			`AND (finished IS NULL OR finished > now() - '12h':::interval)`
 		// The "ORDER BY" clause below exploits the fact that all
 		// running jobs have finished = NULL.
 		orderbyClause = `ORDER BY COALESCE(finished, now()) DESC, started DESC`
 	} else {
 		// Limit the jobs displayed to the select statement in n.Jobs.
-		whereClause = fmt.Sprintf(`WHERE job_id in (%s)`, n.Jobs.String())
+		whereClause = fmt.Sprintf(`AND job_id in (%s)`, n.Jobs.String())
+	}
+
+	var detailsClause string
+	switch {
+	case n.Details:
+		detailsClause = detailsColumns
+	case n.Checkpoint:
+		detailsClause = checkpointColumns
 	}
 
-	sqlStmt := fmt.Sprintf("%s %s %s", selectClause, whereClause, orderbyClause)
+	sqlStmt := fmt.Sprintf("%s %s %s",
+		fmt.Sprintf(selectClause, detailsClause), whereClause, orderbyClause)
 
 	return parse(sqlStmt)
 }
@@ -1157,6 +1157,8 @@ type NodeInfo struct {
 	// LogicalClusterID is the cluster ID of the tenant, unique per
 	// tenant.
 	LogicalClusterID func() uuid.UUID
+	// TenantName returns the name of the tenant.
+	TenantName func() roachpb.TenantName
 	// NodeID is either the SQL instance ID or node ID, depending on
 	// circumstances.
 	// TODO(knz): Split this across node ID and instance ID. Likely,
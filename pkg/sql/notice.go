@@ -32,6 +32,7 @@ var NoticesEnabled = settings.RegisterBoolSetting(
 // sending notices.
 type noticeSender interface {
 	BufferNotice(pgnotice.Notice)
+	SendNotice(context.Context, pgnotice.Notice) error
 }
 
 // BufferClientNotice implements the eval.ClientNoticeSender interface.
@@ -39,18 +40,36 @@ func (p *planner) BufferClientNotice(ctx context.Context, notice pgnotice.Notice
 	if log.V(2) {
 		log.Infof(ctx, "buffered notice: %+v", notice)
 	}
+	if !p.canSendNotice(notice) {
+		return
+	}
+	p.noticeSender.BufferNotice(notice)
+}
+
+// SendClientNotice sends the notice to the client immediately, rather than
+// once the statement completes, so that it reaches the client before a
+// long-running statement returns.
+func (p *planner) SendClientNotice(ctx context.Context, notice pgnotice.Notice) error {
+	if log.V(2) {
+		log.Infof(ctx, "sending notice: %+v", notice)
+	}
+	if !p.canSendNotice(notice) {
+		return nil
+	}
+	return p.noticeSender.SendNotice(ctx, notice)
+}
+
+// canSendNotice returns whether the notice can flow to the client.
+func (p *planner) canSendNotice(notice pgnotice.Notice) bool {
 	noticeSeverity, ok := pgnotice.ParseDisplaySeverity(pgerror.GetSeverity(notice))
 	if !ok {
 		noticeSeverity = pgnotice.DisplaySeverityNotice
 	}
-	if p.noticeSender == nil ||
-		noticeSeverity > pgnotice.DisplaySeverity(p.SessionData().NoticeDisplaySeverity) ||
-		!NoticesEnabled.Get(&p.execCfg.Settings.SV) {
-		// Notice cannot flow to the client - because of one of these conditions:
-		// * there is no client
-		// * the session's NoticeDisplaySeverity is higher than the severity of the notice.
-		// * the notice protocol was disabled
-		return
-	}
-	p.noticeSender.BufferNotice(notice)
+	// Notice cannot flow to the client - because of one of these conditions:
+	// * there is no client
+	// * the session's NoticeDisplaySeverity is higher than the severity of the notice.
+	// * the notice protocol was disabled
+	return p.noticeSender != nil &&
+		noticeSeverity <= pgnotice.DisplaySeverity(p.SessionData().NoticeDisplaySeverity) &&
+		NoticesEnabled.Get(&p.execCfg.Settings.SV)
 }
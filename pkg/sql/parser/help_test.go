@@ -130,6 +130,7 @@ func TestContextualHelp(t *testing.T) {
 		{`CANCEL SESSIONS IF ??`, `CANCEL SESSIONS`},
 		{`CANCEL SESSIONS IF EXISTS ??`, `CANCEL SESSIONS`},
 		{`CANCEL ALL ??`, `CANCEL ALL JOBS`},
+		{`CANCEL CHANGEFEED ??`, `CANCEL CHANGEFEED`},
 
 		{`CREATE UNIQUE ??`, `CREATE`},
 		{`CREATE UNIQUE INDEX ??`, `CREATE INDEX`},
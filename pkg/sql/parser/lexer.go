@@ -294,6 +294,14 @@ func (l *lexer) Lex(lval *sqlSymType) int {
 						lval.id = SET_TRACING
 					}
 				}
+			case TARGET:
+				// Do not use the lookahead rule for `SET target = ...`, `SET
+				// target TO ...` or `SET target.custom ...`.
+				switch secondToken.id {
+				case '=', TO, '.', ',', 0:
+				default:
+					lval.id = SET_TARGET
+				}
 			}
 		}
 	}
@@ -27,6 +27,8 @@ func TestLexer(t *testing.T) {
 		{`NOT IN`, []int{NOT_LA, IN}},
 		{`NOT SIMILAR`, []int{NOT_LA, SIMILAR}},
 		{`AS OF SYSTEM TIME`, []int{AS_LA, OF, SYSTEM, TIME}},
+		{`SET TARGET foo TOPIC`, []int{SET_TARGET, TARGET, IDENT, TOPIC}},
+		{`SET target = foo`, []int{SET, TARGET, '=', IDENT}},
 	}
 	for i, d := range testData {
 		s := makeScanner(d.sql)
@@ -889,7 +889,7 @@ func (u *sqlSymUnion) showTenantOpts() tree.ShowTenantOptions {
 %token <str> BOOLEAN BOTH BOX2D BUNDLE BY
 
 %token <str> CACHE CALLED CANCEL CANCELQUERY CAPABILITIES CAPABILITY CASCADE CASE CAST CBRT CHANGEFEED CHAR
-%token <str> CHARACTER CHARACTERISTICS CHECK CHECK_FILES CLOSE
+%token <str> CHARACTER CHARACTERISTICS CHECK CHECKPOINT CHECK_FILES CLOSE
 %token <str> CLUSTER COALESCE COLLATE COLLATION COLUMN COLUMNS COMMENT COMMENTS COMMIT
 %token <str> COMMITTED COMPACT COMPLETE COMPLETIONS CONCAT CONCURRENTLY CONFIGURATION CONFIGURATIONS CONFIGURE
 %token <str> CONFLICT CONNECTION CONNECTIONS CONSTRAINT CONSTRAINTS CONTAINS CONTROLCHANGEFEED CONTROLJOB
@@ -975,8 +975,8 @@ func (u *sqlSymUnion) showTenantOpts() tree.ShowTenantOptions {
 %token <str> STABLE START STATE STATISTICS STATUS STDIN STDOUT STOP STREAM STRICT STRING STORAGE STORE STORED STORING SUBSTRING SUPER
 %token <str> SUPPORT SURVIVE SURVIVAL SYMMETRIC SYNTAX SYSTEM SQRT SUBSCRIPTION STATEMENTS
 
-%token <str> TABLE TABLES TABLESPACE TEMP TEMPLATE TEMPORARY TENANT TENANT_NAME TENANTS TESTING_RELOCATE TEXT THEN
-%token <str> TIES TIME TIMETZ TIMESTAMP TIMESTAMPTZ TO THROTTLING TRAILING TRACE
+%token <str> TABLE TABLES TABLESPACE TARGET TEMP TEMPLATE TEMPORARY TENANT TENANT_NAME TENANTS TESTING_RELOCATE TEXT THEN
+%token <str> TIES TIME TIMETZ TIMESTAMP TIMESTAMPTZ TO THROTTLING TOPIC TRAILING TRACE
 %token <str> TRANSACTION TRANSACTIONS TRANSFER TRANSFORM TREAT TRIGGER TRIM TRUE
 %token <str> TRUNCATE TRUSTED TYPE TYPES
 %token <str> TRACING
@@ -1012,8 +1012,10 @@ func (u *sqlSymUnion) showTenantOpts() tree.ShowTenantOptions {
 // references.
 // - TENANT_ALL is used to differentiate `ALTER TENANT <id>` from
 // `ALTER TENANT ALL`.
+// - SET_TARGET is used to differentiate `ALTER CHANGEFEED <id> SET TARGET
+// <target> TOPIC ...` from setting an option named target.
 %token NOT_LA NULLS_LA WITH_LA AS_LA GENERATED_ALWAYS GENERATED_BY_DEFAULT RESET_ALL ROLE_ALL
-%token USER_ALL ON_LA TENANT_ALL SET_TRACING
+%token USER_ALL ON_LA TENANT_ALL SET_TRACING SET_TARGET
 
 %union {
   id    int32
@@ -1137,6 +1139,7 @@ func (u *sqlSymUnion) showTenantOpts() tree.ShowTenantOptions {
 %type <tree.Statement> cancel_queries_stmt
 %type <tree.Statement> cancel_sessions_stmt
 %type <tree.Statement> cancel_all_jobs_stmt
+%type <tree.Statement> cancel_changefeed_stmt
 
 // SCRUB
 %type <tree.Statement> scrub_stmt
@@ -4159,13 +4162,29 @@ copy_generic_options:
 
 // %Help: CANCEL
 // %Category: Group
-// %Text: CANCEL JOBS, CANCEL QUERIES, CANCEL SESSIONS
+// %Text: CANCEL JOBS, CANCEL QUERIES, CANCEL SESSIONS, CANCEL CHANGEFEED
 cancel_stmt:
-  cancel_jobs_stmt      // EXTEND WITH HELP: CANCEL JOBS
-| cancel_queries_stmt   // EXTEND WITH HELP: CANCEL QUERIES
-| cancel_sessions_stmt  // EXTEND WITH HELP: CANCEL SESSIONS
-| cancel_all_jobs_stmt  // EXTEND WITH HELP: CANCEL ALL JOBS
-| CANCEL error          // SHOW HELP: CANCEL
+  cancel_jobs_stmt        // EXTEND WITH HELP: CANCEL JOBS
+| cancel_queries_stmt     // EXTEND WITH HELP: CANCEL QUERIES
+| cancel_sessions_stmt    // EXTEND WITH HELP: CANCEL SESSIONS
+| cancel_all_jobs_stmt    // EXTEND WITH HELP: CANCEL ALL JOBS
+| cancel_changefeed_stmt  // EXTEND WITH HELP: CANCEL CHANGEFEED
+| CANCEL error            // SHOW HELP: CANCEL
+
+// %Help: CANCEL CHANGEFEED - gracefully drain a changefeed at a timestamp
+// %Category: CCL
+// %Text:
+// CANCEL CHANGEFEED <job_id> AT TIME <timestamp>
+//
+// The changefeed keeps emitting changes until its frontier reaches the given
+// timestamp, emits a final resolved timestamp, and then completes.
+// %SeeAlso: ALTER CHANGEFEED, CANCEL JOBS
+cancel_changefeed_stmt:
+  CANCEL CHANGEFEED d_expr AT TIME a_expr
+  {
+    $$.val = &tree.CancelChangefeed{Job: $3.expr(), Time: $6.expr()}
+  }
+| CANCEL CHANGEFEED error // SHOW HELP: CANCEL CHANGEFEED
 
 // %Help: CANCEL JOBS - cancel background jobs
 // %Category: Misc
@@ -4270,10 +4289,18 @@ cancel_sessions_stmt:
 // %Category: Misc
 // %Text:
 // CANCEL ALL {BACKUP|CHANGEFEED|IMPORT|RESTORE} JOBS
+// CANCEL ALL CHANGEFEED JOBS WHERE <expr>
+//
+// The jobs of changefeeds can be filtered by the scheme of any of their sinks
+// (sink_scheme) and by their metrics_label option (metrics_label).
 cancel_all_jobs_stmt:
-  CANCEL ALL name JOBS
+  CANCEL ALL name JOBS opt_where_clause
   {
-    $$.val = &tree.ControlJobsOfType{Type: $3, Command: tree.CancelJob}
+    $$.val = &tree.ControlJobsOfType{
+      Type: $3,
+      Command: tree.CancelJob,
+      Where: tree.NewWhere(tree.AstWhere, $5.expr()),
+    }
   }
 | CANCEL ALL error // SHOW HELP: CANCEL ALL JOBS
 
@@ -5003,7 +5030,7 @@ create_stats_option:
 // %Category: CCL
 // %Text:
 // CREATE CHANGEFEED
-// FOR <targets> [INTO sink] [WITH <options>]
+// FOR <targets> [INTO sink | INTO (sink, sink [, ...])] [WITH <options>]
 //
 // sink: data capture stream destination (Enterprise only)
 create_changefeed_stmt:
@@ -5124,22 +5151,51 @@ changefeed_targets:
   }
 
 changefeed_target:
-  opt_table_prefix table_name opt_changefeed_family
+  table_name opt_changefeed_family
+  {
+    $$.val = tree.ChangefeedTarget{
+      TableName:  $1.unresolvedObjectName().ToUnresolvedName(),
+      FamilyName: tree.Name($2),
+    }
+  }
+| TABLE table_name opt_changefeed_family
   {
     $$.val = tree.ChangefeedTarget{
       TableName:  $2.unresolvedObjectName().ToUnresolvedName(),
       FamilyName: tree.Name($3),
     }
   }
+| table_name '@' index_name
+  {
+    $$.val = tree.ChangefeedTarget{
+      TableName: $1.unresolvedObjectName().ToUnresolvedName(),
+      IndexName: tree.UnrestrictedName($3),
+    }
+  }
+| TABLE table_name '@' index_name
+  {
+    $$.val = tree.ChangefeedTarget{
+      TableName: $2.unresolvedObjectName().ToUnresolvedName(),
+      IndexName: tree.UnrestrictedName($4),
+    }
+  }
+| SEQUENCE table_name
+  {
+    $$.val = tree.ChangefeedTarget{
+      TableName: $2.unresolvedObjectName().ToUnresolvedName(),
+      Sequence:  true,
+    }
+  }
+| VIEW table_name
+  {
+    $$.val = tree.ChangefeedTarget{
+      TableName: $2.unresolvedObjectName().ToUnresolvedName(),
+      View:      true,
+    }
+  }
 
 changefeed_target_expr: insert_target
 
-opt_table_prefix:
-  TABLE
-  {}
-| /* EMPTY */
-  {}
-
 opt_changefeed_family:
   FAMILY family_name
   {
@@ -5155,6 +5211,10 @@ opt_changefeed_sink:
   {
     $$.val = $2.expr()
   }
+| INTO '(' string_or_placeholder ',' string_or_placeholder_list ')'
+  {
+    $$.val = &tree.Tuple{Exprs: append(tree.Exprs{$3.expr()}, $5.exprs()...)}
+  }
 | /* EMPTY */
   {
     /* SKIP DOC */
@@ -5642,6 +5702,11 @@ explain_option_list:
 // %Category: CCL
 // %Text:
 // ALTER CHANGEFEED <job_id> {{ADD|DROP <targets...>} | SET <options...>}...
+// ALTER CHANGEFEED <job_id> SET TARGET <target> TOPIC <topic>
+//
+// SET TARGET ... TOPIC emits the changes of the target to the given topic,
+// rather than the topic named after it, while the other targets keep emitting
+// to their topics. An empty topic restores the default.
 alter_changefeed_stmt:
   ALTER CHANGEFEED a_expr alter_changefeed_cmds
   {
@@ -5672,10 +5737,11 @@ alter_changefeed_cmd:
     }
   }
   // ALTER CHANGEFEED <job_id> DROP [TABLE] ...
-| DROP changefeed_targets
+| DROP changefeed_targets opt_with_options
   {
     $$.val = &tree.AlterChangefeedDropTarget{
       Targets: $2.changefeedTargets(),
+      Options: $3.kvOptions(),
     }
   }
 | SET kv_option_list
@@ -5690,6 +5756,14 @@ alter_changefeed_cmd:
       Options: $2.nameList(),
     }
   }
+  // ALTER CHANGEFEED <job_id> SET TARGET [TABLE] ... TOPIC ...
+| SET_TARGET TARGET changefeed_target TOPIC string_or_placeholder
+  {
+    $$.val = &tree.AlterChangefeedSetTargetTopic{
+      Target: $3.changefeedTarget(),
+      Topic:  $5.expr(),
+    }
+  }
 
 // %Help: ALTER BACKUP - alter an existing backup's encryption keys
 // %Category: CCL
@@ -7704,6 +7778,10 @@ statements_or_queries:
 // SHOW [AUTOMATIC | CHANGEFEED] JOBS [select clause]
 // SHOW JOBS FOR SCHEDULES [select clause]
 // SHOW [CHANGEFEED] JOB <jobid>
+// SHOW CHANGEFEED JOBS [select clause] WITH DETAILS
+// SHOW CHANGEFEED JOB <jobid> WITH DETAILS
+// SHOW CHANGEFEED JOBS <select clause> WITH CHECKPOINT
+// SHOW CHANGEFEED JOB <jobid> WITH CHECKPOINT
 // %SeeAlso: CANCEL JOBS, PAUSE JOBS, RESUME JOBS
 show_jobs_stmt:
   SHOW AUTOMATIC JOBS
@@ -7718,6 +7796,10 @@ show_jobs_stmt:
   {
     $$.val = &tree.ShowChangefeedJobs{}
   }
+| SHOW CHANGEFEED JOBS WITH DETAILS
+  {
+    $$.val = &tree.ShowChangefeedJobs{Details: true}
+  }
 | SHOW AUTOMATIC JOBS error // SHOW HELP: SHOW JOBS
 | SHOW JOBS error // SHOW HELP: SHOW JOBS
 | SHOW CHANGEFEED JOBS error // SHOW HELP: SHOW JOBS
@@ -7737,6 +7819,14 @@ show_jobs_stmt:
   {
     $$.val = &tree.ShowChangefeedJobs{Jobs: $4.slct()}
   }
+| SHOW CHANGEFEED JOBS select_stmt WITH DETAILS
+  {
+    $$.val = &tree.ShowChangefeedJobs{Jobs: $4.slct(), Details: true}
+  }
+| SHOW CHANGEFEED JOBS select_stmt WITH CHECKPOINT
+  {
+    $$.val = &tree.ShowChangefeedJobs{Jobs: $4.slct(), Checkpoint: true}
+  }
 | SHOW JOBS select_stmt error // SHOW HELP: SHOW JOBS
 | SHOW JOB a_expr
   {
@@ -7754,6 +7844,24 @@ show_jobs_stmt:
       },
     }
   }
+| SHOW CHANGEFEED JOB a_expr WITH DETAILS
+  {
+    $$.val = &tree.ShowChangefeedJobs{
+      Jobs: &tree.Select{
+        Select: &tree.ValuesClause{Rows: []tree.Exprs{tree.Exprs{$4.expr()}}},
+      },
+      Details: true,
+    }
+  }
+| SHOW CHANGEFEED JOB a_expr WITH CHECKPOINT
+  {
+    $$.val = &tree.ShowChangefeedJobs{
+      Jobs: &tree.Select{
+        Select: &tree.ValuesClause{Rows: []tree.Exprs{tree.Exprs{$4.expr()}}},
+      },
+      Checkpoint: true,
+    }
+  }
 | SHOW JOB WHEN COMPLETE a_expr
   {
     $$.val = &tree.ShowJobs{
@@ -8761,10 +8869,18 @@ resume_stmt:
 // %Category: Misc
 // %Text:
 // RESUME ALL {BACKUP|CHANGEFEED|IMPORT|RESTORE} JOBS
+// RESUME ALL CHANGEFEED JOBS WHERE <expr>
+//
+// The jobs of changefeeds can be filtered by the scheme of any of their sinks
+// (sink_scheme) and by their metrics_label option (metrics_label).
 resume_all_jobs_stmt:
-  RESUME ALL name JOBS
+  RESUME ALL name JOBS opt_where_clause
   {
-    $$.val = &tree.ControlJobsOfType{Type: $3, Command: tree.ResumeJob}
+    $$.val = &tree.ControlJobsOfType{
+      Type: $3,
+      Command: tree.ResumeJob,
+      Where: tree.NewWhere(tree.AstWhere, $5.expr()),
+    }
   }
 | RESUME ALL error // SHOW HELP: RESUME ALL JOBS
 
@@ -8853,10 +8969,18 @@ pause_schedules_stmt:
 // %Category: Misc
 // %Text:
 // PAUSE ALL {BACKUP|CHANGEFEED|IMPORT|RESTORE} JOBS
+// PAUSE ALL CHANGEFEED JOBS WHERE <expr>
+//
+// The jobs of changefeeds can be filtered by the scheme of any of their sinks
+// (sink_scheme) and by their metrics_label option (metrics_label).
 pause_all_jobs_stmt:
-  PAUSE ALL name JOBS
+  PAUSE ALL name JOBS opt_where_clause
   {
-    $$.val = &tree.ControlJobsOfType{Type: $3, Command: tree.PauseJob}
+    $$.val = &tree.ControlJobsOfType{
+      Type: $3,
+      Command: tree.PauseJob,
+      Where: tree.NewWhere(tree.AstWhere, $5.expr()),
+    }
   }
 | PAUSE ALL error // SHOW HELP: PAUSE ALL JOBS
 
@@ -16148,6 +16272,7 @@ unreserved_keyword:
 | CAPABILITY
 | CASCADE
 | CHANGEFEED
+| CHECKPOINT
 | CHECK_FILES
 | CLOSE
 | CLUSTER
@@ -16507,6 +16632,7 @@ unreserved_keyword:
 | SYSTEM
 | TABLES
 | TABLESPACE
+| TARGET
 | TEMP
 | TEMPLATE
 | TEMPORARY
@@ -16516,6 +16642,7 @@ unreserved_keyword:
 | TESTING_RELOCATE
 | TEXT
 | TIES
+| TOPIC
 | TRACE
 | TRACING
 | TRANSACTION
@@ -16619,6 +16746,7 @@ bare_label_keywords:
 | CHANGEFEED
 | CHARACTERISTICS
 | CHECK
+| CHECKPOINT
 | CHECK_FILES
 | CLOSE
 | CLUSTER
@@ -17060,6 +17188,7 @@ bare_label_keywords:
 | TABLE
 | TABLES
 | TABLESPACE
+| TARGET
 | TEMP
 | TEMPLATE
 | TEMPORARY
@@ -17075,6 +17204,7 @@ bare_label_keywords:
 | TIMESTAMP
 | TIMESTAMPTZ
 | TIMETZ
+| TOPIC
 | TRACE
 | TRACING
 | TRAILING
@@ -4831,6 +4831,13 @@ func (h oidHasher) EnumEntryOid(typOID *tree.DOid, physicalRep []byte) *tree.DOi
 	return h.getOid()
 }
 
+// EnumMemberOid returns the OID of the member of an enum type with the given
+// physical representation, as shown by pg_catalog.pg_enum. It is unaffected by
+// members being added to the enum, or the member being renamed.
+func EnumMemberOid(typOID oid.Oid, physicalRep []byte) oid.Oid {
+	return makeOidHasher().EnumEntryOid(tree.NewDOid(typOID), physicalRep).Oid
+}
+
 func (h oidHasher) rewriteOid(source descpb.ID, depended descpb.ID) *tree.DOid {
 	h.writeTypeTag(rewriteTypeTag)
 	h.writeUInt32(uint32(source))
@@ -2342,6 +2342,10 @@ var builtinOidsArray = []string{
 	2368: `pg_advisory_unlock_shared(key: int) -> bool`,
 	2369: `pg_advisory_unlock_shared(key1: int4, key2: int4) -> bool`,
 	2370: `pg_advisory_unlock_all() -> void`,
+	2371: `crdb_internal.changefeed_usage() -> jsonb`,
+	2372: `crdb_internal.changefeed_replay_dead_letters(dead_letter_table: string, job_id: int) -> int`,
+	2373: `crdb_internal.preview_changefeed(changefeed: string, limit: int) -> tuple{string AS topic, string AS key, string AS value}`,
+	2374: `crdb_internal.changefeed_events(job_id: int, cursor: string) -> tuple{string AS topic, string AS key, string AS value, string AS resolved}`,
 }
 
 var builtinOidsBySignature map[string]oid.Oid
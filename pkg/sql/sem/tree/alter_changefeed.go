@@ -46,15 +46,17 @@ type AlterChangefeedCmd interface {
 	alterChangefeedCmd()
 }
 
-func (*AlterChangefeedAddTarget) alterChangefeedCmd()    {}
-func (*AlterChangefeedDropTarget) alterChangefeedCmd()   {}
-func (*AlterChangefeedSetOptions) alterChangefeedCmd()   {}
-func (*AlterChangefeedUnsetOptions) alterChangefeedCmd() {}
+func (*AlterChangefeedAddTarget) alterChangefeedCmd()      {}
+func (*AlterChangefeedDropTarget) alterChangefeedCmd()     {}
+func (*AlterChangefeedSetOptions) alterChangefeedCmd()     {}
+func (*AlterChangefeedUnsetOptions) alterChangefeedCmd()   {}
+func (*AlterChangefeedSetTargetTopic) alterChangefeedCmd() {}
 
 var _ AlterChangefeedCmd = &AlterChangefeedAddTarget{}
 var _ AlterChangefeedCmd = &AlterChangefeedDropTarget{}
 var _ AlterChangefeedCmd = &AlterChangefeedSetOptions{}
 var _ AlterChangefeedCmd = &AlterChangefeedUnsetOptions{}
+var _ AlterChangefeedCmd = &AlterChangefeedSetTargetTopic{}
 
 // AlterChangefeedAddTarget represents an ADD <targets> command
 type AlterChangefeedAddTarget struct {
@@ -75,12 +77,17 @@ func (node *AlterChangefeedAddTarget) Format(ctx *FmtCtx) {
 // AlterChangefeedDropTarget represents an DROP <targets> command
 type AlterChangefeedDropTarget struct {
 	Targets ChangefeedTargets
+	Options KVOptions
 }
 
 // Format implements the NodeFormatter interface.
 func (node *AlterChangefeedDropTarget) Format(ctx *FmtCtx) {
 	ctx.WriteString(" DROP ")
 	ctx.FormatNode(&node.Targets)
+	if node.Options != nil {
+		ctx.WriteString(" WITH ")
+		ctx.FormatNode(&node.Options)
+	}
 }
 
 // AlterChangefeedSetOptions represents an SET <options> command
@@ -104,3 +111,18 @@ func (node *AlterChangefeedUnsetOptions) Format(ctx *FmtCtx) {
 	ctx.WriteString(" UNSET ")
 	ctx.FormatNode(&node.Options)
 }
+
+// AlterChangefeedSetTargetTopic represents a SET TARGET <target> TOPIC <topic>
+// command.
+type AlterChangefeedSetTargetTopic struct {
+	Target ChangefeedTarget
+	Topic  Expr
+}
+
+// Format implements the NodeFormatter interface.
+func (node *AlterChangefeedSetTargetTopic) Format(ctx *FmtCtx) {
+	ctx.WriteString(" SET TARGET ")
+	ctx.FormatNode(&node.Target)
+	ctx.WriteString(" TOPIC ")
+	ctx.FormatNode(node.Topic)
+}
@@ -0,0 +1,28 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package tree
+
+// CancelChangefeed represents a CANCEL CHANGEFEED ... AT TIME statement,
+// which gracefully drains a changefeed up to the given timestamp.
+type CancelChangefeed struct {
+	Job  Expr
+	Time Expr
+}
+
+var _ Statement = &CancelChangefeed{}
+
+// Format implements the NodeFormatter interface.
+func (node *CancelChangefeed) Format(ctx *FmtCtx) {
+	ctx.WriteString(`CANCEL CHANGEFEED `)
+	ctx.FormatNode(node.Job)
+	ctx.WriteString(` AT TIME `)
+	ctx.FormatNode(node.Time)
+}
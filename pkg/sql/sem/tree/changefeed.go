@@ -18,6 +18,8 @@ import (
 // CreateChangefeed represents a CREATE CHANGEFEED statement.
 type CreateChangefeed struct {
 	Targets ChangefeedTargets
+	// SinkURI is the sink expression, or a *Tuple of them for changefeeds
+	// emitting to multiple sinks.
 	SinkURI Expr
 	Options KVOptions
 	Select  *SelectClause
@@ -72,12 +74,30 @@ func (node *CreateChangefeed) formatWithPredicates(ctx *FmtCtx) {
 type ChangefeedTarget struct {
 	TableName  TablePattern
 	FamilyName Name
+	// IndexName is set if the target was specified as a secondary index of
+	// the table, in which case the changefeed watches the entries of the
+	// index rather than the rows of the table.
+	IndexName UnrestrictedName
+	// Sequence is true if the target was specified as a SEQUENCE.
+	Sequence bool
+	// View is true if the target was specified as a VIEW.
+	View bool
 }
 
 // Format implements the NodeFormatter interface.
 func (ct *ChangefeedTarget) Format(ctx *FmtCtx) {
-	ctx.WriteString("TABLE ")
+	if ct.Sequence {
+		ctx.WriteString("SEQUENCE ")
+	} else if ct.View {
+		ctx.WriteString("VIEW ")
+	} else {
+		ctx.WriteString("TABLE ")
+	}
 	ctx.FormatNode(ct.TableName)
+	if ct.IndexName != "" {
+		ctx.WriteByte('@')
+		ctx.FormatNode(&ct.IndexName)
+	}
 	if ct.FamilyName != "" {
 		ctx.WriteString(" FAMILY ")
 		ctx.FormatNode(&ct.FamilyName)
@@ -125,6 +125,8 @@ type ControlJobsForSchedules struct {
 type ControlJobsOfType struct {
 	Type    string
 	Command JobCommand
+	// Where, if set, filters the jobs of the type the command applies to.
+	Where *Where
 }
 
 // Format implements the NodeFormatter interface.
@@ -133,6 +135,10 @@ func (n *ControlJobsOfType) Format(ctx *FmtCtx) {
 	ctx.WriteString(" ALL ")
 	ctx.WriteString(n.Type)
 	ctx.WriteString(" JOBS")
+	if n.Where != nil {
+		ctx.WriteByte(' ')
+		ctx.FormatNode(n.Where)
+	}
 }
 
 // Format implements NodeFormatter interface.
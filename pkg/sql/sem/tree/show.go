@@ -484,6 +484,11 @@ func (node *ShowJobs) Format(ctx *FmtCtx) {
 type ShowChangefeedJobs struct {
 	// If non-nil, a select statement that provides the job ids to be shown.
 	Jobs *Select
+	// Details, if set, adds the status of each node running the changefeed.
+	Details bool
+	// Checkpoint, if set, adds the changefeed's progress serialized for use
+	// with the restore_checkpoint option of CREATE CHANGEFEED.
+	Checkpoint bool
 }
 
 // Format implements the NodeFormatter interface.
@@ -493,6 +498,12 @@ func (node *ShowChangefeedJobs) Format(ctx *FmtCtx) {
 		ctx.WriteString(" ")
 		ctx.FormatNode(node.Jobs)
 	}
+	if node.Details {
+		ctx.WriteString(" WITH DETAILS")
+	}
+	if node.Checkpoint {
+		ctx.WriteString(" WITH CHECKPOINT")
+	}
 }
 
 // ShowSurvivalGoal represents a SHOW REGIONS statement
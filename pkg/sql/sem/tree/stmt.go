@@ -195,6 +195,7 @@ var _ CCLOnlyStatement = &ShowBackup{}
 var _ CCLOnlyStatement = &Restore{}
 var _ CCLOnlyStatement = &CreateChangefeed{}
 var _ CCLOnlyStatement = &AlterChangefeed{}
+var _ CCLOnlyStatement = &CancelChangefeed{}
 var _ CCLOnlyStatement = &Import{}
 var _ CCLOnlyStatement = &Export{}
 var _ CCLOnlyStatement = &ScheduledBackup{}
@@ -638,6 +639,17 @@ func (n *ControlJobsOfType) StatementTag() string {
 	return fmt.Sprintf("%s ALL %s JOBS", JobCommandToStatement[n.Command], strings.ToUpper(n.Type))
 }
 
+// StatementReturnType implements the Statement interface.
+func (*CancelChangefeed) StatementReturnType() StatementReturnType { return Rows }
+
+// StatementType implements the Statement interface.
+func (*CancelChangefeed) StatementType() StatementType { return TypeDML }
+
+// StatementTag returns a short string identifying the type of statement.
+func (*CancelChangefeed) StatementTag() string { return `CANCEL CHANGEFEED` }
+
+func (*CancelChangefeed) cclOnlyStatement() {}
+
 // StatementReturnType implements the Statement interface.
 func (*CancelQueries) StatementReturnType() StatementReturnType { return RowsAffected }
 
@@ -2162,6 +2174,7 @@ func (n *ControlJobs) String() string                         { return AsString(
 func (n *ControlSchedules) String() string                    { return AsString(n) }
 func (n *ControlJobsForSchedules) String() string             { return AsString(n) }
 func (n *ControlJobsOfType) String() string                   { return AsString(n) }
+func (n *CancelChangefeed) String() string                    { return AsString(n) }
 func (n *CancelQueries) String() string                       { return AsString(n) }
 func (n *CancelSessions) String() string                      { return AsString(n) }
 func (n *CannedOptPlan) String() string                       { return AsString(n) }
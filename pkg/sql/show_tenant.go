@@ -125,6 +125,10 @@ func (n *showTenantNode) getTenantValues(
 				name:  tenantcapabilitiespb.CanViewTSDBMetrics,
 				value: strconv.FormatBool(capabilities.CanViewTSDBMetrics),
 			},
+			{
+				name:  tenantcapabilitiespb.CanBeChangefeedSource,
+				value: strconv.FormatBool(capabilities.CanBeChangefeedSource),
+			},
 		}
 	}
 
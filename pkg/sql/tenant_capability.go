@@ -25,9 +25,10 @@ import (
 )
 
 var capabilityTypes = map[tenantcapabilitiespb.TenantCapabilityName]*types.T{
-	tenantcapabilitiespb.CanAdminSplit:      types.Bool,
-	tenantcapabilitiespb.CanViewNodeInfo:    types.Bool,
-	tenantcapabilitiespb.CanViewTSDBMetrics: types.Bool,
+	tenantcapabilitiespb.CanAdminSplit:         types.Bool,
+	tenantcapabilitiespb.CanViewNodeInfo:       types.Bool,
+	tenantcapabilitiespb.CanViewTSDBMetrics:    types.Bool,
+	tenantcapabilitiespb.CanBeChangefeedSource: types.Bool,
 }
 
 const alterTenantCapabilityOp = "ALTER TENANT CAPABILITY"
@@ -179,6 +180,20 @@ func (n *alterTenantCapabilityNode) startExec(params runParams) error {
 				dst.CanViewTSDBMetrics = b
 			}
 
+		case tenantcapabilitiespb.CanBeChangefeedSource:
+			if n.n.IsRevoke {
+				dst.CanBeChangefeedSource = false
+			} else {
+				b := true
+				if typedExpr != nil {
+					b, err = paramparse.DatumAsBool(ctx, p.EvalContext(), capabilityName.String(), typedExpr)
+					if err != nil {
+						return err
+					}
+				}
+				dst.CanBeChangefeedSource = b
+			}
+
 		default:
 			return errors.AssertionFailedf("unhandled: %q", capabilityName)
 		}
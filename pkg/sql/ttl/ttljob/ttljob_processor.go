@@ -16,6 +16,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/clusterversion"
 	"github.com/cockroachdb/cockroach/pkg/jobs"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
@@ -296,6 +297,14 @@ func (t *ttlProcessor) runTTLOnSpan(
 			}
 			deleteBatch := expiredRowsPKs[startRowIdx:until]
 			do := func(ctx context.Context, txn isql.Txn) error {
+				// Mark the deletes of the transaction so that changefeeds can
+				// tell them apart from the deletes of users, once every node
+				// understands the mark.
+				if serverCfg.Settings.Version.IsActive(ctx, clusterversion.V23_1RowLevelTTLValueHeader) {
+					if err := txn.KV().SetRowLevelTTL(); err != nil {
+						return err
+					}
+				}
 				// If we detected a schema change here, the DELETE will not succeed
 				// (the SELECT still will because of the AOST). Early exit here.
 				desc, err := flowCtx.Descriptors.ByIDWithLeased(txn.KV()).WithoutNonPublic().Get().Table(ctx, details.TableID)
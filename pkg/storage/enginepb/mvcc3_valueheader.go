@@ -18,12 +18,13 @@ func (h MVCCValueHeader) IsEmpty() bool {
 	// NB: We don't use a struct comparison like h == MVCCValueHeader{} due to a
 	// Go 1.19 performance regression, see:
 	// https://github.com/cockroachdb/cockroach/issues/88818
-	return h.LocalTimestamp.IsEmpty() && h.KVNemesisSeq.Get() == 0
+	return h.LocalTimestamp.IsEmpty() && h.KVNemesisSeq.Get() == 0 && !h.RowLevelTTL
 }
 
 func (h *MVCCValueHeader) pure() MVCCValueHeaderPure {
 	return MVCCValueHeaderPure{
 		LocalTimestamp: h.LocalTimestamp,
+		RowLevelTTL:    h.RowLevelTTL,
 	}
 }
 
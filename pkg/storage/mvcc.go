@@ -2136,6 +2136,12 @@ func mvccPutInternal(
 		!writer.ShouldWriteLocalTimestamps(ctx) {
 		versionValue.LocalTimestamp = hlc.ClockTimestamp{}
 	}
+	// Record writes of the row-level TTL job so that rangefeeds can surface
+	// them. Transactions are only marked once the V23_1RowLevelTTLValueHeader
+	// cluster version is active, so every node understands the mark.
+	if txn != nil && txn.RowLevelTTL {
+		versionValue.RowLevelTTL = true
+	}
 
 	// Write the mvcc metadata now that we have sizes for the latest
 	// versioned value. For values, the size of keys is always accounted
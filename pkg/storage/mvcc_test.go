@@ -1668,6 +1668,51 @@ func TestMVCCUncommittedDeleteRangeVisible(t *testing.T) {
 	}
 }
 
+// TestMVCCWriteRowLevelTTL tests that writes made by a transaction marked
+// as a row-level TTL deletion carry the mark in their value header, and that
+// writes by other transactions do not.
+func TestMVCCWriteRowLevelTTL(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+	DisableMetamorphicSimpleValueEncoding(t)
+
+	ctx := context.Background()
+	engine := NewDefaultInMemForTesting()
+	defer engine.Close()
+
+	ts := hlc.Timestamp{WallTime: 1}
+	ttlTxn := makeTxn(*txn1, ts)
+	ttlTxn.RowLevelTTL = true
+	require.NoError(t, MVCCPut(ctx, engine, nil, testKey1, ts, hlc.ClockTimestamp{}, value1, ttlTxn))
+	_, err := MVCCDelete(ctx, engine, nil, testKey2, ts, hlc.ClockTimestamp{}, ttlTxn)
+	require.NoError(t, err)
+	require.NoError(t, MVCCPut(ctx, engine, nil, testKey3, ts, hlc.ClockTimestamp{}, value3, makeTxn(*txn2, ts)))
+
+	for _, tc := range []struct {
+		key         roachpb.Key
+		rowLevelTTL bool
+		tombstone   bool
+	}{
+		{key: testKey1, rowLevelTTL: true},
+		{key: testKey2, rowLevelTTL: true, tombstone: true},
+		{key: testKey3},
+	} {
+		iter := engine.NewMVCCIterator(MVCCKeyIterKind, IterOptions{Prefix: true})
+		iter.SeekGE(MVCCKey{Key: tc.key, Timestamp: ts})
+		ok, err := iter.Valid()
+		require.NoError(t, err)
+		require.True(t, ok)
+		raw, err := iter.UnsafeValue()
+		require.NoError(t, err)
+		v, err := DecodeMVCCValue(raw)
+		require.NoError(t, err)
+		iter.Close()
+
+		require.Equal(t, tc.rowLevelTTL, v.RowLevelTTL, "key %s", tc.key)
+		require.Equal(t, tc.tombstone, v.IsTombstone(), "key %s", tc.key)
+	}
+}
+
 // TestMVCCDeleteRangeOldTimestamp tests a case where a delete range with an
 // older timestamp happens after a delete with a newer timestamp.
 func TestMVCCDeleteRangeOldTimestamp(t *testing.T) {
@@ -134,6 +134,12 @@ func (v MVCCValue) SafeFormat(w redact.SafePrinter, _ rune) {
 		if !v.LocalTimestamp.IsEmpty() {
 			w.Printf("localTs=%s", v.LocalTimestamp)
 		}
+		if v.RowLevelTTL {
+			if !v.LocalTimestamp.IsEmpty() {
+				w.Printf(", ")
+			}
+			w.Printf("rowLevelTTL")
+		}
 		w.Printf("}")
 	}
 	w.Print(v.Value.PrettyPrint())
@@ -102,6 +102,16 @@ func TestMVCCValueFormat(t *testing.T) {
 		"header+tombstone": {val: MVCCValue{MVCCValueHeader: valHeader}, expect: "{localTs=0.000000009,0}/<empty>"},
 		"header+bytes":     {val: MVCCValue{MVCCValueHeader: valHeader, Value: strVal}, expect: "{localTs=0.000000009,0}/BYTES/foo"},
 		"header+int":       {val: MVCCValue{MVCCValueHeader: valHeader, Value: intVal}, expect: "{localTs=0.000000009,0}/INT/17"},
+		"ttl+tombstone": {
+			val:    MVCCValue{MVCCValueHeader: enginepb.MVCCValueHeader{RowLevelTTL: true}},
+			expect: "{rowLevelTTL}/<empty>",
+		},
+		"header+ttl+tombstone": {
+			val: MVCCValue{MVCCValueHeader: enginepb.MVCCValueHeader{
+				LocalTimestamp: valHeader.LocalTimestamp, RowLevelTTL: true,
+			}},
+			expect: "{localTs=0.000000009,0, rowLevelTTL}/<empty>",
+		},
 	}
 	for name, tc := range testcases {
 		t.Run(name, func(t *testing.T) {
@@ -158,6 +168,42 @@ func TestEncodeDecodeMVCCValue(t *testing.T) {
 	}
 }
 
+func TestEncodeDecodeMVCCValueRowLevelTTL(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var strVal roachpb.Value
+	strVal.SetString("foo")
+
+	for name, val := range map[string]MVCCValue{
+		"tombstone": {MVCCValueHeader: enginepb.MVCCValueHeader{RowLevelTTL: true}},
+		"bytes":     {MVCCValueHeader: enginepb.MVCCValueHeader{RowLevelTTL: true}, Value: strVal},
+		"localTs+tombstone": {MVCCValueHeader: enginepb.MVCCValueHeader{
+			LocalTimestamp: hlc.ClockTimestamp{WallTime: 9}, RowLevelTTL: true,
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// The mark alone makes the header non-empty, so the value takes the
+			// extended encoding even without a local timestamp.
+			require.False(t, val.MVCCValueHeader.IsEmpty())
+			enc, err := EncodeMVCCValue(val)
+			require.NoError(t, err)
+			require.Equal(t, encodedMVCCValueSize(val), len(enc))
+
+			dec, err := DecodeMVCCValue(enc)
+			require.NoError(t, err)
+			if len(dec.Value.RawBytes) == 0 {
+				dec.Value.RawBytes = nil // normalize
+			}
+			require.Equal(t, val, dec)
+			require.True(t, dec.RowLevelTTL)
+
+			isTombstone, err := EncodedMVCCValueIsTombstone(enc)
+			require.NoError(t, err)
+			require.Equal(t, val.IsTombstone(), isTombstone)
+		})
+	}
+}
+
 func TestDecodeMVCCValueErrors(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -1811,6 +1811,10 @@ func (tc *TestCluster) WaitForTenantCapabilities(
 						if !capabilities.CanViewTSDBMetrics {
 							return missingCapabilityError(capabilityName)
 						}
+					case tenantcapabilitiespb.CanBeChangefeedSource:
+						if !capabilities.CanBeChangefeedSource {
+							return missingCapabilityError(capabilityName)
+						}
 					default:
 						t.Fatalf("unrecognized capability: %q", capabilityName)
 					}
@@ -1499,6 +1499,19 @@ var charts = []sectionDescription{
 					"changefeed.replan_count",
 				},
 			},
+			{
+				Title: "Admission",
+				Metrics: []string{
+					"changefeed.admission.admitted",
+					"changefeed.admission.pending",
+				},
+			},
+			{
+				Title: "Sink Client Pool",
+				Metrics: []string{
+					"changefeed.sink_client_pool.clients",
+				},
+			},
 			{
 				Title: "Nprocs Consume Event Nanos",
 				Metrics: []string{
@@ -1569,6 +1582,7 @@ var charts = []sectionDescription{
 					"changefeed.bytes.messages_pushback_nanos",
 					"changefeed.messages.messages_pushback_nanos",
 					"changefeed.flush.messages_pushback_nanos",
+					"changefeed.scan_throttled_nanos",
 				},
 			},
 			{
@@ -1583,6 +1597,72 @@ var charts = []sectionDescription{
 					"changefeed.internal_retry_message_count",
 				},
 			},
+			{
+				Title: "Sink Host Emitted Bytes",
+				Metrics: []string{
+					"changefeed.sink_host.emitted_bytes",
+				},
+			},
+			{
+				Title: "Sink Host Emitted Messages",
+				Metrics: []string{
+					"changefeed.sink_host.emitted_messages",
+				},
+			},
+			{
+				Title: "Sink Host Errors",
+				Metrics: []string{
+					"changefeed.sink_host.errors",
+				},
+			},
+			{
+				Title: "Sink Host Latency",
+				Metrics: []string{
+					"changefeed.sink_host.latency",
+				},
+			},
+			{
+				Title: "Kafka Throttling",
+				Metrics: []string{
+					"changefeed.kafka_throttling_hist_nanos",
+				},
+			},
+			{
+				Title: "Sink Credential Reloads",
+				Metrics: []string{
+					"changefeed.sink_credentials.reloads",
+				},
+			},
+			{
+				Title: "Table Emitted Messages",
+				Metrics: []string{
+					"changefeed.table.emitted_messages",
+				},
+			},
+			{
+				Title: "Table Emitted Bytes",
+				Metrics: []string{
+					"changefeed.table.emitted_bytes",
+				},
+			},
+			{
+				Title: "Duplicate Messages",
+				Metrics: []string{
+					"changefeed.duplicate_messages",
+				},
+			},
+			{
+				Title: "Table Duplicate Messages",
+				Metrics: []string{
+					"changefeed.table.duplicate_messages",
+				},
+			},
+			{
+				Title: "Checkpointed Emitted Bytes",
+				Metrics: []string{
+					"changefeed.checkpointed_emitted_bytes",
+				},
+			},
 		},
 	},
 	{